@@ -99,6 +99,13 @@ type Operation struct {
 	// Input/output/control options.
 	UIIn  terraform.UIInput
 	UIOut terraform.UIOutput
+
+	// StopContext, if set, is canceled to stop the operation right away
+	// after the context given to Backend.Operation was canceled, such as on
+	// a second interrupt. Canceling the context only lets what's in flight
+	// finish, while stopping asks the providers and provisioners to cancel
+	// it too. Not every backend supports it.
+	StopContext context.Context
 }
 
 // RunningOperation is the result of starting an operation.
@@ -86,11 +86,26 @@ func (b *Local) opApply(
 			b.CLI.Output("Interrupt received. Gracefully shutting down...")
 		}
 
-		// Stop execution
-		go tfCtx.Stop()
+		// Stop execution, letting the resources that are being applied
+		// finish so that they're recorded in the state
+		go tfCtx.Interrupt()
+
+		// Wait for completion still, unless we're asked to stop what's
+		// in flight as well
+		var stopCh <-chan struct{}
+		if op.StopContext != nil {
+			stopCh = op.StopContext.Done()
+		}
+		select {
+		case <-stopCh:
+			if b.CLI != nil {
+				b.CLI.Output("Stopping the operations in progress...")
+			}
 
-		// Wait for completion still
-		<-doneCh
+			go tfCtx.Stop()
+			<-doneCh
+		case <-doneCh:
+		}
 	case <-doneCh:
 	}
 
@@ -107,6 +122,15 @@ func (b *Local) opApply(
 		return
 	}
 
+	// Show any warnings from the apply, such as resources whose state
+	// doesn't match the plan
+	if ws := tfCtx.ApplyWarnings(); b.CLI != nil && len(ws) > 0 {
+		b.CLI.Warn("Warnings:\n")
+		for _, w := range ws {
+			b.CLI.Warn(fmt.Sprintf("  * %s", w))
+		}
+	}
+
 	if applyErr != nil {
 		runningOp.Err = fmt.Errorf(
 			"Error applying plan:\n\n"+
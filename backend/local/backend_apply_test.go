@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/terraform/backend"
 	"github.com/hashicorp/terraform/config/module"
@@ -104,6 +105,65 @@ test_instance.foo:
 	`)
 }
 
+func TestLocal_applyStop(t *testing.T) {
+	b := TestLocal(t)
+	p := TestLocalProvider(t, b, "test")
+
+	startedCh := make(chan struct{})
+	stoppedCh := make(chan struct{})
+	p.StopFn = func() error {
+		close(stoppedCh)
+		return nil
+	}
+	p.ApplyFn = func(
+		info *terraform.InstanceInfo,
+		s *terraform.InstanceState,
+		d *terraform.InstanceDiff) (*terraform.InstanceState, error) {
+		close(startedCh)
+
+		// Only stopping the provider ends the apply
+		select {
+		case <-stoppedCh:
+		case <-time.After(5 * time.Second):
+			return nil, fmt.Errorf("provider wasn't stopped")
+		}
+
+		return &terraform.InstanceState{ID: "yes"}, nil
+	}
+
+	mod, modCleanup := module.TestTree(t, "./test-fixtures/apply")
+	defer modCleanup()
+
+	ctx, ctxCancel := context.WithCancel(context.Background())
+	defer ctxCancel()
+	stopCtx, stopCtxCancel := context.WithCancel(context.Background())
+	defer stopCtxCancel()
+
+	op := testOperationApply()
+	op.Module = mod
+	op.StopContext = stopCtx
+
+	run, err := b.Operation(ctx, op)
+	if err != nil {
+		t.Fatalf("bad: %s", err)
+	}
+
+	// Interrupt, then stop
+	<-startedCh
+	ctxCancel()
+	stopCtxCancel()
+
+	<-run.Done()
+	if run.Err != nil {
+		t.Fatalf("err: %s", run.Err)
+	}
+
+	checkState(t, b.StateOutPath, `
+test_instance.foo:
+  ID = yes
+	`)
+}
+
 func testOperationApply() *backend.Operation {
 	return &backend.Operation{
 		Type: backend.OperationTypeApply,
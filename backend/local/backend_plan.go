@@ -105,6 +105,14 @@ func (b *Local) opPlan(
 
 	// Perform some output tasks if we have a CLI to output to.
 	if b.CLI != nil {
+		if len(plan.Warnings) > 0 {
+			b.CLI.Warn("Warnings:\n")
+			for _, w := range plan.Warnings {
+				b.CLI.Warn(fmt.Sprintf(
+					"  * %s: %s", strings.Join(w.Resources, ", "), w.Message))
+			}
+		}
+
 		if plan.Diff.Empty() {
 			b.CLI.Output(b.Colorize().Color(strings.TrimSpace(planNoChanges)))
 			return
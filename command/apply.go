@@ -183,9 +183,13 @@ func (c *ApplyCommand) Run(args []string) int {
 	opReq.PlanRefresh = refresh
 	opReq.Type = backend.OperationTypeApply
 
-	// Perform the operation
+	// Perform the operation. The first interrupt lets what's in flight
+	// finish, the second stops it too.
 	ctx, ctxCancel := context.WithCancel(context.Background())
 	defer ctxCancel()
+	stopCtx, stopCtxCancel := context.WithCancel(context.Background())
+	defer stopCtxCancel()
+	opReq.StopContext = stopCtx
 	op, err := b.Operation(ctx, opReq)
 	if err != nil {
 		c.Ui.Error(fmt.Sprintf("Error starting operation: %s", err))
@@ -204,10 +208,19 @@ func (c *ApplyCommand) Run(args []string) int {
 		// Still get the result, since there is still one
 		select {
 		case <-c.ShutdownCh:
-			c.Ui.Error(
-				"Two interrupts received. Exiting immediately. Note that data\n" +
-					"loss may have occurred.")
-			return 1
+			// Stop the operations in flight as well
+			stopCtxCancel()
+
+			c.Ui.Output("Two interrupts received. Stopping the operations in progress...")
+
+			select {
+			case <-c.ShutdownCh:
+				c.Ui.Error(
+					"Three interrupts received. Exiting immediately. Note that data\n" +
+						"loss may have occurred.")
+				return 1
+			case <-op.Done():
+			}
 		case <-op.Done():
 		}
 	case <-op.Done():
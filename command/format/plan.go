@@ -134,7 +134,7 @@ func formatPlanModuleExpand(
 		// determine the longest key so that we can align them all.
 		keyLen := 0
 		keys := make([]string, 0, len(rdiff.Attributes))
-		for key, _ := range rdiff.Attributes {
+		for _, key := range rdiff.SortedAttributeKeys() {
 			// Skip the ID since we do that specially
 			if key == "id" {
 				continue
@@ -145,7 +145,6 @@ func formatPlanModuleExpand(
 				keyLen = len(key)
 			}
 		}
-		sort.Strings(keys)
 
 		// Go through and output each attribute
 		for _, attrK := range keys {
@@ -194,6 +193,18 @@ func formatPlanModuleExpand(
 		// Write the reset color so we don't overload the user's terminal
 		buf.WriteString(opts.Color.Color("[reset]\n"))
 	}
+
+	// Resources with a computed count are only expanded during apply, so
+	// we can't show their instances yet.
+	for _, name := range m.DeferredCount {
+		if moduleName != "" {
+			name = moduleName + "." + name
+		}
+
+		buf.WriteString(opts.Color.Color(fmt.Sprintf(
+			"[yellow]~ %s (count computed, expanded during apply)\n", name)))
+		buf.WriteString(opts.Color.Color("[reset]\n"))
+	}
 }
 
 // formatPlanModuleSingle will output the given module and all of its
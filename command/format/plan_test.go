@@ -43,6 +43,38 @@ func TestPlan_destroyDeposed(t *testing.T) {
 	}
 }
 
+// Test that resources deferred to apply get displayed
+func TestPlan_deferredCount(t *testing.T) {
+	plan := &terraform.Plan{
+		Diff: &terraform.Diff{
+			Modules: []*terraform.ModuleDiff{
+				&terraform.ModuleDiff{
+					Path:          []string{"root", "child"},
+					Resources:     map[string]*terraform.InstanceDiff{},
+					DeferredCount: []string{"aws_instance.foo"},
+				},
+			},
+		},
+	}
+	opts := &PlanOpts{
+		Plan: plan,
+		Color: &colorstring.Colorize{
+			Colors:  colorstring.DefaultColors,
+			Disable: true,
+		},
+		ModuleDepth: 1,
+	}
+
+	actual := Plan(opts)
+
+	expected := strings.TrimSpace(`
+~ module.child.aws_instance.foo (count computed, expanded during apply)
+	`)
+	if actual != expected {
+		t.Fatalf("expected:\n\n%s\n\ngot:\n\n%s", expected, actual)
+	}
+}
+
 // Test that computed fields with an interpolation string get displayed
 func TestPlan_displayInterpolations(t *testing.T) {
 	plan := &terraform.Plan{
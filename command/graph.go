@@ -22,6 +22,7 @@ func (c *GraphCommand) Run(args []string) int {
 	var verbose bool
 	var drawCycles bool
 	var graphTypeStr string
+	var format string
 
 	args = c.Meta.process(args, false)
 
@@ -30,11 +31,17 @@ func (c *GraphCommand) Run(args []string) int {
 	cmdFlags.BoolVar(&verbose, "verbose", false, "verbose")
 	cmdFlags.BoolVar(&drawCycles, "draw-cycles", false, "draw-cycles")
 	cmdFlags.StringVar(&graphTypeStr, "type", "", "type")
+	cmdFlags.StringVar(&format, "format", "dot", "format")
 	cmdFlags.Usage = func() { c.Ui.Error(c.Help()) }
 	if err := cmdFlags.Parse(args); err != nil {
 		return 1
 	}
 
+	if format != "dot" && format != "mermaid" {
+		c.Ui.Error(fmt.Sprintf("Invalid graph format requested: %s", format))
+		return 1
+	}
+
 	configPath, err := ModulePath(cmdFlags.Args())
 	if err != nil {
 		c.Ui.Error(err.Error())
@@ -118,11 +125,17 @@ func (c *GraphCommand) Run(args []string) int {
 		return 1
 	}
 
-	graphStr, err := terraform.GraphDot(g, &dag.DotOpts{
-		DrawCycles: drawCycles,
-		MaxDepth:   moduleDepth,
-		Verbose:    verbose,
-	})
+	var graphStr string
+	switch format {
+	case "mermaid":
+		graphStr, err = terraform.GraphMermaid(g)
+	default:
+		graphStr, err = terraform.GraphDot(g, &dag.DotOpts{
+			DrawCycles: drawCycles,
+			MaxDepth:   moduleDepth,
+			Verbose:    verbose,
+		})
+	}
 	if err != nil {
 		c.Ui.Error(fmt.Sprintf("Error converting graph: %s", err))
 		return 1
@@ -142,7 +155,8 @@ Usage: terraform graph [options] [DIR]
 
   The graph is outputted in DOT format. The typical program that can
   read this format is GraphViz, but many web services are also available
-  to read this format.
+  to read this format. With -format=mermaid, the graph is outputted as
+  a Mermaid flowchart instead, which can be rendered in Markdown.
 
   The -type flag can be used to control the type of graph shown. Terraform
   creates different graphs for different operations. See the options below
@@ -155,6 +169,8 @@ Options:
   -draw-cycles   Highlight any cycles in the graph with colored edges.
                  This helps when diagnosing cycle errors.
 
+  -format=dot    Format of the graph to output. Can be: dot, mermaid.
+
   -no-color      If specified, output won't contain any color.
 
   -type=plan     Type of graph to output. Can be: plan, plan-destroy, apply,
@@ -96,14 +96,14 @@ func (h *CountHook) PostDiff(
 		return terraform.HookActionContinue, nil
 	}
 
-	switch d.ChangeType() {
-	case terraform.DiffDestroyCreate:
+	switch d.Action() {
+	case terraform.DiffActionReplace:
 		h.ToRemoveAndAdd += 1
-	case terraform.DiffCreate:
+	case terraform.DiffActionCreate:
 		h.ToAdd += 1
-	case terraform.DiffDestroy:
+	case terraform.DiffActionDelete:
 		h.ToRemove += 1
-	case terraform.DiffUpdate:
+	case terraform.DiffActionUpdate:
 		h.ToChange += 1
 	}
 
@@ -7,6 +7,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/go-version"
@@ -66,6 +67,11 @@ type ProviderConfig struct {
 	Name      string
 	Alias     string
 	RawConfig *RawConfig
+
+	// Version is the constraint on the version of the provider, such as
+	// "~> 1.2", that's checked before anything is applied with it. This
+	// is empty if any version is allowed.
+	Version string
 }
 
 // A resource represents a single Terraform resource in the configuration.
@@ -112,6 +118,70 @@ type ResourceLifecycle struct {
 	CreateBeforeDestroy bool     `mapstructure:"create_before_destroy"`
 	PreventDestroy      bool     `mapstructure:"prevent_destroy"`
 	IgnoreChanges       []string `mapstructure:"ignore_changes"`
+
+	// PreventReplace makes the plan fail if a change to the configuration
+	// requires the existing resource to be replaced.
+	PreventReplace bool `mapstructure:"prevent_replace"`
+
+	// ReplaceTriggeredBy is a list of references to other resources, or
+	// attributes of other resources, in the same module. The resource is
+	// replaced whenever any of them has a planned change.
+	ReplaceTriggeredBy []string `mapstructure:"replace_triggered_by"`
+
+	// RetryAttempts and RetryBackoff are set from the "retry" block.
+	// RetryAttempts is the number of times a retryable apply error is
+	// retried and RetryBackoff is the delay before the first retry, which
+	// doubles with every subsequent attempt.
+	RetryAttempts int
+	RetryBackoff  time.Duration
+
+	// Timeout is the maximum amount of time a single apply of the resource
+	// may take. Zero means there is no limit.
+	Timeout time.Duration
+
+	// CreateTimeout, UpdateTimeout and DeleteTimeout are set from the
+	// "timeouts" block. They override Timeout for an apply that creates,
+	// updates or destroys the resource respectively. Zero means Timeout
+	// is used.
+	CreateTimeout time.Duration
+	UpdateTimeout time.Duration
+	DeleteTimeout time.Duration
+
+	// ParallelProvisioners runs the provisioners of the resource at the
+	// same time instead of one after another in the order they're declared.
+	ParallelProvisioners bool `mapstructure:"parallel_provisioners"`
+
+	// ImportId is the ID of an existing object to import instead of
+	// creating the resource. It's only used when the resource isn't in the
+	// state yet.
+	ImportId string `mapstructure:"import_id"`
+
+	// PreservePriorState keeps the state the resource had before it was
+	// last updated in the state, so that it can be restored manually.
+	PreservePriorState bool `mapstructure:"preserve_prior_state"`
+
+	// Preconditions are set from the "precondition" blocks. They're
+	// checked before the resource is diffed.
+	Preconditions []*ResourceCondition
+
+	// Postconditions are set from the "postcondition" blocks. They're
+	// checked against the state of the resource every time it's applied.
+	Postconditions []*ResourceCondition
+}
+
+// ResourceCondition is a condition from a "precondition" or a
+// "postcondition" block of a resource lifecycle. RawConfig holds the
+// "condition" and the "error_message" of the block. Only the condition of
+// a postcondition may reference the resource itself with self.
+type ResourceCondition struct {
+	RawConfig *RawConfig
+}
+
+// Copy returns a copy of this ResourceCondition
+func (c *ResourceCondition) Copy() *ResourceCondition {
+	return &ResourceCondition{
+		RawConfig: c.RawConfig.Copy(),
+	}
 }
 
 // Copy returns a copy of this ResourceLifecycle
@@ -119,12 +189,65 @@ func (r *ResourceLifecycle) Copy() *ResourceLifecycle {
 	n := &ResourceLifecycle{
 		CreateBeforeDestroy: r.CreateBeforeDestroy,
 		PreventDestroy:      r.PreventDestroy,
+		PreventReplace:      r.PreventReplace,
 		IgnoreChanges:       make([]string, len(r.IgnoreChanges)),
+		RetryAttempts:       r.RetryAttempts,
+		RetryBackoff:        r.RetryBackoff,
+		Timeout:             r.Timeout,
+		CreateTimeout:       r.CreateTimeout,
+		UpdateTimeout:       r.UpdateTimeout,
+		DeleteTimeout:       r.DeleteTimeout,
+
+		ParallelProvisioners: r.ParallelProvisioners,
+		ImportId:             r.ImportId,
+		PreservePriorState:   r.PreservePriorState,
 	}
 	copy(n.IgnoreChanges, r.IgnoreChanges)
+	if r.ReplaceTriggeredBy != nil {
+		n.ReplaceTriggeredBy = make([]string, len(r.ReplaceTriggeredBy))
+		copy(n.ReplaceTriggeredBy, r.ReplaceTriggeredBy)
+	}
+	n.Preconditions = copyResourceConditions(r.Preconditions)
+	n.Postconditions = copyResourceConditions(r.Postconditions)
 	return n
 }
 
+func copyResourceConditions(cs []*ResourceCondition) []*ResourceCondition {
+	if cs == nil {
+		return nil
+	}
+
+	result := make([]*ResourceCondition, len(cs))
+	for i, c := range cs {
+		result[i] = c.Copy()
+	}
+	return result
+}
+
+// ParseReplaceTrigger splits an entry of replace_triggered_by into the
+// ID of the referenced resource and the referenced attribute. The
+// attribute is empty if the entry references the whole resource, such
+// as "aws_instance.foo" rather than "aws_instance.foo.id".
+func ParseReplaceTrigger(v string) (string, string, error) {
+	parts := strings.Split(v, ".")
+
+	n := 2
+	if len(parts) > 0 && parts[0] == "data" {
+		n = 3
+	}
+	if len(parts) < n {
+		return "", "", fmt.Errorf("invalid replace_triggered_by reference: %s", v)
+	}
+	for _, p := range parts {
+		if p == "" {
+			return "", "", fmt.Errorf(
+				"invalid replace_triggered_by reference: %s", v)
+		}
+	}
+
+	return strings.Join(parts[:n], "."), strings.Join(parts[n:], "."), nil
+}
+
 // Provisioner is a configured provisioner step on a resource.
 type Provisioner struct {
 	Type      string
@@ -133,6 +256,11 @@ type Provisioner struct {
 
 	When      ProvisionerWhen
 	OnFailure ProvisionerOnFailure
+
+	// Condition, if non-nil, holds the "condition" of the provisioner. The
+	// provisioner only runs if it is true. It's interpolated against the
+	// applied state of the resource, so it can reference self.
+	Condition *RawConfig
 }
 
 // Copy returns a copy of this Provisioner
@@ -143,6 +271,7 @@ func (p *Provisioner) Copy() *Provisioner {
 		ConnInfo:  p.ConnInfo.Copy(),
 		When:      p.When,
 		OnFailure: p.OnFailure,
+		Condition: p.Condition.Copy(),
 	}
 }
 
@@ -220,10 +349,25 @@ func (r *Resource) Count() (int, error) {
 	return int(v), nil
 }
 
+// providerName returns the full name of the provider that manages the
+// resource: the provider it's assigned to, or the provider named by the
+// prefix of its type.
+func (r *Resource) providerName() string {
+	if r.Provider != "" {
+		return r.Provider
+	}
+
+	if idx := strings.IndexRune(r.Type, '_'); idx != -1 {
+		return r.Type[:idx]
+	}
+
+	return r.Type
+}
+
 // A unique identifier for this resource.
 func (r *Resource) Id() string {
 	switch r.Mode {
-	case ManagedResourceMode:
+	case ManagedResourceMode, ValuesResourceMode:
 		return fmt.Sprintf("%s.%s", r.Type, r.Name)
 	case DataResourceMode:
 		return fmt.Sprintf("data.%s.%s", r.Type, r.Name)
@@ -367,6 +511,38 @@ func (c *Config) Validate() error {
 		}
 
 		providerSet[name] = struct{}{}
+
+		if p.Version != "" {
+			if _, err := version.NewConstraint(p.Version); err != nil {
+				errs = append(errs, fmt.Errorf(
+					"provider.%s: version %q syntax error: %s",
+					name, p.Version, err))
+			}
+		}
+	}
+
+	// Check that providers aren't configured from the resources they
+	// manage, since they must be configured before those exist.
+	resourceProviders := make(map[string]string)
+	for _, r := range c.Resources {
+		resourceProviders[r.Id()] = r.providerName()
+	}
+	for _, p := range c.ProviderConfigs {
+		for _, v := range p.RawConfig.Variables {
+			rv, ok := v.(*ResourceVariable)
+			if !ok {
+				continue
+			}
+
+			id := rv.ResourceId()
+			if name, ok := resourceProviders[id]; ok && name == p.FullName() {
+				errs = append(errs, fmt.Errorf(
+					"provider.%s: configuration depends on %s, which is managed "+
+						"by the same provider. A provider can only be configured "+
+						"from resources of other providers.",
+					p.FullName(), id))
+			}
+		}
 	}
 
 	// Check that all references to modules are valid
@@ -512,6 +688,7 @@ func (c *Config) Validate() error {
 					v.FullKey()))
 
 			// Good
+			case *DependenciesVariable:
 			case *ModuleVariable:
 			case *ResourceVariable:
 			case *UserVariable:
@@ -541,6 +718,12 @@ func (c *Config) Validate() error {
 				"%s: resource count must be an integer",
 				n))
 		}
+
+		// Every instance would import the same object
+		if r.Lifecycle.ImportId != "" && r.RawCount.Value().(string) != "1" {
+			errs = append(errs, fmt.Errorf(
+				"%s: lifecycle import_id can't be used with count", n))
+		}
 		r.RawCount.init()
 
 		// Validate DependsOn
@@ -600,6 +783,51 @@ func (c *Config) Validate() error {
 			}
 		}
 
+		if r.Lifecycle.RetryAttempts < 0 {
+			errs = append(errs, fmt.Errorf(
+				"%s: lifecycle retry attempts must not be negative", n))
+		}
+		if r.Lifecycle.RetryBackoff < 0 {
+			errs = append(errs, fmt.Errorf(
+				"%s: lifecycle retry backoff must not be negative", n))
+		}
+		if r.Lifecycle.Timeout < 0 {
+			errs = append(errs, fmt.Errorf(
+				"%s: lifecycle timeout must not be negative", n))
+		}
+		if r.Lifecycle.CreateTimeout < 0 ||
+			r.Lifecycle.UpdateTimeout < 0 ||
+			r.Lifecycle.DeleteTimeout < 0 {
+			errs = append(errs, fmt.Errorf(
+				"%s: lifecycle timeouts must not be negative", n))
+		}
+
+		// Verify replace_triggered_by points to other resources that exist
+		for _, v := range r.Lifecycle.ReplaceTriggeredBy {
+			id, _, err := ParseReplaceTrigger(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %s", n, err))
+				continue
+			}
+
+			if id == r.Id() {
+				errs = append(errs, fmt.Errorf(
+					"%s: replace_triggered_by cannot reference itself", n))
+				continue
+			}
+
+			if _, ok := resources[id]; !ok {
+				errs = append(errs, fmt.Errorf(
+					"%s: replace_triggered_by references non-existent resource '%s'",
+					n, id))
+			}
+		}
+
+		errs = append(errs, validateResourceConditions(
+			n, "precondition", r.Lifecycle.Preconditions)...)
+		errs = append(errs, validateResourceConditions(
+			n, "postcondition", r.Lifecycle.Postconditions)...)
+
 		// Verify ignore_changes has no interpolations
 		rc, err := NewRawConfig(map[string]interface{}{
 			"root": r.Lifecycle.IgnoreChanges,
@@ -622,10 +850,43 @@ func (c *Config) Validate() error {
 					n))
 			}
 		}
+		if r.Mode == ValuesResourceMode {
+			if _, ok := r.RawConfig.Raw["provisioner"]; ok {
+				errs = append(errs, fmt.Errorf(
+					"%s: values cannot have provisioners",
+					n))
+			}
+
+			// The ID of values is always their address
+			if _, ok := r.RawConfig.Raw["id"]; ok {
+				errs = append(errs, fmt.Errorf(
+					"%s: id is reserved and can't be set in values",
+					n))
+			}
+		}
+
+		// The values type is reserved for values blocks, whose
+		// resources would otherwise have the same addresses
+		if r.Mode == ManagedResourceMode && r.Type == ValuesResourceType {
+			errs = append(errs, fmt.Errorf(
+				"%s: resource type %q is reserved, use a values block instead",
+				n, ValuesResourceType))
+		}
 	}
 
 	for source, vs := range vars {
 		for _, v := range vs {
+			if dv, ok := v.(*DependenciesVariable); ok {
+				if _, ok := resources[dv.Resource]; !ok {
+					errs = append(errs, fmt.Errorf(
+						"%s: unknown resource '%s' referenced in %s",
+						source,
+						dv.Resource,
+						dv.FullKey()))
+				}
+				continue
+			}
+
 			rv, ok := v.(*ResourceVariable)
 			if !ok {
 				continue
@@ -721,9 +982,10 @@ func (c *Config) Validate() error {
 
 	// Validate the self variable
 	for source, rc := range c.rawConfigs() {
-		// Ignore provisioners. This is a pretty brittle way to do this,
-		// but better than also repeating all the resources.
-		if strings.Contains(source, "provision") {
+		// Ignore provisioners and postconditions. This is a pretty brittle
+		// way to do this, but better than also repeating all the resources.
+		if strings.Contains(source, "provision") ||
+			strings.Contains(source, "postcondition") {
 			continue
 		}
 
@@ -779,6 +1041,19 @@ func (c *Config) rawConfigs() map[string]*RawConfig {
 				"%s provisioner %s (#%d)",
 				source, p.Type, i+1)
 			result[subsource] = p.RawConfig
+			if p.Condition != nil {
+				result[subsource+" condition"] = p.Condition
+			}
+		}
+
+		for i, p := range rc.Lifecycle.Preconditions {
+			subsource := fmt.Sprintf("%s precondition (#%d)", source, i+1)
+			result[subsource] = p.RawConfig
+		}
+
+		for i, p := range rc.Lifecycle.Postconditions {
+			subsource := fmt.Sprintf("%s postcondition (#%d)", source, i+1)
+			result[subsource] = p.RawConfig
 		}
 	}
 
@@ -841,6 +1116,27 @@ func (c *Config) validateVarContextFn(
 	}
 }
 
+// validateResourceConditions validates the precondition or postcondition
+// blocks, named by kind, of the resource n.
+func validateResourceConditions(n, kind string, cs []*ResourceCondition) []error {
+	var errs []error
+	for i, c := range cs {
+		if _, ok := c.RawConfig.Raw["condition"]; !ok {
+			errs = append(errs, fmt.Errorf(
+				"%s: lifecycle %s #%d is missing the condition", n, kind, i+1))
+		}
+		if msg, ok := c.RawConfig.Raw["error_message"]; ok {
+			if _, ok := msg.(string); !ok {
+				errs = append(errs, fmt.Errorf(
+					"%s: lifecycle %s #%d error_message must be a string",
+					n, kind, i+1))
+			}
+		}
+	}
+
+	return errs
+}
+
 func (c *Config) validateDependsOn(
 	n string,
 	v []string,
@@ -944,6 +1240,9 @@ func (c *ProviderConfig) mergerMerge(m merger) merger {
 	if c2.Alias != "" {
 		result.Alias = c2.Alias
 	}
+	if c2.Version != "" {
+		result.Version = c2.Version
+	}
 
 	return &result
 }
@@ -1082,7 +1381,7 @@ func (m ResourceMode) Taintable() bool {
 	switch m {
 	case ManagedResourceMode:
 		return true
-	case DataResourceMode:
+	case DataResourceMode, ValuesResourceMode:
 		return false
 	default:
 		panic(fmt.Errorf("unsupported ResourceMode value %s", m))
@@ -166,6 +166,10 @@ func providerConfigsStr(pcs []*ProviderConfig) string {
 
 		result += fmt.Sprintf("%s\n", n)
 
+		if pc.Version != "" {
+			result += fmt.Sprintf("  version = %s\n", pc.Version)
+		}
+
 		keys := make([]string, 0, len(pc.RawConfig.Raw))
 		for k, _ := range pc.RawConfig.Raw {
 			keys = append(keys, k)
@@ -245,6 +249,10 @@ func resourcesStr(rs []*Resource) string {
 					result += fmt.Sprintf("      on_failure = %s\n", p.OnFailure.String())
 				}
 
+				if p.Condition != nil {
+					result += fmt.Sprintf("      condition = %v\n", p.Condition.Raw["condition"])
+				}
+
 				ks := make([]string, 0, len(p.RawConfig.Raw))
 				for k, _ := range p.RawConfig.Raw {
 					ks = append(ks, k)
@@ -296,6 +296,104 @@ func TestConfigValidate_dependsOnVar(t *testing.T) {
 	}
 }
 
+func TestConfigValidate_replaceTriggeredBy(t *testing.T) {
+	c := testConfig(t, "validate-replace-triggered-by-good")
+	if err := c.Validate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestConfigValidate_replaceTriggeredByInvalid(t *testing.T) {
+	c := testConfig(t, "validate-replace-triggered-by-invalid")
+	if err := c.Validate(); err == nil {
+		t.Fatal("should not be valid")
+	}
+}
+
+func TestConfigValidate_replaceTriggeredByMissing(t *testing.T) {
+	c := testConfig(t, "validate-replace-triggered-by-missing")
+	if err := c.Validate(); err == nil {
+		t.Fatal("should not be valid")
+	}
+}
+
+func TestConfigValidate_replaceTriggeredBySelf(t *testing.T) {
+	c := testConfig(t, "validate-replace-triggered-by-self")
+	if err := c.Validate(); err == nil {
+		t.Fatal("should not be valid")
+	}
+}
+
+func TestConfigValidate_importIdCount(t *testing.T) {
+	c := testConfig(t, "validate-import-id-count")
+	if err := c.Validate(); err == nil {
+		t.Fatal("should not be valid")
+	}
+}
+
+func TestConfigValidate_preconditionNoCondition(t *testing.T) {
+	c := testConfig(t, "validate-precondition-no-condition")
+	if err := c.Validate(); err == nil {
+		t.Fatal("should not be valid")
+	}
+}
+
+func TestConfigValidate_preconditionSelf(t *testing.T) {
+	c := testConfig(t, "validate-precondition-self")
+	if err := c.Validate(); err == nil {
+		t.Fatal("should not be valid")
+	}
+}
+
+func TestConfigValidate_postcondition(t *testing.T) {
+	c := testConfig(t, "validate-postcondition-self")
+	if err := c.Validate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestConfigValidate_postconditionBadRef(t *testing.T) {
+	c := testConfig(t, "validate-postcondition-bad-ref")
+	if err := c.Validate(); err == nil {
+		t.Fatal("should not be valid")
+	}
+}
+
+func TestConfigValidate_postconditionNoCondition(t *testing.T) {
+	c := testConfig(t, "validate-postcondition-no-condition")
+	if err := c.Validate(); err == nil {
+		t.Fatal("should not be valid")
+	}
+}
+
+func TestParseReplaceTrigger(t *testing.T) {
+	cases := []struct {
+		Input string
+		Id    string
+		Attr  string
+		Err   bool
+	}{
+		{"aws_instance.foo", "aws_instance.foo", "", false},
+		{"aws_instance.foo.id", "aws_instance.foo", "id", false},
+		{"aws_instance.foo.tags.Name", "aws_instance.foo", "tags.Name", false},
+		{"data.aws_ami.foo", "data.aws_ami.foo", "", false},
+		{"data.aws_ami.foo.id", "data.aws_ami.foo", "id", false},
+		{"aws_instance", "", "", true},
+		{"data.aws_ami", "", "", true},
+		{"aws_instance..id", "", "", true},
+	}
+
+	for _, tc := range cases {
+		id, attr, err := ParseReplaceTrigger(tc.Input)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s: err: %s", tc.Input, err)
+		}
+		if id != tc.Id || attr != tc.Attr {
+			t.Fatalf("%s: bad: %q %q", tc.Input, id, attr)
+		}
+	}
+}
+
 func TestConfigValidate_dupModule(t *testing.T) {
 	c := testConfig(t, "validate-dup-module")
 	if err := c.Validate(); err == nil {
@@ -435,6 +533,46 @@ func TestConfigValidate_providerMultiGood(t *testing.T) {
 	}
 }
 
+func TestConfigValidate_providerVersionBad(t *testing.T) {
+	c := testConfig(t, "validate-provider-version-bad")
+	if err := c.Validate(); err == nil {
+		t.Fatal("should not be valid")
+	}
+}
+
+func TestConfigValidate_valuesId(t *testing.T) {
+	c := testConfig(t, "validate-values-id")
+	if err := c.Validate(); err == nil {
+		t.Fatal("should not be valid")
+	}
+}
+
+func TestConfigValidate_valuesReservedType(t *testing.T) {
+	c := testConfig(t, "validate-values-reserved")
+	if err := c.Validate(); err == nil {
+		t.Fatal("should not be valid")
+	}
+}
+
+func TestConfigValidate_providerSelfRef(t *testing.T) {
+	for _, name := range []string{
+		"validate-provider-self-ref",
+		"validate-provider-self-ref-alias",
+	} {
+		c := testConfig(t, name)
+		if err := c.Validate(); err == nil {
+			t.Fatalf("%s: should not be valid", name)
+		}
+	}
+}
+
+func TestConfigValidate_providerSelfRefGood(t *testing.T) {
+	c := testConfig(t, "validate-provider-self-ref-good")
+	if err := c.Validate(); err != nil {
+		t.Fatalf("should be valid: %s", err)
+	}
+}
+
 func TestConfigValidate_providerMultiRefGood(t *testing.T) {
 	c := testConfig(t, "validate-provider-multi-ref-good")
 	if err := c.Validate(); err != nil {
@@ -505,6 +643,13 @@ func TestConfigValidate_unknownResourceVar_output(t *testing.T) {
 	}
 }
 
+func TestConfigValidate_unknownResourceDependencies(t *testing.T) {
+	c := testConfig(t, "validate-unknown-resource-dependencies")
+	if err := c.Validate(); err == nil {
+		t.Fatal("should not be valid")
+	}
+}
+
 func TestConfigValidate_unknownVar(t *testing.T) {
 	c := testConfig(t, "validate-unknownvar")
 	if err := c.Validate(); err == nil {
@@ -31,6 +31,15 @@ const (
 	CountValueIndex
 )
 
+// A DependenciesVariable is the list of the dependencies of a resource in
+// the same module that the "dependencies" function returns, such as
+// "${dependencies("aws_instance.foo")}". It's only detected for calls
+// that are given the resource as a literal string.
+type DependenciesVariable struct {
+	Resource string // Resource ID, i.e. "aws_instance.foo"
+	key      string
+}
+
 // A ModuleVariable is a variable that is referencing the output
 // of a module, such as "${module.foo.bar}"
 type ModuleVariable struct {
@@ -130,6 +139,35 @@ func (c *CountVariable) FullKey() string {
 	return c.key
 }
 
+func NewDependenciesVariable(resource string) (*DependenciesVariable, error) {
+	parts := strings.Split(resource, ".")
+	if (len(parts) != 2 && len(parts) != 3) ||
+		(len(parts) == 3 && parts[0] != "data") {
+		return nil, fmt.Errorf(
+			"dependencies(%q): the resource must be TYPE.NAME or data.TYPE.NAME",
+			resource)
+	}
+
+	return &DependenciesVariable{
+		Resource: resource,
+		key:      dependenciesKey(resource),
+	}, nil
+}
+
+func (v *DependenciesVariable) FullKey() string {
+	return v.key
+}
+
+func (v *DependenciesVariable) GoString() string {
+	return fmt.Sprintf("*%#v", *v)
+}
+
+// dependenciesKey returns the key of the DependenciesVariable of the given
+// resource, which can't be the key of any other variable.
+func dependenciesKey(resource string) string {
+	return fmt.Sprintf("dependencies(%s)", resource)
+}
+
 func NewModuleVariable(key string) (*ModuleVariable, error) {
 	parts := strings.SplitN(key, ".", 3)
 	if len(parts) < 3 {
@@ -198,6 +236,9 @@ func NewResourceVariable(key string) (*ResourceVariable, error) {
 				"%s: resource variables must be three parts: TYPE.NAME.ATTR",
 				key)
 		}
+		if parts[0] == ValuesResourceType {
+			mode = ValuesResourceMode
+		}
 	}
 
 	field := parts[2]
@@ -235,7 +276,7 @@ func NewResourceVariable(key string) (*ResourceVariable, error) {
 
 func (v *ResourceVariable) ResourceId() string {
 	switch v.Mode {
-	case ManagedResourceMode:
+	case ManagedResourceMode, ValuesResourceMode:
 		return fmt.Sprintf("%s.%s", v.Type, v.Name)
 	case DataResourceMode:
 		return fmt.Sprintf("data.%s.%s", v.Type, v.Name)
@@ -343,6 +384,20 @@ func DetectVariables(root ast.Node) ([]InterpolatedVariable, error) {
 				}
 				result = append(result, v)
 			}
+		case *ast.Call:
+			if vn.Func != "dependencies" || len(vn.Args) != 1 {
+				return n
+			}
+			lit, ok := vn.Args[0].(*ast.LiteralNode)
+			if !ok || lit.Typex != ast.TypeString {
+				return n
+			}
+			v, err := NewDependenciesVariable(lit.Value.(string))
+			if err != nil {
+				resultErr = err
+				return n
+			}
+			result = append(result, v)
 		default:
 			return n
 		}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+)
+
+// configHashPlaceholder is the result of the "confighash" function. It's
+// replaced with the hash of the configuration once the whole
+// configuration is interpolated, see replaceConfigHash.
+const configHashPlaceholder = "2F4E51D8-1B2A-4E63-9C7B-5D2A8E0F6C31"
+
+// replaceConfigHash replaces the result of every "confighash" call in the
+// interpolated configuration with a hash of the configuration. The
+// top-level keys that use confighash aren't part of the hash, so the hash
+// doesn't depend on itself.
+//
+// The hash only depends on the interpolated values, not on how they're
+// written, and it's the same for the same values on any run. If any of
+// the hashed values is unknown, the keys that use confighash are unknown
+// too, since their value can only be known once everything else is.
+//
+// The caller must hold the lock of the RawConfig.
+func (r *RawConfig) replaceConfigHash() error {
+	var keys []string
+	input := make(map[string]interface{})
+	for k, v := range r.config {
+		if configHashUsed(v) {
+			keys = append(keys, k)
+			continue
+		}
+
+		input[k] = v
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	unknown := false
+	for _, k := range r.unknownKeys {
+		if _, ok := input[strings.SplitN(k, ".", 2)[0]]; ok {
+			unknown = true
+			break
+		}
+	}
+	if unknown {
+		for _, k := range keys {
+			r.config[k] = UnknownVariableValue
+			r.unknownKeys = append(r.unknownKeys, k)
+		}
+
+		return nil
+	}
+
+	// Maps are encoded with sorted keys, so the encoding is stable
+	encoded, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(encoded)
+	hash := hex.EncodeToString(sum[:])
+
+	for _, k := range keys {
+		r.config[k] = configHashReplace(r.config[k], hash)
+	}
+
+	return nil
+}
+
+// configHashUsed returns true if the result of a "confighash" call is
+// anywhere within v.
+func configHashUsed(v interface{}) bool {
+	switch t := v.(type) {
+	case string:
+		return strings.Contains(t, configHashPlaceholder)
+	case []interface{}:
+		for _, e := range t {
+			if configHashUsed(e) {
+				return true
+			}
+		}
+	case []map[string]interface{}:
+		for _, e := range t {
+			if configHashUsed(e) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		for _, e := range t {
+			if configHashUsed(e) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// configHashReplace returns v with the result of every "confighash" call
+// within it replaced with hash.
+func configHashReplace(v interface{}, hash string) interface{} {
+	switch t := v.(type) {
+	case string:
+		return strings.Replace(t, configHashPlaceholder, hash, -1)
+	case []interface{}:
+		result := make([]interface{}, len(t))
+		for i, e := range t {
+			result[i] = configHashReplace(e, hash)
+		}
+		return result
+	case []map[string]interface{}:
+		result := make([]map[string]interface{}, len(t))
+		for i, e := range t {
+			result[i] = configHashReplace(e, hash).(map[string]interface{})
+		}
+		return result
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			result[k] = configHashReplace(e, hash)
+		}
+		return result
+	}
+
+	return v
+}
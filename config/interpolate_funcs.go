@@ -62,6 +62,7 @@ func Funcs() map[string]ast.Function {
 		"coalesce":     interpolationFuncCoalesce(),
 		"compact":      interpolationFuncCompact(),
 		"concat":       interpolationFuncConcat(),
+		"confighash":   interpolationFuncConfigHash(),
 		"distinct":     interpolationFuncDistinct(),
 		"element":      interpolationFuncElement(),
 		"file":         interpolationFuncFile(),
@@ -90,6 +91,7 @@ func Funcs() map[string]ast.Function {
 		"timestamp":    interpolationFuncTimestamp(),
 		"title":        interpolationFuncTitle(),
 		"trimspace":    interpolationFuncTrimSpace(),
+		"try":          interpolationFuncTry(),
 		"upper":        interpolationFuncUpper(),
 		"zipmap":       interpolationFuncZipMap(),
 	}
@@ -293,6 +295,35 @@ func interpolationFuncCidrSubnet() ast.Function {
 	}
 }
 
+// interpolationFuncTry implements the "try" function that returns its
+// first argument, or its second argument if the first can't be computed.
+// The fallback is done by RawConfig.Interpolate before evaluation since
+// the arguments of a function are always evaluated first, so this is only
+// called when the first argument could be computed.
+func interpolationFuncTry() ast.Function {
+	return ast.Function{
+		ArgTypes:   []ast.Type{ast.TypeString, ast.TypeString},
+		ReturnType: ast.TypeString,
+		Callback: func(args []interface{}) (interface{}, error) {
+			return args[0].(string), nil
+		},
+	}
+}
+
+// interpolationFuncConfigHash implements the "confighash" function that
+// returns a hash of the configuration it's used in. The placeholder it
+// returns is replaced with the hash by RawConfig.Interpolate once the
+// rest of the configuration is interpolated.
+func interpolationFuncConfigHash() ast.Function {
+	return ast.Function{
+		ArgTypes:   []ast.Type{},
+		ReturnType: ast.TypeString,
+		Callback: func(args []interface{}) (interface{}, error) {
+			return configHashPlaceholder, nil
+		},
+	}
+}
+
 // interpolationFuncCoalesce implements the "coalesce" function that
 // returns the first non null / empty string from the provided input
 func interpolationFuncCoalesce() ast.Function {
@@ -836,6 +867,33 @@ func interpolationFuncSplit() ast.Function {
 	}
 }
 
+// interpolationFuncDependencies implements the "dependencies" function
+// that returns the dependencies that are written to the state for a
+// resource in the same module. The lists are set in vs by the variables
+// detected for the calls.
+func interpolationFuncDependencies(vs map[string]ast.Variable) ast.Function {
+	return ast.Function{
+		ArgTypes:   []ast.Type{ast.TypeString},
+		ReturnType: ast.TypeList,
+		Callback: func(args []interface{}) (interface{}, error) {
+			resource := args[0].(string)
+			v, ok := vs[dependenciesKey(resource)]
+			if !ok {
+				return nil, fmt.Errorf(
+					"dependencies of %q aren't known; the resource must be "+
+						"given as a literal string, such as "+
+						"dependencies(\"aws_instance.foo\")", resource)
+			}
+			if v.Type != ast.TypeList {
+				return nil, fmt.Errorf(
+					"dependencies of %q are %s, not a list", resource, v.Type)
+			}
+
+			return v.Value, nil
+		},
+	}
+}
+
 // interpolationFuncLookup implements the "lookup" function that allows
 // dynamic lookups of map types within a Terraform configuration.
 func interpolationFuncLookup(vs map[string]ast.Variable) ast.Function {
@@ -1491,6 +1491,44 @@ func TestInterpolateFuncLookup(t *testing.T) {
 	})
 }
 
+func TestInterpolateFuncDependencies(t *testing.T) {
+	testFunction(t, testFunctionConfig{
+		Vars: map[string]ast.Variable{
+			"dependencies(aws_instance.foo)": ast.Variable{
+				Type: ast.TypeList,
+				Value: []ast.Variable{
+					ast.Variable{Type: ast.TypeString, Value: "aws_instance.bar"},
+					ast.Variable{Type: ast.TypeString, Value: "module.baz"},
+				},
+			},
+			"var.name": ast.Variable{
+				Value: "aws_instance.qux",
+				Type:  ast.TypeString,
+			},
+		},
+		Cases: []testFunctionCase{
+			{
+				`${dependencies("aws_instance.foo")}`,
+				[]interface{}{"aws_instance.bar", "module.baz"},
+				false,
+			},
+
+			// The resource must be a literal
+			{
+				`${dependencies(var.name)}`,
+				nil,
+				true,
+			},
+
+			{
+				`${dependencies("aws_instance.bar")}`,
+				nil,
+				true,
+			},
+		},
+	})
+}
+
 func TestInterpolateFuncKeys(t *testing.T) {
 	testFunction(t, testFunctionConfig{
 		Vars: map[string]ast.Variable{
@@ -256,6 +256,26 @@ func TestDetectVariables(t *testing.T) {
 				},
 			},
 		},
+
+		{
+			`${dependencies("data.aws_ami.foo")}`,
+			[]InterpolatedVariable{
+				&DependenciesVariable{
+					Resource: "data.aws_ami.foo",
+					key:      "dependencies(data.aws_ami.foo)",
+				},
+			},
+		},
+
+		{
+			`${dependencies(var.foo)}`,
+			[]InterpolatedVariable{
+				&UserVariable{
+					Name: "foo",
+					key:  "var.foo",
+				},
+			},
+		},
 	}
 
 	for _, tc := range cases {
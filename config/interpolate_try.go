@@ -0,0 +1,91 @@
+package config
+
+import (
+	"github.com/hashicorp/hil"
+	"github.com/hashicorp/hil/ast"
+	"github.com/mitchellh/copystructure"
+)
+
+// detectTryVariables adds the keys of the variables in the given node to
+// either try or required, depending on whether they are used within the
+// first argument of a "try" call or not.
+func detectTryVariables(
+	root ast.Node, try, required map[string]struct{}) error {
+	// Find all the nodes within the first argument of a try
+	inTry := make(map[ast.Node]struct{})
+	root.Accept(func(n ast.Node) ast.Node {
+		if call, ok := n.(*ast.Call); ok && call.Func == "try" && len(call.Args) == 2 {
+			call.Args[0].Accept(func(n ast.Node) ast.Node {
+				inTry[n] = struct{}{}
+				return n
+			})
+		}
+
+		return n
+	})
+
+	var resultErr error
+	root.Accept(func(n ast.Node) ast.Node {
+		va, ok := n.(*ast.VariableAccess)
+		if !ok || resultErr != nil {
+			return n
+		}
+
+		v, err := NewInterpolatedVariable(va.Name)
+		if err != nil {
+			resultErr = err
+			return n
+		}
+
+		if _, ok := inTry[n]; ok {
+			try[v.FullKey()] = struct{}{}
+		} else {
+			required[v.FullKey()] = struct{}{}
+		}
+
+		return n
+	})
+
+	return resultErr
+}
+
+// resolveTry replaces every "try" call in the given node with its first
+// argument if it can be evaluated, or its second argument otherwise. The
+// first argument can't be evaluated if it uses a variable that isn't
+// set or if evaluating it returns an error. A first argument with an
+// unknown value is kept, so the result is unknown.
+func resolveTry(root ast.Node, config *hil.EvalConfig) ast.Node {
+	return root.Accept(func(n ast.Node) ast.Node {
+		call, ok := n.(*ast.Call)
+		if !ok || call.Func != "try" || len(call.Args) != 2 {
+			return n
+		}
+
+		// Nested calls were already replaced since children are visited
+		// first, so look for any variable that isn't set.
+		missing := false
+		call.Args[0].Accept(func(n ast.Node) ast.Node {
+			if va, ok := n.(*ast.VariableAccess); ok {
+				if _, ok := config.GlobalScope.LookupVar(va.Name); !ok {
+					missing = true
+				}
+			}
+
+			return n
+		})
+		if missing {
+			return call.Args[1]
+		}
+
+		// Evaluate a copy, since evaluating can modify the tree
+		arg, err := copystructure.Copy(call.Args[0])
+		if err != nil {
+			return call.Args[1]
+		}
+		if _, err := hil.Eval(&ast.Output{Exprs: []ast.Node{arg.(ast.Node)}}, config); err != nil {
+			return call.Args[1]
+		}
+
+		return call.Args[0]
+	})
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"io/ioutil"
+	"time"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/hcl"
@@ -26,6 +27,7 @@ func (t *hclConfigurable) Config() (*Config, error) {
 		"provider":  struct{}{},
 		"resource":  struct{}{},
 		"terraform": struct{}{},
+		"values":    struct{}{},
 		"variable":  struct{}{},
 	}
 
@@ -88,10 +90,12 @@ func (t *hclConfigurable) Config() (*Config, error) {
 		var err error
 		managedResourceConfigs := list.Filter("resource")
 		dataResourceConfigs := list.Filter("data")
+		valuesResourceConfigs := list.Filter("values")
 
 		config.Resources = make(
 			[]*Resource, 0,
-			len(managedResourceConfigs.Items)+len(dataResourceConfigs.Items),
+			len(managedResourceConfigs.Items)+len(dataResourceConfigs.Items)+
+				len(valuesResourceConfigs.Items),
 		)
 
 		managedResources, err := loadManagedResourcesHcl(managedResourceConfigs)
@@ -102,9 +106,14 @@ func (t *hclConfigurable) Config() (*Config, error) {
 		if err != nil {
 			return nil, err
 		}
+		valuesResources, err := loadValuesResourcesHcl(valuesResourceConfigs)
+		if err != nil {
+			return nil, err
+		}
 
 		config.Resources = append(config.Resources, dataResources...)
 		config.Resources = append(config.Resources, managedResources...)
+		config.Resources = append(config.Resources, valuesResources...)
 	}
 
 	// Build the outputs
@@ -541,6 +550,7 @@ func loadProvidersHcl(list *ast.ObjectList) ([]*ProviderConfig, error) {
 		}
 
 		delete(config, "alias")
+		delete(config, "version")
 
 		rawConfig, err := NewRawConfig(config)
 		if err != nil {
@@ -562,10 +572,23 @@ func loadProvidersHcl(list *ast.ObjectList) ([]*ProviderConfig, error) {
 			}
 		}
 
+		// If we have a version field, then add it in
+		var version string
+		if a := listVal.Filter("version"); len(a.Items) > 0 {
+			err := hcl.DecodeObject(&version, a.Items[0].Val)
+			if err != nil {
+				return nil, fmt.Errorf(
+					"Error reading version for provider[%s]: %s",
+					n,
+					err)
+			}
+		}
+
 		result = append(result, &ProviderConfig{
 			Name:      n,
 			Alias:     alias,
 			RawConfig: rawConfig,
+			Version:   version,
 		})
 	}
 
@@ -691,6 +714,104 @@ func loadDataResourcesHcl(list *ast.ObjectList) ([]*Resource, error) {
 	return result, nil
 }
 
+// Given a handle to a HCL object, this recurses into the structure
+// and pulls out a list of values resources.
+//
+// The resulting resources may not be unique, but each one represents
+// exactly one "values" block in the HCL configuration. We leave it up to
+// another pass to merge them together.
+func loadValuesResourcesHcl(list *ast.ObjectList) ([]*Resource, error) {
+	list = list.Children()
+	if len(list.Items) == 0 {
+		return nil, nil
+	}
+
+	// Where all the results will go
+	var result []*Resource
+
+	for _, item := range list.Items {
+		if len(item.Keys) != 1 {
+			return nil, fmt.Errorf(
+				"position %s: 'values' must be followed by exactly one string: a name",
+				item.Pos())
+		}
+
+		k := item.Keys[0].Token.Value().(string)
+
+		var listVal *ast.ObjectList
+		if ot, ok := item.Val.(*ast.ObjectType); ok {
+			listVal = ot.List
+		} else {
+			return nil, fmt.Errorf("values %s: should be an object", k)
+		}
+
+		var config map[string]interface{}
+		if err := hcl.DecodeObject(&config, item.Val); err != nil {
+			return nil, fmt.Errorf(
+				"Error reading config for values %s: %s",
+				k,
+				err)
+		}
+
+		// Remove the fields we handle specially. Everything else is a
+		// value that is stored as an attribute.
+		delete(config, "depends_on")
+		delete(config, "count")
+
+		rawConfig, err := NewRawConfig(config)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"Error reading config for values %s: %s",
+				k,
+				err)
+		}
+
+		// If we have a count, then figure it out
+		var count string = "1"
+		if o := listVal.Filter("count"); len(o.Items) > 0 {
+			err = hcl.DecodeObject(&count, o.Items[0].Val)
+			if err != nil {
+				return nil, fmt.Errorf(
+					"Error parsing count for values %s: %s",
+					k,
+					err)
+			}
+		}
+		countConfig, err := NewRawConfig(map[string]interface{}{
+			"count": count,
+		})
+		if err != nil {
+			return nil, err
+		}
+		countConfig.Key = "count"
+
+		// If we have depends fields, then add those in
+		var dependsOn []string
+		if o := listVal.Filter("depends_on"); len(o.Items) > 0 {
+			err := hcl.DecodeObject(&dependsOn, o.Items[0].Val)
+			if err != nil {
+				return nil, fmt.Errorf(
+					"Error reading depends_on for values %s: %s",
+					k,
+					err)
+			}
+		}
+
+		result = append(result, &Resource{
+			Mode:         ValuesResourceMode,
+			Name:         k,
+			Type:         ValuesResourceType,
+			RawCount:     countConfig,
+			RawConfig:    rawConfig,
+			Provisioners: []*Provisioner{},
+			DependsOn:    dependsOn,
+			Lifecycle:    ResourceLifecycle{},
+		})
+	}
+
+	return result, nil
+}
+
 // Given a handle to a HCL object, this recurses into the structure
 // and pulls out a list of managed resources.
 //
@@ -847,7 +968,12 @@ func loadManagedResourcesHcl(list *ast.ObjectList) ([]*Resource, error) {
 			}
 
 			// Check for invalid keys
-			valid := []string{"create_before_destroy", "ignore_changes", "prevent_destroy"}
+			valid := []string{
+				"create_before_destroy", "ignore_changes", "import_id",
+				"parallel_provisioners", "postcondition", "precondition",
+				"preserve_prior_state", "prevent_destroy", "prevent_replace",
+				"replace_triggered_by", "retry", "timeout", "timeouts",
+			}
 			if err := checkHCLKeys(o.Items[0].Val, valid); err != nil {
 				return nil, multierror.Prefix(err, fmt.Sprintf(
 					"%s[%s]:", t, k))
@@ -862,6 +988,14 @@ func loadManagedResourcesHcl(list *ast.ObjectList) ([]*Resource, error) {
 					err)
 			}
 
+			// The retry, condition and timeouts blocks and timeout are
+			// handled specially below
+			delete(raw, "postcondition")
+			delete(raw, "precondition")
+			delete(raw, "retry")
+			delete(raw, "timeout")
+			delete(raw, "timeouts")
+
 			if err := mapstructure.WeakDecode(raw, &lifecycle); err != nil {
 				return nil, fmt.Errorf(
 					"Error parsing lifecycle for %s[%s]: %s",
@@ -869,6 +1003,81 @@ func loadManagedResourcesHcl(list *ast.ObjectList) ([]*Resource, error) {
 					k,
 					err)
 			}
+
+			if ot, ok := o.Items[0].Val.(*ast.ObjectType); ok {
+				if ro := ot.List.Filter("retry"); len(ro.Items) > 0 {
+					if len(ro.Items) > 1 {
+						return nil, fmt.Errorf(
+							"%s[%s]: Multiple lifecycle retry blocks found, expected one",
+							t, k)
+					}
+
+					if err := loadLifecycleRetryHcl(ro.Items[0].Val, &lifecycle); err != nil {
+						return nil, fmt.Errorf(
+							"Error parsing lifecycle retry for %s[%s]: %s",
+							t,
+							k,
+							err)
+					}
+				}
+
+				for _, po := range ot.List.Filter("precondition").Items {
+					p, err := loadLifecycleConditionHcl(po.Val)
+					if err != nil {
+						return nil, fmt.Errorf(
+							"Error parsing lifecycle precondition for %s[%s]: %s",
+							t,
+							k,
+							err)
+					}
+
+					lifecycle.Preconditions = append(lifecycle.Preconditions, p)
+				}
+
+				for _, po := range ot.List.Filter("postcondition").Items {
+					p, err := loadLifecycleConditionHcl(po.Val)
+					if err != nil {
+						return nil, fmt.Errorf(
+							"Error parsing lifecycle postcondition for %s[%s]: %s",
+							t,
+							k,
+							err)
+					}
+
+					lifecycle.Postconditions = append(lifecycle.Postconditions, p)
+				}
+
+				if to := ot.List.Filter("timeout"); len(to.Items) > 0 {
+					var timeout string
+					err := hcl.DecodeObject(&timeout, to.Items[0].Val)
+					if err == nil {
+						lifecycle.Timeout, err = time.ParseDuration(timeout)
+					}
+					if err != nil {
+						return nil, fmt.Errorf(
+							"Error parsing lifecycle timeout for %s[%s]: %s",
+							t,
+							k,
+							err)
+					}
+				}
+
+				if to := ot.List.Filter("timeouts"); len(to.Items) > 0 {
+					if len(to.Items) > 1 {
+						return nil, fmt.Errorf(
+							"%s[%s]: Multiple lifecycle timeouts blocks found, expected one",
+							t, k)
+					}
+
+					if err := loadLifecycleTimeoutsHcl(to.Items[0].Val, &lifecycle); err != nil {
+						return nil, fmt.Errorf(
+							"Error parsing lifecycle timeouts for %s[%s]: %s",
+							t,
+							k,
+							err)
+					}
+				}
+			}
 		}
 
 		result = append(result, &Resource{
@@ -887,6 +1096,97 @@ func loadManagedResourcesHcl(list *ast.ObjectList) ([]*Resource, error) {
 	return result, nil
 }
 
+// loadLifecycleRetryHcl loads the "retry" block within a resource
+// lifecycle block into the given lifecycle.
+func loadLifecycleRetryHcl(n ast.Node, lifecycle *ResourceLifecycle) error {
+	valid := []string{"attempts", "backoff"}
+	if err := checkHCLKeys(n, valid); err != nil {
+		return err
+	}
+
+	var retry struct {
+		Attempts int    `hcl:"attempts"`
+		Backoff  string `hcl:"backoff"`
+	}
+	if err := hcl.DecodeObject(&retry, n); err != nil {
+		return err
+	}
+
+	lifecycle.RetryAttempts = retry.Attempts
+	if retry.Backoff != "" {
+		d, err := time.ParseDuration(retry.Backoff)
+		if err != nil {
+			return fmt.Errorf("backoff: %s", err)
+		}
+
+		lifecycle.RetryBackoff = d
+	}
+
+	return nil
+}
+
+// loadLifecycleTimeoutsHcl loads the "timeouts" block within a resource
+// lifecycle block into the given lifecycle.
+func loadLifecycleTimeoutsHcl(n ast.Node, lifecycle *ResourceLifecycle) error {
+	valid := []string{"create", "update", "delete"}
+	if err := checkHCLKeys(n, valid); err != nil {
+		return err
+	}
+
+	var timeouts struct {
+		Create string `hcl:"create"`
+		Update string `hcl:"update"`
+		Delete string `hcl:"delete"`
+	}
+	if err := hcl.DecodeObject(&timeouts, n); err != nil {
+		return err
+	}
+
+	for _, v := range []struct {
+		Name   string
+		Raw    string
+		Output *time.Duration
+	}{
+		{"create", timeouts.Create, &lifecycle.CreateTimeout},
+		{"update", timeouts.Update, &lifecycle.UpdateTimeout},
+		{"delete", timeouts.Delete, &lifecycle.DeleteTimeout},
+	} {
+		if v.Raw == "" {
+			continue
+		}
+
+		d, err := time.ParseDuration(v.Raw)
+		if err != nil {
+			return fmt.Errorf("%s: %s", v.Name, err)
+		}
+
+		*v.Output = d
+	}
+
+	return nil
+}
+
+// loadLifecycleConditionHcl loads a "precondition" or a "postcondition"
+// block within a resource lifecycle block.
+func loadLifecycleConditionHcl(n ast.Node) (*ResourceCondition, error) {
+	valid := []string{"condition", "error_message"}
+	if err := checkHCLKeys(n, valid); err != nil {
+		return nil, err
+	}
+
+	var raw map[string]interface{}
+	if err := hcl.DecodeObject(&raw, n); err != nil {
+		return nil, err
+	}
+
+	rawConfig, err := NewRawConfig(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ResourceCondition{RawConfig: rawConfig}, nil
+}
+
 func loadProvisionersHcl(list *ast.ObjectList, connInfo map[string]interface{}) ([]*Provisioner, error) {
 	list = list.Children()
 	if len(list.Items) == 0 {
@@ -940,10 +1240,24 @@ func loadProvisionersHcl(list *ast.ObjectList, connInfo map[string]interface{})
 			}
 		}
 
+		// Parse the "condition" value, which is interpolated later
+		var condition *RawConfig
+		if v, ok := config["condition"]; ok {
+			var err error
+			condition, err = NewRawConfig(map[string]interface{}{
+				"condition": v,
+			})
+			if err != nil {
+				return nil, fmt.Errorf(
+					"position %s: 'provisioner' condition: %s", item.Pos(), err)
+			}
+		}
+
 		// Delete fields we special case
 		delete(config, "connection")
 		delete(config, "when")
 		delete(config, "on_failure")
+		delete(config, "condition")
 
 		rawConfig, err := NewRawConfig(config)
 		if err != nil {
@@ -984,6 +1298,7 @@ func loadProvisionersHcl(list *ast.ObjectList, connInfo map[string]interface{})
 			ConnInfo:  connRaw,
 			When:      when,
 			OnFailure: onFailure,
+			Condition: condition,
 		})
 	}
 
@@ -6,6 +6,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestErrNoConfigsFound_impl(t *testing.T) {
@@ -666,6 +667,71 @@ func TestLoadFile_provisioners(t *testing.T) {
 	}
 }
 
+func TestLoadFile_providerVersion(t *testing.T) {
+	c, err := LoadFile(filepath.Join(fixtureDir, "provider-version.tf"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if c == nil {
+		t.Fatal("config should not be nil")
+	}
+
+	actual := providerConfigsStr(c.ProviderConfigs)
+	if actual != strings.TrimSpace(providerVersionConfigsStr) {
+		t.Fatalf("bad:\n%s", actual)
+	}
+
+	if err := c.Validate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestLoadFile_provisionersCondition(t *testing.T) {
+	c, err := LoadFile(filepath.Join(fixtureDir, "provisioners-condition.tf"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if c == nil {
+		t.Fatal("config should not be nil")
+	}
+
+	actual := resourcesStr(c.Resources)
+	if actual != strings.TrimSpace(provisionerConditionResourcesStr) {
+		t.Fatalf("bad:\n%s", actual)
+	}
+
+	if err := c.Validate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestLoadFile_values(t *testing.T) {
+	c, err := LoadFile(filepath.Join(fixtureDir, "values.tf"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if c == nil {
+		t.Fatal("config should not be nil")
+	}
+
+	actual := resourcesStr(c.Resources)
+	if actual != strings.TrimSpace(valuesResourcesStr) {
+		t.Fatalf("bad:\n%s", actual)
+	}
+
+	r := c.Resources[1]
+	if r.Mode != ValuesResourceMode || r.Type != ValuesResourceType {
+		t.Fatalf("bad: %#v", r)
+	}
+
+	if err := c.Validate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
 func TestLoadFile_provisionersDestroy(t *testing.T) {
 	c, err := LoadFile(filepath.Join(fixtureDir, "provisioners-destroy.tf"))
 	if err != nil {
@@ -854,6 +920,325 @@ func TestLoad_preventDestroyString(t *testing.T) {
 	}
 }
 
+func TestLoadFile_lifecycleRetry(t *testing.T) {
+	c, err := LoadFile(filepath.Join(fixtureDir, "lifecycle-retry.tf"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if c == nil {
+		t.Fatal("config should not be nil")
+	}
+
+	r := c.Resources[0]
+	if r.Name != "web" && r.Type != "aws_instance" {
+		t.Fatalf("Bad: %#v", r)
+	}
+
+	if r.Lifecycle.RetryAttempts != 3 {
+		t.Fatalf("Bad: %#v", r.Lifecycle)
+	}
+	if r.Lifecycle.RetryBackoff != 2*time.Second {
+		t.Fatalf("Bad: %#v", r.Lifecycle)
+	}
+
+	r = c.Resources[1]
+	if r.Name != "bar" && r.Type != "aws_instance" {
+		t.Fatalf("Bad: %#v", r)
+	}
+
+	// Should not enable retries
+	if r.Lifecycle.RetryAttempts != 0 || r.Lifecycle.RetryBackoff != 0 {
+		t.Fatalf("Bad: %#v", r.Lifecycle)
+	}
+}
+
+func TestLoadFile_lifecycleRetryBadBackoff(t *testing.T) {
+	_, err := LoadFile(filepath.Join(fixtureDir, "lifecycle-retry-bad-backoff.tf"))
+	if err == nil {
+		t.Fatal("should have error")
+	}
+}
+
+func TestLoadFile_lifecycleTimeout(t *testing.T) {
+	c, err := LoadFile(filepath.Join(fixtureDir, "lifecycle-timeout.tf"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if c == nil {
+		t.Fatal("config should not be nil")
+	}
+
+	r := c.Resources[0]
+	if r.Name != "web" && r.Type != "aws_instance" {
+		t.Fatalf("Bad: %#v", r)
+	}
+
+	if r.Lifecycle.Timeout != 30*time.Minute {
+		t.Fatalf("Bad: %#v", r.Lifecycle)
+	}
+
+	r = c.Resources[1]
+	if r.Name != "bar" && r.Type != "aws_instance" {
+		t.Fatalf("Bad: %#v", r)
+	}
+
+	// Should not have a timeout
+	if r.Lifecycle.Timeout != 0 {
+		t.Fatalf("Bad: %#v", r.Lifecycle)
+	}
+}
+
+func TestLoadFile_lifecycleTimeouts(t *testing.T) {
+	c, err := LoadFile(filepath.Join(fixtureDir, "lifecycle-timeouts.tf"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if c == nil {
+		t.Fatal("config should not be nil")
+	}
+
+	r := c.Resources[0]
+	if r.Name != "web" && r.Type != "aws_instance" {
+		t.Fatalf("Bad: %#v", r)
+	}
+
+	if r.Lifecycle.Timeout != 30*time.Minute {
+		t.Fatalf("Bad: %#v", r.Lifecycle)
+	}
+	if r.Lifecycle.CreateTimeout != 10*time.Minute {
+		t.Fatalf("Bad: %#v", r.Lifecycle)
+	}
+	if r.Lifecycle.UpdateTimeout != 0 {
+		t.Fatalf("Bad: %#v", r.Lifecycle)
+	}
+	if r.Lifecycle.DeleteTimeout != time.Hour {
+		t.Fatalf("Bad: %#v", r.Lifecycle)
+	}
+
+	r = c.Resources[1]
+	if r.Name != "bar" && r.Type != "aws_instance" {
+		t.Fatalf("Bad: %#v", r)
+	}
+
+	// Should not have timeouts
+	if r.Lifecycle.CreateTimeout != 0 ||
+		r.Lifecycle.UpdateTimeout != 0 ||
+		r.Lifecycle.DeleteTimeout != 0 {
+		t.Fatalf("Bad: %#v", r.Lifecycle)
+	}
+}
+
+func TestLoadFile_lifecycleParallelProvisioners(t *testing.T) {
+	c, err := LoadFile(filepath.Join(fixtureDir, "lifecycle-parallel-provisioners.tf"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if c == nil {
+		t.Fatal("config should not be nil")
+	}
+
+	r := c.Resources[0]
+	if r.Name != "web" && r.Type != "aws_instance" {
+		t.Fatalf("Bad: %#v", r)
+	}
+
+	if !r.Lifecycle.ParallelProvisioners {
+		t.Fatalf("Bad: %#v", r.Lifecycle)
+	}
+
+	r = c.Resources[1]
+	if r.Name != "bar" && r.Type != "aws_instance" {
+		t.Fatalf("Bad: %#v", r)
+	}
+
+	// Should run provisioners in order by default
+	if r.Lifecycle.ParallelProvisioners {
+		t.Fatalf("Bad: %#v", r.Lifecycle)
+	}
+}
+
+func TestLoadFile_lifecyclePreservePriorState(t *testing.T) {
+	c, err := LoadFile(filepath.Join(fixtureDir, "lifecycle-preserve-prior-state.tf"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if c == nil {
+		t.Fatal("config should not be nil")
+	}
+
+	r := c.Resources[0]
+	if r.Name != "web" && r.Type != "aws_instance" {
+		t.Fatalf("Bad: %#v", r)
+	}
+
+	if !r.Lifecycle.PreservePriorState {
+		t.Fatalf("Bad: %#v", r.Lifecycle)
+	}
+
+	r = c.Resources[1]
+	if r.Name != "bar" && r.Type != "aws_instance" {
+		t.Fatalf("Bad: %#v", r)
+	}
+
+	if r.Lifecycle.PreservePriorState {
+		t.Fatalf("Bad: %#v", r.Lifecycle)
+	}
+}
+
+func TestLoadFile_lifecycleImportId(t *testing.T) {
+	c, err := LoadFile(filepath.Join(fixtureDir, "lifecycle-import-id.tf"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if c == nil {
+		t.Fatal("config should not be nil")
+	}
+
+	r := c.Resources[0]
+	if r.Name != "web" && r.Type != "aws_instance" {
+		t.Fatalf("Bad: %#v", r)
+	}
+
+	if r.Lifecycle.ImportId != "i-abc123" {
+		t.Fatalf("Bad: %#v", r.Lifecycle)
+	}
+
+	r = c.Resources[1]
+	if r.Name != "bar" && r.Type != "aws_instance" {
+		t.Fatalf("Bad: %#v", r)
+	}
+
+	if r.Lifecycle.ImportId != "" {
+		t.Fatalf("Bad: %#v", r.Lifecycle)
+	}
+}
+
+func TestLoadFile_lifecyclePostcondition(t *testing.T) {
+	c, err := LoadFile(filepath.Join(fixtureDir, "lifecycle-postcondition.tf"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if c == nil {
+		t.Fatal("config should not be nil")
+	}
+
+	r := c.Resources[0]
+	if len(r.Lifecycle.Postconditions) != 2 {
+		t.Fatalf("Bad: %#v", r.Lifecycle)
+	}
+
+	actual := r.Lifecycle.Postconditions[0].RawConfig.Raw
+	expected := map[string]interface{}{
+		"condition":     `${self.ami == "foo"}`,
+		"error_message": "wrong ami",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("Bad: %#v", actual)
+	}
+
+	actual = r.Lifecycle.Postconditions[1].RawConfig.Raw
+	expected = map[string]interface{}{
+		"condition": `${self.id != ""}`,
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("Bad: %#v", actual)
+	}
+
+	r = c.Resources[1]
+	if r.Lifecycle.Postconditions != nil {
+		t.Fatalf("Bad: %#v", r.Lifecycle)
+	}
+}
+
+func TestLoadFile_lifecyclePrecondition(t *testing.T) {
+	c, err := LoadFile(filepath.Join(fixtureDir, "lifecycle-precondition.tf"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if c == nil {
+		t.Fatal("config should not be nil")
+	}
+
+	r := c.Resources[0]
+	if len(r.Lifecycle.Preconditions) != 1 || r.Lifecycle.Postconditions != nil {
+		t.Fatalf("Bad: %#v", r.Lifecycle)
+	}
+
+	actual := r.Lifecycle.Preconditions[0].RawConfig.Raw
+	expected := map[string]interface{}{
+		"condition":     `${var.region == "us-east-1"}`,
+		"error_message": "wrong region",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("Bad: %#v", actual)
+	}
+}
+
+func TestLoadFile_lifecyclePreventReplace(t *testing.T) {
+	c, err := LoadFile(filepath.Join(fixtureDir, "lifecycle-prevent-replace.tf"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if c == nil {
+		t.Fatal("config should not be nil")
+	}
+
+	if r := c.Resources[0]; !r.Lifecycle.PreventReplace {
+		t.Fatalf("Bad: %#v", r.Lifecycle)
+	}
+	if r := c.Resources[1]; r.Lifecycle.PreventReplace {
+		t.Fatalf("Bad: %#v", r.Lifecycle)
+	}
+}
+
+func TestLoadFile_lifecycleReplaceTriggeredBy(t *testing.T) {
+	c, err := LoadFile(filepath.Join(fixtureDir, "lifecycle-replace-triggered-by.tf"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if c == nil {
+		t.Fatal("config should not be nil")
+	}
+
+	actual := make(map[string][]string)
+	for _, r := range c.Resources {
+		actual[r.Id()] = r.Lifecycle.ReplaceTriggeredBy
+	}
+
+	expected := map[string][]string{
+		"aws_instance.web": []string{"aws_instance.bar.ami", "data.aws_ami.foo"},
+		"aws_instance.bar": nil,
+		"data.aws_ami.foo": nil,
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("Bad: %#v", actual)
+	}
+}
+
+func TestLoadFile_lifecycleTimeoutBad(t *testing.T) {
+	_, err := LoadFile(filepath.Join(fixtureDir, "lifecycle-timeout-bad.tf"))
+	if err == nil {
+		t.Fatal("should have error")
+	}
+}
+
+func TestLoadFile_lifecycleTimeoutsBad(t *testing.T) {
+	_, err := LoadFile(filepath.Join(fixtureDir, "lifecycle-timeouts-bad.tf"))
+	if err == nil {
+		t.Fatal("should have error")
+	}
+}
+
 func TestLoad_temporary_files(t *testing.T) {
 	_, err := LoadDir(filepath.Join(fixtureDir, "dir-temporary-files"))
 	if err == nil {
@@ -1190,6 +1575,27 @@ aws_instance.web (x1)
       path
 `
 
+const provisionerConditionResourcesStr = `
+aws_instance.web (x1)
+  provisioners
+    shell
+    shell
+      condition = ${self.private_ip != ""}
+      path
+`
+
+const valuesResourcesStr = `
+aws_instance.web (x1)
+  tags
+  vars
+    resource: values.tags.name
+values.tags (x1)
+  env
+  name
+  vars
+    user: var.env
+`
+
 const connectionResourcesStr = `
 aws_instance.web (x1)
   ami
@@ -1237,3 +1643,11 @@ aws_instance.baz (x1)
 aws_instance.web (x1)
   ami
 `
+
+const providerVersionConfigsStr = `
+aws
+  version = ~> 1.2
+  region
+do
+  api_key
+`
@@ -0,0 +1,5 @@
+module "child" {
+    source = "./child"
+
+    count = 2
+}
@@ -330,6 +330,14 @@ func (t *Tree) Validate() error {
 				newErr.Err = fmt.Errorf(
 					"module %s: %s is not a valid parameter",
 					m.Name, k)
+				if k == "count" || k == "for_each" {
+					newErr.Err = fmt.Errorf(
+						"module %s: %s is not a valid parameter. Modules "+
+							"can't be repeated: each module block is a "+
+							"single instance, so that references to its "+
+							"outputs and resources are unambiguous",
+						m.Name, k)
+				}
 				return newErr
 			}
 
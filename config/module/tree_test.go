@@ -371,6 +371,22 @@ func TestTreeValidate_badChildVar(t *testing.T) {
 	}
 }
 
+func TestTreeValidate_moduleCount(t *testing.T) {
+	tree := NewTree("", testConfig(t, "validate-module-count"))
+
+	if err := tree.Load(testStorage(t), GetModeGet); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err := tree.Validate()
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), "can't be repeated") {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
 func TestTreeValidate_badRoot(t *testing.T) {
 	tree := NewTree("", testConfig(t, "validate-root-bad"))
 
@@ -32,6 +32,11 @@ type RawConfig struct {
 	Interpolations []ast.Node
 	Variables      map[string]InterpolatedVariable
 
+	// TryVariables are the keys of Variables that are only used within
+	// the first argument of a "try" call. These are allowed to be missing
+	// from the variables given to Interpolate.
+	TryVariables map[string]struct{}
+
 	lock        sync.Mutex
 	config      map[string]interface{}
 	unknownKeys []string
@@ -126,7 +131,10 @@ func (r *RawConfig) Interpolate(vs map[string]ast.Variable) error {
 	defer r.lock.Unlock()
 
 	config := langEvalConfig(vs)
-	return r.interpolate(func(root ast.Node) (interface{}, error) {
+	err := r.interpolate(func(root ast.Node) (interface{}, error) {
+		// Replace the calls to try with the argument to use
+		root = resolveTry(root, config)
+
 		// None of the variables we need are computed, meaning we should
 		// be able to properly evaluate.
 		result, err := hil.Eval(root, config)
@@ -136,6 +144,13 @@ func (r *RawConfig) Interpolate(vs map[string]ast.Variable) error {
 
 		return result.Value, nil
 	})
+	if err != nil {
+		return err
+	}
+
+	// The hash of the configuration can only be computed once everything
+	// else is interpolated
+	return r.replaceConfigHash()
 }
 
 // Merge merges another RawConfig into this one (overriding any conflicting
@@ -195,7 +210,10 @@ func (r *RawConfig) init() error {
 	r.config = r.Raw
 	r.Interpolations = nil
 	r.Variables = nil
+	r.TryVariables = nil
 
+	tryVars := make(map[string]struct{})
+	requiredVars := make(map[string]struct{})
 	fn := func(node ast.Node) (interface{}, error) {
 		r.Interpolations = append(r.Interpolations, node)
 		vars, err := DetectVariables(node)
@@ -211,6 +229,10 @@ func (r *RawConfig) init() error {
 			r.Variables[v.FullKey()] = v
 		}
 
+		if err := detectTryVariables(node, tryVars, requiredVars); err != nil {
+			return "", err
+		}
+
 		return "", nil
 	}
 
@@ -219,6 +241,18 @@ func (r *RawConfig) init() error {
 		return err
 	}
 
+	// A variable used both within and outside of a try is required
+	for k := range tryVars {
+		if _, ok := requiredVars[k]; ok {
+			continue
+		}
+
+		if r.TryVariables == nil {
+			r.TryVariables = make(map[string]struct{})
+		}
+		r.TryVariables[k] = struct{}{}
+	}
+
 	return nil
 }
 
@@ -325,6 +359,7 @@ func langEvalConfig(vs map[string]ast.Variable) *hil.EvalConfig {
 	funcMap["lookup"] = interpolationFuncLookup(vs)
 	funcMap["keys"] = interpolationFuncKeys(vs)
 	funcMap["values"] = interpolationFuncValues(vs)
+	funcMap["dependencies"] = interpolationFuncDependencies(vs)
 
 	return &hil.EvalConfig{
 		GlobalScope: &ast.BasicScope{
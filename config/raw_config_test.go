@@ -3,6 +3,8 @@ package config
 import (
 	"encoding/gob"
 	"reflect"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/hashicorp/hil/ast"
@@ -238,6 +240,205 @@ func TestRawConfig_syntax(t *testing.T) {
 	}
 }
 
+func TestRawConfig_try(t *testing.T) {
+	cases := map[string]struct {
+		Input    string
+		Vars     map[string]ast.Variable
+		Expected interface{}
+	}{
+		"set": {
+			`${try(var.bar, "default")}`,
+			map[string]ast.Variable{
+				"var.bar": ast.Variable{Value: "baz", Type: ast.TypeString},
+			},
+			"baz",
+		},
+
+		"missing": {
+			`${try(var.bar, "default")}`,
+			map[string]ast.Variable{},
+			"default",
+		},
+
+		"missing in a larger expression": {
+			`foo-${try(upper(var.bar), var.baz)}`,
+			map[string]ast.Variable{
+				"var.baz": ast.Variable{Value: "baz", Type: ast.TypeString},
+			},
+			"foo-baz",
+		},
+
+		"evaluation error": {
+			`${try(index(split(",", var.bar), "c"), "default")}`,
+			map[string]ast.Variable{
+				"var.bar": ast.Variable{Value: "a,b", Type: ast.TypeString},
+			},
+			"default",
+		},
+
+		"nested": {
+			`${try(var.bar, try(var.baz, "default"))}`,
+			map[string]ast.Variable{},
+			"default",
+		},
+
+		"unknown": {
+			`${try(var.bar, "default")}`,
+			map[string]ast.Variable{
+				"var.bar": ast.Variable{
+					Value: UnknownVariableValue,
+					Type:  ast.TypeUnknown,
+				},
+			},
+			UnknownVariableValue,
+		},
+	}
+
+	for k, tc := range cases {
+		rc, err := NewRawConfig(map[string]interface{}{"foo": tc.Input})
+		if err != nil {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+
+		if err := rc.Interpolate(tc.Vars); err != nil {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+
+		actual := rc.Config()["foo"]
+		if !reflect.DeepEqual(actual, tc.Expected) {
+			t.Fatalf("%s: bad: %#v", k, actual)
+		}
+	}
+}
+
+func TestRawConfig_trySyntax(t *testing.T) {
+	raw := map[string]interface{}{
+		"foo": `${try(var.bar, "default"}`,
+	}
+
+	if _, err := NewRawConfig(raw); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestRawConfig_tryVariables(t *testing.T) {
+	raw := map[string]interface{}{
+		"foo": `${try(var.a, "default")} ${try(var.b, var.c)}`,
+		"bar": "${var.b}",
+	}
+
+	rc, err := NewRawConfig(raw)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// var.b and var.c are required since they're used outside of the
+	// first argument to try.
+	expected := map[string]struct{}{"var.a": struct{}{}}
+	if !reflect.DeepEqual(rc.TryVariables, expected) {
+		t.Fatalf("bad: %#v", rc.TryVariables)
+	}
+}
+
+func TestRawConfig_configHash(t *testing.T) {
+	interpolate := func(raw map[string]interface{}, vars map[string]ast.Variable) *RawConfig {
+		rc, err := NewRawConfig(raw)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if err := rc.Interpolate(vars); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		return rc
+	}
+
+	vars := map[string]ast.Variable{
+		"var.ami": ast.Variable{Value: "ami-123", Type: ast.TypeString},
+	}
+	raw := map[string]interface{}{
+		"ami":  "${var.ami}",
+		"size": "small",
+		"tags": []map[string]interface{}{
+			map[string]interface{}{"hash": "h-${confighash()}"},
+		},
+	}
+
+	hash := func(rc *RawConfig) string {
+		tags := rc.Config()["tags"].([]map[string]interface{})
+		return tags[0]["hash"].(string)
+	}
+
+	// The hash is stable
+	expected := hash(interpolate(raw, vars))
+	if !strings.HasPrefix(expected, "h-") || len(expected) != 2+64 {
+		t.Fatalf("bad: %s", expected)
+	}
+	for i := 0; i < 10; i++ {
+		if actual := hash(interpolate(raw, vars)); actual != expected {
+			t.Fatalf("bad: %s != %s", actual, expected)
+		}
+	}
+
+	// It depends on the interpolated values, not how they're written, and
+	// not on the keys that use it
+	actual := hash(interpolate(map[string]interface{}{
+		"ami":  "ami-123",
+		"size": "small",
+		"tags": []map[string]interface{}{
+			map[string]interface{}{"hash": "h-${confighash()}", "other": "x"},
+		},
+	}, nil))
+	if actual != expected {
+		t.Fatalf("bad: %s != %s", actual, expected)
+	}
+
+	// It changes with the configuration
+	actual = hash(interpolate(raw, map[string]ast.Variable{
+		"var.ami": ast.Variable{Value: "ami-456", Type: ast.TypeString},
+	}))
+	if actual == expected {
+		t.Fatalf("hash should change: %s", actual)
+	}
+}
+
+func TestRawConfig_configHashUnknown(t *testing.T) {
+	raw := map[string]interface{}{
+		"ami":  "${var.ami}",
+		"hash": "${confighash()}",
+	}
+
+	rc, err := NewRawConfig(raw)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	vars := map[string]ast.Variable{
+		"var.ami": ast.Variable{
+			Value: UnknownVariableValue,
+			Type:  ast.TypeUnknown,
+		},
+	}
+	if err := rc.Interpolate(vars); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The hash isn't known until every value is
+	expected := map[string]interface{}{
+		"ami":  UnknownVariableValue,
+		"hash": UnknownVariableValue,
+	}
+	if !reflect.DeepEqual(rc.Config(), expected) {
+		t.Fatalf("bad: %#v", rc.Config())
+	}
+
+	keys := rc.UnknownKeys()
+	sort.Strings(keys)
+	if !reflect.DeepEqual(keys, []string{"ami", "hash"}) {
+		t.Fatalf("bad: %#v", keys)
+	}
+}
+
 func TestRawConfig_unknown(t *testing.T) {
 	raw := map[string]interface{}{
 		"foo": "${var.bar}",
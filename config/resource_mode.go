@@ -6,4 +6,16 @@ type ResourceMode int
 const (
 	ManagedResourceMode ResourceMode = iota
 	DataResourceMode
+
+	// ValuesResourceMode is the mode of the resources declared with
+	// "values" blocks. They don't manage any infrastructure: Terraform
+	// stores their interpolated configuration as their attributes without
+	// calling a provider.
+	ValuesResourceMode
 )
+
+// ValuesResourceType is the type of every resource in ValuesResourceMode.
+// The type is reserved, so the addresses and state keys of values
+// resources, such as "values.NAME", are written like those of managed
+// resources.
+const ValuesResourceType = "values"
@@ -4,9 +4,9 @@ package config
 
 import "fmt"
 
-const _ResourceMode_name = "ManagedResourceModeDataResourceMode"
+const _ResourceMode_name = "ManagedResourceModeDataResourceModeValuesResourceMode"
 
-var _ResourceMode_index = [...]uint8{0, 19, 35}
+var _ResourceMode_index = [...]uint8{0, 19, 35, 53}
 
 func (i ResourceMode) String() string {
 	if i < 0 || i >= ResourceMode(len(_ResourceMode_index)-1) {
@@ -0,0 +1,10 @@
+resource "aws_instance" "web" {
+    ami = "foo"
+    lifecycle {
+        import_id = "i-abc123"
+    }
+}
+
+resource "aws_instance" "bar" {
+    ami = "foo"
+}
@@ -0,0 +1,10 @@
+resource "aws_instance" "web" {
+    ami = "foo"
+    lifecycle {
+        parallel_provisioners = true
+    }
+}
+
+resource "aws_instance" "bar" {
+    ami = "foo"
+}
@@ -0,0 +1,17 @@
+resource "aws_instance" "web" {
+    ami = "foo"
+    lifecycle {
+        postcondition {
+            condition     = "${self.ami == "foo"}"
+            error_message = "wrong ami"
+        }
+
+        postcondition {
+            condition = "${self.id != ""}"
+        }
+    }
+}
+
+resource "aws_instance" "bar" {
+    ami = "foo"
+}
@@ -0,0 +1,11 @@
+variable "region" {}
+
+resource "aws_instance" "web" {
+    ami = "foo"
+    lifecycle {
+        precondition {
+            condition     = "${var.region == "us-east-1"}"
+            error_message = "wrong region"
+        }
+    }
+}
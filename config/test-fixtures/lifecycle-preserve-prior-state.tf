@@ -0,0 +1,10 @@
+resource "aws_instance" "web" {
+    ami = "foo"
+    lifecycle {
+        preserve_prior_state = true
+    }
+}
+
+resource "aws_instance" "bar" {
+    ami = "foo"
+}
@@ -0,0 +1,10 @@
+resource "aws_instance" "web" {
+    ami = "foo"
+    lifecycle {
+        prevent_replace = true
+    }
+}
+
+resource "aws_instance" "bar" {
+    ami = "foo"
+}
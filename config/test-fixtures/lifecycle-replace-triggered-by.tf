@@ -0,0 +1,12 @@
+resource "aws_instance" "web" {
+    ami = "foo"
+    lifecycle {
+        replace_triggered_by = ["aws_instance.bar.ami", "data.aws_ami.foo"]
+    }
+}
+
+resource "aws_instance" "bar" {
+    ami = "foo"
+}
+
+data "aws_ami" "foo" {}
@@ -0,0 +1,10 @@
+
+resource "aws_instance" "web" {
+    ami = "foo"
+    lifecycle {
+        retry {
+            attempts = 3
+            backoff = "soon"
+        }
+    }
+}
@@ -0,0 +1,14 @@
+
+resource "aws_instance" "web" {
+    ami = "foo"
+    lifecycle {
+        retry {
+            attempts = 3
+            backoff = "2s"
+        }
+    }
+}
+
+resource "aws_instance" "bar" {
+    ami = "foo"
+}
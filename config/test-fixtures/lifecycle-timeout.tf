@@ -0,0 +1,11 @@
+
+resource "aws_instance" "web" {
+    ami = "foo"
+    lifecycle {
+        timeout = "30m"
+    }
+}
+
+resource "aws_instance" "bar" {
+    ami = "foo"
+}
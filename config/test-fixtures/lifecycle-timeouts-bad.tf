@@ -0,0 +1,8 @@
+resource "aws_instance" "web" {
+    ami = "foo"
+    lifecycle {
+        timeouts {
+            update = "later"
+        }
+    }
+}
@@ -0,0 +1,15 @@
+resource "aws_instance" "web" {
+    ami = "foo"
+    lifecycle {
+        timeout = "30m"
+
+        timeouts {
+            create = "10m"
+            delete = "1h"
+        }
+    }
+}
+
+resource "aws_instance" "bar" {
+    ami = "foo"
+}
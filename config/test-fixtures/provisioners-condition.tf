@@ -0,0 +1,8 @@
+resource "aws_instance" "web" {
+    provisioner "shell" {}
+
+    provisioner "shell" {
+        path = "foo"
+        condition = "${self.private_ip != ""}"
+    }
+}
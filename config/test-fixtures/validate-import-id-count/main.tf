@@ -0,0 +1,6 @@
+resource "aws_instance" "web" {
+    count = 2
+    lifecycle {
+        import_id = "i-abc123"
+    }
+}
@@ -0,0 +1,7 @@
+resource "aws_instance" "web" {
+    lifecycle {
+        postcondition {
+            condition = "${aws_instance.nope.id != ""}"
+        }
+    }
+}
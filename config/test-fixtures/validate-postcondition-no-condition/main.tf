@@ -0,0 +1,7 @@
+resource "aws_instance" "web" {
+    lifecycle {
+        postcondition {
+            error_message = "no condition"
+        }
+    }
+}
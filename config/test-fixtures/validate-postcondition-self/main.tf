@@ -0,0 +1,9 @@
+resource "aws_instance" "db" {}
+
+resource "aws_instance" "web" {
+    lifecycle {
+        postcondition {
+            condition = "${self.subnet == aws_instance.db.subnet}"
+        }
+    }
+}
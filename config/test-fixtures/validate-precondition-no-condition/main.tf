@@ -0,0 +1,7 @@
+resource "aws_instance" "web" {
+    lifecycle {
+        precondition {
+            error_message = "no condition"
+        }
+    }
+}
@@ -0,0 +1,8 @@
+provider "aws" {
+    alias = "west"
+    region = "${data.aws_region.west.name}"
+}
+
+data "aws_region" "west" {
+    provider = "aws.west"
+}
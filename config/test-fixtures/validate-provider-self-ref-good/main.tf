@@ -0,0 +1,12 @@
+provider "aws" {
+    region = "${test_instance.foo.region}"
+}
+
+provider "aws" {
+    alias = "west"
+    region = "${aws_instance.foo.region}"
+}
+
+resource "test_instance" "foo" {}
+
+resource "aws_instance" "foo" {}
@@ -0,0 +1,5 @@
+provider "aws" {
+    region = "${aws_instance.foo.region}"
+}
+
+resource "aws_instance" "foo" {}
@@ -0,0 +1,7 @@
+resource "aws_instance" "web" {
+    lifecycle {
+        replace_triggered_by = ["aws_instance.bar.ami", "aws_instance.bar"]
+    }
+}
+
+resource "aws_instance" "bar" {}
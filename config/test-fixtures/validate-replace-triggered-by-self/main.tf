@@ -0,0 +1,5 @@
+resource "aws_instance" "web" {
+    lifecycle {
+        replace_triggered_by = ["aws_instance.web.ami"]
+    }
+}
@@ -0,0 +1,6 @@
+resource "aws_instance" "web" {
+}
+
+output "deps" {
+    value = "${join(",", dependencies("aws_instance.db"))}"
+}
@@ -0,0 +1,3 @@
+values "tags" {
+  id = "foo"
+}
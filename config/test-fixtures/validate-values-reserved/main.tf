@@ -0,0 +1,3 @@
+resource "values" "tags" {
+  name = "foo"
+}
@@ -0,0 +1,12 @@
+variable "env" {
+  default = "prod"
+}
+
+values "tags" {
+  env  = "${var.env}"
+  name = "web-${var.env}"
+}
+
+resource "aws_instance" "web" {
+  tags = "${values.tags.name}"
+}
@@ -132,13 +132,14 @@ func (g *AcyclicGraph) Validate() error {
 	cycles := g.Cycles()
 	if len(cycles) > 0 {
 		for _, cycle := range cycles {
-			cycleStr := make([]string, len(cycle))
-			for j, vertex := range cycle {
+			path := g.cyclePath(cycle)
+			cycleStr := make([]string, len(path))
+			for j, vertex := range path {
 				cycleStr[j] = VertexName(vertex)
 			}
 
 			err = multierror.Append(err, fmt.Errorf(
-				"Cycle: %s", strings.Join(cycleStr, ", ")))
+				"Cycle: %s", strings.Join(cycleStr, " -> ")))
 		}
 	}
 
@@ -163,6 +164,63 @@ func (g *AcyclicGraph) Cycles() [][]Vertex {
 	return cycles
 }
 
+// cyclePath returns the shortest path along the edges of the graph that
+// starts and ends at the same vertex of the given strongly connected
+// component. The path starts at the vertex with the lowest name so that
+// the same cycle is always reported the same way.
+func (g *AcyclicGraph) cyclePath(cycle []Vertex) []Vertex {
+	members := make(map[interface{}]struct{}, len(cycle))
+	start := cycle[0]
+	for _, v := range cycle {
+		members[hashcode(v)] = struct{}{}
+		if VertexName(v) < VertexName(start) {
+			start = v
+		}
+	}
+
+	// Breadth-first search from the start, staying within the component,
+	// until we find an edge back to the start.
+	prev := make(map[interface{}]Vertex)
+	queue := []Vertex{start}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		targets := AsVertexList(g.DownEdges(current))
+		sort.Sort(byVertexName(targets))
+		for _, raw := range targets {
+			if _, ok := members[hashcode(raw)]; !ok {
+				continue
+			}
+
+			if hashcode(raw) == hashcode(start) {
+				path := []Vertex{start}
+				for v := current; hashcode(v) != hashcode(start); v = prev[hashcode(v)] {
+					path = append(path, v)
+				}
+				path = append(path, start)
+
+				// We built the path backwards, so reverse all but the ends
+				for i, j := 1, len(path)-2; i < j; i, j = i+1, j-1 {
+					path[i], path[j] = path[j], path[i]
+				}
+
+				return path
+			}
+
+			if _, ok := prev[hashcode(raw)]; ok {
+				continue
+			}
+			prev[hashcode(raw)] = current
+			queue = append(queue, raw)
+		}
+	}
+
+	// A strongly connected component always has a path back to the
+	// start, but fall back to the component itself just in case.
+	return cycle
+}
+
 // Walk walks the graph, calling your callback as each node is visited.
 // This will walk nodes in parallel if it can. Because the walk is done
 // in parallel, the error returned will be a multierror.
@@ -134,6 +134,53 @@ func TestAcyclicGraphValidate_cycle(t *testing.T) {
 	}
 }
 
+func TestAcyclicGraphValidate_cyclePath(t *testing.T) {
+	var g AcyclicGraph
+	g.Add("a")
+	g.Add("b")
+	g.Add("c")
+	g.Add("d")
+	g.Add("root")
+	g.Connect(BasicEdge("root", "b"))
+	g.Connect(BasicEdge("b", "c"))
+	g.Connect(BasicEdge("c", "a"))
+	g.Connect(BasicEdge("a", "b"))
+	g.Connect(BasicEdge("c", "d"))
+
+	err := g.Validate()
+	if err == nil {
+		t.Fatal("should error")
+	}
+
+	expected := "Cycle: a -> b -> c -> a"
+	if !strings.Contains(err.Error(), expected) {
+		t.Fatalf("expected %q in:\n%s", expected, err)
+	}
+}
+
+func TestAcyclicGraphValidate_cyclePathShortest(t *testing.T) {
+	var g AcyclicGraph
+	g.Add("a")
+	g.Add("b")
+	g.Add("c")
+	g.Add("root")
+	g.Connect(BasicEdge("root", "c"))
+	g.Connect(BasicEdge("a", "b"))
+	g.Connect(BasicEdge("b", "c"))
+	g.Connect(BasicEdge("c", "a"))
+	g.Connect(BasicEdge("b", "a"))
+
+	err := g.Validate()
+	if err == nil {
+		t.Fatal("should error")
+	}
+
+	expected := "Cycle: a -> b -> a"
+	if !strings.Contains(err.Error(), expected) {
+		t.Fatalf("expected %q in:\n%s", expected, err)
+	}
+}
+
 func TestAcyclicGraphValidate_cycleSelf(t *testing.T) {
 	var g AcyclicGraph
 	g.Add(1)
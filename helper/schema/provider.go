@@ -50,6 +50,17 @@ type Provider struct {
 	// See the ConfigureFunc documentation for more information.
 	ConfigureFunc ConfigureFunc
 
+	// IsRetryableFunc is a function for determining whether an error
+	// returned while applying a resource is transient and the apply can
+	// be retried. If this is omitted, no errors are retryable.
+	IsRetryableFunc func(error) bool
+
+	// DiffValuesEquivalentFunc is a function for determining whether two
+	// values of the same attribute, one from the plan and one from the
+	// diff made again during apply, are equivalent once normalized by
+	// the provider. If this is omitted, values must be equal.
+	DiffValuesEquivalentFunc func(info *terraform.InstanceInfo, k, old, new string) bool
+
 	meta interface{}
 
 	stopCtx       context.Context
@@ -237,6 +248,27 @@ func (p *Provider) Refresh(
 	return r.Refresh(s, p.meta)
 }
 
+// IsRetryable implementation of terraform.ResourceProviderRetryClassifier
+// interface.
+func (p *Provider) IsRetryable(err error) bool {
+	if err == nil || p.IsRetryableFunc == nil {
+		return false
+	}
+
+	return p.IsRetryableFunc(err)
+}
+
+// DiffValuesEquivalent implementation of
+// terraform.ResourceProviderValueNormalizer interface.
+func (p *Provider) DiffValuesEquivalent(
+	info *terraform.InstanceInfo, k, old, new string) bool {
+	if p.DiffValuesEquivalentFunc == nil {
+		return false
+	}
+
+	return p.DiffValuesEquivalentFunc(info, k, old, new)
+}
+
 // Resources implementation of terraform.ResourceProvider interface.
 func (p *Provider) Resources() []terraform.ResourceType {
 	keys := make([]string, 0, len(p.ResourcesMap))
@@ -258,12 +290,38 @@ func (p *Provider) Resources() []terraform.ResourceType {
 		result = append(result, terraform.ResourceType{
 			Name:       k,
 			Importable: resource.Importer != nil,
+			Schema:     resourceSchema(resource),
 		})
 	}
 
 	return result
 }
 
+// resourceSchema returns the schema of the attributes of the resource for
+// core, or nil if the resource has no schema.
+func resourceSchema(r *Resource) *terraform.ResourceSchema {
+	if len(r.Schema) == 0 {
+		return nil
+	}
+
+	result := &terraform.ResourceSchema{
+		Attributes: make(map[string]*terraform.ResourceSchema, len(r.Schema)),
+	}
+	for k, s := range r.Schema {
+		attr := &terraform.ResourceSchema{}
+		if elem, ok := s.Elem.(*Resource); ok {
+			if nested := resourceSchema(elem); nested != nil {
+				attr = nested
+			}
+		}
+		attr.ComputedOnly = s.Computed && !s.Optional && !s.Required
+
+		result.Attributes[k] = attr
+	}
+
+	return result
+}
+
 func (p *Provider) ImportState(
 	info *terraform.InstanceInfo,
 	id string) ([]*terraform.InstanceState, error) {
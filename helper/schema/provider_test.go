@@ -1,8 +1,10 @@
 package schema
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -12,6 +14,8 @@ import (
 
 func TestProvider_impl(t *testing.T) {
 	var _ terraform.ResourceProvider = new(Provider)
+	var _ terraform.ResourceProviderRetryClassifier = new(Provider)
+	var _ terraform.ResourceProviderValueNormalizer = new(Provider)
 }
 
 func TestProviderConfigure(t *testing.T) {
@@ -123,6 +127,67 @@ func TestProviderResources(t *testing.T) {
 				terraform.ResourceType{Name: "foo"},
 			},
 		},
+
+		{
+			P: &Provider{
+				ResourcesMap: map[string]*Resource{
+					"foo": &Resource{
+						Schema: map[string]*Schema{
+							"ami": &Schema{
+								Type:     TypeString,
+								Required: true,
+							},
+							"disk": &Schema{
+								Type:     TypeList,
+								Optional: true,
+								Elem: &Resource{
+									Schema: map[string]*Schema{
+										"size": &Schema{
+											Type:     TypeInt,
+											Optional: true,
+										},
+									},
+								},
+							},
+							"tags": &Schema{
+								Type:     TypeMap,
+								Optional: true,
+								Elem:     &Schema{Type: TypeString},
+							},
+							"arn": &Schema{
+								Type:     TypeString,
+								Computed: true,
+							},
+							"zone": &Schema{
+								Type:     TypeString,
+								Optional: true,
+								Computed: true,
+							},
+						},
+					},
+				},
+			},
+			Result: []terraform.ResourceType{
+				terraform.ResourceType{
+					Name: "foo",
+					Schema: &terraform.ResourceSchema{
+						Attributes: map[string]*terraform.ResourceSchema{
+							"ami": &terraform.ResourceSchema{},
+							"disk": &terraform.ResourceSchema{
+								Attributes: map[string]*terraform.ResourceSchema{
+									"size": &terraform.ResourceSchema{},
+								},
+							},
+							"tags": &terraform.ResourceSchema{},
+							"arn": &terraform.ResourceSchema{
+								ComputedOnly: true,
+							},
+							"zone": &terraform.ResourceSchema{},
+						},
+					},
+				},
+			},
+		},
 	}
 
 	for i, tc := range cases {
@@ -317,6 +382,68 @@ func TestProviderImportState_setsType(t *testing.T) {
 	}
 }
 
+func TestProviderIsRetryable(t *testing.T) {
+	errThrottled := errors.New("throttled")
+
+	cases := []struct {
+		Name     string
+		Func     func(error) bool
+		Err      error
+		Expected bool
+	}{
+		{"no func", nil, errThrottled, false},
+		{"nil error", func(error) bool { return true }, nil, false},
+		{
+			"retryable",
+			func(err error) bool { return err == errThrottled },
+			errThrottled,
+			true,
+		},
+		{
+			"not retryable",
+			func(err error) bool { return err == errThrottled },
+			errors.New("bad request"),
+			false,
+		},
+	}
+
+	for _, tc := range cases {
+		p := &Provider{IsRetryableFunc: tc.Func}
+		if actual := p.IsRetryable(tc.Err); actual != tc.Expected {
+			t.Fatalf("%s: expected %t, got %t", tc.Name, tc.Expected, actual)
+		}
+	}
+}
+
+func TestProviderDiffValuesEquivalent(t *testing.T) {
+	fold := func(info *terraform.InstanceInfo, k, old, new string) bool {
+		return k == "name" && strings.EqualFold(old, new)
+	}
+
+	cases := []struct {
+		Name     string
+		Func     func(*terraform.InstanceInfo, string, string, string) bool
+		Key      string
+		Old      string
+		New      string
+		Expected bool
+	}{
+		{"no func", nil, "name", "Foo", "foo", false},
+		{"equivalent", fold, "name", "Foo", "foo", true},
+		{"different", fold, "name", "Foo", "bar", false},
+		{"other key", fold, "tag", "Foo", "foo", false},
+	}
+
+	info := &terraform.InstanceInfo{Id: "foo", Type: "foo"}
+	for _, tc := range cases {
+		p := &Provider{DiffValuesEquivalentFunc: tc.Func}
+		actual := p.DiffValuesEquivalent(info, tc.Key, tc.Old, tc.New)
+		if actual != tc.Expected {
+			t.Fatalf("%s: expected %t, got %t", tc.Name, tc.Expected, actual)
+		}
+	}
+}
+
 func TestProviderMeta(t *testing.T) {
 	p := new(Provider)
 	if v := p.Meta(); v != nil {
@@ -169,6 +169,31 @@ func (p *ResourceProvider) Diff(
 	return resp.Diff, err
 }
 
+func (p *ResourceProvider) PlanModify(
+	info *terraform.InstanceInfo,
+	s *terraform.InstanceState,
+	c *terraform.ResourceConfig,
+	d *terraform.InstanceDiff) (*terraform.InstanceDiff, error) {
+	var resp ResourceProviderPlanModifyResponse
+	args := &ResourceProviderPlanModifyArgs{
+		Info:   info,
+		State:  s,
+		Config: c,
+		Diff:   d,
+	}
+	err := p.Client.Call("Plugin.PlanModify", args, &resp)
+	if err != nil {
+		// A failed call, such as to a provider built before PlanModify
+		// existed, leaves the diff unchanged.
+		return nil, nil
+	}
+	if resp.Error != nil {
+		err = resp.Error
+	}
+
+	return resp.Diff, err
+}
+
 func (p *ResourceProvider) ValidateDataSource(
 	t string, c *terraform.ResourceConfig) ([]string, []error) {
 	var resp ResourceProviderValidateResourceResponse
@@ -213,6 +238,40 @@ func (p *ResourceProvider) Refresh(
 	return resp.State, err
 }
 
+func (p *ResourceProvider) IsRetryable(err error) bool {
+	var resp ResourceProviderIsRetryableResponse
+	args := &ResourceProviderIsRetryableArgs{
+		Error: plugin.NewBasicError(err),
+	}
+
+	if err := p.Client.Call("Plugin.IsRetryable", args, &resp); err != nil {
+		// A failed call is treated as not retryable so the original
+		// error is reported as-is.
+		return false
+	}
+
+	return resp.Retryable
+}
+
+func (p *ResourceProvider) DiffValuesEquivalent(
+	info *terraform.InstanceInfo, k, old, new string) bool {
+	var resp ResourceProviderDiffValuesEquivalentResponse
+	args := &ResourceProviderDiffValuesEquivalentArgs{
+		Info: info,
+		Key:  k,
+		Old:  old,
+		New:  new,
+	}
+
+	if err := p.Client.Call("Plugin.DiffValuesEquivalent", args, &resp); err != nil {
+		// A failed call is treated as not equivalent so the diffs are
+		// compared strictly.
+		return false
+	}
+
+	return resp.Equivalent
+}
+
 func (p *ResourceProvider) ImportState(
 	info *terraform.InstanceInfo,
 	id string) ([]*terraform.InstanceState, error) {
@@ -233,6 +292,29 @@ func (p *ResourceProvider) ImportState(
 	return resp.State, err
 }
 
+func (p *ResourceProvider) ParseImportID(
+	info *terraform.InstanceInfo,
+	id string) (map[string]string, error) {
+	var resp ResourceProviderParseImportIDResponse
+	args := &ResourceProviderParseImportIDArgs{
+		Info: info,
+		Id:   id,
+	}
+
+	err := p.Client.Call("Plugin.ParseImportID", args, &resp)
+	if err != nil {
+		// A failed call, such as to a provider built before ParseImportID
+		// existed, imports the ID as it is, the same as a provider that
+		// doesn't parse its IDs.
+		return nil, nil
+	}
+	if resp.Error != nil {
+		err = resp.Error
+	}
+
+	return resp.Attributes, err
+}
+
 func (p *ResourceProvider) Resources() []terraform.ResourceType {
 	var result []terraform.ResourceType
 
@@ -348,6 +430,18 @@ type ResourceProviderDiffResponse struct {
 	Error *plugin.BasicError
 }
 
+type ResourceProviderPlanModifyArgs struct {
+	Info   *terraform.InstanceInfo
+	State  *terraform.InstanceState
+	Config *terraform.ResourceConfig
+	Diff   *terraform.InstanceDiff
+}
+
+type ResourceProviderPlanModifyResponse struct {
+	Diff  *terraform.InstanceDiff
+	Error *plugin.BasicError
+}
+
 type ResourceProviderRefreshArgs struct {
 	Info  *terraform.InstanceInfo
 	State *terraform.InstanceState
@@ -358,6 +452,25 @@ type ResourceProviderRefreshResponse struct {
 	Error *plugin.BasicError
 }
 
+type ResourceProviderIsRetryableArgs struct {
+	Error *plugin.BasicError
+}
+
+type ResourceProviderIsRetryableResponse struct {
+	Retryable bool
+}
+
+type ResourceProviderDiffValuesEquivalentArgs struct {
+	Info *terraform.InstanceInfo
+	Key  string
+	Old  string
+	New  string
+}
+
+type ResourceProviderDiffValuesEquivalentResponse struct {
+	Equivalent bool
+}
+
 type ResourceProviderImportStateArgs struct {
 	Info *terraform.InstanceInfo
 	Id   string
@@ -368,6 +481,16 @@ type ResourceProviderImportStateResponse struct {
 	Error *plugin.BasicError
 }
 
+type ResourceProviderParseImportIDArgs struct {
+	Info *terraform.InstanceInfo
+	Id   string
+}
+
+type ResourceProviderParseImportIDResponse struct {
+	Attributes map[string]string
+	Error      *plugin.BasicError
+}
+
 type ResourceProviderReadDataApplyArgs struct {
 	Info *terraform.InstanceInfo
 	Diff *terraform.InstanceDiff
@@ -504,6 +627,22 @@ func (s *ResourceProviderServer) Diff(
 	return nil
 }
 
+func (s *ResourceProviderServer) PlanModify(
+	args *ResourceProviderPlanModifyArgs,
+	result *ResourceProviderPlanModifyResponse) error {
+	// A provider that doesn't modify plans leaves the diff unchanged
+	var diff *terraform.InstanceDiff
+	var err error
+	if m, ok := s.Provider.(terraform.ResourceProviderPlanModifier); ok {
+		diff, err = m.PlanModify(args.Info, args.State, args.Config, args.Diff)
+	}
+	*result = ResourceProviderPlanModifyResponse{
+		Diff:  diff,
+		Error: plugin.NewBasicError(err),
+	}
+	return nil
+}
+
 func (s *ResourceProviderServer) Refresh(
 	args *ResourceProviderRefreshArgs,
 	result *ResourceProviderRefreshResponse) error {
@@ -515,6 +654,40 @@ func (s *ResourceProviderServer) Refresh(
 	return nil
 }
 
+func (s *ResourceProviderServer) IsRetryable(
+	args *ResourceProviderIsRetryableArgs,
+	result *ResourceProviderIsRetryableResponse) error {
+	var err error
+	if args.Error != nil {
+		err = args.Error
+	}
+
+	var retryable bool
+	if c, ok := s.Provider.(terraform.ResourceProviderRetryClassifier); ok {
+		retryable = c.IsRetryable(err)
+	}
+
+	*result = ResourceProviderIsRetryableResponse{
+		Retryable: retryable,
+	}
+	return nil
+}
+
+func (s *ResourceProviderServer) DiffValuesEquivalent(
+	args *ResourceProviderDiffValuesEquivalentArgs,
+	result *ResourceProviderDiffValuesEquivalentResponse) error {
+	var equivalent bool
+	if n, ok := s.Provider.(terraform.ResourceProviderValueNormalizer); ok {
+		equivalent = n.DiffValuesEquivalent(
+			args.Info, args.Key, args.Old, args.New)
+	}
+
+	*result = ResourceProviderDiffValuesEquivalentResponse{
+		Equivalent: equivalent,
+	}
+	return nil
+}
+
 func (s *ResourceProviderServer) ImportState(
 	args *ResourceProviderImportStateArgs,
 	result *ResourceProviderImportStateResponse) error {
@@ -526,6 +699,22 @@ func (s *ResourceProviderServer) ImportState(
 	return nil
 }
 
+func (s *ResourceProviderServer) ParseImportID(
+	args *ResourceProviderParseImportIDArgs,
+	result *ResourceProviderParseImportIDResponse) error {
+	// A provider that doesn't parse import IDs adds no attributes
+	var attrs map[string]string
+	var err error
+	if p, ok := s.Provider.(terraform.ResourceProviderImportIDParser); ok {
+		attrs, err = p.ParseImportID(args.Info, args.Id)
+	}
+	*result = ResourceProviderParseImportIDResponse{
+		Attributes: attrs,
+		Error:      plugin.NewBasicError(err),
+	}
+	return nil
+}
+
 func (s *ResourceProviderServer) Resources(
 	nothing interface{},
 	result *[]terraform.ResourceType) error {
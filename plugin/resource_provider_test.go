@@ -12,6 +12,8 @@ import (
 func TestResourceProvider_impl(t *testing.T) {
 	var _ plugin.Plugin = new(ResourceProviderPlugin)
 	var _ terraform.ResourceProvider = new(ResourceProvider)
+	var _ terraform.ResourceProviderRetryClassifier = new(ResourceProvider)
+	var _ terraform.ResourceProviderValueNormalizer = new(ResourceProvider)
 }
 
 func TestResourceProvider_stop(t *testing.T) {
@@ -295,6 +297,100 @@ func TestResourceProvider_diff(t *testing.T) {
 	}
 }
 
+func TestResourceProvider_planModify(t *testing.T) {
+	p := new(terraform.MockResourceProvider)
+
+	// Create a mock provider
+	client, _ := plugin.TestPluginRPCConn(t, pluginMap(&ServeOpts{
+		ProviderFunc: testProviderFixed(p),
+	}))
+	defer client.Close()
+
+	// Request the provider
+	raw, err := client.Dispense(ProviderPluginName)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	provider := raw.(terraform.ResourceProviderPlanModifier)
+
+	p.PlanModifyReturn = &terraform.InstanceDiff{
+		Attributes: map[string]*terraform.ResourceAttrDiff{
+			"foo": &terraform.ResourceAttrDiff{
+				Old: "",
+				New: "bar",
+			},
+			"size": &terraform.ResourceAttrDiff{
+				Old: "",
+				New: "small",
+			},
+		},
+	}
+
+	// PlanModify
+	info := &terraform.InstanceInfo{}
+	state := &terraform.InstanceState{}
+	config := &terraform.ResourceConfig{
+		Raw: map[string]interface{}{"foo": "bar"},
+	}
+	d := &terraform.InstanceDiff{
+		Attributes: map[string]*terraform.ResourceAttrDiff{
+			"foo": &terraform.ResourceAttrDiff{
+				Old: "",
+				New: "bar",
+			},
+		},
+	}
+	diff, err := provider.PlanModify(info, state, config, d)
+	if !p.PlanModifyCalled {
+		t.Fatal("PlanModify should be called")
+	}
+	if !reflect.DeepEqual(p.PlanModifyDiff, d) {
+		t.Fatalf("bad: %#v", p.PlanModifyDiff)
+	}
+	if err != nil {
+		t.Fatalf("bad: %#v", err)
+	}
+	if !reflect.DeepEqual(p.PlanModifyReturn, diff) {
+		t.Fatalf("bad: %#v", diff)
+	}
+}
+
+// Providers built before PlanModify was added to the protocol leave the
+// diff unchanged.
+func TestResourceProvider_planModifyUnsupported(t *testing.T) {
+	client, _ := plugin.TestPluginRPCConn(t, map[string]plugin.Plugin{
+		ProviderPluginName: new(testLegacyResourceProviderPlugin),
+	})
+	defer client.Close()
+
+	// Request the provider
+	raw, err := client.Dispense(ProviderPluginName)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	provider := raw.(terraform.ResourceProviderPlanModifier)
+
+	d := &terraform.InstanceDiff{
+		Attributes: map[string]*terraform.ResourceAttrDiff{
+			"foo": &terraform.ResourceAttrDiff{
+				Old: "",
+				New: "bar",
+			},
+		},
+	}
+	diff, err := provider.PlanModify(
+		&terraform.InstanceInfo{},
+		&terraform.InstanceState{},
+		&terraform.ResourceConfig{},
+		d)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if diff != nil {
+		t.Fatalf("bad: %#v", diff)
+	}
+}
+
 func TestResourceProvider_diff_error(t *testing.T) {
 	p := new(terraform.MockResourceProvider)
 
@@ -372,6 +468,77 @@ func TestResourceProvider_refresh(t *testing.T) {
 	}
 }
 
+func TestResourceProvider_isRetryable(t *testing.T) {
+	p := new(terraform.MockResourceProvider)
+
+	// Create a mock provider
+	client, _ := plugin.TestPluginRPCConn(t, pluginMap(&ServeOpts{
+		ProviderFunc: testProviderFixed(p),
+	}))
+	defer client.Close()
+
+	// Request the provider
+	raw, err := client.Dispense(ProviderPluginName)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	provider := raw.(terraform.ResourceProviderRetryClassifier)
+
+	p.IsRetryableReturn = true
+
+	// IsRetryable
+	retryable := provider.IsRetryable(errors.New("throttled"))
+	if !p.IsRetryableCalled {
+		t.Fatal("IsRetryable should be called")
+	}
+	if p.IsRetryableError == nil || p.IsRetryableError.Error() != "throttled" {
+		t.Fatalf("bad: %#v", p.IsRetryableError)
+	}
+	if !retryable {
+		t.Fatal("should be retryable")
+	}
+}
+
+func TestResourceProvider_diffValuesEquivalent(t *testing.T) {
+	p := new(terraform.MockResourceProvider)
+
+	// Create a mock provider
+	client, _ := plugin.TestPluginRPCConn(t, pluginMap(&ServeOpts{
+		ProviderFunc: testProviderFixed(p),
+	}))
+	defer client.Close()
+
+	// Request the provider
+	raw, err := client.Dispense(ProviderPluginName)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	provider := raw.(terraform.ResourceProviderValueNormalizer)
+
+	p.DiffValuesEquivalentReturn = true
+
+	// DiffValuesEquivalent
+	info := &terraform.InstanceInfo{Id: "foo"}
+	equivalent := provider.DiffValuesEquivalent(info, "name", "Foo", "foo")
+	if !p.DiffValuesEquivalentCalled {
+		t.Fatal("DiffValuesEquivalent should be called")
+	}
+	if p.DiffValuesEquivalentInfo == nil || p.DiffValuesEquivalentInfo.Id != "foo" {
+		t.Fatalf("bad: %#v", p.DiffValuesEquivalentInfo)
+	}
+	if p.DiffValuesEquivalentKey != "name" ||
+		p.DiffValuesEquivalentOld != "Foo" ||
+		p.DiffValuesEquivalentNew != "foo" {
+		t.Fatalf("bad: %q %q %q",
+			p.DiffValuesEquivalentKey,
+			p.DiffValuesEquivalentOld,
+			p.DiffValuesEquivalentNew)
+	}
+	if !equivalent {
+		t.Fatal("should be equivalent")
+	}
+}
+
 func TestResourceProvider_importState(t *testing.T) {
 	p := new(terraform.MockResourceProvider)
 
@@ -411,6 +578,67 @@ func TestResourceProvider_importState(t *testing.T) {
 	}
 }
 
+func TestResourceProvider_parseImportID(t *testing.T) {
+	p := new(terraform.MockResourceProvider)
+
+	// Create a mock provider
+	client, _ := plugin.TestPluginRPCConn(t, pluginMap(&ServeOpts{
+		ProviderFunc: testProviderFixed(p),
+	}))
+	defer client.Close()
+
+	// Request the provider
+	raw, err := client.Dispense(ProviderPluginName)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	provider := raw.(terraform.ResourceProviderImportIDParser)
+
+	p.ParseImportIDReturn = map[string]string{
+		"region": "us-west-2",
+	}
+
+	// ParseImportID
+	info := &terraform.InstanceInfo{}
+	attrs, err := provider.ParseImportID(info, "us-west-2/foo")
+	if !p.ParseImportIDCalled {
+		t.Fatal("ParseImportID should be called")
+	}
+	if p.ParseImportIDID != "us-west-2/foo" {
+		t.Fatalf("bad: %#v", p.ParseImportIDID)
+	}
+	if err != nil {
+		t.Fatalf("bad: %#v", err)
+	}
+	if !reflect.DeepEqual(p.ParseImportIDReturn, attrs) {
+		t.Fatalf("bad: %#v", attrs)
+	}
+}
+
+// Providers built before ParseImportID was added to the protocol import
+// the ID as it is.
+func TestResourceProvider_parseImportIDUnsupported(t *testing.T) {
+	client, _ := plugin.TestPluginRPCConn(t, map[string]plugin.Plugin{
+		ProviderPluginName: new(testLegacyResourceProviderPlugin),
+	})
+	defer client.Close()
+
+	// Request the provider
+	raw, err := client.Dispense(ProviderPluginName)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	provider := raw.(terraform.ResourceProviderImportIDParser)
+
+	attrs, err := provider.ParseImportID(&terraform.InstanceInfo{}, "us-west-2/foo")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if attrs != nil {
+		t.Fatalf("bad: %#v", attrs)
+	}
+}
+
 func TestResourceProvider_resources(t *testing.T) {
 	p := new(terraform.MockResourceProvider)
 
@@ -825,3 +1053,24 @@ func TestResourceProvider_close(t *testing.T) {
 		t.Fatal("should have error")
 	}
 }
+
+// testLegacyResourceProviderPlugin serves a provider whose server only
+// has the methods that every version of the protocol has, such as a
+// provider built against an older version of Terraform.
+type testLegacyResourceProviderPlugin struct {
+	ResourceProviderPlugin
+}
+
+func (p *testLegacyResourceProviderPlugin) Server(
+	b *plugin.MuxBroker) (interface{}, error) {
+	return new(testLegacyResourceProviderServer), nil
+}
+
+type testLegacyResourceProviderServer struct{}
+
+func (s *testLegacyResourceProviderServer) Stop(
+	_ interface{},
+	reply *ResourceProviderStopResponse) error {
+	*reply = ResourceProviderStopResponse{}
+	return nil
+}
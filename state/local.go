@@ -140,7 +140,7 @@ func (s *LocalState) WriteState(state *terraform.State) error {
 	s.state.IncrementSerialMaybe(s.readState)
 	s.readState = s.state
 
-	if err := terraform.WriteState(s.state, s.stateFileOut); err != nil {
+	if err := terraform.WriteStateStream(s.state, s.stateFileOut); err != nil {
 		return err
 	}
 
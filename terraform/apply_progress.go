@@ -0,0 +1,341 @@
+package terraform
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mitchellh/hashstructure"
+)
+
+// applyProgressVersion is the version of the format of the progress files
+// written with WriteApplyProgress.
+const applyProgressVersion = 1
+
+// ApplyProgress records the resource instances an apply has applied
+// successfully, so that an interrupted apply of a plan can be resumed by
+// applying the same plan again with the same ApplyProgress. The instances
+// that were already applied are then skipped instead of failing because
+// their state no longer matches the plan. It's safe for concurrent use and
+// is given to a context with ContextOpts.ApplyProgress.
+//
+// An instance is only skipped if its planned diff, its state and the
+// state of its dependencies are all the same as when it was applied. If
+// it's still planned the same but its state or the state of one of its
+// dependencies changed since, resuming fails, since the instance must be
+// planned again.
+//
+// The progress can be persisted with WriteApplyProgress as the apply goes,
+// for example whenever the state is persisted, and read back with
+// ReadApplyProgress.
+type ApplyProgress struct {
+	markers map[string]*applyProgressMarker
+	lock    sync.Mutex
+}
+
+// applyProgressMarker records that a single resource instance was applied.
+// Each field is a hash, of the planned diff, of the state written once the
+// instance was applied, and of the states of its dependencies then.
+type applyProgressMarker struct {
+	Diff         uint64 `json:"diff"`
+	State        uint64 `json:"state"`
+	Dependencies uint64 `json:"dependencies"`
+}
+
+// applyProgressFile is the format of the progress files.
+type applyProgressFile struct {
+	Version   int                             `json:"version"`
+	Resources map[string]*applyProgressMarker `json:"resources"`
+}
+
+// NewApplyProgress returns an ApplyProgress without any applied instances.
+func NewApplyProgress() *ApplyProgress {
+	return &ApplyProgress{markers: make(map[string]*applyProgressMarker)}
+}
+
+// ReadApplyProgress reads a progress written with WriteApplyProgress.
+func ReadApplyProgress(src io.Reader) (*ApplyProgress, error) {
+	var f applyProgressFile
+	if err := json.NewDecoder(src).Decode(&f); err != nil {
+		return nil, fmt.Errorf("Error decoding apply progress: %s", err)
+	}
+
+	if f.Version != applyProgressVersion {
+		return nil, fmt.Errorf(
+			"Terraform doesn't support apply progress version %d", f.Version)
+	}
+
+	result := NewApplyProgress()
+	for k, m := range f.Resources {
+		result.markers[k] = m
+	}
+
+	return result, nil
+}
+
+// WriteApplyProgress writes the progress to dst.
+func WriteApplyProgress(p *ApplyProgress, dst io.Writer) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	f := &applyProgressFile{
+		Version:   applyProgressVersion,
+		Resources: p.markers,
+	}
+	if err := json.NewEncoder(dst).Encode(f); err != nil {
+		return fmt.Errorf("Error writing apply progress: %s", err)
+	}
+
+	return nil
+}
+
+// Applied returns the addresses of the resource instances recorded as
+// applied, sorted.
+func (p *ApplyProgress) Applied() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	result := make([]string, 0, len(p.markers))
+	for k := range p.markers {
+		result = append(result, k)
+	}
+	sort.Strings(result)
+
+	return result
+}
+
+// copy returns a copy of the progress that's changed independently, or
+// nil if p is nil.
+func (p *ApplyProgress) copy() *ApplyProgress {
+	if p == nil {
+		return nil
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	result := NewApplyProgress()
+	for k, v := range p.markers {
+		result.markers[k] = v
+	}
+
+	return result
+}
+
+// get returns the marker of the instance with the given address, or nil
+// if it wasn't applied.
+func (p *ApplyProgress) get(addr string) *applyProgressMarker {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.markers[addr]
+}
+
+// set records that the instance with the given address was applied.
+func (p *ApplyProgress) set(addr string, m *applyProgressMarker) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.markers[addr] = m
+}
+
+// EvalCheckApplyProgress is an EvalNode implementation that skips the
+// apply of a resource instance if ContextOpts.ApplyProgress says an
+// interrupted apply of the same plan already applied it. It must come
+// right after the planned diff is read.
+type EvalCheckApplyProgress struct {
+	Name         string
+	Info         *InstanceInfo
+	Diff         **InstanceDiff
+	Dependencies []string
+
+	// OutputDiffHash is set to the hash of the planned diff, which is
+	// recorded with EvalRecordApplyProgress once the instance is applied.
+	OutputDiffHash *uint64
+}
+
+func (n *EvalCheckApplyProgress) Eval(ctx EvalContext) (interface{}, error) {
+	progress := ctx.ApplyProgress()
+	if progress == nil || *n.Diff == nil {
+		return nil, nil
+	}
+
+	diffHash, err := applyProgressDiffHash(*n.Diff)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", n.Name, err)
+	}
+	*n.OutputDiffHash = diffHash
+
+	// The marker of another plan is stale, so the instance is applied as
+	// usual then.
+	m := progress.get(applyProgressAddr(ctx, n.Name))
+	if m == nil || m.Diff != diffHash {
+		return nil, nil
+	}
+
+	stateHash, depsHash, err := applyProgressStateHashes(ctx, n.Name, n.Dependencies)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", n.Name, err)
+	}
+	if m.State != stateHash {
+		return nil, fmt.Errorf(
+			"%s: the state changed since the interrupted apply applied it, "+
+				"so it must be planned again", n.Name)
+	}
+	if m.Dependencies != depsHash {
+		return nil, fmt.Errorf(
+			"%s: the state of its dependencies changed since the interrupted "+
+				"apply applied it, so it must be planned again", n.Name)
+	}
+
+	log.Printf(
+		"[INFO] %s: already applied by the interrupted apply, skipping it",
+		n.Info.Id)
+
+	// There is nothing left to apply, like for an applied diff
+	var noDiff *InstanceDiff
+	if _, err := (&EvalWriteDiff{Name: n.Name, Diff: &noDiff}).Eval(ctx); err != nil {
+		return nil, err
+	}
+
+	err = ctx.Hook(func(h Hook) (HookAction, error) {
+		return h.ResourceUnchanged(n.Info)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, EvalEarlyExitError{}
+}
+
+// EvalRecordApplyProgress is an EvalNode implementation that records in
+// ContextOpts.ApplyProgress that a resource instance was applied, once its
+// state is written. Nothing is recorded if Error is set.
+type EvalRecordApplyProgress struct {
+	Name         string
+	DiffHash     *uint64
+	Dependencies []string
+	Error        *error
+}
+
+func (n *EvalRecordApplyProgress) Eval(ctx EvalContext) (interface{}, error) {
+	progress := ctx.ApplyProgress()
+	if progress == nil || (n.Error != nil && *n.Error != nil) {
+		return nil, nil
+	}
+
+	stateHash, depsHash, err := applyProgressStateHashes(ctx, n.Name, n.Dependencies)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", n.Name, err)
+	}
+
+	progress.set(applyProgressAddr(ctx, n.Name), &applyProgressMarker{
+		Diff:         *n.DiffHash,
+		State:        stateHash,
+		Dependencies: depsHash,
+	})
+
+	return nil, nil
+}
+
+// applyProgressAddr returns the address the state with the given name in
+// the module of ctx is recorded with.
+func applyProgressAddr(ctx EvalContext, name string) string {
+	path := normalizeModulePath(ctx.Path())
+	addr, err := parseResourceAddressInternal(name)
+	if err != nil {
+		// Keep the instances of different modules apart regardless
+		return strings.Join(append(path, name), ".")
+	}
+	addr.Path = path[1:]
+
+	return addr.String()
+}
+
+// applyProgressDiffHash returns the hash of a planned diff.
+func applyProgressDiffHash(d *InstanceDiff) (uint64, error) {
+	v := struct {
+		Attributes     map[string]*ResourceAttrDiff
+		Destroy        bool
+		DestroyDeposed bool
+		DestroyTainted bool
+	}{
+		Attributes:     d.CopyAttributes(),
+		Destroy:        d.GetDestroy(),
+		DestroyDeposed: d.GetDestroyDeposed(),
+		DestroyTainted: d.GetDestroyTainted(),
+	}
+
+	return hashstructure.Hash(v, nil)
+}
+
+// applyProgressStateHashes returns the hashes of the primary state with
+// the given name in the module of ctx, and of the states of the given
+// dependencies in the module.
+func applyProgressStateHashes(
+	ctx EvalContext, name string, deps []string) (uint64, uint64, error) {
+	state, lock := ctx.State()
+	lock.RLock()
+	defer lock.RUnlock()
+
+	var resources map[string]*ResourceState
+	if mod := state.ModuleByPath(ctx.Path()); mod != nil {
+		resources = mod.Resources
+	}
+
+	var primary *InstanceState
+	if rs := resources[name]; rs != nil {
+		primary = rs.Primary
+	}
+	stateHash, err := hashstructure.Hash(applyProgressInstance(primary), nil)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// The dependencies are by resource, so they include every instance
+	var depStates []interface{}
+	sorted := make([]string, len(deps))
+	copy(sorted, deps)
+	sort.Strings(sorted)
+	for _, dep := range sorted {
+		keys := make([]string, 0, len(resources))
+		for k := range resources {
+			if k == dep || strings.HasPrefix(k, dep+".") {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			depStates = append(depStates, k, applyProgressInstance(resources[k].Primary))
+		}
+	}
+	depsHash, err := hashstructure.Hash(depStates, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return stateHash, depsHash, nil
+}
+
+// applyProgressInstance returns the parts of an instance state that are
+// hashed. Meta isn't hashed, since its values can change type when the
+// state is persisted.
+func applyProgressInstance(s *InstanceState) interface{} {
+	v := struct {
+		ID         string
+		Attributes map[string]string
+		Tainted    bool
+	}{}
+	if s != nil {
+		v.ID = s.ID
+		v.Attributes = s.Attributes
+		v.Tainted = s.Tainted
+	}
+
+	return v
+}
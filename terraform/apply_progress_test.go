@@ -0,0 +1,34 @@
+package terraform
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApplyProgress_readWrite(t *testing.T) {
+	p := NewApplyProgress()
+	p.set("aws_instance.foo", &applyProgressMarker{Diff: 1, State: 2, Dependencies: 3})
+	p.set("module.child.aws_instance.bar[1]", &applyProgressMarker{Diff: 4})
+
+	var buf bytes.Buffer
+	if err := WriteApplyProgress(p, &buf); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual, err := ReadApplyProgress(&buf)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !reflect.DeepEqual(actual.markers, p.markers) {
+		t.Fatalf("bad: %#v", actual.markers)
+	}
+}
+
+func TestReadApplyProgress_badVersion(t *testing.T) {
+	_, err := ReadApplyProgress(strings.NewReader(`{"version": 42}`))
+	if err == nil {
+		t.Fatal("should error")
+	}
+}
@@ -2,11 +2,15 @@ package terraform
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"path"
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/hcl"
@@ -62,6 +66,164 @@ type ContextOpts struct {
 	Targets            []string
 	Variables          map[string]interface{}
 
+	// ProviderParallelism limits the number of resources that may be
+	// applied concurrently with a single provider, keyed by the provider
+	// name ("aws" or "aws.alias"). This is in addition to Parallelism.
+	// Providers without an entry are only limited by Parallelism. Each
+	// module has its own instance of a provider, with a limit of its own.
+	ProviderParallelism map[string]int
+
+	// DestroyParallelism, if set, limits the number of resources that may
+	// be destroyed concurrently during an apply, instead of Parallelism.
+	// The resources that are created or updated are still limited by
+	// Parallelism, separately. Destroys that depend on each other are
+	// always done one after the other, regardless.
+	DestroyParallelism int
+
+	// RefreshTargetsOnly, if true, will only refresh the resources that
+	// are directly targeted when Targets is set. The resources that they
+	// depend on keep their last-known state. This has no effect without
+	// Targets.
+	RefreshTargetsOnly bool
+
+	// ExpandTargets, if true, adds the resources that the Targets depend
+	// on to the Targets, so that they're targeted themselves instead of
+	// only being walked as dependencies. Resources that depend on the
+	// Targets are not added. See ExpandTargets.
+	ExpandTargets bool
+
+	// Replace is a list of resource addresses that are planned as a full
+	// replacement. Their diffs ignore the existing state and contain every
+	// configured attribute as if the resource were being created, plus a
+	// destroy of the existing resource. Nothing is changed unless the
+	// resulting plan is applied.
+	Replace []string
+
+	// ForceAttributes maps resource addresses to attributes that are forced
+	// into their diffs, even if the provider doesn't find a change to them,
+	// so that applying the diff sends them to the provider again. This is
+	// useful when an attribute was changed outside of Terraform in a way
+	// the provider can't detect. Forcing an attribute that requires a new
+	// resource replaces the resource.
+	ForceAttributes map[string][]string
+
+	// AttributeFilter, if set, limits the changes to the resources that
+	// are updated in place to the attributes whose keys match one of the
+	// glob patterns, such as "tags.*", so that the other changes, such as
+	// drift that must be left alone, aren't applied. A pattern that
+	// matches a block, such as "ebs_block_device", also matches all of
+	// its attributes. The resources that are created or replaced keep all
+	// their changes, and a plan that would leave out an attribute that
+	// requires the replacement fails. The same filter must be given to
+	// the context that applies the plan.
+	AttributeFilter []string
+
+	// StrictApply, if true, makes Apply return an error when the state
+	// a provider produces doesn't match the planned diff, instead of
+	// only recording a warning in ApplyWarnings. It also makes Apply fail
+	// before applying anything when a provider with a version constraint
+	// doesn't report its version.
+	StrictApply bool
+
+	// Moves are resources that were renamed or moved to another module in
+	// the configuration. Their state is moved to the new address before
+	// any operation, so they aren't destroyed and created again. The
+	// given State is not modified.
+	Moves []*ResourceMove
+
+	// BatchStateUpdates, if true, calls the PostStateUpdate hooks less
+	// often during a walk. Instead of after every resource is written to
+	// the state, the hooks are called once before anything is destroyed
+	// and once when the walk completes, including when it is interrupted.
+	// This avoids persisting the whole state after every resource.
+	BatchStateUpdates bool
+
+	// ResourceTimeout, if non-zero, limits how long applying a single
+	// resource instance may take as a whole, including interpolating its
+	// configuration and running its provisioners. This is a safety net
+	// against hangs that the lifecycle timeout of the provider apply
+	// doesn't cover. A resource instance that takes longer is abandoned
+	// and fails, and is tainted if its apply had already started.
+	ResourceTimeout time.Duration
+
+	// StateLockTimeout, if non-zero, limits how long reading or writing
+	// the state of a resource waits for the lock on the state. The lock
+	// is held while the hooks persist the state, so a slow backend can
+	// otherwise stall the whole walk. A resource that can't get the lock
+	// in time fails without touching the state.
+	StateLockTimeout time.Duration
+
+	// SkipProvisioners, if true, doesn't run the creation-time
+	// provisioners of the resources that are created. The resources are
+	// still applied as usual, and aren't tainted for the provisioners that
+	// didn't run. SkipDestroyProvisioners does the same for the
+	// destroy-time provisioners.
+	SkipProvisioners        bool
+	SkipDestroyProvisioners bool
+
+	// CoalesceProviders, if true, makes the resources of the providers in
+	// a module that have an identical configuration share a single
+	// provider instance during apply, instead of starting and configuring
+	// one per provider. Only the input asked for the provider that is kept
+	// is used, which is the first by name, such as "aws" before "aws.b".
+	CoalesceProviders bool
+
+	// Tracer, if set, traces applying the resources. Every resource that
+	// is applied gets a span, with child spans for computing its diff,
+	// applying it with the provider and running its provisioners.
+	Tracer Tracer
+
+	// DiffCache, if set, caches the diffs the providers compute, so the
+	// providers aren't asked again for the diffs of resources whose
+	// configuration and state didn't change. The same cache can be given
+	// to the contexts of multiple plans. See DiffCache.
+	DiffCache *DiffCache
+
+	// ManagedBy, if set, makes Plan warn about the resources whose state
+	// says they're managed by another configuration. See ManagedBy.
+	ManagedBy *ManagedBy
+
+	// RewriteProvisionerConfig, if set, is called with the configuration
+	// of every provisioner before it runs and can change it, for example
+	// to wrap commands. See ProvisionerConfigFunc.
+	RewriteProvisionerConfig ProvisionerConfigFunc
+
+	// StateLog, if set, gets a line of JSON for every change to the state
+	// of a resource instance when the state is changed, such as during
+	// apply. The lines are StateTransitions, and are meant for audit
+	// trails: unlike hooks they can't affect the operation.
+	StateLog io.Writer
+
+	// ApplyProgress, if set, records the resource instances Apply applies,
+	// and makes Apply skip the ones an interrupted apply of the same plan
+	// with the same ApplyProgress already applied. See ApplyProgress.
+	ApplyProgress *ApplyProgress
+
+	// ValidateUnreachable, if true, makes Validate warn about the resources
+	// of child modules that don't reference anything and that nothing
+	// references, since they may be unused. The resources of the root
+	// module are never reported.
+	ValidateUnreachable bool
+
+	// ApplyStages, if set, splits Apply into stages that are applied one
+	// after the other, each a list of resource addresses such as
+	// "aws_instance.foo" or "module.foo". The resources of a stage are
+	// applied in parallel as usual, once every resource of the stages
+	// before it is applied and ApplyGate allowed it. A resource is in the
+	// first stage that contains it, and the resources in no stage aren't
+	// held back. If a resource fails, the stages after it aren't applied.
+	ApplyStages [][]string
+
+	// ApplyGate, if set, is called before each stage of ApplyStages but the
+	// first, and can wait for an approval. See ApplyGateFunc.
+	ApplyGate ApplyGateFunc
+
+	// DeferDestroys, if true, makes Apply destroy resources only once every
+	// resource that's created or updated is applied. A resource that must
+	// be applied after a destroy, such as the replacement of a resource
+	// without create_before_destroy, is still applied after it.
+	DeferDestroys bool
+
 	UIInput UIInput
 }
 
@@ -89,14 +251,45 @@ type Context struct {
 	uiInput    UIInput
 	variables  map[string]interface{}
 
+	applyWarnings       []string
+	batchStateUpdates   bool
+	coalesceProviders   bool
+	destroySem          Semaphore
 	l                   sync.Mutex // Lock acquired during any task
 	parallelSem         Semaphore
+	providerParallelism map[string]int
 	providerInputConfig map[string]map[string]interface{}
+	refreshTargetsOnly  bool
+	replace             []*ResourceAddress
+	forceAttributes     []*forcedAttributes
+	attributeFilter     []string
+	resourceTimeout     time.Duration
+	stateLockTimeout    time.Duration
 	runLock             sync.Mutex
 	runCond             *sync.Cond
 	runContext          context.Context
 	runContextCancel    context.CancelFunc
+	runInterrupt        context.Context
+	runInterruptCancel  context.CancelFunc
 	shadowErr           error
+	skipProvisioners    bool
+	skipDestroyProvs    bool
+	strictApply         bool
+	tracer              Tracer
+	diffCache           *DiffCache
+	stateInvalidations  *stateInvalidations
+	managedBy           *ManagedBy
+	rewriteProvConfig   ProvisionerConfigFunc
+	stateLog            *stateLog
+	applyProgress       *ApplyProgress
+	validateUnreachable bool
+	applyStages         [][]*ResourceAddress
+	applyGate           ApplyGateFunc
+	deferDestroys       bool
+
+	// unrefreshedState is the state before the last Refresh, for the
+	// reasons of the diffs of the following Plan.
+	unrefreshedState *State
 }
 
 // NewContext creates a new Context structure.
@@ -141,6 +334,14 @@ func NewContext(opts *ContextOpts) (*Context, error) {
 	// has run.
 	state.TFVersion = Version
 
+	// Move the state of any resources that moved in the configuration
+	if len(opts.Moves) > 0 {
+		state = state.DeepCopy()
+		if err := state.MoveResources(opts.Moves); err != nil {
+			return nil, err
+		}
+	}
+
 	// Determine parallelism, default to 10. We do this both to limit
 	// CPU pressure but also to have an extra guard against rate throttling
 	// from providers.
@@ -149,6 +350,28 @@ func NewContext(opts *ContextOpts) (*Context, error) {
 		par = 10
 	}
 
+	// Check the per-provider limits on parallelism. The semaphores are
+	// created by the walks, for each provider instance.
+	for name, n := range opts.ProviderParallelism {
+		if n < 1 {
+			return nil, fmt.Errorf(
+				"provider %q: parallelism must be at least 1, got %d",
+				name, n)
+		}
+	}
+
+	// Destroys share the limit of the other resources unless they have
+	// their own
+	var destroySem Semaphore
+	if opts.DestroyParallelism < 0 {
+		return nil, fmt.Errorf(
+			"destroy parallelism must be at least 1, got %d",
+			opts.DestroyParallelism)
+	}
+	if opts.DestroyParallelism > 0 {
+		destroySem = NewSemaphore(opts.DestroyParallelism)
+	}
+
 	// Set up the variables in the following sequence:
 	//    0 - Take default values from the configuration
 	//    1 - Take values from TF_VAR_x environment variables
@@ -165,6 +388,68 @@ func NewContext(opts *ContextOpts) (*Context, error) {
 		}
 	}
 
+	// Target the dependencies of the targets if requested
+	targets := opts.Targets
+	if opts.ExpandTargets && len(targets) > 0 && opts.Module != nil {
+		var err error
+		targets, err = ExpandTargets(opts.Module, targets)
+		if err != nil {
+			return nil, err
+		}
+
+		log.Printf("[INFO] terraform: expanded targets: %v", targets)
+	}
+
+	// Parse the addresses of the resources to force a replacement of
+	var replace []*ResourceAddress
+	for _, v := range opts.Replace {
+		addr, err := ParseResourceAddress(v)
+		if err != nil {
+			return nil, fmt.Errorf("replace %q: %s", v, err)
+		}
+
+		replace = append(replace, addr)
+	}
+
+	// Parse the addresses of the resources to force attributes of
+	forceKeys := make([]string, 0, len(opts.ForceAttributes))
+	for k := range opts.ForceAttributes {
+		forceKeys = append(forceKeys, k)
+	}
+	sort.Strings(forceKeys)
+
+	forceAttrs := make([]*forcedAttributes, 0, len(forceKeys))
+	for _, k := range forceKeys {
+		addr, err := ParseResourceAddress(k)
+		if err != nil {
+			return nil, fmt.Errorf("force attributes %q: %s", k, err)
+		}
+
+		forceAttrs = append(forceAttrs, &forcedAttributes{
+			Addr:       addr,
+			Attributes: opts.ForceAttributes[k],
+		})
+	}
+
+	for _, p := range opts.AttributeFilter {
+		if _, err := path.Match(p, ""); err != nil {
+			return nil, fmt.Errorf("attribute filter %q: %s", p, err)
+		}
+	}
+
+	// Parse the addresses of the resources of each stage of the apply
+	applyStages := make([][]*ResourceAddress, len(opts.ApplyStages))
+	for i, stage := range opts.ApplyStages {
+		for _, v := range stage {
+			addr, err := ParseResourceAddress(v)
+			if err != nil {
+				return nil, fmt.Errorf("apply stage %d: %q: %s", i, v, err)
+			}
+
+			applyStages[i] = append(applyStages[i], addr)
+		}
+	}
+
 	diff := opts.Diff
 	if diff == nil {
 		diff = &Diff{}
@@ -181,13 +466,37 @@ func NewContext(opts *ContextOpts) (*Context, error) {
 		module:    opts.Module,
 		shadow:    opts.Shadow,
 		state:     state,
-		targets:   opts.Targets,
+		targets:   targets,
 		uiInput:   opts.UIInput,
 		variables: variables,
 
+		batchStateUpdates:   opts.BatchStateUpdates,
+		coalesceProviders:   opts.CoalesceProviders,
+		destroySem:          destroySem,
 		parallelSem:         NewSemaphore(par),
+		providerParallelism: opts.ProviderParallelism,
 		providerInputConfig: make(map[string]map[string]interface{}),
+		refreshTargetsOnly:  opts.RefreshTargetsOnly && len(targets) > 0,
+		replace:             replace,
+		forceAttributes:     forceAttrs,
+		attributeFilter:     opts.AttributeFilter,
+		resourceTimeout:     opts.ResourceTimeout,
+		stateLockTimeout:    opts.StateLockTimeout,
 		sh:                  sh,
+		skipProvisioners:    opts.SkipProvisioners,
+		skipDestroyProvs:    opts.SkipDestroyProvisioners,
+		strictApply:         opts.StrictApply,
+		tracer:              opts.Tracer,
+		diffCache:           opts.DiffCache,
+		stateInvalidations:  newStateInvalidations(),
+		managedBy:           opts.ManagedBy,
+		rewriteProvConfig:   opts.RewriteProvisionerConfig,
+		stateLog:            newStateLog(opts.StateLog),
+		applyProgress:       opts.ApplyProgress,
+		validateUnreachable: opts.ValidateUnreachable,
+		applyStages:         applyStages,
+		applyGate:           opts.ApplyGate,
+		deferDestroys:       opts.DeferDestroys,
 	}, nil
 }
 
@@ -199,6 +508,13 @@ type ContextGraphOpts struct {
 	Verbose bool
 }
 
+// forcedAttributes are the attributes that are forced into the diffs of
+// the resources with an address, as configured with ForceAttributes.
+type forcedAttributes struct {
+	Addr       *ResourceAddress
+	Attributes []string
+}
+
 // Graph returns the graph used for the given operation type.
 //
 // The most extensive or complex graph type is GraphTypePlan.
@@ -217,6 +533,11 @@ func (c *Context) Graph(typ GraphType, opts *ContextGraphOpts) (*Graph, error) {
 			Provisioners: c.components.ResourceProvisioners(),
 			Destroy:      c.destroy,
 			Validate:     opts.Validate,
+
+			CoalesceProviders:      c.coalesceProviders,
+			StrictProviderVersions: c.strictApply,
+			Stages:                 c.applyStages,
+			DeferDestroys:          c.deferDestroys,
 		}).Build(RootModulePath)
 
 	case GraphTypeInput:
@@ -465,12 +786,28 @@ func (c *Context) Apply() (*State, error) {
 		err = multierror.Append(err, walker.ValidationErrors...)
 	}
 
+	// Record the warnings, or turn them into errors if we're strict
+	c.applyWarnings = walker.ValidationWarnings
+	if c.strictApply {
+		for _, w := range walker.ValidationWarnings {
+			err = multierror.Append(err, errors.New(w))
+		}
+
+		c.applyWarnings = nil
+	}
+
 	// Clean out any unused things
 	c.state.prune()
 
 	return c.state, err
 }
 
+// ApplyWarnings returns the warnings from the last call to Apply, such as
+// resources whose applied state doesn't match the plan.
+func (c *Context) ApplyWarnings() []string {
+	return c.applyWarnings
+}
+
 // Plan generates an execution plan for the given context.
 //
 // The execution plan encapsulates the context and can be stored
@@ -504,6 +841,10 @@ func (c *Context) Plan() (*Plan, error) {
 		}
 		defer func() {
 			c.state = old
+
+			// The plan was made with the states that were refreshed
+			// because they were invalidated, so they're kept.
+			c.stateInvalidations.writeRefreshed(old)
 		}()
 
 		operation = walkPlan
@@ -531,6 +872,7 @@ func (c *Context) Plan() (*Plan, error) {
 		return nil, err
 	}
 	p.Diff = c.diff
+	p.Warnings = walker.resourceWarnings.planWarnings()
 
 	// If this is true, it means we're running unit tests. In this case,
 	// we perform a deep copy just to ensure that all context tests also
@@ -562,6 +904,37 @@ func (c *Context) Plan() (*Plan, error) {
 	return p, errs
 }
 
+// InvalidateState marks the states of the given resource instances as
+// stale, so the next Plan refreshes them with their providers before
+// planning them. This refreshes single resources without refreshing the
+// whole state. The refreshed states are kept in the state of the context.
+//
+// The addresses must be of resource instances, such as "aws_instance.foo"
+// or "module.child.aws_instance.bar[1]".
+func (c *Context) InvalidateState(addrs ...string) error {
+	parsed := make([]*ResourceAddress, len(addrs))
+	for i, v := range addrs {
+		addr, err := ParseResourceAddress(v)
+		if err != nil {
+			return err
+		}
+		if addr.Name == "" {
+			return fmt.Errorf("%s: must be the address of a resource", v)
+		}
+		if addr.Mode != config.ManagedResourceMode {
+			return fmt.Errorf("%s: data sources are read on every plan", v)
+		}
+
+		parsed[i] = addr
+	}
+
+	for _, addr := range parsed {
+		c.stateInvalidations.add(addr)
+	}
+
+	return nil
+}
+
 // Refresh goes through all the resources in the state and refreshes them
 // to their latest state. This will update the state that this context
 // works with, along with returning it.
@@ -571,7 +944,9 @@ func (c *Context) Plan() (*Plan, error) {
 func (c *Context) Refresh() (*State, error) {
 	defer c.acquireRun("refresh")()
 
-	// Copy our own state
+	// Copy our own state, keeping the one from before the refresh so
+	// that the plan can tell what changed outside of Terraform.
+	c.unrefreshedState = c.state
 	c.state = c.state.DeepCopy()
 
 	// Build the graph.
@@ -620,6 +995,44 @@ func (c *Context) Stop() {
 	log.Printf("[WARN] terraform: stop complete")
 }
 
+// Interrupt gracefully stops the running task. Nothing new is started,
+// but resources that are already being applied are allowed to finish
+// and have their state recorded. Unlike Stop, providers and provisioners
+// aren't asked to cancel what they're doing.
+//
+// Calling Interrupt again while the task is still running stops it the
+// same as Stop does.
+//
+// Interrupt will block until the task completes.
+func (c *Context) Interrupt() {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	if c.runContextCancel != nil {
+		if c.runInterruptCancel == nil {
+			// We were already interrupted, so cancel what's in flight too
+			log.Printf("[WARN] terraform: Interrupt called again, stopping")
+			c.runContextCancel()
+			c.runContextCancel = nil
+		} else {
+			log.Printf("[WARN] terraform: Interrupt called, finishing in-flight work")
+
+			// Tell the hook we want to stop, so nothing new starts
+			c.sh.Stop()
+
+			c.runInterruptCancel()
+			c.runInterruptCancel = nil
+		}
+	}
+
+	// Grab the condition var before we exit
+	if cond := c.runCond; cond != nil {
+		cond.Wait()
+	}
+
+	log.Printf("[WARN] terraform: interrupt complete")
+}
+
 // Validate validates the configuration and returns any warnings or errors.
 func (c *Context) Validate() ([]string, []error) {
 	defer c.acquireRun("validate")()
@@ -661,9 +1074,15 @@ func (c *Context) Validate() ([]string, []error) {
 		return nil, multierror.Append(errs, err).Errors
 	}
 
+	// Report the resources nothing is connected to, if requested
+	warns := walker.ValidationWarnings
+	if c.validateUnreachable {
+		warns = append(warns, unreachableResourceWarnings(graph)...)
+	}
+
 	// Return the result
 	rerrs := multierror.Append(errs, walker.ValidationErrors...)
-	return walker.ValidationWarnings, rerrs.Errors
+	return warns, rerrs.Errors
 }
 
 // Module returns the module tree associated with this context.
@@ -703,6 +1122,10 @@ func (c *Context) acquireRun(phase string) func() {
 	// Create a new run context
 	c.runContext, c.runContextCancel = context.WithCancel(context.Background())
 
+	// The interrupt context is canceled by Interrupt, and also when the
+	// run context is canceled since a stop implies an interrupt.
+	c.runInterrupt, c.runInterruptCancel = context.WithCancel(c.runContext)
+
 	// Reset the stop hook so we're not stopped
 	c.sh.Reset()
 
@@ -727,6 +1150,9 @@ func (c *Context) releaseRun() {
 	if c.runContextCancel != nil {
 		c.runContextCancel()
 	}
+	if c.runInterruptCancel != nil {
+		c.runInterruptCancel()
+	}
 
 	// Unlock all waiting our condition
 	cond := c.runCond
@@ -735,6 +1161,7 @@ func (c *Context) releaseRun() {
 
 	// Unset the context
 	c.runContext = nil
+	c.runInterrupt = nil
 }
 
 func (c *Context) walk(
@@ -766,21 +1193,34 @@ func (c *Context) walk(
 	log.Printf("[DEBUG] Starting graph walk: %s", operation.String())
 
 	walker := &ContextGraphWalker{
-		Context:     realCtx,
-		Operation:   operation,
-		StopContext: c.runContext,
+		Context:          realCtx,
+		Operation:        operation,
+		StopContext:      c.runContext,
+		InterruptContext: c.runInterrupt,
 	}
 
 	// Watch for a stop so we can call the provider Stop() API.
 	doneCh := make(chan struct{})
 	stopCh := c.runContext.Done()
-	go c.watchStop(walker, doneCh, stopCh)
+	watchDoneCh := make(chan struct{})
+	go func() {
+		defer close(watchDoneCh)
+		c.watchStop(walker, doneCh, stopCh)
+	}()
 
 	// Walk the real graph, this will block until it completes
 	realErr := graph.Walk(walker)
 
-	// Close the done channel so the watcher stops
+	// Call the state hooks for any batched updates, even if the walk
+	// failed or was stopped, so that everything applied is persisted.
+	if err := walker.flushStateUpdates(); err != nil {
+		realErr = multierror.Append(realErr, err)
+	}
+
+	// Close the done channel so the watcher stops, and wait for it so
+	// that the Stop calls of a stopped walk complete before we return
 	close(doneCh)
+	<-watchDoneCh
 
 	// If we have a shadow graph and we interrupted the real graph, then
 	// we just close the shadow and never verify it. It is non-trivial to
@@ -3,6 +3,7 @@ package terraform
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
 	"reflect"
 	"sort"
 	"strings"
@@ -631,6 +632,248 @@ func TestContext2Apply_providerAliasConfigure(t *testing.T) {
 	}
 }
 
+// Each resource must be applied with the provider instance for its alias,
+// and a resource without an alias with the default provider.
+func TestContext2Apply_providerAliasMulti(t *testing.T) {
+	m := testModule(t, "apply-provider-alias-multi")
+
+	var l sync.Mutex
+	applied := make(map[string]string)
+	factory := func() (ResourceProvider, error) {
+		var region string
+		p := testProvider("aws")
+		p.DiffFn = testDiffFn
+		p.ConfigureFn = func(c *ResourceConfig) error {
+			v, _ := c.Get("region")
+			region, _ = v.(string)
+			return nil
+		}
+		p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
+			l.Lock()
+			defer l.Unlock()
+			applied[info.Id] = region
+
+			return testApplyFn(info, s, d)
+		}
+
+		return p, nil
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": factory,
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := ctx.Apply(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := map[string]string{
+		"aws_instance.default": "default",
+		"aws_instance.east":    "east",
+		"aws_instance.west":    "west",
+	}
+	if !reflect.DeepEqual(applied, expected) {
+		t.Fatalf("bad: %#v", applied)
+	}
+}
+
+func TestContext2Apply_inconsistentState(t *testing.T) {
+	m := testModule(t, "apply-inconsistent-state")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+	p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
+		result, err := testApplyFn(info, s, d)
+		if err != nil {
+			return nil, err
+		}
+
+		// The computed ip is exempt, but num doesn't match the plan
+		result.Attributes["ip"] = "1.2.3.4"
+		result.Attributes["num"] = "3"
+		return result, nil
+	}
+
+	cases := map[string]struct {
+		Strict bool
+	}{
+		"warning": {false},
+		"strict":  {true},
+	}
+
+	for k, tc := range cases {
+		ctx := testContext2(t, &ContextOpts{
+			Module: m,
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+			StrictApply: tc.Strict,
+		})
+
+		if _, err := ctx.Plan(); err != nil {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+
+		state, err := ctx.Apply()
+
+		var msgs []string
+		if tc.Strict {
+			if err == nil {
+				t.Fatalf("%s: should error", k)
+			}
+			msgs = append(msgs, err.Error())
+		} else {
+			if err != nil {
+				t.Fatalf("%s: err: %s", k, err)
+			}
+			msgs = ctx.ApplyWarnings()
+		}
+
+		if len(msgs) != 1 {
+			t.Fatalf("%s: expected 1 diagnostic, got: %#v", k, msgs)
+		}
+		if !strings.Contains(msgs[0], `"num" was planned to be "2", but the provider produced "3"`) {
+			t.Fatalf("%s: bad: %s", k, msgs[0])
+		}
+		if strings.Contains(msgs[0], `"ip"`) {
+			t.Fatalf("%s: computed attribute should be exempt: %s", k, msgs[0])
+		}
+
+		// The state from the provider is kept either way
+		rs := state.RootModule().Resources["aws_instance.foo"]
+		if rs == nil || rs.Primary.Attributes["num"] != "3" {
+			t.Fatalf("%s: bad state:\n%s", k, state)
+		}
+	}
+}
+
+func TestContext2Apply_consistentState(t *testing.T) {
+	m := testModule(t, "apply-inconsistent-state")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+	p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
+		result, err := testApplyFn(info, s, d)
+		if err != nil {
+			return nil, err
+		}
+
+		// Any value for a computed attribute is consistent
+		result.Attributes["ip"] = "1.2.3.4"
+		return result, nil
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		StrictApply: true,
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := ctx.Apply(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if ws := ctx.ApplyWarnings(); len(ws) > 0 {
+		t.Fatalf("bad: %#v", ws)
+	}
+}
+
+func TestContext2Apply_dependenciesFunc(t *testing.T) {
+	m := testModule(t, "apply-dependencies-func")
+	p := testProvider("aws")
+	pr := testProvisioner()
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The connection of the provisioner is a dependency too
+	mod := state.RootModule()
+	expected := []string{"aws_instance.a", "aws_instance.b"}
+	if actual := mod.Resources["aws_instance.c"].Dependencies; !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+	if actual := mod.Resources["aws_instance.d"].Primary.Attributes["foo"]; actual != strings.Join(expected, ",") {
+		t.Fatalf("bad: %#v", actual)
+	}
+	if actual := mod.Outputs["deps"].Value; actual != "aws_instance.a" {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	// They're known when planning, so the plan is empty once applied
+	ctx = testContext2(t, &ContextOpts{
+		Module: m,
+		State:  state,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
+	})
+	plan, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !plan.Diff.Empty() {
+		t.Fatalf("bad: %s", plan)
+	}
+}
+
+func TestContext2Apply_interpolateTry(t *testing.T) {
+	m := testModule(t, "apply-interpolate-try")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyInterpolateTryStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+}
+
 // GH-2870
 func TestContext2Apply_providerWarning(t *testing.T) {
 	m := testModule(t, "apply-provider-warning")
@@ -1136,22 +1379,116 @@ aws_instance.bar:
 	`)
 }
 
-func TestContext2Apply_destroyComputed(t *testing.T) {
-	m := testModule(t, "apply-destroy-computed")
+// Test that a deposed instance left behind for a resource that is no
+// longer in the config is destroyed, even without a primary instance.
+func TestContext2Apply_createBeforeDestroy_deposedOrphan(t *testing.T) {
+	cases := map[string]struct {
+		Primary  *InstanceState
+		Expected []string
+	}{
+		"no primary": {
+			nil,
+			[]string{"destroy foo"},
+		},
+		"primary": {
+			&InstanceState{ID: "bar"},
+			[]string{"destroy bar", "destroy foo"},
+		},
+	}
+
+	for k, tc := range cases {
+		m := testModule(t, "empty")
+		p := testProvider("aws")
+		p.DiffFn = testDiffFn
+
+		var l sync.Mutex
+		var destroyed []string
+		p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
+			l.Lock()
+			defer l.Unlock()
+			if d.Destroy {
+				destroyed = append(destroyed, "destroy "+s.ID)
+			}
+
+			return testApplyFn(info, s, d)
+		}
+
+		state := &State{
+			Modules: []*ModuleState{
+				&ModuleState{
+					Path: rootModulePath,
+					Resources: map[string]*ResourceState{
+						"aws_instance.bar": &ResourceState{
+							Type:    "aws_instance",
+							Primary: tc.Primary,
+							Deposed: []*InstanceState{
+								&InstanceState{
+									ID: "foo",
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+
+		ctx := testContext2(t, &ContextOpts{
+			Module: m,
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+			State: state,
+		})
+
+		if _, err := ctx.Plan(); err != nil {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+
+		state, err := ctx.Apply()
+		if err != nil {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+
+		sort.Strings(destroyed)
+		if !reflect.DeepEqual(destroyed, tc.Expected) {
+			t.Fatalf("%s: bad: %#v", k, destroyed)
+		}
+
+		checkStateString(t, state, "<no state>")
+	}
+}
+
+// Test that a deposed instance isn't destroyed before the create that
+// replaces it has finished.
+func TestContext2Apply_createBeforeDestroy_deposedNoPrimary(t *testing.T) {
+	m := testModule(t, "apply-cbd-deposed-only")
 	p := testProvider("aws")
-	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
+
+	var l sync.Mutex
+	var order []string
+	p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
+		l.Lock()
+		defer l.Unlock()
+		if d.Destroy {
+			order = append(order, "destroy "+s.ID)
+		} else {
+			order = append(order, "create")
+		}
+
+		return testApplyFn(info, s, d)
+	}
+
 	state := &State{
 		Modules: []*ModuleState{
 			&ModuleState{
 				Path: rootModulePath,
 				Resources: map[string]*ResourceState{
-					"aws_instance.foo": &ResourceState{
+					"aws_instance.bar": &ResourceState{
 						Type: "aws_instance",
-						Primary: &InstanceState{
-							ID: "foo",
-							Attributes: map[string]string{
-								"output": "value",
+						Deposed: []*InstanceState{
+							&InstanceState{
+								ID: "foo",
 							},
 						},
 					},
@@ -1159,37 +1496,210 @@ func TestContext2Apply_destroyComputed(t *testing.T) {
 			},
 		},
 	}
+
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
-		State:   state,
-		Destroy: true,
+		State: state,
 	})
 
-	if p, err := ctx.Plan(); err != nil {
+	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
-	} else {
-		t.Logf(p.String())
 	}
 
-	if _, err := ctx.Apply(); err != nil {
+	state, err := ctx.Apply()
+	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
-}
 
-// Test that the destroy operation uses depends_on as a source of ordering.
-func TestContext2Apply_destroyDependsOn(t *testing.T) {
-	// It is possible for this to be racy, so we loop a number of times
-	// just to check.
-	for i := 0; i < 10; i++ {
-		testContext2Apply_destroyDependsOn(t)
+	expected := []string{"create", "destroy foo"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Fatalf("bad: %#v", order)
 	}
+
+	checkStateString(t, state, `
+aws_instance.bar:
+  ID = foo
+	`)
 }
 
-func testContext2Apply_destroyDependsOn(t *testing.T) {
-	m := testModule(t, "apply-destroy-depends-on")
+// Two diff keys that parse to the same instance would overwrite each other
+// in the state.
+func TestContext2Apply_stateIdCollision(t *testing.T) {
+	m := testModule(t, "apply-state-id-collision")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	attrs := func() map[string]*ResourceAttrDiff {
+		return map[string]*ResourceAttrDiff{
+			"type": &ResourceAttrDiff{New: "aws_instance"},
+		}
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Diff: &Diff{
+			Modules: []*ModuleDiff{
+				&ModuleDiff{
+					Path: rootModulePath,
+					Resources: map[string]*InstanceDiff{
+						"aws_instance.foo.1":  &InstanceDiff{Attributes: attrs()},
+						"aws_instance.foo.01": &InstanceDiff{Attributes: attrs()},
+					},
+				},
+			},
+		},
+	})
+
+	_, err := ctx.Apply()
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), "aws_instance.foo[1] is in the graph more than once") {
+		t.Fatalf("bad: %s", err)
+	}
+	if p.ApplyCalled {
+		t.Fatal("nothing should be applied")
+	}
+}
+
+func TestContext2Apply_preventDestroy(t *testing.T) {
+	cases := map[string]*InstanceDiff{
+		"destroy": &InstanceDiff{Destroy: true},
+
+		"replace": &InstanceDiff{
+			Attributes: map[string]*ResourceAttrDiff{
+				"require_new": &ResourceAttrDiff{
+					Old:         "no",
+					New:         "yes",
+					RequiresNew: true,
+				},
+			},
+		},
+	}
+
+	for k, d := range cases {
+		m := testModule(t, "apply-prevent-destroy")
+		p := testProvider("aws")
+		p.ApplyFn = testApplyFn
+		p.DiffFn = testDiffFn
+		state := &State{
+			Modules: []*ModuleState{
+				&ModuleState{
+					Path: rootModulePath,
+					Resources: map[string]*ResourceState{
+						"aws_instance.foo": &ResourceState{
+							Type: "aws_instance",
+							Primary: &InstanceState{
+								ID:         "foo",
+								Attributes: map[string]string{"require_new": "no"},
+							},
+						},
+					},
+				},
+			},
+		}
+
+		// Nothing orders bar after foo, so bar would be applied if the
+		// check happened during the walk.
+		diff := &Diff{
+			Modules: []*ModuleDiff{
+				&ModuleDiff{
+					Path: rootModulePath,
+					Resources: map[string]*InstanceDiff{
+						"aws_instance.foo": d,
+						"aws_instance.bar": &InstanceDiff{
+							Attributes: map[string]*ResourceAttrDiff{
+								"foo": &ResourceAttrDiff{
+									New: "bar",
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+
+		ctx := testContext2(t, &ContextOpts{
+			Module: m,
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+			State: state,
+			Diff:  diff,
+		})
+
+		_, err := ctx.Apply()
+		if err == nil {
+			t.Fatalf("%s: should error", k)
+		}
+		if !strings.Contains(err.Error(), "aws_instance.foo: the plan would destroy") {
+			t.Fatalf("%s: bad: %s", k, err)
+		}
+		if p.ApplyCalled {
+			t.Fatalf("%s: nothing should be applied", k)
+		}
+	}
+}
+
+func TestContext2Apply_destroyComputed(t *testing.T) {
+	m := testModule(t, "apply-destroy-computed")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "foo",
+							Attributes: map[string]string{
+								"output": "value",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State:   state,
+		Destroy: true,
+	})
+
+	if p, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	} else {
+		t.Logf(p.String())
+	}
+
+	if _, err := ctx.Apply(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+// Test that the destroy operation uses depends_on as a source of ordering.
+func TestContext2Apply_destroyDependsOn(t *testing.T) {
+	// It is possible for this to be racy, so we loop a number of times
+	// just to check.
+	for i := 0; i < 10; i++ {
+		testContext2Apply_destroyDependsOn(t)
+	}
+}
+
+func testContext2Apply_destroyDependsOn(t *testing.T) {
+	m := testModule(t, "apply-destroy-depends-on")
 	p := testProvider("aws")
 	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
@@ -1642,288 +2152,198 @@ func TestContext2Apply_badDiff(t *testing.T) {
 	}
 }
 
-func TestContext2Apply_cancel(t *testing.T) {
-	stopped := false
-
-	m := testModule(t, "apply-cancel")
+func TestContext2Apply_errorMultiple(t *testing.T) {
+	m := testModule(t, "apply-error-multiple")
 	p := testProvider("aws")
-	ctx := testContext2(t, &ContextOpts{
-		Module: m,
-		Providers: map[string]ResourceProviderFactory{
-			"aws": testProviderFuncFixed(p),
-		},
-	})
+	p.DiffFn = testDiffFn
 
+	errFail := fmt.Errorf("failure")
 	p.ApplyFn = func(*InstanceInfo, *InstanceState, *InstanceDiff) (*InstanceState, error) {
-		if !stopped {
-			stopped = true
-			go ctx.Stop()
-
-			for {
-				if ctx.sh.Stopped() {
-					break
-				}
-			}
-		}
-
-		return &InstanceState{
-			ID: "foo",
-			Attributes: map[string]string{
-				"num": "2",
-			},
-		}, nil
+		return nil, errFail
 	}
-	p.DiffFn = func(*InstanceInfo, *InstanceState, *ResourceConfig) (*InstanceDiff, error) {
-		return &InstanceDiff{
-			Attributes: map[string]*ResourceAttrDiff{
-				"num": &ResourceAttrDiff{
-					New: "bar",
+
+	// aws_instance.ok is already up to date, so it exits early
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.ok": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID:         "ok",
+							Attributes: map[string]string{"num": "3"},
+						},
+					},
 				},
 			},
-		}, nil
+		},
 	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: s,
+	})
 
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	// Start the Apply in a goroutine
-	var applyErr error
-	stateCh := make(chan *State)
-	go func() {
-		state, err := ctx.Apply()
-		if err != nil {
-			applyErr = err
-		}
-
-		stateCh <- state
-	}()
-
-	state := <-stateCh
-	if applyErr != nil {
-		t.Fatalf("err: %s", applyErr)
+	_, err := ctx.Apply()
+	if err == nil {
+		t.Fatal("should error")
 	}
 
-	mod := state.RootModule()
-	if len(mod.Resources) != 1 {
-		t.Fatalf("bad: %s", state.String())
+	errs := ResourceErrors(err)
+	expected := []string{
+		"aws_instance.bar",
+		"aws_instance.foo[0]",
+		"aws_instance.foo[1]",
 	}
-
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyCancelStr)
-	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
+	actual := make([]string, 0, len(errs))
+	for k, v := range errs {
+		actual = append(actual, k)
+		if v != errFail {
+			t.Fatalf("%s: original error should be preserved: %#v", k, v)
+		}
 	}
-
-	if !p.StopCalled {
-		t.Fatal("stop should be called")
+	sort.Strings(actual)
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v\n\n%s", actual, err)
 	}
 }
 
-func TestContext2Apply_cancelBlock(t *testing.T) {
-	m := testModule(t, "apply-cancel-block")
+func TestContext2Apply_replaceTriggeredByCreateBeforeDestroy(t *testing.T) {
+	m := testModule(t, "apply-replace-triggered-by-cbd")
 	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+
+	var l sync.Mutex
+	var order []string
+	p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
+		l.Lock()
+		defer l.Unlock()
+
+		if d.Destroy {
+			order = append(order, "destroy "+info.Id)
+		} else {
+			order = append(order, "apply "+info.Id)
+		}
+
+		return testApplyFn(info, s, d)
+	}
+
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "foo",
+							Attributes: map[string]string{
+								"ami":  "old",
+								"type": "aws_instance",
+							},
+						},
+					},
+					"aws_instance.bar": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bar",
+							Attributes: map[string]string{
+								"num":  "1",
+								"type": "aws_instance",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
+		State: s,
 	})
 
-	applyCh := make(chan struct{})
-	p.DiffFn = testDiffFn
-	p.ApplyFn = func(*InstanceInfo, *InstanceState, *InstanceDiff) (*InstanceState, error) {
-		close(applyCh)
-
-		for !ctx.sh.Stopped() {
-			// Wait for stop to be called
-		}
-
-		// Sleep
-		time.Sleep(100 * time.Millisecond)
-
-		return &InstanceState{
-			ID: "foo",
-		}, nil
-	}
-
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	// Start the Apply in a goroutine
-	var applyErr error
-	stateCh := make(chan *State)
-	go func() {
-		state, err := ctx.Apply()
-		if err != nil {
-			applyErr = err
-		}
-
-		stateCh <- state
-	}()
-
-	stopDone := make(chan struct{})
-	go func() {
-		defer close(stopDone)
-		<-applyCh
-		ctx.Stop()
-	}()
-
-	// Make sure that stop blocks
-	select {
-	case <-stopDone:
-		t.Fatal("stop should block")
-	case <-time.After(10 * time.Millisecond):
-	}
-
-	// Wait for stop
-	select {
-	case <-stopDone:
-	case <-time.After(500 * time.Millisecond):
-		t.Fatal("stop should be done")
-	}
-
-	// Wait for apply to complete
-	state := <-stateCh
-	if applyErr != nil {
-		t.Fatalf("err: %s", applyErr)
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
 	}
 
-	checkStateString(t, state, `
-aws_instance.foo:
-  ID = foo
-	`)
-}
-
-func TestContext2Apply_cancelProvisioner(t *testing.T) {
-	m := testModule(t, "apply-cancel-provisioner")
-	p := testProvider("aws")
-	p.ApplyFn = testApplyFn
-	p.DiffFn = testDiffFn
-	pr := testProvisioner()
-	ctx := testContext2(t, &ContextOpts{
-		Module: m,
-		Providers: map[string]ResourceProviderFactory{
-			"aws": testProviderFuncFixed(p),
-		},
-		Provisioners: map[string]ResourceProvisionerFactory{
-			"shell": testProvisionerFuncFixed(pr),
-		},
-	})
-
-	prStopped := make(chan struct{})
-	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
-		// Start the stop process
-		go ctx.Stop()
-
-		<-prStopped
-		return nil
-	}
-	pr.StopFn = func() error {
-		close(prStopped)
-		return nil
+	// The replacement of bar must create the new instance first
+	expected := []string{
+		"apply aws_instance.foo",
+		"apply aws_instance.bar",
+		"destroy aws_instance.bar (deposed #0)",
 	}
-
-	if _, err := ctx.Plan(); err != nil {
-		t.Fatalf("err: %s", err)
+	if !reflect.DeepEqual(order, expected) {
+		t.Fatalf("bad: %#v", order)
 	}
 
-	// Start the Apply in a goroutine
-	var applyErr error
-	stateCh := make(chan *State)
-	go func() {
-		state, err := ctx.Apply()
-		if err != nil {
-			applyErr = err
-		}
-
-		stateCh <- state
-	}()
-
-	// Wait for completion
-	state := <-stateCh
-	if applyErr != nil {
-		t.Fatalf("err: %s", applyErr)
+	rs := state.RootModule().Resources["aws_instance.bar"]
+	if rs == nil || rs.Primary == nil || rs.Primary.ID == "bar" {
+		t.Fatalf("bar should be replaced:\n%s", state)
 	}
-
-	checkStateString(t, state, `
-aws_instance.foo: (tainted)
-  ID = foo
-  num = 2
-  type = aws_instance
-	`)
-
-	if !pr.StopCalled {
-		t.Fatal("stop should be called")
+	if len(rs.Deposed) != 0 {
+		t.Fatalf("deposed instance should be destroyed:\n%s", state)
 	}
 }
 
-func TestContext2Apply_compute(t *testing.T) {
-	m := testModule(t, "apply-compute")
+func TestContext2Apply_forceReplace(t *testing.T) {
+	m := testModule(t, "plan-force-replace")
 	p := testProvider("aws")
-	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
-	ctx := testContext2(t, &ContextOpts{
-		Module: m,
-		Providers: map[string]ResourceProviderFactory{
-			"aws": testProviderFuncFixed(p),
-		},
-	})
-
-	if _, err := ctx.Plan(); err != nil {
-		t.Fatalf("err: %s", err)
-	}
 
-	ctx.variables = map[string]interface{}{"value": "1"}
+	var l sync.Mutex
+	var order []string
+	p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
+		l.Lock()
+		defer l.Unlock()
 
-	state, err := ctx.Apply()
-	if err != nil {
-		t.Fatalf("err: %s", err)
-	}
+		if d.Destroy {
+			order = append(order, "destroy "+info.Id)
+		} else {
+			order = append(order, "apply "+info.Id)
+		}
 
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyComputeStr)
-	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
+		return testApplyFn(info, s, d)
 	}
-}
 
-func TestContext2Apply_countDecrease(t *testing.T) {
-	m := testModule(t, "apply-count-dec")
-	p := testProvider("aws")
-	p.DiffFn = testDiffFn
 	s := &State{
 		Modules: []*ModuleState{
 			&ModuleState{
 				Path: rootModulePath,
 				Resources: map[string]*ResourceState{
-					"aws_instance.foo.0": &ResourceState{
-						Type: "aws_instance",
-						Primary: &InstanceState{
-							ID: "bar",
-							Attributes: map[string]string{
-								"foo":  "foo",
-								"type": "aws_instance",
-							},
-						},
-					},
-					"aws_instance.foo.1": &ResourceState{
+					"aws_instance.foo": &ResourceState{
 						Type: "aws_instance",
 						Primary: &InstanceState{
-							ID: "bar",
+							ID: "foo",
 							Attributes: map[string]string{
-								"foo":  "foo",
+								"id":   "foo",
+								"ami":  "bar",
+								"num":  "2",
 								"type": "aws_instance",
 							},
 						},
 					},
-					"aws_instance.foo.2": &ResourceState{
+					"aws_instance.bar": &ResourceState{
 						Type: "aws_instance",
 						Primary: &InstanceState{
 							ID: "bar",
 							Attributes: map[string]string{
-								"foo":  "foo",
+								"id":   "bar",
+								"num":  "1",
 								"type": "aws_instance",
 							},
 						},
@@ -1937,7 +2357,8 @@ func TestContext2Apply_countDecrease(t *testing.T) {
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
-		State: s,
+		State:   s,
+		Replace: []string{"aws_instance.foo"},
 	})
 
 	if _, err := ctx.Plan(); err != nil {
@@ -1949,43 +2370,61 @@ func TestContext2Apply_countDecrease(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyCountDecStr)
-	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
+	expected := []string{
+		"destroy aws_instance.foo",
+		"apply aws_instance.foo",
+	}
+	if !reflect.DeepEqual(order, expected) {
+		t.Fatalf("bad: %#v", order)
+	}
+
+	rs := state.RootModule().Resources["aws_instance.bar"]
+	if rs == nil || rs.Primary == nil || rs.Primary.ID != "bar" {
+		t.Fatalf("bar should not be replaced:\n%s", state)
 	}
 }
 
-func TestContext2Apply_countDecreaseToOneX(t *testing.T) {
-	m := testModule(t, "apply-count-dec-one")
+func TestContext2Apply_forceAttributes(t *testing.T) {
+	m := testModule(t, "apply-force-attributes")
 	p := testProvider("aws")
-	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
+
+	var l sync.Mutex
+	applied := make(map[string][]*InstanceDiff)
+	p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
+		l.Lock()
+		applied[info.Id] = append(applied[info.Id], d)
+		l.Unlock()
+
+		return testApplyFn(info, s, d)
+	}
+
 	s := &State{
 		Modules: []*ModuleState{
 			&ModuleState{
 				Path: rootModulePath,
 				Resources: map[string]*ResourceState{
-					"aws_instance.foo.0": &ResourceState{
+					"aws_instance.foo": &ResourceState{
 						Type: "aws_instance",
 						Primary: &InstanceState{
-							ID: "bar",
+							ID: "foo",
 							Attributes: map[string]string{
-								"foo":  "foo",
+								"id":   "foo",
+								"ami":  "bar",
+								"num":  "2",
 								"type": "aws_instance",
 							},
 						},
 					},
-					"aws_instance.foo.1": &ResourceState{
-						Type: "aws_instance",
-						Primary: &InstanceState{
-							ID: "bar",
-						},
-					},
-					"aws_instance.foo.2": &ResourceState{
+					"aws_instance.bar": &ResourceState{
 						Type: "aws_instance",
 						Primary: &InstanceState{
 							ID: "bar",
+							Attributes: map[string]string{
+								"id":   "bar",
+								"num":  "1",
+								"type": "aws_instance",
+							},
 						},
 					},
 				},
@@ -1998,34 +2437,69 @@ func TestContext2Apply_countDecreaseToOneX(t *testing.T) {
 			"aws": testProviderFuncFixed(p),
 		},
 		State: s,
+		ForceAttributes: map[string][]string{
+			"aws_instance.foo": []string{"ami"},
+			"aws_instance.bar": []string{"num"},
+		},
 	})
 
-	if _, err := ctx.Plan(); err != nil {
+	plan, err := ctx.Plan()
+	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	state, err := ctx.Apply()
-	if err != nil {
+	// Forcing an attribute that requires a new resource replaces it
+	rd := plan.Diff.RootModule().Resources
+	if ct := rd["aws_instance.foo"].ChangeType(); ct != DiffUpdate {
+		t.Fatalf("foo should be updated, got: %#v", ct)
+	}
+	if ct := rd["aws_instance.bar"].ChangeType(); ct != DiffDestroyCreate {
+		t.Fatalf("bar should be replaced, got: %#v", ct)
+	}
+
+	if _, err := ctx.Apply(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyCountDecToOneStr)
-	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
+	ds := applied["aws_instance.foo"]
+	if len(ds) != 1 {
+		t.Fatalf("foo should be applied once, got: %#v", ds)
+	}
+	ad, ok := ds[0].GetAttribute("ami")
+	if !ok {
+		t.Fatalf("ami should be in the applied diff: %#v", ds[0])
+	}
+	if ad.Old != "bar" || ad.New != "bar" || ad.RequiresNew {
+		t.Fatalf("bad: %#v", ad)
+	}
+	if _, ok := ds[0].GetAttribute("num"); ok {
+		t.Fatalf("num should not be in the applied diff: %#v", ds[0])
+	}
+
+	// The replacement of bar is a destroy and a create
+	if len(applied["aws_instance.bar"]) != 2 {
+		t.Fatalf("bar should be destroyed and created, got: %#v", applied["aws_instance.bar"])
 	}
 }
 
-// https://github.com/PeoplePerHour/terraform/pull/11
-//
-// This tests a case where both a "resource" and "resource.0" are in
-// the state file, which apparently is a reasonable backwards compatibility
-// concern found in the above 3rd party repo.
-func TestContext2Apply_countDecreaseToOneCorrupted(t *testing.T) {
-	m := testModule(t, "apply-count-dec-one")
+func TestContext2Apply_forceAttributesBad(t *testing.T) {
+	_, err := NewContext(&ContextOpts{
+		Module: testModule(t, "apply-force-attributes"),
+		ForceAttributes: map[string][]string{
+			"aws_instance.foo[nope]": []string{"ami"},
+		},
+	})
+	if err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestContext2Apply_preservePriorState(t *testing.T) {
+	m := testModule(t, "apply-preserve-prior-state")
 	p := testProvider("aws")
 	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
+
 	s := &State{
 		Modules: []*ModuleState{
 			&ModuleState{
@@ -2034,19 +2508,27 @@ func TestContext2Apply_countDecreaseToOneCorrupted(t *testing.T) {
 					"aws_instance.foo": &ResourceState{
 						Type: "aws_instance",
 						Primary: &InstanceState{
-							ID: "bar",
+							ID: "foo",
 							Attributes: map[string]string{
-								"foo":  "foo",
-								"type": "aws_instance",
+								"id":  "foo",
+								"ami": "old",
 							},
 						},
 					},
-					"aws_instance.foo.0": &ResourceState{
+					"aws_instance.baz": &ResourceState{
 						Type: "aws_instance",
 						Primary: &InstanceState{
 							ID: "baz",
 							Attributes: map[string]string{
-								"type": "aws_instance",
+								"id":  "baz",
+								"ami": "old",
+							},
+						},
+						Prior: &InstanceState{
+							ID: "baz",
+							Attributes: map[string]string{
+								"id":  "baz",
+								"ami": "older",
 							},
 						},
 					},
@@ -2062,10 +2544,8 @@ func TestContext2Apply_countDecreaseToOneCorrupted(t *testing.T) {
 		State: s,
 	})
 
-	if p, err := ctx.Plan(); err != nil {
+	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
-	} else {
-		testStringMatch(t, p, testTerraformApplyCountDecToOneCorruptedPlanStr)
 	}
 
 	state, err := ctx.Apply()
@@ -2073,43 +2553,87 @@ func TestContext2Apply_countDecreaseToOneCorrupted(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyCountDecToOneCorruptedStr)
-	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
+	rs := state.RootModule().Resources
+
+	// The update keeps the state from before it
+	prior := rs["aws_instance.foo"].Prior
+	if prior == nil || prior.Attributes["ami"] != "old" {
+		t.Fatalf("bad prior state of foo: %#v", prior)
+	}
+	if v := rs["aws_instance.foo"].Primary.Attributes["ami"]; v != "new" {
+		t.Fatalf("bad ami of foo: %q", v)
+	}
+
+	// There's nothing before a create
+	if prior := rs["aws_instance.bar"].Prior; prior != nil {
+		t.Fatalf("bar should have no prior state: %#v", prior)
+	}
+
+	// Applying without preserving the prior state clears it
+	if prior := rs["aws_instance.baz"].Prior; prior != nil {
+		t.Fatalf("baz should have no prior state: %#v", prior)
 	}
 }
 
-func TestContext2Apply_countTainted(t *testing.T) {
-	m := testModule(t, "apply-count-tainted")
-	p := testProvider("aws")
-	p.DiffFn = testDiffFn
-	s := &State{
-		Modules: []*ModuleState{
-			&ModuleState{
-				Path: rootModulePath,
-				Resources: map[string]*ResourceState{
-					"aws_instance.foo.0": &ResourceState{
-						Type: "aws_instance",
-						Primary: &InstanceState{
-							ID: "bar",
-							Attributes: map[string]string{
-								"foo":  "foo",
-								"type": "aws_instance",
-							},
-							Tainted: true,
-						},
-					},
-				},
-			},
-		},
+func TestContext2Apply_providerParallelism(t *testing.T) {
+	m := testModule(t, "apply-provider-parallelism")
+
+	// The aws provider is capped at 1, so track the number of in-flight
+	// applies and record the maximum we ever see.
+	var awsActive, awsMax int32
+	pAWS := testProvider("aws")
+	pAWS.DiffFn = testDiffFn
+	pAWS.ApplyFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		d *InstanceDiff) (*InstanceState, error) {
+		n := atomic.AddInt32(&awsActive, 1)
+		defer atomic.AddInt32(&awsActive, -1)
+		for {
+			max := atomic.LoadInt32(&awsMax)
+			if n <= max || atomic.CompareAndSwapInt32(&awsMax, max, n) {
+				break
+			}
+		}
+
+		time.Sleep(10 * time.Millisecond)
+		return testApplyFn(info, s, d)
+	}
+
+	// The do provider is unlimited, so both of its resources must be able
+	// to be applied at the same time.
+	var doWg sync.WaitGroup
+	doWg.Add(2)
+	doCh := make(chan struct{})
+	go func() {
+		doWg.Wait()
+		close(doCh)
+	}()
+	pDO := testProvider("do")
+	pDO.DiffFn = testDiffFn
+	pDO.ApplyFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		d *InstanceDiff) (*InstanceState, error) {
+		doWg.Done()
+		select {
+		case <-doCh:
+		case <-time.After(5 * time.Second):
+			return nil, fmt.Errorf("do resources were not applied in parallel")
+		}
+
+		return testApplyFn(info, s, d)
 	}
+
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
-			"aws": testProviderFuncFixed(p),
+			"aws": testProviderFuncFixed(pAWS),
+			"do":  testProviderFuncFixed(pDO),
+		},
+		ProviderParallelism: map[string]int{
+			"aws": 1,
 		},
-		State: s,
 	})
 
 	if _, err := ctx.Plan(); err != nil {
@@ -2121,51 +2645,149 @@ func TestContext2Apply_countTainted(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyCountTaintedStr)
-	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
+	if len(state.RootModule().Resources) != 5 {
+		t.Fatalf("bad: %s", state)
+	}
+	if max := atomic.LoadInt32(&awsMax); max != 1 {
+		t.Fatalf("expected at most 1 concurrent aws apply, got %d", max)
 	}
 }
 
-func TestContext2Apply_countVariable(t *testing.T) {
-	m := testModule(t, "apply-count-variable")
+// The provider a child module configures has a limit of its own.
+func TestContext2Apply_providerParallelismModule(t *testing.T) {
+	m := testModule(t, "apply-provider-parallelism-module")
+
+	// The first apply of each module waits for the first of the other, so
+	// both providers must be applying at the same time.
+	var wg sync.WaitGroup
+	wg.Add(2)
+	ch := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(ch)
+	}()
+
+	var lock sync.Mutex
+	started := make(map[string]bool)
+	active := make(map[string]int)
+	max := make(map[string]int)
 	p := testProvider("aws")
-	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
+	p.ApplyFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		d *InstanceDiff) (*InstanceState, error) {
+		mod := strings.Join(info.ModulePath, ".")
+
+		lock.Lock()
+		first := !started[mod]
+		started[mod] = true
+		active[mod]++
+		if active[mod] > max[mod] {
+			max[mod] = active[mod]
+		}
+		lock.Unlock()
+
+		defer func() {
+			lock.Lock()
+			active[mod]--
+			lock.Unlock()
+		}()
+
+		if first {
+			wg.Done()
+			select {
+			case <-ch:
+			case <-time.After(5 * time.Second):
+				return nil, fmt.Errorf("the providers of the modules share a limit")
+			}
+		}
+
+		time.Sleep(10 * time.Millisecond)
+		return testApplyFn(info, s, d)
+	}
+
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
+		ProviderParallelism: map[string]int{
+			"aws": 1,
+		},
 	})
 
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	state, err := ctx.Apply()
-	if err != nil {
+	if _, err := ctx.Apply(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyCountVariableStr)
-	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
+	expected := map[string]int{"root": 1, "root.child": 1}
+	if !reflect.DeepEqual(max, expected) {
+		t.Fatalf("bad: %#v", max)
 	}
 }
 
-func TestContext2Apply_countVariableRef(t *testing.T) {
-	m := testModule(t, "apply-count-variable-ref")
+func TestContext2Apply_applyStages(t *testing.T) {
+	m := testModule(t, "apply-stages")
+
+	// Both instances of the first stage must be applied at the same time
+	var wg sync.WaitGroup
+	wg.Add(2)
+	ch := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(ch)
+	}()
+
+	var lock sync.Mutex
+	var applied []string
 	p := testProvider("aws")
-	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
+	p.ApplyFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		d *InstanceDiff) (*InstanceState, error) {
+		if strings.HasPrefix(info.Id, "aws_instance.a") {
+			wg.Done()
+			select {
+			case <-ch:
+			case <-time.After(5 * time.Second):
+				return nil, fmt.Errorf("stage resources were not applied in parallel")
+			}
+		}
+
+		lock.Lock()
+		applied = append(applied, info.Id)
+		lock.Unlock()
+		return testApplyFn(info, s, d)
+	}
+
+	var gates []int
+	var appliedAtGate []string
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
+		ApplyStages: [][]string{
+			[]string{"aws_instance.a"},
+			[]string{"aws_instance.b"},
+		},
+		ApplyGate: func(stage int) error {
+			lock.Lock()
+			defer lock.Unlock()
+			gates = append(gates, stage)
+			for _, id := range applied {
+				if id != "aws_instance.c" {
+					appliedAtGate = append(appliedAtGate, id)
+				}
+			}
+			return nil
+		},
 	})
 
 	if _, err := ctx.Plan(); err != nil {
@@ -2177,29 +2799,49 @@ func TestContext2Apply_countVariableRef(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyCountVariableRefStr)
-	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
+	if len(state.RootModule().Resources) != 4 {
+		t.Fatalf("bad: %s", state)
+	}
+	if !reflect.DeepEqual(gates, []int{1}) {
+		t.Fatalf("bad: %#v", gates)
+	}
+
+	// Only the first stage was applied when the gate was consulted
+	sort.Strings(appliedAtGate)
+	expected := []string{"aws_instance.a.0", "aws_instance.a.1"}
+	if !reflect.DeepEqual(appliedAtGate, expected) {
+		t.Fatalf("bad: %#v", appliedAtGate)
 	}
 }
 
-func TestContext2Apply_mapVariableOverride(t *testing.T) {
-	m := testModule(t, "apply-map-var-override")
+func TestContext2Apply_applyStagesFailure(t *testing.T) {
+	m := testModule(t, "apply-stages")
 	p := testProvider("aws")
-	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
+	p.ApplyFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		d *InstanceDiff) (*InstanceState, error) {
+		if info.Id == "aws_instance.a.1" {
+			return nil, fmt.Errorf("error")
+		}
+
+		return testApplyFn(info, s, d)
+	}
+
+	gated := false
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
-		Variables: map[string]interface{}{
-			"images": []map[string]interface{}{
-				map[string]interface{}{
-					"us-west-2": "overridden",
-				},
-			},
+		ApplyStages: [][]string{
+			[]string{"aws_instance.a"},
+			[]string{"aws_instance.b"},
+		},
+		ApplyGate: func(stage int) error {
+			gated = true
+			return nil
 		},
 	})
 
@@ -2208,28 +2850,24 @@ func TestContext2Apply_mapVariableOverride(t *testing.T) {
 	}
 
 	state, err := ctx.Apply()
-	if err != nil {
-		t.Fatalf("err: %s", err)
+	if err == nil {
+		t.Fatal("should error")
 	}
 
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(`
-aws_instance.bar:
-  ID = foo
-  ami = overridden
-  type = aws_instance
-aws_instance.foo:
-  ID = foo
-  ami = image-1234
-  type = aws_instance
-	`)
-	if actual != expected {
-		t.Fatalf("got: \n%s\nexpected: \n%s", actual, expected)
+	// The failure halts the apply before the second stage
+	if gated {
+		t.Fatal("gate should not be called")
+	}
+	if _, ok := state.RootModule().Resources["aws_instance.b"]; ok {
+		t.Fatalf("bad: %s", state)
+	}
+	if _, ok := state.RootModule().Resources["aws_instance.a.0"]; !ok {
+		t.Fatalf("bad: %s", state)
 	}
 }
 
-func TestContext2Apply_moduleBasic(t *testing.T) {
-	m := testModule(t, "apply-module")
+func TestContext2Apply_applyStagesGateError(t *testing.T) {
+	m := testModule(t, "apply-stages")
 	p := testProvider("aws")
 	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
@@ -2238,6 +2876,13 @@ func TestContext2Apply_moduleBasic(t *testing.T) {
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
+		ApplyStages: [][]string{
+			[]string{"aws_instance.a"},
+			[]string{"aws_instance.b"},
+		},
+		ApplyGate: func(stage int) error {
+			return fmt.Errorf("not approved")
+		},
 	})
 
 	if _, err := ctx.Plan(); err != nil {
@@ -2245,65 +2890,64 @@ func TestContext2Apply_moduleBasic(t *testing.T) {
 	}
 
 	state, err := ctx.Apply()
-	if err != nil {
-		t.Fatalf("err: %s", err)
+	if err == nil || !strings.Contains(err.Error(), "apply stage 1: not approved") {
+		t.Fatalf("bad: %v", err)
 	}
-
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyModuleStr)
-	if actual != expected {
-		t.Fatalf("bad, expected:\n%s\n\nactual:\n%s", expected, actual)
+	if _, ok := state.RootModule().Resources["aws_instance.b"]; ok {
+		t.Fatalf("bad: %s", state)
 	}
 }
 
-func TestContext2Apply_moduleDestroyOrder(t *testing.T) {
-	m := testModule(t, "apply-module-destroy-order")
-	p := testProvider("aws")
-	p.DiffFn = testDiffFn
+func TestContext2Apply_deferDestroys(t *testing.T) {
+	m := testModule(t, "apply-defer-destroys")
 
-	// Create a custom apply function to track the order they were destroyed
+	var lock sync.Mutex
 	var order []string
-	var orderLock sync.Mutex
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
 	p.ApplyFn = func(
 		info *InstanceInfo,
-		is *InstanceState,
-		id *InstanceDiff) (*InstanceState, error) {
-		orderLock.Lock()
-		defer orderLock.Unlock()
+		s *InstanceState,
+		d *InstanceDiff) (*InstanceState, error) {
+		id := info.Id
+		if d.GetDestroy() {
+			id += " (destroy)"
+		}
 
-		order = append(order, is.ID)
-		return nil, nil
+		lock.Lock()
+		order = append(order, id)
+		lock.Unlock()
+		return testApplyFn(info, s, d)
 	}
 
-	state := &State{
+	s := &State{
 		Modules: []*ModuleState{
 			&ModuleState{
 				Path: rootModulePath,
 				Resources: map[string]*ResourceState{
-					"aws_instance.b": &ResourceState{
+					"aws_instance.bar": &ResourceState{
 						Type: "aws_instance",
 						Primary: &InstanceState{
-							ID: "b",
+							ID: "bar",
+							Attributes: map[string]string{
+								"require_new": "no",
+							},
 						},
 					},
-				},
-			},
-
-			&ModuleState{
-				Path: []string{"root", "child"},
-				Resources: map[string]*ResourceState{
-					"aws_instance.a": &ResourceState{
+					"aws_instance.baz": &ResourceState{
 						Type: "aws_instance",
 						Primary: &InstanceState{
-							ID: "a",
+							ID: "baz",
+							Attributes: map[string]string{
+								"foo": "bar",
+							},
 						},
 					},
-				},
-				Outputs: map[string]*OutputState{
-					"a_output": &OutputState{
-						Type:      "string",
-						Sensitive: false,
-						Value:     "a",
+					"aws_instance.old": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "old",
+						},
 					},
 				},
 			},
@@ -2315,51 +2959,48 @@ func TestContext2Apply_moduleDestroyOrder(t *testing.T) {
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
-		State:   state,
-		Destroy: true,
+		State:         s,
+		DeferDestroys: true,
 	})
 
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	state, err := ctx.Apply()
-	if err != nil {
+	if _, err := ctx.Apply(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	expected := []string{"b", "a"}
-	if !reflect.DeepEqual(order, expected) {
+	index := make(map[string]int)
+	for i, id := range order {
+		index[id] = i
+	}
+	if len(index) != 5 {
 		t.Fatalf("bad: %#v", order)
 	}
 
-	{
-		actual := strings.TrimSpace(state.String())
-		expected := strings.TrimSpace(testTerraformApplyModuleDestroyOrderStr)
-		if actual != expected {
-			t.Fatalf("bad: \n%s", actual)
+	// The replacement of bar still waits for its destroy, and so does baz
+	// that depends on bar. Everything else is destroyed last.
+	before := [][2]string{
+		[2]string{"aws_instance.bar (destroy)", "aws_instance.bar"},
+		[2]string{"aws_instance.bar", "aws_instance.baz"},
+		[2]string{"aws_instance.foo", "aws_instance.bar (destroy)"},
+		[2]string{"aws_instance.foo", "aws_instance.old (destroy)"},
+		[2]string{"aws_instance.bar", "aws_instance.old (destroy)"},
+		[2]string{"aws_instance.baz", "aws_instance.old (destroy)"},
+	}
+	for _, b := range before {
+		if index[b[0]] > index[b[1]] {
+			t.Fatalf("%s should be applied before %s: %#v", b[0], b[1], order)
 		}
 	}
 }
 
-func TestContext2Apply_moduleInheritAlias(t *testing.T) {
-	m := testModule(t, "apply-module-provider-inherit-alias")
-	p := testProvider("aws")
-	p.ApplyFn = testApplyFn
-	p.DiffFn = testDiffFn
-
-	p.ConfigureFn = func(c *ResourceConfig) error {
-		if _, ok := c.Get("child"); !ok {
-			return nil
-		}
-
-		if _, ok := c.Get("root"); ok {
-			return fmt.Errorf("child should not get root")
-		}
-
-		return nil
-	}
+func TestContext2Apply_cancel(t *testing.T) {
+	stopped := false
 
+	m := testModule(t, "apply-cancel")
+	p := testProvider("aws")
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
@@ -2367,69 +3008,189 @@ func TestContext2Apply_moduleInheritAlias(t *testing.T) {
 		},
 	})
 
+	p.ApplyFn = func(*InstanceInfo, *InstanceState, *InstanceDiff) (*InstanceState, error) {
+		if !stopped {
+			stopped = true
+			go ctx.Stop()
+
+			for {
+				if ctx.sh.Stopped() {
+					break
+				}
+			}
+		}
+
+		return &InstanceState{
+			ID: "foo",
+			Attributes: map[string]string{
+				"num": "2",
+			},
+		}, nil
+	}
+	p.DiffFn = func(*InstanceInfo, *InstanceState, *ResourceConfig) (*InstanceDiff, error) {
+		return &InstanceDiff{
+			Attributes: map[string]*ResourceAttrDiff{
+				"num": &ResourceAttrDiff{
+					New: "bar",
+				},
+			},
+		}, nil
+	}
+
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	state, err := ctx.Apply()
-	if err != nil {
-		t.Fatalf("err: %s", err)
+	// Start the Apply in a goroutine
+	var applyErr error
+	stateCh := make(chan *State)
+	go func() {
+		state, err := ctx.Apply()
+		if err != nil {
+			applyErr = err
+		}
+
+		stateCh <- state
+	}()
+
+	state := <-stateCh
+	if applyErr != nil {
+		t.Fatalf("err: %s", applyErr)
 	}
 
-	checkStateString(t, state, `
-<no state>
-module.child:
-  aws_instance.foo:
-    ID = foo
-    provider = aws.eu
-	`)
+	mod := state.RootModule()
+	if len(mod.Resources) != 1 {
+		t.Fatalf("bad: %s", state.String())
+	}
+
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyCancelStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+
+	if !p.StopCalled {
+		t.Fatal("stop should be called")
+	}
 }
 
-func TestContext2Apply_moduleOrphanInheritAlias(t *testing.T) {
-	m := testModule(t, "apply-module-provider-inherit-alias-orphan")
-	p := testProvider("aws")
-	p.ApplyFn = testApplyFn
-	p.DiffFn = testDiffFn
+func TestContext2Apply_batchStateUpdates(t *testing.T) {
+	m := testModule(t, "apply-batch-state-updates")
 
-	called := false
-	p.ConfigureFn = func(c *ResourceConfig) error {
-		called = true
+	var expected string
+	for _, batch := range []bool{false, true} {
+		p := testProvider("aws")
+		p.ApplyFn = testApplyFn
+		p.DiffFn = testDiffFn
+		h := new(testStateUpdateHook)
+		ctx := testContext2(t, &ContextOpts{
+			Module: m,
+			Hooks:  []Hook{h},
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+			BatchStateUpdates: batch,
+		})
 
-		if _, ok := c.Get("child"); !ok {
-			return nil
+		if _, err := ctx.Plan(); err != nil {
+			t.Fatalf("err: %s", err)
 		}
 
-		if _, ok := c.Get("root"); ok {
-			return fmt.Errorf("child should not get root")
+		state, err := ctx.Apply()
+		if err != nil {
+			t.Fatalf("err: %s", err)
 		}
 
-		return nil
+		// Every resource is written to the state once, but with batching
+		// the hook is only called when the walk is done.
+		calls := 5
+		if batch {
+			calls = 1
+		}
+		if h.Calls != calls {
+			t.Fatalf("batch %t: expected %d calls, got %d", batch, calls, h.Calls)
+		}
+
+		// The last state the hook got must be the final state
+		actual := strings.TrimSpace(state.String())
+		if hooked := strings.TrimSpace(h.State.String()); hooked != actual {
+			t.Fatalf("batch %t: bad:\n\n%s\n\nexpected:\n\n%s", batch, hooked, actual)
+		}
+		if expected == "" {
+			expected = actual
+		}
+		if actual != expected {
+			t.Fatalf("batch %t: bad:\n\n%s\n\nexpected:\n\n%s", batch, actual, expected)
+		}
 	}
+}
 
-	// Create a state with an orphan module
-	state := &State{
-		Modules: []*ModuleState{
-			&ModuleState{
-				Path: []string{"root", "child"},
-				Resources: map[string]*ResourceState{
-					"aws_instance.bar": &ResourceState{
-						Type: "aws_instance",
-						Primary: &InstanceState{
-							ID: "bar",
-						},
-						Provider: "aws.eu",
-					},
-				},
-			},
-		},
+func TestContext2Apply_batchStateUpdatesDestroy(t *testing.T) {
+	m := testModule(t, "apply-batch-state-updates-cbd")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+	h := new(testStateUpdateHook)
+
+	// Before anything is destroyed, the hook must have seen everything
+	// that was created.
+	var l sync.Mutex
+	var created []string
+	var checked bool
+	p.ApplyFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		d *InstanceDiff) (*InstanceState, error) {
+		l.Lock()
+		defer l.Unlock()
+
+		if d.Destroy {
+			checked = true
+
+			h.Lock()
+			defer h.Unlock()
+			if h.State == nil {
+				t.Errorf("%s: destroying before the state was persisted", info.Id)
+				return nil, nil
+			}
+			for _, id := range created {
+				rs := h.State.RootModule().Resources[id]
+				if rs == nil || rs.Primary == nil {
+					t.Errorf("%s: %s is not persisted:\n\n%s", info.Id, id, h.State)
+				}
+			}
+
+			return nil, nil
+		}
+
+		created = append(created, info.Id)
+		return testApplyFn(info, s, d)
 	}
 
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
-		State:  state,
+		Hooks:  []Hook{h},
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
+		State: &State{
+			Modules: []*ModuleState{
+				&ModuleState{
+					Path: rootModulePath,
+					Resources: map[string]*ResourceState{
+						"aws_instance.b": &ResourceState{
+							Type: "aws_instance",
+							Primary: &InstanceState{
+								ID: "b",
+								Attributes: map[string]string{
+									"require_new": "old",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		BatchStateUpdates: true,
 	})
 
 	if _, err := ctx.Plan(); err != nil {
@@ -2441,195 +3202,436 @@ func TestContext2Apply_moduleOrphanInheritAlias(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
-	if !called {
-		t.Fatal("must call configure")
+	if !checked {
+		t.Fatal("nothing was destroyed")
 	}
 
-	checkStateString(t, state, `
-module.child:
-  <no state>
-  `)
+	actual := strings.TrimSpace(state.String())
+	if hooked := strings.TrimSpace(h.State.String()); hooked != actual {
+		t.Fatalf("bad:\n\n%s\n\nexpected:\n\n%s", hooked, actual)
+	}
 }
 
-func TestContext2Apply_moduleOrphanProvider(t *testing.T) {
-	m := testModule(t, "apply-module-orphan-provider-inherit")
+func TestContext2Apply_batchStateUpdatesStop(t *testing.T) {
+	stopped := false
+
+	m := testModule(t, "apply-cancel")
 	p := testProvider("aws")
-	p.ApplyFn = testApplyFn
-	p.DiffFn = testDiffFn
+	h := new(testStateUpdateHook)
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Hooks:  []Hook{h},
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		BatchStateUpdates: true,
+	})
 
-	p.ConfigureFn = func(c *ResourceConfig) error {
-		if _, ok := c.Get("value"); !ok {
-			return fmt.Errorf("value is not found")
+	p.ApplyFn = func(*InstanceInfo, *InstanceState, *InstanceDiff) (*InstanceState, error) {
+		if !stopped {
+			stopped = true
+			go ctx.Stop()
+
+			for {
+				if ctx.sh.Stopped() {
+					break
+				}
+			}
 		}
 
-		return nil
+		return &InstanceState{
+			ID: "foo",
+			Attributes: map[string]string{
+				"num": "2",
+			},
+		}, nil
 	}
-
-	// Create a state with an orphan module
-	state := &State{
-		Modules: []*ModuleState{
-			&ModuleState{
-				Path: []string{"root", "child"},
-				Resources: map[string]*ResourceState{
-					"aws_instance.bar": &ResourceState{
-						Type: "aws_instance",
-						Primary: &InstanceState{
-							ID: "bar",
-						},
-					},
+	p.DiffFn = func(*InstanceInfo, *InstanceState, *ResourceConfig) (*InstanceDiff, error) {
+		return &InstanceDiff{
+			Attributes: map[string]*ResourceAttrDiff{
+				"num": &ResourceAttrDiff{
+					New: "bar",
 				},
 			},
-		},
+		}, nil
 	}
 
-	ctx := testContext2(t, &ContextOpts{
-		Module: m,
-		State:  state,
-		Providers: map[string]ResourceProviderFactory{
-			"aws": testProviderFuncFixed(p),
-		},
-	})
-
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	if _, err := ctx.Apply(); err != nil {
+	state, err := ctx.Apply()
+	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
+
+	// The resource applied before the interruption must be persisted
+	if h.Calls != 1 {
+		t.Fatalf("expected 1 call, got %d", h.Calls)
+	}
+	actual := strings.TrimSpace(h.State.String())
+	expected := strings.TrimSpace(testTerraformApplyCancelStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+	if state.String() != h.State.String() {
+		t.Fatalf("bad: \n%s", state)
+	}
 }
 
-func TestContext2Apply_moduleOrphanGrandchildProvider(t *testing.T) {
-	m := testModule(t, "apply-module-orphan-provider-inherit")
-	p := testProvider("aws")
-	p.ApplyFn = testApplyFn
-	p.DiffFn = testDiffFn
+func BenchmarkContext2Apply_batchStateUpdates(b *testing.B) {
+	mod := testModule(b, "apply-batch-state-updates")
 
-	p.ConfigureFn = func(c *ResourceConfig) error {
-		if _, ok := c.Get("value"); !ok {
-			return fmt.Errorf("value is not found")
-		}
+	for _, batch := range []bool{false, true} {
+		b.Run(fmt.Sprintf("batch=%t", batch), func(b *testing.B) {
+			var calls int
+			for i := 0; i < b.N; i++ {
+				p := testProvider("aws")
+				p.ApplyFn = testApplyFn
+				p.DiffFn = testDiffFn
+				h := new(testStateUpdateHook)
+				h.Serialize = true
 
-		return nil
+				ctx, err := NewContext(&ContextOpts{
+					Module: mod,
+					Hooks:  []Hook{h},
+					Providers: map[string]ResourceProviderFactory{
+						"aws": testProviderFuncFixed(p),
+					},
+					BatchStateUpdates: batch,
+				})
+				if err != nil {
+					b.Fatalf("err: %s", err)
+				}
+				if _, err := ctx.Plan(); err != nil {
+					b.Fatalf("err: %s", err)
+				}
+				if _, err := ctx.Apply(); err != nil {
+					b.Fatalf("err: %s", err)
+				}
+
+				calls += h.Calls
+			}
+
+			b.ReportMetric(float64(calls)/float64(b.N), "writes/op")
+		})
 	}
+}
 
-	// Create a state with an orphan module that is nested (grandchild)
-	state := &State{
-		Modules: []*ModuleState{
-			&ModuleState{
-				Path: []string{"root", "parent", "child"},
-				Resources: map[string]*ResourceState{
-					"aws_instance.bar": &ResourceState{
-						Type: "aws_instance",
-						Primary: &InstanceState{
-							ID: "bar",
-						},
-					},
-				},
+func TestContext2Apply_providerVersion(t *testing.T) {
+	cases := map[string]struct {
+		Version string
+		Strict  bool
+		Err     bool
+		Warns   int
+	}{
+		"satisfied":         {"1.2.5", false, false, 0},
+		"not satisfied":     {"2.0.0", false, true, 0},
+		"no version":        {"", false, false, 1},
+		"no version strict": {"", true, true, 0},
+	}
+
+	m := testModule(t, "apply-provider-version")
+	for k, tc := range cases {
+		p := testProvider("aws")
+		p.ApplyFn = testApplyFn
+		p.DiffFn = testDiffFn
+		p.ProviderVersionReturn = tc.Version
+
+		ctx := testContext2(t, &ContextOpts{
+			Module: m,
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
 			},
-		},
+			StrictApply: tc.Strict,
+		})
+
+		if _, err := ctx.Plan(); err != nil {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+
+		state, err := ctx.Apply()
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+		if len(ctx.ApplyWarnings()) != tc.Warns {
+			t.Fatalf("%s: bad: %#v", k, ctx.ApplyWarnings())
+		}
+
+		// Nothing is applied with a provider that fails the check
+		if p.ApplyCalled == tc.Err {
+			t.Fatalf("%s: bad: %#v", k, p.ApplyCalled)
+		}
+		if tc.Err {
+			if !strings.Contains(err.Error(), "provider.aws") {
+				t.Fatalf("%s: bad: %s", k, err)
+			}
+
+			continue
+		}
+
+		checkStateString(t, state, `
+aws_instance.foo:
+  ID = foo
+  foo = bar
+  type = aws_instance
+		`)
 	}
+}
 
-	ctx := testContext2(t, &ContextOpts{
-		Module: m,
-		State:  state,
-		Providers: map[string]ResourceProviderFactory{
-			"aws": testProviderFuncFixed(p),
+func TestContext2Apply_coalesceProviders(t *testing.T) {
+	cases := map[string]struct {
+		Coalesce bool
+		Shared   [][]string
+	}{
+		"disabled": {
+			false,
+			[][]string{
+				[]string{"aws_instance.a"},
+				[]string{"aws_instance.b"},
+				[]string{"aws_instance.c"},
+				[]string{"aws_instance.d"},
+				[]string{"aws_instance.e"},
+			},
 		},
-	})
 
-	if _, err := ctx.Plan(); err != nil {
-		t.Fatalf("err: %s", err)
+		// aws.other has another configuration, and aws.inherited is
+		// inherited by the child module, so neither is coalesced.
+		"enabled": {
+			true,
+			[][]string{
+				[]string{"aws_instance.a", "aws_instance.b"},
+				[]string{"aws_instance.c"},
+				[]string{"aws_instance.d"},
+				[]string{"aws_instance.e"},
+			},
+		},
 	}
 
-	if _, err := ctx.Apply(); err != nil {
-		t.Fatalf("err: %s", err)
+	m := testModule(t, "apply-coalesce-providers")
+	for k, tc := range cases {
+		var l sync.Mutex
+		var count int
+		applied := make(map[*MockResourceProvider][]string)
+		factory := func() (ResourceProvider, error) {
+			p := testProvider("aws")
+			p.DiffFn = testDiffFn
+			p.ApplyFn = func(
+				info *InstanceInfo,
+				s *InstanceState,
+				d *InstanceDiff) (*InstanceState, error) {
+				l.Lock()
+				applied[p] = append(applied[p], info.Id)
+				l.Unlock()
+				return testApplyFn(info, s, d)
+			}
+
+			l.Lock()
+			count++
+			l.Unlock()
+			return p, nil
+		}
+
+		ctx := testContext2(t, &ContextOpts{
+			Module: m,
+			Providers: map[string]ResourceProviderFactory{
+				"aws": factory,
+			},
+			CoalesceProviders: tc.Coalesce,
+		})
+
+		if _, err := ctx.Plan(); err != nil {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+
+		// Only count the providers started for the apply
+		l.Lock()
+		count = 0
+		l.Unlock()
+
+		if _, err := ctx.Apply(); err != nil {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+
+		actual := make([][]string, 0, len(applied))
+		for _, ids := range applied {
+			sort.Strings(ids)
+			actual = append(actual, ids)
+		}
+		sort.Sort(stringSlicesSort(actual))
+		if !reflect.DeepEqual(actual, tc.Shared) {
+			t.Fatalf("%s: bad: %#v", k, actual)
+		}
+		if count != len(tc.Shared) {
+			t.Fatalf("%s: expected %d providers, got %d", k, len(tc.Shared), count)
+		}
 	}
 }
 
-func TestContext2Apply_moduleGrandchildProvider(t *testing.T) {
-	m := testModule(t, "apply-module-grandchild-provider-inherit")
-	p := testProvider("aws")
-	p.ApplyFn = testApplyFn
-	p.DiffFn = testDiffFn
+func BenchmarkContext2Apply_coalesceProviders(b *testing.B) {
+	mod := testModule(b, "apply-coalesce-providers-many")
 
-	var callLock sync.Mutex
-	called := false
-	p.ConfigureFn = func(c *ResourceConfig) error {
-		if _, ok := c.Get("value"); !ok {
-			return fmt.Errorf("value is not found")
-		}
-		callLock.Lock()
-		called = true
-		callLock.Unlock()
+	for _, coalesce := range []bool{false, true} {
+		b.Run(fmt.Sprintf("coalesce=%t", coalesce), func(b *testing.B) {
+			var count int
+			for i := 0; i < b.N; i++ {
+				p := testProvider("aws")
+				p.ApplyFn = testApplyFn
+				p.DiffFn = testDiffFn
 
-		return nil
+				ctx, err := NewContext(&ContextOpts{
+					Module: mod,
+					Providers: map[string]ResourceProviderFactory{
+						"aws": func() (ResourceProvider, error) {
+							count++
+							return p, nil
+						},
+					},
+					CoalesceProviders: coalesce,
+				})
+				if err != nil {
+					b.Fatalf("err: %s", err)
+				}
+				if _, err := ctx.Plan(); err != nil {
+					b.Fatalf("err: %s", err)
+				}
+				if _, err := ctx.Apply(); err != nil {
+					b.Fatalf("err: %s", err)
+				}
+			}
+
+			b.ReportMetric(float64(count)/float64(b.N), "providers/op")
+		})
 	}
+}
 
+func TestContext2Apply_tracer(t *testing.T) {
+	m := testModule(t, "apply-tracer")
+	p := testProvider("aws")
+	pr := testProvisioner()
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	tracer := new(testTracer)
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
+		Tracer: tracer,
 	})
 
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
-
 	if _, err := ctx.Apply(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	callLock.Lock()
-	defer callLock.Unlock()
-	if called != true {
-		t.Fatalf("err: configure never called")
+	actual := tracer.String()
+	expected := strings.TrimSpace(`
+aws_instance.bar resource (aws.west)
+  aws_instance.bar diff (aws.west)
+  aws_instance.bar apply (aws.west)
+  aws_instance.bar provisioners (aws.west)
+aws_instance.foo resource (aws)
+  aws_instance.foo diff (aws)
+  aws_instance.foo apply (aws)
+  aws_instance.foo provisioners (aws)
+`)
+	if actual != expected {
+		t.Fatalf("bad:\n\n%s", actual)
 	}
 }
 
-// This tests an issue where all the providers in a module but not
-// in the root weren't being added to the root properly. In this test
-// case: aws is explicitly added to root, but "test" should be added to.
-// With the bug, it wasn't.
-func TestContext2Apply_moduleOnlyProvider(t *testing.T) {
-	m := testModule(t, "apply-module-only-provider")
+func TestContext2Apply_tracerError(t *testing.T) {
+	m := testModule(t, "apply-tracer")
 	p := testProvider("aws")
-	p.ApplyFn = testApplyFn
+	pr := testProvisioner()
 	p.DiffFn = testDiffFn
-	pTest := testProvider("test")
-	pTest.ApplyFn = testApplyFn
-	pTest.DiffFn = testDiffFn
+	p.ApplyFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		d *InstanceDiff) (*InstanceState, error) {
+		if info.Id == "aws_instance.foo" {
+			return nil, fmt.Errorf("error")
+		}
 
+		return testApplyFn(info, s, d)
+	}
+	tracer := new(testTracer)
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
-			"aws":  testProviderFuncFixed(p),
-			"test": testProviderFuncFixed(pTest),
+			"aws": testProviderFuncFixed(p),
+		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
 		},
+		Tracer: tracer,
 	})
 
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
-
-	state, err := ctx.Apply()
-	if err != nil {
-		t.Fatalf("err: %s", err)
+	if _, err := ctx.Apply(); err == nil {
+		t.Fatal("should error")
 	}
 
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyModuleOnlyProviderStr)
+	// The provisioners didn't run because the apply failed, and
+	// aws_instance.bar wasn't applied at all
+	actual := tracer.String()
+	expected := strings.TrimSpace(`
+aws_instance.foo resource (aws) error
+  aws_instance.foo diff (aws)
+  aws_instance.foo apply (aws) error
+  aws_instance.foo provisioners (aws)
+`)
 	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
+		t.Fatalf("bad:\n\n%s", actual)
 	}
 }
 
-func TestContext2Apply_moduleProviderAlias(t *testing.T) {
-	m := testModule(t, "apply-module-provider-alias")
+// stringSlicesSort sorts string slices by their first element.
+type stringSlicesSort [][]string
+
+func (s stringSlicesSort) Len() int           { return len(s) }
+func (s stringSlicesSort) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s stringSlicesSort) Less(i, j int) bool { return s[i][0] < s[j][0] }
+
+// testStateUpdateHook records a copy of the state every time the
+// PostStateUpdate hook is called, like a hook persisting it would.
+type testStateUpdateHook struct {
+	NilHook
+	sync.Mutex
+
+	// Serialize, if true, also writes the state like a persisting hook.
+	Serialize bool
+
+	Calls int
+	State *State
+}
+
+func (h *testStateUpdateHook) PostStateUpdate(s *State) (HookAction, error) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.Calls++
+	h.State = s.DeepCopy()
+	if h.Serialize {
+		if err := WriteState(s, ioutil.Discard); err != nil {
+			return HookActionHalt, err
+		}
+	}
+
+	return HookActionContinue, nil
+}
+
+func TestContext2Apply_cancelBlock(t *testing.T) {
+	m := testModule(t, "apply-cancel-block")
 	p := testProvider("aws")
-	p.ApplyFn = testApplyFn
-	p.DiffFn = testDiffFn
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
@@ -2637,35 +3639,108 @@ func TestContext2Apply_moduleProviderAlias(t *testing.T) {
 		},
 	})
 
+	applyCh := make(chan struct{})
+	p.DiffFn = testDiffFn
+	p.ApplyFn = func(*InstanceInfo, *InstanceState, *InstanceDiff) (*InstanceState, error) {
+		close(applyCh)
+
+		for !ctx.sh.Stopped() {
+			// Wait for stop to be called
+		}
+
+		// Sleep
+		time.Sleep(100 * time.Millisecond)
+
+		return &InstanceState{
+			ID: "foo",
+		}, nil
+	}
+
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	state, err := ctx.Apply()
-	if err != nil {
-		t.Fatalf("err: %s", err)
+	// Start the Apply in a goroutine
+	var applyErr error
+	stateCh := make(chan *State)
+	go func() {
+		state, err := ctx.Apply()
+		if err != nil {
+			applyErr = err
+		}
+
+		stateCh <- state
+	}()
+
+	stopDone := make(chan struct{})
+	go func() {
+		defer close(stopDone)
+		<-applyCh
+		ctx.Stop()
+	}()
+
+	// Make sure that stop blocks
+	select {
+	case <-stopDone:
+		t.Fatal("stop should block")
+	case <-time.After(10 * time.Millisecond):
 	}
 
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyModuleProviderAliasStr)
-	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
+	// Wait for stop
+	select {
+	case <-stopDone:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("stop should be done")
+	}
+
+	// Wait for apply to complete
+	state := <-stateCh
+	if applyErr != nil {
+		t.Fatalf("err: %s", applyErr)
 	}
+
+	checkStateString(t, state, `
+aws_instance.foo:
+  ID = foo
+	`)
 }
 
-func TestContext2Apply_moduleProviderAliasTargets(t *testing.T) {
-	m := testModule(t, "apply-module-provider-alias")
+func TestContext2Apply_interrupt(t *testing.T) {
+	m := testModule(t, "apply-cancel")
 	p := testProvider("aws")
-	p.ApplyFn = testApplyFn
-	p.DiffFn = testDiffFn
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
-		Targets: []string{"no.thing"},
 	})
 
+	interruptDone := make(chan struct{})
+	p.DiffFn = testDiffFn
+	p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
+		if info.Id != "aws_instance.foo" {
+			t.Errorf("should not apply %s after the interrupt", info.Id)
+			return testApplyFn(info, s, d)
+		}
+
+		go func() {
+			defer close(interruptDone)
+			ctx.Interrupt()
+		}()
+		for !ctx.sh.Stopped() {
+			// Wait for the interrupt
+		}
+
+		// The interrupt must wait for the in-flight apply
+		select {
+		case <-interruptDone:
+			t.Error("interrupt should block")
+		case <-time.After(10 * time.Millisecond):
+		}
+
+		return testApplyFn(info, s, d)
+	}
+
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
@@ -2675,63 +3750,92 @@ func TestContext2Apply_moduleProviderAliasTargets(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(`
-<no state>
-	`)
-	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
+	select {
+	case <-interruptDone:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("interrupt should be done")
 	}
-}
 
-func TestContext2Apply_moduleProviderCloseNested(t *testing.T) {
-	m := testModule(t, "apply-module-provider-close-nested")
-	p := testProvider("aws")
-	p.ApplyFn = testApplyFn
-	p.DiffFn = testDiffFn
+	checkStateString(t, state, `
+aws_instance.foo:
+  ID = foo
+  num = 2
+  type = aws_instance
+	`)
+
+	if p.StopCalled {
+		t.Fatal("stop should not be called")
+	}
+}
+
+func TestContext2Apply_interruptTwice(t *testing.T) {
+	m := testModule(t, "apply-cancel")
+	p := testProvider("aws")
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
-		State: &State{
-			Modules: []*ModuleState{
-				&ModuleState{
-					Path: []string{"root", "child", "subchild"},
-					Resources: map[string]*ResourceState{
-						"aws_instance.foo": &ResourceState{
-							Type: "aws_instance",
-							Primary: &InstanceState{
-								ID: "bar",
-							},
-						},
-					},
-				},
-			},
-		},
-		Destroy: true,
 	})
 
+	stopCh := make(chan struct{})
+	p.StopFn = func() error {
+		close(stopCh)
+		return nil
+	}
+	p.DiffFn = testDiffFn
+	p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
+		go ctx.Interrupt()
+		for !ctx.sh.Stopped() {
+			// Wait for the interrupt
+		}
+
+		// The first interrupt lets us finish, the second one cancels us
+		go ctx.Interrupt()
+		select {
+		case <-stopCh:
+		case <-time.After(500 * time.Millisecond):
+			t.Error("stop should be called")
+		}
+
+		return testApplyFn(info, s, d)
+	}
+
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	if _, err := ctx.Apply(); err != nil {
+	state, err := ctx.Apply()
+	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
+
+	checkStateString(t, state, `
+aws_instance.foo:
+  ID = foo
+  num = 2
+  type = aws_instance
+	`)
 }
 
-// Tests that variables used as module vars that reference data that
-// already exists in the state and requires no diff works properly. This
-// fixes an issue faced where module variables were pruned because they were
-// accessing "non-existent" resources (they existed, just not in the graph
-// cause they weren't in the diff).
-func TestContext2Apply_moduleVarRefExisting(t *testing.T) {
-	m := testModule(t, "apply-ref-existing")
+func TestContext2Apply_timeout(t *testing.T) {
+	m := testModule(t, "apply-timeout")
 	p := testProvider("aws")
-	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
 
+	releaseCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	p.ApplyFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		d *InstanceDiff) (*InstanceState, error) {
+		defer close(doneCh)
+
+		// Block well past the timeout
+		<-releaseCh
+		return testApplyFn(info, s, d)
+	}
+
 	state := &State{
 		Modules: []*ModuleState{
 			&ModuleState{
@@ -2742,7 +3846,7 @@ func TestContext2Apply_moduleVarRefExisting(t *testing.T) {
 						Primary: &InstanceState{
 							ID: "foo",
 							Attributes: map[string]string{
-								"foo": "bar",
+								"num": "1",
 							},
 						},
 					},
@@ -2764,63 +3868,164 @@ func TestContext2Apply_moduleVarRefExisting(t *testing.T) {
 	}
 
 	state, err := ctx.Apply()
-	if err != nil {
-		t.Fatalf("err: %s", err)
+	if err == nil {
+		t.Fatal("should error")
 	}
-
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyModuleVarRefExistingStr)
-	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
+	if !strings.Contains(err.Error(), "apply exceeded timeout of 10ms") {
+		t.Fatalf("bad: %s", err)
 	}
+
+	// Let the provider finish late, which must not affect the state
+	close(releaseCh)
+	<-doneCh
+
+	checkStateString(t, state, `
+aws_instance.foo: (tainted)
+  ID = foo
+  num = 1
+	`)
 }
 
-func TestContext2Apply_moduleVarResourceCount(t *testing.T) {
-	m := testModule(t, "apply-module-var-resource-count")
+// A replacement is limited by the delete timeout while destroying and by
+// the create timeout while creating.
+func TestContext2Apply_timeoutsReplace(t *testing.T) {
+	m := testModule(t, "apply-timeouts-replace")
 	p := testProvider("aws")
-	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
+
+	// Block the destroy of foo and the create of bar past their timeouts
+	releaseCh := make(chan struct{})
+	p.ApplyFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		d *InstanceDiff) (*InstanceState, error) {
+		if (info.Id == "aws_instance.foo" && d.Destroy) ||
+			(info.Id == "aws_instance.bar" && !d.Destroy) {
+			<-releaseCh
+		}
+
+		return testApplyFn(info, s, d)
+	}
+
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "foo",
+							Attributes: map[string]string{
+								"require_new": "old",
+							},
+						},
+					},
+					"aws_instance.bar": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bar",
+							Attributes: map[string]string{
+								"require_new": "old",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
-		Variables: map[string]interface{}{
-			"count": "2",
-		},
-		Destroy: true,
+		State: state,
 	})
 
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	if _, err := ctx.Apply(); err != nil {
-		t.Fatalf("err: %s", err)
+	_, err := ctx.Apply()
+	close(releaseCh)
+	if err == nil {
+		t.Fatal("should error")
 	}
 
-	ctx = testContext2(t, &ContextOpts{
+	for _, id := range []string{"aws_instance.foo", "aws_instance.bar"} {
+		expected := id + ": apply exceeded timeout of 10ms"
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("expected %q in error: %s", expected, err)
+		}
+	}
+}
+
+func TestContext2Apply_cancelProvisioner(t *testing.T) {
+	m := testModule(t, "apply-cancel-provisioner")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	pr := testProvisioner()
+	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
-		Variables: map[string]interface{}{
-			"count": "5",
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
 		},
 	})
 
+	prStopped := make(chan struct{})
+	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
+		// Start the stop process
+		go ctx.Stop()
+
+		<-prStopped
+		return nil
+	}
+	pr.StopFn = func() error {
+		close(prStopped)
+		return nil
+	}
+
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	if _, err := ctx.Apply(); err != nil {
-		t.Fatalf("err: %s", err)
+	// Start the Apply in a goroutine
+	var applyErr error
+	stateCh := make(chan *State)
+	go func() {
+		state, err := ctx.Apply()
+		if err != nil {
+			applyErr = err
+		}
+
+		stateCh <- state
+	}()
+
+	// Wait for completion
+	state := <-stateCh
+	if applyErr != nil {
+		t.Fatalf("err: %s", applyErr)
+	}
+
+	checkStateString(t, state, `
+aws_instance.foo: (tainted)
+  ID = foo
+  num = 2
+  type = aws_instance
+	`)
+
+	if !pr.StopCalled {
+		t.Fatal("stop should be called")
 	}
 }
 
-// GH-819
-func TestContext2Apply_moduleBool(t *testing.T) {
-	m := testModule(t, "apply-module-bool")
+func TestContext2Apply_compute(t *testing.T) {
+	m := testModule(t, "apply-compute")
 	p := testProvider("aws")
 	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
@@ -2835,22 +4040,22 @@ func TestContext2Apply_moduleBool(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
+	ctx.variables = map[string]interface{}{"value": "1"}
+
 	state, err := ctx.Apply()
 	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
 	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyModuleBoolStr)
+	expected := strings.TrimSpace(testTerraformApplyComputeStr)
 	if actual != expected {
 		t.Fatalf("bad: \n%s", actual)
 	}
 }
 
-// Tests that a module can be targeted and everything is properly created.
-// This adds to the plan test to also just verify that apply works.
-func TestContext2Apply_moduleTarget(t *testing.T) {
-	m := testModule(t, "plan-targeted-cross-module")
+func TestContext2Apply_countComputed(t *testing.T) {
+	m := testModule(t, "apply-count-computed")
 	p := testProvider("aws")
 	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
@@ -2859,52 +4064,65 @@ func TestContext2Apply_moduleTarget(t *testing.T) {
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
-		Targets: []string{"module.B"},
 	})
 
-	if _, err := ctx.Plan(); err != nil {
+	plan, err := ctx.Plan()
+	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
+	// The count of bar isn't known until foo is created
+	if _, ok := plan.Diff.RootModule().Resources["aws_instance.bar.0"]; ok {
+		t.Fatalf("bar should not be planned:\n%s", plan)
+	}
+	if !reflect.DeepEqual(plan.Diff.RootModule().DeferredCount, []string{"aws_instance.bar"}) {
+		t.Fatalf("bar should be deferred:\n%s", plan)
+	}
+
 	state, err := ctx.Apply()
 	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	checkStateString(t, state, `
-<no state>
-module.A:
-  aws_instance.foo:
-    ID = foo
-    foo = bar
-    type = aws_instance
-
-  Outputs:
-
-  value = foo
-module.B:
-  aws_instance.bar:
-    ID = foo
-    foo = foo
-    type = aws_instance
-	`)
+	checkStateString(t, state, testTerraformApplyCountComputedStr)
 }
 
-func TestContext2Apply_multiProvider(t *testing.T) {
-	m := testModule(t, "apply-multi-provider")
+func TestContext2Apply_countComputedDecrease(t *testing.T) {
+	m := testModule(t, "apply-count-computed")
 	p := testProvider("aws")
 	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
 
-	pDO := testProvider("do")
-	pDO.ApplyFn = testApplyFn
-	pDO.DiffFn = testDiffFn
+	resources := make(map[string]*ResourceState)
+	for i := 0; i < 5; i++ {
+		resources[fmt.Sprintf("aws_instance.bar.%d", i)] = &ResourceState{
+			Type: "aws_instance",
+			Primary: &InstanceState{
+				ID: fmt.Sprintf("bar%d", i),
+				Attributes: map[string]string{
+					"foo":  fmt.Sprintf("%d", i),
+					"type": "aws_instance",
+				},
+			},
+		}
+	}
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path:      rootModulePath,
+				Resources: resources,
+			},
+		},
+	}
 
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
-			"do":  testProviderFuncFixed(pDO),
+		},
+		State: s,
+		Variables: map[string]interface{}{
+			"count": "2",
 		},
 	})
 
@@ -2917,301 +4135,2973 @@ func TestContext2Apply_multiProvider(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
-	mod := state.RootModule()
-	if len(mod.Resources) < 2 {
-		t.Fatalf("bad: %#v", mod.Resources)
-	}
-
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyMultiProviderStr)
-	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
-	}
+	checkStateString(t, state, testTerraformApplyCountComputedDecreaseStr)
 }
 
-func TestContext2Apply_multiProviderDestroy(t *testing.T) {
-	m := testModule(t, "apply-multi-provider-destroy")
+func TestContext2Apply_countDecrease(t *testing.T) {
+	m := testModule(t, "apply-count-dec")
 	p := testProvider("aws")
 	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo.0": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bar",
+							Attributes: map[string]string{
+								"foo":  "foo",
+								"type": "aws_instance",
+							},
+						},
+					},
+					"aws_instance.foo.1": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bar",
+							Attributes: map[string]string{
+								"foo":  "foo",
+								"type": "aws_instance",
+							},
+						},
+					},
+					"aws_instance.foo.2": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bar",
+							Attributes: map[string]string{
+								"foo":  "foo",
+								"type": "aws_instance",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: s,
+	})
 
-	p2 := testProvider("do")
-	p2.ApplyFn = testApplyFn
-	p2.DiffFn = testDiffFn
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
 
-	var state *State
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
 
-	// First, create the instances
-	{
-		ctx := testContext2(t, &ContextOpts{
-			Module: m,
-			Providers: map[string]ResourceProviderFactory{
-				"aws":   testProviderFuncFixed(p),
-				"vault": testProviderFuncFixed(p2),
-			},
-		})
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyCountDecStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+}
 
-		if _, err := ctx.Plan(); err != nil {
-			t.Fatalf("err: %s", err)
-		}
+func TestContext2Apply_countDecreaseToZero(t *testing.T) {
+	m := testModule(t, "apply-count-dec-zero")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
 
-		s, err := ctx.Apply()
-		if err != nil {
-			t.Fatalf("err: %s", err)
+	var l sync.Mutex
+	var destroyed []string
+	p.ApplyFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		d *InstanceDiff) (*InstanceState, error) {
+		if d.Destroy {
+			l.Lock()
+			destroyed = append(destroyed, info.Id)
+			l.Unlock()
 		}
-
-		state = s
+		return testApplyFn(info, s, d)
 	}
 
-	// Destroy them
-	{
-		// Verify that aws_instance.bar is destroyed first
-		var checked bool
-		var called int32
-		var lock sync.Mutex
-		applyFn := func(
-			info *InstanceInfo,
-			is *InstanceState,
-			id *InstanceDiff) (*InstanceState, error) {
-			lock.Lock()
-			defer lock.Unlock()
+	resources := map[string]*ResourceState{
+		"aws_instance.bar": &ResourceState{
+			Type: "aws_instance",
+			Primary: &InstanceState{
+				ID: "bar",
+				Attributes: map[string]string{
+					"foo":  "bar",
+					"type": "aws_instance",
+				},
+			},
+		},
+	}
+	for i := 0; i < 3; i++ {
+		resources[fmt.Sprintf("aws_instance.foo.%d", i)] = &ResourceState{
+			Type: "aws_instance",
+			Primary: &InstanceState{
+				ID: fmt.Sprintf("foo%d", i),
+				Attributes: map[string]string{
+					"foo":  "foo",
+					"type": "aws_instance",
+				},
+			},
+		}
+	}
 
-			if info.HumanId() == "aws_instance.bar" {
-				checked = true
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: &State{
+			Modules: []*ModuleState{
+				&ModuleState{
+					Path:      rootModulePath,
+					Resources: resources,
+				},
+			},
+		},
+	})
 
-				// Sleep to allow parallel execution
-				time.Sleep(50 * time.Millisecond)
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
 
-				// Verify that called is 0 (dep not called)
-				if atomic.LoadInt32(&called) != 0 {
-					return nil, fmt.Errorf("nothing else should be called")
-				}
-			}
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
 
-			atomic.AddInt32(&called, 1)
-			return testApplyFn(info, is, id)
-		}
+	sort.Strings(destroyed)
+	expected := []string{
+		"aws_instance.foo.0",
+		"aws_instance.foo.1",
+		"aws_instance.foo.2",
+	}
+	if !reflect.DeepEqual(destroyed, expected) {
+		t.Fatalf("bad: %#v", destroyed)
+	}
 
-		// Set the apply functions
-		p.ApplyFn = applyFn
-		p2.ApplyFn = applyFn
+	actual := strings.TrimSpace(state.String())
+	if actual != strings.TrimSpace(testTerraformApplyCountDecZeroStr) {
+		t.Fatalf("bad: \n%s", actual)
+	}
+}
 
-		ctx := testContext2(t, &ContextOpts{
-			Destroy: true,
-			State:   state,
-			Module:  m,
-			Providers: map[string]ResourceProviderFactory{
-				"aws":   testProviderFuncFixed(p),
-				"vault": testProviderFuncFixed(p2),
+func TestContext2Apply_countDecreaseToOneX(t *testing.T) {
+	m := testModule(t, "apply-count-dec-one")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo.0": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bar",
+							Attributes: map[string]string{
+								"foo":  "foo",
+								"type": "aws_instance",
+							},
+						},
+					},
+					"aws_instance.foo.1": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bar",
+						},
+					},
+					"aws_instance.foo.2": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bar",
+						},
+					},
+				},
 			},
-		})
+		},
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: s,
+	})
 
-		if _, err := ctx.Plan(); err != nil {
-			t.Fatalf("err: %s", err)
-		}
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
 
-		s, err := ctx.Apply()
-		if err != nil {
-			t.Fatalf("err: %s", err)
-		}
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
 
-		if !checked {
-			t.Fatal("should be checked")
-		}
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyCountDecToOneStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+}
+
+// https://github.com/PeoplePerHour/terraform/pull/11
+//
+// This tests a case where both a "resource" and "resource.0" are in
+// the state file, which apparently is a reasonable backwards compatibility
+// concern found in the above 3rd party repo.
+func TestContext2Apply_countDecreaseToOneCorrupted(t *testing.T) {
+	m := testModule(t, "apply-count-dec-one")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bar",
+							Attributes: map[string]string{
+								"foo":  "foo",
+								"type": "aws_instance",
+							},
+						},
+					},
+					"aws_instance.foo.0": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "baz",
+							Attributes: map[string]string{
+								"type": "aws_instance",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: s,
+	})
+
+	if p, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	} else {
+		testStringMatch(t, p, testTerraformApplyCountDecToOneCorruptedPlanStr)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyCountDecToOneCorruptedStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+}
+
+func TestContext2Apply_countTainted(t *testing.T) {
+	m := testModule(t, "apply-count-tainted")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo.0": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bar",
+							Attributes: map[string]string{
+								"foo":  "foo",
+								"type": "aws_instance",
+							},
+							Tainted: true,
+						},
+					},
+				},
+			},
+		},
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: s,
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyCountTaintedStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+}
+
+func TestContext2Apply_countVariable(t *testing.T) {
+	m := testModule(t, "apply-count-variable")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyCountVariableStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+}
+
+func TestContext2Apply_countVariableRef(t *testing.T) {
+	m := testModule(t, "apply-count-variable-ref")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyCountVariableRefStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+}
+
+func TestContext2Apply_mapVariableOverride(t *testing.T) {
+	m := testModule(t, "apply-map-var-override")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Variables: map[string]interface{}{
+			"images": []map[string]interface{}{
+				map[string]interface{}{
+					"us-west-2": "overridden",
+				},
+			},
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(`
+aws_instance.bar:
+  ID = foo
+  ami = overridden
+  type = aws_instance
+aws_instance.foo:
+  ID = foo
+  ami = image-1234
+  type = aws_instance
+	`)
+	if actual != expected {
+		t.Fatalf("got: \n%s\nexpected: \n%s", actual, expected)
+	}
+}
+
+func TestContext2Apply_moduleBasic(t *testing.T) {
+	m := testModule(t, "apply-module")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyModuleStr)
+	if actual != expected {
+		t.Fatalf("bad, expected:\n%s\n\nactual:\n%s", expected, actual)
+	}
+}
+
+func TestContext2Apply_moduleDestroyOrder(t *testing.T) {
+	m := testModule(t, "apply-module-destroy-order")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+
+	// Create a custom apply function to track the order they were destroyed
+	var order []string
+	var orderLock sync.Mutex
+	p.ApplyFn = func(
+		info *InstanceInfo,
+		is *InstanceState,
+		id *InstanceDiff) (*InstanceState, error) {
+		orderLock.Lock()
+		defer orderLock.Unlock()
+
+		order = append(order, is.ID)
+		return nil, nil
+	}
+
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.b": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "b",
+						},
+					},
+				},
+			},
+
+			&ModuleState{
+				Path: []string{"root", "child"},
+				Resources: map[string]*ResourceState{
+					"aws_instance.a": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "a",
+						},
+					},
+				},
+				Outputs: map[string]*OutputState{
+					"a_output": &OutputState{
+						Type:      "string",
+						Sensitive: false,
+						Value:     "a",
+					},
+				},
+			},
+		},
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State:   state,
+		Destroy: true,
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []string{"b", "a"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Fatalf("bad: %#v", order)
+	}
+
+	{
+		actual := strings.TrimSpace(state.String())
+		expected := strings.TrimSpace(testTerraformApplyModuleDestroyOrderStr)
+		if actual != expected {
+			t.Fatalf("bad: \n%s", actual)
+		}
+	}
+}
+
+func TestContext2Apply_moduleInheritAlias(t *testing.T) {
+	m := testModule(t, "apply-module-provider-inherit-alias")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+
+	p.ConfigureFn = func(c *ResourceConfig) error {
+		if _, ok := c.Get("child"); !ok {
+			return nil
+		}
+
+		if _, ok := c.Get("root"); ok {
+			return fmt.Errorf("child should not get root")
+		}
+
+		return nil
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	checkStateString(t, state, `
+<no state>
+module.child:
+  aws_instance.foo:
+    ID = foo
+    provider = aws.eu
+	`)
+}
+
+func TestContext2Apply_moduleOrphanInheritAlias(t *testing.T) {
+	m := testModule(t, "apply-module-provider-inherit-alias-orphan")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+
+	called := false
+	p.ConfigureFn = func(c *ResourceConfig) error {
+		called = true
+
+		if _, ok := c.Get("child"); !ok {
+			return nil
+		}
+
+		if _, ok := c.Get("root"); ok {
+			return fmt.Errorf("child should not get root")
+		}
+
+		return nil
+	}
+
+	// Create a state with an orphan module
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: []string{"root", "child"},
+				Resources: map[string]*ResourceState{
+					"aws_instance.bar": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bar",
+						},
+						Provider: "aws.eu",
+					},
+				},
+			},
+		},
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		State:  state,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !called {
+		t.Fatal("must call configure")
+	}
+
+	checkStateString(t, state, `
+module.child:
+  <no state>
+  `)
+}
+
+func TestContext2Apply_moduleOrphanProvider(t *testing.T) {
+	m := testModule(t, "apply-module-orphan-provider-inherit")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+
+	p.ConfigureFn = func(c *ResourceConfig) error {
+		if _, ok := c.Get("value"); !ok {
+			return fmt.Errorf("value is not found")
+		}
+
+		return nil
+	}
+
+	// Create a state with an orphan module
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: []string{"root", "child"},
+				Resources: map[string]*ResourceState{
+					"aws_instance.bar": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bar",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		State:  state,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := ctx.Apply(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestContext2Apply_moduleOrphanGrandchildProvider(t *testing.T) {
+	m := testModule(t, "apply-module-orphan-provider-inherit")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+
+	p.ConfigureFn = func(c *ResourceConfig) error {
+		if _, ok := c.Get("value"); !ok {
+			return fmt.Errorf("value is not found")
+		}
+
+		return nil
+	}
+
+	// Create a state with an orphan module that is nested (grandchild)
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: []string{"root", "parent", "child"},
+				Resources: map[string]*ResourceState{
+					"aws_instance.bar": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bar",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		State:  state,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := ctx.Apply(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestContext2Apply_moduleGrandchildProvider(t *testing.T) {
+	m := testModule(t, "apply-module-grandchild-provider-inherit")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+
+	var callLock sync.Mutex
+	called := false
+	p.ConfigureFn = func(c *ResourceConfig) error {
+		if _, ok := c.Get("value"); !ok {
+			return fmt.Errorf("value is not found")
+		}
+		callLock.Lock()
+		called = true
+		callLock.Unlock()
+
+		return nil
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := ctx.Apply(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	callLock.Lock()
+	defer callLock.Unlock()
+	if called != true {
+		t.Fatalf("err: configure never called")
+	}
+}
+
+// This tests an issue where all the providers in a module but not
+// in the root weren't being added to the root properly. In this test
+// case: aws is explicitly added to root, but "test" should be added to.
+// With the bug, it wasn't.
+func TestContext2Apply_moduleOnlyProvider(t *testing.T) {
+	m := testModule(t, "apply-module-only-provider")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	pTest := testProvider("test")
+	pTest.ApplyFn = testApplyFn
+	pTest.DiffFn = testDiffFn
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws":  testProviderFuncFixed(p),
+			"test": testProviderFuncFixed(pTest),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyModuleOnlyProviderStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+}
+
+func TestContext2Apply_moduleProviderAlias(t *testing.T) {
+	m := testModule(t, "apply-module-provider-alias")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyModuleProviderAliasStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+}
+
+func TestContext2Apply_moduleProviderAliasTargets(t *testing.T) {
+	m := testModule(t, "apply-module-provider-alias")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Targets: []string{"no.thing"},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(`
+<no state>
+	`)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+}
+
+func TestContext2Apply_moduleProviderCloseNested(t *testing.T) {
+	m := testModule(t, "apply-module-provider-close-nested")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: &State{
+			Modules: []*ModuleState{
+				&ModuleState{
+					Path: []string{"root", "child", "subchild"},
+					Resources: map[string]*ResourceState{
+						"aws_instance.foo": &ResourceState{
+							Type: "aws_instance",
+							Primary: &InstanceState{
+								ID: "bar",
+							},
+						},
+					},
+				},
+			},
+		},
+		Destroy: true,
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := ctx.Apply(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+// Tests that variables used as module vars that reference data that
+// already exists in the state and requires no diff works properly. This
+// fixes an issue faced where module variables were pruned because they were
+// accessing "non-existent" resources (they existed, just not in the graph
+// cause they weren't in the diff).
+func TestContext2Apply_moduleVarRefExisting(t *testing.T) {
+	m := testModule(t, "apply-ref-existing")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "foo",
+							Attributes: map[string]string{
+								"foo": "bar",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: state,
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyModuleVarRefExistingStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+}
+
+func TestContext2Apply_moduleVarResourceCount(t *testing.T) {
+	m := testModule(t, "apply-module-var-resource-count")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Variables: map[string]interface{}{
+			"count": "2",
+		},
+		Destroy: true,
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := ctx.Apply(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	ctx = testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Variables: map[string]interface{}{
+			"count": "5",
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := ctx.Apply(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+// GH-819
+func TestContext2Apply_moduleBool(t *testing.T) {
+	m := testModule(t, "apply-module-bool")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyModuleBoolStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+}
+
+// Tests that a module can be targeted and everything is properly created.
+// This adds to the plan test to also just verify that apply works.
+func TestContext2Apply_moduleTarget(t *testing.T) {
+	m := testModule(t, "plan-targeted-cross-module")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Targets: []string{"module.B"},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	checkStateString(t, state, `
+<no state>
+module.A:
+  aws_instance.foo:
+    ID = foo
+    foo = bar
+    type = aws_instance
+
+  Outputs:
+
+  value = foo
+module.B:
+  aws_instance.bar:
+    ID = foo
+    foo = foo
+    type = aws_instance
+	`)
+}
+
+func TestContext2Apply_importId(t *testing.T) {
+	m := testModule(t, "apply-import-id")
+	p := testProvider("aws")
+	pr := testProvisioner()
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	p.ImportStateReturn = []*InstanceState{
+		&InstanceState{
+			ID:        "i-abc123",
+			Ephemeral: EphemeralState{Type: "aws_instance"},
+		},
+		&InstanceState{
+			ID:        "sg-abc123",
+			Ephemeral: EphemeralState{Type: "aws_security_group"},
+		},
+	}
+	p.RefreshFn = func(info *InstanceInfo, s *InstanceState) (*InstanceState, error) {
+		return &InstanceState{
+			ID:         s.ID,
+			Attributes: map[string]string{"foo": "baz"},
+		}, nil
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !p.ImportStateCalled {
+		t.Fatal("import should be called")
+	}
+	if p.ImportStateID != "i-abc123" {
+		t.Fatalf("bad: %s", p.ImportStateID)
+	}
+	if p.ApplyCalled {
+		t.Fatal("apply should not be called")
+	}
+	if pr.ApplyCalled {
+		t.Fatal("an imported resource should not be provisioned")
+	}
+
+	// The state is what was imported, not the config
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(`
+aws_instance.foo:
+  ID = i-abc123
+  foo = baz
+`)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+
+	// Planning again shows the drift from the config as an update. The
+	// test diff function doesn't fill in the old values.
+	p.ImportStateCalled = false
+	ctx = testContext2(t, &ContextOpts{
+		Module: m,
+		State:  state,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
+	})
+
+	plan, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual = strings.TrimSpace(plan.Diff.String())
+	expected = strings.TrimSpace(`
+UPDATE: aws_instance.foo
+  foo:  "" => "bar"
+  type: "" => "aws_instance"
+`)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+	if p.ImportStateCalled {
+		t.Fatal("import should not be called again")
+	}
+}
+
+// The attributes that an import ID holds are kept when importing on
+// apply, the same as with terraform import.
+func TestContext2Apply_importIdComposite(t *testing.T) {
+	m := testModule(t, "apply-import-id-composite")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	p.ParseImportIDReturn = map[string]string{
+		"region": "us-west-2",
+	}
+	p.ImportStateReturn = []*InstanceState{
+		&InstanceState{
+			ID:        "i-abc123",
+			Ephemeral: EphemeralState{Type: "aws_instance"},
+		},
+	}
+	p.RefreshFn = func(info *InstanceInfo, s *InstanceState) (*InstanceState, error) {
+		result := s.DeepCopy()
+		result.Attributes["foo"] = "baz"
+		return result, nil
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !p.ParseImportIDCalled {
+		t.Fatal("ParseImportID should be called")
+	}
+	if p.ParseImportIDID != "us-west-2/i-abc123" {
+		t.Fatalf("bad: %s", p.ParseImportIDID)
+	}
+
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(`
+aws_instance.foo:
+  ID = i-abc123
+  foo = baz
+  region = us-west-2
+`)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+}
+
+func TestContext2Apply_importIdNotFound(t *testing.T) {
+	m := testModule(t, "apply-import-id")
+	p := testProvider("aws")
+	pr := testProvisioner()
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	p.ImportStateReturn = []*InstanceState{
+		&InstanceState{
+			ID:        "i-abc123",
+			Ephemeral: EphemeralState{Type: "aws_instance"},
+		},
+	}
+	p.RefreshFn = func(*InstanceInfo, *InstanceState) (*InstanceState, error) {
+		return nil, nil
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err == nil || !strings.Contains(err.Error(), "doesn't\nexist") {
+		t.Fatalf("bad: %s", err)
+	}
+	if p.ApplyCalled {
+		t.Fatal("apply should not be called")
+	}
+
+	actual := strings.TrimSpace(state.String())
+	if actual != "<no state>" {
+		t.Fatalf("bad: \n%s", actual)
+	}
+}
+
+// A precondition that depends on a computed attribute is deferred to the
+// apply, when the attribute is known.
+func TestContext2Apply_preconditionComputed(t *testing.T) {
+	m := testModule(t, "apply-precondition-computed")
+
+	cases := map[string]struct {
+		Expected string
+		Err      bool
+	}{
+		"holds":    {"foo", false},
+		"violated": {"bar", true},
+	}
+
+	for k, tc := range cases {
+		p := testProvider("aws")
+		p.ApplyFn = testApplyFn
+		p.DiffFn = testDiffFn
+		ctx := testContext2(t, &ContextOpts{
+			Module: m,
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+			Variables: map[string]interface{}{
+				"expected": tc.Expected,
+			},
+		})
+
+		if _, err := ctx.Plan(); err != nil {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+
+		state, err := ctx.Apply()
+		mod := state.RootModule()
+		if mod.Resources["aws_instance.bar"] == nil {
+			t.Fatalf("%s: bar should be applied", k)
+		}
+
+		if !tc.Err {
+			if err != nil {
+				t.Fatalf("%s: err: %s", k, err)
+			}
+			if mod.Resources["aws_instance.baz"] == nil {
+				t.Fatalf("%s: baz should be applied", k)
+			}
+			continue
+		}
+
+		if err == nil || !strings.Contains(err.Error(), "bar has the wrong ID") {
+			t.Fatalf("%s: bad: %s", k, err)
+		}
+		if mod.Resources["aws_instance.baz"] != nil {
+			t.Fatalf("%s: baz should not be applied", k)
+		}
+	}
+}
+
+func TestContext2Apply_postcondition(t *testing.T) {
+	m := testModule(t, "apply-postcondition")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), "foo must be baz, got bar") {
+		t.Fatalf("bad: %s", err)
+	}
+	if strings.Contains(err.Error(), "aws_instance.pass") {
+		t.Fatalf("passing postcondition should not error: %s", err)
+	}
+
+	// The resource with the failing postcondition is kept but tainted
+	mod := state.RootModule()
+	if rs := mod.Resources["aws_instance.pass"]; rs == nil || rs.Primary.Tainted {
+		t.Fatalf("bad: %#v", rs)
+	}
+	if rs := mod.Resources["aws_instance.fail"]; rs == nil || !rs.Primary.Tainted {
+		t.Fatalf("bad: %#v", rs)
+	}
+
+	// The next apply replaces it
+	ctx = testContext2(t, &ContextOpts{
+		Module: m,
+		State:  state,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	plan, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	rd := plan.Diff.RootModule().Resources["aws_instance.fail"]
+	if rd == nil || !rd.DestroyTainted {
+		t.Fatalf("bad: %#v", rd)
+	}
+	if rd := plan.Diff.RootModule().Resources["aws_instance.pass"]; rd != nil {
+		t.Fatalf("bad: %#v", rd)
+	}
+}
+
+func TestContext2Apply_multiProvider(t *testing.T) {
+	m := testModule(t, "apply-multi-provider")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+
+	pDO := testProvider("do")
+	pDO.ApplyFn = testApplyFn
+	pDO.DiffFn = testDiffFn
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+			"do":  testProviderFuncFixed(pDO),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	mod := state.RootModule()
+	if len(mod.Resources) < 2 {
+		t.Fatalf("bad: %#v", mod.Resources)
+	}
+
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyMultiProviderStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+}
+
+func TestContext2Apply_multiProviderDestroy(t *testing.T) {
+	m := testModule(t, "apply-multi-provider-destroy")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+
+	p2 := testProvider("do")
+	p2.ApplyFn = testApplyFn
+	p2.DiffFn = testDiffFn
+
+	var state *State
+
+	// First, create the instances
+	{
+		ctx := testContext2(t, &ContextOpts{
+			Module: m,
+			Providers: map[string]ResourceProviderFactory{
+				"aws":   testProviderFuncFixed(p),
+				"vault": testProviderFuncFixed(p2),
+			},
+		})
+
+		if _, err := ctx.Plan(); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		s, err := ctx.Apply()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		state = s
+	}
+
+	// Destroy them
+	{
+		// Verify that aws_instance.bar is destroyed first
+		var checked bool
+		var called int32
+		var lock sync.Mutex
+		applyFn := func(
+			info *InstanceInfo,
+			is *InstanceState,
+			id *InstanceDiff) (*InstanceState, error) {
+			lock.Lock()
+			defer lock.Unlock()
+
+			if info.HumanId() == "aws_instance.bar" {
+				checked = true
+
+				// Sleep to allow parallel execution
+				time.Sleep(50 * time.Millisecond)
+
+				// Verify that called is 0 (dep not called)
+				if atomic.LoadInt32(&called) != 0 {
+					return nil, fmt.Errorf("nothing else should be called")
+				}
+			}
+
+			atomic.AddInt32(&called, 1)
+			return testApplyFn(info, is, id)
+		}
+
+		// Set the apply functions
+		p.ApplyFn = applyFn
+		p2.ApplyFn = applyFn
+
+		ctx := testContext2(t, &ContextOpts{
+			Destroy: true,
+			State:   state,
+			Module:  m,
+			Providers: map[string]ResourceProviderFactory{
+				"aws":   testProviderFuncFixed(p),
+				"vault": testProviderFuncFixed(p2),
+			},
+		})
+
+		if _, err := ctx.Plan(); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		s, err := ctx.Apply()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if !checked {
+			t.Fatal("should be checked")
+		}
+
+		state = s
+	}
+
+	checkStateString(t, state, `<no state>`)
+}
+
+// This is like the multiProviderDestroy test except it tests that
+// dependent resources within a child module that inherit provider
+// configuration are still destroyed first.
+func TestContext2Apply_multiProviderDestroyChild(t *testing.T) {
+	m := testModule(t, "apply-multi-provider-destroy-child")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+
+	p2 := testProvider("do")
+	p2.ApplyFn = testApplyFn
+	p2.DiffFn = testDiffFn
+
+	var state *State
+
+	// First, create the instances
+	{
+		ctx := testContext2(t, &ContextOpts{
+			Module: m,
+			Providers: map[string]ResourceProviderFactory{
+				"aws":   testProviderFuncFixed(p),
+				"vault": testProviderFuncFixed(p2),
+			},
+		})
+
+		if _, err := ctx.Plan(); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		s, err := ctx.Apply()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		state = s
+	}
+
+	// Destroy them
+	{
+		// Verify that aws_instance.bar is destroyed first
+		var checked bool
+		var called int32
+		var lock sync.Mutex
+		applyFn := func(
+			info *InstanceInfo,
+			is *InstanceState,
+			id *InstanceDiff) (*InstanceState, error) {
+			lock.Lock()
+			defer lock.Unlock()
+
+			if info.HumanId() == "module.child.aws_instance.bar" {
+				checked = true
+
+				// Sleep to allow parallel execution
+				time.Sleep(50 * time.Millisecond)
+
+				// Verify that called is 0 (dep not called)
+				if atomic.LoadInt32(&called) != 0 {
+					return nil, fmt.Errorf("nothing else should be called")
+				}
+			}
+
+			atomic.AddInt32(&called, 1)
+			return testApplyFn(info, is, id)
+		}
+
+		// Set the apply functions
+		p.ApplyFn = applyFn
+		p2.ApplyFn = applyFn
+
+		ctx := testContext2(t, &ContextOpts{
+			Destroy: true,
+			State:   state,
+			Module:  m,
+			Providers: map[string]ResourceProviderFactory{
+				"aws":   testProviderFuncFixed(p),
+				"vault": testProviderFuncFixed(p2),
+			},
+		})
+
+		if _, err := ctx.Plan(); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		s, err := ctx.Apply()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if !checked {
+			t.Fatal("should be checked")
+		}
+
+		state = s
+	}
+
+	checkStateString(t, state, `
+<no state>
+module.child:
+  <no state>
+`)
+}
+
+func TestContext2Apply_multiVar(t *testing.T) {
+	m := testModule(t, "apply-multi-var")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+
+	// First, apply with a count of 3
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Variables: map[string]interface{}{
+			"count": "3",
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := state.RootModule().Outputs["output"]
+	expected := "bar0,bar1,bar2"
+	if actual == nil || actual.Value != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+
+	t.Logf("Initial state: %s", state.String())
+
+	// Apply again, reduce the count to 1
+	{
+		ctx := testContext2(t, &ContextOpts{
+			Module: m,
+			State:  state,
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+			Variables: map[string]interface{}{
+				"count": "1",
+			},
+		})
+
+		if _, err := ctx.Plan(); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		state, err := ctx.Apply()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		t.Logf("End state: %s", state.String())
+
+		actual := state.RootModule().Outputs["output"]
+		if actual == nil {
+			t.Fatal("missing output")
+		}
+
+		expected := "bar0"
+		if actual.Value != expected {
+			t.Fatalf("bad: \n%s", actual)
+		}
+	}
+}
+
+// Test that multi-var (splat) access is ordered by count, not by
+// value.
+func TestContext2Apply_multiVarOrder(t *testing.T) {
+	m := testModule(t, "apply-multi-var-order")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+
+	// First, apply with a count of 3
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	t.Logf("State: %s", state.String())
+
+	actual := state.RootModule().Outputs["should-be-11"]
+	expected := "index-11"
+	if actual == nil || actual.Value != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+}
+
+// Test that multi-var (splat) access is ordered by count, not by
+// value, through interpolations.
+func TestContext2Apply_multiVarOrderInterp(t *testing.T) {
+	m := testModule(t, "apply-multi-var-order-interp")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+
+	// First, apply with a count of 3
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	t.Logf("State: %s", state.String())
+
+	actual := state.RootModule().Outputs["should-be-11"]
+	expected := "baz-index-11"
+	if actual == nil || actual.Value != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+}
+
+// Based on GH-10440 where a graph edge wasn't properly being created
+// between a modified resource and a count instance being destroyed.
+func TestContext2Apply_multiVarCountDec(t *testing.T) {
+	var s *State
+
+	// First create resources. Nothing sneaky here.
+	{
+		m := testModule(t, "apply-multi-var-count-dec")
+		p := testProvider("aws")
+		p.ApplyFn = testApplyFn
+		p.DiffFn = testDiffFn
+		ctx := testContext2(t, &ContextOpts{
+			Module: m,
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+			Variables: map[string]interface{}{
+				"count": "2",
+			},
+		})
+
+		if _, err := ctx.Plan(); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		state, err := ctx.Apply()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		t.Logf("Step 1 state: %s", state)
+
+		s = state
+	}
+
+	// Decrease the count by 1 and verify that everything happens in the
+	// right order.
+	{
+		m := testModule(t, "apply-multi-var-count-dec")
+		p := testProvider("aws")
+		p.ApplyFn = testApplyFn
+		p.DiffFn = testDiffFn
+
+		// Verify that aws_instance.bar is modified first and nothing
+		// else happens at the same time.
+		var checked bool
+		var called int32
+		var lock sync.Mutex
+		p.ApplyFn = func(
+			info *InstanceInfo,
+			is *InstanceState,
+			id *InstanceDiff) (*InstanceState, error) {
+			lock.Lock()
+			defer lock.Unlock()
+
+			if info.HumanId() == "aws_instance.bar" {
+				checked = true
+
+				// Sleep to allow parallel execution
+				time.Sleep(50 * time.Millisecond)
+
+				// Verify that called is 0 (dep not called)
+				if atomic.LoadInt32(&called) != 1 {
+					return nil, fmt.Errorf("nothing else should be called")
+				}
+			}
+
+			atomic.AddInt32(&called, 1)
+			return testApplyFn(info, is, id)
+		}
+
+		ctx := testContext2(t, &ContextOpts{
+			State:  s,
+			Module: m,
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+			Variables: map[string]interface{}{
+				"count": "1",
+			},
+		})
+
+		if _, err := ctx.Plan(); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		state, err := ctx.Apply()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if !checked {
+			t.Fatal("apply never called")
+		}
+
+		t.Logf("Step 2 state: %s", state)
+
+		s = state
+	}
+}
+
+func TestContext2Apply_nilDiff(t *testing.T) {
+	m := testModule(t, "apply-good")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	p.DiffFn = func(*InstanceInfo, *InstanceState, *ResourceConfig) (*InstanceDiff, error) {
+		return nil, nil
+	}
+
+	if _, err := ctx.Apply(); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestContext2Apply_outputDependsOn(t *testing.T) {
+	m := testModule(t, "apply-output-depends-on")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+
+	{
+		// Create a custom apply function that sleeps a bit (to allow parallel
+		// graph execution) and then returns an error to force a partial state
+		// return. We then verify the output is NOT there.
+		p.ApplyFn = func(
+			info *InstanceInfo,
+			is *InstanceState,
+			id *InstanceDiff) (*InstanceState, error) {
+
+			// Sleep to allow parallel execution
+			time.Sleep(50 * time.Millisecond)
+
+			// Return error to force partial state
+			return nil, fmt.Errorf("abcd")
+		}
+
+		ctx := testContext2(t, &ContextOpts{
+			Module: m,
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+		})
+
+		if _, err := ctx.Plan(); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		state, err := ctx.Apply()
+		if err == nil || !strings.Contains(err.Error(), "abcd") {
+			t.Fatalf("err: %s", err)
+		}
+
+		checkStateString(t, state, `<no state>`)
+	}
+
+	{
+		// Create the standard apply function and verify we get the output
+		p.ApplyFn = testApplyFn
+
+		ctx := testContext2(t, &ContextOpts{
+			Module: m,
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+		})
+
+		if _, err := ctx.Plan(); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		state, err := ctx.Apply()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		checkStateString(t, state, `
+aws_instance.foo:
+  ID = foo
+
+Outputs:
+
+value = result
+		`)
+	}
+}
+
+func TestContext2Apply_outputOrphan(t *testing.T) {
+	m := testModule(t, "apply-output-orphan")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Outputs: map[string]*OutputState{
+					"foo": &OutputState{
+						Type:      "string",
+						Sensitive: false,
+						Value:     "bar",
+					},
+					"bar": &OutputState{
+						Type:      "string",
+						Sensitive: false,
+						Value:     "baz",
+					},
+				},
+			},
+		},
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: state,
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyOutputOrphanStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+}
+
+func TestContext2Apply_outputOrphanModule(t *testing.T) {
+	m := testModule(t, "apply-output-orphan-module")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: []string{"root", "child"},
+				Outputs: map[string]*OutputState{
+					"foo": &OutputState{
+						Type:  "string",
+						Value: "bar",
+					},
+					"bar": &OutputState{
+						Type:  "string",
+						Value: "baz",
+					},
+				},
+			},
+		},
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: state,
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyOutputOrphanModuleStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+}
+
+func TestContext2Apply_providerComputedVar(t *testing.T) {
+	m := testModule(t, "apply-provider-computed")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+
+	pTest := testProvider("test")
+	pTest.ApplyFn = testApplyFn
+	pTest.DiffFn = testDiffFn
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws":  testProviderFuncFixed(p),
+			"test": testProviderFuncFixed(pTest),
+		},
+	})
+
+	p.ConfigureFn = func(c *ResourceConfig) error {
+		if c.IsComputed("value") {
+			return fmt.Errorf("value is computed")
+		}
+
+		v, ok := c.Get("value")
+		if !ok {
+			return fmt.Errorf("value is not found")
+		}
+		if v != "yes" {
+			return fmt.Errorf("value is not 'yes': %v", v)
+		}
+
+		return nil
+	}
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := ctx.Apply(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestContext2Apply_providerConfigureDisabled(t *testing.T) {
+	m := testModule(t, "apply-provider-configure-disabled")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+
+	called := false
+	p.ConfigureFn = func(c *ResourceConfig) error {
+		called = true
+
+		if _, ok := c.Get("value"); !ok {
+			return fmt.Errorf("value is not found")
+		}
+
+		return nil
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := ctx.Apply(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !called {
+		t.Fatal("configure never called")
+	}
+}
+
+func TestContext2Apply_provisionerModule(t *testing.T) {
+	m := testModule(t, "apply-provisioner-module")
+	p := testProvider("aws")
+	pr := testProvisioner()
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyProvisionerModuleStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+
+	// Verify apply was invoked
+	if !pr.ApplyCalled {
+		t.Fatalf("provisioner not invoked")
+	}
+}
+
+func TestContext2Apply_Provisioner_compute(t *testing.T) {
+	m := testModule(t, "apply-provisioner-compute")
+	p := testProvider("aws")
+	pr := testProvisioner()
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
+		val, ok := c.Config["foo"]
+		if !ok || val != "computed_dynamical" {
+			t.Fatalf("bad value for foo: %v %#v", val, c)
+		}
+
+		return nil
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
+		Variables: map[string]interface{}{
+			"value": "1",
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyProvisionerStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+
+	// Verify apply was invoked
+	if !pr.ApplyCalled {
+		t.Fatalf("provisioner not invoked")
+	}
+}
+
+func TestContext2Apply_provisionerCondition(t *testing.T) {
+	m := testModule(t, "apply-provisioner-condition")
+	p := testProvider("aws")
+	pr := testProvisioner()
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+
+	var lock sync.Mutex
+	var commands []string
+	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
+		lock.Lock()
+		defer lock.Unlock()
+		commands = append(commands, c.Config["command"].(string))
+		return nil
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := ctx.Apply(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The condition on the computed id is evaluated after apply
+	sort.Strings(commands)
+	expected := []string{"always", "always", "computed", "computed", "first"}
+	if !reflect.DeepEqual(commands, expected) {
+		t.Fatalf("bad: %#v", commands)
+	}
+}
+
+func TestContext2Apply_values(t *testing.T) {
+	m := testModule(t, "apply-values")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Variables: map[string]interface{}{
+			"env": "prod",
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	checkStateString(t, state, testTerraformApplyValuesStr)
+
+	// Changing an input updates the stored values in place
+	ctx = testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Variables: map[string]interface{}{
+			"env": "dev",
+		},
+		State: state,
+	})
+
+	// There is nothing to refresh for values
+	if _, err := ctx.Refresh(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	plan, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	rd := plan.Diff.RootModule().Resources["values.tags"]
+	if rd == nil || rd.ChangeType() != DiffUpdate {
+		t.Fatalf("bad: %#v", rd)
+	}
+
+	state, err = ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	checkStateString(t, state, testTerraformApplyValuesUpdateStr)
+
+	// Destroying just removes the values from the state
+	ctx = testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Variables: map[string]interface{}{
+			"env": "dev",
+		},
+		State:   state,
+		Destroy: true,
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err = ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	checkStateString(t, state, "<no state>")
+}
+
+func TestContext2Apply_provisionerRewriteConfig(t *testing.T) {
+	m := testModule(t, "apply-provisioner-rewrite")
+	p := testProvider("aws")
+	pr := testProvisioner()
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+
+	var lock sync.Mutex
+	var commands []string
+	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
+		lock.Lock()
+		defer lock.Unlock()
+		commands = append(commands, c.Config["command"].(string))
+		return nil
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
+		RewriteProvisionerConfig: func(
+			info *InstanceInfo, name string, c *ResourceConfig) (*ResourceConfig, error) {
+			if name != "shell" {
+				return nil, fmt.Errorf("bad name: %s", name)
+			}
+
+			// The config is already interpolated
+			command := c.Config["command"].(string)
+			return testResourceConfig(t, map[string]interface{}{
+				"command": fmt.Sprintf("audit %s -- %s", info.Id, command),
+			}), nil
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := ctx.Apply(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	sort.Strings(commands)
+	expected := []string{
+		"audit aws_instance.bar -- echo bar",
+		"audit aws_instance.foo -- echo foo",
+	}
+	if !reflect.DeepEqual(commands, expected) {
+		t.Fatalf("bad: %#v", commands)
+	}
+}
+
+func TestContext2Apply_provisionerRewriteConfigError(t *testing.T) {
+	m := testModule(t, "apply-provisioner-rewrite")
+	p := testProvider("aws")
+	pr := testProvisioner()
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
+		RewriteProvisionerConfig: func(
+			*InstanceInfo, string, *ResourceConfig) (*ResourceConfig, error) {
+			return nil, fmt.Errorf("rewrite failed")
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Only the provisioner that doesn't continue on failure fails apply
+	state, err := ctx.Apply()
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), "aws_instance.foo: provisioner shell: rewrite failed") {
+		t.Fatalf("bad: %s", err)
+	}
+	if strings.Contains(err.Error(), "aws_instance.bar") {
+		t.Fatalf("bad: %s", err)
+	}
+
+	if pr.ApplyCalled {
+		t.Fatal("provisioner should not be called")
+	}
+
+	checkStateString(t, state, testTerraformApplyProvisionerRewriteConfigErrorStr)
+}
+
+func TestContext2Apply_provisionerCreateFail(t *testing.T) {
+	m := testModule(t, "apply-provisioner-fail-create")
+	p := testProvider("aws")
+	pr := testProvisioner()
+	p.DiffFn = testDiffFn
+
+	p.ApplyFn = func(
+		info *InstanceInfo,
+		is *InstanceState,
+		id *InstanceDiff) (*InstanceState, error) {
+		is.ID = "foo"
+		return is, fmt.Errorf("error")
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err == nil {
+		t.Fatal("should error")
+	}
+
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyProvisionerFailCreateStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+}
+
+func TestContext2Apply_provisionerCreateFailNoId(t *testing.T) {
+	m := testModule(t, "apply-provisioner-fail-create")
+	p := testProvider("aws")
+	pr := testProvisioner()
+	p.DiffFn = testDiffFn
+
+	p.ApplyFn = func(
+		info *InstanceInfo,
+		is *InstanceState,
+		id *InstanceDiff) (*InstanceState, error) {
+		return nil, fmt.Errorf("error")
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err == nil {
+		t.Fatal("should error")
+	}
+
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyProvisionerFailCreateNoIdStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+}
+
+func TestContext2Apply_resourceTimeoutProvisioner(t *testing.T) {
+	m := testModule(t, "apply-provisioner-fail")
+	p := testProvider("aws")
+	pr := testProvisioner()
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+
+	// The provisioner hangs until the test is over
+	releaseCh := make(chan struct{})
+	defer close(releaseCh)
+	pr.ApplyFn = func(*InstanceState, *ResourceConfig) error {
+		<-releaseCh
+		return nil
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
+		ResourceTimeout: 50 * time.Millisecond,
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	doneCh := make(chan struct{})
+	var state *State
+	var err error
+	go func() {
+		defer close(doneCh)
+		state, err = ctx.Apply()
+	}()
+
+	select {
+	case <-doneCh:
+	case <-time.After(5 * time.Second):
+		t.Fatal("apply should time out")
+	}
+
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), "aws_instance.bar: applying took longer than the resource timeout of 50ms") {
+		t.Fatalf("bad: %s", err)
+	}
+
+	// The resource was created before provisioning hung, so it must be
+	// kept in the state and be tainted. The other resource isn't affected.
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyProvisionerFailStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+}
+
+func TestContext2Apply_provisionerFail(t *testing.T) {
+	m := testModule(t, "apply-provisioner-fail")
+	p := testProvider("aws")
+	pr := testProvisioner()
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+
+	pr.ApplyFn = func(*InstanceState, *ResourceConfig) error {
+		return fmt.Errorf("EXPLOSION")
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
+		Variables: map[string]interface{}{
+			"value": "1",
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err == nil {
+		t.Fatal("should error")
+	}
+
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyProvisionerFailStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+
+	// The created resource must be kept in state and tainted, not rolled back
+	rs := state.RootModule().Resources["aws_instance.bar"]
+	if rs == nil || rs.Primary == nil {
+		t.Fatalf("resource should be in state: %#v", rs)
+	}
+	if !rs.Primary.Tainted {
+		t.Fatalf("resource should be tainted: %#v", rs.Primary)
+	}
+}
+
+func TestContext2Apply_provisionerFail_createBeforeDestroy(t *testing.T) {
+	m := testModule(t, "apply-provisioner-fail-create-before")
+	p := testProvider("aws")
+	pr := testProvisioner()
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	pr.ApplyFn = func(*InstanceState, *ResourceConfig) error {
+		return fmt.Errorf("EXPLOSION")
+	}
+
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.bar": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bar",
+							Attributes: map[string]string{
+								"require_new": "abc",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
+		State: state,
+	})
 
-		state = s
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
 	}
 
-	checkStateString(t, state, `<no state>`)
+	state, err := ctx.Apply()
+	if err == nil {
+		t.Fatal("should error")
+	}
+
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyProvisionerFailCreateBeforeDestroyStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
 }
 
-// This is like the multiProviderDestroy test except it tests that
-// dependent resources within a child module that inherit provider
-// configuration are still destroyed first.
-func TestContext2Apply_multiProviderDestroyChild(t *testing.T) {
-	m := testModule(t, "apply-multi-provider-destroy-child")
+func TestContext2Apply_error_createBeforeDestroy(t *testing.T) {
+	m := testModule(t, "apply-error-create-before")
 	p := testProvider("aws")
-	p.ApplyFn = testApplyFn
-	p.DiffFn = testDiffFn
-
-	p2 := testProvider("do")
-	p2.ApplyFn = testApplyFn
-	p2.DiffFn = testDiffFn
-
-	var state *State
-
-	// First, create the instances
-	{
-		ctx := testContext2(t, &ContextOpts{
-			Module: m,
-			Providers: map[string]ResourceProviderFactory{
-				"aws":   testProviderFuncFixed(p),
-				"vault": testProviderFuncFixed(p2),
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.bar": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bar",
+							Attributes: map[string]string{
+								"require_new": "abc",
+							},
+						},
+					},
+				},
 			},
-		})
-
-		if _, err := ctx.Plan(); err != nil {
-			t.Fatalf("err: %s", err)
-		}
-
-		s, err := ctx.Apply()
-		if err != nil {
-			t.Fatalf("err: %s", err)
-		}
-
-		state = s
+		},
 	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: state,
+	})
+	p.ApplyFn = func(info *InstanceInfo, is *InstanceState, id *InstanceDiff) (*InstanceState, error) {
+		return nil, fmt.Errorf("error")
+	}
+	p.DiffFn = testDiffFn
 
-	// Destroy them
-	{
-		// Verify that aws_instance.bar is destroyed first
-		var checked bool
-		var called int32
-		var lock sync.Mutex
-		applyFn := func(
-			info *InstanceInfo,
-			is *InstanceState,
-			id *InstanceDiff) (*InstanceState, error) {
-			lock.Lock()
-			defer lock.Unlock()
-
-			if info.HumanId() == "module.child.aws_instance.bar" {
-				checked = true
-
-				// Sleep to allow parallel execution
-				time.Sleep(50 * time.Millisecond)
-
-				// Verify that called is 0 (dep not called)
-				if atomic.LoadInt32(&called) != 0 {
-					return nil, fmt.Errorf("nothing else should be called")
-				}
-			}
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
 
-			atomic.AddInt32(&called, 1)
-			return testApplyFn(info, is, id)
-		}
+	state, err := ctx.Apply()
+	if err == nil {
+		t.Fatal("should have error")
+	}
 
-		// Set the apply functions
-		p.ApplyFn = applyFn
-		p2.ApplyFn = applyFn
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyErrorCreateBeforeDestroyStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s\n\nExpected:\n\n%s", actual, expected)
+	}
+}
 
-		ctx := testContext2(t, &ContextOpts{
-			Destroy: true,
-			State:   state,
-			Module:  m,
-			Providers: map[string]ResourceProviderFactory{
-				"aws":   testProviderFuncFixed(p),
-				"vault": testProviderFuncFixed(p2),
+func TestContext2Apply_errorDestroy_createBeforeDestroy(t *testing.T) {
+	m := testModule(t, "apply-error-create-before")
+	p := testProvider("aws")
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.bar": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bar",
+							Attributes: map[string]string{
+								"require_new": "abc",
+							},
+						},
+					},
+				},
 			},
-		})
-
-		if _, err := ctx.Plan(); err != nil {
-			t.Fatalf("err: %s", err)
+		},
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: state,
+	})
+	p.ApplyFn = func(info *InstanceInfo, is *InstanceState, id *InstanceDiff) (*InstanceState, error) {
+		// Fail the destroy!
+		if id.Destroy {
+			return is, fmt.Errorf("error")
 		}
 
-		s, err := ctx.Apply()
-		if err != nil {
-			t.Fatalf("err: %s", err)
+		// Create should work
+		is = &InstanceState{
+			ID: "foo",
 		}
+		return is, nil
+	}
+	p.DiffFn = testDiffFn
 
-		if !checked {
-			t.Fatal("should be checked")
-		}
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
 
-		state = s
+	state, err := ctx.Apply()
+	if err == nil {
+		t.Fatal("should have error")
 	}
 
-	checkStateString(t, state, `
-<no state>
-module.child:
-  <no state>
-`)
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyErrorDestroyCreateBeforeDestroyStr)
+	if actual != expected {
+		t.Fatalf("bad: actual:\n%s\n\nexpected:\n%s", actual, expected)
+	}
 }
 
-func TestContext2Apply_multiVar(t *testing.T) {
-	m := testModule(t, "apply-multi-var")
+func TestContext2Apply_multiDepose_createBeforeDestroy(t *testing.T) {
+	m := testModule(t, "apply-multi-depose-create-before-destroy")
 	p := testProvider("aws")
-	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
+	ps := map[string]ResourceProviderFactory{"aws": testProviderFuncFixed(p)}
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.web": &ResourceState{
+						Type:    "aws_instance",
+						Primary: &InstanceState{ID: "foo"},
+					},
+				},
+			},
+		},
+	}
 
-	// First, apply with a count of 3
 	ctx := testContext2(t, &ContextOpts{
-		Module: m,
-		Providers: map[string]ResourceProviderFactory{
-			"aws": testProviderFuncFixed(p),
-		},
-		Variables: map[string]interface{}{
-			"count": "3",
-		},
+		Module:    m,
+		Providers: ps,
+		State:     state,
 	})
+	createdInstanceId := "bar"
+	// Create works
+	createFunc := func(is *InstanceState) (*InstanceState, error) {
+		return &InstanceState{ID: createdInstanceId}, nil
+	}
+	// Destroy starts broken
+	destroyFunc := func(is *InstanceState) (*InstanceState, error) {
+		return is, fmt.Errorf("destroy failed")
+	}
+	p.ApplyFn = func(info *InstanceInfo, is *InstanceState, id *InstanceDiff) (*InstanceState, error) {
+		if id.Destroy {
+			return destroyFunc(is)
+		} else {
+			return createFunc(is)
+		}
+	}
 
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
+	// Destroy is broken, so even though CBD successfully replaces the instance,
+	// we'll have to save the Deposed instance to destroy later
 	state, err := ctx.Apply()
-	if err != nil {
+	if err == nil {
+		t.Fatal("should have error")
+	}
+
+	checkStateString(t, state, `
+aws_instance.web: (1 deposed)
+  ID = bar
+  Deposed ID 1 = foo
+	`)
+
+	createdInstanceId = "baz"
+	ctx = testContext2(t, &ContextOpts{
+		Module:    m,
+		Providers: ps,
+		State:     state,
+	})
+
+	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	actual := state.RootModule().Outputs["output"]
-	expected := "bar0,bar1,bar2"
-	if actual == nil || actual.Value != expected {
-		t.Fatalf("bad: \n%s", actual)
+	// We're replacing the primary instance once again. Destroy is _still_
+	// broken, so the Deposed list gets longer
+	state, err = ctx.Apply()
+	if err == nil {
+		t.Fatal("should have error")
 	}
 
-	t.Logf("Initial state: %s", state.String())
-
-	// Apply again, reduce the count to 1
-	{
-		ctx := testContext2(t, &ContextOpts{
-			Module: m,
-			State:  state,
-			Providers: map[string]ResourceProviderFactory{
-				"aws": testProviderFuncFixed(p),
-			},
-			Variables: map[string]interface{}{
-				"count": "1",
-			},
-		})
+	checkStateString(t, state, `
+aws_instance.web: (2 deposed)
+  ID = baz
+  Deposed ID 1 = foo
+  Deposed ID 2 = bar
+	`)
 
-		if _, err := ctx.Plan(); err != nil {
-			t.Fatalf("err: %s", err)
+	// Destroy partially fixed!
+	destroyFunc = func(is *InstanceState) (*InstanceState, error) {
+		if is.ID == "foo" || is.ID == "baz" {
+			return nil, nil
+		} else {
+			return is, fmt.Errorf("destroy partially failed")
 		}
+	}
 
-		state, err := ctx.Apply()
-		if err != nil {
-			t.Fatalf("err: %s", err)
-		}
+	createdInstanceId = "qux"
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	state, err = ctx.Apply()
+	// Expect error because 1/2 of Deposed destroys failed
+	if err == nil {
+		t.Fatal("should have error")
+	}
 
-		t.Logf("End state: %s", state.String())
+	// foo and baz are now gone, bar sticks around
+	checkStateString(t, state, `
+aws_instance.web: (1 deposed)
+  ID = qux
+  Deposed ID 1 = bar
+	`)
 
-		actual := state.RootModule().Outputs["output"]
-		if actual == nil {
-			t.Fatal("missing output")
-		}
+	// Destroy working fully!
+	destroyFunc = func(is *InstanceState) (*InstanceState, error) {
+		return nil, nil
+	}
 
-		expected := "bar0"
-		if actual.Value != expected {
-			t.Fatalf("bad: \n%s", actual)
-		}
+	createdInstanceId = "quux"
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	state, err = ctx.Apply()
+	if err != nil {
+		t.Fatal("should not have error:", err)
 	}
+
+	// And finally the state is clean
+	checkStateString(t, state, `
+aws_instance.web:
+  ID = quux
+	`)
 }
 
-// Test that multi-var (splat) access is ordered by count, not by
-// value.
-func TestContext2Apply_multiVarOrder(t *testing.T) {
-	m := testModule(t, "apply-multi-var-order")
+// Verify that a normal provisioner with on_failure "continue" set won't
+// taint the resource and continues executing.
+func TestContext2Apply_provisionerFailContinue(t *testing.T) {
+	m := testModule(t, "apply-provisioner-fail-continue")
 	p := testProvider("aws")
+	pr := testProvisioner()
 	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
 
-	// First, apply with a count of 3
+	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
+		return fmt.Errorf("provisioner error")
+	}
+
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
 	})
 
 	if _, err := ctx.Plan(); err != nil {
@@ -3223,29 +7113,46 @@ func TestContext2Apply_multiVarOrder(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
-	t.Logf("State: %s", state.String())
+	checkStateString(t, state, `
+aws_instance.foo:
+  ID = foo
+  foo = bar
+  type = aws_instance
+  `)
 
-	actual := state.RootModule().Outputs["should-be-11"]
-	expected := "index-11"
-	if actual == nil || actual.Value != expected {
-		t.Fatalf("bad: \n%s", actual)
+	// Verify apply was invoked
+	if !pr.ApplyCalled {
+		t.Fatalf("provisioner not invoked")
 	}
 }
 
-// Test that multi-var (splat) access is ordered by count, not by
-// value, through interpolations.
-func TestContext2Apply_multiVarOrderInterp(t *testing.T) {
-	m := testModule(t, "apply-multi-var-order-interp")
+// Verify that a provisioner with on_failure "continue" doesn't stop the
+// following provisioners, and that a later failing provisioner still
+// taints the resource.
+func TestContext2Apply_provisionerFailContinueMixed(t *testing.T) {
+	m := testModule(t, "apply-provisioner-fail-continue-mixed")
 	p := testProvider("aws")
+	pr := testProvisioner()
 	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
 
-	// First, apply with a count of 3
+	var l sync.Mutex
+	var calls []string
+	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
+		l.Lock()
+		defer l.Unlock()
+		calls = append(calls, c.Config["foo"].(string))
+		return fmt.Errorf("provisioner error")
+	}
+
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
 	})
 
 	if _, err := ctx.Plan(); err != nil {
@@ -3253,236 +7160,144 @@ func TestContext2Apply_multiVarOrderInterp(t *testing.T) {
 	}
 
 	state, err := ctx.Apply()
-	if err != nil {
-		t.Fatalf("err: %s", err)
+	if err == nil {
+		t.Fatal("should error")
 	}
 
-	t.Logf("State: %s", state.String())
+	checkStateString(t, state, `
+aws_instance.foo: (tainted)
+  ID = foo
+  foo = bar
+  type = aws_instance
+  `)
 
-	actual := state.RootModule().Outputs["should-be-11"]
-	expected := "baz-index-11"
-	if actual == nil || actual.Value != expected {
-		t.Fatalf("bad: \n%s", actual)
+	// The third provisioner never runs because the second one failed
+	expected := []string{"one", "two"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Fatalf("bad: %#v", calls)
 	}
 }
 
-// Based on GH-10440 where a graph edge wasn't properly being created
-// between a modified resource and a count instance being destroyed.
-func TestContext2Apply_multiVarCountDec(t *testing.T) {
-	var s *State
-
-	// First create resources. Nothing sneaky here.
-	{
-		m := testModule(t, "apply-multi-var-count-dec")
-		p := testProvider("aws")
-		p.ApplyFn = testApplyFn
-		p.DiffFn = testDiffFn
-		ctx := testContext2(t, &ContextOpts{
-			Module: m,
-			Providers: map[string]ResourceProviderFactory{
-				"aws": testProviderFuncFixed(p),
-			},
-			Variables: map[string]interface{}{
-				"count": "2",
-			},
-		})
-
-		if _, err := ctx.Plan(); err != nil {
-			t.Fatalf("err: %s", err)
-		}
-
-		state, err := ctx.Apply()
-		if err != nil {
-			t.Fatalf("err: %s", err)
-		}
-
-		t.Logf("Step 1 state: %s", state)
-
-		s = state
-	}
-
-	// Decrease the count by 1 and verify that everything happens in the
-	// right order.
-	{
-		m := testModule(t, "apply-multi-var-count-dec")
-		p := testProvider("aws")
-		p.ApplyFn = testApplyFn
-		p.DiffFn = testDiffFn
-
-		// Verify that aws_instance.bar is modified first and nothing
-		// else happens at the same time.
-		var checked bool
-		var called int32
-		var lock sync.Mutex
-		p.ApplyFn = func(
-			info *InstanceInfo,
-			is *InstanceState,
-			id *InstanceDiff) (*InstanceState, error) {
-			lock.Lock()
-			defer lock.Unlock()
-
-			if info.HumanId() == "aws_instance.bar" {
-				checked = true
-
-				// Sleep to allow parallel execution
-				time.Sleep(50 * time.Millisecond)
-
-				// Verify that called is 0 (dep not called)
-				if atomic.LoadInt32(&called) != 1 {
-					return nil, fmt.Errorf("nothing else should be called")
-				}
-			}
-
-			atomic.AddInt32(&called, 1)
-			return testApplyFn(info, is, id)
-		}
-
-		ctx := testContext2(t, &ContextOpts{
-			State:  s,
-			Module: m,
-			Providers: map[string]ResourceProviderFactory{
-				"aws": testProviderFuncFixed(p),
-			},
-			Variables: map[string]interface{}{
-				"count": "1",
-			},
-		})
-
-		if _, err := ctx.Plan(); err != nil {
-			t.Fatalf("err: %s", err)
-		}
-
-		state, err := ctx.Apply()
-		if err != nil {
-			t.Fatalf("err: %s", err)
-		}
+// Verify that every provisioner runs when they all continue on failure,
+// and that the resource isn't tainted.
+func TestContext2Apply_provisionerFailContinueAll(t *testing.T) {
+	m := testModule(t, "apply-provisioner-fail-continue-mixed")
+	p := testProvider("aws")
+	pr := testProvisioner()
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
 
-		if !checked {
-			t.Fatal("apply never called")
+	var l sync.Mutex
+	var calls []string
+	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
+		l.Lock()
+		defer l.Unlock()
+		v := c.Config["foo"].(string)
+		calls = append(calls, v)
+		if v == "one" {
+			return fmt.Errorf("provisioner error")
 		}
 
-		t.Logf("Step 2 state: %s", state)
-
-		s = state
+		return nil
 	}
-}
 
-func TestContext2Apply_nilDiff(t *testing.T) {
-	m := testModule(t, "apply-good")
-	p := testProvider("aws")
-	p.ApplyFn = testApplyFn
-	p.DiffFn = testDiffFn
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
 	})
 
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	p.DiffFn = func(*InstanceInfo, *InstanceState, *ResourceConfig) (*InstanceDiff, error) {
-		return nil, nil
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
 	}
 
-	if _, err := ctx.Apply(); err == nil {
-		t.Fatal("should error")
+	checkStateString(t, state, `
+aws_instance.foo:
+  ID = foo
+  foo = bar
+  type = aws_instance
+  `)
+
+	expected := []string{"one", "two", "three"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Fatalf("bad: %#v", calls)
 	}
 }
 
-func TestContext2Apply_outputDependsOn(t *testing.T) {
-	m := testModule(t, "apply-output-depends-on")
+// Verify that a normal provisioner with on_failure "continue" records
+// the error with the hook.
+func TestContext2Apply_provisionerFailContinueHook(t *testing.T) {
+	h := new(MockHook)
+	m := testModule(t, "apply-provisioner-fail-continue")
 	p := testProvider("aws")
+	pr := testProvisioner()
+	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
-
-	{
-		// Create a custom apply function that sleeps a bit (to allow parallel
-		// graph execution) and then returns an error to force a partial state
-		// return. We then verify the output is NOT there.
-		p.ApplyFn = func(
-			info *InstanceInfo,
-			is *InstanceState,
-			id *InstanceDiff) (*InstanceState, error) {
-
-			// Sleep to allow parallel execution
-			time.Sleep(50 * time.Millisecond)
-
-			// Return error to force partial state
-			return nil, fmt.Errorf("abcd")
-		}
-
-		ctx := testContext2(t, &ContextOpts{
-			Module: m,
-			Providers: map[string]ResourceProviderFactory{
-				"aws": testProviderFuncFixed(p),
-			},
-		})
-
-		if _, err := ctx.Plan(); err != nil {
-			t.Fatalf("err: %s", err)
-		}
-
-		state, err := ctx.Apply()
-		if err == nil || !strings.Contains(err.Error(), "abcd") {
-			t.Fatalf("err: %s", err)
-		}
-
-		checkStateString(t, state, `<no state>`)
+	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
+		return fmt.Errorf("provisioner error")
 	}
 
-	{
-		// Create the standard apply function and verify we get the output
-		p.ApplyFn = testApplyFn
-
-		ctx := testContext2(t, &ContextOpts{
-			Module: m,
-			Providers: map[string]ResourceProviderFactory{
-				"aws": testProviderFuncFixed(p),
-			},
-		})
-
-		if _, err := ctx.Plan(); err != nil {
-			t.Fatalf("err: %s", err)
-		}
-
-		state, err := ctx.Apply()
-		if err != nil {
-			t.Fatalf("err: %s", err)
-		}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Hooks:  []Hook{h},
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
+	})
 
-		checkStateString(t, state, `
-aws_instance.foo:
-  ID = foo
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
 
-Outputs:
+	if _, err := ctx.Apply(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
 
-value = result
-		`)
+	if !h.PostProvisionCalled {
+		t.Fatal("PostProvision not called")
+	}
+	if h.PostProvisionErrorArg == nil {
+		t.Fatal("should have error")
 	}
 }
 
-func TestContext2Apply_outputOrphan(t *testing.T) {
-	m := testModule(t, "apply-output-orphan")
+func TestContext2Apply_provisionerDestroy(t *testing.T) {
+	m := testModule(t, "apply-provisioner-destroy")
 	p := testProvider("aws")
+	pr := testProvisioner()
 	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
+	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
+		val, ok := c.Config["foo"]
+		if !ok || val != "destroy" {
+			t.Fatalf("bad value for foo: %v %#v", val, c)
+		}
+
+		return nil
+	}
 
 	state := &State{
 		Modules: []*ModuleState{
 			&ModuleState{
 				Path: rootModulePath,
-				Outputs: map[string]*OutputState{
-					"foo": &OutputState{
-						Type:      "string",
-						Sensitive: false,
-						Value:     "bar",
-					},
-					"bar": &OutputState{
-						Type:      "string",
-						Sensitive: false,
-						Value:     "baz",
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bar",
+						},
 					},
 				},
 			},
@@ -3490,11 +7305,15 @@ func TestContext2Apply_outputOrphan(t *testing.T) {
 	}
 
 	ctx := testContext2(t, &ContextOpts{
-		Module: m,
+		Module:  m,
+		State:   state,
+		Destroy: true,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
-		State: state,
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
 	})
 
 	if _, err := ctx.Plan(); err != nil {
@@ -3506,31 +7325,60 @@ func TestContext2Apply_outputOrphan(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyOutputOrphanStr)
-	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
+	checkStateString(t, state, `<no state>`)
+
+	// Verify apply was invoked
+	if !pr.ApplyCalled {
+		t.Fatalf("provisioner not invoked")
 	}
 }
 
-func TestContext2Apply_outputOrphanModule(t *testing.T) {
-	m := testModule(t, "apply-output-orphan-module")
+// A resource that is provisioned through a bastion host must be destroyed,
+// running its destroy-time provisioners, before the bastion is.
+func TestContext2Apply_provisionerDestroyConnInfo(t *testing.T) {
+	m := testModule(t, "apply-provisioner-destroy-conn-info")
 	p := testProvider("aws")
-	p.ApplyFn = testApplyFn
+	pr := testProvisioner()
 	p.DiffFn = testDiffFn
 
+	var l sync.Mutex
+	var order []string
+	p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
+		l.Lock()
+		defer l.Unlock()
+		order = append(order, "destroy "+info.Id)
+		return nil, nil
+	}
+	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
+		l.Lock()
+		defer l.Unlock()
+		order = append(order, "provision "+rs.ID)
+
+		if v := rs.Ephemeral.ConnInfo["bastion_host"]; v != "bastion" {
+			t.Errorf("bad bastion_host: %q", v)
+		}
+		return nil
+	}
+
 	state := &State{
 		Modules: []*ModuleState{
 			&ModuleState{
-				Path: []string{"root", "child"},
-				Outputs: map[string]*OutputState{
-					"foo": &OutputState{
-						Type:  "string",
-						Value: "bar",
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.bastion": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bastion",
+							Attributes: map[string]string{
+								"id": "bastion",
+							},
+						},
 					},
-					"bar": &OutputState{
-						Type:  "string",
-						Value: "baz",
+					"aws_instance.web": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "web",
+						},
 					},
 				},
 			},
@@ -3538,11 +7386,15 @@ func TestContext2Apply_outputOrphanModule(t *testing.T) {
 	}
 
 	ctx := testContext2(t, &ContextOpts{
-		Module: m,
+		Module:  m,
+		State:   state,
+		Destroy: true,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
-		State: state,
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
 	})
 
 	if _, err := ctx.Plan(); err != nil {
@@ -3554,97 +7406,114 @@ func TestContext2Apply_outputOrphanModule(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyOutputOrphanModuleStr)
-	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
+	checkStateString(t, state, `<no state>`)
+
+	expected := []string{
+		"provision web",
+		"destroy aws_instance.web",
+		"destroy aws_instance.bastion",
+	}
+	if !reflect.DeepEqual(order, expected) {
+		t.Fatalf("bad: %#v", order)
 	}
 }
 
-func TestContext2Apply_providerComputedVar(t *testing.T) {
-	m := testModule(t, "apply-provider-computed")
-	p := testProvider("aws")
-	p.ApplyFn = testApplyFn
-	p.DiffFn = testDiffFn
-
-	pTest := testProvider("test")
-	pTest.ApplyFn = testApplyFn
-	pTest.DiffFn = testDiffFn
-
-	ctx := testContext2(t, &ContextOpts{
-		Module: m,
-		Providers: map[string]ResourceProviderFactory{
-			"aws":  testProviderFuncFixed(p),
-			"test": testProviderFuncFixed(pTest),
-		},
-	})
-
-	p.ConfigureFn = func(c *ResourceConfig) error {
-		if c.IsComputed("value") {
-			return fmt.Errorf("value is computed")
-		}
-
-		v, ok := c.Get("value")
-		if !ok {
-			return fmt.Errorf("value is not found")
-		}
-		if v != "yes" {
-			return fmt.Errorf("value is not 'yes': %v", v)
-		}
-
-		return nil
+func TestContext2Apply_diffValuesEquivalent(t *testing.T) {
+	cases := map[string]struct {
+		Equivalent bool
+		Err        bool
+	}{
+		"strict":     {false, true},
+		"equivalent": {true, false},
 	}
 
-	if _, err := ctx.Plan(); err != nil {
-		t.Fatalf("err: %s", err)
-	}
+	for k, tc := range cases {
+		m := testModule(t, "apply-diff-values-equivalent")
+		p := testProvider("aws")
+		p.ApplyFn = testApplyFn
+		p.DiffValuesEquivalentReturn = tc.Equivalent
 
-	if _, err := ctx.Apply(); err != nil {
-		t.Fatalf("err: %s", err)
-	}
-}
+		// The provider folds the case of the name once it's applying, so
+		// the name that changed in the plan matches the state
+		var lock sync.Mutex
+		applying := false
+		p.DiffFn = func(
+			info *InstanceInfo,
+			s *InstanceState,
+			c *ResourceConfig) (*InstanceDiff, error) {
+			lock.Lock()
+			defer lock.Unlock()
 
-func TestContext2Apply_providerConfigureDisabled(t *testing.T) {
-	m := testModule(t, "apply-provider-configure-disabled")
-	p := testProvider("aws")
-	p.ApplyFn = testApplyFn
-	p.DiffFn = testDiffFn
+			diff := &InstanceDiff{Attributes: map[string]*ResourceAttrDiff{}}
+			for _, attr := range []string{"name", "value"} {
+				v, _ := c.Get(attr)
+				old := s.Attributes[attr]
+				if old == v.(string) || (applying && strings.EqualFold(old, v.(string))) {
+					continue
+				}
 
-	called := false
-	p.ConfigureFn = func(c *ResourceConfig) error {
-		called = true
+				diff.Attributes[attr] = &ResourceAttrDiff{Old: old, New: v.(string)}
+			}
 
-		if _, ok := c.Get("value"); !ok {
-			return fmt.Errorf("value is not found")
+			return diff, nil
 		}
 
-		return nil
-	}
-
-	ctx := testContext2(t, &ContextOpts{
-		Module: m,
-		Providers: map[string]ResourceProviderFactory{
-			"aws": testProviderFuncFixed(p),
-		},
-	})
+		ctx := testContext2(t, &ContextOpts{
+			Module: m,
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+			State: &State{
+				Modules: []*ModuleState{
+					&ModuleState{
+						Path: rootModulePath,
+						Resources: map[string]*ResourceState{
+							"aws_instance.foo": &ResourceState{
+								Type: "aws_instance",
+								Primary: &InstanceState{
+									ID: "bar",
+									Attributes: map[string]string{
+										"name":  "foo",
+										"value": "foo",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		})
 
-	if _, err := ctx.Plan(); err != nil {
-		t.Fatalf("err: %s", err)
-	}
+		if _, err := ctx.Plan(); err != nil {
+			t.Fatalf("%s: err: %s", k, err)
+		}
 
-	if _, err := ctx.Apply(); err != nil {
-		t.Fatalf("err: %s", err)
-	}
+		lock.Lock()
+		applying = true
+		lock.Unlock()
 
-	if !called {
-		t.Fatal("configure never called")
+		_, err := ctx.Apply()
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s: err: %v", k, err)
+		}
+		if err != nil && !strings.Contains(err.Error(), "attribute mismatch: name") {
+			t.Fatalf("%s: bad error: %s", k, err)
+		}
+		if !p.DiffValuesEquivalentCalled {
+			t.Fatalf("%s: DiffValuesEquivalent should be called", k)
+		}
+		if p.DiffValuesEquivalentOld != "Foo" || p.DiffValuesEquivalentNew != "foo" {
+			t.Fatalf("%s: bad values: %q, %q",
+				k, p.DiffValuesEquivalentOld, p.DiffValuesEquivalentNew)
+		}
 	}
 }
 
-func TestContext2Apply_provisionerModule(t *testing.T) {
-	m := testModule(t, "apply-provisioner-module")
+// Values that change every time they're interpolated, such as a UUID,
+// don't have to match between plan and apply.
+func TestContext2Apply_diffValuesUuid(t *testing.T) {
+	m := testModule(t, "apply-diff-values-uuid")
 	p := testProvider("aws")
-	pr := testProvisioner()
 	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
 	ctx := testContext2(t, &ContextOpts{
@@ -3652,9 +7521,6 @@ func TestContext2Apply_provisionerModule(t *testing.T) {
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
-		Provisioners: map[string]ResourceProvisionerFactory{
-			"shell": testProvisionerFuncFixed(pr),
-		},
 	})
 
 	if _, err := ctx.Plan(); err != nil {
@@ -3666,32 +7532,19 @@ func TestContext2Apply_provisionerModule(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyProvisionerModuleStr)
-	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
-	}
-
-	// Verify apply was invoked
-	if !pr.ApplyCalled {
-		t.Fatalf("provisioner not invoked")
+	rs := state.RootModule().Resources["aws_instance.foo"]
+	if rs == nil || rs.Primary.Attributes["value"] == "" {
+		t.Fatalf("bad: %s", state)
 	}
 }
 
-func TestContext2Apply_Provisioner_compute(t *testing.T) {
-	m := testModule(t, "apply-provisioner-compute")
+func TestContext2Apply_provisionerSkip(t *testing.T) {
+	m := testModule(t, "apply-provisioner-resource-ref")
 	p := testProvider("aws")
 	pr := testProvisioner()
 	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
-	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
-		val, ok := c.Config["foo"]
-		if !ok || val != "computed_dynamical" {
-			t.Fatalf("bad value for foo: %v %#v", val, c)
-		}
 
-		return nil
-	}
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
@@ -3700,9 +7553,7 @@ func TestContext2Apply_Provisioner_compute(t *testing.T) {
 		Provisioners: map[string]ResourceProvisionerFactory{
 			"shell": testProvisionerFuncFixed(pr),
 		},
-		Variables: map[string]interface{}{
-			"value": "1",
-		},
+		SkipProvisioners: true,
 	})
 
 	if _, err := ctx.Plan(); err != nil {
@@ -3714,73 +7565,119 @@ func TestContext2Apply_Provisioner_compute(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
+	// The resource is applied and not tainted
 	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyProvisionerStr)
+	expected := strings.TrimSpace(testTerraformApplyProvisionerResourceRefStr)
 	if actual != expected {
 		t.Fatalf("bad: \n%s", actual)
 	}
 
-	// Verify apply was invoked
-	if !pr.ApplyCalled {
-		t.Fatalf("provisioner not invoked")
+	if pr.ApplyCalled {
+		t.Fatal("provisioner should not be invoked")
 	}
 }
 
-func TestContext2Apply_provisionerCreateFail(t *testing.T) {
-	m := testModule(t, "apply-provisioner-fail-create")
-	p := testProvider("aws")
-	pr := testProvisioner()
-	p.DiffFn = testDiffFn
-
-	p.ApplyFn = func(
-		info *InstanceInfo,
-		is *InstanceState,
-		id *InstanceDiff) (*InstanceState, error) {
-		is.ID = "foo"
-		return is, fmt.Errorf("error")
+func TestContext2Apply_provisionerDestroySkip(t *testing.T) {
+	cases := map[string]struct {
+		SkipProvisioners        bool
+		SkipDestroyProvisioners bool
+		Called                  bool
+	}{
+		"skip destroy":     {false, true, false},
+		"skip create only": {true, false, true},
+		"skip both":        {true, true, false},
+		"skip none":        {false, false, true},
 	}
 
-	ctx := testContext2(t, &ContextOpts{
-		Module: m,
-		Providers: map[string]ResourceProviderFactory{
-			"aws": testProviderFuncFixed(p),
-		},
-		Provisioners: map[string]ResourceProvisionerFactory{
-			"shell": testProvisionerFuncFixed(pr),
-		},
-	})
+	for k, tc := range cases {
+		m := testModule(t, "apply-provisioner-destroy")
+		p := testProvider("aws")
+		pr := testProvisioner()
+		p.ApplyFn = testApplyFn
+		p.DiffFn = testDiffFn
 
-	if _, err := ctx.Plan(); err != nil {
-		t.Fatalf("err: %s", err)
-	}
+		state := &State{
+			Modules: []*ModuleState{
+				&ModuleState{
+					Path: rootModulePath,
+					Resources: map[string]*ResourceState{
+						"aws_instance.foo": &ResourceState{
+							Type: "aws_instance",
+							Primary: &InstanceState{
+								ID: "bar",
+							},
+						},
+					},
+				},
+			},
+		}
 
-	state, err := ctx.Apply()
-	if err == nil {
-		t.Fatal("should error")
-	}
+		ctx := testContext2(t, &ContextOpts{
+			Module:  m,
+			State:   state,
+			Destroy: true,
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+			Provisioners: map[string]ResourceProvisionerFactory{
+				"shell": testProvisionerFuncFixed(pr),
+			},
+			SkipProvisioners:        tc.SkipProvisioners,
+			SkipDestroyProvisioners: tc.SkipDestroyProvisioners,
+		})
 
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyProvisionerFailCreateStr)
-	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
+		if _, err := ctx.Plan(); err != nil {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+
+		state, err := ctx.Apply()
+		if err != nil {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+
+		// The resource is destroyed either way
+		actual := strings.TrimSpace(state.String())
+		if actual != "<no state>" {
+			t.Fatalf("%s: bad: \n%s", k, actual)
+		}
+
+		if pr.ApplyCalled != tc.Called {
+			t.Fatalf("%s: bad: %#v", k, pr.ApplyCalled)
+		}
 	}
 }
 
-func TestContext2Apply_provisionerCreateFailNoId(t *testing.T) {
-	m := testModule(t, "apply-provisioner-fail-create")
+// Verify that on destroy provisioner failure, nothing happens to the instance
+func TestContext2Apply_provisionerDestroyFail(t *testing.T) {
+	m := testModule(t, "apply-provisioner-destroy")
 	p := testProvider("aws")
 	pr := testProvisioner()
+	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
+	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
+		return fmt.Errorf("provisioner error")
+	}
 
-	p.ApplyFn = func(
-		info *InstanceInfo,
-		is *InstanceState,
-		id *InstanceDiff) (*InstanceState, error) {
-		return nil, fmt.Errorf("error")
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bar",
+						},
+					},
+				},
+			},
+		},
 	}
 
 	ctx := testContext2(t, &ContextOpts{
-		Module: m,
+		Module:  m,
+		State:   state,
+		Destroy: true,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
@@ -3798,35 +7695,63 @@ func TestContext2Apply_provisionerCreateFailNoId(t *testing.T) {
 		t.Fatal("should error")
 	}
 
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyProvisionerFailCreateNoIdStr)
-	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
+	checkStateString(t, state, `
+aws_instance.foo:
+  ID = bar
+	`)
+
+	// Verify apply was invoked
+	if !pr.ApplyCalled {
+		t.Fatalf("provisioner not invoked")
 	}
 }
 
-func TestContext2Apply_provisionerFail(t *testing.T) {
-	m := testModule(t, "apply-provisioner-fail")
+// Verify that on destroy provisioner failure with "continue" that
+// we continue to the next provisioner.
+func TestContext2Apply_provisionerDestroyFailContinue(t *testing.T) {
+	m := testModule(t, "apply-provisioner-destroy-continue")
 	p := testProvider("aws")
 	pr := testProvisioner()
 	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
 
-	pr.ApplyFn = func(*InstanceState, *ResourceConfig) error {
-		return fmt.Errorf("EXPLOSION")
+	var calls []string
+	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
+		val, ok := c.Config["foo"]
+		if !ok {
+			t.Fatalf("bad value for foo: %v %#v", val, c)
+		}
+
+		calls = append(calls, val.(string))
+		return fmt.Errorf("provisioner error")
+	}
+
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bar",
+						},
+					},
+				},
+			},
+		},
 	}
 
 	ctx := testContext2(t, &ContextOpts{
-		Module: m,
+		Module:  m,
+		State:   state,
+		Destroy: true,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
 		Provisioners: map[string]ResourceProvisionerFactory{
 			"shell": testProvisionerFuncFixed(pr),
 		},
-		Variables: map[string]interface{}{
-			"value": "1",
-		},
 	})
 
 	if _, err := ctx.Plan(); err != nil {
@@ -3834,25 +7759,42 @@ func TestContext2Apply_provisionerFail(t *testing.T) {
 	}
 
 	state, err := ctx.Apply()
-	if err == nil {
-		t.Fatal("should error")
+	if err != nil {
+		t.Fatalf("err: %s", err)
 	}
 
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyProvisionerFailStr)
-	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
+	checkStateString(t, state, `<no state>`)
+
+	// Verify apply was invoked
+	if !pr.ApplyCalled {
+		t.Fatalf("provisioner not invoked")
+	}
+
+	expected := []string{"one", "two"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Fatalf("bad: %#v", calls)
 	}
 }
 
-func TestContext2Apply_provisionerFail_createBeforeDestroy(t *testing.T) {
-	m := testModule(t, "apply-provisioner-fail-create-before")
+// Verify that on destroy provisioner failure with "continue" that
+// we continue to the next provisioner. But if the next provisioner defines
+// to fail, then we fail after running it.
+func TestContext2Apply_provisionerDestroyFailContinueFail(t *testing.T) {
+	m := testModule(t, "apply-provisioner-destroy-fail")
 	p := testProvider("aws")
 	pr := testProvisioner()
 	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
-	pr.ApplyFn = func(*InstanceState, *ResourceConfig) error {
-		return fmt.Errorf("EXPLOSION")
+
+	var calls []string
+	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
+		val, ok := c.Config["foo"]
+		if !ok {
+			t.Fatalf("bad value for foo: %v %#v", val, c)
+		}
+
+		calls = append(calls, val.(string))
+		return fmt.Errorf("provisioner error")
 	}
 
 	state := &State{
@@ -3860,28 +7802,27 @@ func TestContext2Apply_provisionerFail_createBeforeDestroy(t *testing.T) {
 			&ModuleState{
 				Path: rootModulePath,
 				Resources: map[string]*ResourceState{
-					"aws_instance.bar": &ResourceState{
+					"aws_instance.foo": &ResourceState{
 						Type: "aws_instance",
 						Primary: &InstanceState{
 							ID: "bar",
-							Attributes: map[string]string{
-								"require_new": "abc",
-							},
 						},
 					},
 				},
 			},
 		},
 	}
+
 	ctx := testContext2(t, &ContextOpts{
-		Module: m,
+		Module:  m,
+		State:   state,
+		Destroy: true,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
 		Provisioners: map[string]ResourceProvisionerFactory{
 			"shell": testProvisionerFuncFixed(pr),
 		},
-		State: state,
 	})
 
 	if _, err := ctx.Plan(); err != nil {
@@ -3893,261 +7834,355 @@ func TestContext2Apply_provisionerFail_createBeforeDestroy(t *testing.T) {
 		t.Fatal("should error")
 	}
 
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyProvisionerFailCreateBeforeDestroyStr)
-	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
+	checkStateString(t, state, `
+aws_instance.foo:
+  ID = bar
+  `)
+
+	// Verify apply was invoked
+	if !pr.ApplyCalled {
+		t.Fatalf("provisioner not invoked")
+	}
+
+	expected := []string{"one", "two"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Fatalf("bad: %#v", calls)
 	}
 }
 
-func TestContext2Apply_error_createBeforeDestroy(t *testing.T) {
-	m := testModule(t, "apply-error-create-before")
+// Verify that destroy provisioners run before the resource is deleted
+func TestContext2Apply_provisionerDestroyOrder(t *testing.T) {
+	m := testModule(t, "apply-provisioner-destroy")
 	p := testProvider("aws")
+	pr := testProvisioner()
+	p.DiffFn = testDiffFn
+
+	var l sync.Mutex
+	var calls []string
+	p.ApplyFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		d *InstanceDiff) (*InstanceState, error) {
+		l.Lock()
+		defer l.Unlock()
+		calls = append(calls, "apply")
+		return testApplyFn(info, s, d)
+	}
+	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
+		l.Lock()
+		defer l.Unlock()
+		if rs.ID != "bar" {
+			t.Errorf("provisioner should see the existing instance: %#v", rs)
+		}
+		calls = append(calls, "provision "+c.Config["foo"].(string))
+		return nil
+	}
+
 	state := &State{
 		Modules: []*ModuleState{
 			&ModuleState{
 				Path: rootModulePath,
 				Resources: map[string]*ResourceState{
-					"aws_instance.bar": &ResourceState{
+					"aws_instance.foo": &ResourceState{
 						Type: "aws_instance",
 						Primary: &InstanceState{
 							ID: "bar",
-							Attributes: map[string]string{
-								"require_new": "abc",
-							},
 						},
 					},
 				},
 			},
 		},
 	}
+
 	ctx := testContext2(t, &ContextOpts{
-		Module: m,
+		Module:  m,
+		State:   state,
+		Destroy: true,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
-		State: state,
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
 	})
-	p.ApplyFn = func(info *InstanceInfo, is *InstanceState, id *InstanceDiff) (*InstanceState, error) {
-		return nil, fmt.Errorf("error")
-	}
-	p.DiffFn = testDiffFn
 
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
 	state, err := ctx.Apply()
-	if err == nil {
-		t.Fatal("should have error")
+	if err != nil {
+		t.Fatalf("err: %s", err)
 	}
 
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyErrorCreateBeforeDestroyStr)
-	if actual != expected {
-		t.Fatalf("bad: \n%s\n\nExpected:\n\n%s", actual, expected)
+	checkStateString(t, state, `<no state>`)
+
+	expected := []string{"provision destroy", "apply"}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Fatalf("bad: %#v", calls)
 	}
 }
 
-func TestContext2Apply_errorDestroy_createBeforeDestroy(t *testing.T) {
-	m := testModule(t, "apply-error-create-before")
+// Verify destroy provisioners are not run for tainted instances.
+func TestContext2Apply_provisionerDestroyTainted(t *testing.T) {
+	m := testModule(t, "apply-provisioner-destroy")
 	p := testProvider("aws")
+	pr := testProvisioner()
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+
+	destroyCalled := false
+	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
+		expected := "create"
+		if rs.ID == "bar" {
+			destroyCalled = true
+			return nil
+		}
+
+		val, ok := c.Config["foo"]
+		if !ok || val != expected {
+			t.Fatalf("bad value for foo: %v %#v", val, c)
+		}
+
+		return nil
+	}
+
 	state := &State{
 		Modules: []*ModuleState{
 			&ModuleState{
 				Path: rootModulePath,
 				Resources: map[string]*ResourceState{
-					"aws_instance.bar": &ResourceState{
+					"aws_instance.foo": &ResourceState{
 						Type: "aws_instance",
 						Primary: &InstanceState{
-							ID: "bar",
-							Attributes: map[string]string{
-								"require_new": "abc",
-							},
+							ID:      "bar",
+							Tainted: true,
 						},
 					},
 				},
 			},
 		},
 	}
+
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
+		State:  state,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
-		State: state,
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
 	})
-	p.ApplyFn = func(info *InstanceInfo, is *InstanceState, id *InstanceDiff) (*InstanceState, error) {
-		// Fail the destroy!
-		if id.Destroy {
-			return is, fmt.Errorf("error")
-		}
-
-		// Create should work
-		is = &InstanceState{
-			ID: "foo",
-		}
-		return is, nil
-	}
-	p.DiffFn = testDiffFn
 
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
 	state, err := ctx.Apply()
-	if err == nil {
-		t.Fatal("should have error")
+	if err != nil {
+		t.Fatalf("err: %s", err)
 	}
 
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyErrorDestroyCreateBeforeDestroyStr)
-	if actual != expected {
-		t.Fatalf("bad: actual:\n%s\n\nexpected:\n%s", actual, expected)
-	}
-}
+	checkStateString(t, state, `
+aws_instance.foo:
+  ID = foo
+  foo = bar
+  type = aws_instance
+	`)
 
-func TestContext2Apply_multiDepose_createBeforeDestroy(t *testing.T) {
-	m := testModule(t, "apply-multi-depose-create-before-destroy")
-	p := testProvider("aws")
-	p.DiffFn = testDiffFn
-	ps := map[string]ResourceProviderFactory{"aws": testProviderFuncFixed(p)}
-	state := &State{
-		Modules: []*ModuleState{
-			&ModuleState{
-				Path: rootModulePath,
-				Resources: map[string]*ResourceState{
-					"aws_instance.web": &ResourceState{
-						Type:    "aws_instance",
-						Primary: &InstanceState{ID: "foo"},
-					},
-				},
-			},
-		},
+	// Verify apply was invoked
+	if !pr.ApplyCalled {
+		t.Fatalf("provisioner not invoked")
 	}
 
-	ctx := testContext2(t, &ContextOpts{
-		Module:    m,
-		Providers: ps,
-		State:     state,
-	})
-	createdInstanceId := "bar"
-	// Create works
-	createFunc := func(is *InstanceState) (*InstanceState, error) {
-		return &InstanceState{ID: createdInstanceId}, nil
+	if destroyCalled {
+		t.Fatal("destroy should not be called")
 	}
-	// Destroy starts broken
-	destroyFunc := func(is *InstanceState) (*InstanceState, error) {
-		return is, fmt.Errorf("destroy failed")
+}
+
+func TestContext2Apply_provisionerParallel(t *testing.T) {
+	cases := map[string]struct {
+		Fixture     string
+		Concurrency int32
+	}{
+		"sequential": {"apply-provisioner-sequential", 1},
+		"parallel":   {"apply-provisioner-parallel", 2},
 	}
-	p.ApplyFn = func(info *InstanceInfo, is *InstanceState, id *InstanceDiff) (*InstanceState, error) {
-		if id.Destroy {
-			return destroyFunc(is)
-		} else {
-			return createFunc(is)
+
+	const delay = 100 * time.Millisecond
+
+	for k, tc := range cases {
+		m := testModule(t, tc.Fixture)
+		p := testProvider("aws")
+		pr := testProvisioner()
+		p.ApplyFn = testApplyFn
+		p.DiffFn = testDiffFn
+
+		var l sync.Mutex
+		var running, maxRunning int32
+		var order []string
+		hosts := make(map[string]string)
+		pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
+			n := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+
+			cmd, _ := c.Config["command"].(string)
+
+			l.Lock()
+			if n > maxRunning {
+				maxRunning = n
+			}
+			order = append(order, cmd)
+			hosts[cmd] = rs.Ephemeral.ConnInfo["host"]
+			l.Unlock()
+
+			time.Sleep(delay)
+			return nil
 		}
-	}
 
-	if _, err := ctx.Plan(); err != nil {
-		t.Fatalf("err: %s", err)
-	}
+		ctx := testContext2(t, &ContextOpts{
+			Module: m,
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+			Provisioners: map[string]ResourceProvisionerFactory{
+				"shell": testProvisionerFuncFixed(pr),
+			},
+		})
 
-	// Destroy is broken, so even though CBD successfully replaces the instance,
-	// we'll have to save the Deposed instance to destroy later
-	state, err := ctx.Apply()
-	if err == nil {
-		t.Fatal("should have error")
+		if _, err := ctx.Plan(); err != nil {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+
+		start := time.Now()
+		if _, err := ctx.Apply(); err != nil {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+		elapsed := time.Since(start)
+
+		if maxRunning != tc.Concurrency {
+			t.Fatalf("%s: bad concurrency: %d", k, maxRunning)
+		}
+		if tc.Concurrency == 1 {
+			if elapsed < 2*delay {
+				t.Fatalf("%s: provisioners should run one at a time: %s", k, elapsed)
+			}
+			if !reflect.DeepEqual(order, []string{"one", "two"}) {
+				t.Fatalf("%s: bad order: %#v", k, order)
+			}
+		}
+
+		// Each provisioner must see its own connection info
+		expected := map[string]string{"one": "foo", "two": "two"}
+		if !reflect.DeepEqual(hosts, expected) {
+			t.Fatalf("%s: bad hosts: %#v", k, hosts)
+		}
 	}
+}
 
-	checkStateString(t, state, `
-aws_instance.web: (1 deposed)
-  ID = bar
-  Deposed ID 1 = foo
-	`)
+func TestContext2Apply_provisionerParallelFail(t *testing.T) {
+	m := testModule(t, "apply-provisioner-parallel")
+	p := testProvider("aws")
+	pr := testProvisioner()
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
 
-	createdInstanceId = "baz"
-	ctx = testContext2(t, &ContextOpts{
-		Module:    m,
-		Providers: ps,
-		State:     state,
+	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
+		return fmt.Errorf("EXPLOSION %s", c.Config["command"])
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
 	})
 
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	// We're replacing the primary instance once again. Destroy is _still_
-	// broken, so the Deposed list gets longer
-	state, err = ctx.Apply()
+	state, err := ctx.Apply()
 	if err == nil {
-		t.Fatal("should have error")
+		t.Fatal("should error")
 	}
 
-	checkStateString(t, state, `
-aws_instance.web: (2 deposed)
-  ID = baz
-  Deposed ID 1 = foo
-  Deposed ID 2 = bar
-	`)
-
-	// Destroy partially fixed!
-	destroyFunc = func(is *InstanceState) (*InstanceState, error) {
-		if is.ID == "foo" || is.ID == "baz" {
-			return nil, nil
-		} else {
-			return is, fmt.Errorf("destroy partially failed")
+	// The errors of all the provisioners are returned
+	for _, v := range []string{"EXPLOSION one", "EXPLOSION two"} {
+		if !strings.Contains(err.Error(), v) {
+			t.Fatalf("expected %q in error: %s", v, err)
 		}
 	}
 
-	createdInstanceId = "qux"
-	if _, err := ctx.Plan(); err != nil {
-		t.Fatalf("err: %s", err)
-	}
-	state, err = ctx.Apply()
-	// Expect error because 1/2 of Deposed destroys failed
-	if err == nil {
-		t.Fatal("should have error")
+	rs := state.RootModule().Resources["aws_instance.foo"]
+	if rs == nil || rs.Primary == nil || !rs.Primary.Tainted {
+		t.Fatalf("resource should be tainted: %#v", rs)
 	}
+}
 
-	// foo and baz are now gone, bar sticks around
-	checkStateString(t, state, `
-aws_instance.web: (1 deposed)
-  ID = qux
-  Deposed ID 1 = bar
-	`)
+func TestContext2Apply_provisionerResourceRef(t *testing.T) {
+	m := testModule(t, "apply-provisioner-resource-ref")
+	p := testProvider("aws")
+	pr := testProvisioner()
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
+		val, ok := c.Config["foo"]
+		if !ok || val != "2" {
+			t.Fatalf("bad value for foo: %v %#v", val, c)
+		}
 
-	// Destroy working fully!
-	destroyFunc = func(is *InstanceState) (*InstanceState, error) {
-		return nil, nil
+		return nil
 	}
 
-	createdInstanceId = "quux"
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
+	})
+
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
-	state, err = ctx.Apply()
+
+	state, err := ctx.Apply()
 	if err != nil {
-		t.Fatal("should not have error:", err)
+		t.Fatalf("err: %s", err)
 	}
 
-	// And finally the state is clean
-	checkStateString(t, state, `
-aws_instance.web:
-  ID = quux
-	`)
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyProvisionerResourceRefStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+
+	// Verify apply was invoked
+	if !pr.ApplyCalled {
+		t.Fatalf("provisioner not invoked")
+	}
 }
 
-// Verify that a normal provisioner with on_failure "continue" set won't
-// taint the resource and continues executing.
-func TestContext2Apply_provisionerFailContinue(t *testing.T) {
-	m := testModule(t, "apply-provisioner-fail-continue")
+func TestContext2Apply_provisionerSelfRef(t *testing.T) {
+	m := testModule(t, "apply-provisioner-self-ref")
 	p := testProvider("aws")
 	pr := testProvisioner()
 	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
-
 	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
-		return fmt.Errorf("provisioner error")
+		val, ok := c.Config["command"]
+		if !ok || val != "bar" {
+			t.Fatalf("bad value for command: %v %#v", val, c)
+		}
+
+		return nil
 	}
 
 	ctx := testContext2(t, &ContextOpts{
@@ -4169,12 +8204,11 @@ func TestContext2Apply_provisionerFailContinue(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
-	checkStateString(t, state, `
-aws_instance.foo:
-  ID = foo
-  foo = bar
-  type = aws_instance
-  `)
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyProvisionerSelfRefStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
 
 	// Verify apply was invoked
 	if !pr.ApplyCalled {
@@ -4182,22 +8216,37 @@ aws_instance.foo:
 	}
 }
 
-// Verify that a normal provisioner with on_failure "continue" records
-// the error with the hook.
-func TestContext2Apply_provisionerFailContinueHook(t *testing.T) {
-	h := new(MockHook)
-	m := testModule(t, "apply-provisioner-fail-continue")
+func TestContext2Apply_provisionerSelfRefComputed(t *testing.T) {
+	m := testModule(t, "apply-provisioner-self-computed")
 	p := testProvider("aws")
 	pr := testProvisioner()
-	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
+	p.ApplyFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		d *InstanceDiff) (*InstanceState, error) {
+		return &InstanceState{
+			ID: "i-abc123",
+			Attributes: map[string]string{
+				"id":      "i-abc123",
+				"compute": "ip",
+				"ip":      "10.0.0.1",
+			},
+		}, nil
+	}
 	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
-		return fmt.Errorf("provisioner error")
+		if val := c.Config["command"]; val != "i-abc123" {
+			t.Errorf("bad value for command: %#v", val)
+		}
+		if val := c.Config["ip"]; val != "10.0.0.1" {
+			t.Errorf("bad value for ip: %#v", val)
+		}
+
+		return nil
 	}
 
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
-		Hooks:  []Hook{h},
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
@@ -4214,49 +8263,141 @@ func TestContext2Apply_provisionerFailContinueHook(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
-	if !h.PostProvisionCalled {
-		t.Fatal("PostProvision not called")
+	if !pr.ApplyCalled {
+		t.Fatalf("provisioner not invoked")
 	}
-	if h.PostProvisionErrorArg == nil {
-		t.Fatal("should have error")
+}
+
+func TestContext2Apply_provisionerSelfRefUnknown(t *testing.T) {
+	m := testModule(t, "apply-provisioner-self-computed")
+	p := testProvider("aws")
+	pr := testProvisioner()
+	p.DiffFn = testDiffFn
+	p.ApplyFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		d *InstanceDiff) (*InstanceState, error) {
+		// A buggy provider that never sets the computed attribute
+		return &InstanceState{
+			ID: "i-abc123",
+			Attributes: map[string]string{
+				"id":      "i-abc123",
+				"compute": "ip",
+			},
+		}, nil
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	_, err := ctx.Apply()
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), `"ip" is still unknown`) {
+		t.Fatalf("err should name the attribute: %s", err)
+	}
+
+	if pr.ApplyCalled {
+		t.Fatalf("provisioner should not be invoked")
 	}
 }
 
-func TestContext2Apply_provisionerDestroy(t *testing.T) {
-	m := testModule(t, "apply-provisioner-destroy")
+func TestContext2Apply_provisionerMultiSelfRef(t *testing.T) {
+	var lock sync.Mutex
+	commands := make([]string, 0, 5)
+
+	m := testModule(t, "apply-provisioner-multi-self-ref")
 	p := testProvider("aws")
 	pr := testProvisioner()
 	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
 	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
-		val, ok := c.Config["foo"]
-		if !ok || val != "destroy" {
-			t.Fatalf("bad value for foo: %v %#v", val, c)
+		lock.Lock()
+		defer lock.Unlock()
+
+		val, ok := c.Config["command"]
+		if !ok {
+			t.Fatalf("bad value for command: %v %#v", val, c)
 		}
 
+		commands = append(commands, val.(string))
 		return nil
 	}
 
-	state := &State{
-		Modules: []*ModuleState{
-			&ModuleState{
-				Path: rootModulePath,
-				Resources: map[string]*ResourceState{
-					"aws_instance.foo": &ResourceState{
-						Type: "aws_instance",
-						Primary: &InstanceState{
-							ID: "bar",
-						},
-					},
-				},
-			},
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
 		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyProvisionerMultiSelfRefStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
+
+	// Verify apply was invoked
+	if !pr.ApplyCalled {
+		t.Fatalf("provisioner not invoked")
+	}
+
+	// Verify our result
+	sort.Strings(commands)
+	expectedCommands := []string{"number 0", "number 1", "number 2"}
+	if !reflect.DeepEqual(commands, expectedCommands) {
+		t.Fatalf("bad: %#v", commands)
+	}
+}
+
+func TestContext2Apply_provisionerMultiSelfRefSingle(t *testing.T) {
+	var lock sync.Mutex
+	order := make([]string, 0, 5)
+
+	m := testModule(t, "apply-provisioner-multi-self-ref-single")
+	p := testProvider("aws")
+	pr := testProvisioner()
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
+		lock.Lock()
+		defer lock.Unlock()
+
+		val, ok := c.Config["order"]
+		if !ok {
+			t.Fatalf("bad value for order: %v %#v", val, c)
+		}
+
+		order = append(order, val.(string))
+		return nil
 	}
 
 	ctx := testContext2(t, &ContextOpts{
-		Module:  m,
-		State:   state,
-		Destroy: true,
+		Module: m,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
@@ -4274,45 +8415,49 @@ func TestContext2Apply_provisionerDestroy(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
-	checkStateString(t, state, `<no state>`)
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyProvisionerMultiSelfRefSingleStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
 
 	// Verify apply was invoked
 	if !pr.ApplyCalled {
 		t.Fatalf("provisioner not invoked")
 	}
+
+	// Verify our result
+	sort.Strings(order)
+	expectedOrder := []string{"0", "1", "2"}
+	if !reflect.DeepEqual(order, expectedOrder) {
+		t.Fatalf("bad: %#v", order)
+	}
 }
 
-// Verify that on destroy provisioner failure, nothing happens to the instance
-func TestContext2Apply_provisionerDestroyFail(t *testing.T) {
-	m := testModule(t, "apply-provisioner-destroy")
+func TestContext2Apply_provisionerMultiSelfRefCount(t *testing.T) {
+	var lock sync.Mutex
+	commands := make([]string, 0, 5)
+
+	m := testModule(t, "apply-provisioner-multi-self-ref-count")
 	p := testProvider("aws")
 	pr := testProvisioner()
 	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
 	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
-		return fmt.Errorf("provisioner error")
-	}
+		lock.Lock()
+		defer lock.Unlock()
 
-	state := &State{
-		Modules: []*ModuleState{
-			&ModuleState{
-				Path: rootModulePath,
-				Resources: map[string]*ResourceState{
-					"aws_instance.foo": &ResourceState{
-						Type: "aws_instance",
-						Primary: &InstanceState{
-							ID: "bar",
-						},
-					},
-				},
-			},
-		},
+		val, ok := c.Config["command"]
+		if !ok {
+			t.Fatalf("bad value for command: %v %#v", val, c)
+		}
+
+		commands = append(commands, val.(string))
+		return nil
 	}
 
 	ctx := testContext2(t, &ContextOpts{
-		Module:  m,
-		State:   state,
-		Destroy: true,
+		Module: m,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
@@ -4325,133 +8470,105 @@ func TestContext2Apply_provisionerDestroyFail(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
-	state, err := ctx.Apply()
-	if err == nil {
-		t.Fatal("should error")
+	if _, err := ctx.Apply(); err != nil {
+		t.Fatalf("err: %s", err)
 	}
 
-	checkStateString(t, state, `
-aws_instance.foo:
-  ID = bar
-	`)
-
 	// Verify apply was invoked
 	if !pr.ApplyCalled {
 		t.Fatalf("provisioner not invoked")
 	}
+
+	// Verify our result
+	sort.Strings(commands)
+	expectedCommands := []string{"3", "3", "3"}
+	if !reflect.DeepEqual(commands, expectedCommands) {
+		t.Fatalf("bad: %#v", commands)
+	}
 }
 
-// Verify that on destroy provisioner failure with "continue" that
-// we continue to the next provisioner.
-func TestContext2Apply_provisionerDestroyFailContinue(t *testing.T) {
-	m := testModule(t, "apply-provisioner-destroy-continue")
+func TestContext2Apply_provisionerExplicitSelfRef(t *testing.T) {
+	m := testModule(t, "apply-provisioner-explicit-self-ref")
 	p := testProvider("aws")
 	pr := testProvisioner()
 	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
-
-	var calls []string
 	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
-		val, ok := c.Config["foo"]
-		if !ok {
-			t.Fatalf("bad value for foo: %v %#v", val, c)
+		val, ok := c.Config["command"]
+		if !ok || val != "bar" {
+			t.Fatalf("bad value for command: %v %#v", val, c)
 		}
 
-		calls = append(calls, val.(string))
-		return fmt.Errorf("provisioner error")
+		return nil
 	}
 
-	state := &State{
-		Modules: []*ModuleState{
-			&ModuleState{
-				Path: rootModulePath,
-				Resources: map[string]*ResourceState{
-					"aws_instance.foo": &ResourceState{
-						Type: "aws_instance",
-						Primary: &InstanceState{
-							ID: "bar",
-						},
-					},
-				},
+	var state *State
+	{
+		ctx := testContext2(t, &ContextOpts{
+			Module: m,
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
 			},
-		},
-	}
+			Provisioners: map[string]ResourceProvisionerFactory{
+				"shell": testProvisionerFuncFixed(pr),
+			},
+		})
 
-	ctx := testContext2(t, &ContextOpts{
-		Module:  m,
-		State:   state,
-		Destroy: true,
-		Providers: map[string]ResourceProviderFactory{
-			"aws": testProviderFuncFixed(p),
-		},
-		Provisioners: map[string]ResourceProvisionerFactory{
-			"shell": testProvisionerFuncFixed(pr),
-		},
-	})
+		_, err := ctx.Plan()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
 
-	if _, err := ctx.Plan(); err != nil {
-		t.Fatalf("err: %s", err)
-	}
+		state, err = ctx.Apply()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
 
-	state, err := ctx.Apply()
-	if err != nil {
-		t.Fatalf("err: %s", err)
+		// Verify apply was invoked
+		if !pr.ApplyCalled {
+			t.Fatalf("provisioner not invoked")
+		}
 	}
 
-	checkStateString(t, state, `<no state>`)
+	{
+		ctx := testContext2(t, &ContextOpts{
+			Module:  m,
+			Destroy: true,
+			State:   state,
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+			Provisioners: map[string]ResourceProvisionerFactory{
+				"shell": testProvisionerFuncFixed(pr),
+			},
+		})
 
-	// Verify apply was invoked
-	if !pr.ApplyCalled {
-		t.Fatalf("provisioner not invoked")
-	}
+		_, err := ctx.Plan()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
 
-	expected := []string{"one", "two"}
-	if !reflect.DeepEqual(calls, expected) {
-		t.Fatalf("bad: %#v", calls)
+		state, err = ctx.Apply()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		checkStateString(t, state, `<no state>`)
 	}
 }
 
-// Verify that on destroy provisioner failure with "continue" that
-// we continue to the next provisioner. But if the next provisioner defines
-// to fail, then we fail after running it.
-func TestContext2Apply_provisionerDestroyFailContinueFail(t *testing.T) {
-	m := testModule(t, "apply-provisioner-destroy-fail")
+// Provisioner should NOT run on a diff, only create
+func TestContext2Apply_Provisioner_Diff(t *testing.T) {
+	m := testModule(t, "apply-provisioner-diff")
 	p := testProvider("aws")
 	pr := testProvisioner()
 	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
-
-	var calls []string
 	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
-		val, ok := c.Config["foo"]
-		if !ok {
-			t.Fatalf("bad value for foo: %v %#v", val, c)
-		}
-
-		calls = append(calls, val.(string))
-		return fmt.Errorf("provisioner error")
-	}
-
-	state := &State{
-		Modules: []*ModuleState{
-			&ModuleState{
-				Path: rootModulePath,
-				Resources: map[string]*ResourceState{
-					"aws_instance.foo": &ResourceState{
-						Type: "aws_instance",
-						Primary: &InstanceState{
-							ID: "bar",
-						},
-					},
-				},
-			},
-		},
+		return nil
 	}
-
 	ctx := testContext2(t, &ContextOpts{
-		Module:  m,
-		State:   state,
-		Destroy: true,
+		Module: m,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
@@ -4465,114 +8582,153 @@ func TestContext2Apply_provisionerDestroyFailContinueFail(t *testing.T) {
 	}
 
 	state, err := ctx.Apply()
-	if err == nil {
-		t.Fatal("should error")
+	if err != nil {
+		t.Fatalf("err: %s", err)
 	}
 
-	checkStateString(t, state, `
-aws_instance.foo:
-  ID = bar
-  `)
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyProvisionerDiffStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
 
 	// Verify apply was invoked
 	if !pr.ApplyCalled {
 		t.Fatalf("provisioner not invoked")
 	}
+	pr.ApplyCalled = false
 
-	expected := []string{"one", "two"}
-	if !reflect.DeepEqual(calls, expected) {
-		t.Fatalf("bad: %#v", calls)
-	}
-}
+	// Change the state to force a diff
+	mod := state.RootModule()
+	mod.Resources["aws_instance.bar"].Primary.Attributes["foo"] = "baz"
 
-// Verify destroy provisioners are not run for tainted instances.
-func TestContext2Apply_provisionerDestroyTainted(t *testing.T) {
-	m := testModule(t, "apply-provisioner-destroy")
-	p := testProvider("aws")
-	pr := testProvisioner()
-	p.ApplyFn = testApplyFn
-	p.DiffFn = testDiffFn
+	// Re-create context with state
+	ctx = testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
+		State: state,
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
 
-	destroyCalled := false
-	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
-		expected := "create"
-		if rs.ID == "bar" {
-			destroyCalled = true
-			return nil
-		}
+	state2, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
 
-		val, ok := c.Config["foo"]
-		if !ok || val != expected {
-			t.Fatalf("bad value for foo: %v %#v", val, c)
-		}
+	actual = strings.TrimSpace(state2.String())
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
 
-		return nil
+	// Verify apply was NOT invoked
+	if pr.ApplyCalled {
+		t.Fatalf("provisioner invoked")
 	}
+}
 
-	state := &State{
+func TestContext2Apply_outputDiffVars(t *testing.T) {
+	m := testModule(t, "apply-good")
+	p := testProvider("aws")
+	s := &State{
 		Modules: []*ModuleState{
 			&ModuleState{
 				Path: rootModulePath,
 				Resources: map[string]*ResourceState{
-					"aws_instance.foo": &ResourceState{
+					"aws_instance.baz": &ResourceState{
 						Type: "aws_instance",
 						Primary: &InstanceState{
-							ID:      "bar",
-							Tainted: true,
+							ID: "bar",
 						},
 					},
 				},
 			},
 		},
 	}
-
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
-		State:  state,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
-		Provisioners: map[string]ResourceProvisionerFactory{
-			"shell": testProvisionerFuncFixed(pr),
-		},
+		State: s,
 	})
 
-	if _, err := ctx.Plan(); err != nil {
-		t.Fatalf("err: %s", err)
-	}
+	p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
+		for k, ad := range d.Attributes {
+			if ad.NewComputed {
+				return nil, fmt.Errorf("%s: computed", k)
+			}
+		}
 
-	state, err := ctx.Apply()
-	if err != nil {
-		t.Fatalf("err: %s", err)
+		result := s.MergeDiff(d)
+		result.ID = "foo"
+		return result, nil
 	}
-
-	checkStateString(t, state, `
-aws_instance.foo:
-  ID = foo
-  foo = bar
-  type = aws_instance
-	`)
-
-	// Verify apply was invoked
-	if !pr.ApplyCalled {
-		t.Fatalf("provisioner not invoked")
+	p.DiffFn = func(*InstanceInfo, *InstanceState, *ResourceConfig) (*InstanceDiff, error) {
+		return &InstanceDiff{
+			Attributes: map[string]*ResourceAttrDiff{
+				"foo": &ResourceAttrDiff{
+					NewComputed: true,
+					Type:        DiffAttrOutput,
+				},
+				"bar": &ResourceAttrDiff{
+					New: "baz",
+				},
+			},
+		}, nil
 	}
 
-	if destroyCalled {
-		t.Fatal("destroy should not be called")
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := ctx.Apply(); err != nil {
+		t.Fatalf("err: %s", err)
 	}
 }
 
-func TestContext2Apply_provisionerResourceRef(t *testing.T) {
-	m := testModule(t, "apply-provisioner-resource-ref")
+func TestContext2Apply_Provisioner_ConnInfo(t *testing.T) {
+	m := testModule(t, "apply-provisioner-conninfo")
 	p := testProvider("aws")
 	pr := testProvisioner()
-	p.ApplyFn = testApplyFn
+
+	p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
+		if s.Ephemeral.ConnInfo == nil {
+			t.Fatalf("ConnInfo not initialized")
+		}
+
+		result, _ := testApplyFn(info, s, d)
+		result.Ephemeral.ConnInfo = map[string]string{
+			"type": "ssh",
+			"host": "127.0.0.1",
+			"port": "22",
+		}
+		return result, nil
+	}
 	p.DiffFn = testDiffFn
+
 	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
-		val, ok := c.Config["foo"]
-		if !ok || val != "2" {
-			t.Fatalf("bad value for foo: %v %#v", val, c)
+		conn := rs.Ephemeral.ConnInfo
+		if conn["type"] != "telnet" {
+			t.Fatalf("Bad: %#v", conn)
+		}
+		if conn["host"] != "127.0.0.1" {
+			t.Fatalf("Bad: %#v", conn)
+		}
+		if conn["port"] != "2222" {
+			t.Fatalf("Bad: %#v", conn)
+		}
+		if conn["user"] != "superuser" {
+			t.Fatalf("Bad: %#v", conn)
+		}
+		if conn["pass"] != "test" {
+			t.Fatalf("Bad: %#v", conn)
 		}
 
 		return nil
@@ -4586,6 +8742,10 @@ func TestContext2Apply_provisionerResourceRef(t *testing.T) {
 		Provisioners: map[string]ResourceProvisionerFactory{
 			"shell": testProvisionerFuncFixed(pr),
 		},
+		Variables: map[string]interface{}{
+			"value": "1",
+			"pass":  "test",
+		},
 	})
 
 	if _, err := ctx.Plan(); err != nil {
@@ -4598,7 +8758,7 @@ func TestContext2Apply_provisionerResourceRef(t *testing.T) {
 	}
 
 	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyProvisionerResourceRefStr)
+	expected := strings.TrimSpace(testTerraformApplyProvisionerStr)
 	if actual != expected {
 		t.Fatalf("bad: \n%s", actual)
 	}
@@ -4609,31 +8769,21 @@ func TestContext2Apply_provisionerResourceRef(t *testing.T) {
 	}
 }
 
-func TestContext2Apply_provisionerSelfRef(t *testing.T) {
-	m := testModule(t, "apply-provisioner-self-ref")
+func TestContext2Apply_destroyX(t *testing.T) {
+	m := testModule(t, "apply-destroy")
+	h := new(HookRecordApplyOrder)
 	p := testProvider("aws")
-	pr := testProvisioner()
 	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
-	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
-		val, ok := c.Config["command"]
-		if !ok || val != "bar" {
-			t.Fatalf("bad value for command: %v %#v", val, c)
-		}
-
-		return nil
-	}
-
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
+		Hooks:  []Hook{h},
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
-		Provisioners: map[string]ResourceProvisionerFactory{
-			"shell": testProvisionerFuncFixed(pr),
-		},
 	})
 
+	// First plan and apply a create operation
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
@@ -4643,38 +8793,72 @@ func TestContext2Apply_provisionerSelfRef(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
+	// Next, plan and apply a destroy operation
+	h.Active = true
+	ctx = testContext2(t, &ContextOpts{
+		Destroy: true,
+		State:   state,
+		Module:  m,
+		Hooks:   []Hook{h},
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err = ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Test that things were destroyed
 	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyProvisionerSelfRefStr)
+	expected := strings.TrimSpace(testTerraformApplyDestroyStr)
 	if actual != expected {
 		t.Fatalf("bad: \n%s", actual)
 	}
 
-	// Verify apply was invoked
-	if !pr.ApplyCalled {
-		t.Fatalf("provisioner not invoked")
+	// Test that things were destroyed _in the right order_
+	expected2 := []string{"aws_instance.bar", "aws_instance.foo"}
+	actual2 := h.IDs
+	if !reflect.DeepEqual(actual2, expected2) {
+		t.Fatalf("expected: %#v\n\ngot:%#v", expected2, actual2)
 	}
 }
 
-func TestContext2Apply_provisionerMultiSelfRef(t *testing.T) {
-	var lock sync.Mutex
-	commands := make([]string, 0, 5)
+func TestContext2Apply_destroyParallelism(t *testing.T) {
+	m := testModule(t, "apply-destroy-parallelism")
 
-	m := testModule(t, "apply-provisioner-multi-self-ref")
+	var lock sync.Mutex
+	var active, max int
+	var order []string
 	p := testProvider("aws")
-	pr := testProvisioner()
-	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
-	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
-		lock.Lock()
-		defer lock.Unlock()
+	p.ApplyFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		d *InstanceDiff) (*InstanceState, error) {
+		if !d.GetDestroy() {
+			return testApplyFn(info, s, d)
+		}
 
-		val, ok := c.Config["command"]
-		if !ok {
-			t.Fatalf("bad value for command: %v %#v", val, c)
+		lock.Lock()
+		active++
+		if active > max {
+			max = active
 		}
+		order = append(order, info.Id)
+		lock.Unlock()
 
-		commands = append(commands, val.(string))
-		return nil
+		time.Sleep(20 * time.Millisecond)
+
+		lock.Lock()
+		active--
+		lock.Unlock()
+		return testApplyFn(info, s, d)
 	}
 
 	ctx := testContext2(t, &ContextOpts{
@@ -4682,59 +8866,99 @@ func TestContext2Apply_provisionerMultiSelfRef(t *testing.T) {
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
-		Provisioners: map[string]ResourceProvisionerFactory{
-			"shell": testProvisionerFuncFixed(pr),
-		},
 	})
-
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
-
 	state, err := ctx.Apply()
 	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyProvisionerMultiSelfRefStr)
-	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
+	ctx = testContext2(t, &ContextOpts{
+		Destroy:            true,
+		State:              state,
+		Module:             m,
+		Parallelism:        10,
+		DestroyParallelism: 2,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	state, err = ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
 	}
 
-	// Verify apply was invoked
-	if !pr.ApplyCalled {
-		t.Fatalf("provisioner not invoked")
+	checkStateString(t, state, `<no state>`)
+
+	if max != 2 {
+		t.Fatalf("expected at most 2 concurrent destroys, got %d", max)
 	}
 
-	// Verify our result
-	sort.Strings(commands)
-	expectedCommands := []string{"number 0", "number 1", "number 2"}
-	if !reflect.DeepEqual(commands, expectedCommands) {
-		t.Fatalf("bad: %#v", commands)
+	// The instances that depend on aws_instance.foo.0 are still destroyed
+	// before it
+	if len(order) != 6 || order[5] != "aws_instance.foo.0" {
+		t.Fatalf("bad: %#v", order)
 	}
 }
 
-func TestContext2Apply_provisionerMultiSelfRefSingle(t *testing.T) {
-	var lock sync.Mutex
-	order := make([]string, 0, 5)
+// The instances left over when a computed count shrinks are destroyed
+// under the destroy parallelism as well.
+func TestContext2Apply_destroyParallelismCountOrphans(t *testing.T) {
+	m := testModule(t, "apply-count-computed")
 
-	m := testModule(t, "apply-provisioner-multi-self-ref-single")
+	var lock sync.Mutex
+	var active, max, destroyed int
 	p := testProvider("aws")
-	pr := testProvisioner()
-	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
-	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
-		lock.Lock()
-		defer lock.Unlock()
+	p.ApplyFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		d *InstanceDiff) (*InstanceState, error) {
+		if !d.GetDestroy() {
+			return testApplyFn(info, s, d)
+		}
 
-		val, ok := c.Config["order"]
-		if !ok {
-			t.Fatalf("bad value for order: %v %#v", val, c)
+		lock.Lock()
+		active++
+		destroyed++
+		if active > max {
+			max = active
 		}
+		lock.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		lock.Lock()
+		active--
+		lock.Unlock()
+		return testApplyFn(info, s, d)
+	}
 
-		order = append(order, val.(string))
-		return nil
+	resources := make(map[string]*ResourceState)
+	for i := 0; i < 5; i++ {
+		resources[fmt.Sprintf("aws_instance.bar.%d", i)] = &ResourceState{
+			Type: "aws_instance",
+			Primary: &InstanceState{
+				ID: fmt.Sprintf("bar%d", i),
+				Attributes: map[string]string{
+					"foo":  "0",
+					"type": "aws_instance",
+				},
+			},
+		}
+	}
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path:      rootModulePath,
+				Resources: resources,
+			},
+		},
 	}
 
 	ctx := testContext2(t, &ContextOpts{
@@ -4742,8 +8966,11 @@ func TestContext2Apply_provisionerMultiSelfRefSingle(t *testing.T) {
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
-		Provisioners: map[string]ResourceProvisionerFactory{
-			"shell": testProvisionerFuncFixed(pr),
+		State:              s,
+		Parallelism:        10,
+		DestroyParallelism: 1,
+		Variables: map[string]interface{}{
+			"count": "1",
 		},
 	})
 
@@ -4756,168 +8983,94 @@ func TestContext2Apply_provisionerMultiSelfRefSingle(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyProvisionerMultiSelfRefSingleStr)
-	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
+	if _, ok := state.RootModule().Resources["aws_instance.bar.1"]; ok {
+		t.Fatalf("bad: %s", state)
 	}
-
-	// Verify apply was invoked
-	if !pr.ApplyCalled {
-		t.Fatalf("provisioner not invoked")
+	if destroyed != 4 {
+		t.Fatalf("expected 4 destroys, got %d", destroyed)
 	}
-
-	// Verify our result
-	sort.Strings(order)
-	expectedOrder := []string{"0", "1", "2"}
-	if !reflect.DeepEqual(order, expectedOrder) {
-		t.Fatalf("bad: %#v", order)
+	if max != 1 {
+		t.Fatalf("expected at most 1 concurrent destroy, got %d", max)
 	}
 }
 
-func TestContext2Apply_provisionerMultiSelfRefCount(t *testing.T) {
-	var lock sync.Mutex
-	commands := make([]string, 0, 5)
-
-	m := testModule(t, "apply-provisioner-multi-self-ref-count")
+func TestContext2Apply_destroyOrder(t *testing.T) {
+	m := testModule(t, "apply-destroy")
+	h := new(HookRecordApplyOrder)
 	p := testProvider("aws")
-	pr := testProvisioner()
 	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
-	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
-		lock.Lock()
-		defer lock.Unlock()
-
-		val, ok := c.Config["command"]
-		if !ok {
-			t.Fatalf("bad value for command: %v %#v", val, c)
-		}
-
-		commands = append(commands, val.(string))
-		return nil
-	}
-
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
+		Hooks:  []Hook{h},
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
-		Provisioners: map[string]ResourceProvisionerFactory{
-			"shell": testProvisionerFuncFixed(pr),
-		},
 	})
 
+	// First plan and apply a create operation
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	if _, err := ctx.Apply(); err != nil {
+	state, err := ctx.Apply()
+	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	// Verify apply was invoked
-	if !pr.ApplyCalled {
-		t.Fatalf("provisioner not invoked")
-	}
-
-	// Verify our result
-	sort.Strings(commands)
-	expectedCommands := []string{"3", "3", "3"}
-	if !reflect.DeepEqual(commands, expectedCommands) {
-		t.Fatalf("bad: %#v", commands)
-	}
-}
+	t.Logf("State 1: %s", state)
 
-func TestContext2Apply_provisionerExplicitSelfRef(t *testing.T) {
-	m := testModule(t, "apply-provisioner-explicit-self-ref")
-	p := testProvider("aws")
-	pr := testProvisioner()
-	p.ApplyFn = testApplyFn
-	p.DiffFn = testDiffFn
-	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
-		val, ok := c.Config["command"]
-		if !ok || val != "bar" {
-			t.Fatalf("bad value for command: %v %#v", val, c)
-		}
+	// Next, plan and apply config-less to force a destroy with "apply"
+	h.Active = true
+	ctx = testContext2(t, &ContextOpts{
+		State:  state,
+		Module: module.NewEmptyTree(),
+		Hooks:  []Hook{h},
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
 
-		return nil
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
 	}
 
-	var state *State
-	{
-		ctx := testContext2(t, &ContextOpts{
-			Module: m,
-			Providers: map[string]ResourceProviderFactory{
-				"aws": testProviderFuncFixed(p),
-			},
-			Provisioners: map[string]ResourceProvisionerFactory{
-				"shell": testProvisionerFuncFixed(pr),
-			},
-		})
-
-		_, err := ctx.Plan()
-		if err != nil {
-			t.Fatalf("err: %s", err)
-		}
-
-		state, err = ctx.Apply()
-		if err != nil {
-			t.Fatalf("err: %s", err)
-		}
-
-		// Verify apply was invoked
-		if !pr.ApplyCalled {
-			t.Fatalf("provisioner not invoked")
-		}
+	state, err = ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
 	}
 
-	{
-		ctx := testContext2(t, &ContextOpts{
-			Module:  m,
-			Destroy: true,
-			State:   state,
-			Providers: map[string]ResourceProviderFactory{
-				"aws": testProviderFuncFixed(p),
-			},
-			Provisioners: map[string]ResourceProvisionerFactory{
-				"shell": testProvisionerFuncFixed(pr),
-			},
-		})
-
-		_, err := ctx.Plan()
-		if err != nil {
-			t.Fatalf("err: %s", err)
-		}
-
-		state, err = ctx.Apply()
-		if err != nil {
-			t.Fatalf("err: %s", err)
-		}
+	// Test that things were destroyed
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyDestroyStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
 
-		checkStateString(t, state, `<no state>`)
+	// Test that things were destroyed _in the right order_
+	expected2 := []string{"aws_instance.bar", "aws_instance.foo"}
+	actual2 := h.IDs
+	if !reflect.DeepEqual(actual2, expected2) {
+		t.Fatalf("expected: %#v\n\ngot:%#v", expected2, actual2)
 	}
 }
 
-// Provisioner should NOT run on a diff, only create
-func TestContext2Apply_Provisioner_Diff(t *testing.T) {
-	m := testModule(t, "apply-provisioner-diff")
+// https://github.com/hashicorp/terraform/issues/2767
+func TestContext2Apply_destroyModulePrefix(t *testing.T) {
+	m := testModule(t, "apply-destroy-module-resource-prefix")
+	h := new(MockHook)
 	p := testProvider("aws")
-	pr := testProvisioner()
 	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
-	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
-		return nil
-	}
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
+		Hooks:  []Hook{h},
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
-		Provisioners: map[string]ResourceProvisionerFactory{
-			"shell": testProvisionerFuncFixed(pr),
-		},
 	})
 
+	// First plan and apply a create operation
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
@@ -4927,63 +9080,98 @@ func TestContext2Apply_Provisioner_Diff(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyProvisionerDiffStr)
-	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
+	// Verify that we got the apply info correct
+	if v := h.PreApplyInfo.HumanId(); v != "module.child.aws_instance.foo" {
+		t.Fatalf("bad: %s", v)
 	}
 
-	// Verify apply was invoked
-	if !pr.ApplyCalled {
-		t.Fatalf("provisioner not invoked")
+	// Next, plan and apply a destroy operation and reset the hook
+	h = new(MockHook)
+	ctx = testContext2(t, &ContextOpts{
+		Destroy: true,
+		State:   state,
+		Module:  m,
+		Hooks:   []Hook{h},
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
 	}
-	pr.ApplyCalled = false
 
-	// Change the state to force a diff
-	mod := state.RootModule()
-	mod.Resources["aws_instance.bar"].Primary.Attributes["foo"] = "baz"
+	state, err = ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
 
-	// Re-create context with state
-	ctx = testContext2(t, &ContextOpts{
+	// Test that things were destroyed
+	if v := h.PreApplyInfo.HumanId(); v != "module.child.aws_instance.foo" {
+		t.Fatalf("bad: %s", v)
+	}
+}
+
+func TestContext2Apply_destroyNestedModule(t *testing.T) {
+	m := testModule(t, "apply-destroy-nested-module")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: []string{"root", "child", "subchild"},
+				Resources: map[string]*ResourceState{
+					"aws_instance.bar": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bar",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
-		Provisioners: map[string]ResourceProvisionerFactory{
-			"shell": testProvisionerFuncFixed(pr),
-		},
-		State: state,
+		State: s,
 	})
 
+	// First plan and apply a create operation
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	state2, err := ctx.Apply()
+	state, err := ctx.Apply()
 	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	actual = strings.TrimSpace(state2.String())
+	// Test that things were destroyed
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyDestroyNestedModuleStr)
 	if actual != expected {
 		t.Fatalf("bad: \n%s", actual)
 	}
-
-	// Verify apply was NOT invoked
-	if pr.ApplyCalled {
-		t.Fatalf("provisioner invoked")
-	}
 }
 
-func TestContext2Apply_outputDiffVars(t *testing.T) {
-	m := testModule(t, "apply-good")
+func TestContext2Apply_destroyDeeplyNestedModule(t *testing.T) {
+	m := testModule(t, "apply-destroy-deeply-nested-module")
 	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+
 	s := &State{
 		Modules: []*ModuleState{
 			&ModuleState{
-				Path: rootModulePath,
+				Path: []string{"root", "child", "subchild", "subsubchild"},
 				Resources: map[string]*ResourceState{
-					"aws_instance.baz": &ResourceState{
+					"aws_instance.bar": &ResourceState{
 						Type: "aws_instance",
 						Primary: &InstanceState{
 							ID: "bar",
@@ -4993,6 +9181,7 @@ func TestContext2Apply_outputDiffVars(t *testing.T) {
 			},
 		},
 	}
+
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
@@ -5001,240 +9190,358 @@ func TestContext2Apply_outputDiffVars(t *testing.T) {
 		State: s,
 	})
 
-	p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
-		for k, ad := range d.Attributes {
-			if ad.NewComputed {
-				return nil, fmt.Errorf("%s: computed", k)
-			}
-		}
-
-		result := s.MergeDiff(d)
-		result.ID = "foo"
-		return result, nil
-	}
-	p.DiffFn = func(*InstanceInfo, *InstanceState, *ResourceConfig) (*InstanceDiff, error) {
-		return &InstanceDiff{
-			Attributes: map[string]*ResourceAttrDiff{
-				"foo": &ResourceAttrDiff{
-					NewComputed: true,
-					Type:        DiffAttrOutput,
-				},
-				"bar": &ResourceAttrDiff{
-					New: "baz",
-				},
-			},
-		}, nil
-	}
-
+	// First plan and apply a create operation
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
-	if _, err := ctx.Apply(); err != nil {
+
+	state, err := ctx.Apply()
+	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
+
+	// Test that things were destroyed
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(`
+module.child.subchild.subsubchild:
+  <no state>
+	`)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
+	}
 }
 
-func TestContext2Apply_Provisioner_ConnInfo(t *testing.T) {
-	m := testModule(t, "apply-provisioner-conninfo")
+// https://github.com/hashicorp/terraform/issues/5440
+func TestContext2Apply_destroyModuleWithAttrsReferencingResource(t *testing.T) {
+	m := testModule(t, "apply-destroy-module-with-attrs")
 	p := testProvider("aws")
-	pr := testProvisioner()
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
 
-	p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
-		if s.Ephemeral.ConnInfo == nil {
-			t.Fatalf("ConnInfo not initialized")
+	var state *State
+	var err error
+	{
+		ctx := testContext2(t, &ContextOpts{
+			Module: m,
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+		})
+
+		// First plan and apply a create operation
+		if p, err := ctx.Plan(); err != nil {
+			t.Fatalf("plan err: %s", err)
+		} else {
+			t.Logf("Step 1 plan: %s", p)
 		}
 
-		result, _ := testApplyFn(info, s, d)
-		result.Ephemeral.ConnInfo = map[string]string{
-			"type": "ssh",
-			"host": "127.0.0.1",
-			"port": "22",
+		state, err = ctx.Apply()
+		if err != nil {
+			t.Fatalf("apply err: %s", err)
 		}
-		return result, nil
+
+		t.Logf("Step 1 state: %s", state)
 	}
-	p.DiffFn = testDiffFn
 
-	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
-		conn := rs.Ephemeral.ConnInfo
-		if conn["type"] != "telnet" {
-			t.Fatalf("Bad: %#v", conn)
+	h := new(HookRecordApplyOrder)
+	h.Active = true
+
+	{
+		ctx := testContext2(t, &ContextOpts{
+			Destroy: true,
+			Module:  m,
+			State:   state,
+			Hooks:   []Hook{h},
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+			Variables: map[string]interface{}{
+				"key_name": "foobarkey",
+			},
+		})
+
+		// First plan and apply a create operation
+		plan, err := ctx.Plan()
+		if err != nil {
+			t.Fatalf("destroy plan err: %s", err)
 		}
-		if conn["host"] != "127.0.0.1" {
-			t.Fatalf("Bad: %#v", conn)
+
+		t.Logf("Step 2 plan: %s", plan)
+
+		var buf bytes.Buffer
+		if err := WritePlan(plan, &buf); err != nil {
+			t.Fatalf("plan write err: %s", err)
 		}
-		if conn["port"] != "2222" {
-			t.Fatalf("Bad: %#v", conn)
+
+		planFromFile, err := ReadPlan(&buf)
+		if err != nil {
+			t.Fatalf("plan read err: %s", err)
 		}
-		if conn["user"] != "superuser" {
-			t.Fatalf("Bad: %#v", conn)
+
+		ctx, err = planFromFile.Context(&ContextOpts{
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+		})
+		if err != nil {
+			t.Fatalf("err: %s", err)
 		}
-		if conn["pass"] != "test" {
-			t.Fatalf("Bad: %#v", conn)
+
+		state, err = ctx.Apply()
+		if err != nil {
+			t.Fatalf("destroy apply err: %s", err)
 		}
 
-		return nil
+		t.Logf("Step 2 state: %s", state)
 	}
 
-	ctx := testContext2(t, &ContextOpts{
-		Module: m,
-		Providers: map[string]ResourceProviderFactory{
-			"aws": testProviderFuncFixed(p),
-		},
-		Provisioners: map[string]ResourceProvisionerFactory{
-			"shell": testProvisionerFuncFixed(pr),
-		},
-		Variables: map[string]interface{}{
-			"value": "1",
-			"pass":  "test",
-		},
-	})
-
-	if _, err := ctx.Plan(); err != nil {
-		t.Fatalf("err: %s", err)
+	//Test that things were destroyed
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(`
+<no state>
+module.child:
+  <no state>
+		`)
+	if actual != expected {
+		t.Fatalf("expected:\n\n%s\n\nactual:\n\n%s", expected, actual)
 	}
+}
 
-	state, err := ctx.Apply()
-	if err != nil {
-		t.Fatalf("err: %s", err)
+func TestContext2Apply_destroyWithModuleVariableAndCount(t *testing.T) {
+	m := testModule(t, "apply-destroy-mod-var-and-count")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+
+	var state *State
+	var err error
+	{
+		ctx := testContext2(t, &ContextOpts{
+			Module: m,
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+		})
+
+		// First plan and apply a create operation
+		if _, err := ctx.Plan(); err != nil {
+			t.Fatalf("plan err: %s", err)
+		}
+
+		state, err = ctx.Apply()
+		if err != nil {
+			t.Fatalf("apply err: %s", err)
+		}
 	}
 
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyProvisionerStr)
-	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
+	h := new(HookRecordApplyOrder)
+	h.Active = true
+
+	{
+		ctx := testContext2(t, &ContextOpts{
+			Destroy: true,
+			Module:  m,
+			State:   state,
+			Hooks:   []Hook{h},
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+		})
+
+		// First plan and apply a create operation
+		plan, err := ctx.Plan()
+		if err != nil {
+			t.Fatalf("destroy plan err: %s", err)
+		}
+
+		var buf bytes.Buffer
+		if err := WritePlan(plan, &buf); err != nil {
+			t.Fatalf("plan write err: %s", err)
+		}
+
+		planFromFile, err := ReadPlan(&buf)
+		if err != nil {
+			t.Fatalf("plan read err: %s", err)
+		}
+
+		ctx, err = planFromFile.Context(&ContextOpts{
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+		})
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		state, err = ctx.Apply()
+		if err != nil {
+			t.Fatalf("destroy apply err: %s", err)
+		}
 	}
 
-	// Verify apply was invoked
-	if !pr.ApplyCalled {
-		t.Fatalf("provisioner not invoked")
+	//Test that things were destroyed
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(`
+<no state>
+module.child:
+  <no state>
+		`)
+	if actual != expected {
+		t.Fatalf("expected: \n%s\n\nbad: \n%s", expected, actual)
 	}
 }
 
-func TestContext2Apply_destroyX(t *testing.T) {
-	m := testModule(t, "apply-destroy")
-	h := new(HookRecordApplyOrder)
+func TestContext2Apply_destroyTargetWithModuleVariableAndCount(t *testing.T) {
+	m := testModule(t, "apply-destroy-mod-var-and-count")
 	p := testProvider("aws")
 	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
-	ctx := testContext2(t, &ContextOpts{
-		Module: m,
-		Hooks:  []Hook{h},
-		Providers: map[string]ResourceProviderFactory{
-			"aws": testProviderFuncFixed(p),
-		},
-	})
 
-	// First plan and apply a create operation
-	if _, err := ctx.Plan(); err != nil {
-		t.Fatalf("err: %s", err)
-	}
+	var state *State
+	var err error
+	{
+		ctx := testContext2(t, &ContextOpts{
+			Module: m,
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+		})
 
-	state, err := ctx.Apply()
-	if err != nil {
-		t.Fatalf("err: %s", err)
+		// First plan and apply a create operation
+		if _, err := ctx.Plan(); err != nil {
+			t.Fatalf("plan err: %s", err)
+		}
+
+		state, err = ctx.Apply()
+		if err != nil {
+			t.Fatalf("apply err: %s", err)
+		}
 	}
 
-	// Next, plan and apply a destroy operation
-	h.Active = true
-	ctx = testContext2(t, &ContextOpts{
-		Destroy: true,
-		State:   state,
-		Module:  m,
-		Hooks:   []Hook{h},
-		Providers: map[string]ResourceProviderFactory{
-			"aws": testProviderFuncFixed(p),
-		},
-	})
+	{
+		ctx := testContext2(t, &ContextOpts{
+			Destroy: true,
+			Module:  m,
+			State:   state,
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+			Targets: []string{"module.child"},
+		})
 
-	if _, err := ctx.Plan(); err != nil {
-		t.Fatalf("err: %s", err)
-	}
+		_, err := ctx.Plan()
+		if err != nil {
+			t.Fatalf("plan err: %s", err)
+		}
 
-	state, err = ctx.Apply()
-	if err != nil {
-		t.Fatalf("err: %s", err)
+		// Destroy, targeting the module explicitly
+		state, err = ctx.Apply()
+		if err != nil {
+			t.Fatalf("destroy apply err: %s", err)
+		}
 	}
 
-	// Test that things were destroyed
+	//Test that things were destroyed
 	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyDestroyStr)
+	expected := strings.TrimSpace(`
+<no state>
+module.child:
+  <no state>
+		`)
 	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
-	}
-
-	// Test that things were destroyed _in the right order_
-	expected2 := []string{"aws_instance.bar", "aws_instance.foo"}
-	actual2 := h.IDs
-	if !reflect.DeepEqual(actual2, expected2) {
-		t.Fatalf("expected: %#v\n\ngot:%#v", expected2, actual2)
+		t.Fatalf("expected: \n%s\n\nbad: \n%s", expected, actual)
 	}
 }
 
-func TestContext2Apply_destroyOrder(t *testing.T) {
-	m := testModule(t, "apply-destroy")
-	h := new(HookRecordApplyOrder)
+func TestContext2Apply_destroyWithModuleVariableAndCountNested(t *testing.T) {
+	m := testModule(t, "apply-destroy-mod-var-and-count-nested")
 	p := testProvider("aws")
 	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
-	ctx := testContext2(t, &ContextOpts{
-		Module: m,
-		Hooks:  []Hook{h},
-		Providers: map[string]ResourceProviderFactory{
-			"aws": testProviderFuncFixed(p),
-		},
-	})
 
-	// First plan and apply a create operation
-	if _, err := ctx.Plan(); err != nil {
-		t.Fatalf("err: %s", err)
-	}
+	var state *State
+	var err error
+	{
+		ctx := testContext2(t, &ContextOpts{
+			Module: m,
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+		})
 
-	state, err := ctx.Apply()
-	if err != nil {
-		t.Fatalf("err: %s", err)
-	}
+		// First plan and apply a create operation
+		if _, err := ctx.Plan(); err != nil {
+			t.Fatalf("plan err: %s", err)
+		}
 
-	t.Logf("State 1: %s", state)
+		state, err = ctx.Apply()
+		if err != nil {
+			t.Fatalf("apply err: %s", err)
+		}
+	}
 
-	// Next, plan and apply config-less to force a destroy with "apply"
+	h := new(HookRecordApplyOrder)
 	h.Active = true
-	ctx = testContext2(t, &ContextOpts{
-		State:  state,
-		Module: module.NewEmptyTree(),
-		Hooks:  []Hook{h},
-		Providers: map[string]ResourceProviderFactory{
-			"aws": testProviderFuncFixed(p),
-		},
-	})
 
-	if _, err := ctx.Plan(); err != nil {
-		t.Fatalf("err: %s", err)
-	}
+	{
+		ctx := testContext2(t, &ContextOpts{
+			Destroy: true,
+			Module:  m,
+			State:   state,
+			Hooks:   []Hook{h},
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+		})
 
-	state, err = ctx.Apply()
-	if err != nil {
-		t.Fatalf("err: %s", err)
+		// First plan and apply a create operation
+		plan, err := ctx.Plan()
+		if err != nil {
+			t.Fatalf("destroy plan err: %s", err)
+		}
+
+		var buf bytes.Buffer
+		if err := WritePlan(plan, &buf); err != nil {
+			t.Fatalf("plan write err: %s", err)
+		}
+
+		planFromFile, err := ReadPlan(&buf)
+		if err != nil {
+			t.Fatalf("plan read err: %s", err)
+		}
+
+		ctx, err = planFromFile.Context(&ContextOpts{
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+		})
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		state, err = ctx.Apply()
+		if err != nil {
+			t.Fatalf("destroy apply err: %s", err)
+		}
 	}
 
-	// Test that things were destroyed
+	//Test that things were destroyed
 	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyDestroyStr)
+	expected := strings.TrimSpace(`
+<no state>
+module.child:
+  <no state>
+module.child.child2:
+  <no state>
+		`)
 	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
-	}
-
-	// Test that things were destroyed _in the right order_
-	expected2 := []string{"aws_instance.bar", "aws_instance.foo"}
-	actual2 := h.IDs
-	if !reflect.DeepEqual(actual2, expected2) {
-		t.Fatalf("expected: %#v\n\ngot:%#v", expected2, actual2)
+		t.Fatalf("expected: \n%s\n\nbad: \n%s", expected, actual)
 	}
 }
 
-// https://github.com/hashicorp/terraform/issues/2767
-func TestContext2Apply_destroyModulePrefix(t *testing.T) {
-	m := testModule(t, "apply-destroy-module-resource-prefix")
-	h := new(MockHook)
+func TestContext2Apply_destroyOutputs(t *testing.T) {
+	m := testModule(t, "apply-destroy-outputs")
+	h := new(HookRecordApplyOrder)
 	p := testProvider("aws")
 	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
@@ -5252,17 +9559,13 @@ func TestContext2Apply_destroyModulePrefix(t *testing.T) {
 	}
 
 	state, err := ctx.Apply()
+
 	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	// Verify that we got the apply info correct
-	if v := h.PreApplyInfo.HumanId(); v != "module.child.aws_instance.foo" {
-		t.Fatalf("bad: %s", v)
-	}
-
-	// Next, plan and apply a destroy operation and reset the hook
-	h = new(MockHook)
+	// Next, plan and apply a destroy operation
+	h.Active = true
 	ctx = testContext2(t, &ContextOpts{
 		Destroy: true,
 		State:   state,
@@ -5282,24 +9585,21 @@ func TestContext2Apply_destroyModulePrefix(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
-	// Test that things were destroyed
-	if v := h.PreApplyInfo.HumanId(); v != "module.child.aws_instance.foo" {
-		t.Fatalf("bad: %s", v)
+	mod := state.RootModule()
+	if len(mod.Resources) > 0 {
+		t.Fatalf("bad: %#v", mod)
 	}
 }
 
-func TestContext2Apply_destroyNestedModule(t *testing.T) {
-	m := testModule(t, "apply-destroy-nested-module")
+func TestContext2Apply_destroyOrphan(t *testing.T) {
+	m := testModule(t, "apply-error")
 	p := testProvider("aws")
-	p.ApplyFn = testApplyFn
-	p.DiffFn = testDiffFn
-
 	s := &State{
 		Modules: []*ModuleState{
 			&ModuleState{
-				Path: []string{"root", "child", "subchild"},
+				Path: rootModulePath,
 				Resources: map[string]*ResourceState{
-					"aws_instance.bar": &ResourceState{
+					"aws_instance.baz": &ResourceState{
 						Type: "aws_instance",
 						Primary: &InstanceState{
 							ID: "bar",
@@ -5309,7 +9609,6 @@ func TestContext2Apply_destroyNestedModule(t *testing.T) {
 			},
 		},
 	}
-
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
@@ -5318,7 +9617,25 @@ func TestContext2Apply_destroyNestedModule(t *testing.T) {
 		State: s,
 	})
 
-	// First plan and apply a create operation
+	p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
+		if d.Destroy {
+			return nil, nil
+		}
+
+		result := s.MergeDiff(d)
+		result.ID = "foo"
+		return result, nil
+	}
+	p.DiffFn = func(*InstanceInfo, *InstanceState, *ResourceConfig) (*InstanceDiff, error) {
+		return &InstanceDiff{
+			Attributes: map[string]*ResourceAttrDiff{
+				"num": &ResourceAttrDiff{
+					New: "bar",
+				},
+			},
+		}, nil
+	}
+
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
@@ -5328,29 +9645,38 @@ func TestContext2Apply_destroyNestedModule(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
-	// Test that things were destroyed
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyDestroyNestedModuleStr)
-	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
+	mod := state.RootModule()
+	if _, ok := mod.Resources["aws_instance.baz"]; ok {
+		t.Fatalf("bad: %#v", mod.Resources)
 	}
 }
 
-func TestContext2Apply_destroyDeeplyNestedModule(t *testing.T) {
-	m := testModule(t, "apply-destroy-deeply-nested-module")
+func TestContext2Apply_destroyTaintedProvisioner(t *testing.T) {
+	m := testModule(t, "apply-destroy-provisioner")
 	p := testProvider("aws")
+	pr := testProvisioner()
 	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
 
+	called := false
+	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
+		called = true
+		return nil
+	}
+
 	s := &State{
 		Modules: []*ModuleState{
 			&ModuleState{
-				Path: []string{"root", "child", "subchild", "subsubchild"},
+				Path: rootModulePath,
 				Resources: map[string]*ResourceState{
-					"aws_instance.bar": &ResourceState{
+					"aws_instance.foo": &ResourceState{
 						Type: "aws_instance",
 						Primary: &InstanceState{
 							ID: "bar",
+							Attributes: map[string]string{
+								"id": "bar",
+							},
+							Tainted: true,
 						},
 					},
 				},
@@ -5363,10 +9689,13 @@ func TestContext2Apply_destroyDeeplyNestedModule(t *testing.T) {
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
-		State: s,
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
+		State:   s,
+		Destroy: true,
 	})
 
-	// First plan and apply a create operation
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
@@ -5376,377 +9705,275 @@ func TestContext2Apply_destroyDeeplyNestedModule(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
-	// Test that things were destroyed
+	if called {
+		t.Fatal("provisioner should not be called")
+	}
+
 	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(`
-module.child.subchild.subsubchild:
-  <no state>
-	`)
+	expected := strings.TrimSpace("<no state>")
 	if actual != expected {
 		t.Fatalf("bad: \n%s", actual)
 	}
 }
 
-// https://github.com/hashicorp/terraform/issues/5440
-func TestContext2Apply_destroyModuleWithAttrsReferencingResource(t *testing.T) {
-	m := testModule(t, "apply-destroy-module-with-attrs")
-	p := testProvider("aws")
-	p.ApplyFn = testApplyFn
-	p.DiffFn = testDiffFn
-
-	var state *State
-	var err error
-	{
-		ctx := testContext2(t, &ContextOpts{
-			Module: m,
-			Providers: map[string]ResourceProviderFactory{
-				"aws": testProviderFuncFixed(p),
-			},
-		})
+func TestContext2Apply_error(t *testing.T) {
+	errored := false
 
-		// First plan and apply a create operation
-		if p, err := ctx.Plan(); err != nil {
-			t.Fatalf("plan err: %s", err)
-		} else {
-			t.Logf("Step 1 plan: %s", p)
-		}
+	m := testModule(t, "apply-error")
+	p := testProvider("aws")
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
 
-		state, err = ctx.Apply()
-		if err != nil {
-			t.Fatalf("apply err: %s", err)
+	p.ApplyFn = func(*InstanceInfo, *InstanceState, *InstanceDiff) (*InstanceState, error) {
+		if errored {
+			state := &InstanceState{
+				ID: "bar",
+			}
+			return state, fmt.Errorf("error")
 		}
+		errored = true
 
-		t.Logf("Step 1 state: %s", state)
-	}
-
-	h := new(HookRecordApplyOrder)
-	h.Active = true
-
-	{
-		ctx := testContext2(t, &ContextOpts{
-			Destroy: true,
-			Module:  m,
-			State:   state,
-			Hooks:   []Hook{h},
-			Providers: map[string]ResourceProviderFactory{
-				"aws": testProviderFuncFixed(p),
-			},
-			Variables: map[string]interface{}{
-				"key_name": "foobarkey",
+		return &InstanceState{
+			ID: "foo",
+			Attributes: map[string]string{
+				"num": "2",
 			},
-		})
-
-		// First plan and apply a create operation
-		plan, err := ctx.Plan()
-		if err != nil {
-			t.Fatalf("destroy plan err: %s", err)
-		}
-
-		t.Logf("Step 2 plan: %s", plan)
-
-		var buf bytes.Buffer
-		if err := WritePlan(plan, &buf); err != nil {
-			t.Fatalf("plan write err: %s", err)
-		}
-
-		planFromFile, err := ReadPlan(&buf)
-		if err != nil {
-			t.Fatalf("plan read err: %s", err)
-		}
-
-		ctx, err = planFromFile.Context(&ContextOpts{
-			Providers: map[string]ResourceProviderFactory{
-				"aws": testProviderFuncFixed(p),
+		}, nil
+	}
+	p.DiffFn = func(*InstanceInfo, *InstanceState, *ResourceConfig) (*InstanceDiff, error) {
+		return &InstanceDiff{
+			Attributes: map[string]*ResourceAttrDiff{
+				"num": &ResourceAttrDiff{
+					New: "bar",
+				},
 			},
-		})
-		if err != nil {
-			t.Fatalf("err: %s", err)
-		}
+		}, nil
+	}
 
-		state, err = ctx.Apply()
-		if err != nil {
-			t.Fatalf("destroy apply err: %s", err)
-		}
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
 
-		t.Logf("Step 2 state: %s", state)
+	state, err := ctx.Apply()
+	if err == nil {
+		t.Fatal("should have error")
 	}
 
-	//Test that things were destroyed
 	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(`
-<no state>
-module.child:
-  <no state>
-		`)
+	expected := strings.TrimSpace(testTerraformApplyErrorStr)
 	if actual != expected {
-		t.Fatalf("expected:\n\n%s\n\nactual:\n\n%s", expected, actual)
+		t.Fatalf("bad: \n%s", actual)
 	}
 }
 
-func TestContext2Apply_destroyWithModuleVariableAndCount(t *testing.T) {
-	m := testModule(t, "apply-destroy-mod-var-and-count")
-	p := testProvider("aws")
-	p.ApplyFn = testApplyFn
-	p.DiffFn = testDiffFn
+func TestContext2Apply_errorPartial(t *testing.T) {
+	errored := false
 
-	var state *State
-	var err error
-	{
-		ctx := testContext2(t, &ContextOpts{
-			Module: m,
-			Providers: map[string]ResourceProviderFactory{
-				"aws": testProviderFuncFixed(p),
+	m := testModule(t, "apply-error")
+	p := testProvider("aws")
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.bar": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bar",
+						},
+					},
+				},
 			},
-		})
-
-		// First plan and apply a create operation
-		if _, err := ctx.Plan(); err != nil {
-			t.Fatalf("plan err: %s", err)
-		}
-
-		state, err = ctx.Apply()
-		if err != nil {
-			t.Fatalf("apply err: %s", err)
-		}
+		},
 	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: s,
+	})
 
-	h := new(HookRecordApplyOrder)
-	h.Active = true
-
-	{
-		ctx := testContext2(t, &ContextOpts{
-			Destroy: true,
-			Module:  m,
-			State:   state,
-			Hooks:   []Hook{h},
-			Providers: map[string]ResourceProviderFactory{
-				"aws": testProviderFuncFixed(p),
-			},
-		})
-
-		// First plan and apply a create operation
-		plan, err := ctx.Plan()
-		if err != nil {
-			t.Fatalf("destroy plan err: %s", err)
+	p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
+		if errored {
+			return s, fmt.Errorf("error")
 		}
+		errored = true
 
-		var buf bytes.Buffer
-		if err := WritePlan(plan, &buf); err != nil {
-			t.Fatalf("plan write err: %s", err)
-		}
+		return &InstanceState{
+			ID: "foo",
+			Attributes: map[string]string{
+				"num": "2",
+			},
+		}, nil
+	}
+	p.DiffFn = func(*InstanceInfo, *InstanceState, *ResourceConfig) (*InstanceDiff, error) {
+		return &InstanceDiff{
+			Attributes: map[string]*ResourceAttrDiff{
+				"num": &ResourceAttrDiff{
+					New: "bar",
+				},
+			},
+		}, nil
+	}
 
-		planFromFile, err := ReadPlan(&buf)
-		if err != nil {
-			t.Fatalf("plan read err: %s", err)
-		}
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
 
-		ctx, err = planFromFile.Context(&ContextOpts{
-			Providers: map[string]ResourceProviderFactory{
-				"aws": testProviderFuncFixed(p),
-			},
-		})
-		if err != nil {
-			t.Fatalf("err: %s", err)
-		}
+	state, err := ctx.Apply()
+	if err == nil {
+		t.Fatal("should have error")
+	}
 
-		state, err = ctx.Apply()
-		if err != nil {
-			t.Fatalf("destroy apply err: %s", err)
-		}
+	mod := state.RootModule()
+	if len(mod.Resources) != 2 {
+		t.Fatalf("bad: %#v", mod.Resources)
 	}
 
-	//Test that things were destroyed
 	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(`
-<no state>
-module.child:
-  <no state>
-		`)
+	expected := strings.TrimSpace(testTerraformApplyErrorPartialStr)
 	if actual != expected {
-		t.Fatalf("expected: \n%s\n\nbad: \n%s", expected, actual)
+		t.Fatalf("bad: \n%s", actual)
 	}
 }
 
-func TestContext2Apply_destroyTargetWithModuleVariableAndCount(t *testing.T) {
-	m := testModule(t, "apply-destroy-mod-var-and-count")
+func TestContext2Apply_hook(t *testing.T) {
+	m := testModule(t, "apply-good")
+	h := new(MockHook)
 	p := testProvider("aws")
 	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Hooks:  []Hook{h},
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
 
-	var state *State
-	var err error
-	{
-		ctx := testContext2(t, &ContextOpts{
-			Module: m,
-			Providers: map[string]ResourceProviderFactory{
-				"aws": testProviderFuncFixed(p),
-			},
-		})
-
-		// First plan and apply a create operation
-		if _, err := ctx.Plan(); err != nil {
-			t.Fatalf("plan err: %s", err)
-		}
-
-		state, err = ctx.Apply()
-		if err != nil {
-			t.Fatalf("apply err: %s", err)
-		}
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
 	}
 
-	{
-		ctx := testContext2(t, &ContextOpts{
-			Destroy: true,
-			Module:  m,
-			State:   state,
-			Providers: map[string]ResourceProviderFactory{
-				"aws": testProviderFuncFixed(p),
-			},
-			Targets: []string{"module.child"},
-		})
-
-		_, err := ctx.Plan()
-		if err != nil {
-			t.Fatalf("plan err: %s", err)
-		}
-
-		// Destroy, targeting the module explicitly
-		state, err = ctx.Apply()
-		if err != nil {
-			t.Fatalf("destroy apply err: %s", err)
-		}
+	if _, err := ctx.Apply(); err != nil {
+		t.Fatalf("err: %s", err)
 	}
 
-	//Test that things were destroyed
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(`
-<no state>
-module.child:
-  <no state>
-		`)
-	if actual != expected {
-		t.Fatalf("expected: \n%s\n\nbad: \n%s", expected, actual)
+	if !h.PreApplyCalled {
+		t.Fatal("should be called")
+	}
+	if !h.PostApplyCalled {
+		t.Fatal("should be called")
+	}
+	if !h.PostStateUpdateCalled {
+		t.Fatalf("should call post state update")
+	}
+	if !h.ApplyElapsedCalled {
+		t.Fatal("should be called")
+	}
+	if h.ApplyElapsedDuration <= 0 {
+		t.Fatalf("bad duration: %s", h.ApplyElapsedDuration)
+	}
+	if h.ApplyElapsedAttempts != 1 {
+		t.Fatalf("bad attempts: %d", h.ApplyElapsedAttempts)
 	}
 }
 
-func TestContext2Apply_destroyWithModuleVariableAndCountNested(t *testing.T) {
-	m := testModule(t, "apply-destroy-mod-var-and-count-nested")
+func TestContext2Apply_hookPreApplyProvider(t *testing.T) {
+	m := testModule(t, "apply-provider-pre-apply")
+	h := new(testHookPreApplyProvider)
 	p := testProvider("aws")
 	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
+	pDO := testProvider("do")
+	pDO.ApplyFn = testApplyFn
+	pDO.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Hooks:  []Hook{h},
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+			"do":  testProviderFuncFixed(pDO),
+		},
+	})
 
-	var state *State
-	var err error
-	{
-		ctx := testContext2(t, &ContextOpts{
-			Module: m,
-			Providers: map[string]ResourceProviderFactory{
-				"aws": testProviderFuncFixed(p),
-			},
-		})
-
-		// First plan and apply a create operation
-		if _, err := ctx.Plan(); err != nil {
-			t.Fatalf("plan err: %s", err)
-		}
-
-		state, err = ctx.Apply()
-		if err != nil {
-			t.Fatalf("apply err: %s", err)
-		}
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
 	}
 
-	h := new(HookRecordApplyOrder)
-	h.Active = true
-
-	{
-		ctx := testContext2(t, &ContextOpts{
-			Destroy: true,
-			Module:  m,
-			State:   state,
-			Hooks:   []Hook{h},
-			Providers: map[string]ResourceProviderFactory{
-				"aws": testProviderFuncFixed(p),
-			},
-		})
-
-		// First plan and apply a create operation
-		plan, err := ctx.Plan()
-		if err != nil {
-			t.Fatalf("destroy plan err: %s", err)
-		}
-
-		var buf bytes.Buffer
-		if err := WritePlan(plan, &buf); err != nil {
-			t.Fatalf("plan write err: %s", err)
-		}
-
-		planFromFile, err := ReadPlan(&buf)
-		if err != nil {
-			t.Fatalf("plan read err: %s", err)
-		}
-
-		ctx, err = planFromFile.Context(&ContextOpts{
-			Providers: map[string]ResourceProviderFactory{
-				"aws": testProviderFuncFixed(p),
-			},
-		})
-		if err != nil {
-			t.Fatalf("err: %s", err)
-		}
-
-		state, err = ctx.Apply()
-		if err != nil {
-			t.Fatalf("destroy apply err: %s", err)
-		}
+	if _, err := ctx.Apply(); err != nil {
+		t.Fatalf("err: %s", err)
 	}
 
-	//Test that things were destroyed
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(`
-<no state>
-module.child:
-  <no state>
-module.child.child2:
-  <no state>
-		`)
-	if actual != expected {
-		t.Fatalf("expected: \n%s\n\nbad: \n%s", expected, actual)
+	actual := h.Providers
+	sort.Strings(actual)
+	expected := []string{
+		"root.aws",
+		"root.aws.west",
+		"root.child.aws",
+		"root.do",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+	if len(h.Early) > 0 {
+		t.Fatalf("resources applied before the hook: %#v", h.Early)
 	}
 }
 
-func TestContext2Apply_destroyOutputs(t *testing.T) {
-	m := testModule(t, "apply-destroy-outputs")
-	h := new(HookRecordApplyOrder)
+func TestContext2Apply_hookPreApplyProviderConfigureError(t *testing.T) {
+	m := testModule(t, "apply-provider-pre-apply")
+	h := new(testHookPreApplyProvider)
 	p := testProvider("aws")
 	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
+	pDO := testProvider("do")
+	pDO.ApplyFn = testApplyFn
+	pDO.DiffFn = testDiffFn
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Hooks:  []Hook{h},
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
+			"do":  testProviderFuncFixed(pDO),
 		},
 	})
 
-	// First plan and apply a create operation
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	state, err := ctx.Apply()
+	// Configuring the providers fails, so nothing may be applied
+	p.ConfigureReturnError = fmt.Errorf("bad credentials")
+	pDO.ConfigureReturnError = fmt.Errorf("bad credentials")
 
-	if err != nil {
-		t.Fatalf("err: %s", err)
+	if _, err := ctx.Apply(); err == nil {
+		t.Fatal("should error")
 	}
 
-	// Next, plan and apply a destroy operation
-	h.Active = true
-	ctx = testContext2(t, &ContextOpts{
-		Destroy: true,
-		State:   state,
-		Module:  m,
-		Hooks:   []Hook{h},
+	if len(h.Providers) > 0 {
+		t.Fatalf("bad: %#v", h.Providers)
+	}
+	if p.ApplyCalled || pDO.ApplyCalled {
+		t.Fatal("apply should not be called")
+	}
+}
+
+func TestContext2Apply_hookPreApplyProviderError(t *testing.T) {
+	m := testModule(t, "apply-good")
+	h := new(MockHook)
+	h.PreApplyProviderError = fmt.Errorf("refresh failed")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Hooks:  []Hook{h},
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
@@ -5756,26 +9983,74 @@ func TestContext2Apply_destroyOutputs(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
-	state, err = ctx.Apply()
-	if err != nil {
-		t.Fatalf("err: %s", err)
+	_, err := ctx.Apply()
+	if err == nil || !strings.Contains(err.Error(), "refresh failed") {
+		t.Fatalf("bad: %s", err)
+	}
+	if !reflect.DeepEqual(h.PreApplyProviderPath, rootModulePath) {
+		t.Fatalf("bad: %#v", h.PreApplyProviderPath)
+	}
+	if h.PreApplyProviderName != "aws" {
+		t.Fatalf("bad: %#v", h.PreApplyProviderName)
+	}
+	if p.ApplyCalled {
+		t.Fatal("apply should not be called")
 	}
+}
+
+// testHookPreApplyProvider records the providers the PreApplyProvider
+// hook is called for, and the resources applied before their provider
+// was reported.
+type testHookPreApplyProvider struct {
+	NilHook
+	sync.Mutex
+
+	Providers []string
+	Early     []string
+}
+
+func (h *testHookPreApplyProvider) PreApplyProvider(path []string, name string) (HookAction, error) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.Providers = append(h.Providers, strings.Join(append(append([]string{}, path...), name), "."))
+	return HookActionContinue, nil
+}
+
+func (h *testHookPreApplyProvider) PreApply(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (HookAction, error) {
+	h.Lock()
+	defer h.Unlock()
 
-	mod := state.RootModule()
-	if len(mod.Resources) > 0 {
-		t.Fatalf("bad: %#v", mod)
+	// Resources of the child module and of the two provider types are
+	// told apart by their type and module, aliases by their name.
+	provider := resourceProvider(info.Type, "")
+	if strings.HasPrefix(info.Id, "aws_instance.west") {
+		provider = "aws.west"
+	}
+	key := strings.Join(append(append([]string{}, info.ModulePath...), provider), ".")
+	for _, p := range h.Providers {
+		if p == key {
+			return HookActionContinue, nil
+		}
 	}
+
+	h.Early = append(h.Early, info.HumanId())
+	return HookActionContinue, nil
 }
 
-func TestContext2Apply_destroyOrphan(t *testing.T) {
-	m := testModule(t, "apply-error")
+func TestContext2Apply_hookOrphan(t *testing.T) {
+	m := testModule(t, "apply-blank")
+	h := new(MockHook)
 	p := testProvider("aws")
-	s := &State{
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+
+	state := &State{
 		Modules: []*ModuleState{
 			&ModuleState{
 				Path: rootModulePath,
 				Resources: map[string]*ResourceState{
-					"aws_instance.baz": &ResourceState{
+					"aws_instance.bar": &ResourceState{
 						Type: "aws_instance",
 						Primary: &InstanceState{
 							ID: "bar",
@@ -5785,21 +10060,52 @@ func TestContext2Apply_destroyOrphan(t *testing.T) {
 			},
 		},
 	}
+
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
+		State:  state,
+		Hooks:  []Hook{h},
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
-		State: s,
 	})
 
-	p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
-		if d.Destroy {
-			return nil, nil
-		}
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if _, err := ctx.Apply(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !h.PreApplyCalled {
+		t.Fatal("should be called")
+	}
+	if !h.PostApplyCalled {
+		t.Fatal("should be called")
+	}
+	if !h.PostStateUpdateCalled {
+		t.Fatalf("should call post state update")
+	}
+}
+
+func TestContext2Apply_idAttr(t *testing.T) {
+	m := testModule(t, "apply-idattr")
+	p := testProvider("aws")
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
 
+	p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
 		result := s.MergeDiff(d)
 		result.ID = "foo"
+		result.Attributes = map[string]string{
+			"id": "bar",
+		}
+
 		return result, nil
 	}
 	p.DiffFn = func(*InstanceInfo, *InstanceState, *ResourceConfig) (*InstanceDiff, error) {
@@ -5822,54 +10128,72 @@ func TestContext2Apply_destroyOrphan(t *testing.T) {
 	}
 
 	mod := state.RootModule()
-	if _, ok := mod.Resources["aws_instance.baz"]; ok {
-		t.Fatalf("bad: %#v", mod.Resources)
+	rs, ok := mod.Resources["aws_instance.foo"]
+	if !ok {
+		t.Fatal("not in state")
+	}
+	if rs.Primary.ID != "foo" {
+		t.Fatalf("bad: %#v", rs.Primary.ID)
+	}
+	if rs.Primary.Attributes["id"] != "foo" {
+		t.Fatalf("bad: %#v", rs.Primary.Attributes)
 	}
 }
 
-func TestContext2Apply_destroyTaintedProvisioner(t *testing.T) {
-	m := testModule(t, "apply-destroy-provisioner")
+func TestContext2Apply_outputBasic(t *testing.T) {
+	m := testModule(t, "apply-output")
 	p := testProvider("aws")
-	pr := testProvisioner()
 	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
 
-	called := false
-	pr.ApplyFn = func(rs *InstanceState, c *ResourceConfig) error {
-		called = true
-		return nil
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
 	}
 
-	s := &State{
-		Modules: []*ModuleState{
-			&ModuleState{
-				Path: rootModulePath,
-				Resources: map[string]*ResourceState{
-					"aws_instance.foo": &ResourceState{
-						Type: "aws_instance",
-						Primary: &InstanceState{
-							ID: "bar",
-							Attributes: map[string]string{
-								"id": "bar",
-							},
-							Tainted: true,
-						},
-					},
-				},
-			},
-		},
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyOutputStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
 	}
+}
+
+func TestContext2Apply_outputComputedId(t *testing.T) {
+	m := testModule(t, "apply-output-computed-id")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+	p.ApplyFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		d *InstanceDiff) (*InstanceState, error) {
+		// Slow down the apply so an unordered output would be evaluated
+		// before the resource is created.
+		time.Sleep(10 * time.Millisecond)
+
+		result, err := testApplyFn(info, s, d)
+		if err != nil {
+			return nil, err
+		}
 
+		result.ID = "i-" + info.HumanId()
+		result.Attributes["id"] = result.ID
+		return result, nil
+	}
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
-		Provisioners: map[string]ResourceProvisionerFactory{
-			"shell": testProvisionerFuncFixed(pr),
-		},
-		State:   s,
-		Destroy: true,
 	})
 
 	if _, err := ctx.Plan(); err != nil {
@@ -5881,152 +10205,223 @@ func TestContext2Apply_destroyTaintedProvisioner(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
-	if called {
-		t.Fatal("provisioner should not be called")
+	expected := map[string]string{
+		"id":          "i-aws_instance.foo",
+		"child_id":    "i-module.child.aws_instance.bar",
+		"child_value": "i-aws_instance.foo",
 	}
-
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace("<no state>")
-	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
+	for k, v := range expected {
+		actual, ok := state.RootModule().Outputs[k]
+		if !ok || actual.Value != v {
+			t.Fatalf("bad output %q: %#v\n\n%s", k, actual, state)
+		}
 	}
 }
 
-func TestContext2Apply_error(t *testing.T) {
-	errored := false
-
-	m := testModule(t, "apply-error")
+// Test that hooks never see the values of sensitive attributes, while
+// the apply still uses them.
+func TestContext2Apply_sensitiveHook(t *testing.T) {
+	m := testModule(t, "apply-sensitive-hook")
+	h := new(MockHook)
 	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		c *ResourceConfig) (*InstanceDiff, error) {
+		d, err := testDiffFn(info, s, c)
+		if err != nil {
+			return nil, err
+		}
+
+		d.Attributes["password"].Sensitive = true
+		d.Attributes["keys.#"] = &ResourceAttrDiff{
+			Old:       "",
+			New:       "1",
+			Sensitive: true,
+		}
+		d.Attributes["keys.0"] = &ResourceAttrDiff{
+			Old: "",
+			New: "s3cret",
+		}
+		return d, nil
+	}
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
+		Hooks:  []Hook{h},
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
 	})
 
-	p.ApplyFn = func(*InstanceInfo, *InstanceState, *InstanceDiff) (*InstanceState, error) {
-		if errored {
-			state := &InstanceState{
-				ID: "bar",
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for name, d := range map[string]*InstanceDiff{
+		"PostDiff": h.PostDiffDiff,
+		"PreApply": h.PreApplyDiff,
+	} {
+		for _, k := range []string{"password", "keys.#", "keys.0"} {
+			attr := d.Attributes[k]
+			if attr.New != sensitiveRedacted || !attr.Sensitive {
+				t.Fatalf("%s: %s should be redacted: %#v", name, k, attr)
 			}
-			return state, fmt.Errorf("error")
 		}
-		errored = true
+		if attr := d.Attributes["foo"]; attr.New != "bar" {
+			t.Fatalf("%s: foo should not be redacted: %#v", name, attr)
+		}
+	}
 
-		return &InstanceState{
-			ID: "foo",
-			Attributes: map[string]string{
-				"num": "2",
-			},
-		}, nil
+	checkStateString(t, state, `
+aws_instance.foo:
+  ID = foo
+  foo = bar
+  keys.# = 1
+  keys.0 = s3cret
+  password = hunter2
+  type = aws_instance
+	`)
+}
+
+func TestContext2Apply_outputInvalid(t *testing.T) {
+	m := testModule(t, "apply-output-invalid")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	_, err := ctx.Plan()
+	if err == nil {
+		t.Fatalf("err: %s", err)
 	}
-	p.DiffFn = func(*InstanceInfo, *InstanceState, *ResourceConfig) (*InstanceDiff, error) {
-		return &InstanceDiff{
-			Attributes: map[string]*ResourceAttrDiff{
-				"num": &ResourceAttrDiff{
-					New: "bar",
-				},
-			},
-		}, nil
+	if !strings.Contains(err.Error(), "is not a valid type") {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestContext2Apply_outputAdd(t *testing.T) {
+	m1 := testModule(t, "apply-output-add-before")
+	p1 := testProvider("aws")
+	p1.ApplyFn = testApplyFn
+	p1.DiffFn = testDiffFn
+	ctx1 := testContext2(t, &ContextOpts{
+		Module: m1,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p1),
+		},
+	})
+
+	if _, err := ctx1.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state1, err := ctx1.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	m2 := testModule(t, "apply-output-add-after")
+	p2 := testProvider("aws")
+	p2.ApplyFn = testApplyFn
+	p2.DiffFn = testDiffFn
+	ctx2 := testContext2(t, &ContextOpts{
+		Module: m2,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p2),
+		},
+		State: state1,
+	})
+
+	if _, err := ctx2.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state2, err := ctx2.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(state2.String())
+	expected := strings.TrimSpace(testTerraformApplyOutputAddStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
 	}
+}
+
+func TestContext2Apply_outputList(t *testing.T) {
+	m := testModule(t, "apply-output-list")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
 
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
 	state, err := ctx.Apply()
-	if err == nil {
-		t.Fatal("should have error")
+	if err != nil {
+		t.Fatalf("err: %s", err)
 	}
 
 	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyErrorStr)
+	expected := strings.TrimSpace(testTerraformApplyOutputListStr)
 	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
+		t.Fatalf("expected: \n%s\n\nbad: \n%s", expected, actual)
 	}
 }
 
-func TestContext2Apply_errorPartial(t *testing.T) {
-	errored := false
-
-	m := testModule(t, "apply-error")
+func TestContext2Apply_outputMulti(t *testing.T) {
+	m := testModule(t, "apply-output-multi")
 	p := testProvider("aws")
-	s := &State{
-		Modules: []*ModuleState{
-			&ModuleState{
-				Path: rootModulePath,
-				Resources: map[string]*ResourceState{
-					"aws_instance.bar": &ResourceState{
-						Type: "aws_instance",
-						Primary: &InstanceState{
-							ID: "bar",
-						},
-					},
-				},
-			},
-		},
-	}
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
-		State: s,
 	})
 
-	p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
-		if errored {
-			return s, fmt.Errorf("error")
-		}
-		errored = true
-
-		return &InstanceState{
-			ID: "foo",
-			Attributes: map[string]string{
-				"num": "2",
-			},
-		}, nil
-	}
-	p.DiffFn = func(*InstanceInfo, *InstanceState, *ResourceConfig) (*InstanceDiff, error) {
-		return &InstanceDiff{
-			Attributes: map[string]*ResourceAttrDiff{
-				"num": &ResourceAttrDiff{
-					New: "bar",
-				},
-			},
-		}, nil
-	}
-
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
 	state, err := ctx.Apply()
-	if err == nil {
-		t.Fatal("should have error")
-	}
-
-	mod := state.RootModule()
-	if len(mod.Resources) != 2 {
-		t.Fatalf("bad: %#v", mod.Resources)
+	if err != nil {
+		t.Fatalf("err: %s", err)
 	}
 
 	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyErrorPartialStr)
+	expected := strings.TrimSpace(testTerraformApplyOutputMultiStr)
 	if actual != expected {
 		t.Fatalf("bad: \n%s", actual)
 	}
 }
 
-func TestContext2Apply_hook(t *testing.T) {
-	m := testModule(t, "apply-good")
-	h := new(MockHook)
+func TestContext2Apply_outputMultiIndex(t *testing.T) {
+	m := testModule(t, "apply-output-multi-index")
 	p := testProvider("aws")
 	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
-		Hooks:  []Hook{h},
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
@@ -6036,29 +10431,39 @@ func TestContext2Apply_hook(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
-	if _, err := ctx.Apply(); err != nil {
+	state, err := ctx.Apply()
+	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	if !h.PreApplyCalled {
-		t.Fatal("should be called")
-	}
-	if !h.PostApplyCalled {
-		t.Fatal("should be called")
-	}
-	if !h.PostStateUpdateCalled {
-		t.Fatalf("should call post state update")
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyOutputMultiIndexStr)
+	if actual != expected {
+		t.Fatalf("bad: \n%s", actual)
 	}
 }
 
-func TestContext2Apply_hookOrphan(t *testing.T) {
-	m := testModule(t, "apply-blank")
-	h := new(MockHook)
+func TestContext2Apply_taintX(t *testing.T) {
+	m := testModule(t, "apply-taint")
 	p := testProvider("aws")
-	p.ApplyFn = testApplyFn
-	p.DiffFn = testDiffFn
 
-	state := &State{
+	// destroyCount tests against regression of
+	// https://github.com/hashicorp/terraform/issues/1056
+	var destroyCount = int32(0)
+	var once sync.Once
+	simulateProviderDelay := func() {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
+		once.Do(simulateProviderDelay)
+		if d.Destroy {
+			atomic.AddInt32(&destroyCount, 1)
+		}
+		return testApplyFn(info, s, d)
+	}
+	p.DiffFn = testDiffFn
+	s := &State{
 		Modules: []*ModuleState{
 			&ModuleState{
 				Path: rootModulePath,
@@ -6066,73 +10471,96 @@ func TestContext2Apply_hookOrphan(t *testing.T) {
 					"aws_instance.bar": &ResourceState{
 						Type: "aws_instance",
 						Primary: &InstanceState{
-							ID: "bar",
+							ID: "baz",
+							Attributes: map[string]string{
+								"num":  "2",
+								"type": "aws_instance",
+							},
+							Tainted: true,
 						},
 					},
 				},
 			},
 		},
 	}
-
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
-		State:  state,
-		Hooks:  []Hook{h},
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
+		State: s,
 	})
 
-	if _, err := ctx.Plan(); err != nil {
+	if p, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
+	} else {
+		t.Logf("plan: %s", p)
 	}
 
-	if _, err := ctx.Apply(); err != nil {
+	state, err := ctx.Apply()
+	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	if !h.PreApplyCalled {
-		t.Fatal("should be called")
-	}
-	if !h.PostApplyCalled {
-		t.Fatal("should be called")
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyTaintStr)
+	if actual != expected {
+		t.Fatalf("bad:\n%s", actual)
 	}
-	if !h.PostStateUpdateCalled {
-		t.Fatalf("should call post state update")
+
+	if destroyCount != 1 {
+		t.Fatalf("Expected 1 destroy, got %d", destroyCount)
 	}
 }
 
-func TestContext2Apply_idAttr(t *testing.T) {
-	m := testModule(t, "apply-idattr")
+func TestContext2Apply_taintDep(t *testing.T) {
+	m := testModule(t, "apply-taint-dep")
 	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "baz",
+							Attributes: map[string]string{
+								"num":  "2",
+								"type": "aws_instance",
+							},
+							Tainted: true,
+						},
+					},
+					"aws_instance.bar": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bar",
+							Attributes: map[string]string{
+								"foo":  "baz",
+								"num":  "2",
+								"type": "aws_instance",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
+		State: s,
 	})
 
-	p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
-		result := s.MergeDiff(d)
-		result.ID = "foo"
-		result.Attributes = map[string]string{
-			"id": "bar",
-		}
-
-		return result, nil
-	}
-	p.DiffFn = func(*InstanceInfo, *InstanceState, *ResourceConfig) (*InstanceDiff, error) {
-		return &InstanceDiff{
-			Attributes: map[string]*ResourceAttrDiff{
-				"num": &ResourceAttrDiff{
-					New: "bar",
-				},
-			},
-		}, nil
-	}
-
-	if _, err := ctx.Plan(); err != nil {
+	if p, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
+	} else {
+		t.Logf("plan: %s", p)
 	}
 
 	state, err := ctx.Apply()
@@ -6140,33 +10568,61 @@ func TestContext2Apply_idAttr(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
-	mod := state.RootModule()
-	rs, ok := mod.Resources["aws_instance.foo"]
-	if !ok {
-		t.Fatal("not in state")
-	}
-	if rs.Primary.ID != "foo" {
-		t.Fatalf("bad: %#v", rs.Primary.ID)
+	actual := strings.TrimSpace(state.String())
+	expected := strings.TrimSpace(testTerraformApplyTaintDepStr)
+	if actual != expected {
+		t.Fatalf("bad:\n%s", actual)
 	}
-	if rs.Primary.Attributes["id"] != "foo" {
-		t.Fatalf("bad: %#v", rs.Primary.Attributes)
+}
+
+func TestContext2Apply_taintDepRequiresNew(t *testing.T) {
+	m := testModule(t, "apply-taint-dep-requires-new")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "baz",
+							Attributes: map[string]string{
+								"num":  "2",
+								"type": "aws_instance",
+							},
+							Tainted: true,
+						},
+					},
+					"aws_instance.bar": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bar",
+							Attributes: map[string]string{
+								"foo":  "baz",
+								"num":  "2",
+								"type": "aws_instance",
+							},
+						},
+					},
+				},
+			},
+		},
 	}
-}
-
-func TestContext2Apply_outputBasic(t *testing.T) {
-	m := testModule(t, "apply-output")
-	p := testProvider("aws")
-	p.ApplyFn = testApplyFn
-	p.DiffFn = testDiffFn
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
+		State: s,
 	})
 
-	if _, err := ctx.Plan(); err != nil {
+	if p, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
+	} else {
+		t.Logf("plan: %s", p)
 	}
 
 	state, err := ctx.Apply()
@@ -6175,120 +10631,212 @@ func TestContext2Apply_outputBasic(t *testing.T) {
 	}
 
 	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyOutputStr)
+	expected := strings.TrimSpace(testTerraformApplyTaintDepRequireNewStr)
 	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
+		t.Fatalf("bad:\n%s", actual)
 	}
 }
 
-func TestContext2Apply_outputInvalid(t *testing.T) {
-	m := testModule(t, "apply-output-invalid")
+func TestContext2Apply_stateLog(t *testing.T) {
+	m := testModule(t, "apply-state-log")
 	p := testProvider("aws")
 	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
-	ctx := testContext2(t, &ContextOpts{
-		Module: m,
-		Providers: map[string]ResourceProviderFactory{
-			"aws": testProviderFuncFixed(p),
-		},
-	})
 
-	_, err := ctx.Plan()
-	if err == nil {
-		t.Fatalf("err: %s", err)
-	}
-	if !strings.Contains(err.Error(), "is not a valid type") {
-		t.Fatalf("err: %s", err)
+	var buf bytes.Buffer
+	var state *State
+	cases := []struct {
+		Value    string
+		Destroy  bool
+		Expected []StateTransition
+	}{
+		{
+			"1", false,
+			[]StateTransition{
+				{Addr: "aws_instance.foo", Action: StateTransitionCreate, NewSerial: 1},
+			},
+		},
+		{
+			"2", false,
+			[]StateTransition{
+				{Addr: "aws_instance.foo", Action: StateTransitionUpdate, NewSerial: 1},
+			},
+		},
+		{
+			"2", true,
+			[]StateTransition{
+				{Addr: "aws_instance.foo", Action: StateTransitionDestroy, NewSerial: 1},
+			},
+		},
 	}
-}
 
-func TestContext2Apply_outputAdd(t *testing.T) {
-	m1 := testModule(t, "apply-output-add-before")
-	p1 := testProvider("aws")
-	p1.ApplyFn = testApplyFn
-	p1.DiffFn = testDiffFn
-	ctx1 := testContext2(t, &ContextOpts{
-		Module: m1,
-		Providers: map[string]ResourceProviderFactory{
-			"aws": testProviderFuncFixed(p1),
-		},
-	})
+	for i, tc := range cases {
+		ctx := testContext2(t, &ContextOpts{
+			Module: m,
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+			Variables: map[string]interface{}{
+				"value": tc.Value,
+			},
+			State:    state,
+			Destroy:  tc.Destroy,
+			StateLog: &buf,
+		})
 
-	if _, err := ctx1.Plan(); err != nil {
-		t.Fatalf("err: %s", err)
+		// Plan changes a copy of the state, so it doesn't log anything
+		if _, err := ctx.Plan(); err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+		if buf.Len() > 0 {
+			t.Fatalf("%d: plan should not log: %s", i, buf.String())
+		}
+
+		var err error
+		state, err = ctx.Apply()
+		if err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+
+		actual := testStateTransitions(t, &buf)
+		if !reflect.DeepEqual(actual, tc.Expected) {
+			t.Fatalf("%d: bad: %#v", i, actual)
+		}
 	}
+}
 
-	state1, err := ctx1.Apply()
-	if err != nil {
-		t.Fatalf("err: %s", err)
+func TestContext2Apply_stateLogCreateBeforeDestroy(t *testing.T) {
+	m := testModule(t, "apply-state-log-cbd")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+
+	state := &State{
+		Serial: 4,
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bar",
+							Attributes: map[string]string{
+								"require_new": "1",
+							},
+						},
+					},
+				},
+			},
+		},
 	}
 
-	m2 := testModule(t, "apply-output-add-after")
-	p2 := testProvider("aws")
-	p2.ApplyFn = testApplyFn
-	p2.DiffFn = testDiffFn
-	ctx2 := testContext2(t, &ContextOpts{
-		Module: m2,
+	var buf bytes.Buffer
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
 		Providers: map[string]ResourceProviderFactory{
-			"aws": testProviderFuncFixed(p2),
+			"aws": testProviderFuncFixed(p),
 		},
-		State: state1,
+		Variables: map[string]interface{}{
+			"value": "2",
+		},
+		State:    state,
+		StateLog: &buf,
 	})
 
-	if _, err := ctx2.Plan(); err != nil {
+	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	state2, err := ctx2.Apply()
-	if err != nil {
+	if _, err := ctx.Apply(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	actual := strings.TrimSpace(state2.String())
-	expected := strings.TrimSpace(testTerraformApplyOutputAddStr)
-	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
+	// The old instance is deposed, replaced and then destroyed
+	expected := []StateTransition{
+		{Addr: "aws_instance.foo", Action: StateTransitionDepose, OldSerial: 4, NewSerial: 5},
+		{Addr: "aws_instance.foo", Action: StateTransitionCreate, OldSerial: 4, NewSerial: 5},
+		{Addr: "aws_instance.foo", Action: StateTransitionDestroy, Deposed: true, OldSerial: 4, NewSerial: 5},
+	}
+	actual := testStateTransitions(t, &buf)
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
 	}
 }
 
-func TestContext2Apply_outputList(t *testing.T) {
-	m := testModule(t, "apply-output-list")
+// The state is still logged when the nodes are evaluated with the
+// resource timeout.
+func TestContext2Apply_stateLogResourceTimeout(t *testing.T) {
+	m := testModule(t, "apply-state-log")
 	p := testProvider("aws")
 	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
+
+	var buf bytes.Buffer
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
+		Variables: map[string]interface{}{
+			"value": "1",
+		},
+		ResourceTimeout: time.Minute,
+		StateLog:        &buf,
 	})
 
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	state, err := ctx.Apply()
-	if err != nil {
+	if _, err := ctx.Apply(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyOutputListStr)
-	if actual != expected {
-		t.Fatalf("expected: \n%s\n\nbad: \n%s", expected, actual)
+	expected := []StateTransition{
+		{Addr: "aws_instance.foo", Action: StateTransitionCreate, NewSerial: 1},
+	}
+	actual := testStateTransitions(t, &buf)
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
 	}
 }
 
-func TestContext2Apply_outputMulti(t *testing.T) {
-	m := testModule(t, "apply-output-multi")
+func TestContext2Apply_attributeFilter(t *testing.T) {
+	m := testModule(t, "apply-attribute-filter")
 	p := testProvider("aws")
 	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bar",
+							Attributes: map[string]string{
+								"id":     "bar",
+								"foo":    "old",
+								"bar":    "old",
+								"list.#": "1",
+								"list.0": "a",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
+		State:           state,
+		AttributeFilter: []string{"foo", "list.*"},
 	})
 
 	if _, err := ctx.Plan(); err != nil {
@@ -6300,201 +10848,273 @@ func TestContext2Apply_outputMulti(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyOutputMultiStr)
-	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
+	// Only the changes to the attributes that match are applied
+	actual := state.RootModule().Resources["aws_instance.foo"].Primary.Attributes
+	expected := map[string]string{
+		"id":     "foo",
+		"foo":    "new",
+		"bar":    "old",
+		"list.#": "2",
+		"list.0": "a",
+		"list.1": "b",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
 	}
 }
 
-func TestContext2Apply_outputMultiIndex(t *testing.T) {
-	m := testModule(t, "apply-output-multi-index")
+func TestContext2Apply_idChangeOnUpdate(t *testing.T) {
+	m := testModule(t, "apply-id-change")
 	p := testProvider("aws")
-	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
+	p.ApplyFn = testApplyIdChangeFn
+
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
+		State: testApplyIdChangeState(),
 	})
-
 	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
 	}
-
 	state, err := ctx.Apply()
 	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyOutputMultiIndexStr)
-	if actual != expected {
-		t.Fatalf("bad: \n%s", actual)
+	// Only the updated instance has the new ID. The dependent didn't plan
+	// for it, so it still has the old one.
+	checkStateString(t, state, testTerraformApplyIdChangeStr)
+
+	warns := ctx.ApplyWarnings()
+	if len(warns) != 1 || !strings.Contains(warns[0], `the ID changed from "i-1" to "i-1-new"`) {
+		t.Fatalf("bad: %#v", warns)
 	}
 }
 
-func TestContext2Apply_taintX(t *testing.T) {
-	m := testModule(t, "apply-taint")
+func TestContext2Apply_idChangeOnUpdatePlanned(t *testing.T) {
+	m := testModule(t, "apply-id-change")
 	p := testProvider("aws")
+	p.ApplyFn = testApplyIdChangeFn
 
-	// destroyCount tests against regression of
-	// https://github.com/hashicorp/terraform/issues/1056
-	var destroyCount = int32(0)
-	var once sync.Once
-	simulateProviderDelay := func() {
-		time.Sleep(10 * time.Millisecond)
-	}
-
-	p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
-		once.Do(simulateProviderDelay)
-		if d.Destroy {
-			atomic.AddInt32(&destroyCount, 1)
+	// The provider plans the new ID of the instance it changes
+	p.DiffFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		c *ResourceConfig) (*InstanceDiff, error) {
+		d, err := testDiffFn(info, s, c)
+		if err != nil || d.Empty() || info.Id != "aws_instance.foo.1" {
+			return d, err
 		}
-		return testApplyFn(info, s, d)
-	}
-	p.DiffFn = testDiffFn
-	s := &State{
-		Modules: []*ModuleState{
-			&ModuleState{
-				Path: rootModulePath,
-				Resources: map[string]*ResourceState{
-					"aws_instance.bar": &ResourceState{
-						Type: "aws_instance",
-						Primary: &InstanceState{
-							ID: "baz",
-							Attributes: map[string]string{
-								"num":  "2",
-								"type": "aws_instance",
-							},
-							Tainted: true,
-						},
-					},
-				},
-			},
-		},
+		d.Attributes["id"] = &ResourceAttrDiff{Old: s.ID, NewComputed: true}
+		return d, nil
 	}
+
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
-		State: s,
+		State: testApplyIdChangeState(),
 	})
-
-	if p, err := ctx.Plan(); err != nil {
+	if _, err := ctx.Plan(); err != nil {
 		t.Fatalf("err: %s", err)
-	} else {
-		t.Logf("plan: %s", p)
 	}
-
 	state, err := ctx.Apply()
 	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyTaintStr)
-	if actual != expected {
-		t.Fatalf("bad:\n%s", actual)
+	// The dependent gets the new ID in the same apply
+	checkStateString(t, state, testTerraformApplyIdChangePlannedStr)
+
+	if warns := ctx.ApplyWarnings(); len(warns) > 0 {
+		t.Fatalf("bad: %#v", warns)
 	}
+}
 
-	if destroyCount != 1 {
-		t.Fatalf("Expected 1 destroy, got %d", destroyCount)
+// testApplyIdChangeFn applies like testApplyFn, but keeps the IDs of the
+// instances it updates except aws_instance.foo.1, which gets a new one.
+func testApplyIdChangeFn(
+	info *InstanceInfo,
+	s *InstanceState,
+	d *InstanceDiff) (*InstanceState, error) {
+	id := s.ID
+	result, err := testApplyFn(info, s, d)
+	if err != nil || result == nil {
+		return result, err
+	}
+
+	if id == "" {
+		id = result.ID
+	}
+	if info.Id == "aws_instance.foo.1" {
+		id = "i-1-new"
 	}
+	result.ID = id
+	result.Attributes["id"] = id
+
+	return result, nil
 }
 
-func TestContext2Apply_taintDep(t *testing.T) {
-	m := testModule(t, "apply-taint-dep")
-	p := testProvider("aws")
-	p.ApplyFn = testApplyFn
-	p.DiffFn = testDiffFn
-	s := &State{
+func testApplyIdChangeState() *State {
+	instance := func(id string, attrs map[string]string) *ResourceState {
+		attrs["id"] = id
+		attrs["type"] = "aws_instance"
+		return &ResourceState{
+			Type: "aws_instance",
+			Primary: &InstanceState{
+				ID:         id,
+				Attributes: attrs,
+			},
+		}
+	}
+
+	return &State{
 		Modules: []*ModuleState{
 			&ModuleState{
 				Path: rootModulePath,
 				Resources: map[string]*ResourceState{
-					"aws_instance.foo": &ResourceState{
-						Type: "aws_instance",
-						Primary: &InstanceState{
-							ID: "baz",
-							Attributes: map[string]string{
-								"num":  "2",
-								"type": "aws_instance",
-							},
-							Tainted: true,
-						},
-					},
-					"aws_instance.bar": &ResourceState{
-						Type: "aws_instance",
-						Primary: &InstanceState{
-							ID: "bar",
-							Attributes: map[string]string{
-								"foo":  "baz",
-								"num":  "2",
-								"type": "aws_instance",
-							},
-						},
-					},
+					"aws_instance.foo.0": instance("i-0", map[string]string{"foo": "bar"}),
+					"aws_instance.foo.1": instance("i-1", map[string]string{"foo": "old"}),
+					"aws_instance.dep":   instance("d", map[string]string{"ids": "i-0,i-1"}),
 				},
 			},
 		},
 	}
+}
+
+func TestContext2Apply_applyProgress(t *testing.T) {
+	m := testModule(t, "apply-progress")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+
+	var l sync.Mutex
+	var applied []string
+	fail := true
+	p.ApplyFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		d *InstanceDiff) (*InstanceState, error) {
+		l.Lock()
+		defer l.Unlock()
+		if info.Id == "aws_instance.b" && fail {
+			return nil, fmt.Errorf("interrupted")
+		}
+		applied = append(applied, info.Id)
+		return testApplyFn(info, s, d)
+	}
+	providers := map[string]ResourceProviderFactory{
+		"aws": testProviderFuncFixed(p),
+	}
+
 	ctx := testContext2(t, &ContextOpts{
-		Module: m,
-		Providers: map[string]ResourceProviderFactory{
-			"aws": testProviderFuncFixed(p),
-		},
-		State: s,
+		Module:    m,
+		Providers: providers,
 	})
-
-	if p, err := ctx.Plan(); err != nil {
+	plan, err := ctx.Plan()
+	if err != nil {
 		t.Fatalf("err: %s", err)
-	} else {
-		t.Logf("plan: %s", p)
 	}
 
+	// The interrupted apply
+	progress := NewApplyProgress()
+	ctx = testContext2(t, &ContextOpts{
+		Module:        m,
+		Providers:     providers,
+		Diff:          plan.Diff.DeepCopy(),
+		ApplyProgress: progress,
+	})
 	state, err := ctx.Apply()
+	if err == nil {
+		t.Fatal("should error")
+	}
+
+	expected := []string{"aws_instance.a", "aws_instance.c"}
+	if actual := progress.Applied(); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	// Resume with the persisted progress
+	var buf bytes.Buffer
+	if err := WriteApplyProgress(progress, &buf); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	progress, err = ReadApplyProgress(&buf)
 	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyTaintDepStr)
-	if actual != expected {
-		t.Fatalf("bad:\n%s", actual)
+	fail = false
+	applied = nil
+	ctx = testContext2(t, &ContextOpts{
+		Module:        m,
+		Providers:     providers,
+		State:         state,
+		Diff:          plan.Diff.DeepCopy(),
+		ApplyProgress: progress,
+	})
+	state, err = ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if expected := []string{"aws_instance.b"}; !reflect.DeepEqual(applied, expected) {
+		t.Fatalf("bad: %#v", applied)
 	}
+
+	checkStateString(t, state, `
+aws_instance.a:
+  ID = foo
+  foo = a
+  type = aws_instance
+aws_instance.b:
+  ID = foo
+  foo = b
+  type = aws_instance
+aws_instance.c:
+  ID = foo
+  foo = a
+  type = aws_instance
+
+  Dependencies:
+    aws_instance.a
+	`)
 }
 
-func TestContext2Apply_taintDepRequiresNew(t *testing.T) {
-	m := testModule(t, "apply-taint-dep-requires-new")
+func TestContext2Apply_applyProgressDependencyChanged(t *testing.T) {
+	m := testModule(t, "apply-progress")
 	p := testProvider("aws")
-	p.ApplyFn = testApplyFn
 	p.DiffFn = testDiffFn
-	s := &State{
+
+	fail := true
+	p.ApplyFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		d *InstanceDiff) (*InstanceState, error) {
+		if info.Id == "aws_instance.b" && fail {
+			return nil, fmt.Errorf("interrupted")
+		}
+		return testApplyFn(info, s, d)
+	}
+	providers := map[string]ResourceProviderFactory{
+		"aws": testProviderFuncFixed(p),
+	}
+
+	// a already exists, so only b and c are applied
+	state := &State{
 		Modules: []*ModuleState{
 			&ModuleState{
 				Path: rootModulePath,
 				Resources: map[string]*ResourceState{
-					"aws_instance.foo": &ResourceState{
-						Type: "aws_instance",
-						Primary: &InstanceState{
-							ID: "baz",
-							Attributes: map[string]string{
-								"num":  "2",
-								"type": "aws_instance",
-							},
-							Tainted: true,
-						},
-					},
-					"aws_instance.bar": &ResourceState{
+					"aws_instance.a": &ResourceState{
 						Type: "aws_instance",
 						Primary: &InstanceState{
-							ID: "bar",
+							ID: "foo",
 							Attributes: map[string]string{
-								"foo":  "baz",
-								"num":  "2",
+								"foo":  "a",
 								"type": "aws_instance",
 							},
 						},
@@ -6503,29 +11123,53 @@ func TestContext2Apply_taintDepRequiresNew(t *testing.T) {
 			},
 		},
 	}
+
 	ctx := testContext2(t, &ContextOpts{
-		Module: m,
-		Providers: map[string]ResourceProviderFactory{
-			"aws": testProviderFuncFixed(p),
-		},
-		State: s,
+		Module:    m,
+		Providers: providers,
+		State:     state,
 	})
-
-	if p, err := ctx.Plan(); err != nil {
+	plan, err := ctx.Plan()
+	if err != nil {
 		t.Fatalf("err: %s", err)
-	} else {
-		t.Logf("plan: %s", p)
 	}
 
-	state, err := ctx.Apply()
-	if err != nil {
-		t.Fatalf("err: %s", err)
+	progress := NewApplyProgress()
+	ctx = testContext2(t, &ContextOpts{
+		Module:        m,
+		Providers:     providers,
+		State:         state,
+		Diff:          plan.Diff.DeepCopy(),
+		ApplyProgress: progress,
+	})
+	state, err = ctx.Apply()
+	if err == nil {
+		t.Fatal("should error")
 	}
 
-	actual := strings.TrimSpace(state.String())
-	expected := strings.TrimSpace(testTerraformApplyTaintDepRequireNewStr)
-	if actual != expected {
-		t.Fatalf("bad:\n%s", actual)
+	expected := []string{"aws_instance.c"}
+	if actual := progress.Applied(); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	// a changes before the apply is resumed, so c must be planned again
+	// rather than skipped.
+	state.RootModule().Resources["aws_instance.a"].Primary.Attributes["foo"] = "changed"
+
+	fail = false
+	ctx = testContext2(t, &ContextOpts{
+		Module:        m,
+		Providers:     providers,
+		State:         state,
+		Diff:          plan.Diff.DeepCopy(),
+		ApplyProgress: progress,
+	})
+	_, err = ctx.Apply()
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), "planned again") {
+		t.Fatalf("bad: %s", err)
 	}
 }
 
@@ -7712,6 +12356,148 @@ module.middle.bottom:
 
 // If a data source explicitly depends on another resource, it's because we need
 // that resource to be applied first.
+func TestContext2Apply_dataComputedDependency(t *testing.T) {
+	p := testProvider("null")
+	m := testModule(t, "apply-data-computed-dependency")
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"null": testProviderFuncFixed(p),
+		},
+	})
+
+	var applied bool
+	p.ApplyFn = func(info *InstanceInfo, s *InstanceState, d *InstanceDiff) (*InstanceState, error) {
+		applied = true
+		result, err := testApplyFn(info, s, d)
+		if err == nil {
+			result.Attributes["value"] = "APPLIED"
+		}
+
+		return result, err
+	}
+
+	p.DiffFn = testDiffFn
+	p.ReadDataDiffFn = testDataDiffFn
+
+	var readValue string
+	p.ReadDataApplyFn = func(info *InstanceInfo, d *InstanceDiff) (*InstanceState, error) {
+		if !applied {
+			return nil, fmt.Errorf("data source read before its dependency")
+		}
+
+		// The value is only known once the dependency is applied, so the
+		// diff must have been re-computed from the interpolated config.
+		readValue = d.Attributes["foo"].New
+		return &InstanceState{
+			ID: "read",
+			Attributes: map[string]string{
+				"foo": readValue,
+			},
+		}, nil
+	}
+
+	if _, err := ctx.Refresh(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if p.ReadDataApplyCalled {
+		t.Fatal("data source should be deferred until apply")
+	}
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if readValue != "APPLIED" {
+		t.Fatalf("bad: %q", readValue)
+	}
+
+	root := state.ModuleByPath(RootModulePath)
+	actual := root.Resources["data.null_data_source.read"].Primary.Attributes["foo"]
+	if actual != "APPLIED" {
+		t.Fatalf("bad:\n%s", strings.TrimSpace(state.String()))
+	}
+}
+
+func TestContext2Apply_dataUnchangedDependency(t *testing.T) {
+	p := testProvider("null")
+	m := testModule(t, "apply-data-unchanged-dependency")
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"null_resource.write": &ResourceState{
+						Type: "null_resource",
+						Primary: &InstanceState{
+							ID: "foo",
+							Attributes: map[string]string{
+								"foo": "bar",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"null": testProviderFuncFixed(p),
+		},
+		State: s,
+	})
+
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	p.ReadDataDiffFn = testDataDiffFn
+	p.ReadDataApplyFn = func(info *InstanceInfo, d *InstanceDiff) (*InstanceState, error) {
+		return &InstanceState{
+			ID: "read",
+			Attributes: map[string]string{
+				"foo": d.Attributes["foo"].New,
+			},
+		}, nil
+	}
+
+	// Everything the data source depends on is known, so it is read
+	// during refresh.
+	if _, err := ctx.Refresh(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !p.ReadDataApplyCalled {
+		t.Fatal("data source should be read during refresh")
+	}
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Nothing upstream changed, so the data source shouldn't be read again
+	p.ReadDataApplyCalled = false
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if p.ReadDataApplyCalled {
+		t.Fatal("data source should not be read again during apply")
+	}
+
+	root := state.ModuleByPath(RootModulePath)
+	actual := root.Resources["data.null_data_source.read"].Primary.Attributes["foo"]
+	if actual != "bar" {
+		t.Fatalf("bad:\n%s", strings.TrimSpace(state.String()))
+	}
+}
+
 func TestContext2Apply_dataDependsOn(t *testing.T) {
 	p := testProvider("null")
 	m := testModule(t, "apply-data-depends-on")
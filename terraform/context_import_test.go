@@ -2,6 +2,7 @@ package terraform
 
 import (
 	"fmt"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -39,6 +40,90 @@ func TestContextImport_basic(t *testing.T) {
 	}
 }
 
+func TestContextImport_parseImportID(t *testing.T) {
+	p := testProvider("aws")
+	ctx := testContext2(t, &ContextOpts{
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	p.ParseImportIDFn = func(info *InstanceInfo, id string) (map[string]string, error) {
+		parts := strings.Split(id, "/")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("expected REGION/ID, got %q", id)
+		}
+
+		return map[string]string{"region": parts[0], "id": parts[1]}, nil
+	}
+	p.ImportStateFn = func(info *InstanceInfo, id string) ([]*InstanceState, error) {
+		return []*InstanceState{
+			&InstanceState{
+				ID:        strings.Split(id, "/")[1],
+				Ephemeral: EphemeralState{Type: "aws_instance"},
+			},
+		}, nil
+	}
+	p.RefreshFn = func(info *InstanceInfo, s *InstanceState) (*InstanceState, error) {
+		return s, nil
+	}
+
+	state, err := ctx.Import(&ImportOpts{
+		Targets: []*ImportTarget{
+			&ImportTarget{
+				Addr: "aws_instance.foo",
+				ID:   "us-west-2/bar",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The attributes the ID holds are in the state to refresh
+	if p.ParseImportIDID != "us-west-2/bar" {
+		t.Fatalf("bad: %#v", p.ParseImportIDID)
+	}
+	expected := map[string]string{"region": "us-west-2", "id": "bar"}
+	if actual := p.RefreshState.Attributes; !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	checkStateString(t, state, testImportParseIDStr)
+}
+
+func TestContextImport_parseImportIDMalformed(t *testing.T) {
+	p := testProvider("aws")
+	ctx := testContext2(t, &ContextOpts{
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	p.ParseImportIDReturnError = fmt.Errorf("expected REGION/ID")
+	p.ImportStateReturn = []*InstanceState{
+		&InstanceState{
+			ID:        "foo",
+			Ephemeral: EphemeralState{Type: "aws_instance"},
+		},
+	}
+
+	_, err := ctx.Import(&ImportOpts{
+		Targets: []*ImportTarget{
+			&ImportTarget{
+				Addr: "aws_instance.foo",
+				ID:   "bar",
+			},
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "import aws_instance.foo (id: bar): expected REGION/ID") {
+		t.Fatalf("bad: %v", err)
+	}
+	if p.ImportStateCalled {
+		t.Fatal("ImportState should not be called")
+	}
+}
+
 func TestContextImport_countIndex(t *testing.T) {
 	p := testProvider("aws")
 	ctx := testContext2(t, &ContextOpts{
@@ -787,3 +872,10 @@ aws_instance.foo:
   ID = foo
   provider = aws.alias
 `
+
+const testImportParseIDStr = `
+aws_instance.foo:
+  ID = bar
+  provider = aws
+  region = us-west-2
+`
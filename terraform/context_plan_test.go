@@ -9,6 +9,8 @@ import (
 	"strings"
 	"sync"
 	"testing"
+
+	"github.com/hashicorp/terraform/flatmap"
 )
 
 func TestContext2Plan_basic(t *testing.T) {
@@ -858,6 +860,171 @@ func TestContext2Plan_nil(t *testing.T) {
 	}
 }
 
+func TestContext2Plan_resourceUnchanged(t *testing.T) {
+	m := testModule(t, "plan-resource-unchanged")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+	h := new(testHookResourceUnchanged)
+
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "foo",
+							Attributes: map[string]string{
+								"num": "2",
+							},
+						},
+					},
+					"data.aws_data_source.foo": &ResourceState{
+						Type: "aws_data_source",
+						Primary: &InstanceState{
+							ID: "foo",
+							Attributes: map[string]string{
+								"foo": "yes",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Hooks:  []Hook{h},
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: state,
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Only the existing resource without changes is unchanged, not the
+	// new resource or the data source that's only read
+	expected := []string{"aws_instance.foo"}
+	if !reflect.DeepEqual(h.Ids, expected) {
+		t.Fatalf("bad: %#v", h.Ids)
+	}
+}
+
+// testHookResourceUnchanged records the resources the ResourceUnchanged
+// hook is called for.
+type testHookResourceUnchanged struct {
+	NilHook
+
+	sync.Mutex
+	Ids []string
+}
+
+func (h *testHookResourceUnchanged) ResourceUnchanged(info *InstanceInfo) (HookAction, error) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.Ids = append(h.Ids, info.Id)
+	sort.Strings(h.Ids)
+	return HookActionContinue, nil
+}
+
+func TestContext2Plan_configHash(t *testing.T) {
+	m := testModule(t, "plan-config-hash")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+
+	plan := func(num string) *InstanceDiff {
+		ctx := testContext2(t, &ContextOpts{
+			Module: m,
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+			Variables: map[string]interface{}{
+				"num": num,
+			},
+		})
+
+		plan, err := ctx.Plan()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		// The hash of bar depends on the computed ID of foo
+		bar := plan.Diff.RootModule().Resources["aws_instance.bar"]
+		if attr := bar.Attributes["tag"]; attr == nil || !attr.NewComputed {
+			t.Fatalf("bar tag should be computed: %#v", attr)
+		}
+
+		return plan.Diff.RootModule().Resources["aws_instance.foo"]
+	}
+
+	expected := plan("2").Attributes["tag"].New
+	if len(expected) != 64 {
+		t.Fatalf("bad: %q", expected)
+	}
+	if actual := plan("2").Attributes["tag"].New; actual != expected {
+		t.Fatalf("hash should be stable: %q != %q", actual, expected)
+	}
+	if actual := plan("3").Attributes["tag"].New; actual == expected {
+		t.Fatalf("hash should change: %q", actual)
+	}
+}
+
+func TestContext2Plan_precondition(t *testing.T) {
+	m := testModule(t, "plan-precondition")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+
+	cases := map[string]struct {
+		Region string
+		Err    bool
+	}{
+		"holds":    {"us-east-1", false},
+		"violated": {"us-west-2", true},
+	}
+
+	for k, tc := range cases {
+		p.DiffCalled = false
+		ctx := testContext2(t, &ContextOpts{
+			Module: m,
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+			Variables: map[string]interface{}{
+				"region": tc.Region,
+			},
+		})
+
+		_, err := ctx.Plan()
+		if !tc.Err {
+			if err != nil {
+				t.Fatalf("%s: err: %s", k, err)
+			}
+			if !p.DiffCalled {
+				t.Fatalf("%s: should diff", k)
+			}
+			continue
+		}
+
+		if err == nil {
+			t.Fatalf("%s: should error", k)
+		}
+		expected := "aws_instance.foo: precondition #1: failed: " +
+			"the AMI is only in us-east-1, not us-west-2"
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("%s: bad: %s", k, err)
+		}
+		if p.DiffCalled {
+			t.Fatalf("%s: should not diff", k)
+		}
+	}
+}
+
 func TestContext2Plan_preventDestroy_bad(t *testing.T) {
 	m := testModule(t, "plan-prevent-destroy-bad")
 	p := testProvider("aws")
@@ -893,6 +1060,140 @@ func TestContext2Plan_preventDestroy_bad(t *testing.T) {
 	}
 }
 
+func TestContext2Plan_computedOnly(t *testing.T) {
+	m := testModule(t, "plan-computed-only")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+
+	// zone is optional and computed, so it can be set
+	schema := &ResourceSchema{
+		Attributes: map[string]*ResourceSchema{
+			"ami":  &ResourceSchema{},
+			"arn":  &ResourceSchema{ComputedOnly: true},
+			"zone": &ResourceSchema{},
+			"ebs_block_device": &ResourceSchema{
+				Attributes: map[string]*ResourceSchema{
+					"volume_size": &ResourceSchema{},
+					"volume_id":   &ResourceSchema{ComputedOnly: true},
+				},
+			},
+		},
+	}
+
+	cases := map[string]struct {
+		Schema *ResourceSchema
+		Err    string
+	}{
+		"no schema": {nil, ""},
+		"schema": {
+			schema,
+			"aws_instance.foo: the configuration sets arn, ebs_block_device.0.volume_id, " +
+				"which only the provider sets",
+		},
+	}
+
+	for k, tc := range cases {
+		p.ResourcesReturn = []ResourceType{
+			ResourceType{Name: "aws_instance", Schema: tc.Schema},
+		}
+
+		ctx := testContext2(t, &ContextOpts{
+			Module: m,
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+		})
+
+		_, err := ctx.Plan()
+		if tc.Err == "" {
+			if err != nil {
+				t.Fatalf("%s: err: %s", k, err)
+			}
+			continue
+		}
+
+		if err == nil {
+			t.Fatalf("%s: should error", k)
+		}
+		if !strings.Contains(err.Error(), tc.Err) {
+			t.Fatalf("%s: bad: %s", k, err)
+		}
+	}
+}
+
+func TestContext2Plan_preventReplace(t *testing.T) {
+	m := testModule(t, "plan-prevent-replace")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+
+	cases := map[string]struct {
+		State   *InstanceState
+		Replace []string
+		Err     bool
+	}{
+		"requires new": {
+			State: &InstanceState{ID: "i-abc123"},
+			Err:   true,
+		},
+
+		"create": {
+			State: nil,
+		},
+
+		"tainted": {
+			State: &InstanceState{ID: "i-abc123", Tainted: true},
+		},
+
+		"explicit replace": {
+			State:   &InstanceState{ID: "i-abc123"},
+			Replace: []string{"aws_instance.foo"},
+		},
+	}
+
+	for k, tc := range cases {
+		state := &State{
+			Modules: []*ModuleState{
+				&ModuleState{
+					Path:      rootModulePath,
+					Resources: map[string]*ResourceState{},
+				},
+			},
+		}
+		if tc.State != nil {
+			state.RootModule().Resources["aws_instance.foo"] = &ResourceState{
+				Type:    "aws_instance",
+				Primary: tc.State,
+			}
+		}
+
+		ctx := testContext2(t, &ContextOpts{
+			Module: m,
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+			State:   state,
+			Replace: tc.Replace,
+		})
+
+		plan, err := ctx.Plan()
+		if !tc.Err {
+			if err != nil {
+				t.Fatalf("%s: err: %s", k, err)
+			}
+			if plan.Diff.RootModule().Resources["aws_instance.foo"] == nil {
+				t.Fatalf("%s: should have a diff", k)
+			}
+			continue
+		}
+
+		expectedErr := "aws_instance.foo: the plan would replace this resource " +
+			"because of changes to: require_new."
+		if !strings.Contains(fmt.Sprintf("%s", err), expectedErr) {
+			t.Fatalf("%s: expected err would contain %q\nerr: %s", k, expectedErr, err)
+		}
+	}
+}
+
 func TestContext2Plan_preventDestroy_good(t *testing.T) {
 	m := testModule(t, "plan-prevent-destroy-good")
 	p := testProvider("aws")
@@ -1106,6 +1407,32 @@ func TestContext2Plan_provisionerCycle(t *testing.T) {
 	}
 }
 
+func TestContext2Plan_cycleConnection(t *testing.T) {
+	m := testModule(t, "plan-cycle-connection")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+	pr := testProvisioner()
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
+	})
+
+	_, err := ctx.Plan()
+	if err == nil {
+		t.Fatal("should error")
+	}
+
+	expected := "Cycle: aws_instance.a -> aws_security_group.b -> aws_instance.a"
+	if !strings.Contains(err.Error(), expected) {
+		t.Fatalf("expected %q in:\n%s", expected, err)
+	}
+}
+
 func TestContext2Plan_computed(t *testing.T) {
 	m := testModule(t, "plan-computed")
 	p := testProvider("aws")
@@ -1389,13 +1716,52 @@ func TestContext2Plan_computedList(t *testing.T) {
 }
 
 // GH-8695. This tests that you can index into a computed list on a
-// splatted resource.
-func TestContext2Plan_computedMultiIndex(t *testing.T) {
-	m := testModule(t, "plan-computed-multi-index")
+// A value that depends on a computed attribute must be known after apply
+// in the diffs of the resources downstream, even for a provider that
+// copies the config values into its diff as they are.
+func TestContext2Plan_computedPropagate(t *testing.T) {
+	m := testModule(t, "plan-computed-propagate")
 	p := testProvider("aws")
-	p.DiffFn = testDiffFn
+	p.DiffFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		c *ResourceConfig) (*InstanceDiff, error) {
+		if info.Id == "aws_instance.a" {
+			return testDiffFn(info, s, c)
+		}
+
+		diff := &InstanceDiff{Attributes: make(map[string]*ResourceAttrDiff)}
+		for k, v := range flatmap.Flatten(c.Config) {
+			if s.Attributes[k] != v {
+				diff.Attributes[k] = &ResourceAttrDiff{Old: s.Attributes[k], New: v}
+			}
+		}
+
+		return diff, nil
+	}
+
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.a": resourceState("aws_instance", "a"),
+					"aws_instance.b": resourceState("aws_instance", "b"),
+					"aws_instance.c": resourceState("aws_instance", "c"),
+				},
+			},
+		},
+	}
+	for _, rs := range s.RootModule().Resources {
+		rs.Primary.Attributes = map[string]string{
+			"id":  rs.Primary.ID,
+			"foo": "old",
+		}
+	}
+
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
+		State:  s,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
@@ -1406,15 +1772,32 @@ func TestContext2Plan_computedMultiIndex(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
-	actual := strings.TrimSpace(plan.String())
-	expected := strings.TrimSpace(testTerraformPlanComputedMultiIndexStr)
-	if actual != expected {
-		t.Fatalf("bad:\n%s", actual)
+	reasons := []DiffReason{DiffReasonConfig}
+	expected := map[string]map[string]*ResourceAttrDiff{
+		"aws_instance.b": map[string]*ResourceAttrDiff{
+			"foo":    &ResourceAttrDiff{Old: "old", NewComputed: true, Reasons: reasons},
+			"list.#": &ResourceAttrDiff{New: "2", Reasons: reasons},
+			"list.0": &ResourceAttrDiff{New: "x", Reasons: reasons},
+			"list.1": &ResourceAttrDiff{NewComputed: true, Reasons: reasons},
+		},
+		"aws_instance.c": map[string]*ResourceAttrDiff{
+			"foo": &ResourceAttrDiff{Old: "old", NewComputed: true, Reasons: reasons},
+		},
+	}
+	for k, attrs := range expected {
+		actual := plan.Diff.RootModule().Resources[k]
+		if actual == nil {
+			t.Fatalf("%s: no diff", k)
+		}
+		if !reflect.DeepEqual(actual.Attributes, attrs) {
+			t.Fatalf("%s: bad:\n%#v", k, actual)
+		}
 	}
 }
 
-func TestContext2Plan_count(t *testing.T) {
-	m := testModule(t, "plan-count")
+// splatted resource.
+func TestContext2Plan_computedMultiIndex(t *testing.T) {
+	m := testModule(t, "plan-computed-multi-index")
 	p := testProvider("aws")
 	p.DiffFn = testDiffFn
 	ctx := testContext2(t, &ContextOpts{
@@ -1429,124 +1812,355 @@ func TestContext2Plan_count(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
-	if len(plan.Diff.RootModule().Resources) < 6 {
-		t.Fatalf("bad: %#v", plan.Diff.RootModule().Resources)
-	}
-
 	actual := strings.TrimSpace(plan.String())
-	expected := strings.TrimSpace(testTerraformPlanCountStr)
+	expected := strings.TrimSpace(testTerraformPlanComputedMultiIndexStr)
 	if actual != expected {
 		t.Fatalf("bad:\n%s", actual)
 	}
 }
 
-func TestContext2Plan_countComputed(t *testing.T) {
-	m := testModule(t, "plan-count-computed")
+func TestContext2Plan_diffReasons(t *testing.T) {
+	m := testModule(t, "plan-diff-reasons")
 	p := testProvider("aws")
 	p.DiffFn = testDiffFn
+
+	// drift and both are changed outside of Terraform
+	p.RefreshFn = func(info *InstanceInfo, s *InstanceState) (*InstanceState, error) {
+		s = s.DeepCopy()
+		if info.Id == "aws_instance.drift" || info.Id == "aws_instance.both" {
+			s.Attributes["foo"] = "changed"
+		}
+		return s, nil
+	}
+
+	instance := func(foo string, tainted bool) *ResourceState {
+		return &ResourceState{
+			Type: "aws_instance",
+			Primary: &InstanceState{
+				ID: "foo",
+				Attributes: map[string]string{
+					"foo":  foo,
+					"type": "aws_instance",
+				},
+				Tainted: tainted,
+			},
+		}
+	}
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.drift":     instance("bar", false),
+					"aws_instance.config":    instance("old", false),
+					"aws_instance.both":      instance("old", false),
+					"aws_instance.tainted":   instance("bar", true),
+					"aws_instance.triggered": instance("bar", false),
+				},
+			},
+		},
+	}
+
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
+		State:  s,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
 	})
-
-	_, err := ctx.Plan()
-	if err == nil {
-		t.Fatal("should error")
+	if _, err := ctx.Refresh(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	plan, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	cases := []struct {
+		Resource string
+		Attr     string
+		Reasons  []DiffReason
+	}{
+		{"aws_instance.drift", "foo", []DiffReason{DiffReasonDrift}},
+		{"aws_instance.config", "foo", []DiffReason{DiffReasonConfig}},
+		{"aws_instance.both", "foo", []DiffReason{DiffReasonDrift, DiffReasonConfig}},
+		{"aws_instance.tainted", "id", []DiffReason{DiffReasonTainted}},
+		{"aws_instance.triggered", "id", []DiffReason{DiffReasonReplaceTriggered}},
+		{"aws_instance.triggered", "foo", []DiffReason{DiffReasonReplaceTriggered}},
+	}
+	for _, tc := range cases {
+		rd := plan.Diff.RootModule().Resources[tc.Resource]
+		if rd == nil {
+			t.Fatalf("%s: no diff", tc.Resource)
+		}
+		ad, ok := rd.GetAttribute(tc.Attr)
+		if !ok {
+			t.Fatalf("%s: no diff of %s:\n%#v", tc.Resource, tc.Attr, rd)
+		}
+		if !reflect.DeepEqual(ad.Reasons, tc.Reasons) {
+			t.Fatalf("%s.%s: bad: %#v", tc.Resource, tc.Attr, ad.Reasons)
+		}
 	}
 }
 
-func TestContext2Plan_countComputedModule(t *testing.T) {
-	m := testModule(t, "plan-count-computed-module")
+// Without a refresh before the plan, nothing is known to have drifted.
+func TestContext2Plan_diffReasonsNoRefresh(t *testing.T) {
+	m := testModule(t, "plan-diff-reasons")
 	p := testProvider("aws")
 	p.DiffFn = testDiffFn
+
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.drift": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "foo",
+							Attributes: map[string]string{
+								"foo":  "changed",
+								"type": "aws_instance",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
+		State:  s,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
 	})
+	plan, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
 
-	_, err := ctx.Plan()
+	ad, ok := plan.Diff.RootModule().Resources["aws_instance.drift"].GetAttribute("foo")
+	if !ok {
+		t.Fatal("no diff of foo")
+	}
+	if expected := []DiffReason{DiffReasonConfig}; !reflect.DeepEqual(ad.Reasons, expected) {
+		t.Fatalf("bad: %#v", ad.Reasons)
+	}
+}
 
-	expectedErr := "aws_instance.bar: value of 'count'"
-	if !strings.Contains(fmt.Sprintf("%s", err), expectedErr) {
-		t.Fatalf("expected err would contain %q\nerr: %s\n",
-			expectedErr, err)
+func TestContext2Plan_attributeFilterCount(t *testing.T) {
+	m := testModule(t, "apply-attribute-filter")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: &State{
+			Modules: []*ModuleState{
+				&ModuleState{
+					Path: rootModulePath,
+					Resources: map[string]*ResourceState{
+						"aws_instance.foo": &ResourceState{
+							Type: "aws_instance",
+							Primary: &InstanceState{
+								ID: "bar",
+								Attributes: map[string]string{
+									"id":     "bar",
+									"foo":    "old",
+									"bar":    "old",
+									"list.#": "1",
+									"list.0": "a",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		AttributeFilter: []string{"list.1"},
+	})
+
+	// The count of the list changes, so it can't be left out
+	_, err := ctx.Plan()
+	if err == nil || !strings.Contains(err.Error(), `leaves out "list.#"`) {
+		t.Fatalf("bad: %v", err)
 	}
 }
 
-func TestContext2Plan_countModuleStatic(t *testing.T) {
-	m := testModule(t, "plan-count-module-static")
+func TestContext2Plan_attributeFilterRequiresNew(t *testing.T) {
+	m := testModule(t, "plan-attribute-filter-requires-new")
 	p := testProvider("aws")
 	p.DiffFn = testDiffFn
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bar",
+							Attributes: map[string]string{
+								"id":          "bar",
+								"foo":         "old",
+								"require_new": "old",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	// Leaving out the attribute that requires the replacement fails
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
+		State:           state,
+		AttributeFilter: []string{"foo"},
 	})
+	_, err := ctx.Plan()
+	if err == nil || !strings.Contains(err.Error(), `leaves out "require_new"`) {
+		t.Fatalf("bad: %v", err)
+	}
 
+	// Keeping it keeps the whole replacement
+	ctx = testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State:           state,
+		AttributeFilter: []string{"require_*"},
+	})
 	plan, err := ctx.Plan()
 	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	actual := strings.TrimSpace(plan.String())
-	expected := strings.TrimSpace(`
-DIFF:
-
-module.child:
-  CREATE: aws_instance.foo.0
-  CREATE: aws_instance.foo.1
-  CREATE: aws_instance.foo.2
-
-STATE:
-
-<no state>
-`)
-	if actual != expected {
-		t.Fatalf("bad:\n%s", actual)
+	diff := plan.Diff.RootModule().Resources["aws_instance.foo"]
+	if diff == nil || !diff.RequiresNew() {
+		t.Fatalf("bad: %s", plan)
+	}
+	if attr := diff.Attributes["foo"]; attr == nil || attr.New != "new" {
+		t.Fatalf("bad: %s", plan)
 	}
 }
 
-func TestContext2Plan_countModuleStaticGrandchild(t *testing.T) {
-	m := testModule(t, "plan-count-module-static-grandchild")
+func TestContext2Plan_planModify(t *testing.T) {
+	m := testModule(t, "plan-modify")
 	p := testProvider("aws")
 	p.DiffFn = testDiffFn
+	p.ApplyFn = testApplyFn
+
+	// The provider sets a default size, unless the configuration sets one
+	p.PlanModifyFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		c *ResourceConfig,
+		d *InstanceDiff) (*InstanceDiff, error) {
+		if _, ok := c.Get("size"); ok || d.Empty() {
+			return nil, nil
+		}
+		d.SetAttribute("size", &ResourceAttrDiff{New: "small"})
+		return d, nil
+	}
+
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
 	})
-
 	plan, err := ctx.Plan()
 	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	actual := strings.TrimSpace(plan.String())
-	expected := strings.TrimSpace(`
-DIFF:
+	ad, ok := plan.Diff.RootModule().Resources["aws_instance.foo"].GetAttribute("size")
+	if !ok || ad.New != "small" {
+		t.Fatalf("bad: %#v", ad)
+	}
 
-module.child.child:
-  CREATE: aws_instance.foo.0
-  CREATE: aws_instance.foo.1
-  CREATE: aws_instance.foo.2
+	// Apply diffs again, and must get the same diff
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
 
-STATE:
+	checkStateString(t, state, `
+aws_instance.foo:
+  ID = foo
+  foo = bar
+  size = small
+  type = aws_instance
+	`)
+}
 
-<no state>
-`)
-	if actual != expected {
-		t.Fatalf("bad:\n%s", actual)
+func TestContext2Plan_planModifyChangesConfig(t *testing.T) {
+	m := testModule(t, "plan-modify")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+	p.PlanModifyFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		c *ResourceConfig,
+		d *InstanceDiff) (*InstanceDiff, error) {
+		d.SetAttribute("foo", &ResourceAttrDiff{New: "baz"})
+		return d, nil
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+	_, err := ctx.Plan()
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), "changes values set in the configuration: foo") {
+		t.Fatalf("bad: %s", err)
 	}
 }
 
-func TestContext2Plan_countIndex(t *testing.T) {
-	m := testModule(t, "plan-count-index")
+func TestContext2Plan_planModifyDestroy(t *testing.T) {
+	m := testModule(t, "plan-modify")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+	p.PlanModifyFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		c *ResourceConfig,
+		d *InstanceDiff) (*InstanceDiff, error) {
+		d.SetDestroy(true)
+		return d, nil
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+	_, err := ctx.Plan()
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), "destroys the resource") {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestContext2Plan_count(t *testing.T) {
+	m := testModule(t, "plan-count")
 	p := testProvider("aws")
 	p.DiffFn = testDiffFn
 	ctx := testContext2(t, &ContextOpts{
@@ -1561,15 +2175,19 @@ func TestContext2Plan_countIndex(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
+	if len(plan.Diff.RootModule().Resources) < 6 {
+		t.Fatalf("bad: %#v", plan.Diff.RootModule().Resources)
+	}
+
 	actual := strings.TrimSpace(plan.String())
-	expected := strings.TrimSpace(testTerraformPlanCountIndexStr)
+	expected := strings.TrimSpace(testTerraformPlanCountStr)
 	if actual != expected {
 		t.Fatalf("bad:\n%s", actual)
 	}
 }
 
-func TestContext2Plan_countIndexZero(t *testing.T) {
-	m := testModule(t, "plan-count-index-zero")
+func TestContext2Plan_countComputed(t *testing.T) {
+	m := testModule(t, "plan-count-computed")
 	p := testProvider("aws")
 	p.DiffFn = testDiffFn
 	ctx := testContext2(t, &ContextOpts{
@@ -1585,14 +2203,14 @@ func TestContext2Plan_countIndexZero(t *testing.T) {
 	}
 
 	actual := strings.TrimSpace(plan.String())
-	expected := strings.TrimSpace(testTerraformPlanCountIndexZeroStr)
+	expected := strings.TrimSpace(testTerraformPlanCountComputedStr)
 	if actual != expected {
-		t.Fatalf("bad:\n%s", actual)
+		t.Fatalf("bad:\n%s\n\nexpected:\n%s", actual, expected)
 	}
 }
 
-func TestContext2Plan_countVar(t *testing.T) {
-	m := testModule(t, "plan-count-var")
+func TestContext2Plan_countComputedData(t *testing.T) {
+	m := testModule(t, "plan-count-computed-data")
 	p := testProvider("aws")
 	p.DiffFn = testDiffFn
 	ctx := testContext2(t, &ContextOpts{
@@ -1600,8 +2218,25 @@ func TestContext2Plan_countVar(t *testing.T) {
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
-		Variables: map[string]interface{}{
-			"count": "3",
+	})
+
+	_, err := ctx.Plan()
+
+	expectedErr := "data.aws_data_source.bar: value of 'count'"
+	if !strings.Contains(fmt.Sprintf("%s", err), expectedErr) {
+		t.Fatalf("expected err would contain %q\nerr: %s\n",
+			expectedErr, err)
+	}
+}
+
+func TestContext2Plan_countComputedModule(t *testing.T) {
+	m := testModule(t, "plan-count-computed-module")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
 		},
 	})
 
@@ -1611,14 +2246,14 @@ func TestContext2Plan_countVar(t *testing.T) {
 	}
 
 	actual := strings.TrimSpace(plan.String())
-	expected := strings.TrimSpace(testTerraformPlanCountVarStr)
+	expected := strings.TrimSpace(testTerraformPlanCountComputedModuleStr)
 	if actual != expected {
-		t.Fatalf("bad:\n%s", actual)
+		t.Fatalf("bad:\n%s\n\nexpected:\n%s", actual, expected)
 	}
 }
 
-func TestContext2Plan_countZero(t *testing.T) {
-	m := testModule(t, "plan-count-zero")
+func TestContext2Plan_countModuleStatic(t *testing.T) {
+	m := testModule(t, "plan-count-module-static")
 	p := testProvider("aws")
 	p.DiffFn = testDiffFn
 	ctx := testContext2(t, &ContextOpts{
@@ -1634,15 +2269,25 @@ func TestContext2Plan_countZero(t *testing.T) {
 	}
 
 	actual := strings.TrimSpace(plan.String())
-	expected := strings.TrimSpace(testTerraformPlanCountZeroStr)
+	expected := strings.TrimSpace(`
+DIFF:
+
+module.child:
+  CREATE: aws_instance.foo.0
+  CREATE: aws_instance.foo.1
+  CREATE: aws_instance.foo.2
+
+STATE:
+
+<no state>
+`)
 	if actual != expected {
-		t.Logf("expected:\n%s", expected)
 		t.Fatalf("bad:\n%s", actual)
 	}
 }
 
-func TestContext2Plan_countOneIndex(t *testing.T) {
-	m := testModule(t, "plan-count-one-index")
+func TestContext2Plan_countModuleStaticGrandchild(t *testing.T) {
+	m := testModule(t, "plan-count-module-static-grandchild")
 	p := testProvider("aws")
 	p.DiffFn = testDiffFn
 	ctx := testContext2(t, &ContextOpts{
@@ -1658,14 +2303,183 @@ func TestContext2Plan_countOneIndex(t *testing.T) {
 	}
 
 	actual := strings.TrimSpace(plan.String())
-	expected := strings.TrimSpace(testTerraformPlanCountOneIndexStr)
+	expected := strings.TrimSpace(`
+DIFF:
+
+module.child.child:
+  CREATE: aws_instance.foo.0
+  CREATE: aws_instance.foo.1
+  CREATE: aws_instance.foo.2
+
+STATE:
+
+<no state>
+`)
 	if actual != expected {
 		t.Fatalf("bad:\n%s", actual)
 	}
 }
 
-func TestContext2Plan_countDecreaseToOne(t *testing.T) {
-	m := testModule(t, "plan-count-dec")
+func TestContext2Plan_countIndex(t *testing.T) {
+	m := testModule(t, "plan-count-index")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	plan, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(plan.String())
+	expected := strings.TrimSpace(testTerraformPlanCountIndexStr)
+	if actual != expected {
+		t.Fatalf("bad:\n%s", actual)
+	}
+}
+
+func TestContext2Plan_countIndexZero(t *testing.T) {
+	m := testModule(t, "plan-count-index-zero")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	plan, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(plan.String())
+	expected := strings.TrimSpace(testTerraformPlanCountIndexZeroStr)
+	if actual != expected {
+		t.Fatalf("bad:\n%s", actual)
+	}
+}
+
+func TestContext2Plan_countVar(t *testing.T) {
+	m := testModule(t, "plan-count-var")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Variables: map[string]interface{}{
+			"count": "3",
+		},
+	})
+
+	plan, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(plan.String())
+	expected := strings.TrimSpace(testTerraformPlanCountVarStr)
+	if actual != expected {
+		t.Fatalf("bad:\n%s", actual)
+	}
+}
+
+func TestContext2Plan_countZero(t *testing.T) {
+	m := testModule(t, "plan-count-zero")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	plan, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(plan.String())
+	expected := strings.TrimSpace(testTerraformPlanCountZeroStr)
+	if actual != expected {
+		t.Logf("expected:\n%s", expected)
+		t.Fatalf("bad:\n%s", actual)
+	}
+}
+
+func TestContext2Plan_countZeroNew(t *testing.T) {
+	m := testModule(t, "plan-count-zero-new")
+	p := testProvider("aws")
+
+	var l sync.Mutex
+	var diffed []string
+	p.DiffFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		c *ResourceConfig) (*InstanceDiff, error) {
+		l.Lock()
+		diffed = append(diffed, info.Id)
+		l.Unlock()
+		return testDiffFn(info, s, c)
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	plan, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The zero count resource must never be diffed
+	if !reflect.DeepEqual(diffed, []string{"aws_instance.bar"}) {
+		t.Fatalf("bad: %#v", diffed)
+	}
+
+	rs := plan.Diff.RootModule().Resources
+	if len(rs) != 1 || rs["aws_instance.bar"] == nil {
+		t.Fatalf("bad:\n%s", plan)
+	}
+}
+
+func TestContext2Plan_countOneIndex(t *testing.T) {
+	m := testModule(t, "plan-count-one-index")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	plan, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(plan.String())
+	expected := strings.TrimSpace(testTerraformPlanCountOneIndexStr)
+	if actual != expected {
+		t.Fatalf("bad:\n%s", actual)
+	}
+}
+
+func TestContext2Plan_countDecreaseToOne(t *testing.T) {
+	m := testModule(t, "plan-count-dec")
 	p := testProvider("aws")
 	p.DiffFn = testDiffFn
 	s := &State{
@@ -2187,6 +3001,95 @@ func TestContext2Plan_hook(t *testing.T) {
 	}
 }
 
+func TestContext2Plan_hookOrder(t *testing.T) {
+	m := testModule(t, "plan-good")
+	h := new(testDiffRecordHook)
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Hooks:  []Hook{h},
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// aws_instance.bar depends on aws_instance.foo, so the order is fixed
+	expected := []string{
+		"PreDiff aws_instance.foo",
+		"PostDiff aws_instance.foo",
+		"PreDiff aws_instance.bar",
+		"PostDiff aws_instance.bar",
+	}
+	if !reflect.DeepEqual(h.Calls, expected) {
+		t.Fatalf("bad: %#v", h.Calls)
+	}
+}
+
+func TestContext2Plan_hookHalt(t *testing.T) {
+	m := testModule(t, "plan-orphan")
+	h := new(MockHook)
+	h.PreDiffReturn = HookActionHalt
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+
+	// The shadow graph doesn't run hooks and would report the halted
+	// diff as a mismatch, so this doesn't use testContext2.
+	ctx, err := NewContext(&ContextOpts{
+		Module: m,
+		Hooks:  []Hook{h},
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	plan, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if p.DiffCalled {
+		t.Fatal("diff should not be called")
+	}
+	if h.PostDiffCalled {
+		t.Fatal("PostDiff should not be called")
+	}
+	if !plan.Diff.Empty() {
+		t.Fatalf("bad: %s", plan.Diff)
+	}
+}
+
+// testDiffRecordHook records the order of the diff hook calls.
+type testDiffRecordHook struct {
+	NilHook
+
+	sync.Mutex
+	Calls []string
+}
+
+func (h *testDiffRecordHook) PreDiff(n *InstanceInfo, s *InstanceState) (HookAction, error) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.Calls = append(h.Calls, "PreDiff "+n.Id)
+	return HookActionContinue, nil
+}
+
+func (h *testDiffRecordHook) PostDiff(n *InstanceInfo, d *InstanceDiff) (HookAction, error) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.Calls = append(h.Calls, "PostDiff "+n.Id)
+	return HookActionContinue, nil
+}
+
 func TestContext2Plan_orphan(t *testing.T) {
 	m := testModule(t, "plan-orphan")
 	p := testProvider("aws")
@@ -2334,11 +3237,21 @@ func TestContext2Plan_taint(t *testing.T) {
 	}
 }
 
-func TestContext2Apply_taintIgnoreChanges(t *testing.T) {
-	m := testModule(t, "plan-taint-ignore-changes")
+func TestContext2Plan_taintProviderUnaware(t *testing.T) {
+	m := testModule(t, "plan-taint")
 	p := testProvider("aws")
-	p.ApplyFn = testApplyFn
-	p.DiffFn = testDiffFn
+	p.DiffFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		c *ResourceConfig) (*InstanceDiff, error) {
+		// Behave like a provider that doesn't know about tainting
+		d, err := testDiffFn(info, s, c)
+		if d != nil {
+			d.DestroyTainted = false
+		}
+
+		return d, err
+	}
 	s := &State{
 		Modules: []*ModuleState{
 			&ModuleState{
@@ -2347,11 +3260,14 @@ func TestContext2Apply_taintIgnoreChanges(t *testing.T) {
 					"aws_instance.foo": &ResourceState{
 						Type: "aws_instance",
 						Primary: &InstanceState{
-							ID: "foo",
-							Attributes: map[string]string{
-								"vars": "foo",
-								"type": "aws_instance",
-							},
+							ID:         "bar",
+							Attributes: map[string]string{"num": "2"},
+						},
+					},
+					"aws_instance.bar": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID:      "baz",
 							Tainted: true,
 						},
 					},
@@ -2373,15 +3289,14 @@ func TestContext2Apply_taintIgnoreChanges(t *testing.T) {
 	}
 
 	actual := strings.TrimSpace(plan.String())
-	expected := strings.TrimSpace(testTerraformPlanTaintIgnoreChangesStr)
+	expected := strings.TrimSpace(testTerraformPlanTaintStr)
 	if actual != expected {
 		t.Fatalf("bad:\n%s", actual)
 	}
 }
 
-// Fails about 50% of the time before the fix for GH-4982, covers the fix.
-func TestContext2Plan_taintDestroyInterpolatedCountRace(t *testing.T) {
-	m := testModule(t, "plan-taint-interpolated-count")
+func TestContext2Plan_taintOrphan(t *testing.T) {
+	m := testModule(t, "plan-orphan")
 	p := testProvider("aws")
 	p.DiffFn = testDiffFn
 	s := &State{
@@ -2389,21 +3304,13 @@ func TestContext2Plan_taintDestroyInterpolatedCountRace(t *testing.T) {
 			&ModuleState{
 				Path: rootModulePath,
 				Resources: map[string]*ResourceState{
-					"aws_instance.foo.0": &ResourceState{
+					"aws_instance.baz": &ResourceState{
 						Type: "aws_instance",
 						Primary: &InstanceState{
 							ID:      "bar",
 							Tainted: true,
 						},
 					},
-					"aws_instance.foo.1": &ResourceState{
-						Type:    "aws_instance",
-						Primary: &InstanceState{ID: "bar"},
-					},
-					"aws_instance.foo.2": &ResourceState{
-						Type:    "aws_instance",
-						Primary: &InstanceState{ID: "bar"},
-					},
 				},
 			},
 		},
@@ -2416,15 +3323,112 @@ func TestContext2Plan_taintDestroyInterpolatedCountRace(t *testing.T) {
 		State: s,
 	})
 
-	for i := 0; i < 100; i++ {
-		plan, err := ctx.Plan()
-		if err != nil {
-			t.Fatalf("err: %s", err)
-		}
-
-		actual := strings.TrimSpace(plan.String())
-		expected := strings.TrimSpace(`
-DIFF:
+	plan, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// A tainted resource that is no longer in the config is only destroyed
+	rd := plan.Diff.RootModule().Resources["aws_instance.baz"]
+	if rd == nil {
+		t.Fatalf("bad: %s", plan)
+	}
+	if ct := rd.ChangeType(); ct != DiffDestroy {
+		t.Fatalf("bad: %#v\n\n%s", ct, plan)
+	}
+}
+
+func TestContext2Apply_taintIgnoreChanges(t *testing.T) {
+	m := testModule(t, "plan-taint-ignore-changes")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "foo",
+							Attributes: map[string]string{
+								"vars": "foo",
+								"type": "aws_instance",
+							},
+							Tainted: true,
+						},
+					},
+				},
+			},
+		},
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: s,
+	})
+
+	plan, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(plan.String())
+	expected := strings.TrimSpace(testTerraformPlanTaintIgnoreChangesStr)
+	if actual != expected {
+		t.Fatalf("bad:\n%s", actual)
+	}
+}
+
+// Fails about 50% of the time before the fix for GH-4982, covers the fix.
+func TestContext2Plan_taintDestroyInterpolatedCountRace(t *testing.T) {
+	m := testModule(t, "plan-taint-interpolated-count")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo.0": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID:      "bar",
+							Tainted: true,
+						},
+					},
+					"aws_instance.foo.1": &ResourceState{
+						Type:    "aws_instance",
+						Primary: &InstanceState{ID: "bar"},
+					},
+					"aws_instance.foo.2": &ResourceState{
+						Type:    "aws_instance",
+						Primary: &InstanceState{ID: "bar"},
+					},
+				},
+			},
+		},
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: s,
+	})
+
+	for i := 0; i < 100; i++ {
+		plan, err := ctx.Plan()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		actual := strings.TrimSpace(plan.String())
+		expected := strings.TrimSpace(`
+DIFF:
 
 DESTROY/CREATE: aws_instance.foo.0
   type: "" => "aws_instance"
@@ -2844,8 +3848,8 @@ func TestContext2Plan_ignoreChanges(t *testing.T) {
 	}
 }
 
-func TestContext2Plan_ignoreChangesWildcard(t *testing.T) {
-	m := testModule(t, "plan-ignore-changes-wildcard")
+func TestContext2Plan_ignoreChangesNested(t *testing.T) {
+	m := testModule(t, "plan-ignore-changes-nested")
 	p := testProvider("aws")
 	p.DiffFn = testDiffFn
 	s := &State{
@@ -2854,11 +3858,16 @@ func TestContext2Plan_ignoreChangesWildcard(t *testing.T) {
 				Path: rootModulePath,
 				Resources: map[string]*ResourceState{
 					"aws_instance.foo": &ResourceState{
+						Type: "aws_instance",
 						Primary: &InstanceState{
 							ID: "bar",
 							Attributes: map[string]string{
-								"ami":           "ami-abcd1234",
-								"instance_type": "t2.micro",
+								"ami":                             "ami-old",
+								"ebs_block_device.#":              "1",
+								"ebs_block_device.0.device_name":  "/dev/sdb",
+								"ebs_block_device.0.volume_size":  "10",
+								"root_block_device.#":             "1",
+								"root_block_device.0.volume_size": "10",
 							},
 						},
 					},
@@ -2871,10 +3880,6 @@ func TestContext2Plan_ignoreChangesWildcard(t *testing.T) {
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
-		Variables: map[string]interface{}{
-			"foo": "ami-1234abcd",
-			"bar": "t2.small",
-		},
 		State: s,
 	})
 
@@ -2883,125 +3888,110 @@ func TestContext2Plan_ignoreChangesWildcard(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
-	if len(plan.Diff.RootModule().Resources) > 0 {
-		t.Fatalf("bad: %#v", plan.Diff.RootModule().Resources)
-	}
-
-	actual := strings.TrimSpace(plan.String())
-	expected := strings.TrimSpace(testTerraformPlanIgnoreChangesWildcardStr)
+	actual := strings.TrimSpace(plan.Diff.String())
+	expected := strings.TrimSpace(testTerraformPlanIgnoreChangesNestedStr)
 	if actual != expected {
 		t.Fatalf("bad:\n%s\n\nexpected\n\n%s", actual, expected)
 	}
 }
 
-func TestContext2Plan_moduleMapLiteral(t *testing.T) {
-	m := testModule(t, "plan-module-map-literal")
-	p := testProvider("aws")
-	p.ApplyFn = testApplyFn
-	p.DiffFn = func(i *InstanceInfo, s *InstanceState, c *ResourceConfig) (*InstanceDiff, error) {
-		// Here we verify that both the populated and empty map literals made it
-		// through to the resource attributes
-		val, _ := c.Get("tags")
-		m, ok := val.(map[string]interface{})
-		if !ok {
-			t.Fatalf("Tags attr not map: %#v", val)
-		}
-		if m["foo"] != "bar" {
-			t.Fatalf("Bad value in tags attr: %#v", m)
-		}
-		{
-			val, _ := c.Get("meta")
-			m, ok := val.(map[string]interface{})
-			if !ok {
-				t.Fatalf("Meta attr not map: %#v", val)
-			}
-			if len(m) != 0 {
-				t.Fatalf("Meta attr not empty: %#v", val)
-			}
-		}
-		return nil, nil
-	}
-	ctx := testContext2(t, &ContextOpts{
-		Module: m,
-		Providers: map[string]ResourceProviderFactory{
-			"aws": testProviderFuncFixed(p),
-		},
-	})
-
-	if _, err := ctx.Plan(); err != nil {
-		t.Fatalf("err: %s", err)
-	}
-}
-
-func TestContext2Plan_computedValueInMap(t *testing.T) {
-	m := testModule(t, "plan-computed-value-in-map")
+func TestContext2Plan_ignoreChangesWildcard(t *testing.T) {
+	m := testModule(t, "plan-ignore-changes-wildcard")
 	p := testProvider("aws")
-	p.DiffFn = func(info *InstanceInfo, state *InstanceState, c *ResourceConfig) (*InstanceDiff, error) {
-		switch info.Type {
-		case "aws_computed_source":
-			return &InstanceDiff{
-				Attributes: map[string]*ResourceAttrDiff{
-					"computed_read_only": &ResourceAttrDiff{
-						NewComputed: true,
+	p.DiffFn = testDiffFn
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Primary: &InstanceState{
+							ID: "bar",
+							Attributes: map[string]string{
+								"ami":           "ami-abcd1234",
+								"instance_type": "t2.micro",
+							},
+						},
 					},
 				},
-			}, nil
-		}
-
-		return testDiffFn(info, state, c)
+			},
+		},
 	}
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
+		Variables: map[string]interface{}{
+			"foo": "ami-1234abcd",
+			"bar": "t2.small",
+		},
+		State: s,
 	})
 
-	if _, err := ctx.Plan(); err != nil {
-		t.Fatalf("err: %s", err)
-	}
-
 	plan, err := ctx.Plan()
 	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
+	if len(plan.Diff.RootModule().Resources) > 0 {
+		t.Fatalf("bad: %#v", plan.Diff.RootModule().Resources)
+	}
+
 	actual := strings.TrimSpace(plan.String())
-	expected := strings.TrimSpace(testTerraformPlanComputedValueInMap)
+	expected := strings.TrimSpace(testTerraformPlanIgnoreChangesWildcardStr)
 	if actual != expected {
 		t.Fatalf("bad:\n%s\n\nexpected\n\n%s", actual, expected)
 	}
 }
 
-func TestContext2Plan_moduleVariableFromSplat(t *testing.T) {
-	m := testModule(t, "plan-module-variable-from-splat")
+func TestContext2Plan_ignoreChangesWildcardRequiresNew(t *testing.T) {
+	m := testModule(t, "plan-ignore-changes-wildcard-requires-new")
 	p := testProvider("aws")
 	p.DiffFn = testDiffFn
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Primary: &InstanceState{
+							ID: "bar",
+							Attributes: map[string]string{
+								"require_new":   "abc",
+								"instance_type": "t2.micro",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
 	ctx := testContext2(t, &ContextOpts{
 		Module: m,
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
+		Variables: map[string]interface{}{
+			"foo": "xyz",
+			"bar": "t2.small",
+		},
+		State: s,
 	})
 
-	if _, err := ctx.Plan(); err != nil {
-		t.Fatalf("err: %s", err)
-	}
-
 	plan, err := ctx.Plan()
 	if err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	actual := strings.TrimSpace(plan.String())
-	expected := strings.TrimSpace(testTerraformPlanModuleVariableFromSplat)
-	if actual != expected {
-		t.Fatalf("bad:\n%s\n\nexpected\n\n%s", actual, expected)
+	// Both the in-place and the requires new changes should be ignored
+	if len(plan.Diff.RootModule().Resources) > 0 {
+		t.Fatalf("bad: %#v", plan.Diff.RootModule().Resources)
 	}
 }
 
-func TestContext2Plan_createBeforeDestroy_depends_datasource(t *testing.T) {
-	m := testModule(t, "plan-cdb-depends-datasource")
+func TestContext2Plan_ignoreChangesWildcardCreate(t *testing.T) {
+	m := testModule(t, "plan-ignore-changes-wildcard-requires-new")
 	p := testProvider("aws")
 	p.DiffFn = testDiffFn
 	ctx := testContext2(t, &ContextOpts{
@@ -3009,6 +3999,10 @@ func TestContext2Plan_createBeforeDestroy_depends_datasource(t *testing.T) {
 		Providers: map[string]ResourceProviderFactory{
 			"aws": testProviderFuncFixed(p),
 		},
+		Variables: map[string]interface{}{
+			"foo": "xyz",
+			"bar": "t2.small",
+		},
 	})
 
 	plan, err := ctx.Plan()
@@ -3016,25 +4010,465 @@ func TestContext2Plan_createBeforeDestroy_depends_datasource(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
-	if got := len(plan.Diff.Modules); got != 1 {
-		t.Fatalf("got %d modules; want 1", got)
-	}
+	// The resource doesn't exist yet, so it must still be created
+	actual := strings.TrimSpace(plan.String())
+	expected := strings.TrimSpace(`
+DIFF:
 
-	moduleDiff := plan.Diff.Modules[0]
+CREATE: aws_instance.foo
+  instance_type: "" => "t2.small"
+  require_new:   "" => "xyz" (forces new resource)
+  type:          "" => "aws_instance"
 
-	if _, ok := moduleDiff.Resources["aws_instance.foo.0"]; !ok {
-		t.Fatalf("missing diff for aws_instance.foo.0")
-	}
-	if _, ok := moduleDiff.Resources["aws_instance.foo.1"]; !ok {
-		t.Fatalf("missing diff for aws_instance.foo.1")
-	}
-	if _, ok := moduleDiff.Resources["data.aws_vpc.bar.0"]; !ok {
-		t.Fatalf("missing diff for data.aws_vpc.bar.0")
-	}
-	if _, ok := moduleDiff.Resources["data.aws_vpc.bar.1"]; !ok {
-		t.Fatalf("missing diff for data.aws_vpc.bar.1")
-	}
-}
+STATE:
+
+<no state>
+`)
+	if actual != expected {
+		t.Fatalf("bad:\n%s\n\nexpected\n\n%s", actual, expected)
+	}
+}
+
+func TestContext2Plan_replaceTriggeredBy(t *testing.T) {
+	m := testModule(t, "plan-replace-triggered-by")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "foo",
+							Attributes: map[string]string{
+								"ami":  "old",
+								"type": "aws_instance",
+							},
+						},
+					},
+					"aws_instance.bar": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bar",
+							Attributes: map[string]string{
+								"id":   "bar",
+								"num":  "1",
+								"type": "aws_instance",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	cases := map[string]struct {
+		Ami      string
+		Expected string
+	}{
+		"changed": {
+			"new",
+			`
+DIFF:
+
+DESTROY/CREATE: aws_instance.bar
+  num:  "1" => "1"
+  type: "aws_instance" => "aws_instance"
+UPDATE: aws_instance.foo
+  ami:  "" => "new"
+  type: "" => "aws_instance"
+
+STATE:
+
+aws_instance.bar:
+  ID = bar
+  num = 1
+  type = aws_instance
+aws_instance.foo:
+  ID = foo
+  ami = old
+  type = aws_instance
+`,
+		},
+
+		"unchanged": {
+			"old",
+			`
+DIFF:
+
+
+
+STATE:
+
+aws_instance.bar:
+  ID = bar
+  num = 1
+  type = aws_instance
+aws_instance.foo:
+  ID = foo
+  ami = old
+  type = aws_instance
+`,
+		},
+	}
+
+	for k, tc := range cases {
+		ctx := testContext2(t, &ContextOpts{
+			Module: m,
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+			Variables: map[string]interface{}{
+				"ami": tc.Ami,
+			},
+			State: s,
+		})
+
+		plan, err := ctx.Plan()
+		if err != nil {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+
+		actual := strings.TrimSpace(plan.String())
+		expected := strings.TrimSpace(tc.Expected)
+		if actual != expected {
+			t.Fatalf("%s: bad:\n%s\n\nexpected:\n\n%s", k, actual, expected)
+		}
+	}
+}
+
+func TestContext2Plan_forceReplace(t *testing.T) {
+	m := testModule(t, "plan-force-replace")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "foo",
+							Attributes: map[string]string{
+								"id":   "foo",
+								"ami":  "bar",
+								"num":  "2",
+								"type": "aws_instance",
+							},
+						},
+					},
+					"aws_instance.bar": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "bar",
+							Attributes: map[string]string{
+								"id":   "bar",
+								"num":  "1",
+								"type": "aws_instance",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State:   s,
+		Replace: []string{"aws_instance.foo"},
+	})
+
+	plan, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(plan.String())
+	expected := strings.TrimSpace(testTerraformPlanForceReplaceStr)
+	if actual != expected {
+		t.Fatalf("bad:\n%s\n\nexpected:\n\n%s", actual, expected)
+	}
+
+	// Every configured attribute must be in the diff as a new value
+	rd := plan.Diff.RootModule().Resources["aws_instance.foo"]
+	for _, k := range []string{"ami", "num"} {
+		ad, ok := rd.Attributes[k]
+		if !ok {
+			t.Fatalf("missing attribute %q: %#v", k, rd)
+		}
+		if ad.New != s.RootModule().Resources["aws_instance.foo"].Primary.Attributes[k] {
+			t.Fatalf("bad %q: %#v", k, ad)
+		}
+	}
+
+	// Planning must not have changed anything
+	if p.ApplyCalled {
+		t.Fatal("apply should not be called")
+	}
+	if actual := ctx.State().String(); actual != s.String() {
+		t.Fatalf("bad state:\n%s", actual)
+	}
+}
+
+func TestContext2Plan_forceReplaceInvalid(t *testing.T) {
+	m := testModule(t, "plan-force-replace")
+	p := testProvider("aws")
+	_, err := NewContext(&ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Replace: []string{"aws_instance"},
+	})
+	if err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestContext2Plan_moved(t *testing.T) {
+	m := testModule(t, "plan-moved")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "foo",
+							Attributes: map[string]string{
+								"foo":  "bar",
+								"type": "aws_instance",
+							},
+						},
+					},
+					"aws_instance.baz": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID: "baz",
+							Attributes: map[string]string{
+								"foo":  "bar",
+								"type": "aws_instance",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	moves := []*ResourceMove{
+		&ResourceMove{
+			From: &ResourceAddress{
+				Type:         "aws_instance",
+				Name:         "foo",
+				Index:        -1,
+				InstanceType: TypePrimary,
+			},
+			To: &ResourceAddress{
+				Type:         "aws_instance",
+				Name:         "renamed",
+				Index:        -1,
+				InstanceType: TypePrimary,
+			},
+		},
+		&ResourceMove{
+			From: &ResourceAddress{
+				Type:         "aws_instance",
+				Name:         "baz",
+				Index:        -1,
+				InstanceType: TypePrimary,
+			},
+			To: &ResourceAddress{
+				Path:         []string{"child"},
+				Type:         "aws_instance",
+				Name:         "baz",
+				Index:        -1,
+				InstanceType: TypePrimary,
+			},
+		},
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: s,
+		Moves: moves,
+	})
+
+	plan, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !plan.Diff.Empty() {
+		t.Fatalf("bad:\n%s", plan)
+	}
+
+	actual := strings.TrimSpace(plan.State.String())
+	expected := strings.TrimSpace(testTerraformPlanMovedStr)
+	if actual != expected {
+		t.Fatalf("bad:\n%s", actual)
+	}
+
+	// The given state must not be modified
+	if _, ok := s.RootModule().Resources["aws_instance.foo"]; !ok {
+		t.Fatalf("original state modified:\n%s", s)
+	}
+}
+
+func TestContext2Plan_moduleMapLiteral(t *testing.T) {
+	m := testModule(t, "plan-module-map-literal")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = func(i *InstanceInfo, s *InstanceState, c *ResourceConfig) (*InstanceDiff, error) {
+		// Here we verify that both the populated and empty map literals made it
+		// through to the resource attributes
+		val, _ := c.Get("tags")
+		m, ok := val.(map[string]interface{})
+		if !ok {
+			t.Fatalf("Tags attr not map: %#v", val)
+		}
+		if m["foo"] != "bar" {
+			t.Fatalf("Bad value in tags attr: %#v", m)
+		}
+		{
+			val, _ := c.Get("meta")
+			m, ok := val.(map[string]interface{})
+			if !ok {
+				t.Fatalf("Meta attr not map: %#v", val)
+			}
+			if len(m) != 0 {
+				t.Fatalf("Meta attr not empty: %#v", val)
+			}
+		}
+		return nil, nil
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestContext2Plan_computedValueInMap(t *testing.T) {
+	m := testModule(t, "plan-computed-value-in-map")
+	p := testProvider("aws")
+	p.DiffFn = func(info *InstanceInfo, state *InstanceState, c *ResourceConfig) (*InstanceDiff, error) {
+		switch info.Type {
+		case "aws_computed_source":
+			return &InstanceDiff{
+				Attributes: map[string]*ResourceAttrDiff{
+					"computed_read_only": &ResourceAttrDiff{
+						NewComputed: true,
+					},
+				},
+			}, nil
+		}
+
+		return testDiffFn(info, state, c)
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	plan, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(plan.String())
+	expected := strings.TrimSpace(testTerraformPlanComputedValueInMap)
+	if actual != expected {
+		t.Fatalf("bad:\n%s\n\nexpected\n\n%s", actual, expected)
+	}
+}
+
+func TestContext2Plan_moduleVariableFromSplat(t *testing.T) {
+	m := testModule(t, "plan-module-variable-from-splat")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	plan, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(plan.String())
+	expected := strings.TrimSpace(testTerraformPlanModuleVariableFromSplat)
+	if actual != expected {
+		t.Fatalf("bad:\n%s\n\nexpected\n\n%s", actual, expected)
+	}
+}
+
+func TestContext2Plan_createBeforeDestroy_depends_datasource(t *testing.T) {
+	m := testModule(t, "plan-cdb-depends-datasource")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	plan, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if got := len(plan.Diff.Modules); got != 1 {
+		t.Fatalf("got %d modules; want 1", got)
+	}
+
+	moduleDiff := plan.Diff.Modules[0]
+
+	if _, ok := moduleDiff.Resources["aws_instance.foo.0"]; !ok {
+		t.Fatalf("missing diff for aws_instance.foo.0")
+	}
+	if _, ok := moduleDiff.Resources["aws_instance.foo.1"]; !ok {
+		t.Fatalf("missing diff for aws_instance.foo.1")
+	}
+	if _, ok := moduleDiff.Resources["data.aws_vpc.bar.0"]; !ok {
+		t.Fatalf("missing diff for data.aws_vpc.bar.0")
+	}
+	if _, ok := moduleDiff.Resources["data.aws_vpc.bar.1"]; !ok {
+		t.Fatalf("missing diff for data.aws_vpc.bar.1")
+	}
+}
 
 // interpolated lists need to be stored in the original order.
 func TestContext2Plan_listOrder(t *testing.T) {
@@ -3054,11 +4488,481 @@ func TestContext2Plan_listOrder(t *testing.T) {
 		t.Fatalf("err: %s", err)
 	}
 
-	rDiffs := plan.Diff.Modules[0].Resources
-	rDiffA := rDiffs["aws_instance.a"]
-	rDiffB := rDiffs["aws_instance.b"]
+	rDiffs := plan.Diff.Modules[0].Resources
+	rDiffA := rDiffs["aws_instance.a"]
+	rDiffB := rDiffs["aws_instance.b"]
+
+	if !rDiffA.Equal(rDiffB) {
+		t.Fatal("aws_instance.a and aws_instance.b diffs should match:\n", plan)
+	}
+}
+
+func TestContext2Plan_providerWarnings(t *testing.T) {
+	m := testModule(t, "plan-provider-warnings")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	p.ValidateResourceFn = func(t string, c *ResourceConfig) ([]string, []error) {
+		ws := []string{"deprecated"}
+		if v, ok := c.Get("warn"); ok {
+			ws = append(ws, v.(string))
+		}
+
+		return ws, nil
+	}
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	plan, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []*PlanWarning{
+		&PlanWarning{
+			Message: "deprecated",
+			Resources: []string{
+				"aws_instance.bar",
+				"aws_instance.foo[0]",
+				"aws_instance.foo[1]",
+				"module.child.aws_instance.baz",
+			},
+		},
+		&PlanWarning{
+			Message:   "unique",
+			Resources: []string{"aws_instance.bar"},
+		},
+	}
+	if !reflect.DeepEqual(plan.Warnings, expected) {
+		for _, w := range plan.Warnings {
+			t.Logf("%#v", w)
+		}
+		t.Fatal("bad")
+	}
 
-	if !rDiffA.Equal(rDiffB) {
-		t.Fatal("aws_instance.a and aws_instance.b diffs should match:\n", plan)
+	// The warnings don't prevent the plan from being applied
+	if _, err := ctx.Apply(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
+
+func TestContext2Plan_managedBy(t *testing.T) {
+	m := testModule(t, "plan-managed-by")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+
+	instance := func(id, managedBy string) *ResourceState {
+		attrs := map[string]string{"id": id}
+		if managedBy != "" {
+			attrs["tags.%"] = "1"
+			attrs["tags.managed_by"] = managedBy
+		}
+
+		return &ResourceState{
+			Type: "aws_instance",
+			Primary: &InstanceState{
+				ID:         id,
+				Attributes: attrs,
+			},
+		}
+	}
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo.0":    instance("foo0", "staging"),
+					"aws_instance.foo.1":    instance("foo1", "prod"),
+					"aws_instance.bar":      instance("bar", "staging"),
+					"aws_instance.untagged": instance("untagged", ""),
+				},
+			},
+		},
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: s,
+		ManagedBy: &ManagedBy{
+			Attribute: "tags.managed_by",
+			Name:      "prod",
+		},
+	})
+
+	plan, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(plan.Warnings) != 1 {
+		t.Fatalf("bad: %#v", plan.Warnings)
+	}
+	w := plan.Warnings[0]
+	if !strings.Contains(w.Message, `tags.managed_by is "staging" instead of "prod"`) {
+		t.Fatalf("bad: %s", w.Message)
+	}
+	expected := []string{"aws_instance.bar", "aws_instance.foo[0]"}
+	if !reflect.DeepEqual(w.Resources, expected) {
+		t.Fatalf("bad: %#v", w.Resources)
+	}
+}
+
+func TestContext2Plan_diffCache(t *testing.T) {
+	m := testModule(t, "plan-diff-cache")
+	p := testProvider("aws")
+
+	var lock sync.Mutex
+	var diffed []string
+	p.DiffFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		c *ResourceConfig) (*InstanceDiff, error) {
+		lock.Lock()
+		diffed = append(diffed, info.Id)
+		lock.Unlock()
+
+		return testDiffFn(info, s, c)
+	}
+
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID:         "foo",
+							Attributes: map[string]string{"ami": "foo"},
+						},
+					},
+					"aws_instance.bar": &ResourceState{
+						Type: "aws_instance",
+						Primary: &InstanceState{
+							ID:         "bar",
+							Attributes: map[string]string{"foo": "bar"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	cache := NewDiffCache()
+	plan := func(vars map[string]interface{}) string {
+		diffed = nil
+		ctx := testContext2(t, &ContextOpts{
+			Module: m,
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+			State:     s,
+			Variables: vars,
+			DiffCache: cache,
+		})
+
+		plan, err := ctx.Plan()
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		sort.Strings(diffed)
+		return plan.Diff.String()
+	}
+
+	expected := plan(nil)
+	if !reflect.DeepEqual(diffed, []string{
+		"aws_instance.bar",
+		"aws_instance.dep",
+		"aws_instance.foo",
+		"aws_instance.new",
+	}) {
+		t.Fatalf("bad: %#v", diffed)
+	}
+
+	// The diff of a resource whose config is computed isn't cached
+	if cache.Len() != 3 {
+		t.Fatalf("bad: %d", cache.Len())
+	}
+
+	// Nothing changed, so only the computed one is diffed again
+	if actual := plan(nil); actual != expected {
+		t.Fatalf("bad:\n%s\n\nexpected:\n%s", actual, expected)
+	}
+	if !reflect.DeepEqual(diffed, []string{"aws_instance.dep"}) {
+		t.Fatalf("bad: %#v", diffed)
+	}
+
+	// A changed config invalidates the cached diff
+	actual := plan(map[string]interface{}{"ami": "bar"})
+	if !reflect.DeepEqual(diffed, []string{"aws_instance.dep", "aws_instance.foo"}) {
+		t.Fatalf("bad: %#v", diffed)
+	}
+	if !strings.Contains(actual, `ami:  "" => "bar"`) {
+		t.Fatalf("bad:\n%s", actual)
+	}
+}
+
+func BenchmarkContext2Plan_diffCache(b *testing.B) {
+	mod := testModule(b, "plan-diff-cache-many")
+
+	for _, cached := range []bool{false, true} {
+		b.Run(fmt.Sprintf("cache=%t", cached), func(b *testing.B) {
+			var cache *DiffCache
+			if cached {
+				cache = NewDiffCache()
+			}
+
+			var lock sync.Mutex
+			var count int
+			p := testProvider("aws")
+			p.DiffFn = func(
+				info *InstanceInfo,
+				s *InstanceState,
+				c *ResourceConfig) (*InstanceDiff, error) {
+				lock.Lock()
+				count++
+				lock.Unlock()
+
+				return testDiffFn(info, s, c)
+			}
+
+			for i := 0; i < b.N; i++ {
+				ctx, err := NewContext(&ContextOpts{
+					Module: mod,
+					Providers: map[string]ResourceProviderFactory{
+						"aws": testProviderFuncFixed(p),
+					},
+					DiffCache: cache,
+				})
+				if err != nil {
+					b.Fatalf("err: %s", err)
+				}
+				if _, err := ctx.Plan(); err != nil {
+					b.Fatalf("err: %s", err)
+				}
+			}
+
+			b.ReportMetric(float64(count)/float64(b.N), "diffs/op")
+		})
+	}
+}
+
+func TestContext2Plan_invalidateState(t *testing.T) {
+	m := testModule(t, "plan-invalidate-state")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+
+	var lock sync.Mutex
+	var refreshed []string
+	p.RefreshFn = func(info *InstanceInfo, s *InstanceState) (*InstanceState, error) {
+		lock.Lock()
+		refreshed = append(refreshed, info.HumanId())
+		lock.Unlock()
+
+		s = s.DeepCopy()
+		s.Attributes["foo"] = "changed"
+		return s, nil
+	}
+
+	instance := func(id string) *ResourceState {
+		return &ResourceState{
+			Type: "aws_instance",
+			Primary: &InstanceState{
+				ID: id,
+				Attributes: map[string]string{
+					"id":  id,
+					"foo": "bar",
+				},
+			},
+		}
+	}
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": instance("foo"),
+					"aws_instance.bar": instance("bar"),
+				},
+			},
+			&ModuleState{
+				Path: []string{"root", "child"},
+				Resources: map[string]*ResourceState{
+					"aws_instance.baz": instance("baz"),
+				},
+			},
+		},
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: s,
+	})
+
+	err := ctx.InvalidateState("aws_instance.foo", "module.child.aws_instance.baz")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	plan, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	sort.Strings(refreshed)
+	expected := []string{"aws_instance.foo", "module.child.aws_instance.baz"}
+	if !reflect.DeepEqual(refreshed, expected) {
+		t.Fatalf("bad: %#v", refreshed)
+	}
+
+	// Only the refreshed resources changed
+	actual := strings.TrimSpace(plan.String())
+	expectedDiff := strings.TrimSpace(`
+DIFF:
+
+UPDATE: aws_instance.foo
+  foo:  "" => "bar"
+  type: "" => "aws_instance"
+
+module.child:
+  UPDATE: aws_instance.baz
+    foo:  "" => "bar"
+    type: "" => "aws_instance"
+
+STATE:
+
+aws_instance.bar:
+  ID = bar
+  foo = bar
+aws_instance.foo:
+  ID = foo
+  foo = changed
+
+module.child:
+  aws_instance.baz:
+    ID = baz
+    foo = changed
+`)
+	if actual != expectedDiff {
+		t.Fatalf("bad:\n%s\n\nexpected:\n%s", actual, expectedDiff)
+	}
+
+	// The next plan doesn't refresh them again
+	refreshed = nil
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(refreshed) != 0 {
+		t.Fatalf("bad: %#v", refreshed)
+	}
+
+	// The refreshed states are applied against
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	checkStateString(t, state, `
+aws_instance.bar:
+  ID = bar
+  foo = bar
+aws_instance.foo:
+  ID = foo
+  foo = bar
+  type = aws_instance
+
+module.child:
+  aws_instance.baz:
+    ID = foo
+    foo = bar
+    type = aws_instance
+	`)
+}
+
+func TestContext2Plan_invalidateStateBad(t *testing.T) {
+	m := testModule(t, "plan-invalidate-state")
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(testProvider("aws")),
+		},
+	})
+
+	for _, v := range []string{"module.child", "data.aws_ami.foo", "nope nope"} {
+		if err := ctx.InvalidateState(v); err == nil {
+			t.Fatalf("%s: should error", v)
+		}
+	}
+}
+
+func TestContext2Plan_rekeyCount(t *testing.T) {
+	m := testModule(t, "plan-rekey-count")
+	p := testProvider("aws")
+	p.DiffFn = testDiffFn
+
+	instance := func(id string) *ResourceState {
+		return &ResourceState{
+			Type: "aws_instance",
+			Primary: &InstanceState{
+				ID: id,
+				Attributes: map[string]string{
+					"id":   id,
+					"foo":  "bar",
+					"type": "aws_instance",
+				},
+			},
+		}
+	}
+	s := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo.0": instance("a"),
+					"aws_instance.foo.1": instance("b"),
+				},
+			},
+		},
+	}
+
+	addr, err := ParseResourceAddress("aws_instance.foo")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	keys := make(map[int]*ResourceAddress)
+	for i, v := range []string{"aws_instance.a", "aws_instance.b"} {
+		if keys[i], err = ParseResourceAddress(v); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	if err := s.RekeyCount(addr, keys); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: s,
+	})
+
+	plan, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !plan.Diff.Empty() {
+		t.Fatalf("bad:\n\n%s", plan.Diff)
 	}
 }
@@ -101,6 +101,112 @@ func TestContext2Refresh_targeted(t *testing.T) {
 	}
 }
 
+func TestContext2Refresh_targetedOnly(t *testing.T) {
+	p := testProvider("aws")
+	m := testModule(t, "refresh-targeted")
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: &State{
+			Modules: []*ModuleState{
+				&ModuleState{
+					Path: rootModulePath,
+					Resources: map[string]*ResourceState{
+						"aws_vpc.metoo":      resourceState("aws_vpc", "vpc-abc123"),
+						"aws_instance.notme": resourceState("aws_instance", "i-bcd345"),
+						"aws_instance.me":    resourceState("aws_instance", "i-abc123"),
+						"aws_elb.meneither":  resourceState("aws_elb", "lb-abc123"),
+					},
+				},
+			},
+		},
+		Targets:            []string{"aws_instance.me"},
+		RefreshTargetsOnly: true,
+	})
+
+	var l sync.Mutex
+	refreshedResources := make([]string, 0, 1)
+	p.RefreshFn = func(i *InstanceInfo, is *InstanceState) (*InstanceState, error) {
+		l.Lock()
+		defer l.Unlock()
+		refreshedResources = append(refreshedResources, i.Id)
+
+		result := is.DeepCopy()
+		result.init()
+		result.Attributes["refreshed"] = "true"
+		return result, nil
+	}
+
+	state, err := ctx.Refresh()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []string{"aws_instance.me"}
+	if !reflect.DeepEqual(refreshedResources, expected) {
+		t.Fatalf("expected: %#v, got: %#v", expected, refreshedResources)
+	}
+
+	// The dependency of the target keeps its last-known state
+	resources := state.RootModule().Resources
+	if _, ok := resources["aws_vpc.metoo"].Primary.Attributes["refreshed"]; ok {
+		t.Fatalf("aws_vpc.metoo should not be refreshed: %s", state)
+	}
+	if resources["aws_instance.me"].Primary.Attributes["refreshed"] != "true" {
+		t.Fatalf("aws_instance.me should be refreshed: %s", state)
+	}
+}
+
+func TestContext2Refresh_targetedOnlyExpand(t *testing.T) {
+	p := testProvider("aws")
+	m := testModule(t, "refresh-targeted")
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		State: &State{
+			Modules: []*ModuleState{
+				&ModuleState{
+					Path: rootModulePath,
+					Resources: map[string]*ResourceState{
+						"aws_vpc.metoo":      resourceState("aws_vpc", "vpc-abc123"),
+						"aws_instance.notme": resourceState("aws_instance", "i-bcd345"),
+						"aws_instance.me":    resourceState("aws_instance", "i-abc123"),
+						"aws_elb.meneither":  resourceState("aws_elb", "lb-abc123"),
+					},
+				},
+			},
+		},
+		Targets:            []string{"aws_instance.me"},
+		RefreshTargetsOnly: true,
+		ExpandTargets:      true,
+	})
+
+	var l sync.Mutex
+	refreshedResources := make([]string, 0, 2)
+	p.RefreshFn = func(i *InstanceInfo, is *InstanceState) (*InstanceState, error) {
+		l.Lock()
+		defer l.Unlock()
+		refreshedResources = append(refreshedResources, i.Id)
+		return is, nil
+	}
+
+	if _, err := ctx.Refresh(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The dependency of the target is targeted too, so it's refreshed,
+	// but the resources that depend on the target aren't
+	sort.Strings(refreshedResources)
+	expected := []string{"aws_instance.me", "aws_vpc.metoo"}
+	if !reflect.DeepEqual(refreshedResources, expected) {
+		t.Fatalf("expected: %#v, got: %#v", expected, refreshedResources)
+	}
+}
+
 func TestContext2Refresh_targetedCount(t *testing.T) {
 	p := testProvider("aws")
 	m := testModule(t, "refresh-targeted-count")
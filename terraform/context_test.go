@@ -87,6 +87,62 @@ func TestNewContextRequiredVersion(t *testing.T) {
 	}
 }
 
+func TestNewContextProviderParallelism(t *testing.T) {
+	cases := map[string]struct {
+		Input map[string]int
+		Err   bool
+	}{
+		"none": {
+			nil,
+			false,
+		},
+
+		"valid": {
+			map[string]int{"aws": 1, "aws.east": 2},
+			false,
+		},
+
+		"zero": {
+			map[string]int{"aws": 0},
+			true,
+		},
+
+		"negative": {
+			map[string]int{"aws": -1},
+			true,
+		},
+	}
+
+	for k, tc := range cases {
+		_, err := NewContext(&ContextOpts{
+			ProviderParallelism: tc.Input,
+		})
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+	}
+}
+
+func TestNewContextDestroyParallelism(t *testing.T) {
+	cases := map[string]struct {
+		Input int
+		Err   bool
+	}{
+		"unset":    {0, false},
+		"valid":    {2, false},
+		"negative": {-1, true},
+	}
+
+	for k, tc := range cases {
+		_, err := NewContext(&ContextOpts{
+			DestroyParallelism: tc.Input,
+		})
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+	}
+}
+
 func TestNewContextState(t *testing.T) {
 	cases := map[string]struct {
 		Input *ContextOpts
@@ -2,6 +2,7 @@ package terraform
 
 import (
 	"fmt"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -517,6 +518,46 @@ func TestContext2Validate_providerConfig_good(t *testing.T) {
 	}
 }
 
+func TestContext2Validate_providerSelfRef(t *testing.T) {
+	m := testModule(t, "validate-provider-self-ref")
+	p := testProvider("aws")
+	c := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	_, e := c.Validate()
+	if len(e) == 0 {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(e[0].Error(), "managed by the same provider") {
+		t.Fatalf("bad: %s", e[0])
+	}
+}
+
+// A provider that indirectly depends on its own resources is a cycle
+func TestContext2Validate_providerCycle(t *testing.T) {
+	m := testModule(t, "validate-provider-cycle")
+	p := testProvider("aws")
+	c := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws":  testProviderFuncFixed(p),
+			"test": testProviderFuncFixed(testProvider("test")),
+		},
+	})
+
+	_, e := c.Validate()
+	if len(e) == 0 {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(e[0].Error(), "Cycle") {
+		t.Fatalf("bad: %s", e[0])
+	}
+}
+
 func TestContext2Validate_provisionerConfig_bad(t *testing.T) {
 	m := testModule(t, "validate-bad-prov-conf")
 	p := testProvider("aws")
@@ -542,6 +583,157 @@ func TestContext2Validate_provisionerConfig_bad(t *testing.T) {
 	}
 }
 
+func TestContext2Validate_provisionerUnknown(t *testing.T) {
+	m := testModule(t, "validate-provisioner-unknown")
+	p := testProvider("aws")
+	pr := testProvisioner()
+	c := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		Provisioners: map[string]ResourceProvisionerFactory{
+			"shell": testProvisionerFuncFixed(pr),
+		},
+	})
+
+	_, e := c.Validate()
+	if len(e) != 1 {
+		t.Fatalf("bad: %#v", e)
+	}
+
+	err := e[0].Error()
+	for _, expected := range []string{
+		`aws_instance.foo: provisioner 1: unknown provisioner type "nope"`,
+		`aws_instance.foo: provisioner 3: unknown provisioner type "nope"`,
+		`module.child.aws_instance.bar: provisioner 0: unknown provisioner type "other"`,
+	} {
+		if !strings.Contains(err, expected) {
+			t.Fatalf("expected error %q, got: %s", expected, err)
+		}
+	}
+	if strings.Count(err, "unknown provisioner type") != 3 {
+		t.Fatalf("bad: %s", err)
+	}
+
+	// The unknown provisioners are caught before anything is validated
+	if pr.ValidateCalled {
+		t.Fatal("validate shouldn't be called")
+	}
+}
+
+func TestContext2Validate_provisionerSelfRefSchema(t *testing.T) {
+	m := testModule(t, "validate-provisioner-self-ref-schema")
+	p := testProvider("aws")
+	pr := testProvisioner()
+
+	schema := &ResourceSchema{
+		Attributes: map[string]*ResourceSchema{
+			"public_ip": &ResourceSchema{},
+			"ebs_block_device": &ResourceSchema{
+				Attributes: map[string]*ResourceSchema{
+					"device_name": &ResourceSchema{},
+				},
+			},
+		},
+	}
+
+	cases := map[string]struct {
+		Schema *ResourceSchema
+		Errs   []string
+	}{
+		"no schema": {nil, nil},
+		"schema": {
+			schema,
+			[]string{
+				`aws_instance.foo: provisioner 1 (shell): "self.pubilc_ip" references an attribute that aws_instance doesn't have`,
+				`aws_instance.foo: provisioner 1 (shell): "self.ebs_block_device.0.device_nmae" references an attribute that aws_instance doesn't have`,
+			},
+		},
+	}
+
+	for k, tc := range cases {
+		p.ResourcesReturn = []ResourceType{
+			ResourceType{Name: "aws_instance", Schema: tc.Schema},
+		}
+
+		c := testContext2(t, &ContextOpts{
+			Module: m,
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+			Provisioners: map[string]ResourceProvisionerFactory{
+				"shell": testProvisionerFuncFixed(pr),
+			},
+		})
+
+		w, e := c.Validate()
+		if len(w) > 0 {
+			t.Fatalf("%s: bad: %#v", k, w)
+		}
+
+		var actual []string
+		for _, err := range e {
+			actual = append(actual, err.Error())
+		}
+		if !reflect.DeepEqual(actual, tc.Errs) {
+			t.Fatalf("%s: bad: %#v", k, actual)
+		}
+	}
+}
+
+func TestContext2Validate_ignoreChangesSchema(t *testing.T) {
+	m := testModule(t, "validate-ignore-changes-schema")
+	p := testProvider("aws")
+
+	schema := &ResourceSchema{
+		Attributes: map[string]*ResourceSchema{
+			"ami":  &ResourceSchema{},
+			"tags": &ResourceSchema{},
+			"ebs_block_device": &ResourceSchema{
+				Attributes: map[string]*ResourceSchema{
+					"volume_size": &ResourceSchema{},
+				},
+			},
+		},
+	}
+
+	cases := map[string]struct {
+		Schema *ResourceSchema
+		Warns  []string
+	}{
+		"no schema": {nil, nil},
+		"schema": {
+			schema,
+			[]string{
+				`aws_instance.foo: ignore_changes: "amii" is not an attribute of aws_instance, so no changes are ignored for it`,
+				`aws_instance.foo: ignore_changes: "ebs_block_device[0].volume_sise" is not an attribute of aws_instance, so no changes are ignored for it`,
+			},
+		},
+	}
+
+	for k, tc := range cases {
+		p.ResourcesReturn = []ResourceType{
+			ResourceType{Name: "aws_instance", Schema: tc.Schema},
+		}
+
+		c := testContext2(t, &ContextOpts{
+			Module: m,
+			Providers: map[string]ResourceProviderFactory{
+				"aws": testProviderFuncFixed(p),
+			},
+		})
+
+		w, e := c.Validate()
+		if len(e) > 0 {
+			t.Fatalf("%s: bad: %#v", k, e)
+		}
+		if !reflect.DeepEqual(w, tc.Warns) {
+			t.Fatalf("%s: bad: %#v", k, w)
+		}
+	}
+}
+
 func TestContext2Validate_provisionerConfig_good(t *testing.T) {
 	m := testModule(t, "validate-bad-prov-conf")
 	p := testProvider("aws")
@@ -937,3 +1129,45 @@ func TestContext2Validate_PlanGraphBuilder(t *testing.T) {
 		t.Fatal(walker.ValidationErrors)
 	}
 }
+
+func TestContext2Validate_unreachable(t *testing.T) {
+	p := testProvider("aws")
+	m := testModule(t, "validate-unreachable")
+
+	// Nothing is reported unless it's asked for
+	c := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+	w, e := c.Validate()
+	if len(w) > 0 {
+		t.Fatalf("bad: %#v", w)
+	}
+	if len(e) > 0 {
+		t.Fatalf("bad: %s", e)
+	}
+
+	c = testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+		ValidateUnreachable: true,
+	})
+	w, e = c.Validate()
+	if len(e) > 0 {
+		t.Fatalf("bad: %s", e)
+	}
+
+	// The standalone resource of the root module and the resources that
+	// are connected to anything in the child aren't reported
+	expected := []string{
+		"module.child.aws_instance.counted: doesn't reference anything in its module and nothing references it, so it may be unused",
+		"module.child.aws_instance.unused: doesn't reference anything in its module and nothing references it, so it may be unused",
+	}
+	if !reflect.DeepEqual(w, expected) {
+		t.Fatalf("bad: %#v", w)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 )
@@ -315,6 +316,21 @@ func (*DebugHook) PostApply(ii *InstanceInfo, is *InstanceState, err error) (Hoo
 	return HookActionContinue, nil
 }
 
+func (*DebugHook) ApplyElapsed(ii *InstanceInfo, d time.Duration, attempts int) {
+	if dbug == nil {
+		return
+	}
+
+	var buf bytes.Buffer
+	if ii != nil {
+		buf.WriteString(ii.HumanId())
+		buf.WriteString("\n")
+	}
+	buf.WriteString(fmt.Sprintf("%s (%d attempts)\n", d, attempts))
+
+	dbug.WriteFile("hook-ApplyElapsed", buf.Bytes())
+}
+
 func (*DebugHook) PreDiff(ii *InstanceInfo, is *InstanceState) (HookAction, error) {
 	if dbug == nil {
 		return HookActionContinue, nil
@@ -521,3 +537,30 @@ func (*DebugHook) PostImportState(ii *InstanceInfo, iss []*InstanceState) (HookA
 func (*DebugHook) PostStateUpdate(*State) (HookAction, error) {
 	return HookActionContinue, nil
 }
+
+func (*DebugHook) PreApplyProvider(path []string, name string) (HookAction, error) {
+	if dbug == nil {
+		return HookActionContinue, nil
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(strings.Join(path, ".") + "\n")
+	buf.WriteString(name + "\n")
+
+	dbug.WriteFile("hook-PreApplyProvider", buf.Bytes())
+	return HookActionContinue, nil
+}
+
+func (*DebugHook) ResourceUnchanged(ii *InstanceInfo) (HookAction, error) {
+	if dbug == nil {
+		return HookActionContinue, nil
+	}
+
+	var buf bytes.Buffer
+	if ii != nil {
+		buf.WriteString(ii.HumanId() + "\n")
+	}
+
+	dbug.WriteFile("hook-ResourceUnchanged", buf.Bytes())
+	return HookActionContinue, nil
+}
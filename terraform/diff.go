@@ -151,6 +151,59 @@ func (d *Diff) DeepCopy() *Diff {
 	return copy.(*Diff)
 }
 
+// DiffStats is a summary of the changes in a diff, counted per resource
+// instance.
+type DiffStats struct {
+	Add     int
+	Change  int
+	Destroy int
+
+	// Replace is the number of instances that are destroyed and created
+	// again. Replacements are only counted here if Stats was asked to
+	// count them separately, otherwise they're counted in both Add and
+	// Destroy.
+	Replace int
+}
+
+// Stats returns the number of resource instances the diff adds, changes
+// and destroys. If separateReplace is true, replacements are counted in
+// Replace instead of in both Add and Destroy.
+//
+// Data sources aren't counted, since reading them doesn't change any
+// infrastructure. This is safe to call on a nil Diff.
+func (d *Diff) Stats(separateReplace bool) DiffStats {
+	var result DiffStats
+	if d == nil {
+		return result
+	}
+
+	for _, m := range d.Modules {
+		for k, r := range m.Resources {
+			if strings.HasPrefix(k, "data.") {
+				continue
+			}
+
+			switch r.Action() {
+			case DiffActionCreate:
+				result.Add++
+			case DiffActionUpdate:
+				result.Change++
+			case DiffActionDelete:
+				result.Destroy++
+			case DiffActionReplace:
+				if separateReplace {
+					result.Replace++
+				} else {
+					result.Add++
+					result.Destroy++
+				}
+			}
+		}
+	}
+
+	return result
+}
+
 func (d *Diff) String() string {
 	var buf bytes.Buffer
 
@@ -200,6 +253,12 @@ type ModuleDiff struct {
 	Path      []string
 	Resources map[string]*InstanceDiff
 	Destroy   bool // Set only by the destroy plan
+
+	// DeferredCount is the sorted list of resources in this module whose
+	// count couldn't be determined during plan. These resources aren't
+	// expanded into Resources and are instead expanded, diffed and
+	// applied during apply.
+	DeferredCount []string
 }
 
 func (d *ModuleDiff) init() {
@@ -236,7 +295,7 @@ func (d *ModuleDiff) ChangeType() DiffChangeType {
 
 // Empty returns true if the diff has no changes within this module.
 func (d *ModuleDiff) Empty() bool {
-	if d.Destroy {
+	if d.Destroy || len(d.DeferredCount) > 0 {
 		return false
 	}
 
@@ -288,12 +347,12 @@ func (d *ModuleDiff) String() string {
 		rdiff := d.Resources[name]
 
 		crud := "UPDATE"
-		switch {
-		case rdiff.RequiresNew() && (rdiff.GetDestroy() || rdiff.GetDestroyTainted()):
+		switch rdiff.Action() {
+		case DiffActionReplace:
 			crud = "DESTROY/CREATE"
-		case rdiff.GetDestroy() || rdiff.GetDestroyDeposed():
+		case DiffActionDelete:
 			crud = "DESTROY"
-		case rdiff.RequiresNew():
+		case DiffActionCreate:
 			crud = "CREATE"
 		}
 
@@ -309,9 +368,8 @@ func (d *ModuleDiff) String() string {
 			extra))
 
 		keyLen := 0
-		rdiffAttrs := rdiff.CopyAttributes()
-		keys := make([]string, 0, len(rdiffAttrs))
-		for key, _ := range rdiffAttrs {
+		var keys []string
+		for _, key := range rdiff.SortedAttributeKeys() {
 			if key == "id" {
 				continue
 			}
@@ -321,7 +379,6 @@ func (d *ModuleDiff) String() string {
 				keyLen = len(key)
 			}
 		}
-		sort.Strings(keys)
 
 		for _, attrK := range keys {
 			attrDiff, _ := rdiff.GetAttribute(attrK)
@@ -354,9 +411,26 @@ func (d *ModuleDiff) String() string {
 		}
 	}
 
+	for _, name := range d.DeferredCount {
+		buf.WriteString(fmt.Sprintf("DEFERRED: %s (count computed)\n", name))
+	}
+
 	return buf.String()
 }
 
+// AddDeferredCount records that the count of the resource with the given
+// id couldn't be determined during plan.
+func (d *ModuleDiff) AddDeferredCount(id string) {
+	idx := sort.SearchStrings(d.DeferredCount, id)
+	if idx < len(d.DeferredCount) && d.DeferredCount[idx] == id {
+		return
+	}
+
+	d.DeferredCount = append(d.DeferredCount, "")
+	copy(d.DeferredCount[idx+1:], d.DeferredCount[idx:])
+	d.DeferredCount[idx] = id
+}
+
 // InstanceDiff is the diff of a resource from some state to another.
 type InstanceDiff struct {
 	mu             sync.Mutex
@@ -385,6 +459,10 @@ type ResourceAttrDiff struct {
 	RequiresNew bool        // True if change requires new resource
 	Sensitive   bool        // True if the data should not be displayed in UI output
 	Type        DiffAttrType
+
+	// Reasons optionally say why the attribute is in the diff. They're
+	// set by Terraform when it plans, never by providers.
+	Reasons []DiffReason
 }
 
 // Empty returns true if the diff for this attr is neutral
@@ -392,6 +470,37 @@ func (d *ResourceAttrDiff) Empty() bool {
 	return d.Old == d.New && !d.NewComputed && !d.NewRemoved
 }
 
+// merge merges the other diff for the same attribute into this one. The
+// two diffs must describe the same change.
+func (d *ResourceAttrDiff) merge(other *ResourceAttrDiff) error {
+	if other == nil {
+		return nil
+	}
+
+	if d.Old != other.Old ||
+		d.New != other.New ||
+		d.NewComputed != other.NewComputed ||
+		d.NewRemoved != other.NewRemoved ||
+		!reflect.DeepEqual(d.NewExtra, other.NewExtra) {
+		return fmt.Errorf(
+			"conflicting changes %#v => %#v and %#v => %#v",
+			d.Old, d.New, other.Old, other.New)
+	}
+
+	if d.RequiresNew != other.RequiresNew {
+		return fmt.Errorf(
+			"conflicting requirement for a new resource: %t and %t",
+			d.RequiresNew, other.RequiresNew)
+	}
+
+	if d.Type == DiffAttrUnknown {
+		d.Type = other.Type
+	}
+	d.Sensitive = d.Sensitive || other.Sensitive
+
+	return nil
+}
+
 func (d *ResourceAttrDiff) GoString() string {
 	return fmt.Sprintf("*%#v", *d)
 }
@@ -435,23 +544,18 @@ func (d *InstanceDiff) Copy() (*InstanceDiff, error) {
 // ChangeType returns the DiffChangeType represented by the diff
 // for this single instance.
 func (d *InstanceDiff) ChangeType() DiffChangeType {
-	if d.Empty() {
-		return DiffNone
-	}
-
-	if d.RequiresNew() && (d.GetDestroy() || d.GetDestroyTainted()) {
-		return DiffDestroyCreate
-	}
-
-	if d.GetDestroy() || d.GetDestroyDeposed() {
-		return DiffDestroy
-	}
-
-	if d.RequiresNew() {
+	switch d.Action() {
+	case DiffActionCreate:
 		return DiffCreate
+	case DiffActionUpdate:
+		return DiffUpdate
+	case DiffActionDelete:
+		return DiffDestroy
+	case DiffActionReplace:
+		return DiffDestroyCreate
 	}
 
-	return DiffUpdate
+	return DiffNone
 }
 
 // Empty returns true if this diff encapsulates no changes.
@@ -493,13 +597,43 @@ func (d *InstanceDiff) DeepCopy() *InstanceDiff {
 	return copy.(*InstanceDiff)
 }
 
+// GoString prints the attributes in the order of SortedAttributeKeys, so
+// that equal diffs always print the same.
 func (d *InstanceDiff) GoString() string {
-	return fmt.Sprintf("*%#v", InstanceDiff{
-		Attributes:     d.Attributes,
-		Destroy:        d.Destroy,
-		DestroyTainted: d.DestroyTainted,
-		DestroyDeposed: d.DestroyDeposed,
-	})
+	var buf bytes.Buffer
+	buf.WriteString("*terraform.InstanceDiff{Attributes:map[string]*terraform.ResourceAttrDiff{")
+	for i, k := range d.sortedAttributeKeys() {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		fmt.Fprintf(&buf, "%q:%#v", k, d.Attributes[k])
+	}
+	fmt.Fprintf(&buf, "}, Destroy:%t, DestroyDeposed:%t, DestroyTainted:%t}",
+		d.Destroy, d.DestroyDeposed, d.DestroyTainted)
+
+	return buf.String()
+}
+
+// SortedAttributeKeys returns the keys of the attribute diffs in a stable
+// order, so that diffs can be compared and written without depending on
+// the order of the map. The keys are sorted by their parts, and the parts
+// that are numbers, such as list indexes, are sorted numerically: "list.2"
+// comes before "list.10".
+func (d *InstanceDiff) SortedAttributeKeys() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.sortedAttributeKeys()
+}
+
+func (d *InstanceDiff) sortedAttributeKeys() []string {
+	keys := make([]string, 0, len(d.Attributes))
+	for k := range d.Attributes {
+		keys = append(keys, k)
+	}
+	sort.Sort(diffKeySort(keys))
+
+	return keys
 }
 
 // RequiresNew returns true if the diff requires the creation of a new
@@ -619,11 +753,139 @@ func (d *InstanceDiff) CopyAttributes() map[string]*ResourceAttrDiff {
 	return attrs
 }
 
+// Merge combines this diff with another diff for the same instance and
+// returns the result as a new diff. Neither diff is modified.
+//
+// Attributes that are only in one of the diffs are copied as-is.
+// Attributes that are in both must describe the same change, including
+// whether it requires a new resource, or an error is returned. The
+// destroy flags are set on the result if they're set on either diff.
+func (d *InstanceDiff) Merge(other *InstanceDiff) (*InstanceDiff, error) {
+	switch {
+	case d == nil:
+		return other.Copy()
+	case other == nil || d == other:
+		return d.Copy()
+	}
+
+	result, err := d.Copy()
+	if err != nil {
+		return nil, err
+	}
+	result.init()
+
+	other.mu.Lock()
+	defer other.mu.Unlock()
+
+	result.Destroy = result.Destroy || other.Destroy
+	result.DestroyDeposed = result.DestroyDeposed || other.DestroyDeposed
+	result.DestroyTainted = result.DestroyTainted || other.DestroyTainted
+
+	for k, v := range other.Attributes {
+		existing, ok := result.Attributes[k]
+		if !ok || existing == nil {
+			attr := *v
+			result.Attributes[k] = &attr
+			continue
+		}
+
+		if err := existing.merge(v); err != nil {
+			return nil, fmt.Errorf("attribute %q: %s", k, err)
+		}
+	}
+
+	for k, v := range other.Meta {
+		if existing, ok := result.Meta[k]; ok {
+			if !reflect.DeepEqual(existing, v) {
+				return nil, fmt.Errorf(
+					"meta %q: conflicting values %#v and %#v", k, existing, v)
+			}
+
+			continue
+		}
+
+		if result.Meta == nil {
+			result.Meta = make(map[string]interface{})
+		}
+		result.Meta[k] = v
+	}
+
+	return result, nil
+}
+
+// sensitiveRedacted is the placeholder for the values of sensitive
+// attributes in the diffs that are passed to hooks.
+const sensitiveRedacted = "<sensitive>"
+
+// redactSensitive returns a copy of the diff with the values of all
+// sensitive attributes replaced by a placeholder, for passing to hooks.
+// The nested attributes of a sensitive list, set or map are redacted as
+// well. If nothing is sensitive then the diff itself is returned.
+func (d *InstanceDiff) redactSensitive() *InstanceDiff {
+	if d == nil {
+		return nil
+	}
+
+	d.mu.Lock()
+	var prefixes []string
+	for k, v := range d.Attributes {
+		if v == nil || !v.Sensitive {
+			continue
+		}
+
+		// "foo.#" and "foo.%" hold the count of "foo", whose elements
+		// are all nested under "foo."
+		k = strings.TrimSuffix(strings.TrimSuffix(k, ".#"), ".%")
+		prefixes = append(prefixes, k+".")
+	}
+	d.mu.Unlock()
+
+	if len(prefixes) == 0 {
+		return d
+	}
+
+	result := d.DeepCopy()
+	for k, v := range result.Attributes {
+		if v == nil {
+			continue
+		}
+
+		if !v.Sensitive {
+			for _, prefix := range prefixes {
+				if strings.HasPrefix(k, prefix) {
+					v.Sensitive = true
+					break
+				}
+			}
+		}
+
+		if v.Sensitive {
+			if v.Old != "" {
+				v.Old = sensitiveRedacted
+			}
+			if v.New != "" {
+				v.New = sensitiveRedacted
+			}
+			v.NewExtra = nil
+		}
+	}
+
+	return result
+}
+
 // Same checks whether or not two InstanceDiff's are the "same". When
 // we say "same", it is not necessarily exactly equal. Instead, it is
 // just checking that the same attributes are changing, a destroy
 // isn't suddenly happening, etc.
 func (d *InstanceDiff) Same(d2 *InstanceDiff) (bool, string) {
+	return d.same(d2, nil)
+}
+
+// same is Same, but an attribute that only one of the diffs changes is
+// allowed if equivalent is non-nil and returns true for its value in d,
+// the planned value, and its value in d2.
+func (d *InstanceDiff) same(
+	d2 *InstanceDiff, equivalent func(k, planned, applied string) bool) (bool, string) {
 	// we can safely compare the pointers without a lock
 	switch {
 	case d == nil && d2 == nil:
@@ -681,14 +943,9 @@ func (d *InstanceDiff) Same(d2 *InstanceDiff) (bool, string) {
 	}
 
 	// Make an ordered list so we are sure the approximated hashes are left
-	// to process at the end of the loop
-	keys := make([]string, 0, len(d.Attributes))
-	for k, _ := range d.Attributes {
-		keys = append(keys, k)
-	}
-	sort.StringSlice(keys).Sort()
-
-	for _, k := range keys {
+	// to process at the end of the loop, and so the reason for a mismatch
+	// is always the same.
+	for _, k := range d.sortedAttributeKeys() {
 		diffOld := d.Attributes[k]
 
 		if _, ok := checkOld[k]; !ok {
@@ -764,6 +1021,12 @@ func (d *InstanceDiff) Same(d2 *InstanceDiff) (bool, string) {
 				ok = true
 			}
 
+			// The attribute isn't changed anymore, so the value it has
+			// now is the old one.
+			if !ok && equivalent != nil && equivalent(k, diffOld.New, diffOld.Old) {
+				ok = true
+			}
+
 			if !ok {
 				return false, fmt.Sprintf("attribute mismatch: %s", k)
 			}
@@ -800,13 +1063,101 @@ func (d *InstanceDiff) Same(d2 *InstanceDiff) (bool, string) {
 		for attr, _ := range checkNew {
 			extras = append(extras, attr)
 		}
-		return false,
-			fmt.Sprintf("extra attributes: %s", strings.Join(extras, ", "))
+		sort.Sort(diffKeySort(extras))
+
+		// The planned value of an attribute that wasn't changed is the
+		// old one.
+		if equivalent != nil {
+			unmatched := extras[:0]
+			for _, attr := range extras {
+				diffNew, _ := d2.GetAttribute(attr)
+				if diffNew == nil || !equivalent(attr, diffNew.Old, diffNew.New) {
+					unmatched = append(unmatched, attr)
+				}
+			}
+			extras = unmatched
+		}
+
+		if len(extras) > 0 {
+			return false,
+				fmt.Sprintf("extra attributes: %s", strings.Join(extras, ", "))
+		}
 	}
 
 	return true, ""
 }
 
+// diffKeySort implements sort.Interface to sort attribute keys. The keys
+// are compared token by token, where a token is a run of digits, a dot or
+// a run of anything else. Two runs of digits are compared numerically, and
+// everything else as strings.
+type diffKeySort []string
+
+func (s diffKeySort) Len() int           { return len(s) }
+func (s diffKeySort) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s diffKeySort) Less(i, j int) bool { return diffKeyLess(s[i], s[j]) }
+
+func diffKeyLess(a, b string) bool {
+	for a != "" && b != "" {
+		ta, tb := diffKeyToken(a), diffKeyToken(b)
+		a, b = a[len(ta):], b[len(tb):]
+		if ta == tb {
+			continue
+		}
+
+		if diffKeyClass(ta[0]) == diffKeyDigits && diffKeyClass(tb[0]) == diffKeyDigits {
+			// Compare the numbers without their leading zeros. If they're
+			// equal, the one with fewer zeros comes first.
+			na, nb := strings.TrimLeft(ta, "0"), strings.TrimLeft(tb, "0")
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if na != nb {
+				return na < nb
+			}
+			return len(ta) < len(tb)
+		}
+
+		return ta < tb
+	}
+
+	return len(a) < len(b)
+}
+
+// diffKeyToken returns the token at the start of s.
+func diffKeyToken(s string) string {
+	class := diffKeyClass(s[0])
+	if class == diffKeyDot {
+		return s[:1]
+	}
+
+	for i := 1; i < len(s); i++ {
+		if diffKeyClass(s[i]) != class {
+			return s[:i]
+		}
+	}
+
+	return s
+}
+
+// The classes of characters that make up the tokens of a key.
+const (
+	diffKeyOther = iota
+	diffKeyDigits
+	diffKeyDot
+)
+
+func diffKeyClass(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return diffKeyDigits
+	case c == '.':
+		return diffKeyDot
+	default:
+		return diffKeyOther
+	}
+}
+
 // moduleDiffSort implements sort.Interface to sort module diffs by path.
 type moduleDiffSort []*ModuleDiff
 
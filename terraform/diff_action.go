@@ -0,0 +1,92 @@
+package terraform
+
+import (
+	"strings"
+)
+
+//go:generate stringer -type=DiffAction diff_action.go
+
+// DiffAction is the action a diff plans for a single resource instance.
+type DiffAction byte
+
+const (
+	DiffActionNoOp DiffAction = iota
+	DiffActionCreate
+	DiffActionRead
+	DiffActionUpdate
+	DiffActionDelete
+	DiffActionReplace
+)
+
+// DiffReplaceOrder is the order in which a replacement destroys the
+// existing instance and creates the new one.
+type DiffReplaceOrder byte
+
+const (
+	// DiffReplaceNone is the order of a diff that isn't a replacement.
+	DiffReplaceNone DiffReplaceOrder = iota
+	DiffReplaceDestroyBeforeCreate
+	DiffReplaceCreateBeforeDestroy
+)
+
+// Action returns the action the diff plans for the instance. This is the
+// single place that decides what a diff does from its destroy flags and
+// attributes.
+//
+// An InstanceDiff doesn't know whether it's for a data source, so reading
+// a data source is reported as a create or update. ModuleDiff.Action
+// reports it as a read.
+func (d *InstanceDiff) Action() DiffAction {
+	if d.Empty() {
+		return DiffActionNoOp
+	}
+
+	if d.RequiresNew() && (d.GetDestroy() || d.GetDestroyTainted()) {
+		return DiffActionReplace
+	}
+
+	if d.GetDestroy() || d.GetDestroyDeposed() {
+		return DiffActionDelete
+	}
+
+	if d.RequiresNew() {
+		return DiffActionCreate
+	}
+
+	return DiffActionUpdate
+}
+
+// ReplaceOrder returns the order in which the replacement the diff plans
+// is done, given whether the resource has create_before_destroy set. This
+// is DiffReplaceNone if the diff doesn't replace the instance.
+func (d *InstanceDiff) ReplaceOrder(createBeforeDestroy bool) DiffReplaceOrder {
+	if d.Action() != DiffActionReplace {
+		return DiffReplaceNone
+	}
+
+	if createBeforeDestroy {
+		return DiffReplaceCreateBeforeDestroy
+	}
+
+	return DiffReplaceDestroyBeforeCreate
+}
+
+// Action returns the action the diff plans for the resource instance with
+// the given name in the module, which is DiffActionRead for a data source
+// that's read.
+func (d *ModuleDiff) Action(name string) DiffAction {
+	rd, ok := d.Resources[name]
+	if !ok {
+		return DiffActionNoOp
+	}
+
+	action := rd.Action()
+	if strings.HasPrefix(name, "data.") {
+		switch action {
+		case DiffActionCreate, DiffActionUpdate, DiffActionReplace:
+			return DiffActionRead
+		}
+	}
+
+	return action
+}
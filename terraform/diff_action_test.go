@@ -0,0 +1,111 @@
+package terraform
+
+import (
+	"testing"
+)
+
+func TestInstanceDiffAction(t *testing.T) {
+	attrs := map[string]*ResourceAttrDiff{
+		"ami": &ResourceAttrDiff{Old: "foo", New: "bar"},
+	}
+	newAttrs := map[string]*ResourceAttrDiff{
+		"ami": &ResourceAttrDiff{Old: "foo", New: "bar", RequiresNew: true},
+	}
+
+	cases := map[string]struct {
+		Diff     *InstanceDiff
+		Action   DiffAction
+		Change   DiffChangeType
+		CBDOrder DiffReplaceOrder
+	}{
+		"empty": {
+			&InstanceDiff{},
+			DiffActionNoOp, DiffNone, DiffReplaceNone,
+		},
+		"update": {
+			&InstanceDiff{Attributes: attrs},
+			DiffActionUpdate, DiffUpdate, DiffReplaceNone,
+		},
+		"create": {
+			&InstanceDiff{Attributes: newAttrs},
+			DiffActionCreate, DiffCreate, DiffReplaceNone,
+		},
+		"destroy": {
+			&InstanceDiff{Destroy: true},
+			DiffActionDelete, DiffDestroy, DiffReplaceNone,
+		},
+		"destroy deposed": {
+			&InstanceDiff{Attributes: attrs, DestroyDeposed: true},
+			DiffActionDelete, DiffDestroy, DiffReplaceNone,
+		},
+		"replace": {
+			&InstanceDiff{Attributes: newAttrs, Destroy: true},
+			DiffActionReplace, DiffDestroyCreate, DiffReplaceCreateBeforeDestroy,
+		},
+		"replace tainted": {
+			&InstanceDiff{Attributes: newAttrs, DestroyTainted: true},
+			DiffActionReplace, DiffDestroyCreate, DiffReplaceCreateBeforeDestroy,
+		},
+	}
+
+	for k, tc := range cases {
+		if actual := tc.Diff.Action(); actual != tc.Action {
+			t.Fatalf("%s: expected %s, got %s", k, tc.Action, actual)
+		}
+		if actual := tc.Diff.ChangeType(); actual != tc.Change {
+			t.Fatalf("%s: expected change type %d, got %d", k, tc.Change, actual)
+		}
+		if actual := tc.Diff.ReplaceOrder(true); actual != tc.CBDOrder {
+			t.Fatalf("%s: expected order %d, got %d", k, tc.CBDOrder, actual)
+		}
+
+		// Without create_before_destroy, a replacement destroys first
+		expected := DiffReplaceNone
+		if tc.Action == DiffActionReplace {
+			expected = DiffReplaceDestroyBeforeCreate
+		}
+		if actual := tc.Diff.ReplaceOrder(false); actual != expected {
+			t.Fatalf("%s: expected order %d, got %d", k, expected, actual)
+		}
+	}
+}
+
+func TestModuleDiffAction(t *testing.T) {
+	d := &ModuleDiff{
+		Path: rootModulePath,
+		Resources: map[string]*InstanceDiff{
+			"aws_instance.foo": &InstanceDiff{
+				Attributes: map[string]*ResourceAttrDiff{
+					"id": &ResourceAttrDiff{NewComputed: true, RequiresNew: true},
+				},
+			},
+			"data.aws_ami.foo": &InstanceDiff{
+				Attributes: map[string]*ResourceAttrDiff{
+					"id": &ResourceAttrDiff{NewComputed: true, RequiresNew: true},
+				},
+			},
+			"data.aws_ami.bar": &InstanceDiff{Destroy: true},
+		},
+	}
+
+	cases := map[string]DiffAction{
+		"aws_instance.foo": DiffActionCreate,
+		"data.aws_ami.foo": DiffActionRead,
+		"data.aws_ami.bar": DiffActionDelete,
+		"aws_instance.bar": DiffActionNoOp,
+	}
+	for name, expected := range cases {
+		if actual := d.Action(name); actual != expected {
+			t.Fatalf("%s: expected %s, got %s", name, expected, actual)
+		}
+	}
+}
+
+func TestDiffActionString(t *testing.T) {
+	if v := DiffActionReplace.String(); v != "DiffActionReplace" {
+		t.Fatalf("bad: %s", v)
+	}
+	if v := DiffAction(100).String(); v != "DiffAction(100)" {
+		t.Fatalf("bad: %s", v)
+	}
+}
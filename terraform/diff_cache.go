@@ -0,0 +1,155 @@
+package terraform
+
+import (
+	"log"
+	"sync"
+
+	"github.com/mitchellh/hashstructure"
+)
+
+// DiffCache caches the diffs providers compute for resources, so repeated
+// plans of a configuration that didn't change don't ask the providers for
+// the same diffs again. It's safe for concurrent use and can be shared by
+// the contexts of a session with ContextOpts.DiffCache.
+//
+// A cached diff is only reused for a resource if both its interpolated
+// configuration and the state it's diffed against are the same as when
+// the diff was cached. A configuration with computed values is never
+// cached, since it depends on the changes planned for other resources.
+// Changes to the configuration of a provider aren't detected, so Clear
+// must be called if a provider is configured differently.
+type DiffCache struct {
+	entries map[string]*diffCacheEntry
+	lock    sync.Mutex
+}
+
+type diffCacheEntry struct {
+	Hash uint64
+	Diff *InstanceDiff
+}
+
+// NewDiffCache returns an empty DiffCache.
+func NewDiffCache() *DiffCache {
+	return &DiffCache{entries: make(map[string]*diffCacheEntry)}
+}
+
+// Len returns the number of cached diffs.
+func (c *DiffCache) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return len(c.entries)
+}
+
+// Clear removes all the cached diffs.
+func (c *DiffCache) Clear() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.entries = make(map[string]*diffCacheEntry)
+}
+
+// copy returns a copy of the cache that's changed independently, or nil
+// if c is nil.
+func (c *DiffCache) copy() *DiffCache {
+	if c == nil {
+		return nil
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	result := NewDiffCache()
+	for k, v := range c.entries {
+		result.entries[k] = v
+	}
+
+	return result
+}
+
+// get returns a copy of the diff cached for the instance with the given
+// config and state, or nil if there is none. This is safe to call on a
+// nil cache.
+func (c *DiffCache) get(
+	info *InstanceInfo, config *ResourceConfig, state *InstanceState) *InstanceDiff {
+	if c == nil {
+		return nil
+	}
+
+	hash, ok := diffCacheHash(config, state)
+	if !ok {
+		return nil
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	e, ok := c.entries[info.uniqueId()]
+	if !ok || e.Hash != hash {
+		return nil
+	}
+
+	log.Printf("[TRACE] %s: using the cached diff", info.HumanId())
+	return e.Diff.DeepCopy()
+}
+
+// put caches a copy of the diff the provider computed for the instance
+// with the given config and state, replacing any diff cached for it
+// before. This is safe to call on a nil cache.
+func (c *DiffCache) put(
+	info *InstanceInfo, config *ResourceConfig, state *InstanceState,
+	diff *InstanceDiff) {
+	if c == nil {
+		return
+	}
+
+	key := info.uniqueId()
+	hash, ok := diffCacheHash(config, state)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if !ok {
+		// The config may have become computed since it was cached, so the
+		// old diff is never valid again.
+		delete(c.entries, key)
+		return
+	}
+
+	c.entries[key] = &diffCacheEntry{
+		Hash: hash,
+		Diff: diff.DeepCopy(),
+	}
+}
+
+// diffCacheHash returns the hash of the config and state that a diff is
+// cached for. This returns false if the diff can't be cached.
+func diffCacheHash(config *ResourceConfig, state *InstanceState) (uint64, bool) {
+	if config == nil || len(config.ComputedKeys) > 0 {
+		return 0, false
+	}
+
+	v := struct {
+		Config     map[string]interface{}
+		ID         string
+		Attributes map[string]string
+		Meta       map[string]string
+		Tainted    bool
+	}{
+		Config: config.Config,
+	}
+	if state != nil {
+		v.ID = state.ID
+		v.Attributes = state.Attributes
+		v.Meta = state.Meta
+		v.Tainted = state.Tainted
+	}
+
+	hash, err := hashstructure.Hash(v, nil)
+	if err != nil {
+		log.Printf("[WARN] not caching diff, error hashing it: %s", err)
+		return 0, false
+	}
+
+	return hash, true
+}
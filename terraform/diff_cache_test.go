@@ -0,0 +1,102 @@
+package terraform
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffCache(t *testing.T) {
+	info := &InstanceInfo{Id: "aws_instance.foo", Type: "aws_instance"}
+	config := testResourceConfig(t, map[string]interface{}{"foo": "bar"})
+	state := &InstanceState{
+		ID:         "foo",
+		Attributes: map[string]string{"foo": "baz"},
+	}
+	diff := &InstanceDiff{
+		Attributes: map[string]*ResourceAttrDiff{
+			"foo": &ResourceAttrDiff{Old: "baz", New: "bar"},
+		},
+	}
+
+	c := NewDiffCache()
+	if actual := c.get(info, config, state); actual != nil {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	c.put(info, config, state, diff)
+	actual := c.get(info, config, state)
+	if !reflect.DeepEqual(actual, diff) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	// The cached diff isn't changed through the result
+	actual.SetAttribute("other", &ResourceAttrDiff{New: "x"})
+	if actual := c.get(info, config, state); !reflect.DeepEqual(actual, diff) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	// Another instance, config or state doesn't hit
+	other := &InstanceInfo{Id: "aws_instance.bar", Type: "aws_instance"}
+	if actual := c.get(other, config, state); actual != nil {
+		t.Fatalf("bad: %#v", actual)
+	}
+	otherConfig := testResourceConfig(t, map[string]interface{}{"foo": "baz"})
+	if actual := c.get(info, otherConfig, state); actual != nil {
+		t.Fatalf("bad: %#v", actual)
+	}
+	otherState := state.DeepCopy()
+	otherState.Attributes["foo"] = "qux"
+	if actual := c.get(info, config, otherState); actual != nil {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	// The copy is independent
+	copied := c.copy()
+	c.Clear()
+	if c.Len() != 0 {
+		t.Fatalf("bad: %d", c.Len())
+	}
+	if actual := copied.get(info, config, state); !reflect.DeepEqual(actual, diff) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestDiffCache_computed(t *testing.T) {
+	info := &InstanceInfo{Id: "aws_instance.foo", Type: "aws_instance"}
+	known := testResourceConfig(t, map[string]interface{}{"foo": "bar"})
+	computed := testResourceConfig(t, map[string]interface{}{"foo": "bar"})
+	computed.ComputedKeys = []string{"foo"}
+	state := &InstanceState{ID: "foo"}
+	diff := &InstanceDiff{
+		Attributes: map[string]*ResourceAttrDiff{
+			"foo": &ResourceAttrDiff{New: "bar"},
+		},
+	}
+
+	c := NewDiffCache()
+	c.put(info, computed, state, diff)
+	if c.Len() != 0 {
+		t.Fatalf("bad: %d", c.Len())
+	}
+
+	// A config that becomes computed removes the diff cached before
+	c.put(info, known, state, diff)
+	c.put(info, computed, state, diff)
+	if actual := c.get(info, known, state); actual != nil {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestDiffCache_nil(t *testing.T) {
+	var c *DiffCache
+	info := &InstanceInfo{Id: "aws_instance.foo", Type: "aws_instance"}
+	config := testResourceConfig(t, map[string]interface{}{"foo": "bar"})
+
+	c.put(info, config, nil, new(InstanceDiff))
+	if actual := c.get(info, config, nil); actual != nil {
+		t.Fatalf("bad: %#v", actual)
+	}
+	if c.copy() != nil {
+		t.Fatal("should be nil")
+	}
+}
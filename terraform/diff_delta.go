@@ -0,0 +1,148 @@
+package terraform
+
+import (
+	"reflect"
+	"sort"
+)
+
+// ResourceDiffDelta describes how the planned change to a single resource
+// instance differs between two diffs, such as two plans of the same
+// configuration made at different times.
+type ResourceDiffDelta struct {
+	// Addr is the address of the resource instance.
+	Addr string
+
+	// OldChange and NewChange are the changes planned for the instance
+	// in each diff. An instance without a change in a diff has DiffNone.
+	OldChange DiffChangeType
+	NewChange DiffChangeType
+
+	// AddedAttributes and RemovedAttributes are the attributes that only
+	// have a diff in the new or the old diff, respectively.
+	// ChangedAttributes are the attributes in both whose diff differs,
+	// for example because a different value is planned. All are sorted.
+	AddedAttributes   []string
+	RemovedAttributes []string
+	ChangedAttributes []string
+}
+
+// Added returns true if the instance only has a change in the new diff.
+func (d *ResourceDiffDelta) Added() bool {
+	return d.OldChange == DiffNone && d.NewChange != DiffNone
+}
+
+// Removed returns true if the instance only has a change in the old diff.
+func (d *ResourceDiffDelta) Removed() bool {
+	return d.OldChange != DiffNone && d.NewChange == DiffNone
+}
+
+// DiffDelta compares two diffs and returns the resource instances whose
+// planned change differs between them, sorted by address. Instances that
+// are planned the same in both aren't returned.
+//
+// Either diff may be nil, in which case all the changes of the other are
+// reported as added or removed.
+func DiffDelta(old, new *Diff) ([]*ResourceDiffDelta, error) {
+	oldDiffs, err := diffDeltaInstances(old)
+	if err != nil {
+		return nil, err
+	}
+	newDiffs, err := diffDeltaInstances(new)
+	if err != nil {
+		return nil, err
+	}
+
+	addrs := make([]string, 0, len(oldDiffs)+len(newDiffs))
+	for addr := range oldDiffs {
+		addrs = append(addrs, addr)
+	}
+	for addr := range newDiffs {
+		if _, ok := oldDiffs[addr]; !ok {
+			addrs = append(addrs, addr)
+		}
+	}
+	sort.Strings(addrs)
+
+	var result []*ResourceDiffDelta
+	for _, addr := range addrs {
+		if d := newResourceDiffDelta(addr, oldDiffs[addr], newDiffs[addr]); d != nil {
+			result = append(result, d)
+		}
+	}
+
+	return result, nil
+}
+
+// diffDeltaInstances returns the instance diffs with changes in d, keyed
+// by the address of the instance.
+func diffDeltaInstances(d *Diff) (map[string]*InstanceDiff, error) {
+	result := make(map[string]*InstanceDiff)
+	if d == nil {
+		return result, nil
+	}
+
+	for _, m := range d.Modules {
+		for name, rd := range m.Resources {
+			if rd.ChangeType() == DiffNone {
+				continue
+			}
+
+			addr, err := parseResourceAddressInternal(name)
+			if err != nil {
+				return nil, err
+			}
+			addr.Path = m.Path[1:]
+
+			result[addr.String()] = rd
+		}
+	}
+
+	return result, nil
+}
+
+// newResourceDiffDelta compares the diffs of a single instance, either of
+// which may be nil. This returns nil if they're the same.
+func newResourceDiffDelta(addr string, old, new *InstanceDiff) *ResourceDiffDelta {
+	result := &ResourceDiffDelta{
+		Addr:      addr,
+		OldChange: DiffNone,
+		NewChange: DiffNone,
+	}
+
+	var oldAttrs, newAttrs map[string]*ResourceAttrDiff
+	if old != nil {
+		result.OldChange = old.ChangeType()
+		oldAttrs = old.CopyAttributes()
+	}
+	if new != nil {
+		result.NewChange = new.ChangeType()
+		newAttrs = new.CopyAttributes()
+	}
+
+	for k, oldAttr := range oldAttrs {
+		newAttr, ok := newAttrs[k]
+		switch {
+		case !ok:
+			result.RemovedAttributes = append(result.RemovedAttributes, k)
+		case !reflect.DeepEqual(oldAttr, newAttr):
+			result.ChangedAttributes = append(result.ChangedAttributes, k)
+		}
+	}
+	for k := range newAttrs {
+		if _, ok := oldAttrs[k]; !ok {
+			result.AddedAttributes = append(result.AddedAttributes, k)
+		}
+	}
+
+	if result.OldChange == result.NewChange &&
+		len(result.AddedAttributes) == 0 &&
+		len(result.RemovedAttributes) == 0 &&
+		len(result.ChangedAttributes) == 0 {
+		return nil
+	}
+
+	sort.Strings(result.AddedAttributes)
+	sort.Strings(result.RemovedAttributes)
+	sort.Strings(result.ChangedAttributes)
+	return result
+}
@@ -0,0 +1,165 @@
+package terraform
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffDelta(t *testing.T) {
+	old := &Diff{
+		Modules: []*ModuleDiff{
+			&ModuleDiff{
+				Path: rootModulePath,
+				Resources: map[string]*InstanceDiff{
+					"aws_instance.same": &InstanceDiff{
+						Attributes: map[string]*ResourceAttrDiff{
+							"ami": &ResourceAttrDiff{Old: "foo", New: "bar"},
+						},
+					},
+					"aws_instance.action": &InstanceDiff{
+						Attributes: map[string]*ResourceAttrDiff{
+							"ami": &ResourceAttrDiff{Old: "foo", New: "bar"},
+						},
+					},
+					"aws_instance.attrs": &InstanceDiff{
+						Attributes: map[string]*ResourceAttrDiff{
+							"ami":  &ResourceAttrDiff{Old: "foo", New: "bar"},
+							"size": &ResourceAttrDiff{Old: "1", New: "2"},
+							"type": &ResourceAttrDiff{Old: "t1", New: "t2"},
+						},
+					},
+					"aws_instance.removed": &InstanceDiff{
+						Destroy: true,
+					},
+					"aws_instance.empty": &InstanceDiff{},
+				},
+			},
+		},
+	}
+
+	new := &Diff{
+		Modules: []*ModuleDiff{
+			&ModuleDiff{
+				Path: rootModulePath,
+				Resources: map[string]*InstanceDiff{
+					"aws_instance.same": &InstanceDiff{
+						Attributes: map[string]*ResourceAttrDiff{
+							"ami": &ResourceAttrDiff{Old: "foo", New: "bar"},
+						},
+					},
+					"aws_instance.action": &InstanceDiff{
+						Destroy: true,
+						Attributes: map[string]*ResourceAttrDiff{
+							"ami": &ResourceAttrDiff{Old: "foo", New: "bar", RequiresNew: true},
+						},
+					},
+					"aws_instance.attrs": &InstanceDiff{
+						Attributes: map[string]*ResourceAttrDiff{
+							"ami":  &ResourceAttrDiff{Old: "foo", New: "baz"},
+							"size": &ResourceAttrDiff{Old: "1", New: "2"},
+							"tags": &ResourceAttrDiff{Old: "", New: "x"},
+						},
+					},
+				},
+			},
+			&ModuleDiff{
+				Path: []string{"root", "child"},
+				Resources: map[string]*InstanceDiff{
+					"aws_instance.added.1": &InstanceDiff{
+						Attributes: map[string]*ResourceAttrDiff{
+							"ami": &ResourceAttrDiff{Old: "", New: "bar"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	actual, err := DiffDelta(old, new)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []*ResourceDiffDelta{
+		&ResourceDiffDelta{
+			Addr:              "aws_instance.action",
+			OldChange:         DiffUpdate,
+			NewChange:         DiffDestroyCreate,
+			ChangedAttributes: []string{"ami"},
+		},
+		&ResourceDiffDelta{
+			Addr:              "aws_instance.attrs",
+			OldChange:         DiffUpdate,
+			NewChange:         DiffUpdate,
+			AddedAttributes:   []string{"tags"},
+			RemovedAttributes: []string{"type"},
+			ChangedAttributes: []string{"ami"},
+		},
+		&ResourceDiffDelta{
+			Addr:      "aws_instance.removed",
+			OldChange: DiffDestroy,
+			NewChange: DiffNone,
+		},
+		&ResourceDiffDelta{
+			Addr:            "module.child.aws_instance.added[1]",
+			OldChange:       DiffNone,
+			NewChange:       DiffUpdate,
+			AddedAttributes: []string{"ami"},
+		},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		for _, d := range actual {
+			t.Logf("%#v", d)
+		}
+		t.Fatal("bad")
+	}
+
+	if actual[0].Added() || actual[0].Removed() {
+		t.Fatalf("bad: %#v", actual[0])
+	}
+	if !actual[2].Removed() {
+		t.Fatalf("should be removed: %#v", actual[2])
+	}
+	if !actual[3].Added() {
+		t.Fatalf("should be added: %#v", actual[3])
+	}
+}
+
+func TestDiffDelta_nil(t *testing.T) {
+	d := &Diff{
+		Modules: []*ModuleDiff{
+			&ModuleDiff{
+				Path: rootModulePath,
+				Resources: map[string]*InstanceDiff{
+					"aws_instance.foo": &InstanceDiff{
+						Destroy: true,
+					},
+				},
+			},
+		},
+	}
+
+	actual, err := DiffDelta(nil, d)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(actual) != 1 || !actual[0].Added() {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	actual, err = DiffDelta(d, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(actual) != 1 || !actual[0].Removed() {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	actual, err = DiffDelta(d, d)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(actual) != 0 {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
@@ -0,0 +1,133 @@
+package terraform
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+)
+
+// jsonDiff is the machine-readable representation of a Diff written by
+// WriteDiffJSON. Resources and attributes are sorted so that the output
+// for the same diff is always identical.
+type jsonDiff struct {
+	Resources []*jsonResourceDiff `json:"resources"`
+}
+
+// jsonResourceDiff is the representation of a single InstanceDiff.
+type jsonResourceDiff struct {
+	Address    string          `json:"address"`
+	Action     string          `json:"action"`
+	Attributes []*jsonAttrDiff `json:"attributes"`
+}
+
+// jsonAttrDiff is the representation of a single ResourceAttrDiff.
+type jsonAttrDiff struct {
+	Name        string `json:"name"`
+	Old         string `json:"old"`
+	New         string `json:"new"`
+	Computed    bool   `json:"computed"`
+	Removed     bool   `json:"removed"`
+	RequiresNew bool   `json:"requires_new"`
+	Sensitive   bool   `json:"sensitive"`
+
+	// Reasons say why the attribute changed, if it's known.
+	Reasons []DiffReason `json:"reasons,omitempty"`
+}
+
+// WriteDiffJSON writes the diff in a stable JSON format to the given
+// writer. Each resource with changes is written with its address, the
+// action that will be taken ("create", "update", "destroy" or "replace")
+// and the old and new values of each attribute. Sensitive values are
+// never written.
+func WriteDiffJSON(d *Diff, dst io.Writer) error {
+	result := &jsonDiff{Resources: make([]*jsonResourceDiff, 0)}
+	if d != nil {
+		for _, m := range d.Modules {
+			for name, rd := range m.Resources {
+				r, err := newJSONResourceDiff(m.Path, name, rd)
+				if err != nil {
+					return err
+				}
+				if r != nil {
+					result.Resources = append(result.Resources, r)
+				}
+			}
+		}
+	}
+	sort.Sort(jsonResourceDiffSort(result.Resources))
+
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	_, err = dst.Write(data)
+	return err
+}
+
+// newJSONResourceDiff builds the representation of a single instance
+// diff. This returns nil if the diff has no changes.
+func newJSONResourceDiff(
+	path []string, name string, d *InstanceDiff) (*jsonResourceDiff, error) {
+	var action string
+	switch d.Action() {
+	case DiffActionCreate:
+		action = "create"
+	case DiffActionUpdate:
+		action = "update"
+	case DiffActionDelete:
+		action = "destroy"
+	case DiffActionReplace:
+		action = "replace"
+	default:
+		return nil, nil
+	}
+
+	addr, err := parseResourceAddressInternal(name)
+	if err != nil {
+		return nil, err
+	}
+	addr.Path = path[1:]
+
+	attrs := d.CopyAttributes()
+	keys := d.SortedAttributeKeys()
+
+	result := &jsonResourceDiff{
+		Address:    addr.String(),
+		Action:     action,
+		Attributes: make([]*jsonAttrDiff, 0, len(keys)),
+	}
+	for _, k := range keys {
+		ad := attrs[k]
+		attr := &jsonAttrDiff{
+			Name:        k,
+			Old:         ad.Old,
+			New:         ad.New,
+			Computed:    ad.NewComputed,
+			Removed:     ad.NewRemoved,
+			RequiresNew: ad.RequiresNew,
+			Sensitive:   ad.Sensitive,
+			Reasons:     ad.Reasons,
+		}
+		if attr.Computed || attr.Sensitive {
+			attr.New = ""
+		}
+		if attr.Sensitive {
+			attr.Old = ""
+		}
+
+		result.Attributes = append(result.Attributes, attr)
+	}
+
+	return result, nil
+}
+
+// jsonResourceDiffSort sorts resources by address.
+type jsonResourceDiffSort []*jsonResourceDiff
+
+func (s jsonResourceDiffSort) Len() int      { return len(s) }
+func (s jsonResourceDiffSort) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s jsonResourceDiffSort) Less(i, j int) bool {
+	return s[i].Address < s[j].Address
+}
@@ -0,0 +1,112 @@
+package terraform
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/terraform/config"
+)
+
+func TestWriteDiffJSON(t *testing.T) {
+	diff := &Diff{
+		Modules: []*ModuleDiff{
+			&ModuleDiff{
+				Path: rootModulePath,
+				Resources: map[string]*InstanceDiff{
+					"aws_instance.create": &InstanceDiff{
+						Attributes: map[string]*ResourceAttrDiff{
+							"ami": &ResourceAttrDiff{
+								New:         "ami-123",
+								RequiresNew: true,
+							},
+							"id": &ResourceAttrDiff{
+								NewComputed: true,
+								New:         config.UnknownVariableValue,
+								RequiresNew: true,
+							},
+						},
+					},
+					"aws_instance.update.1": &InstanceDiff{
+						Attributes: map[string]*ResourceAttrDiff{
+							"tags.%": &ResourceAttrDiff{
+								Old: "1",
+								New: "0",
+							},
+							"tags.Name": &ResourceAttrDiff{
+								Old:        "web",
+								NewRemoved: true,
+							},
+							"password": &ResourceAttrDiff{
+								Old:       "secret",
+								New:       "hunter2",
+								Sensitive: true,
+							},
+						},
+					},
+					"aws_instance.destroy": &InstanceDiff{
+						Destroy: true,
+					},
+					"aws_instance.replace": &InstanceDiff{
+						Destroy: true,
+						Attributes: map[string]*ResourceAttrDiff{
+							"ami": &ResourceAttrDiff{
+								Old:         "ami-123",
+								New:         "ami-456",
+								RequiresNew: true,
+								Reasons: []DiffReason{
+									DiffReasonDrift, DiffReasonConfig,
+								},
+							},
+						},
+					},
+					"aws_instance.noop": &InstanceDiff{},
+				},
+			},
+			&ModuleDiff{
+				Path: []string{"root", "child"},
+				Resources: map[string]*InstanceDiff{
+					"aws_instance.foo": &InstanceDiff{
+						Attributes: map[string]*ResourceAttrDiff{
+							"count": &ResourceAttrDiff{
+								Old: "1",
+								New: "2",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	expected, err := ioutil.ReadFile(
+		filepath.Join(fixtureDir, "diff-json-basic", "diff.json"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Write it multiple times to verify the output is stable
+	for i := 0; i < 5; i++ {
+		var buf bytes.Buffer
+		if err := WriteDiffJSON(diff, &buf); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		if !bytes.Equal(buf.Bytes(), expected) {
+			t.Fatalf("bad:\n\n%s", buf.String())
+		}
+	}
+}
+
+func TestWriteDiffJSON_nil(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteDiffJSON(nil, &buf); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := "{\n  \"resources\": []\n}\n"
+	if buf.String() != expected {
+		t.Fatalf("bad:\n\n%s", buf.String())
+	}
+}
@@ -0,0 +1,62 @@
+package terraform
+
+// DiffReason says why an attribute is in the diff of a resource instance.
+// An attribute can have more than one reason, such as a value that was
+// changed outside of Terraform and is also changed in the configuration.
+type DiffReason string
+
+const (
+	// DiffReasonConfig is an attribute whose configuration changed since
+	// the resource was last applied, or an attribute of a resource that's
+	// created.
+	DiffReasonConfig DiffReason = "config"
+
+	// DiffReasonDrift is an attribute whose value was changed outside of
+	// Terraform, so that the refresh before the plan found a different
+	// value than the state had.
+	DiffReasonDrift DiffReason = "drift"
+
+	// DiffReasonTainted is an attribute of a tainted resource, which is
+	// replaced.
+	DiffReasonTainted DiffReason = "tainted"
+
+	// DiffReasonReplaceTriggered is an attribute of a resource that's
+	// replaced because of a change to a resource in its
+	// lifecycle.replace_triggered_by.
+	DiffReasonReplaceTriggered DiffReason = "replace_triggered"
+
+	// DiffReasonForced is an attribute the user forced into the diff, or
+	// an attribute of a resource the user forced to be replaced.
+	DiffReasonForced DiffReason = "forced"
+)
+
+// HasReason returns true if the attribute has the given reason.
+func (d *ResourceAttrDiff) HasReason(r DiffReason) bool {
+	for _, v := range d.Reasons {
+		if v == r {
+			return true
+		}
+	}
+
+	return false
+}
+
+// addReasons adds the reasons the attribute doesn't already have.
+func (d *ResourceAttrDiff) addReasons(rs ...DiffReason) {
+	for _, r := range rs {
+		if !d.HasReason(r) {
+			d.Reasons = append(d.Reasons, r)
+		}
+	}
+}
+
+// unrefreshedStateReader is implemented by EvalContexts that know the
+// states of resources from before the refresh that preceded the plan, so
+// that changes made outside of Terraform can be told apart from changes
+// to the configuration.
+type unrefreshedStateReader interface {
+	// unrefreshedInstance returns the primary instance with the given
+	// name in the module from before the refresh, and whether it's known.
+	// The instance is nil if it's known not to have existed.
+	unrefreshedInstance(name string) (*InstanceState, bool)
+}
@@ -1,6 +1,7 @@
 package terraform
 
 import (
+	"fmt"
 	"reflect"
 	"strings"
 	"testing"
@@ -150,6 +151,88 @@ func TestDiffPrune(t *testing.T) {
 	}
 }
 
+func TestDiffStats(t *testing.T) {
+	update := func() *InstanceDiff {
+		return &InstanceDiff{
+			Attributes: map[string]*ResourceAttrDiff{
+				"foo": &ResourceAttrDiff{Old: "", New: "bar"},
+			},
+		}
+	}
+	create := func() *InstanceDiff {
+		return &InstanceDiff{
+			Attributes: map[string]*ResourceAttrDiff{
+				"foo": &ResourceAttrDiff{Old: "", New: "bar", RequiresNew: true},
+			},
+		}
+	}
+	replace := func() *InstanceDiff {
+		d := create()
+		d.Destroy = true
+		return d
+	}
+
+	diff := &Diff{
+		Modules: []*ModuleDiff{
+			&ModuleDiff{
+				Path: rootModulePath,
+				Resources: map[string]*InstanceDiff{
+					"aws_instance.create.0": create(),
+					"aws_instance.create.1": create(),
+					"aws_instance.update":   update(),
+					"aws_instance.destroy":  &InstanceDiff{Destroy: true},
+					"aws_instance.replace":  replace(),
+					"aws_instance.tainted": &InstanceDiff{
+						DestroyTainted: true,
+						Attributes:     create().Attributes,
+					},
+					"aws_instance.deposed": &InstanceDiff{DestroyDeposed: true},
+					"aws_instance.empty":   &InstanceDiff{},
+					"data.aws_ami.read":    create(),
+				},
+			},
+			&ModuleDiff{
+				Path: []string{"root", "child"},
+				Resources: map[string]*InstanceDiff{
+					"aws_instance.create":  create(),
+					"aws_instance.destroy": &InstanceDiff{Destroy: true},
+				},
+			},
+		},
+	}
+
+	cases := map[string]struct {
+		Diff            *Diff
+		SeparateReplace bool
+		Expected        DiffStats
+	}{
+		"nil": {
+			nil,
+			false,
+			DiffStats{},
+		},
+
+		"replace as add and destroy": {
+			diff,
+			false,
+			DiffStats{Add: 5, Change: 1, Destroy: 5},
+		},
+
+		"replace separately": {
+			diff,
+			true,
+			DiffStats{Add: 3, Change: 1, Destroy: 3, Replace: 2},
+		},
+	}
+
+	for k, tc := range cases {
+		actual := tc.Diff.Stats(tc.SeparateReplace)
+		if actual != tc.Expected {
+			t.Fatalf("%s: bad: %#v", k, actual)
+		}
+	}
+}
+
 func TestModuleDiff_ChangeType(t *testing.T) {
 	cases := []struct {
 		Diff   *ModuleDiff
@@ -291,6 +374,22 @@ func TestModuleDiff_Empty(t *testing.T) {
 	}
 }
 
+func TestModuleDiff_deferredCount(t *testing.T) {
+	diff := new(ModuleDiff)
+	diff.AddDeferredCount("aws_instance.foo")
+	diff.AddDeferredCount("aws_instance.bar")
+	diff.AddDeferredCount("aws_instance.foo")
+
+	expected := []string{"aws_instance.bar", "aws_instance.foo"}
+	if !reflect.DeepEqual(diff.DeferredCount, expected) {
+		t.Fatalf("bad: %#v", diff.DeferredCount)
+	}
+
+	if diff.Empty() {
+		t.Fatal("should not be empty")
+	}
+}
+
 func TestModuleDiff_String(t *testing.T) {
 	diff := &ModuleDiff{
 		Resources: map[string]*InstanceDiff{
@@ -518,6 +617,351 @@ func TestInstanceDiff_RequiresNew_nil(t *testing.T) {
 	}
 }
 
+func TestInstanceDiffMerge(t *testing.T) {
+	cases := map[string]struct {
+		One, Two *InstanceDiff
+		Expected *InstanceDiff
+		Err      string
+	}{
+		"nil": {
+			nil,
+			nil,
+			nil,
+			"",
+		},
+
+		"one nil": {
+			nil,
+			&InstanceDiff{Destroy: true},
+			&InstanceDiff{Destroy: true},
+			"",
+		},
+
+		"disjoint attributes": {
+			&InstanceDiff{
+				Attributes: map[string]*ResourceAttrDiff{
+					"foo": &ResourceAttrDiff{Old: "", New: "bar"},
+				},
+			},
+			&InstanceDiff{
+				DestroyTainted: true,
+				Attributes: map[string]*ResourceAttrDiff{
+					"baz": &ResourceAttrDiff{
+						Old:         "",
+						New:         "qux",
+						RequiresNew: true,
+					},
+				},
+			},
+			&InstanceDiff{
+				DestroyTainted: true,
+				Attributes: map[string]*ResourceAttrDiff{
+					"foo": &ResourceAttrDiff{Old: "", New: "bar"},
+					"baz": &ResourceAttrDiff{
+						Old:         "",
+						New:         "qux",
+						RequiresNew: true,
+					},
+				},
+			},
+			"",
+		},
+
+		"overlapping identical attributes": {
+			&InstanceDiff{
+				Attributes: map[string]*ResourceAttrDiff{
+					"foo": &ResourceAttrDiff{
+						Old:         "",
+						NewComputed: true,
+						RequiresNew: true,
+					},
+				},
+				Meta: map[string]interface{}{"a": "b"},
+			},
+			&InstanceDiff{
+				Destroy: true,
+				Attributes: map[string]*ResourceAttrDiff{
+					"foo": &ResourceAttrDiff{
+						Old:         "",
+						NewComputed: true,
+						RequiresNew: true,
+						Sensitive:   true,
+						Type:        DiffAttrOutput,
+					},
+				},
+				Meta: map[string]interface{}{"a": "b", "c": "d"},
+			},
+			&InstanceDiff{
+				Destroy: true,
+				Attributes: map[string]*ResourceAttrDiff{
+					"foo": &ResourceAttrDiff{
+						Old:         "",
+						NewComputed: true,
+						RequiresNew: true,
+						Sensitive:   true,
+						Type:        DiffAttrOutput,
+					},
+				},
+				Meta: map[string]interface{}{"a": "b", "c": "d"},
+			},
+			"",
+		},
+
+		"conflicting values": {
+			&InstanceDiff{
+				Attributes: map[string]*ResourceAttrDiff{
+					"foo": &ResourceAttrDiff{Old: "", New: "bar"},
+				},
+			},
+			&InstanceDiff{
+				Attributes: map[string]*ResourceAttrDiff{
+					"foo": &ResourceAttrDiff{Old: "", New: "baz"},
+				},
+			},
+			nil,
+			`attribute "foo": conflicting changes`,
+		},
+
+		"conflicting requires new": {
+			&InstanceDiff{
+				Attributes: map[string]*ResourceAttrDiff{
+					"foo": &ResourceAttrDiff{Old: "", New: "bar"},
+				},
+			},
+			&InstanceDiff{
+				Attributes: map[string]*ResourceAttrDiff{
+					"foo": &ResourceAttrDiff{
+						Old:         "",
+						New:         "bar",
+						RequiresNew: true,
+					},
+				},
+			},
+			nil,
+			`attribute "foo": conflicting requirement for a new resource`,
+		},
+
+		"conflicting meta": {
+			&InstanceDiff{Meta: map[string]interface{}{"a": "b"}},
+			&InstanceDiff{Meta: map[string]interface{}{"a": "c"}},
+			nil,
+			`meta "a": conflicting values`,
+		},
+	}
+
+	for name, tc := range cases {
+		actual, err := tc.One.Merge(tc.Two)
+		if tc.Err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.Err) {
+				t.Fatalf("%s: expected error %q, got: %v", name, tc.Err, err)
+			}
+
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: err: %s", name, err)
+		}
+
+		if !reflect.DeepEqual(actual, tc.Expected) {
+			t.Fatalf("%s: bad:\n\n%#v\n\nexpected:\n\n%#v", name, actual, tc.Expected)
+		}
+	}
+}
+
+func TestInstanceDiffMerge_noModify(t *testing.T) {
+	one := &InstanceDiff{
+		Attributes: map[string]*ResourceAttrDiff{
+			"foo": &ResourceAttrDiff{Old: "", New: "bar"},
+		},
+	}
+	two := &InstanceDiff{
+		Attributes: map[string]*ResourceAttrDiff{
+			"foo": &ResourceAttrDiff{Old: "", New: "bar", Sensitive: true},
+			"baz": &ResourceAttrDiff{Old: "", New: "qux"},
+		},
+	}
+
+	result, err := one.Merge(two)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	result.Attributes["baz"].New = "changed"
+
+	if len(one.Attributes) != 1 || one.Attributes["foo"].Sensitive {
+		t.Fatalf("one was modified: %#v", one)
+	}
+	if two.Attributes["baz"].New != "qux" {
+		t.Fatalf("two was modified: %#v", two)
+	}
+}
+
+func TestInstanceDiffRedactSensitive(t *testing.T) {
+	d := &InstanceDiff{
+		Attributes: map[string]*ResourceAttrDiff{
+			"foo": &ResourceAttrDiff{Old: "a", New: "b"},
+			"password": &ResourceAttrDiff{
+				Old:       "old",
+				New:       "new",
+				Sensitive: true,
+			},
+			"token": &ResourceAttrDiff{
+				Old:         "",
+				NewComputed: true,
+				Sensitive:   true,
+			},
+			"keys.#":     &ResourceAttrDiff{Old: "0", New: "1", Sensitive: true},
+			"keys.0":     &ResourceAttrDiff{Old: "", New: "s3cret"},
+			"tags.%":     &ResourceAttrDiff{Old: "0", New: "1", Sensitive: true},
+			"tags.name":  &ResourceAttrDiff{Old: "", New: "n"},
+			"keystore":   &ResourceAttrDiff{Old: "", New: "visible"},
+			"passwords":  &ResourceAttrDiff{Old: "", New: "visible"},
+			"password.x": &ResourceAttrDiff{Old: "", New: "nested"},
+		},
+	}
+
+	actual := d.redactSensitive()
+	expected := &InstanceDiff{
+		Attributes: map[string]*ResourceAttrDiff{
+			"foo": &ResourceAttrDiff{Old: "a", New: "b"},
+			"password": &ResourceAttrDiff{
+				Old:       sensitiveRedacted,
+				New:       sensitiveRedacted,
+				Sensitive: true,
+			},
+			"token": &ResourceAttrDiff{
+				Old:         "",
+				NewComputed: true,
+				Sensitive:   true,
+			},
+			"keys.#": &ResourceAttrDiff{
+				Old:       sensitiveRedacted,
+				New:       sensitiveRedacted,
+				Sensitive: true,
+			},
+			"keys.0": &ResourceAttrDiff{
+				Old:       "",
+				New:       sensitiveRedacted,
+				Sensitive: true,
+			},
+			"tags.%": &ResourceAttrDiff{
+				Old:       sensitiveRedacted,
+				New:       sensitiveRedacted,
+				Sensitive: true,
+			},
+			"tags.name": &ResourceAttrDiff{
+				Old:       "",
+				New:       sensitiveRedacted,
+				Sensitive: true,
+			},
+			"keystore":  &ResourceAttrDiff{Old: "", New: "visible"},
+			"passwords": &ResourceAttrDiff{Old: "", New: "visible"},
+			"password.x": &ResourceAttrDiff{
+				Old:       "",
+				New:       sensitiveRedacted,
+				Sensitive: true,
+			},
+		},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad:\n\n%#v\n\nexpected:\n\n%#v", actual, expected)
+	}
+
+	// The original must keep the real values
+	if d.Attributes["password"].New != "new" || d.Attributes["keys.0"].Sensitive {
+		t.Fatalf("original was modified: %#v", d)
+	}
+}
+
+func TestInstanceDiffRedactSensitive_none(t *testing.T) {
+	d := &InstanceDiff{
+		Attributes: map[string]*ResourceAttrDiff{
+			"foo": &ResourceAttrDiff{Old: "a", New: "b"},
+		},
+	}
+
+	if actual := d.redactSensitive(); actual != d {
+		t.Fatalf("should return the same diff: %#v", actual)
+	}
+}
+
+func TestInstanceDiffSortedAttributeKeys(t *testing.T) {
+	expected := []string{
+		"a",
+		"c[2]",
+		"c[10]",
+		"list.#",
+		"list.1",
+		"list.1.name",
+		"list.2",
+		"list.10",
+		"ports.9",
+		"ports.10",
+		"ports.010",
+		"tags.%",
+		"tags.b",
+	}
+
+	// Insert the keys in different orders, the result must be the same
+	for i := 0; i < len(expected); i++ {
+		d := &InstanceDiff{Attributes: make(map[string]*ResourceAttrDiff)}
+		for j := range expected {
+			k := expected[(i+j)%len(expected)]
+			d.Attributes[k] = &ResourceAttrDiff{New: k}
+		}
+
+		actual := d.SortedAttributeKeys()
+		if !reflect.DeepEqual(actual, expected) {
+			t.Fatalf("bad: %#v", actual)
+		}
+	}
+}
+
+func TestInstanceDiffGoString(t *testing.T) {
+	d := &InstanceDiff{
+		Attributes: map[string]*ResourceAttrDiff{
+			"list.10": &ResourceAttrDiff{New: "b"},
+			"list.2":  &ResourceAttrDiff{New: "a"},
+		},
+		Destroy: true,
+	}
+
+	expected := `*terraform.InstanceDiff{Attributes:map[string]*terraform.ResourceAttrDiff{` +
+		`"list.2":*terraform.ResourceAttrDiff{Old:"", New:"a", NewComputed:false, NewRemoved:false, NewExtra:interface {}(nil), RequiresNew:false, Sensitive:false, Type:0x0, Reasons:[]terraform.DiffReason(nil)}, ` +
+		`"list.10":*terraform.ResourceAttrDiff{Old:"", New:"b", NewComputed:false, NewRemoved:false, NewExtra:interface {}(nil), RequiresNew:false, Sensitive:false, Type:0x0, Reasons:[]terraform.DiffReason(nil)}}, ` +
+		`Destroy:true, DestroyDeposed:false, DestroyTainted:false}`
+	if actual := fmt.Sprintf("%#v", d); actual != expected {
+		t.Fatalf("bad:\n\n%s\n\nexpected:\n\n%s", actual, expected)
+	}
+}
+
+func TestInstanceDiffSame_extraOrder(t *testing.T) {
+	one := &InstanceDiff{
+		Attributes: map[string]*ResourceAttrDiff{
+			"foo": &ResourceAttrDiff{New: "bar"},
+		},
+	}
+
+	// The extra attributes are always reported in the same order
+	for i := 0; i < 10; i++ {
+		two := &InstanceDiff{
+			Attributes: map[string]*ResourceAttrDiff{
+				"foo":     &ResourceAttrDiff{New: "bar"},
+				"list.10": &ResourceAttrDiff{New: "c"},
+				"list.2":  &ResourceAttrDiff{New: "b"},
+				"a":       &ResourceAttrDiff{New: "a"},
+			},
+		}
+
+		same, reason := one.Same(two)
+		if same {
+			t.Fatal("should not be the same")
+		}
+		if reason != "extra attributes: a, list.2, list.10" {
+			t.Fatalf("bad: %s", reason)
+		}
+	}
+}
+
 func TestInstanceDiffSame(t *testing.T) {
 	cases := []struct {
 		One, Two *InstanceDiff
@@ -1,14 +1,21 @@
 package terraform
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/terraform/config"
 )
 
+// defaultApplyRetryBackoff is the delay before the first retry of a
+// retryable apply error when the resource doesn't configure a backoff.
+const defaultApplyRetryBackoff = 1 * time.Second
+
 // EvalApply is an EvalNode implementation that writes the diff to
 // the full diff.
 type EvalApply struct {
@@ -19,8 +26,25 @@ type EvalApply struct {
 	Output    **InstanceState
 	CreateNew *bool
 	Error     *error
+
+	// Resource is the configuration of the resource being applied. This
+	// is optional and is used to read lifecycle settings such as retries.
+	Resource *config.Resource
+
+	// Prior, if set, is set to a copy of the state before the apply if the
+	// resource is updated and preserves its prior state, and nil otherwise.
+	Prior **InstanceState
+
+	// PriorId, if set, is set to the ID the resource had before it was
+	// updated in place, and to an empty string otherwise. A provider can
+	// change the ID in an update, see EvalCheckApplyConsistency.
+	PriorId *string
 }
 
+// priorStateMaxSize is the maximum size, in bytes of attribute and meta
+// keys and values, of a state that's preserved as the prior state.
+const priorStateMaxSize = 64 * 1024
+
 // TODO: test
 func (n *EvalApply) Eval(ctx EvalContext) (interface{}, error) {
 	diff := *n.Diff
@@ -48,13 +72,60 @@ func (n *EvalApply) Eval(ctx EvalContext) (interface{}, error) {
 	state.init()
 
 	// Flag if we're creating a new instance
+	createNew := state.ID == "" && !diff.GetDestroy() || diff.RequiresNew()
 	if n.CreateNew != nil {
-		*n.CreateNew = state.ID == "" && !diff.GetDestroy() || diff.RequiresNew()
+		*n.CreateNew = createNew
+	}
+
+	// Make sure the batched state updates are persisted before anything
+	// is destroyed, so the persisted state never lists less than exists.
+	if diff.GetDestroy() || diff.RequiresNew() {
+		if err := ctx.FlushStateUpdates(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Keep the state before an update, so that it can be rolled back
+	if n.Prior != nil {
+		*n.Prior = n.priorState(state, diff, createNew)
+	}
+	priorId := state.ID
+
+	var err error
+	if id := n.importId(); id != "" && state.ID == "" && !diff.GetDestroy() {
+		// The resource is flagged for import, so the existing object is
+		// adopted instead of creating a new one. It isn't created, so it's
+		// not provisioned either.
+		log.Printf("[DEBUG] apply: %s: importing %q instead of creating", n.Info.Id, id)
+		createNew = false
+		if n.CreateNew != nil {
+			*n.CreateNew = false
+		}
+
+		state, err = n.importState(ctx, provider, id)
+	} else {
+		// With the completed diff, apply!
+		log.Printf("[DEBUG] apply: %s: executing Apply", n.Info.Id)
+		var elapsed time.Duration
+		var attempts int
+		state, elapsed, attempts, err = n.apply(ctx, provider, state, diff)
+		ctx.Hook(func(h Hook) (HookAction, error) {
+			h.ApplyElapsed(n.Info, elapsed, attempts)
+			return HookActionContinue, nil
+		})
+	}
+
+	// A create that returns no state and no error would silently drop
+	// the resource from the state, so it would be planned for creation
+	// again on every run. This is a bug in the provider.
+	if err == nil && createNew && !diff.GetDestroy() && (state == nil || state.ID == "") {
+		err = fmt.Errorf(
+			"Provider %q produced no state for %s after a create without "+
+				"reporting an error. This is a bug in the provider, please "+
+				"report it to the provider's maintainers.",
+			n.providerName(), n.Info.HumanId())
 	}
 
-	// With the completed diff, apply!
-	log.Printf("[DEBUG] apply: %s: executing Apply", n.Info.Id)
-	state, err := provider.Apply(n.Info, state, diff)
 	if state == nil {
 		state = new(InstanceState)
 	}
@@ -65,6 +136,21 @@ func (n *EvalApply) Eval(ctx EvalContext) (interface{}, error) {
 		state.Attributes["id"] = state.ID
 	}
 
+	// The state is written at the same address whatever the ID is, so a
+	// changed ID only replaces the old one there.
+	updated := !createNew && !diff.GetDestroy() && priorId != ""
+	if updated && state.ID != "" && state.ID != priorId {
+		log.Printf(
+			"[WARN] apply: %s: the provider changed the ID from %q to %q in an update",
+			n.Info.Id, priorId, state.ID)
+	}
+	if n.PriorId != nil {
+		*n.PriorId = ""
+		if updated {
+			*n.PriorId = priorId
+		}
+	}
+
 	// If the value is the unknown variable value, then it is an error.
 	// In this case we record the error and remove it from the state
 	for ak, av := range state.Attributes {
@@ -84,8 +170,7 @@ func (n *EvalApply) Eval(ctx EvalContext) (interface{}, error) {
 	// if we have one, otherwise we just output it.
 	if err != nil {
 		if n.Error != nil {
-			helpfulErr := fmt.Errorf("%s: %s", n.Info.Id, err.Error())
-			*n.Error = multierror.Append(*n.Error, helpfulErr)
+			*n.Error = multierror.Append(*n.Error, newResourceError(n.Info, err))
 		} else {
 			return nil, err
 		}
@@ -94,6 +179,262 @@ func (n *EvalApply) Eval(ctx EvalContext) (interface{}, error) {
 	return nil, nil
 }
 
+// priorState returns a copy of the state to preserve as the prior state
+// of the resource, or nil if there is none.
+func (n *EvalApply) priorState(
+	state *InstanceState, diff *InstanceDiff, createNew bool) *InstanceState {
+	if n.Resource == nil || !n.Resource.Lifecycle.PreservePriorState {
+		return nil
+	}
+
+	// Only an update has a prior state to go back to
+	if createNew || state.ID == "" || diff.GetDestroy() {
+		return nil
+	}
+
+	size := 0
+	for k, v := range state.Attributes {
+		size += len(k) + len(v)
+	}
+	for k, v := range state.Meta {
+		size += len(k) + len(v)
+	}
+	if size > priorStateMaxSize {
+		log.Printf(
+			"[WARN] apply: %s: state is too large to preserve (%d bytes), "+
+				"not keeping the prior state", n.Info.Id, size)
+		return nil
+	}
+
+	return state.DeepCopy()
+}
+
+// importId returns the ID to import the resource with instead of creating
+// it, if it has one.
+func (n *EvalApply) importId() string {
+	if n.Resource == nil {
+		return ""
+	}
+
+	return n.Resource.Lifecycle.ImportId
+}
+
+// importState imports the existing object with the given ID and refreshes
+// it, returning its state as it is. Only the state of the type of the
+// resource is kept; any other states the import returns aren't managed by
+// the configuration.
+func (n *EvalApply) importState(
+	ctx EvalContext, provider ResourceProvider, id string) (*InstanceState, error) {
+	err := ctx.Hook(func(h Hook) (HookAction, error) {
+		return h.PreImportState(n.Info, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	states, err := importStateWithID(provider, n.Info, id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ctx.Hook(func(h Hook) (HookAction, error) {
+		return h.PostImportState(n.Info, states)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var state *InstanceState
+	for _, s := range states {
+		if s == nil || s.Ephemeral.Type != n.Info.Type {
+			if s != nil {
+				log.Printf(
+					"[WARN] apply: %s: ignoring imported %s %q",
+					n.Info.Id, s.Ephemeral.Type, s.ID)
+			}
+			continue
+		}
+
+		if state != nil {
+			return nil, fmt.Errorf(
+				"import %s (id: %s): more than one %s was imported, "+
+					"so it can't be imported on apply",
+				n.Info.HumanId(), id, n.Info.Type)
+		}
+		state = s.DeepCopy()
+	}
+	if state == nil {
+		return nil, fmt.Errorf(
+			"import %s (id: %s): no %s was imported",
+			n.Info.HumanId(), id, n.Info.Type)
+	}
+
+	// The import may only set the ID, so read everything else
+	state, err = provider.Refresh(n.Info, state)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"import %s (id: %s): %s", n.Info.HumanId(), id, err)
+	}
+	if state.Empty() {
+		return nil, fmt.Errorf(
+			"import %s (id: %s): Terraform detected a resource with this ID doesn't\n"+
+				"exist. Please verify the ID is correct. You cannot import non-existent\n"+
+				"resources using Terraform import.",
+			n.Info.HumanId(), id)
+	}
+
+	return state, nil
+}
+
+// providerName returns the name of the provider that applies the resource.
+func (n *EvalApply) providerName() string {
+	var alias string
+	if n.Resource != nil {
+		alias = n.Resource.Provider
+	}
+
+	return resourceProvider(n.Info.Type, alias)
+}
+
+// apply calls Apply on the provider, retrying errors that the provider
+// reports as retryable up to the number of attempts configured in the
+// resource lifecycle. The delay between attempts doubles each time.
+//
+// If the lifecycle sets a timeout for the change, see timeout, each
+// attempt is limited to that long. An attempt that times out is not
+// retried and the prior state is returned marked as tainted.
+func (n *EvalApply) apply(
+	ctx EvalContext,
+	provider ResourceProvider,
+	state *InstanceState,
+	diff *InstanceDiff) (*InstanceState, time.Duration, int, error) {
+	var retries int
+	var backoff, timeout time.Duration
+	if n.Resource != nil {
+		retries = n.Resource.Lifecycle.RetryAttempts
+		backoff = n.Resource.Lifecycle.RetryBackoff
+		timeout = n.timeout(state, diff)
+	}
+	if backoff <= 0 {
+		backoff = defaultApplyRetryBackoff
+	}
+
+	// elapsed is the time spent in the provider, not counting backoffs
+	var elapsed time.Duration
+	for attempt := 0; ; attempt++ {
+		// Providers may modify the state and diff they're given, so if
+		// we may retry we give each attempt its own copy. This way a
+		// successful retry sees exactly what a first attempt would. An
+		// attempt that times out keeps running in the background, so it
+		// must never be given anything we hold on to either.
+		s, d := state, diff
+		if attempt < retries || timeout > 0 {
+			s, d = state.DeepCopy(), diff.DeepCopy()
+		}
+
+		start := time.Now()
+		newState, err := applyWithTimeout(provider, n.Info, s, d, timeout)
+		elapsed += time.Since(start)
+		if err == errApplyTimeout {
+			log.Printf(
+				"[ERROR] apply: %s: timed out after %s", n.Info.Id, timeout)
+
+			tainted := state.DeepCopy()
+			tainted.Tainted = true
+			return tainted, elapsed, attempt + 1, fmt.Errorf(
+				"apply exceeded timeout of %s", timeout)
+		}
+		if err == nil || attempt >= retries || !isRetryable(provider, err) {
+			return newState, elapsed, attempt + 1, err
+		}
+
+		log.Printf(
+			"[WARN] apply: %s: retryable error, retrying in %s (%d/%d): %s",
+			n.Info.Id, backoff, attempt+1, retries, err)
+
+		// Wait for the backoff, but stop retrying if we're interrupted
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Stopped():
+			log.Printf(
+				"[WARN] apply: %s: stop requested, not retrying", n.Info.Id)
+			return newState, elapsed, attempt + 1, err
+		}
+
+		backoff *= 2
+	}
+}
+
+// timeout returns how long a single apply of the diff may take. The
+// create, update and delete timeouts of the lifecycle override its
+// general timeout for that kind of change.
+//
+// A replacement is applied as a destroy followed by a create, so the
+// delete timeout limits the destroy and the create timeout the create.
+func (n *EvalApply) timeout(state *InstanceState, diff *InstanceDiff) time.Duration {
+	lifecycle := n.Resource.Lifecycle
+
+	var timeout time.Duration
+	switch {
+	case diff.GetDestroy():
+		timeout = lifecycle.DeleteTimeout
+	case state.ID == "" || diff.RequiresNew():
+		timeout = lifecycle.CreateTimeout
+	default:
+		timeout = lifecycle.UpdateTimeout
+	}
+	if timeout <= 0 {
+		timeout = lifecycle.Timeout
+	}
+
+	return timeout
+}
+
+// isRetryable returns true if the provider implements
+// ResourceProviderRetryClassifier and classifies err as retryable.
+func isRetryable(provider ResourceProvider, err error) bool {
+	c, ok := provider.(ResourceProviderRetryClassifier)
+	return ok && c.IsRetryable(err)
+}
+
+// errApplyTimeout is returned by applyWithTimeout if the timeout is reached.
+var errApplyTimeout = errors.New("apply timed out")
+
+// applyWithTimeout calls Apply on the provider and waits at most timeout
+// for it to return. A zero timeout waits forever. If the timeout is reached
+// errApplyTimeout is returned and the result of the call is discarded
+// whenever it eventually completes.
+func applyWithTimeout(
+	provider ResourceProvider,
+	info *InstanceInfo,
+	state *InstanceState,
+	diff *InstanceDiff,
+	timeout time.Duration) (*InstanceState, error) {
+	if timeout <= 0 {
+		return provider.Apply(info, state, diff)
+	}
+
+	type applyResult struct {
+		State *InstanceState
+		Err   error
+	}
+
+	// The channel is buffered so the goroutine can always complete even
+	// if nobody receives the result anymore.
+	resultCh := make(chan applyResult, 1)
+	go func() {
+		s, err := provider.Apply(info, state, diff)
+		resultCh <- applyResult{State: s, Err: err}
+	}()
+
+	select {
+	case r := <-resultCh:
+		return r.State, r.Err
+	case <-time.After(timeout):
+		return nil, errApplyTimeout
+	}
+}
+
 // EvalApplyPre is an EvalNode implementation that does the pre-Apply work
 type EvalApplyPre struct {
 	Info  *InstanceInfo
@@ -112,10 +453,15 @@ func (n *EvalApplyPre) Eval(ctx EvalContext) (interface{}, error) {
 	}
 	state.init()
 
+	// From here on the instance may change
+	if err := ctx.ApplyStarted(); err != nil {
+		return nil, err
+	}
+
 	{
 		// Call post-apply hook
 		err := ctx.Hook(func(h Hook) (HookAction, error) {
-			return h.PreApply(n.Info, state, diff)
+			return h.PreApply(n.Info, state, diff.redactSensitive())
 		})
 		if err != nil {
 			return nil, err
@@ -166,7 +512,6 @@ type EvalApplyProvisioners struct {
 	When config.ProvisionerWhen
 }
 
-// TODO: test
 func (n *EvalApplyProvisioners) Eval(ctx EvalContext) (interface{}, error) {
 	state := *n.State
 
@@ -193,6 +538,12 @@ func (n *EvalApplyProvisioners) Eval(ctx EvalContext) (interface{}, error) {
 		return nil, nil
 	}
 
+	if ctx.SkipProvisioners(n.When) {
+		log.Printf(
+			"[INFO] apply: %s: skipping %d provisioner(s)", n.Info.Id, len(provs))
+		return nil, nil
+	}
+
 	{
 		// Call pre hook
 		err := ctx.Hook(func(h Hook) (HookAction, error) {
@@ -212,7 +563,7 @@ func (n *EvalApplyProvisioners) Eval(ctx EvalContext) (interface{}, error) {
 		}
 
 		if n.Error != nil {
-			*n.Error = multierror.Append(*n.Error, err)
+			*n.Error = multierror.Append(*n.Error, newResourceError(n.Info, err))
 		} else {
 			return nil, err
 		}
@@ -262,98 +613,206 @@ func (n *EvalApplyProvisioners) apply(ctx EvalContext, provs []*config.Provision
 		state.Ephemeral.ConnInfo = origConnInfo
 	}()
 
-	for _, prov := range provs {
-		// Get the provisioner
-		provisioner := ctx.Provisioner(prov.Type)
+	if n.Resource.Lifecycle.ParallelProvisioners && len(provs) > 1 {
+		return n.applyParallel(ctx, state, origConnInfo, provs)
+	}
 
-		// Interpolate the provisioner config
-		provConfig, err := ctx.Interpolate(prov.RawConfig.Copy(), n.InterpResource)
-		if err != nil {
+	for _, prov := range provs {
+		if err := n.applyOne(ctx, state, origConnInfo, prov); err != nil {
 			return err
 		}
+	}
+
+	return nil
+}
+
+// applyParallel runs all the provisioners at the same time and returns
+// all of their errors. Each provisioner gets its own copy of the state so
+// that their connection info can't interfere with each other.
+func (n *EvalApplyProvisioners) applyParallel(
+	ctx EvalContext,
+	state *InstanceState,
+	origConnInfo map[string]string,
+	provs []*config.Provisioner) error {
+	var wg sync.WaitGroup
+	var l sync.Mutex
+	var errs error
+	for _, prov := range provs {
+		provState := state.DeepCopy()
+
+		wg.Add(1)
+		go func(prov *config.Provisioner) {
+			defer wg.Done()
+
+			if err := n.applyOne(ctx, provState, origConnInfo, prov); err != nil {
+				l.Lock()
+				defer l.Unlock()
+				errs = multierror.Append(errs, err)
+			}
+		}(prov)
+	}
+	wg.Wait()
+
+	return errs
+}
+
+// applyOne runs a single provisioner on the given state, which has its
+// connection info replaced with that of the provisioner.
+func (n *EvalApplyProvisioners) applyOne(
+	ctx EvalContext,
+	state *InstanceState,
+	origConnInfo map[string]string,
+	prov *config.Provisioner) error {
+	// Get the provisioner
+	provisioner := ctx.Provisioner(prov.Type)
+
+	// Self variables are read from the applied state, so that computed
+	// attributes have the values the provider produced.
+	resource := n.InterpResource
+	if resource != nil {
+		r := *resource
+		r.State = state
+		resource = &r
+	}
 
-		// Interpolate the conn info, since it may contain variables
-		connInfo, err := ctx.Interpolate(prov.ConnInfo.Copy(), n.InterpResource)
+	// Skip the provisioner if it has a condition that doesn't hold
+	if prov.Condition != nil {
+		ok, err := n.conditionHolds(ctx, resource, prov)
 		if err != nil {
 			return err
 		}
+		if !ok {
+			log.Printf(
+				"[INFO] %s: condition of provisioner %s is false, skipping it",
+				n.Info.Id, prov.Type)
+			return nil
+		}
+	}
+
+	// Interpolate the provisioner config
+	provConfig, err := ctx.Interpolate(prov.RawConfig.Copy(), resource)
+	if err != nil {
+		return err
+	}
 
-		// Merge the connection information
-		overlay := make(map[string]string)
-		if origConnInfo != nil {
-			for k, v := range origConnInfo {
-				overlay[k] = v
+	// Let the caller change the config before it's used
+	if fn := ctx.RewriteProvisionerConfig(); fn != nil {
+		provConfig, err = fn(n.Info, prov.Type, provConfig)
+		if err != nil {
+			if prov.OnFailure == config.ProvisionerOnFailureContinue {
+				log.Printf(
+					"[INFO] apply: %s [%s]: error rewriting config, continue requested: %s",
+					n.Info.Id, prov.Type, err)
+				return nil
 			}
+
+			return fmt.Errorf("provisioner %s: %s", prov.Type, err)
 		}
-		for k, v := range connInfo.Config {
-			switch vt := v.(type) {
-			case string:
-				overlay[k] = vt
-			case int64:
-				overlay[k] = strconv.FormatInt(vt, 10)
-			case int32:
-				overlay[k] = strconv.FormatInt(int64(vt), 10)
-			case int:
-				overlay[k] = strconv.FormatInt(int64(vt), 10)
-			case float32:
-				overlay[k] = strconv.FormatFloat(float64(vt), 'f', 3, 32)
-			case float64:
-				overlay[k] = strconv.FormatFloat(vt, 'f', 3, 64)
-			case bool:
-				overlay[k] = strconv.FormatBool(vt)
-			default:
-				overlay[k] = fmt.Sprintf("%v", vt)
-			}
+	}
+
+	// Interpolate the conn info, since it may contain variables
+	connInfo, err := ctx.Interpolate(prov.ConnInfo.Copy(), resource)
+	if err != nil {
+		return err
+	}
+
+	// Merge the connection information
+	overlay := make(map[string]string)
+	if origConnInfo != nil {
+		for k, v := range origConnInfo {
+			overlay[k] = v
 		}
-		state.Ephemeral.ConnInfo = overlay
-
-		{
-			// Call pre hook
-			err := ctx.Hook(func(h Hook) (HookAction, error) {
-				return h.PreProvision(n.Info, prov.Type)
-			})
-			if err != nil {
-				return err
-			}
+	}
+	for k, v := range connInfo.Config {
+		switch vt := v.(type) {
+		case string:
+			overlay[k] = vt
+		case int64:
+			overlay[k] = strconv.FormatInt(vt, 10)
+		case int32:
+			overlay[k] = strconv.FormatInt(int64(vt), 10)
+		case int:
+			overlay[k] = strconv.FormatInt(int64(vt), 10)
+		case float32:
+			overlay[k] = strconv.FormatFloat(float64(vt), 'f', 3, 32)
+		case float64:
+			overlay[k] = strconv.FormatFloat(vt, 'f', 3, 64)
+		case bool:
+			overlay[k] = strconv.FormatBool(vt)
+		default:
+			overlay[k] = fmt.Sprintf("%v", vt)
 		}
+	}
+	state.Ephemeral.ConnInfo = overlay
 
-		// The output function
-		outputFn := func(msg string) {
-			ctx.Hook(func(h Hook) (HookAction, error) {
-				h.ProvisionOutput(n.Info, prov.Type, msg)
-				return HookActionContinue, nil
-			})
+	{
+		// Call pre hook
+		err := ctx.Hook(func(h Hook) (HookAction, error) {
+			return h.PreProvision(n.Info, prov.Type)
+		})
+		if err != nil {
+			return err
 		}
+	}
 
-		// Invoke the Provisioner
-		output := CallbackUIOutput{OutputFn: outputFn}
-		applyErr := provisioner.Apply(&output, state, provConfig)
-
-		// Call post hook
-		hookErr := ctx.Hook(func(h Hook) (HookAction, error) {
-			return h.PostProvision(n.Info, prov.Type, applyErr)
+	// The output function
+	outputFn := func(msg string) {
+		ctx.Hook(func(h Hook) (HookAction, error) {
+			h.ProvisionOutput(n.Info, prov.Type, msg)
+			return HookActionContinue, nil
 		})
+	}
 
-		// Handle the error before we deal with the hook
-		if applyErr != nil {
-			// Determine failure behavior
-			switch prov.OnFailure {
-			case config.ProvisionerOnFailureContinue:
-				log.Printf(
-					"[INFO] apply: %s [%s]: error during provision, continue requested",
-					n.Info.Id, prov.Type)
-
-			case config.ProvisionerOnFailureFail:
-				return applyErr
-			}
+	// Invoke the Provisioner
+	output := CallbackUIOutput{OutputFn: outputFn}
+	applyErr := provisioner.Apply(&output, state, provConfig)
+
+	// Call post hook
+	hookErr := ctx.Hook(func(h Hook) (HookAction, error) {
+		return h.PostProvision(n.Info, prov.Type, applyErr)
+	})
+
+	// Handle the error before we deal with the hook
+	if applyErr != nil {
+		// Determine failure behavior
+		switch prov.OnFailure {
+		case config.ProvisionerOnFailureContinue:
+			log.Printf(
+				"[INFO] apply: %s [%s]: error during provision, continue requested",
+				n.Info.Id, prov.Type)
+
+		case config.ProvisionerOnFailureFail:
+			return applyErr
 		}
+	}
 
-		// Deal with the hook
-		if hookErr != nil {
-			return hookErr
-		}
+	// Deal with the hook
+	if hookErr != nil {
+		return hookErr
 	}
 
 	return nil
+}
+
+// conditionHolds interpolates the condition of prov against the applied
+// state of the resource and returns its value. Everything the condition can
+// reference has been applied by now, so it's an error if it's unknown.
+func (n *EvalApplyProvisioners) conditionHolds(
+	ctx EvalContext, resource *Resource, prov *config.Provisioner) (bool, error) {
+	rc, err := ctx.Interpolate(prov.Condition.Copy(), resource)
+	if err != nil {
+		return false, fmt.Errorf("provisioner %s condition: %s", prov.Type, err)
+	}
+
+	if rc.IsComputed("condition") {
+		return false, fmt.Errorf(
+			"provisioner %s condition: condition is unknown after apply", prov.Type)
+	}
+
+	ok, err := conditionValue(rc)
+	if err != nil {
+		return false, fmt.Errorf("provisioner %s condition: %s", prov.Type, err)
+	}
 
+	return ok, nil
 }
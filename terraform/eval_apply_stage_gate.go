@@ -0,0 +1,33 @@
+package terraform
+
+import (
+	"fmt"
+	"log"
+)
+
+// ApplyGateFunc is called by Apply for each stage of ContextOpts.ApplyStages
+// but the first, with the index of the stage, once all the stages before
+// it are applied. The stage is only applied once it returns nil. An error
+// fails the apply, and neither the stage nor the ones after it are
+// applied.
+type ApplyGateFunc func(stage int) error
+
+// EvalApplyStageGate is an EvalNode implementation that asks the gate of
+// the context whether the stage with the given index can be applied.
+type EvalApplyStageGate struct {
+	Stage int
+}
+
+func (n *EvalApplyStageGate) Eval(ctx EvalContext) (interface{}, error) {
+	gate := ctx.ApplyGate()
+	if gate == nil {
+		return nil, nil
+	}
+
+	log.Printf("[INFO] Waiting for the gate of apply stage %d", n.Stage)
+	if err := gate(n.Stage); err != nil {
+		return nil, fmt.Errorf("apply stage %d: %s", n.Stage, err)
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,731 @@
+package terraform
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/config"
+)
+
+// testFlakyApplyProvider returns a provider whose Apply fails with a
+// retryable error the given number of times before succeeding. The
+// returned counter is incremented on every call to Apply.
+func testFlakyApplyProvider(failures int) (*MockResourceProvider, *int) {
+	errFlaky := errors.New("flaky")
+
+	calls := 0
+	p := new(MockResourceProvider)
+	p.ApplyFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		d *InstanceDiff) (*InstanceState, error) {
+		calls++
+
+		// Simulate a provider that modifies its inputs before failing
+		s.Attributes["attempt"] = "dirty"
+
+		if calls <= failures {
+			return nil, errFlaky
+		}
+
+		result := &InstanceState{
+			ID:         "foo",
+			Attributes: make(map[string]string),
+		}
+		for k, v := range s.Attributes {
+			result.Attributes[k] = v
+		}
+		delete(result.Attributes, "attempt")
+		for k, ad := range d.Attributes {
+			result.Attributes[k] = ad.New
+		}
+
+		return result, nil
+	}
+	p.IsRetryableFn = func(err error) bool {
+		return err == errFlaky
+	}
+
+	return p, &calls
+}
+
+func testEvalApplyRetry(
+	ctx EvalContext,
+	p ResourceProvider,
+	lifecycle config.ResourceLifecycle) (*InstanceState, error) {
+	var provider ResourceProvider = p
+	state := &InstanceState{
+		ID: "foo",
+		Attributes: map[string]string{
+			"id":  "foo",
+			"ami": "bar",
+		},
+	}
+	diff := &InstanceDiff{
+		Attributes: map[string]*ResourceAttrDiff{
+			"ami": &ResourceAttrDiff{
+				Old: "bar",
+				New: "baz",
+			},
+		},
+	}
+
+	var output *InstanceState
+	node := &EvalApply{
+		Info:     &InstanceInfo{Id: "aws_instance.foo", Type: "aws_instance"},
+		State:    &state,
+		Diff:     &diff,
+		Provider: &provider,
+		Output:   &output,
+		Resource: &config.Resource{
+			Name:      "foo",
+			Type:      "aws_instance",
+			Lifecycle: lifecycle,
+		},
+	}
+
+	_, err := node.Eval(ctx)
+	return output, err
+}
+
+func TestEvalApply_retry(t *testing.T) {
+	lifecycle := config.ResourceLifecycle{
+		RetryAttempts: 3,
+		RetryBackoff:  time.Millisecond,
+	}
+
+	// Get the result of a first-try success for comparison
+	p, calls := testFlakyApplyProvider(0)
+	expected, err := testEvalApplyRetry(new(MockEvalContext), p, lifecycle)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if *calls != 1 {
+		t.Fatalf("expected 1 attempt, got %d", *calls)
+	}
+
+	p, calls = testFlakyApplyProvider(2)
+	actual, err := testEvalApplyRetry(new(MockEvalContext), p, lifecycle)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if *calls != 3 {
+		t.Fatalf("expected 3 attempts, got %d", *calls)
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad:\n\n%#v\n\n%#v", actual, expected)
+	}
+}
+
+func TestEvalApply_elapsedRetry(t *testing.T) {
+	lifecycle := config.ResourceLifecycle{
+		RetryAttempts: 3,
+		RetryBackoff:  time.Millisecond,
+	}
+
+	const delay = 10 * time.Millisecond
+	p, calls := testFlakyApplyProvider(2)
+	applyFn := p.ApplyFn
+	p.ApplyFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		d *InstanceDiff) (*InstanceState, error) {
+		time.Sleep(delay)
+		return applyFn(info, s, d)
+	}
+
+	h := new(MockHook)
+	ctx := &MockEvalContext{HookHook: h}
+	if _, err := testEvalApplyRetry(ctx, p, lifecycle); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if *calls != 3 {
+		t.Fatalf("expected 3 attempts, got %d", *calls)
+	}
+
+	// The time of all the attempts is reported together
+	if !h.ApplyElapsedCalled {
+		t.Fatal("ApplyElapsed should be called")
+	}
+	if h.ApplyElapsedInfo.Id != "aws_instance.foo" {
+		t.Fatalf("bad info: %#v", h.ApplyElapsedInfo)
+	}
+	if h.ApplyElapsedAttempts != 3 {
+		t.Fatalf("bad attempts: %d", h.ApplyElapsedAttempts)
+	}
+	if h.ApplyElapsedDuration < 3*delay {
+		t.Fatalf("bad duration: %s", h.ApplyElapsedDuration)
+	}
+}
+
+func TestEvalApply_retryExhausted(t *testing.T) {
+	lifecycle := config.ResourceLifecycle{
+		RetryAttempts: 2,
+		RetryBackoff:  time.Millisecond,
+	}
+
+	p, calls := testFlakyApplyProvider(5)
+	_, err := testEvalApplyRetry(new(MockEvalContext), p, lifecycle)
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if *calls != 3 {
+		t.Fatalf("expected 3 attempts, got %d", *calls)
+	}
+}
+
+func TestEvalApply_retryNotRetryable(t *testing.T) {
+	lifecycle := config.ResourceLifecycle{
+		RetryAttempts: 3,
+		RetryBackoff:  time.Millisecond,
+	}
+
+	p, calls := testFlakyApplyProvider(1)
+	p.IsRetryableFn = nil
+	_, err := testEvalApplyRetry(new(MockEvalContext), p, lifecycle)
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if *calls != 1 {
+		t.Fatalf("expected 1 attempt, got %d", *calls)
+	}
+	if !p.IsRetryableCalled {
+		t.Fatal("IsRetryable should be called")
+	}
+}
+
+func TestEvalApply_retryNotClassifier(t *testing.T) {
+	lifecycle := config.ResourceLifecycle{
+		RetryAttempts: 3,
+		RetryBackoff:  time.Millisecond,
+	}
+
+	// Hide IsRetryable, providers that don't implement it never retry
+	p, calls := testFlakyApplyProvider(1)
+	provider := struct{ ResourceProvider }{p}
+	_, err := testEvalApplyRetry(new(MockEvalContext), provider, lifecycle)
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if *calls != 1 {
+		t.Fatalf("expected 1 attempt, got %d", *calls)
+	}
+	if p.IsRetryableCalled {
+		t.Fatal("IsRetryable should not be called")
+	}
+}
+
+func TestEvalApply_retryDisabled(t *testing.T) {
+	p, calls := testFlakyApplyProvider(1)
+	_, err := testEvalApplyRetry(
+		new(MockEvalContext), p, config.ResourceLifecycle{})
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if *calls != 1 {
+		t.Fatalf("expected 1 attempt, got %d", *calls)
+	}
+	if p.IsRetryableCalled {
+		t.Fatal("IsRetryable should not be called")
+	}
+}
+
+func TestEvalApply_retryStopped(t *testing.T) {
+	lifecycle := config.ResourceLifecycle{
+		RetryAttempts: 3,
+		RetryBackoff:  time.Hour,
+	}
+
+	stopCh := make(chan struct{})
+	close(stopCh)
+	ctx := &MockEvalContext{StoppedValue: stopCh}
+
+	p, calls := testFlakyApplyProvider(1)
+	_, err := testEvalApplyRetry(ctx, p, lifecycle)
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if *calls != 1 {
+		t.Fatalf("expected 1 attempt, got %d", *calls)
+	}
+}
+
+func TestEvalApply_timeout(t *testing.T) {
+	releaseCh := make(chan struct{})
+	doneCh := make(chan struct{})
+
+	p := new(MockResourceProvider)
+	p.ApplyFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		d *InstanceDiff) (*InstanceState, error) {
+		defer close(doneCh)
+
+		// Block longer than the timeout, then write to what we were given
+		<-releaseCh
+		s.Attributes["ami"] = "late"
+		return s, nil
+	}
+
+	lifecycle := config.ResourceLifecycle{
+		Timeout: 10 * time.Millisecond,
+	}
+	output, err := testEvalApplyRetry(new(MockEvalContext), p, lifecycle)
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), "exceeded timeout of 10ms") {
+		t.Fatalf("bad: %s", err)
+	}
+
+	if output == nil || !output.Tainted {
+		t.Fatalf("should be tainted: %#v", output)
+	}
+	if output.Attributes["ami"] != "bar" {
+		t.Fatalf("bad: %#v", output.Attributes)
+	}
+
+	// Let the provider return late and make sure it can't touch our state
+	close(releaseCh)
+	<-doneCh
+	if output.Attributes["ami"] != "bar" {
+		t.Fatalf("late apply modified state: %#v", output.Attributes)
+	}
+}
+
+func TestEvalApply_timeoutNotReached(t *testing.T) {
+	p, calls := testFlakyApplyProvider(0)
+	lifecycle := config.ResourceLifecycle{
+		Timeout: time.Minute,
+	}
+	output, err := testEvalApplyRetry(new(MockEvalContext), p, lifecycle)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if *calls != 1 {
+		t.Fatalf("expected 1 attempt, got %d", *calls)
+	}
+	if output.Tainted {
+		t.Fatal("should not be tainted")
+	}
+	if output.Attributes["ami"] != "baz" {
+		t.Fatalf("bad: %#v", output.Attributes)
+	}
+}
+
+func TestEvalApplyTimeout(t *testing.T) {
+	lifecycle := config.ResourceLifecycle{
+		Timeout:       time.Minute,
+		CreateTimeout: 2 * time.Minute,
+		UpdateTimeout: 3 * time.Minute,
+		DeleteTimeout: 4 * time.Minute,
+	}
+
+	update := &InstanceDiff{
+		Attributes: map[string]*ResourceAttrDiff{
+			"ami": &ResourceAttrDiff{Old: "bar", New: "baz"},
+		},
+	}
+	replace := &InstanceDiff{
+		Attributes: map[string]*ResourceAttrDiff{
+			"ami": &ResourceAttrDiff{Old: "bar", New: "baz", RequiresNew: true},
+		},
+	}
+	destroy := &InstanceDiff{Destroy: true}
+
+	cases := map[string]struct {
+		Lifecycle config.ResourceLifecycle
+		State     *InstanceState
+		Diff      *InstanceDiff
+		Expected  time.Duration
+	}{
+		"create": {
+			lifecycle, &InstanceState{}, update, 2 * time.Minute,
+		},
+		"update": {
+			lifecycle, &InstanceState{ID: "foo"}, update, 3 * time.Minute,
+		},
+		"destroy": {
+			lifecycle, &InstanceState{ID: "foo"}, destroy, 4 * time.Minute,
+		},
+		"create of a replacement": {
+			lifecycle, &InstanceState{ID: "foo"}, replace, 2 * time.Minute,
+		},
+		"general timeout": {
+			config.ResourceLifecycle{
+				Timeout:       time.Minute,
+				DeleteTimeout: 4 * time.Minute,
+			},
+			&InstanceState{ID: "foo"}, update, time.Minute,
+		},
+		"no timeout": {
+			config.ResourceLifecycle{},
+			&InstanceState{ID: "foo"}, destroy, 0,
+		},
+	}
+
+	for k, tc := range cases {
+		node := &EvalApply{
+			Resource: &config.Resource{Lifecycle: tc.Lifecycle},
+		}
+
+		if actual := node.timeout(tc.State, tc.Diff); actual != tc.Expected {
+			t.Fatalf("%s: expected %s, got %s", k, tc.Expected, actual)
+		}
+	}
+}
+
+func TestEvalApplyPriorState(t *testing.T) {
+	preserve := config.ResourceLifecycle{PreservePriorState: true}
+
+	state := &InstanceState{
+		ID:         "foo",
+		Attributes: map[string]string{"id": "foo", "ami": "bar"},
+	}
+	large := &InstanceState{
+		ID:         "foo",
+		Attributes: map[string]string{"data": strings.Repeat("x", priorStateMaxSize)},
+	}
+	update := &InstanceDiff{
+		Attributes: map[string]*ResourceAttrDiff{
+			"ami": &ResourceAttrDiff{Old: "bar", New: "baz"},
+		},
+	}
+	destroy := &InstanceDiff{Destroy: true}
+
+	cases := map[string]struct {
+		Lifecycle config.ResourceLifecycle
+		State     *InstanceState
+		Diff      *InstanceDiff
+		CreateNew bool
+		Expected  *InstanceState
+	}{
+		"update": {
+			preserve, state, update, false, state,
+		},
+		"create": {
+			preserve, &InstanceState{}, update, true, nil,
+		},
+		"replace": {
+			preserve, state, update, true, nil,
+		},
+		"destroy": {
+			preserve, state, destroy, false, nil,
+		},
+		"not preserved": {
+			config.ResourceLifecycle{}, state, update, false, nil,
+		},
+		"too large": {
+			preserve, large, update, false, nil,
+		},
+	}
+
+	for k, tc := range cases {
+		node := &EvalApply{
+			Info:     &InstanceInfo{Id: "aws_instance.foo"},
+			Resource: &config.Resource{Lifecycle: tc.Lifecycle},
+		}
+
+		actual := node.priorState(tc.State, tc.Diff, tc.CreateNew)
+		if !actual.Equal(tc.Expected) {
+			t.Fatalf("%s: bad: %#v", k, actual)
+		}
+		if actual != nil && actual == tc.State {
+			t.Fatalf("%s: should be a copy", k)
+		}
+	}
+}
+
+func TestEvalApply_updateTimeout(t *testing.T) {
+	releaseCh := make(chan struct{})
+	defer close(releaseCh)
+
+	p := new(MockResourceProvider)
+	p.ApplyFn = func(
+		info *InstanceInfo,
+		s *InstanceState,
+		d *InstanceDiff) (*InstanceState, error) {
+		<-releaseCh
+		return s, nil
+	}
+
+	// The update timeout is reached long before the general timeout
+	lifecycle := config.ResourceLifecycle{
+		Timeout:       time.Minute,
+		CreateTimeout: time.Minute,
+		UpdateTimeout: 10 * time.Millisecond,
+	}
+	output, err := testEvalApplyRetry(new(MockEvalContext), p, lifecycle)
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), "exceeded timeout of 10ms") {
+		t.Fatalf("bad: %s", err)
+	}
+	if output == nil || !output.Tainted {
+		t.Fatalf("should be tainted: %#v", output)
+	}
+}
+
+func TestEvalApply_flushStateUpdates(t *testing.T) {
+	cases := map[string]struct {
+		Diff     *InstanceDiff
+		Expected bool
+	}{
+		"create": {
+			&InstanceDiff{
+				Attributes: map[string]*ResourceAttrDiff{
+					"ami": &ResourceAttrDiff{New: "bar"},
+				},
+			},
+			false,
+		},
+
+		"replace": {
+			&InstanceDiff{
+				Attributes: map[string]*ResourceAttrDiff{
+					"ami": &ResourceAttrDiff{
+						Old:         "foo",
+						New:         "bar",
+						RequiresNew: true,
+					},
+				},
+			},
+			true,
+		},
+
+		"destroy": {
+			&InstanceDiff{Destroy: true},
+			true,
+		},
+	}
+
+	for k, tc := range cases {
+		ctx := new(MockEvalContext)
+		p := testProvider("aws")
+		p.ApplyReturn = &InstanceState{ID: "foo"}
+
+		var provider ResourceProvider = p
+		state := &InstanceState{ID: "foo"}
+		diff := tc.Diff
+		var output *InstanceState
+		node := &EvalApply{
+			Info:     &InstanceInfo{Id: "aws_instance.foo", Type: "aws_instance"},
+			State:    &state,
+			Diff:     &diff,
+			Provider: &provider,
+			Output:   &output,
+		}
+		if _, err := node.Eval(ctx); err != nil {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+
+		if ctx.FlushStateUpdatesCalled != tc.Expected {
+			t.Fatalf("%s: expected flush %t", k, tc.Expected)
+		}
+	}
+}
+
+func TestEvalApply_createNilState(t *testing.T) {
+	p := new(MockResourceProvider)
+	var provider ResourceProvider = p
+
+	var state *InstanceState
+	diff := &InstanceDiff{
+		Attributes: map[string]*ResourceAttrDiff{
+			"ami": &ResourceAttrDiff{
+				Old:         "",
+				New:         "bar",
+				RequiresNew: true,
+			},
+		},
+	}
+
+	var output *InstanceState
+	node := &EvalApply{
+		Info:     &InstanceInfo{Id: "aws_instance.foo", Type: "aws_instance"},
+		State:    &state,
+		Diff:     &diff,
+		Provider: &provider,
+		Output:   &output,
+		Resource: &config.Resource{
+			Name:     "foo",
+			Type:     "aws_instance",
+			Provider: "aws.west",
+		},
+	}
+
+	_, err := node.Eval(new(MockEvalContext))
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), `Provider "aws.west" produced no state for aws_instance.foo`) {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestEvalApply_destroyNilState(t *testing.T) {
+	p := new(MockResourceProvider)
+	var provider ResourceProvider = p
+
+	state := &InstanceState{
+		ID:         "foo",
+		Attributes: map[string]string{"id": "foo"},
+	}
+	diff := &InstanceDiff{Destroy: true}
+
+	var output *InstanceState
+	node := &EvalApply{
+		Info:     &InstanceInfo{Id: "aws_instance.foo", Type: "aws_instance"},
+		State:    &state,
+		Diff:     &diff,
+		Provider: &provider,
+		Output:   &output,
+	}
+
+	if _, err := node.Eval(new(MockEvalContext)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !p.ApplyCalled {
+		t.Fatal("apply should be called")
+	}
+	if output == nil || output.ID != "" {
+		t.Fatalf("bad: %#v", output)
+	}
+}
+
+func testEvalApplyProvisioners(
+	t *testing.T, onFailure config.ProvisionerOnFailure) *EvalApplyProvisioners {
+	rc, err := config.NewRawConfig(map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	state := &InstanceState{
+		ID:         "foo",
+		Attributes: map[string]string{"id": "foo"},
+	}
+
+	createNew := true
+	var applyErr error
+	return &EvalApplyProvisioners{
+		Info:  &InstanceInfo{Id: "aws_instance.foo", Type: "aws_instance"},
+		State: &state,
+		Resource: &config.Resource{
+			Name: "foo",
+			Type: "aws_instance",
+			Provisioners: []*config.Provisioner{
+				&config.Provisioner{
+					Type:      "shell",
+					RawConfig: rc,
+					ConnInfo:  rc,
+					When:      config.ProvisionerWhenCreate,
+					OnFailure: onFailure,
+				},
+			},
+		},
+		InterpResource: &Resource{Name: "foo", Type: "aws_instance"},
+		CreateNew:      &createNew,
+		Error:          &applyErr,
+		When:           config.ProvisionerWhenCreate,
+	}
+}
+
+func testEvalApplyProvisionersContext() *MockEvalContext {
+	pr := testProvisioner()
+	pr.ApplyFn = func(*InstanceState, *ResourceConfig) error {
+		return errors.New("EXPLOSION")
+	}
+
+	return &MockEvalContext{
+		ProvisionerProvisioner:  pr,
+		InterpolateConfigResult: &ResourceConfig{},
+	}
+}
+
+func TestEvalApplyProvisioners_failTaints(t *testing.T) {
+	node := testEvalApplyProvisioners(t, config.ProvisionerOnFailureFail)
+	if _, err := node.Eval(testEvalApplyProvisionersContext()); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if *node.Error == nil {
+		t.Fatal("should have recorded the provisioner error")
+	}
+
+	state := *node.State
+	if state == nil || state.ID != "foo" {
+		t.Fatalf("created resource should be kept: %#v", state)
+	}
+	if !state.Tainted {
+		t.Fatal("should be tainted")
+	}
+}
+
+func TestEvalApplyProvisioners_failContinue(t *testing.T) {
+	node := testEvalApplyProvisioners(t, config.ProvisionerOnFailureContinue)
+	if _, err := node.Eval(testEvalApplyProvisionersContext()); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if *node.Error != nil {
+		t.Fatalf("err: %s", *node.Error)
+	}
+	if (*node.State).Tainted {
+		t.Fatal("should not be tainted")
+	}
+}
+
+func TestEvalApplyProvisioners_applyErrorTaints(t *testing.T) {
+	node := testEvalApplyProvisioners(t, config.ProvisionerOnFailureFail)
+	*node.Error = errors.New("apply failed")
+
+	ctx := testEvalApplyProvisionersContext()
+	if _, err := node.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if ctx.ProvisionerCalled {
+		t.Fatal("provisioners should not run after a failed apply")
+	}
+	if !(*node.State).Tainted {
+		t.Fatal("should be tainted")
+	}
+}
+
+func TestEvalApplyProvisioners_skip(t *testing.T) {
+	cases := map[string]struct {
+		When config.ProvisionerWhen
+	}{
+		"create":  {config.ProvisionerWhenCreate},
+		"destroy": {config.ProvisionerWhenDestroy},
+	}
+
+	for k, tc := range cases {
+		node := testEvalApplyProvisioners(t, config.ProvisionerOnFailureFail)
+		node.Resource.Provisioners[0].When = tc.When
+		node.When = tc.When
+
+		ctx := testEvalApplyProvisionersContext()
+		ctx.SkipProvisionersValue = true
+		if _, err := node.Eval(ctx); err != nil {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+
+		if ctx.SkipProvisionersWhen != tc.When {
+			t.Fatalf("%s: bad: %s", k, ctx.SkipProvisionersWhen)
+		}
+		if ctx.ProvisionerCalled {
+			t.Fatalf("%s: provisioners should be skipped", k)
+		}
+		if *node.Error != nil {
+			t.Fatalf("%s: err: %s", k, *node.Error)
+		}
+		if (*node.State).Tainted {
+			t.Fatalf("%s: should not be tainted", k)
+		}
+	}
+}
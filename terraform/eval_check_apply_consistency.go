@@ -0,0 +1,97 @@
+package terraform
+
+import (
+	"fmt"
+	"sort"
+)
+
+// EvalCheckApplyConsistency is an EvalNode implementation that compares
+// the state produced by an apply with the diff that was applied. Any
+// known attribute value in the diff that the provider didn't produce is
+// returned as a warning, since it means the next plan will show a change
+// for that attribute. Computed attributes are not checked.
+//
+// If PriorId is set to the ID of a resource that was updated in place, an
+// ID the provider changed without planning the "id" as computed is also
+// returned as a warning.
+type EvalCheckApplyConsistency struct {
+	Info    *InstanceInfo
+	Diff    **InstanceDiff
+	State   **InstanceState
+	PriorId *string
+}
+
+func (n *EvalCheckApplyConsistency) Eval(ctx EvalContext) (interface{}, error) {
+	if n.Diff == nil || *n.Diff == nil || n.State == nil || *n.State == nil {
+		return nil, nil
+	}
+
+	diff := *n.Diff
+	state := *n.State
+
+	// A destroy doesn't produce any attributes to compare
+	if diff.GetDestroy() && !diff.RequiresNew() {
+		return nil, nil
+	}
+
+	attrs := diff.CopyAttributes()
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var warns []string
+	if n.PriorId != nil && *n.PriorId != "" && state.ID != *n.PriorId {
+		if ad, ok := attrs["id"]; !ok || !ad.NewComputed {
+			warns = append(warns, fmt.Sprintf(
+				"the ID changed from %q to %q in an update that didn't plan "+
+					"a new ID", *n.PriorId, state.ID))
+		}
+	}
+	for _, k := range keys {
+		ad := attrs[k]
+		if ad.NewComputed || ad.Type == DiffAttrOutput {
+			continue
+		}
+
+		actual, ok := state.Attributes[k]
+		if ad.NewRemoved {
+			if ok {
+				warns = append(warns, fmt.Sprintf(
+					"%q was planned to be removed, but the provider kept it",
+					k))
+			}
+
+			continue
+		}
+
+		if actual == ad.New {
+			continue
+		}
+
+		if ad.Sensitive {
+			warns = append(warns, fmt.Sprintf(
+				"%q was planned to be %s, but the provider produced %s",
+				k, sensitiveRedacted, sensitiveRedacted))
+			continue
+		}
+
+		warns = append(warns, fmt.Sprintf(
+			"%q was planned to be %q, but the provider produced %q",
+			k, ad.New, actual))
+	}
+
+	if len(warns) == 0 {
+		return nil, nil
+	}
+
+	for i, w := range warns {
+		warns[i] = fmt.Sprintf(
+			"applied state doesn't match the plan: %s. This is a bug in "+
+				"the provider, please report it to the provider's maintainers.",
+			w)
+	}
+
+	return nil, &EvalValidateError{Warnings: warns}
+}
@@ -0,0 +1,23 @@
+package terraform
+
+import (
+	"log"
+)
+
+// EvalCheckInterrupted is an EvalNode implementation that exits early if
+// the walk was interrupted, so that no new work is started. Work that has
+// already started when the interrupt happens isn't affected by this, and
+// is allowed to finish and record its state.
+type EvalCheckInterrupted struct {
+	Info *InstanceInfo
+}
+
+func (n *EvalCheckInterrupted) Eval(ctx EvalContext) (interface{}, error) {
+	select {
+	case <-ctx.Interrupted():
+		log.Printf("[WARN] %s: interrupted, not starting", n.Info.Id)
+		return nil, EvalEarlyExitError{}
+	default:
+		return nil, nil
+	}
+}
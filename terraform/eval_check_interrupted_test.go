@@ -0,0 +1,24 @@
+package terraform
+
+import (
+	"testing"
+)
+
+func TestEvalCheckInterrupted(t *testing.T) {
+	n := &EvalCheckInterrupted{Info: &InstanceInfo{Id: "foo"}}
+
+	ctx := new(MockEvalContext)
+	if _, err := n.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !ctx.InterruptedCalled {
+		t.Fatal("should call Interrupted")
+	}
+
+	ch := make(chan struct{})
+	close(ch)
+	ctx.InterruptedValue = ch
+	if _, err := n.Eval(ctx); err != (EvalEarlyExitError{}) {
+		t.Fatalf("should exit early, got: %#v", err)
+	}
+}
@@ -0,0 +1,47 @@
+package terraform
+
+import (
+	"fmt"
+)
+
+// ManagedBy configures a guard against resources that are managed by more
+// than one configuration, whose applies would fight each other. Resources
+// record the configuration managing them in an attribute, such as a tag
+// set from the configuration. When the attribute is set in the refreshed
+// state of a resource to another name, the plan warns about it.
+type ManagedBy struct {
+	// Attribute is the flatmapped attribute that holds the name of the
+	// configuration managing a resource, such as "tags.managed_by".
+	Attribute string
+
+	// Name is the name of the current configuration.
+	Name string
+}
+
+// EvalCheckManagedBy is an EvalNode implementation that warns if the state
+// of a resource says it's managed by another configuration, see ManagedBy.
+// The warning is added to the plan. Resources whose state doesn't have the
+// attribute aren't checked.
+type EvalCheckManagedBy struct {
+	Addr  *ResourceAddress
+	State **InstanceState
+}
+
+func (n *EvalCheckManagedBy) Eval(ctx EvalContext) (interface{}, error) {
+	mb := ctx.ManagedBy()
+	if mb == nil || n.State == nil || *n.State == nil {
+		return nil, nil
+	}
+
+	v := (*n.State).Attributes[mb.Attribute]
+	if v == "" || v == mb.Name {
+		return nil, nil
+	}
+
+	ctx.ResourceWarnings(n.Addr, []string{fmt.Sprintf(
+		"%s is %q instead of %q, so the resource is also managed by "+
+			"another configuration. Applying both configurations changes "+
+			"it back and forth.",
+		mb.Attribute, v, mb.Name)})
+	return nil, nil
+}
@@ -0,0 +1,89 @@
+package terraform
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/config"
+)
+
+func TestEvalCheckManagedBy_impl(t *testing.T) {
+	var _ EvalNode = new(EvalCheckManagedBy)
+}
+
+func TestEvalCheckManagedBy(t *testing.T) {
+	mb := &ManagedBy{Attribute: "tags.managed_by", Name: "prod"}
+	cases := map[string]struct {
+		ManagedBy *ManagedBy
+		State     *InstanceState
+		Warn      bool
+	}{
+		"not checked": {
+			nil,
+			&InstanceState{
+				ID:         "foo",
+				Attributes: map[string]string{"tags.managed_by": "staging"},
+			},
+			false,
+		},
+
+		"no state": {
+			mb,
+			nil,
+			false,
+		},
+
+		"no attribute": {
+			mb,
+			&InstanceState{ID: "foo"},
+			false,
+		},
+
+		"same": {
+			mb,
+			&InstanceState{
+				ID:         "foo",
+				Attributes: map[string]string{"tags.managed_by": "prod"},
+			},
+			false,
+		},
+
+		"mismatch": {
+			mb,
+			&InstanceState{
+				ID:         "foo",
+				Attributes: map[string]string{"tags.managed_by": "staging"},
+			},
+			true,
+		},
+	}
+
+	addr := &ResourceAddress{
+		Mode:  config.ManagedResourceMode,
+		Type:  "aws_instance",
+		Name:  "foo",
+		Index: -1,
+	}
+	for k, tc := range cases {
+		ctx := &MockEvalContext{ManagedByValue: tc.ManagedBy}
+		n := &EvalCheckManagedBy{Addr: addr, State: &tc.State}
+		if _, err := n.Eval(ctx); err != nil {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+
+		if ctx.ResourceWarningsCalled != tc.Warn {
+			t.Fatalf("%s: bad: %#v", k, ctx.ResourceWarningsWarnings)
+		}
+		if !tc.Warn {
+			continue
+		}
+
+		if ctx.ResourceWarningsAddr != addr {
+			t.Fatalf("%s: bad: %s", k, ctx.ResourceWarningsAddr)
+		}
+		if len(ctx.ResourceWarningsWarnings) != 1 ||
+			!strings.Contains(ctx.ResourceWarningsWarnings[0], `"staging" instead of "prod"`) {
+			t.Fatalf("%s: bad: %#v", k, ctx.ResourceWarningsWarnings)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package terraform
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/terraform/config"
+)
+
+// EvalCheckPreconditions is an EvalNode implementation that checks the
+// lifecycle preconditions of a resource before it's diffed, and returns an
+// error if any of them doesn't hold.
+//
+// A precondition that depends on values that aren't known yet, such as
+// the computed attributes of a resource that isn't created yet, is
+// skipped. The preconditions are checked again before the resource is
+// applied, when those values are known.
+type EvalCheckPreconditions struct {
+	Info           *InstanceInfo
+	Resource       *config.Resource
+	InterpResource *Resource
+}
+
+func (n *EvalCheckPreconditions) Eval(ctx EvalContext) (interface{}, error) {
+	var errs error
+	for i, c := range n.Resource.Lifecycle.Preconditions {
+		known, err := evalResourceCondition(ctx, n.InterpResource, c)
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf(
+				"%s: precondition #%d: %s", n.Info.Id, i+1, err))
+			continue
+		}
+
+		if !known {
+			log.Printf(
+				"[DEBUG] %s: precondition #%d depends on unknown values, skipping it",
+				n.Info.Id, i+1)
+		}
+	}
+
+	return nil, errs
+}
+
+// EvalCheckPostconditions is an EvalNode implementation that checks the
+// lifecycle postconditions of a resource against its applied state.
+//
+// A postcondition that doesn't hold fails the apply of the resource the
+// same as a failing provisioner does: the error is recorded in Error and
+// the resource is tainted so that the next apply replaces it.
+type EvalCheckPostconditions struct {
+	Info           *InstanceInfo
+	Resource       *config.Resource
+	InterpResource *Resource
+	State          **InstanceState
+	Error          *error
+}
+
+func (n *EvalCheckPostconditions) Eval(ctx EvalContext) (interface{}, error) {
+	state := *n.State
+	if len(n.Resource.Lifecycle.Postconditions) == 0 || state == nil || state.ID == "" {
+		return nil, nil
+	}
+
+	// If the apply or a provisioner failed, the resource is already
+	// tainted and its state may be incomplete.
+	if n.Error != nil && *n.Error != nil {
+		return nil, nil
+	}
+
+	// Self variables are read from the applied state
+	var resource *Resource
+	if n.InterpResource != nil {
+		r := *n.InterpResource
+		r.State = state
+		resource = &r
+	}
+
+	var errs error
+	for i, c := range n.Resource.Lifecycle.Postconditions {
+		known, err := evalResourceCondition(ctx, resource, c)
+
+		// Everything the condition can reference has been applied by
+		// now, so an unknown value can't become known later.
+		if err == nil && !known {
+			err = fmt.Errorf("condition is unknown after apply")
+		}
+
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("postcondition #%d: %s", i+1, err))
+		}
+	}
+	if errs == nil {
+		return nil, nil
+	}
+
+	state.Tainted = true
+	if n.Error != nil {
+		*n.Error = multierror.Append(*n.Error, newResourceError(n.Info, errs))
+		return nil, nil
+	}
+
+	return nil, errs
+}
+
+// evalResourceCondition interpolates the condition c and returns an error
+// if it doesn't hold. The returned bool is false, and the condition isn't
+// checked, if it depends on values that aren't known yet.
+func evalResourceCondition(
+	ctx EvalContext, resource *Resource, c *config.ResourceCondition) (bool, error) {
+	rc, err := ctx.Interpolate(c.RawConfig.Copy(), resource)
+	if err != nil {
+		return true, err
+	}
+
+	if rc.IsComputed("condition") {
+		return false, nil
+	}
+
+	ok, err := conditionValue(rc)
+	if err != nil {
+		return true, err
+	}
+	if ok {
+		return true, nil
+	}
+
+	if msg, ok := rc.Config["error_message"].(string); ok && msg != "" {
+		return true, fmt.Errorf("failed: %s", msg)
+	}
+
+	return true, fmt.Errorf("failed: %s", c.RawConfig.Raw["condition"])
+}
+
+// conditionValue returns the value of the interpolated "condition" in rc,
+// which must be true or false.
+func conditionValue(rc *ResourceConfig) (bool, error) {
+	switch v := rc.Config["condition"].(type) {
+	case bool:
+		return v, nil
+	case string:
+		ok, err := strconv.ParseBool(v)
+		if err != nil {
+			return false, fmt.Errorf("condition must be true or false, got %q", v)
+		}
+
+		return ok, nil
+	default:
+		return false, fmt.Errorf("condition must be true or false, got %#v", v)
+	}
+}
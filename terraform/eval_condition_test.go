@@ -0,0 +1,182 @@
+package terraform
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/config"
+)
+
+func TestEvalCheckPostconditions(t *testing.T) {
+	cases := map[string]struct {
+		Condition interface{}
+		Message   string
+		Err       string
+	}{
+		"true": {
+			Condition: "true",
+		},
+
+		"bool": {
+			Condition: true,
+		},
+
+		"false": {
+			Condition: "false",
+			Err:       "postcondition #1: failed: ${self.foo}",
+		},
+
+		"false with a message": {
+			Condition: "false",
+			Message:   "foo is wrong",
+			Err:       "postcondition #1: failed: foo is wrong",
+		},
+
+		"not a boolean": {
+			Condition: "yes please",
+			Err:       `condition must be true or false, got "yes please"`,
+		},
+
+		"unknown": {
+			Condition: config.UnknownVariableValue,
+			Err:       "condition is unknown after apply",
+		},
+	}
+
+	for k, tc := range cases {
+		rc, err := config.NewRawConfig(map[string]interface{}{
+			"condition": "${self.foo}",
+		})
+		if err != nil {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+
+		result := map[string]interface{}{"condition": tc.Condition}
+		if tc.Message != "" {
+			result["error_message"] = tc.Message
+		}
+
+		state := &InstanceState{ID: "foo"}
+		var applyErr error
+		n := &EvalCheckPostconditions{
+			Info: &InstanceInfo{Id: "aws_instance.foo", Type: "aws_instance"},
+			Resource: &config.Resource{
+				Name: "foo",
+				Type: "aws_instance",
+				Lifecycle: config.ResourceLifecycle{
+					Postconditions: []*config.ResourceCondition{
+						&config.ResourceCondition{RawConfig: rc},
+					},
+				},
+			},
+			InterpResource: &Resource{Name: "foo", Type: "aws_instance"},
+			State:          &state,
+			Error:          &applyErr,
+		}
+
+		ctx := &MockEvalContext{
+			InterpolateConfigResult: NewResourceConfig(nil),
+		}
+		ctx.InterpolateConfigResult.Config = result
+		if _, err := n.Eval(ctx); err != nil {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+
+		if ctx.InterpolateResource.State != state {
+			t.Fatalf("%s: self should be the applied state", k)
+		}
+		if tc.Err == "" {
+			if applyErr != nil {
+				t.Fatalf("%s: err: %s", k, applyErr)
+			}
+			if state.Tainted {
+				t.Fatalf("%s: should not be tainted", k)
+			}
+			continue
+		}
+
+		if applyErr == nil || !strings.Contains(applyErr.Error(), tc.Err) {
+			t.Fatalf("%s: bad: %s", k, applyErr)
+		}
+		if !state.Tainted {
+			t.Fatalf("%s: should be tainted", k)
+		}
+	}
+}
+
+func TestEvalCheckPostconditions_applyError(t *testing.T) {
+	state := &InstanceState{ID: "foo"}
+	applyErr := errors.New("apply failed")
+	n := &EvalCheckPostconditions{
+		Resource: &config.Resource{
+			Lifecycle: config.ResourceLifecycle{
+				Postconditions: []*config.ResourceCondition{
+					&config.ResourceCondition{},
+				},
+			},
+		},
+		State: &state,
+		Error: &applyErr,
+	}
+
+	ctx := new(MockEvalContext)
+	if _, err := n.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if ctx.InterpolateCalled {
+		t.Fatal("postconditions should not be checked after a failed apply")
+	}
+}
+
+func TestEvalCheckPreconditions(t *testing.T) {
+	cases := map[string]struct {
+		Condition interface{}
+		Err       string
+	}{
+		"true":    {"true", ""},
+		"false":   {"false", "aws_instance.foo: precondition #1: failed: ${var.foo}"},
+		"unknown": {config.UnknownVariableValue, ""},
+	}
+
+	for k, tc := range cases {
+		rc, err := config.NewRawConfig(map[string]interface{}{
+			"condition": "${var.foo}",
+		})
+		if err != nil {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+
+		n := &EvalCheckPreconditions{
+			Info: &InstanceInfo{Id: "aws_instance.foo", Type: "aws_instance"},
+			Resource: &config.Resource{
+				Name: "foo",
+				Type: "aws_instance",
+				Lifecycle: config.ResourceLifecycle{
+					Preconditions: []*config.ResourceCondition{
+						&config.ResourceCondition{RawConfig: rc},
+					},
+				},
+			},
+		}
+
+		ctx := &MockEvalContext{
+			InterpolateConfigResult: NewResourceConfig(nil),
+		}
+		ctx.InterpolateConfigResult.Config = map[string]interface{}{
+			"condition": tc.Condition,
+		}
+
+		_, err = n.Eval(ctx)
+		if tc.Err == "" {
+			if err != nil {
+				t.Fatalf("%s: err: %s", k, err)
+			}
+			continue
+		}
+
+		if err == nil || !strings.Contains(err.Error(), tc.Err) {
+			t.Fatalf("%s: bad: %s", k, err)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package terraform
 
 import (
 	"sync"
+	"time"
 
 	"github.com/hashicorp/terraform/config"
 )
@@ -12,6 +13,11 @@ type EvalContext interface {
 	// via Terraform.Context.Stop()
 	Stopped() <-chan struct{}
 
+	// Interrupted returns a channel that is closed when evaluation is
+	// interrupted via Terraform.Context.Interrupt() or stopped. Work that
+	// is already in flight should be finished, but nothing new started.
+	Interrupted() <-chan struct{}
+
 	// Path is the current module path.
 	Path() []string
 
@@ -80,5 +86,104 @@ type EvalContext interface {
 
 	// State returns the global state as well as the lock that should
 	// be used to modify that state.
-	State() (*State, *sync.RWMutex)
+	State() (*State, StateLocker)
+
+	// ResourceStates returns a copy of the state of every resource in
+	// the global state, keyed by address, such as to check invariants
+	// across resources. The copy is made with the state lock held, so it
+	// is consistent and isn't changed by later writes to the state.
+	ResourceStates() (map[string]*ResourceState, error)
+
+	// RefreshTargetsOnly returns true if only the resources that are
+	// directly targeted should be refreshed. Other resources keep the
+	// state they already have.
+	RefreshTargetsOnly() bool
+
+	// ForceReplace returns true if the resource with the given address
+	// must be planned as a full replacement, regardless of its state.
+	ForceReplace(*ResourceAddress) bool
+
+	// ForceAttributes returns the attributes that must be in the diff of
+	// the resource with the given address, even if they're unchanged.
+	ForceAttributes(*ResourceAddress) []string
+
+	// AttributeFilter returns the glob patterns of the attributes whose
+	// changes are kept in the diffs of updates, or nil if all are kept.
+	AttributeFilter() []string
+
+	// ResourceTimeout returns the maximum time applying a single resource
+	// instance may take as a whole, or zero if there is no limit.
+	ResourceTimeout() time.Duration
+
+	// ApplyStarted is called by EvalApplyPre when the apply of a resource
+	// instance starts, before the PreApply hooks. It returns an error if
+	// the apply mustn't start anymore, such as when the resource timed out
+	// in the meantime.
+	ApplyStarted() error
+
+	// ResourceWarnings records warnings for the resource instance with the
+	// given address, such as those a provider reported, which are added
+	// to the plan.
+	ResourceWarnings(*ResourceAddress, []string)
+
+	// ManagedBy returns the check for resources managed by another
+	// configuration, or nil if they aren't checked.
+	ManagedBy() *ManagedBy
+
+	// RewriteProvisionerConfig returns the function that changes the
+	// configuration of provisioners before they run, or nil if it isn't
+	// changed.
+	RewriteProvisionerConfig() ProvisionerConfigFunc
+
+	// ApplyProgress returns the record of the resource instances that are
+	// applied, or nil if it isn't recorded.
+	ApplyProgress() *ApplyProgress
+
+	// ApplyGate returns the function that allows each stage of an apply
+	// to start, or nil if the stages don't wait.
+	ApplyGate() ApplyGateFunc
+
+	// Tracer returns the tracer for the operations done on resources, or
+	// nil if they aren't traced.
+	Tracer() Tracer
+
+	// DiffCache returns the cache of the diffs computed by providers, or
+	// nil if diffs aren't cached.
+	DiffCache() *DiffCache
+
+	// StateLockTimeout returns the maximum time to wait for the lock on
+	// the state when reading or writing the state of a resource, or zero
+	// if there is no limit.
+	StateLockTimeout() time.Duration
+
+	// SkipProvisioners returns true if the provisioners that run at the
+	// given time must not be run.
+	SkipProvisioners(config.ProvisionerWhen) bool
+
+	// StateUpdated calls the PostStateUpdate hooks after the state was
+	// changed. If state updates are batched, the call is deferred until
+	// FlushStateUpdates or the end of the walk instead.
+	StateUpdated() error
+
+	// FlushStateUpdates calls the PostStateUpdate hooks if there are
+	// batched state updates they haven't seen yet. This must be called
+	// before anything is destroyed, so that the persisted state is never
+	// behind on what exists.
+	FlushStateUpdates() error
+
+	// PreApplyProvider calls the PreApplyProvider hooks for the provider
+	// with the given name in the current module, but only the first time
+	// it's called for that provider during the walk. Every call returns
+	// the result of that first call, waiting for it if it's still running.
+	PreApplyProvider(string) error
+}
+
+// StateLocker is the lock of the global state that EvalContext.State
+// returns. It's the lock of the walk, unless the context has to keep a
+// node from changing the state, see EvalTimeout.
+type StateLocker interface {
+	sync.Locker
+	RLock()
+	RUnlock()
+	RLocker() sync.Locker
 }
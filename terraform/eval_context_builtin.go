@@ -6,6 +6,7 @@ import (
 	"log"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/hashicorp/terraform/config"
 )
@@ -16,6 +17,10 @@ type BuiltinEvalContext struct {
 	// StopContext is the context used to track whether we're complete
 	StopContext context.Context
 
+	// InterruptContext is the context used to track whether we've been
+	// interrupted and shouldn't start any new work
+	InterruptContext context.Context
+
 	// PathValue is the Path that this context is operating within.
 	PathValue []string
 
@@ -37,6 +42,7 @@ type BuiltinEvalContext struct {
 	ProviderConfigCache map[string]*ResourceConfig
 	ProviderInputConfig map[string]map[string]interface{}
 	ProviderLock        *sync.Mutex
+	ProviderApplies     map[string]*providerApply
 	ProvisionerCache    map[string]ResourceProvisioner
 	ProvisionerLock     *sync.Mutex
 	DiffValue           *Diff
@@ -44,7 +50,82 @@ type BuiltinEvalContext struct {
 	StateValue          *State
 	StateLock           *sync.RWMutex
 
+	// RefreshTargetsOnlyValue is returned by RefreshTargetsOnly.
+	RefreshTargetsOnlyValue bool
+
+	// ReplaceValue is the list of addresses that ForceReplace matches.
+	ReplaceValue []*ResourceAddress
+
+	// ForceAttributesValue is the list of attributes ForceAttributes
+	// returns for the resources they match.
+	ForceAttributesValue []*forcedAttributes
+
+	// AttributeFilterValue is returned by AttributeFilter.
+	AttributeFilterValue []string
+
+	// ResourceTimeoutValue is returned by ResourceTimeout.
+	ResourceTimeoutValue time.Duration
+
+	// TracerValue is returned by Tracer.
+	TracerValue Tracer
+
+	// DiffCacheValue is returned by DiffCache.
+	DiffCacheValue *DiffCache
+
+	// ManagedByValue is returned by ManagedBy.
+	ManagedByValue *ManagedBy
+
+	// RewriteProvConfigValue is returned by RewriteProvisionerConfig.
+	RewriteProvConfigValue ProvisionerConfigFunc
+
+	// ApplyProgressValue is returned by ApplyProgress.
+	ApplyProgressValue *ApplyProgress
+
+	// ApplyGateValue is returned by ApplyGate.
+	ApplyGateValue ApplyGateFunc
+
+	// StateLockTimeoutValue is returned by StateLockTimeout.
+	StateLockTimeoutValue time.Duration
+
+	// SkipProvisionersValue and SkipDestroyProvsValue are returned by
+	// SkipProvisioners for the creation-time and destroy-time
+	// provisioners respectively.
+	SkipProvisionersValue bool
+	SkipDestroyProvsValue bool
+
+	// StateUpdates, if non-nil, batches the calls to the PostStateUpdate
+	// hooks. See StateUpdated.
+	StateUpdates *stateUpdateBatch
+
+	// ResourceWarningsValue, if non-nil, collects the warnings recorded
+	// with ResourceWarnings. They're dropped otherwise.
+	ResourceWarningsValue *resourceWarnings
+
 	once sync.Once
+
+	// StateInvalidations are the resource states invalidated with
+	// Context.InvalidateState. See stateInvalidator.
+	StateInvalidations *stateInvalidations
+
+	// StateLog, if non-nil, logs the changes to the state of resources.
+	// See stateTransitionLogger.
+	StateLog *stateLog
+
+	// UnrefreshedState, if non-nil, is the state from before the refresh
+	// that preceded the plan. See unrefreshedStateReader.
+	UnrefreshedState *State
+
+	// stateCache caches the resource states looked up in this module for
+	// the duration of the walk. See resourceStateCacher.
+	stateCache     map[string]resourceStateCacheEntry
+	stateCacheLock sync.Mutex
+}
+
+// resourceStateCacheEntry is a cached resource state along with the
+// module state it was found in.
+type resourceStateCacheEntry struct {
+	Module   *ModuleState
+	Resource *ResourceState
 }
 
 func (ctx *BuiltinEvalContext) Stopped() <-chan struct{} {
@@ -56,6 +137,15 @@ func (ctx *BuiltinEvalContext) Stopped() <-chan struct{} {
 	return ctx.StopContext.Done()
 }
 
+func (ctx *BuiltinEvalContext) Interrupted() <-chan struct{} {
+	// This can happen during tests. During tests, we just block forever.
+	if ctx.InterruptContext == nil {
+		return nil
+	}
+
+	return ctx.InterruptContext.Done()
+}
+
 func (ctx *BuiltinEvalContext) Hook(fn func(Hook) (HookAction, error)) error {
 	for _, h := range ctx.Hooks {
 		action, err := fn(h)
@@ -295,11 +385,40 @@ func (ctx *BuiltinEvalContext) Interpolate(
 			Resource: r,
 		}
 
-		vs, err := ctx.Interpolater.Values(scope, cfg.Variables)
+		// The variables only used within a try are allowed to fail, in
+		// which case they're left out so the try uses its default.
+		required := cfg.Variables
+		if len(cfg.TryVariables) > 0 {
+			required = make(map[string]config.InterpolatedVariable)
+			for k, v := range cfg.Variables {
+				if _, ok := cfg.TryVariables[k]; !ok {
+					required[k] = v
+				}
+			}
+		}
+
+		vs, err := ctx.Interpolater.Values(scope, required)
 		if err != nil {
 			return nil, err
 		}
 
+		for k := range cfg.TryVariables {
+			v, ok := cfg.Variables[k]
+			if !ok {
+				continue
+			}
+
+			tryVs, err := ctx.Interpolater.Values(scope, map[string]config.InterpolatedVariable{k: v})
+			if err != nil {
+				log.Printf("[DEBUG] %s: using try default: %s", k, err)
+				continue
+			}
+
+			if tv, ok := tryVs[k]; ok {
+				vs[k] = tv
+			}
+		}
+
 		// Do the interpolation
 		if err := cfg.Interpolate(vs); err != nil {
 			return nil, err
@@ -339,9 +458,279 @@ func (ctx *BuiltinEvalContext) Diff() (*Diff, *sync.RWMutex) {
 	return ctx.DiffValue, ctx.DiffLock
 }
 
-func (ctx *BuiltinEvalContext) State() (*State, *sync.RWMutex) {
+func (ctx *BuiltinEvalContext) State() (*State, StateLocker) {
 	return ctx.StateValue, ctx.StateLock
 }
 
+func (ctx *BuiltinEvalContext) ResourceStates() (map[string]*ResourceState, error) {
+	result := make(map[string]*ResourceState)
+	if ctx.StateValue == nil {
+		return result, nil
+	}
+
+	if err := lockState(ctx, ctx.StateLock.RLocker()); err != nil {
+		return nil, err
+	}
+	defer ctx.StateLock.RUnlock()
+
+	for _, m := range ctx.StateValue.Modules {
+		for k, rs := range m.Resources {
+			addr, err := parseResourceAddressInternal(k)
+			if err != nil {
+				return nil, err
+			}
+			addr.Path = normalizeModulePath(m.Path)[1:]
+
+			result[addr.String()] = rs.deepcopy()
+		}
+	}
+
+	return result, nil
+}
+
+func (ctx *BuiltinEvalContext) StateUpdated() error {
+	if ctx.StateUpdates != nil {
+		ctx.StateUpdates.add()
+		return nil
+	}
+
+	return ctx.callStateHooks()
+}
+
+func (ctx *BuiltinEvalContext) FlushStateUpdates() error {
+	if ctx.StateUpdates == nil || !ctx.StateUpdates.take() {
+		return nil
+	}
+
+	return ctx.callStateHooks()
+}
+
+func (ctx *BuiltinEvalContext) ResourceTimeout() time.Duration {
+	return ctx.ResourceTimeoutValue
+}
+
+func (ctx *BuiltinEvalContext) ApplyStarted() error {
+	return nil
+}
+
+func (ctx *BuiltinEvalContext) StateLockTimeout() time.Duration {
+	return ctx.StateLockTimeoutValue
+}
+
+func (ctx *BuiltinEvalContext) SkipProvisioners(when config.ProvisionerWhen) bool {
+	if when == config.ProvisionerWhenDestroy {
+		return ctx.SkipDestroyProvsValue
+	}
+
+	return ctx.SkipProvisionersValue
+}
+
+// PreApplyProvider keeps track of the providers in ProviderApplies, which
+// is shared by all contexts of the walk like ProviderCache. Without it,
+// the hooks are called every time.
+func (ctx *BuiltinEvalContext) PreApplyProvider(n string) error {
+	hook := func() error {
+		return ctx.Hook(func(h Hook) (HookAction, error) {
+			return h.PreApplyProvider(ctx.Path(), n)
+		})
+	}
+
+	if ctx.ProviderApplies == nil {
+		return hook()
+	}
+
+	providerPath := make([]string, len(ctx.Path())+1)
+	copy(providerPath, ctx.Path())
+	providerPath[len(providerPath)-1] = n
+	key := PathCacheKey(providerPath)
+
+	ctx.ProviderLock.Lock()
+	pa, ok := ctx.ProviderApplies[key]
+	if !ok {
+		pa = new(providerApply)
+		ctx.ProviderApplies[key] = pa
+	}
+	ctx.ProviderLock.Unlock()
+
+	pa.once.Do(func() { pa.err = hook() })
+	return pa.err
+}
+
+func (ctx *BuiltinEvalContext) callStateHooks() error {
+	state, lock := ctx.State()
+
+	// Get a full lock. Even calling something like WriteState can modify
+	// (prune) the state, so we need the full lock.
+	lock.Lock()
+	defer lock.Unlock()
+
+	return ctx.Hook(func(h Hook) (HookAction, error) {
+		return h.PostStateUpdate(state)
+	})
+}
+
+func (ctx *BuiltinEvalContext) RefreshTargetsOnly() bool {
+	return ctx.RefreshTargetsOnlyValue
+}
+
+func (ctx *BuiltinEvalContext) ForceReplace(addr *ResourceAddress) bool {
+	for _, r := range ctx.ReplaceValue {
+		if r.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (ctx *BuiltinEvalContext) ResourceWarnings(addr *ResourceAddress, warns []string) {
+	if ctx.ResourceWarningsValue == nil || len(warns) == 0 {
+		return
+	}
+
+	ctx.ResourceWarningsValue.add(addr, warns)
+}
+
+func (ctx *BuiltinEvalContext) Tracer() Tracer {
+	return ctx.TracerValue
+}
+
+func (ctx *BuiltinEvalContext) DiffCache() *DiffCache {
+	return ctx.DiffCacheValue
+}
+
+func (ctx *BuiltinEvalContext) ManagedBy() *ManagedBy {
+	return ctx.ManagedByValue
+}
+
+func (ctx *BuiltinEvalContext) RewriteProvisionerConfig() ProvisionerConfigFunc {
+	return ctx.RewriteProvConfigValue
+}
+
+func (ctx *BuiltinEvalContext) ApplyProgress() *ApplyProgress {
+	return ctx.ApplyProgressValue
+}
+
+func (ctx *BuiltinEvalContext) ApplyGate() ApplyGateFunc {
+	return ctx.ApplyGateValue
+}
+
+func (ctx *BuiltinEvalContext) AttributeFilter() []string {
+	return ctx.AttributeFilterValue
+}
+
+func (ctx *BuiltinEvalContext) ForceAttributes(addr *ResourceAddress) []string {
+	var result []string
+	seen := make(map[string]struct{})
+	for _, f := range ctx.ForceAttributesValue {
+		if !f.Addr.Contains(addr) {
+			continue
+		}
+
+		for _, k := range f.Attributes {
+			if _, ok := seen[k]; !ok {
+				seen[k] = struct{}{}
+				result = append(result, k)
+			}
+		}
+	}
+
+	return result
+}
+
+// resourceStateCacher
+func (ctx *BuiltinEvalContext) cachedResourceState(name string) *ResourceState {
+	ctx.stateCacheLock.Lock()
+	defer ctx.stateCacheLock.Unlock()
+
+	entry, ok := ctx.stateCache[name]
+	if !ok {
+		return nil
+	}
+
+	// If the resource state was replaced or removed since we cached it,
+	// the entry is stale.
+	if entry.Module.Resources[name] != entry.Resource {
+		delete(ctx.stateCache, name)
+		return nil
+	}
+
+	return entry.Resource
+}
+
+// resourceStateCacher
+func (ctx *BuiltinEvalContext) cacheResourceState(
+	name string, mod *ModuleState, rs *ResourceState) {
+	ctx.stateCacheLock.Lock()
+	defer ctx.stateCacheLock.Unlock()
+
+	if ctx.stateCache == nil {
+		ctx.stateCache = make(map[string]resourceStateCacheEntry)
+	}
+
+	ctx.stateCache[name] = resourceStateCacheEntry{
+		Module:   mod,
+		Resource: rs,
+	}
+}
+
+// stateInvalidator
+func (ctx *BuiltinEvalContext) takeInvalidatedState(name string) (bool, error) {
+	return ctx.StateInvalidations.take(ctx.Path(), name)
+}
+
+// stateInvalidator
+func (ctx *BuiltinEvalContext) setRefreshedState(
+	name string, state *InstanceState) error {
+	return ctx.StateInvalidations.setRefreshed(ctx.Path(), name, state)
+}
+
+// stateTransitionLogger
+func (ctx *BuiltinEvalContext) logStateTransition(
+	name string, serial int64, action StateTransitionAction, deposed bool) {
+	if ctx.StateLog == nil {
+		return
+	}
+
+	addr, err := parseResourceAddressInternal(name)
+	if err != nil {
+		log.Printf("[ERROR] state log: %s", err)
+		return
+	}
+	addr.Path = normalizeModulePath(ctx.Path())[1:]
+
+	ctx.StateLog.log(&StateTransition{
+		Addr:      addr.String(),
+		Action:    action,
+		Deposed:   deposed,
+		OldSerial: serial,
+		NewSerial: serial + 1,
+	})
+}
+
 func (ctx *BuiltinEvalContext) init() {
 }
+
+// providerApply is the result of calling the PreApplyProvider hooks for a
+// single provider.
+type providerApply struct {
+	once sync.Once
+	err  error
+}
+
+func (ctx *BuiltinEvalContext) unrefreshedInstance(name string) (*InstanceState, bool) {
+	if ctx.UnrefreshedState == nil {
+		return nil, false
+	}
+
+	mod := ctx.UnrefreshedState.ModuleByPath(ctx.Path())
+	if mod == nil {
+		return nil, true
+	}
+	rs := mod.Resources[name]
+	if rs == nil {
+		return nil, true
+	}
+
+	return rs.Primary, true
+}
@@ -1,7 +1,9 @@
 package terraform
 
 import (
+	"fmt"
 	"reflect"
+	"sort"
 	"sync"
 	"testing"
 )
@@ -37,6 +39,255 @@ func TestBuiltinEvalContextProviderInput(t *testing.T) {
 	}
 }
 
+func TestBuiltinEvalContextStateUpdated(t *testing.T) {
+	mockHook := new(MockHook)
+
+	ctx := testBuiltinEvalContext(t)
+	ctx.Hooks = []Hook{mockHook}
+	ctx.StateValue = &State{Serial: 42}
+	ctx.StateLock = new(sync.RWMutex)
+
+	if err := ctx.StateUpdated(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !mockHook.PostStateUpdateCalled {
+		t.Fatal("should call PostStateUpdate")
+	}
+	if mockHook.PostStateUpdateState.Serial != 42 {
+		t.Fatalf("bad: %#v", mockHook.PostStateUpdateState)
+	}
+
+	// Without batching there is never anything to flush
+	mockHook.PostStateUpdateCalled = false
+	if err := ctx.FlushStateUpdates(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if mockHook.PostStateUpdateCalled {
+		t.Fatal("should not call PostStateUpdate")
+	}
+}
+
+func TestBuiltinEvalContextStateUpdated_batch(t *testing.T) {
+	mockHook := new(MockHook)
+
+	ctx := testBuiltinEvalContext(t)
+	ctx.Hooks = []Hook{mockHook}
+	ctx.StateValue = &State{Serial: 42}
+	ctx.StateLock = new(sync.RWMutex)
+	ctx.StateUpdates = new(stateUpdateBatch)
+
+	for i := 0; i < 3; i++ {
+		if err := ctx.StateUpdated(); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	if mockHook.PostStateUpdateCalled {
+		t.Fatal("should not call PostStateUpdate until flushed")
+	}
+
+	if err := ctx.FlushStateUpdates(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !mockHook.PostStateUpdateCalled {
+		t.Fatal("should call PostStateUpdate")
+	}
+
+	// A second flush has nothing new to report
+	mockHook.PostStateUpdateCalled = false
+	if err := ctx.FlushStateUpdates(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if mockHook.PostStateUpdateCalled {
+		t.Fatal("should not call PostStateUpdate")
+	}
+}
+
+func TestBuiltinEvalContextPreApplyProvider(t *testing.T) {
+	var lock sync.Mutex
+	applies := make(map[string]*providerApply)
+	hook := new(testHookPreApplyProvider)
+
+	ctx1 := testBuiltinEvalContext(t)
+	ctx1.PathValue = []string{"root"}
+	ctx1.Hooks = []Hook{hook}
+	ctx1.ProviderApplies = applies
+	ctx1.ProviderLock = &lock
+
+	ctx2 := testBuiltinEvalContext(t)
+	ctx2.PathValue = []string{"root", "child"}
+	ctx2.Hooks = []Hook{hook}
+	ctx2.ProviderApplies = applies
+	ctx2.ProviderLock = &lock
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		for _, ctx := range []*BuiltinEvalContext{ctx1, ctx2} {
+			wg.Add(1)
+			go func(ctx *BuiltinEvalContext) {
+				defer wg.Done()
+				if err := ctx.PreApplyProvider("aws"); err != nil {
+					t.Errorf("err: %s", err)
+				}
+			}(ctx)
+		}
+	}
+	wg.Wait()
+
+	actual := hook.Providers
+	sort.Strings(actual)
+	expected := []string{"root.aws", "root.child.aws"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestBuiltinEvalContextPreApplyProvider_error(t *testing.T) {
+	hook := new(MockHook)
+	hook.PreApplyProviderError = fmt.Errorf("error")
+
+	ctx := testBuiltinEvalContext(t)
+	ctx.PathValue = rootModulePath
+	ctx.Hooks = []Hook{hook}
+	ctx.ProviderApplies = make(map[string]*providerApply)
+	ctx.ProviderLock = new(sync.Mutex)
+
+	// Every use of the provider gets the error, not just the first
+	for i := 0; i < 2; i++ {
+		if err := ctx.PreApplyProvider("aws"); err == nil {
+			t.Fatal("should error")
+		}
+	}
+}
+
 func testBuiltinEvalContext(t *testing.T) *BuiltinEvalContext {
 	return &BuiltinEvalContext{}
 }
+
+func TestBuiltinEvalContextResourceStates(t *testing.T) {
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo.0": testResourceStateTagged("foo0", "a"),
+					"aws_instance.foo.1": testResourceStateTagged("foo1", "a"),
+				},
+			},
+			&ModuleState{
+				Path: []string{"root", "child"},
+				Resources: map[string]*ResourceState{
+					"aws_instance.bar": testResourceStateTagged("bar", "a"),
+				},
+			},
+		},
+	}
+
+	ctx := testBuiltinEvalContext(t)
+	ctx.StateValue = state
+	ctx.StateLock = new(sync.RWMutex)
+
+	// Change the tag of all the instances at once while a policy checks
+	// that they always share it
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			ctx.StateLock.Lock()
+			for _, m := range state.Modules {
+				for _, rs := range m.Resources {
+					rs.Primary.Attributes["tags.env"] = fmt.Sprintf("%d", i)
+				}
+			}
+			ctx.StateLock.Unlock()
+		}
+	}()
+
+	policy := &testEvalSharedTag{Tag: "env"}
+	for i := 0; i < 100; i++ {
+		if _, err := policy.Eval(ctx); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	<-done
+
+	actual, err := ctx.ResourceStates()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var keys []string
+	for k := range actual {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	expected := []string{
+		"aws_instance.foo[0]",
+		"aws_instance.foo[1]",
+		"module.child.aws_instance.bar",
+	}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Fatalf("bad: %#v", keys)
+	}
+
+	// The result is a copy that doesn't change with the state
+	state.Modules[0].Resources["aws_instance.foo.0"].Primary.Attributes["tags.env"] = "changed"
+	if v := actual["aws_instance.foo[0]"].Primary.Attributes["tags.env"]; v != "99" {
+		t.Fatalf("bad: %s", v)
+	}
+	actual["aws_instance.foo[1]"].Primary.Attributes["tags.env"] = "changed"
+	if v := state.Modules[0].Resources["aws_instance.foo.1"].Primary.Attributes["tags.env"]; v != "99" {
+		t.Fatalf("bad: %s", v)
+	}
+}
+
+func TestBuiltinEvalContextResourceStates_noState(t *testing.T) {
+	ctx := testBuiltinEvalContext(t)
+	actual, err := ctx.ResourceStates()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(actual) != 0 {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+// testEvalSharedTag is a policy that errors if the instances in the state
+// don't all have the same value for a tag.
+type testEvalSharedTag struct {
+	Tag string
+}
+
+func (n *testEvalSharedTag) Eval(ctx EvalContext) (interface{}, error) {
+	states, err := ctx.ResourceStates()
+	if err != nil {
+		return nil, err
+	}
+
+	var value *string
+	for addr, rs := range states {
+		v := rs.Primary.Attributes["tags."+n.Tag]
+		if value == nil {
+			value = &v
+		}
+		if v != *value {
+			return nil, fmt.Errorf("%s: tag %s is %q, expected %q", addr, n.Tag, v, *value)
+		}
+	}
+
+	return nil, nil
+}
+
+func testResourceStateTagged(id, env string) *ResourceState {
+	return &ResourceState{
+		Type: "aws_instance",
+		Primary: &InstanceState{
+			ID: id,
+			Attributes: map[string]string{
+				"id":       id,
+				"tags.%":   "1",
+				"tags.env": env,
+			},
+		},
+	}
+}
@@ -2,6 +2,7 @@ package terraform
 
 import (
 	"sync"
+	"time"
 
 	"github.com/hashicorp/terraform/config"
 )
@@ -12,6 +13,9 @@ type MockEvalContext struct {
 	StoppedCalled bool
 	StoppedValue  <-chan struct{}
 
+	InterruptedCalled bool
+	InterruptedValue  <-chan struct{}
+
 	HookCalled bool
 	HookHook   Hook
 	HookError  error
@@ -86,6 +90,69 @@ type MockEvalContext struct {
 	StateCalled bool
 	StateState  *State
 	StateLock   *sync.RWMutex
+
+	ResourceStatesCalled bool
+	ResourceStatesValue  map[string]*ResourceState
+	ResourceStatesError  error
+
+	StateUpdatedCalled bool
+	StateUpdatedError  error
+
+	FlushStateUpdatesCalled bool
+	FlushStateUpdatesError  error
+
+	PreApplyProviderCalled bool
+	PreApplyProviderName   string
+	PreApplyProviderError  error
+
+	RefreshTargetsOnlyCalled bool
+	RefreshTargetsOnlyValue  bool
+
+	ForceReplaceCalled bool
+	ForceReplaceAddr   *ResourceAddress
+	ForceReplaceValue  bool
+
+	ForceAttributesCalled bool
+	ForceAttributesAddr   *ResourceAddress
+	ForceAttributesValue  []string
+
+	AttributeFilterCalled bool
+	AttributeFilterValue  []string
+
+	ResourceTimeoutCalled bool
+	ResourceTimeoutValue  time.Duration
+
+	ApplyStartedCalled bool
+	ApplyStartedError  error
+
+	ResourceWarningsCalled   bool
+	ResourceWarningsAddr     *ResourceAddress
+	ResourceWarningsWarnings []string
+
+	TracerCalled bool
+	TracerValue  Tracer
+
+	DiffCacheCalled bool
+	DiffCacheValue  *DiffCache
+
+	ManagedByCalled bool
+	ManagedByValue  *ManagedBy
+
+	RewriteProvisionerConfigCalled bool
+	RewriteProvisionerConfigValue  ProvisionerConfigFunc
+
+	ApplyProgressCalled bool
+	ApplyProgressValue  *ApplyProgress
+
+	ApplyGateCalled bool
+	ApplyGateValue  ApplyGateFunc
+
+	StateLockTimeoutCalled bool
+	StateLockTimeoutValue  time.Duration
+
+	SkipProvisionersCalled bool
+	SkipProvisionersWhen   config.ProvisionerWhen
+	SkipProvisionersValue  bool
 }
 
 func (c *MockEvalContext) Stopped() <-chan struct{} {
@@ -93,6 +160,11 @@ func (c *MockEvalContext) Stopped() <-chan struct{} {
 	return c.StoppedValue
 }
 
+func (c *MockEvalContext) Interrupted() <-chan struct{} {
+	c.InterruptedCalled = true
+	return c.InterruptedValue
+}
+
 func (c *MockEvalContext) Hook(fn func(Hook) (HookAction, error)) error {
 	c.HookCalled = true
 	if c.HookHook != nil {
@@ -202,7 +274,107 @@ func (c *MockEvalContext) Diff() (*Diff, *sync.RWMutex) {
 	return c.DiffDiff, c.DiffLock
 }
 
-func (c *MockEvalContext) State() (*State, *sync.RWMutex) {
+func (c *MockEvalContext) State() (*State, StateLocker) {
 	c.StateCalled = true
 	return c.StateState, c.StateLock
 }
+
+func (c *MockEvalContext) ResourceStates() (map[string]*ResourceState, error) {
+	c.ResourceStatesCalled = true
+	return c.ResourceStatesValue, c.ResourceStatesError
+}
+
+func (c *MockEvalContext) StateUpdated() error {
+	c.StateUpdatedCalled = true
+	return c.StateUpdatedError
+}
+
+func (c *MockEvalContext) FlushStateUpdates() error {
+	c.FlushStateUpdatesCalled = true
+	return c.FlushStateUpdatesError
+}
+
+func (c *MockEvalContext) ResourceTimeout() time.Duration {
+	c.ResourceTimeoutCalled = true
+	return c.ResourceTimeoutValue
+}
+
+func (c *MockEvalContext) ApplyStarted() error {
+	c.ApplyStartedCalled = true
+	return c.ApplyStartedError
+}
+
+func (c *MockEvalContext) StateLockTimeout() time.Duration {
+	c.StateLockTimeoutCalled = true
+	return c.StateLockTimeoutValue
+}
+
+func (c *MockEvalContext) SkipProvisioners(when config.ProvisionerWhen) bool {
+	c.SkipProvisionersCalled = true
+	c.SkipProvisionersWhen = when
+	return c.SkipProvisionersValue
+}
+
+func (c *MockEvalContext) PreApplyProvider(n string) error {
+	c.PreApplyProviderCalled = true
+	c.PreApplyProviderName = n
+	return c.PreApplyProviderError
+}
+
+func (c *MockEvalContext) RefreshTargetsOnly() bool {
+	c.RefreshTargetsOnlyCalled = true
+	return c.RefreshTargetsOnlyValue
+}
+
+func (c *MockEvalContext) ForceReplace(addr *ResourceAddress) bool {
+	c.ForceReplaceCalled = true
+	c.ForceReplaceAddr = addr
+	return c.ForceReplaceValue
+}
+
+func (c *MockEvalContext) ResourceWarnings(addr *ResourceAddress, warns []string) {
+	c.ResourceWarningsCalled = true
+	c.ResourceWarningsAddr = addr
+	c.ResourceWarningsWarnings = warns
+}
+
+func (c *MockEvalContext) Tracer() Tracer {
+	c.TracerCalled = true
+	return c.TracerValue
+}
+
+func (c *MockEvalContext) DiffCache() *DiffCache {
+	c.DiffCacheCalled = true
+	return c.DiffCacheValue
+}
+
+func (c *MockEvalContext) ManagedBy() *ManagedBy {
+	c.ManagedByCalled = true
+	return c.ManagedByValue
+}
+
+func (c *MockEvalContext) RewriteProvisionerConfig() ProvisionerConfigFunc {
+	c.RewriteProvisionerConfigCalled = true
+	return c.RewriteProvisionerConfigValue
+}
+
+func (c *MockEvalContext) ApplyProgress() *ApplyProgress {
+	c.ApplyProgressCalled = true
+	return c.ApplyProgressValue
+}
+
+func (c *MockEvalContext) ApplyGate() ApplyGateFunc {
+	c.ApplyGateCalled = true
+	return c.ApplyGateValue
+}
+
+func (c *MockEvalContext) AttributeFilter() []string {
+	c.AttributeFilterCalled = true
+	return c.AttributeFilterValue
+}
+
+func (c *MockEvalContext) ForceAttributes(addr *ResourceAddress) []string {
+	c.ForceAttributesCalled = true
+	c.ForceAttributesAddr = addr
+	return c.ForceAttributesValue
+}
@@ -13,6 +13,12 @@ type EvalCountFixZeroOneBoundary struct {
 
 // TODO: test
 func (n *EvalCountFixZeroOneBoundary) Eval(ctx EvalContext) (interface{}, error) {
+	// If the count isn't known yet there is nothing we can fix. This
+	// happens when the expansion of the resource is deferred to apply.
+	if countComputed(n.Resource) {
+		return nil, nil
+	}
+
 	// Get the count, important for knowing whether we're supposed to
 	// be adding the zero, or trimming it.
 	count, err := n.Resource.Count()
@@ -20,13 +26,6 @@ func (n *EvalCountFixZeroOneBoundary) Eval(ctx EvalContext) (interface{}, error)
 		return nil, err
 	}
 
-	// Figure what to look for and what to replace it with
-	hunt := n.Resource.Id()
-	replace := hunt + ".0"
-	if count < 2 {
-		hunt, replace = replace, hunt
-	}
-
 	state, lock := ctx.State()
 
 	// Get a lock so we can access this instance and potentially make
@@ -40,6 +39,31 @@ func (n *EvalCountFixZeroOneBoundary) Eval(ctx EvalContext) (interface{}, error)
 		return nil, nil
 	}
 
+	// With a zero count every instance is an orphan, so we fix the keys
+	// based on how many instances are in the state. This is what
+	// EvalCountFixZeroOneBoundaryGlobal does during apply, so the destroys
+	// we plan use the keys the instances will have then.
+	if count == 0 {
+		for k := range mod.Resources {
+			key, err := ParseResourceStateKey(k)
+			if err != nil {
+				return nil, err
+			}
+
+			key.Index = -1
+			if key.String() == n.Resource.Id() {
+				count++
+			}
+		}
+	}
+
+	// Figure what to look for and what to replace it with
+	hunt := n.Resource.Id()
+	replace := hunt + ".0"
+	if count < 2 {
+		hunt, replace = replace, hunt
+	}
+
 	// Look for the resource state. If we don't have one, then it is okay.
 	rs, ok := mod.Resources[hunt]
 	if !ok {
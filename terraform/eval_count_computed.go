@@ -2,6 +2,7 @@ package terraform
 
 import (
 	"fmt"
+	"log"
 
 	"github.com/hashicorp/terraform/config"
 )
@@ -15,7 +16,7 @@ type EvalCountCheckComputed struct {
 
 // TODO: test
 func (n *EvalCountCheckComputed) Eval(ctx EvalContext) (interface{}, error) {
-	if n.Resource.RawCount.Value() == unknownValue() {
+	if countComputed(n.Resource) {
 		return nil, fmt.Errorf(
 			"%s: value of 'count' cannot be computed",
 			n.Resource.Id())
@@ -23,3 +24,43 @@ func (n *EvalCountCheckComputed) Eval(ctx EvalContext) (interface{}, error) {
 
 	return nil, nil
 }
+
+// EvalCountDeferComputed is an EvalNode that checks if a managed resource
+// count is computed and, if so, records the resource in the diff so that
+// its expansion is deferred to apply, when the values the count depends
+// on are known. Data resources can't be deferred and still error.
+type EvalCountDeferComputed struct {
+	Resource *config.Resource
+}
+
+func (n *EvalCountDeferComputed) Eval(ctx EvalContext) (interface{}, error) {
+	if !countComputed(n.Resource) {
+		return nil, nil
+	}
+
+	if n.Resource.Mode != config.ManagedResourceMode {
+		return (&EvalCountCheckComputed{Resource: n.Resource}).Eval(ctx)
+	}
+
+	log.Printf(
+		"[INFO] %s: count is computed, deferring expansion to apply",
+		n.Resource.Id())
+
+	diff, lock := ctx.Diff()
+	lock.Lock()
+	defer lock.Unlock()
+
+	modDiff := diff.ModuleByPath(ctx.Path())
+	if modDiff == nil {
+		modDiff = diff.AddModule(ctx.Path())
+	}
+	modDiff.AddDeferredCount(n.Resource.Id())
+
+	return nil, nil
+}
+
+// countComputed returns true if the interpolated count of the resource
+// isn't known yet.
+func countComputed(r *config.Resource) bool {
+	return r.RawCount.Value() == unknownValue()
+}
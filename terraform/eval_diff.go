@@ -3,19 +3,28 @@ package terraform
 import (
 	"fmt"
 	"log"
+	"path"
+	"sort"
 	"strings"
 
 	"github.com/hashicorp/terraform/config"
+	"github.com/hashicorp/terraform/flatmap"
 )
 
 // EvalCompareDiff is an EvalNode implementation that compares two diffs
 // and errors if the diffs are not equal.
+//
+// If Provider is set and implements ResourceProviderValueNormalizer, an
+// attribute that only one of the diffs changes is passed to its
+// DiffValuesEquivalent. A value the provider normalizes, such as a JSON
+// document with its keys in another order, can match the state once
+// applying, so the attribute isn't in the diff anymore.
 type EvalCompareDiff struct {
 	Info     *InstanceInfo
 	One, Two **InstanceDiff
+	Provider *ResourceProvider
 }
 
-// TODO: test
 func (n *EvalCompareDiff) Eval(ctx EvalContext) (interface{}, error) {
 	one, two := *n.One, *n.Two
 
@@ -41,7 +50,24 @@ func (n *EvalCompareDiff) Eval(ctx EvalContext) (interface{}, error) {
 		}
 	}()
 
-	if same, reason := one.Same(two); !same {
+	var equivalent func(k, planned, applied string) bool
+	if n.Provider != nil {
+		if p, ok := (*n.Provider).(ResourceProviderValueNormalizer); ok {
+			equivalent = func(k, planned, applied string) bool {
+				if !p.DiffValuesEquivalent(n.Info, k, planned, applied) {
+					return false
+				}
+
+				log.Printf(
+					"[DEBUG] %s: %q changed during apply, but the provider "+
+						"considers the values equivalent", n.Info.Id, k)
+				return true
+			}
+		}
+	}
+
+	same, reason := one.same(two, equivalent)
+	if !same {
 		log.Printf("[ERROR] %s: diffs didn't match", n.Info.Id)
 		log.Printf("[ERROR] %s: reason: %s", n.Info.Id, reason)
 		log.Printf("[ERROR] %s: diff one: %#v", n.Info.Id, one)
@@ -89,6 +115,12 @@ func (n *EvalDiff) Eval(ctx EvalContext) (interface{}, error) {
 	config := *n.Config
 	provider := *n.Provider
 
+	// A value set for an attribute that only the provider sets would be
+	// ignored, or changed back with every plan
+	if err := n.checkComputedOnly(provider, config); err != nil {
+		return nil, err
+	}
+
 	// Call pre-diff hook
 	err := ctx.Hook(func(h Hook) (HookAction, error) {
 		return h.PreDiff(n.Info, state)
@@ -97,21 +129,62 @@ func (n *EvalDiff) Eval(ctx EvalContext) (interface{}, error) {
 		return nil, err
 	}
 
-	// The state for the diff must never be nil
+	// Check if a change to another resource, or the user, forces us to
+	// be replaced
+	replaceTriggered := n.replaceTriggered(ctx, state)
+	replaceForced := n.replaceForced(ctx, state)
+	triggered := replaceTriggered || replaceForced
+
+	// Get the attributes the user forces into the diff. A replacement
+	// already has every attribute in its diff.
+	var forced []string
+	if !triggered {
+		forced = n.forcedAttributes(ctx, state)
+	}
+
+	// The state for the diff must never be nil. If we're being replaced,
+	// diff against an empty state so the diff contains every attribute
+	// the same as it would for a provider-requested replacement. Forced
+	// attributes are left out of the state, so that the provider diffs
+	// them as new values, including whether they require a new resource.
 	diffState := state
-	if diffState == nil {
+	if diffState == nil || triggered {
 		diffState = new(InstanceState)
+	} else if len(forced) > 0 {
+		diffState = state.DeepCopy()
+		for k := range diffState.Attributes {
+			if forcedAttributeMatch(k, forced) {
+				delete(diffState.Attributes, k)
+			}
+		}
 	}
 	diffState.init()
 
-	// Diff!
-	diff, err := provider.Diff(n.Info, diffState, config)
+	// Diff! A diff the provider computed for the same config and state
+	// before is reused if there is a cache.
+	cache := ctx.DiffCache()
+	diff := cache.get(n.Info, config, diffState)
+	if diff == nil {
+		diff, err = provider.Diff(n.Info, diffState, config)
+		if err != nil {
+			return nil, err
+		}
+		if diff == nil {
+			diff = new(InstanceDiff)
+		}
+
+		cache.put(n.Info, config, diffState, diff)
+	}
+	n.markUnknownComputed(diff)
+	if len(forced) > 0 {
+		n.forceAttributes(diff, state, forced)
+	}
+
+	// The provider can adjust the diff beyond what Diff does
+	diff, err = n.planModify(provider, diffState, config, diff)
 	if err != nil {
 		return nil, err
 	}
-	if diff == nil {
-		diff = new(InstanceDiff)
-	}
 
 	// Set DestroyDeposed if we have deposed instances
 	_, err = readInstanceFromState(ctx, n.Name, nil, func(rs *ResourceState) (*InstanceState, error) {
@@ -130,6 +203,28 @@ func (n *EvalDiff) Eval(ctx EvalContext) (interface{}, error) {
 		diff.SetTainted((*n.Diff).GetDestroyTainted())
 	}
 
+	// A tainted resource must always be replaced, even if the provider
+	// didn't mark the diff as tainted itself.
+	if state != nil && state.Tainted {
+		diff.SetTainted(true)
+	}
+
+	// If we're replaced because of replace_triggered_by or a forced
+	// replacement, the diff was computed as a create, so fill in the old
+	// values and require new.
+	if triggered {
+		for k, ad := range diff.CopyAttributes() {
+			ad.Old = state.Attributes[k]
+		}
+
+		diff.SetAttribute("id", &ResourceAttrDiff{
+			Old:         state.Attributes["id"],
+			NewComputed: true,
+			RequiresNew: true,
+			Type:        DiffAttrOutput,
+		})
+	}
+
 	// Require a destroy if there is an ID and it requires new.
 	if diff.RequiresNew() && state != nil && state.ID != "" {
 		diff.SetDestroy(true)
@@ -152,13 +247,39 @@ func (n *EvalDiff) Eval(ctx EvalContext) (interface{}, error) {
 		})
 	}
 
-	if err := n.processIgnoreChanges(diff); err != nil {
-		return nil, err
+	// A triggered replacement must not be undone by ignore_changes
+	if !triggered {
+		if err := n.processIgnoreChanges(diff); err != nil {
+			return nil, err
+		}
+
+		if err := n.checkPreventReplace(state, diff); err != nil {
+			return nil, err
+		}
+
+		if err := n.filterAttributes(ctx, state, diff); err != nil {
+			return nil, err
+		}
+	}
+
+	// Say why each attribute changed, for the resource as a whole first
+	var reasons []DiffReason
+	if diff.GetDestroyTainted() {
+		reasons = append(reasons, DiffReasonTainted)
 	}
+	if replaceTriggered {
+		reasons = append(reasons, DiffReasonReplaceTriggered)
+	}
+	if replaceForced {
+		reasons = append(reasons, DiffReasonForced)
+	}
+	n.setReasons(ctx, diff, state, forced, reasons)
+
+	log.Printf("[DEBUG] %s: planned action: %s", n.Info.Id, diff.Action())
 
 	// Call post-refresh hook
 	err = ctx.Hook(func(h Hook) (HookAction, error) {
-		return h.PostDiff(n.Info, diff)
+		return h.PostDiff(n.Info, diff.redactSensitive())
 	})
 	if err != nil {
 		return nil, err
@@ -180,6 +301,393 @@ func (n *EvalDiff) Eval(ctx EvalContext) (interface{}, error) {
 	return nil, nil
 }
 
+// checkPreventReplace returns an error if the resource has prevent_replace
+// set and the diff would replace the existing resource. Only replacements
+// the provider requires are prevented: creating the resource, a tainted
+// resource and a replacement that's asked for with replace_triggered_by or
+// by the user are all allowed.
+func (n *EvalDiff) checkPreventReplace(state *InstanceState, diff *InstanceDiff) error {
+	if n.Resource == nil || !n.Resource.Lifecycle.PreventReplace {
+		return nil
+	}
+	if state == nil || state.ID == "" || state.Tainted {
+		return nil
+	}
+
+	var attrs []string
+	for k, ad := range diff.CopyAttributes() {
+		// The ID is always marked as requiring new when it's replaced
+		if k != "id" && ad.RequiresNew {
+			attrs = append(attrs, k)
+		}
+	}
+	if len(attrs) == 0 {
+		return nil
+	}
+	sort.Strings(attrs)
+
+	return fmt.Errorf(preventReplaceErrStr, n.Info.Id, strings.Join(attrs, ", "))
+}
+
+// checkComputedOnly returns an error if the configuration sets attributes
+// that the schema of the resource type marks as computed-only. Nothing is
+// checked if the provider doesn't report the schema.
+func (n *EvalDiff) checkComputedOnly(provider ResourceProvider, c *ResourceConfig) error {
+	if c == nil {
+		return nil
+	}
+
+	schema := providerResourceSchema(provider, n.Info.Type)
+	if schema == nil {
+		return nil
+	}
+
+	attrs := schema.ComputedOnlyAttributes(c.Raw)
+	if len(attrs) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf(
+		"%s: the configuration sets %s, which only the provider sets. "+
+			"Remove it from the configuration.",
+		n.Info.Id, strings.Join(attrs, ", "))
+}
+
+const preventReplaceErrStr = `%s: the plan would replace this resource because of changes to: %s. It currently has lifecycle.prevent_replace set to true. To avoid this error and continue with the plan, either revert the changes, disable lifecycle.prevent_replace or taint the resource to replace it explicitly.`
+
+// setReasons sets the reasons of the attribute diffs. Every attribute gets
+// the given reasons of the resource as a whole, and the forced attributes
+// DiffReasonForced. A value that differs between the state from before the
+// refresh and the refreshed one drifted, and a value that differs between
+// the former and the diff is changed by the configuration.
+//
+// The ID of a replacement has the reasons of the attributes that require
+// the replacement.
+func (n *EvalDiff) setReasons(
+	ctx EvalContext, diff *InstanceDiff, state *InstanceState,
+	forced []string, reasons []DiffReason) {
+	var prior *InstanceState
+	var priorKnown bool
+	if r, ok := ctx.(unrefreshedStateReader); ok && n.Name != "" {
+		prior, priorKnown = r.unrefreshedInstance(n.Name)
+	}
+
+	attrs := diff.CopyAttributes()
+	exists := state != nil && state.ID != ""
+	for k, ad := range attrs {
+		if ad == nil || k == "id" {
+			continue
+		}
+
+		ad.Reasons = nil
+		ad.addReasons(reasons...)
+		if forcedAttributeMatch(k, forced) {
+			ad.addReasons(DiffReasonForced)
+		}
+		if !exists {
+			ad.addReasons(DiffReasonConfig)
+			continue
+		}
+
+		old, oldOk := state.Attributes[k]
+		base, baseOk := old, oldOk
+		if priorKnown {
+			base, baseOk = "", false
+			if prior != nil {
+				base, baseOk = prior.Attributes[k]
+			}
+			if base != old || baseOk != oldOk {
+				ad.addReasons(DiffReasonDrift)
+			}
+		}
+
+		switch {
+		case ad.NewRemoved:
+			if baseOk {
+				ad.addReasons(DiffReasonConfig)
+			}
+		case ad.NewComputed || ad.New != base:
+			ad.addReasons(DiffReasonConfig)
+		}
+	}
+
+	ad := attrs["id"]
+	if ad == nil {
+		return
+	}
+	ad.Reasons = nil
+	ad.addReasons(reasons...)
+	for k, other := range attrs {
+		if k != "id" && other != nil && other.RequiresNew {
+			ad.addReasons(other.Reasons...)
+		}
+	}
+	if len(ad.Reasons) == 0 {
+		ad.addReasons(DiffReasonConfig)
+	}
+}
+
+// planModify returns the diff as modified by the provider, if it
+// implements ResourceProviderPlanModifier. The modified diff is rejected
+// if it changes a value the configuration sets or destroys the resource.
+func (n *EvalDiff) planModify(
+	provider ResourceProvider, state *InstanceState,
+	c *ResourceConfig, diff *InstanceDiff) (*InstanceDiff, error) {
+	m, ok := provider.(ResourceProviderPlanModifier)
+	if !ok {
+		return diff, nil
+	}
+
+	// The provider gets a copy, so that the original can be checked
+	// against
+	modified, err := m.PlanModify(n.Info, state, c, diff.DeepCopy())
+	if err != nil {
+		return nil, err
+	}
+	if modified == nil {
+		return diff, nil
+	}
+
+	if modified.GetDestroy() || modified.GetDestroyTainted() || modified.GetDestroyDeposed() {
+		return nil, fmt.Errorf(
+			"%s: the provider's plan modification destroys the resource. "+
+				"This is a bug in the provider: it must mark attributes as "+
+				"requiring a new resource instead.", n.Info.Id)
+	}
+	if keys := planModifyChangedConfig(c, diff, modified); len(keys) > 0 {
+		return nil, fmt.Errorf(
+			"%s: the provider's plan modification changes values set in the "+
+				"configuration: %s. This is a bug in the provider.",
+			n.Info.Id, strings.Join(keys, ", "))
+	}
+
+	n.markUnknownComputed(modified)
+	return modified, nil
+}
+
+// planModifyChangedConfig returns the sorted keys of the values set in the
+// configuration whose diff the plan modification changed. A value that
+// wasn't in the original diff because it's unchanged can only be added
+// with the configured value.
+func planModifyChangedConfig(c *ResourceConfig, original, modified *InstanceDiff) []string {
+	if c == nil {
+		return nil
+	}
+
+	originalAttrs := original.CopyAttributes()
+	modifiedAttrs := modified.CopyAttributes()
+
+	var result []string
+	for k, v := range flatmap.Flatten(c.Config) {
+		if v == config.UnknownVariableValue {
+			continue
+		}
+
+		o, m := originalAttrs[k], modifiedAttrs[k]
+		switch {
+		case o == nil && m == nil:
+			continue
+		case o == nil:
+			if !m.NewComputed && !m.NewRemoved && m.New == v {
+				continue
+			}
+		case m != nil:
+			if m.New == o.New && m.NewComputed == o.NewComputed && m.NewRemoved == o.NewRemoved {
+				continue
+			}
+		}
+
+		result = append(result, k)
+	}
+	sort.Strings(result)
+
+	return result
+}
+
+// markUnknownComputed marks the attributes of the diff that are set to
+// the unknown value as computed. The unknown value is what a value that
+// depends on a computed attribute interpolates to, and a provider that
+// copies config values into its diff as they are passes it on as the new
+// value. The value is only known after apply, and writing the placeholder
+// itself would fail the apply.
+func (n *EvalDiff) markUnknownComputed(diff *InstanceDiff) {
+	for k, ad := range diff.CopyAttributes() {
+		if ad == nil || ad.New != config.UnknownVariableValue {
+			continue
+		}
+
+		log.Printf("[DEBUG] %s: %q is unknown, marking it computed", n.Info.Id, k)
+		ad.New = ""
+		ad.NewComputed = true
+	}
+}
+
+// replaceTriggered returns true if the existing resource must be replaced
+// because a resource referenced by its replace_triggered_by has a planned
+// change. The planned diffs of the referenced resources are always
+// written before ours since they're references of this resource.
+func (n *EvalDiff) replaceTriggered(ctx EvalContext, state *InstanceState) bool {
+	if n.Resource == nil || len(n.Resource.Lifecycle.ReplaceTriggeredBy) == 0 {
+		return false
+	}
+
+	// If we don't exist yet, there is nothing to replace
+	if state == nil || state.ID == "" {
+		return false
+	}
+
+	diff, lock := ctx.Diff()
+	lock.RLock()
+	defer lock.RUnlock()
+
+	modDiff := diff.ModuleByPath(ctx.Path())
+	if modDiff == nil {
+		return false
+	}
+
+	for _, v := range n.Resource.Lifecycle.ReplaceTriggeredBy {
+		id, attr, err := config.ParseReplaceTrigger(v)
+		if err != nil {
+			// Validation catches this
+			continue
+		}
+
+		for k, rd := range modDiff.Resources {
+			if k != id && !strings.HasPrefix(k, id+".") {
+				continue
+			}
+
+			if replaceTriggeredByDiff(rd, attr) {
+				log.Printf(
+					"[DEBUG] %s: replacement triggered by change to %s",
+					n.Info.Id, v)
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// replaceForced returns true if the existing resource must be replaced
+// because the user asked for a full replacement of it.
+func (n *EvalDiff) replaceForced(ctx EvalContext, state *InstanceState) bool {
+	// If we don't exist yet, we're already diffed as a create
+	if state == nil || state.ID == "" {
+		return false
+	}
+
+	addr, err := parseResourceAddressInternal(n.Name)
+	if err != nil {
+		return false
+	}
+	addr.Path = ctx.Path()[1:]
+
+	if !ctx.ForceReplace(addr) {
+		return false
+	}
+
+	log.Printf("[DEBUG] %s: replacement forced", n.Info.Id)
+	return true
+}
+
+// forcedAttributes returns the attributes the user forces into the diff
+// of an existing resource.
+func (n *EvalDiff) forcedAttributes(ctx EvalContext, state *InstanceState) []string {
+	// If we don't exist yet, every attribute is already in the diff
+	if state == nil || state.ID == "" {
+		return nil
+	}
+
+	// The diff during apply has no name, but the ID is the same
+	name := n.Name
+	if name == "" {
+		name = n.Info.Id
+	}
+
+	addr, err := parseResourceAddressInternal(name)
+	if err != nil {
+		return nil
+	}
+	addr.Path = ctx.Path()[1:]
+
+	return ctx.ForceAttributes(addr)
+}
+
+// forceAttributes puts the old values back into the diff of the forced
+// attributes, which were diffed against a state without them. A forced
+// attribute the provider didn't diff at all is added with its value in
+// the state, so that it's still sent to the provider again.
+func (n *EvalDiff) forceAttributes(diff *InstanceDiff, state *InstanceState, forced []string) {
+	attrs := diff.CopyAttributes()
+	for k, ad := range attrs {
+		if forcedAttributeMatch(k, forced) {
+			ad.Old = state.Attributes[k]
+		}
+	}
+
+	for _, f := range forced {
+		found := false
+		for k := range attrs {
+			if forcedAttributeMatch(k, []string{f}) {
+				found = true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+
+		for k, v := range state.Attributes {
+			if forcedAttributeMatch(k, []string{f}) {
+				diff.SetAttribute(k, &ResourceAttrDiff{Old: v, New: v})
+				found = true
+			}
+		}
+		if !found {
+			log.Printf("[WARN] %s: forced attribute %q is not set, ignoring it", n.Info.Id, f)
+			continue
+		}
+
+		log.Printf("[DEBUG] %s: forced attribute %q into the diff", n.Info.Id, f)
+	}
+}
+
+// forcedAttributeMatch returns true if the flatmapped attribute k is one
+// of the forced attributes, or is nested in one of them.
+func forcedAttributeMatch(k string, forced []string) bool {
+	for _, f := range forced {
+		if k == f || strings.HasPrefix(k, f+".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// replaceTriggeredByDiff returns true if the given diff changes the
+// attribute, or the resource itself if the attribute is empty.
+func replaceTriggeredByDiff(d *InstanceDiff, attr string) bool {
+	if d.ChangeType() == DiffNone {
+		return false
+	}
+	if attr == "" {
+		return true
+	}
+
+	for k, ad := range d.CopyAttributes() {
+		if k != attr && !strings.HasPrefix(k, attr+".") {
+			continue
+		}
+
+		if ad.NewComputed || ad.NewRemoved || ad.Old != ad.New {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (n *EvalDiff) processIgnoreChanges(diff *InstanceDiff) error {
 	if diff == nil || n.Resource == nil || n.Resource.Id() == "" {
 		return nil
@@ -207,7 +715,7 @@ func (n *EvalDiff) processIgnoreChanges(diff *InstanceDiff) error {
 	ignorableAttrKeys := make(map[string]bool)
 	for _, ignoredKey := range ignoreChanges {
 		for k := range diff.CopyAttributes() {
-			if ignoredKey == "*" || strings.HasPrefix(k, ignoredKey) {
+			if ignoreChangesMatch(ignoredKey, k) {
 				ignorableAttrKeys[k] = true
 			}
 		}
@@ -266,20 +774,166 @@ func (n *EvalDiff) processIgnoreChanges(diff *InstanceDiff) error {
 	return nil
 }
 
+// ignoreChangesMatch returns true if the ignore_changes entry ignored
+// matches the diff attribute key k. Entries are dotted attribute paths,
+// such as "ebs_block_device.0.volume_size", and match the attribute with
+// that key along with everything nested below it. Ignoring a whole block
+// such as "ebs_block_device" ignores all of its attributes, including its
+// count. Indexes can also be written as "ebs_block_device[0]".
+func ignoreChangesMatch(ignored, k string) bool {
+	if ignored == "*" {
+		return true
+	}
+
+	ignored = ignoreChangesPathReplacer.Replace(ignored)
+	return k == ignored || strings.HasPrefix(k, ignored+".")
+}
+
+// ignoreChangesPathReplacer turns the indexes of an ignore_changes entry
+// into the dotted form used by the diff attribute keys.
+var ignoreChangesPathReplacer = strings.NewReplacer("[", ".", "]", "")
+
+// filterAttributes removes the changes to the attributes that don't match
+// ContextOpts.AttributeFilter from the diff of an update in place. The
+// diffs of creates and replacements are kept whole, since the provider
+// needs every attribute then, but the replacement must be required by an
+// attribute that matches.
+func (n *EvalDiff) filterAttributes(
+	ctx EvalContext, state *InstanceState, diff *InstanceDiff) error {
+	patterns := ctx.AttributeFilter()
+	if len(patterns) == 0 || state == nil || state.ID == "" {
+		return nil
+	}
+
+	// A tainted resource must be replaced regardless
+	if diff.GetDestroyTainted() {
+		return nil
+	}
+
+	attrs := diff.CopyAttributes()
+	if diff.RequiresNew() {
+		for k, ad := range attrs {
+			if k == "id" || !ad.RequiresNew || attributeFilterMatch(k, patterns) {
+				continue
+			}
+
+			return fmt.Errorf(
+				"%s: the attribute filter leaves out %q, which requires the "+
+					"resource to be replaced. Add it to the filter, or plan "+
+					"without the filter.",
+				n.Info.Id, k)
+		}
+
+		return nil
+	}
+
+	kept := make(map[string]bool)
+	for k := range attrs {
+		kept[k] = attributeFilterMatch(k, patterns)
+	}
+
+	// A changed count of a block or map must be kept along with any of
+	// its attributes, or the state wouldn't be consistent with them.
+	for k := range attrs {
+		if kept[k] || (!strings.HasSuffix(k, ".#") && !strings.HasSuffix(k, ".%")) {
+			continue
+		}
+
+		prefix := k[:len(k)-1]
+		for kk := range attrs {
+			if kept[kk] && strings.HasPrefix(kk, prefix) {
+				return fmt.Errorf(
+					"%s: the attribute filter keeps %q but leaves out %q, the "+
+						"count of its block. Filter the whole block, such as %q.",
+					n.Info.Id, kk, k, prefix+"*")
+			}
+		}
+	}
+
+	for k := range attrs {
+		if !kept[k] {
+			log.Printf("[DEBUG] %s: attribute filter leaves out: %s", n.Info.Id, k)
+			diff.DelAttribute(k)
+		}
+	}
+
+	return nil
+}
+
+// attributeFilterMatch returns true if the diff attribute key k or one of
+// the blocks it's nested in matches one of the glob patterns.
+func attributeFilterMatch(k string, patterns []string) bool {
+	parts := strings.Split(k, ".")
+	for i := len(parts); i > 0; i-- {
+		prefix := strings.Join(parts[:i], ".")
+		for _, p := range patterns {
+			if ok, _ := path.Match(p, prefix); ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// EvalResourceUnchanged is an EvalNode implementation that calls the
+// ResourceUnchanged hook if the resource exists and its diff is empty.
+type EvalResourceUnchanged struct {
+	Info  *InstanceInfo
+	State **InstanceState
+	Diff  **InstanceDiff
+}
+
+func (n *EvalResourceUnchanged) Eval(ctx EvalContext) (interface{}, error) {
+	state := *n.State
+	if state == nil || state.ID == "" || !(*n.Diff).Empty() {
+		return nil, nil
+	}
+
+	err := ctx.Hook(func(h Hook) (HookAction, error) {
+		return h.ResourceUnchanged(n.Info)
+	})
+	return nil, err
+}
+
 // EvalDiffDestroy is an EvalNode implementation that returns a plain
 // destroy diff.
 type EvalDiffDestroy struct {
 	Info   *InstanceInfo
 	State  **InstanceState
 	Output **InstanceDiff
+
+	// Name, if set, is the name of the resource in the state. Any deposed
+	// instances of the resource are then destroyed along with it, even if
+	// there is no primary instance left, so they can't linger forever
+	// after a create_before_destroy that was interrupted.
+	Name string
 }
 
 // TODO: test
 func (n *EvalDiffDestroy) Eval(ctx EvalContext) (interface{}, error) {
 	state := *n.State
 
+	var deposed bool
+	if n.Name != "" {
+		_, err := readInstanceFromState(ctx, n.Name, nil, func(rs *ResourceState) (*InstanceState, error) {
+			deposed = len(rs.Deposed) > 0
+			return nil, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// If there is no state or we don't have an ID, we're already destroyed
+	// unless there are deposed instances left behind.
 	if state == nil || state.ID == "" {
+		if !deposed {
+			return nil, nil
+		}
+
+		log.Printf("[DEBUG] %s: destroying leftover deposed instances", n.Info.Id)
+		*n.Output = &InstanceDiff{DestroyDeposed: true}
 		return nil, nil
 	}
 
@@ -292,11 +946,11 @@ func (n *EvalDiffDestroy) Eval(ctx EvalContext) (interface{}, error) {
 	}
 
 	// The diff
-	diff := &InstanceDiff{Destroy: true}
+	diff := &InstanceDiff{Destroy: true, DestroyDeposed: deposed}
 
 	// Call post-diff hook
 	err = ctx.Hook(func(h Hook) (HookAction, error) {
-		return h.PostDiff(n.Info, diff)
+		return h.PostDiff(n.Info, diff.redactSensitive())
 	})
 	if err != nil {
 		return nil, err
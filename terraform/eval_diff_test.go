@@ -2,7 +2,11 @@ package terraform
 
 import (
 	"reflect"
+	"sort"
+	"strings"
 	"testing"
+
+	"github.com/hashicorp/terraform/config"
 )
 
 func TestEvalFilterDiff(t *testing.T) {
@@ -76,3 +80,552 @@ func TestEvalFilterDiff(t *testing.T) {
 		}
 	}
 }
+
+func TestEvalCompareDiff(t *testing.T) {
+	ctx := new(MockEvalContext)
+	info := &InstanceInfo{Id: "aws_instance.foo"}
+
+	cases := []struct {
+		Name string
+		One  *InstanceDiff
+		Two  *InstanceDiff
+		Err  bool
+	}{
+		{
+			"apply same",
+			&InstanceDiff{
+				Attributes: map[string]*ResourceAttrDiff{
+					"foo": &ResourceAttrDiff{Old: "bar", New: "baz"},
+				},
+			},
+			&InstanceDiff{
+				Attributes: map[string]*ResourceAttrDiff{
+					"foo": &ResourceAttrDiff{Old: "bar", New: "baz"},
+				},
+			},
+			false,
+		},
+		{
+			"apply changed",
+			&InstanceDiff{
+				Attributes: map[string]*ResourceAttrDiff{
+					"foo": &ResourceAttrDiff{Old: "bar", New: "baz"},
+				},
+			},
+			&InstanceDiff{
+				Attributes: map[string]*ResourceAttrDiff{
+					"foo": &ResourceAttrDiff{Old: "bar", New: "baz"},
+					"bar": &ResourceAttrDiff{Old: "", New: "qux"},
+				},
+			},
+			true,
+		},
+		{
+			"destroy same",
+			&InstanceDiff{Destroy: true},
+			&InstanceDiff{Destroy: true},
+			false,
+		},
+		{
+			"destroy changed",
+			&InstanceDiff{Destroy: true},
+			&InstanceDiff{
+				Attributes: map[string]*ResourceAttrDiff{
+					"foo": &ResourceAttrDiff{Old: "bar", New: "baz"},
+				},
+			},
+			true,
+		},
+		{
+			"destroy already gone",
+			&InstanceDiff{Destroy: true},
+			nil,
+			true,
+		},
+	}
+
+	for _, tc := range cases {
+		one, two := tc.One, tc.Two
+		node := &EvalCompareDiff{
+			Info: info,
+			One:  &one,
+			Two:  &two,
+		}
+
+		_, err := node.Eval(ctx)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s: err: %s", tc.Name, err)
+		}
+		if err != nil && !strings.Contains(err.Error(), "diffs didn't match") {
+			t.Fatalf("%s: bad error: %s", tc.Name, err)
+		}
+	}
+}
+
+// The error for diffs that don't match must not depend on the order of
+// the attribute maps.
+func TestEvalCompareDiff_stableError(t *testing.T) {
+	ctx := new(MockEvalContext)
+	info := &InstanceInfo{Id: "aws_instance.foo"}
+
+	var expected string
+	for i := 0; i < 10; i++ {
+		one := &InstanceDiff{
+			Attributes: map[string]*ResourceAttrDiff{
+				"list.#": &ResourceAttrDiff{Old: "0", New: "2"},
+				"list.0": &ResourceAttrDiff{New: "a"},
+			},
+		}
+		two := &InstanceDiff{
+			Attributes: map[string]*ResourceAttrDiff{
+				"list.#":  &ResourceAttrDiff{Old: "0", New: "11"},
+				"list.0":  &ResourceAttrDiff{New: "a"},
+				"list.10": &ResourceAttrDiff{New: "k"},
+				"list.2":  &ResourceAttrDiff{New: "c"},
+				"list.1":  &ResourceAttrDiff{New: "b"},
+			},
+		}
+
+		node := &EvalCompareDiff{
+			Info: info,
+			One:  &one,
+			Two:  &two,
+		}
+
+		_, err := node.Eval(ctx)
+		if err == nil {
+			t.Fatal("should error")
+		}
+		if !strings.Contains(err.Error(), "extra attributes: list.1, list.2, list.10") {
+			t.Fatalf("bad: %s", err)
+		}
+
+		if i == 0 {
+			expected = err.Error()
+		} else if err.Error() != expected {
+			t.Fatalf("bad:\n\n%s\n\nexpected:\n\n%s", err, expected)
+		}
+	}
+}
+
+func TestEvalCompareDiff_values(t *testing.T) {
+	ctx := new(MockEvalContext)
+	info := &InstanceInfo{Id: "aws_instance.foo"}
+
+	fold := func(info *InstanceInfo, k, old, new string) bool {
+		return strings.EqualFold(old, new)
+	}
+
+	cases := []struct {
+		Name   string
+		One    map[string]*ResourceAttrDiff
+		Two    map[string]*ResourceAttrDiff
+		Equiv  func(*InstanceInfo, string, string, string) bool
+		Reason string
+	}{
+		{
+			"changed value",
+			map[string]*ResourceAttrDiff{
+				"name": &ResourceAttrDiff{New: "Foo"},
+			},
+			map[string]*ResourceAttrDiff{
+				"name": &ResourceAttrDiff{New: "foo"},
+			},
+			nil,
+			"",
+		},
+		{
+			"unchanged during apply",
+			map[string]*ResourceAttrDiff{
+				"name": &ResourceAttrDiff{Old: "foo", New: "Foo"},
+			},
+			map[string]*ResourceAttrDiff{},
+			nil,
+			"attribute mismatch: name",
+		},
+		{
+			"equivalent when unchanged during apply",
+			map[string]*ResourceAttrDiff{
+				"name": &ResourceAttrDiff{Old: "foo", New: "Foo"},
+			},
+			map[string]*ResourceAttrDiff{},
+			fold,
+			"",
+		},
+		{
+			"not equivalent when unchanged during apply",
+			map[string]*ResourceAttrDiff{
+				"name": &ResourceAttrDiff{Old: "foo", New: "bar"},
+			},
+			map[string]*ResourceAttrDiff{},
+			fold,
+			"attribute mismatch: name",
+		},
+		{
+			"changed during apply",
+			map[string]*ResourceAttrDiff{},
+			map[string]*ResourceAttrDiff{
+				"name": &ResourceAttrDiff{Old: "foo", New: "Foo"},
+			},
+			nil,
+			"extra attributes: name",
+		},
+		{
+			"equivalent when changed during apply",
+			map[string]*ResourceAttrDiff{},
+			map[string]*ResourceAttrDiff{
+				"name": &ResourceAttrDiff{Old: "foo", New: "Foo"},
+			},
+			fold,
+			"",
+		},
+		{
+			"not equivalent when changed during apply",
+			map[string]*ResourceAttrDiff{},
+			map[string]*ResourceAttrDiff{
+				"name": &ResourceAttrDiff{Old: "foo", New: "Foo"},
+				"tag":  &ResourceAttrDiff{Old: "foo", New: "bar"},
+			},
+			fold,
+			"extra attributes: tag",
+		},
+	}
+
+	for _, tc := range cases {
+		one := &InstanceDiff{Attributes: tc.One}
+		two := &InstanceDiff{Attributes: tc.Two}
+
+		node := &EvalCompareDiff{
+			Info: info,
+			One:  &one,
+			Two:  &two,
+		}
+		if tc.Equiv != nil {
+			var provider ResourceProvider = &MockResourceProvider{
+				DiffValuesEquivalentFn: tc.Equiv,
+			}
+			node.Provider = &provider
+		}
+
+		_, err := node.Eval(ctx)
+		if tc.Reason == "" {
+			if err != nil {
+				t.Fatalf("%s: err: %s", tc.Name, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Fatalf("%s: should error", tc.Name)
+		}
+		if !strings.Contains(err.Error(), tc.Reason) {
+			t.Fatalf("%s: bad error: %s", tc.Name, err)
+		}
+	}
+}
+
+func TestEvalDiffProcessIgnoreChanges_nested(t *testing.T) {
+	cases := map[string]struct {
+		Ignore   []string
+		Expected []string
+	}{
+		"nothing": {
+			nil,
+			[]string{
+				"ami",
+				"ami_name",
+				"ebs_block_device.#",
+				"ebs_block_device.0.device_name",
+				"ebs_block_device.0.volume_size",
+				"ebs_block_device.1.volume_size",
+			},
+		},
+
+		"nested attribute": {
+			[]string{"ebs_block_device.0.volume_size"},
+			[]string{
+				"ami",
+				"ami_name",
+				"ebs_block_device.#",
+				"ebs_block_device.0.device_name",
+				"ebs_block_device.1.volume_size",
+			},
+		},
+
+		"nested attribute with an index": {
+			[]string{"ebs_block_device[1].volume_size"},
+			[]string{
+				"ami",
+				"ami_name",
+				"ebs_block_device.#",
+				"ebs_block_device.0.device_name",
+				"ebs_block_device.0.volume_size",
+			},
+		},
+
+		"block element": {
+			[]string{"ebs_block_device[0]"},
+			[]string{
+				"ami",
+				"ami_name",
+				"ebs_block_device.#",
+				"ebs_block_device.1.volume_size",
+			},
+		},
+
+		"whole block": {
+			[]string{"ebs_block_device"},
+			[]string{
+				"ami",
+				"ami_name",
+			},
+		},
+
+		"only whole path segments": {
+			[]string{"ami", "ebs_block"},
+			[]string{
+				"ami_name",
+				"ebs_block_device.#",
+				"ebs_block_device.0.device_name",
+				"ebs_block_device.0.volume_size",
+				"ebs_block_device.1.volume_size",
+			},
+		},
+	}
+
+	for k, tc := range cases {
+		diff := &InstanceDiff{
+			Attributes: map[string]*ResourceAttrDiff{
+				"ami":                            &ResourceAttrDiff{Old: "a", New: "b"},
+				"ami_name":                       &ResourceAttrDiff{Old: "a", New: "b"},
+				"ebs_block_device.#":             &ResourceAttrDiff{Old: "1", New: "2"},
+				"ebs_block_device.0.device_name": &ResourceAttrDiff{Old: "a", New: "b"},
+				"ebs_block_device.0.volume_size": &ResourceAttrDiff{Old: "10", New: "20"},
+				"ebs_block_device.1.volume_size": &ResourceAttrDiff{Old: "", New: "20"},
+			},
+		}
+
+		n := &EvalDiff{
+			Resource: &config.Resource{
+				Name: "foo",
+				Type: "aws_instance",
+				Lifecycle: config.ResourceLifecycle{
+					IgnoreChanges: tc.Ignore,
+				},
+			},
+		}
+		if err := n.processIgnoreChanges(diff); err != nil {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+
+		var actual []string
+		for key := range diff.Attributes {
+			actual = append(actual, key)
+		}
+		sort.Strings(actual)
+
+		if !reflect.DeepEqual(actual, tc.Expected) {
+			t.Fatalf("%s: bad: %#v", k, actual)
+		}
+	}
+}
+
+func TestEvalDiffMarkUnknownComputed(t *testing.T) {
+	diff := &InstanceDiff{
+		Attributes: map[string]*ResourceAttrDiff{
+			"known":    &ResourceAttrDiff{Old: "a", New: "b"},
+			"unknown":  &ResourceAttrDiff{Old: "a", New: config.UnknownVariableValue},
+			"computed": &ResourceAttrDiff{Old: "a", NewComputed: true},
+			"list.#":   &ResourceAttrDiff{New: "2"},
+			"list.0":   &ResourceAttrDiff{New: "x"},
+			"list.1":   &ResourceAttrDiff{New: config.UnknownVariableValue},
+		},
+	}
+
+	n := &EvalDiff{Info: &InstanceInfo{Id: "aws_instance.foo"}}
+	n.markUnknownComputed(diff)
+
+	expected := map[string]*ResourceAttrDiff{
+		"known":    &ResourceAttrDiff{Old: "a", New: "b"},
+		"unknown":  &ResourceAttrDiff{Old: "a", NewComputed: true},
+		"computed": &ResourceAttrDiff{Old: "a", NewComputed: true},
+		"list.#":   &ResourceAttrDiff{New: "2"},
+		"list.0":   &ResourceAttrDiff{New: "x"},
+		"list.1":   &ResourceAttrDiff{NewComputed: true},
+	}
+	if !reflect.DeepEqual(diff.Attributes, expected) {
+		t.Fatalf("bad: %#v", diff.Attributes)
+	}
+}
+
+func TestEvalDiffForceAttributes(t *testing.T) {
+	state := &InstanceState{
+		ID: "foo",
+		Attributes: map[string]string{
+			"id":       "foo",
+			"ami":      "bar",
+			"tags.%":   "1",
+			"tags.Foo": "x",
+			"size":     "2",
+		},
+	}
+
+	// The provider diffed ami against a state without it, and didn't
+	// diff tags at all.
+	diff := &InstanceDiff{
+		Attributes: map[string]*ResourceAttrDiff{
+			"ami": &ResourceAttrDiff{Old: "", New: "bar", RequiresNew: true},
+		},
+	}
+
+	n := &EvalDiff{Info: &InstanceInfo{Id: "aws_instance.foo"}}
+	n.forceAttributes(diff, state, []string{"ami", "tags", "nope"})
+
+	expected := map[string]*ResourceAttrDiff{
+		"ami":      &ResourceAttrDiff{Old: "bar", New: "bar", RequiresNew: true},
+		"tags.%":   &ResourceAttrDiff{Old: "1", New: "1"},
+		"tags.Foo": &ResourceAttrDiff{Old: "x", New: "x"},
+	}
+	if !reflect.DeepEqual(diff.Attributes, expected) {
+		t.Fatalf("bad: %#v", diff.Attributes)
+	}
+}
+
+func TestEvalDiffCheckPreventReplace(t *testing.T) {
+	cases := map[string]struct {
+		PreventReplace bool
+		State          *InstanceState
+		Attrs          map[string]*ResourceAttrDiff
+		Err            string
+	}{
+		"replace": {
+			PreventReplace: true,
+			State:          &InstanceState{ID: "foo"},
+			Attrs: map[string]*ResourceAttrDiff{
+				"id":  &ResourceAttrDiff{Old: "foo", NewComputed: true, RequiresNew: true},
+				"ami": &ResourceAttrDiff{Old: "a", New: "b", RequiresNew: true},
+				"az":  &ResourceAttrDiff{Old: "a", New: "b", RequiresNew: true},
+				"tag": &ResourceAttrDiff{Old: "a", New: "b"},
+			},
+			Err: "because of changes to: ami, az.",
+		},
+
+		"not set": {
+			PreventReplace: false,
+			State:          &InstanceState{ID: "foo"},
+			Attrs: map[string]*ResourceAttrDiff{
+				"ami": &ResourceAttrDiff{Old: "a", New: "b", RequiresNew: true},
+			},
+		},
+
+		"update": {
+			PreventReplace: true,
+			State:          &InstanceState{ID: "foo"},
+			Attrs: map[string]*ResourceAttrDiff{
+				"tag": &ResourceAttrDiff{Old: "a", New: "b"},
+			},
+		},
+
+		"tainted": {
+			PreventReplace: true,
+			State:          &InstanceState{ID: "foo", Tainted: true},
+			Attrs: map[string]*ResourceAttrDiff{
+				"ami": &ResourceAttrDiff{Old: "a", New: "b", RequiresNew: true},
+			},
+		},
+
+		"create": {
+			PreventReplace: true,
+			State:          nil,
+			Attrs: map[string]*ResourceAttrDiff{
+				"id":  &ResourceAttrDiff{NewComputed: true, RequiresNew: true},
+				"ami": &ResourceAttrDiff{New: "b", RequiresNew: true},
+			},
+		},
+	}
+
+	for k, tc := range cases {
+		n := &EvalDiff{
+			Info: &InstanceInfo{Id: "aws_instance.foo"},
+			Resource: &config.Resource{
+				Name: "foo",
+				Type: "aws_instance",
+				Lifecycle: config.ResourceLifecycle{
+					PreventReplace: tc.PreventReplace,
+				},
+			},
+		}
+
+		err := n.checkPreventReplace(tc.State, &InstanceDiff{Attributes: tc.Attrs})
+		if tc.Err == "" {
+			if err != nil {
+				t.Fatalf("%s: err: %s", k, err)
+			}
+			continue
+		}
+
+		if err == nil || !strings.Contains(err.Error(), tc.Err) {
+			t.Fatalf("%s: bad: %s", k, err)
+		}
+	}
+}
+
+func TestEvalResourceUnchanged(t *testing.T) {
+	cases := map[string]struct {
+		State  *InstanceState
+		Diff   *InstanceDiff
+		Called bool
+	}{
+		"unchanged": {
+			&InstanceState{ID: "foo"},
+			nil,
+			true,
+		},
+		"empty diff": {
+			&InstanceState{ID: "foo"},
+			new(InstanceDiff),
+			true,
+		},
+		"changed": {
+			&InstanceState{ID: "foo"},
+			&InstanceDiff{
+				Attributes: map[string]*ResourceAttrDiff{
+					"foo": &ResourceAttrDiff{Old: "bar", New: "baz"},
+				},
+			},
+			false,
+		},
+		"destroyed": {
+			&InstanceState{ID: "foo"},
+			&InstanceDiff{Destroy: true},
+			false,
+		},
+		"not created": {
+			nil,
+			nil,
+			false,
+		},
+	}
+
+	for k, tc := range cases {
+		h := new(MockHook)
+		ctx := &MockEvalContext{HookHook: h}
+		info := &InstanceInfo{Id: "aws_instance.foo"}
+
+		state, diff := tc.State, tc.Diff
+		node := &EvalResourceUnchanged{
+			Info:  info,
+			State: &state,
+			Diff:  &diff,
+		}
+		if _, err := node.Eval(ctx); err != nil {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+
+		if h.ResourceUnchangedCalled != tc.Called {
+			t.Fatalf("%s: expected called to be %t", k, tc.Called)
+		}
+		if tc.Called && h.ResourceUnchangedInfo != info {
+			t.Fatalf("%s: bad: %#v", k, h.ResourceUnchangedInfo)
+		}
+	}
+}
@@ -29,10 +29,9 @@ func (n *EvalImportState) Eval(ctx EvalContext) (interface{}, error) {
 	}
 
 	// Import!
-	state, err := provider.ImportState(n.Info, n.Id)
+	state, err := importStateWithID(provider, n.Info, n.Id)
 	if err != nil {
-		return nil, fmt.Errorf(
-			"import %s (id: %s): %s", n.Info.HumanId(), n.Id, err)
+		return nil, err
 	}
 
 	if n.Output != nil {
@@ -52,6 +51,47 @@ func (n *EvalImportState) Eval(ctx EvalContext) (interface{}, error) {
 	return nil, nil
 }
 
+// importStateWithID imports the resource with the given ID from the
+// provider. If the provider implements ResourceProviderImportIDParser, the
+// attributes the ID holds are added to the state of the resource itself,
+// which is the first with its type.
+func importStateWithID(
+	provider ResourceProvider, info *InstanceInfo, id string) ([]*InstanceState, error) {
+	var attrs map[string]string
+	if p, ok := provider.(ResourceProviderImportIDParser); ok {
+		var err error
+		attrs, err = p.ParseImportID(info, id)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"import %s (id: %s): %s", info.HumanId(), id, err)
+		}
+	}
+
+	states, err := provider.ImportState(info, id)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"import %s (id: %s): %s", info.HumanId(), id, err)
+	}
+
+	if len(attrs) > 0 {
+		for _, s := range states {
+			if s == nil || s.Ephemeral.Type != info.Type {
+				continue
+			}
+
+			s.init()
+			for k, v := range attrs {
+				if _, ok := s.Attributes[k]; !ok {
+					s.Attributes[k] = v
+				}
+			}
+			break
+		}
+	}
+
+	return states, nil
+}
+
 // EvalImportStateVerify verifies the state after ImportState and
 // after the refresh to make sure it is non-nil and valid.
 type EvalImportStateVerify struct {
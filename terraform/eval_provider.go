@@ -3,6 +3,7 @@ package terraform
 import (
 	"fmt"
 
+	"github.com/hashicorp/go-version"
 	"github.com/hashicorp/terraform/config"
 )
 
@@ -84,9 +85,14 @@ func (n *EvalCloseProvider) Eval(ctx EvalContext) (interface{}, error) {
 
 // EvalGetProvider is an EvalNode implementation that retrieves an already
 // initialized provider instance for the given name.
+//
+// If PreApply is set, the provider is about to be used to apply a resource
+// and the PreApplyProvider hooks are called for it first, once per walk.
+// See EvalContext.PreApplyProvider.
 type EvalGetProvider struct {
-	Name   string
-	Output *ResourceProvider
+	Name     string
+	Output   *ResourceProvider
+	PreApply bool
 }
 
 func (n *EvalGetProvider) Eval(ctx EvalContext) (interface{}, error) {
@@ -95,6 +101,12 @@ func (n *EvalGetProvider) Eval(ctx EvalContext) (interface{}, error) {
 		return nil, fmt.Errorf("provider %s not initialized", n.Name)
 	}
 
+	if n.PreApply {
+		if err := ctx.PreApplyProvider(n.Name); err != nil {
+			return nil, err
+		}
+	}
+
 	if n.Output != nil {
 		*n.Output = result
 	}
@@ -102,6 +114,70 @@ func (n *EvalGetProvider) Eval(ctx EvalContext) (interface{}, error) {
 	return nil, nil
 }
 
+// EvalCheckProviderVersion is an EvalNode implementation that checks the
+// version of a provider against the version constraint of its
+// configuration, so an incompatible provider fails before anything is
+// applied with it.
+//
+// A provider that doesn't report its version can't be checked. This is
+// returned as a warning, or as an error if Strict is set. The warning is
+// returned as an EvalValidateError, so this must be last in a sequence.
+type EvalCheckProviderVersion struct {
+	Name       string
+	Provider   *ResourceProvider
+	Constraint string
+	Strict     bool
+}
+
+func (n *EvalCheckProviderVersion) Eval(ctx EvalContext) (interface{}, error) {
+	if n.Constraint == "" {
+		return nil, nil
+	}
+
+	cs, err := version.NewConstraint(n.Constraint)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"provider.%s: version %q syntax error: %s", n.Name, n.Constraint, err)
+	}
+
+	var raw string
+	if p, ok := (*n.Provider).(ResourceProviderVersioner); ok {
+		raw, err = p.ProviderVersion()
+		if err != nil {
+			return nil, fmt.Errorf(
+				"provider.%s: error getting the provider version: %s", n.Name, err)
+		}
+	}
+
+	if raw == "" {
+		msg := fmt.Sprintf(
+			"the provider doesn't report its version, so the version "+
+				"constraint %q can't be checked", n.Constraint)
+		if n.Strict {
+			return nil, fmt.Errorf("provider.%s: %s", n.Name, msg)
+		}
+
+		return nil, &EvalValidateError{Warnings: []string{msg}}
+	}
+
+	v, err := version.NewVersion(raw)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"provider.%s: the provider reported an invalid version %q: %s",
+			n.Name, raw, err)
+	}
+
+	if !cs.Check(v) {
+		return nil, fmt.Errorf(
+			"provider.%s: the provider version %s doesn't satisfy the version "+
+				"constraint %q of the configuration. Please use a version of "+
+				"the provider that satisfies it, or update the configuration.",
+			n.Name, v, n.Constraint)
+	}
+
+	return nil, nil
+}
+
 // EvalInputProvider is an EvalNode implementation that asks for input
 // for the given provider configurations.
 type EvalInputProvider struct {
@@ -1,6 +1,7 @@
 package terraform
 
 import (
+	"fmt"
 	"reflect"
 	"testing"
 )
@@ -151,3 +152,111 @@ func TestEvalGetProvider(t *testing.T) {
 		t.Fatalf("bad: %#v", ctx.ProviderName)
 	}
 }
+
+func TestEvalGetProvider_preApply(t *testing.T) {
+	var actual ResourceProvider
+	n := &EvalGetProvider{Name: "foo", Output: &actual, PreApply: true}
+	provider := &MockResourceProvider{}
+	ctx := &MockEvalContext{ProviderProvider: provider}
+	if _, err := n.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !ctx.PreApplyProviderCalled {
+		t.Fatal("should be called")
+	}
+	if ctx.PreApplyProviderName != "foo" {
+		t.Fatalf("bad: %#v", ctx.PreApplyProviderName)
+	}
+
+	ctx = &MockEvalContext{
+		ProviderProvider:      provider,
+		PreApplyProviderError: fmt.Errorf("error"),
+	}
+	if _, err := n.Eval(ctx); err == nil {
+		t.Fatal("should error")
+	}
+
+	n.PreApply = false
+	ctx = &MockEvalContext{ProviderProvider: provider}
+	if _, err := n.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if ctx.PreApplyProviderCalled {
+		t.Fatal("should not be called")
+	}
+}
+
+func TestEvalCheckProviderVersion_impl(t *testing.T) {
+	var _ EvalNode = new(EvalCheckProviderVersion)
+}
+
+func TestEvalCheckProviderVersion(t *testing.T) {
+	cases := map[string]struct {
+		Version    string
+		Constraint string
+		Strict     bool
+		Err        bool
+		Warn       bool
+	}{
+		"satisfied": {
+			"1.2.3", "~> 1.2", false, false, false,
+		},
+
+		"not satisfied": {
+			"2.0.0", "~> 1.2", false, true, false,
+		},
+
+		"no constraint": {
+			"", "", true, false, false,
+		},
+
+		"no version": {
+			"", ">= 1.0", false, false, true,
+		},
+
+		"no version strict": {
+			"", ">= 1.0", true, true, false,
+		},
+
+		"invalid version": {
+			"nope", ">= 1.0", false, true, false,
+		},
+	}
+
+	for k, tc := range cases {
+		var provider ResourceProvider = &MockResourceProvider{
+			ProviderVersionReturn: tc.Version,
+		}
+		n := &EvalCheckProviderVersion{
+			Provider:   &provider,
+			Constraint: tc.Constraint,
+			Strict:     tc.Strict,
+		}
+
+		_, err := n.Eval(&MockEvalContext{})
+		verr, warn := err.(*EvalValidateError)
+		if warn != tc.Warn {
+			t.Fatalf("%s: bad: %#v", k, err)
+		}
+		if warn && (len(verr.Warnings) != 1 || len(verr.Errors) != 0) {
+			t.Fatalf("%s: bad: %#v", k, verr)
+		}
+		if !warn && (err != nil) != tc.Err {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+	}
+}
+
+func TestEvalCheckProviderVersion_notVersioner(t *testing.T) {
+	var provider ResourceProvider = struct{ ResourceProvider }{new(MockResourceProvider)}
+	n := &EvalCheckProviderVersion{
+		Provider:   &provider,
+		Constraint: ">= 1.0",
+	}
+
+	_, err := n.Eval(&MockEvalContext{})
+	if _, ok := err.(*EvalValidateError); !ok {
+		t.Fatalf("should warn: %#v", err)
+	}
+}
@@ -61,7 +61,7 @@ func (n *EvalReadDataDiff) Eval(ctx EvalContext) (interface{}, error) {
 	}
 
 	err = ctx.Hook(func(h Hook) (HookAction, error) {
-		return h.PostDiff(n.Info, diff)
+		return h.PostDiff(n.Info, diff.redactSensitive())
 	})
 	if err != nil {
 		return nil, err
@@ -53,3 +53,60 @@ func (n *EvalRefresh) Eval(ctx EvalContext) (interface{}, error) {
 
 	return nil, nil
 }
+
+// stateInvalidator is implemented by EvalContexts that know the resource
+// states that were invalidated with Context.InvalidateState.
+type stateInvalidator interface {
+	// takeInvalidatedState returns true if the state with the given
+	// name in the module was invalidated, and removes the invalidation.
+	takeInvalidatedState(name string) (bool, error)
+
+	// setRefreshedState records the state that an invalidated state was
+	// refreshed to, so it's kept after the walk.
+	setRefreshedState(name string, state *InstanceState) error
+}
+
+// EvalRefreshInvalidated is an EvalNode implementation that refreshes the
+// state read with EvalReadState with the provider if it was invalidated
+// with Context.InvalidateState. Other states are left as they are.
+type EvalRefreshInvalidated struct {
+	Name     string
+	Provider *ResourceProvider
+	State    **InstanceState
+	Info     *InstanceInfo
+	Output   **InstanceState
+}
+
+func (n *EvalRefreshInvalidated) Eval(ctx EvalContext) (interface{}, error) {
+	inv, ok := ctx.(stateInvalidator)
+	if !ok {
+		return nil, nil
+	}
+
+	ok, err := inv.takeInvalidatedState(n.Name)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	log.Printf("[INFO] %s: state was invalidated, refreshing it", n.Info.Id)
+	state := *n.State
+	refresh := &EvalRefresh{
+		Provider: n.Provider,
+		State:    &state,
+		Info:     n.Info,
+		Output:   &state,
+	}
+	if _, err := refresh.Eval(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := inv.setRefreshedState(n.Name, state); err != nil {
+		return nil, err
+	}
+
+	if n.Output != nil {
+		*n.Output = state
+	}
+
+	return nil, nil
+}
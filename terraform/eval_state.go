@@ -1,17 +1,40 @@
 package terraform
 
-import "fmt"
+import (
+	"fmt"
+	"sync"
+	"time"
+)
 
 // EvalReadState is an EvalNode implementation that reads the
 // primary InstanceState for a specific resource out of the state.
 type EvalReadState struct {
 	Name   string
 	Output **InstanceState
+
+	// Deposed, if true, reads the deposed instance at DeposedIndex
+	// instead of the primary instance, or the last deposed instance if
+	// DeposedIndex is negative. Unlike EvalReadStateDeposed, there being
+	// no deposed instance at the index isn't an error: the result is nil.
+	Deposed      bool
+	DeposedIndex int
 }
 
 func (n *EvalReadState) Eval(ctx EvalContext) (interface{}, error) {
 	return readInstanceFromState(ctx, n.Name, n.Output, func(rs *ResourceState) (*InstanceState, error) {
-		return rs.Primary, nil
+		if !n.Deposed {
+			return rs.Primary, nil
+		}
+
+		idx := n.DeposedIndex
+		if idx < 0 {
+			idx = len(rs.Deposed) - 1
+		}
+		if idx < 0 || idx >= len(rs.Deposed) {
+			return nil, nil
+		}
+
+		return rs.Deposed[idx], nil
 	})
 }
 
@@ -52,17 +75,13 @@ func readInstanceFromState(
 	state, lock := ctx.State()
 
 	// Get a read lock so we can access this instance
-	lock.RLock()
-	defer lock.RUnlock()
-
-	// Look for the module state. If we don't have one, then it doesn't matter.
-	mod := state.ModuleByPath(ctx.Path())
-	if mod == nil {
-		return nil, nil
+	if err := lockState(ctx, lock.RLocker()); err != nil {
+		return nil, fmt.Errorf("%s: %s", resourceName, err)
 	}
+	defer lock.RUnlock()
 
 	// Look for the resource state. If we don't have one, then it is okay.
-	rs := mod.Resources[resourceName]
+	rs := lookupResourceState(ctx, state, resourceName)
 	if rs == nil {
 		return nil, nil
 	}
@@ -81,6 +100,93 @@ func readInstanceFromState(
 	return is, nil
 }
 
+// lockState acquires the lock l on the state of the context, waiting at
+// most the state lock timeout of the context. If the lock isn't acquired
+// in time an error is returned and the lock isn't held. It's still
+// acquired in the background, and released right away, so the abandoned
+// attempt doesn't leave the lock held.
+func lockState(ctx EvalContext, l sync.Locker) error {
+	timeout := ctx.StateLockTimeout()
+	if timeout <= 0 {
+		l.Lock()
+		return nil
+	}
+
+	var abandonLock sync.Mutex
+	abandoned := false
+	lockedCh := make(chan struct{})
+	go func() {
+		l.Lock()
+
+		abandonLock.Lock()
+		defer abandonLock.Unlock()
+		if abandoned {
+			l.Unlock()
+			return
+		}
+
+		close(lockedCh)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-lockedCh:
+		return nil
+	case <-timer.C:
+	}
+
+	abandonLock.Lock()
+	defer abandonLock.Unlock()
+
+	// The lock may have been acquired right as the timer fired
+	select {
+	case <-lockedCh:
+		return nil
+	default:
+	}
+
+	abandoned = true
+	return fmt.Errorf("could not acquire state lock within %s", timeout)
+}
+
+// resourceStateCacher is implemented by EvalContexts that cache the
+// resource states looked up within their module during a walk, to avoid
+// scanning the state for the module on every read.
+//
+// Entries are only valid while the module state still holds the cached
+// resource state under the same name. Resource states are modified in
+// place, so reads through a cached entry always see the latest writes.
+type resourceStateCacher interface {
+	cachedResourceState(name string) *ResourceState
+	cacheResourceState(name string, mod *ModuleState, rs *ResourceState)
+}
+
+// lookupResourceState returns the resource state with the given name in
+// the module of the context, or nil if there is none. The caller must hold
+// the state lock.
+func lookupResourceState(ctx EvalContext, state *State, name string) *ResourceState {
+	cache, ok := ctx.(resourceStateCacher)
+	if ok {
+		if rs := cache.cachedResourceState(name); rs != nil {
+			return rs
+		}
+	}
+
+	mod := state.ModuleByPath(ctx.Path())
+	if mod == nil {
+		return nil
+	}
+
+	rs := mod.Resources[name]
+	if ok && rs != nil {
+		cache.cacheResourceState(name, mod, rs)
+	}
+
+	return rs
+}
+
 // EvalRequireState is an EvalNode implementation that early exits
 // if the state doesn't have an ID.
 type EvalRequireState struct {
@@ -101,22 +207,12 @@ func (n *EvalRequireState) Eval(ctx EvalContext) (interface{}, error) {
 }
 
 // EvalUpdateStateHook is an EvalNode implementation that calls the
-// PostStateUpdate hook with the current state.
+// PostStateUpdate hook with the current state. If state updates are
+// batched, the hook is called later. See EvalContext.StateUpdated.
 type EvalUpdateStateHook struct{}
 
 func (n *EvalUpdateStateHook) Eval(ctx EvalContext) (interface{}, error) {
-	state, lock := ctx.State()
-
-	// Get a full lock. Even calling something like WriteState can modify
-	// (prune) the state, so we need the full lock.
-	lock.Lock()
-	defer lock.Unlock()
-
-	// Call the hook
-	err := ctx.Hook(func(h Hook) (HookAction, error) {
-		return h.PostStateUpdate(state)
-	})
-	if err != nil {
+	if err := ctx.StateUpdated(); err != nil {
 		return nil, err
 	}
 
@@ -131,12 +227,20 @@ type EvalWriteState struct {
 	Provider     string
 	Dependencies []string
 	State        **InstanceState
+
+	// Prior, if set, is written as the prior state of the resource. The
+	// prior state is left as is if this isn't set.
+	Prior **InstanceState
 }
 
 func (n *EvalWriteState) Eval(ctx EvalContext) (interface{}, error) {
 	return writeInstanceToState(ctx, n.Name, n.ResourceType, n.Provider, n.Dependencies,
-		func(rs *ResourceState) error {
+		func(rs *ResourceState, serial int64) error {
+			logInstanceWrite(ctx, n.Name, serial, rs.Primary, *n.State, false)
 			rs.Primary = *n.State
+			if n.Prior != nil {
+				rs.Prior = *n.Prior
+			}
 			return nil
 		},
 	)
@@ -156,10 +260,12 @@ type EvalWriteStateDeposed struct {
 
 func (n *EvalWriteStateDeposed) Eval(ctx EvalContext) (interface{}, error) {
 	return writeInstanceToState(ctx, n.Name, n.ResourceType, n.Provider, n.Dependencies,
-		func(rs *ResourceState) error {
+		func(rs *ResourceState, serial int64) error {
 			if n.Index == -1 {
+				logInstanceWrite(ctx, n.Name, serial, nil, *n.State, true)
 				rs.Deposed = append(rs.Deposed, *n.State)
 			} else {
+				logInstanceWrite(ctx, n.Name, serial, rs.Deposed[n.Index], *n.State, true)
 				rs.Deposed[n.Index] = *n.State
 			}
 			return nil
@@ -169,15 +275,16 @@ func (n *EvalWriteStateDeposed) Eval(ctx EvalContext) (interface{}, error) {
 
 // Pulls together the common tasks of the EvalWriteState nodes.  All the args
 // are passed directly down from the EvalNode along with a `writer` function
-// which is yielded the *ResourceState and is responsible for writing an
-// InstanceState to the proper field in the ResourceState.
+// which is yielded the *ResourceState and the serial of the state, and is
+// responsible for writing an InstanceState to the proper field in the
+// ResourceState.
 func writeInstanceToState(
 	ctx EvalContext,
 	resourceName string,
 	resourceType string,
 	provider string,
 	dependencies []string,
-	writerFn func(*ResourceState) error,
+	writerFn func(*ResourceState, int64) error,
 ) (*InstanceState, error) {
 	state, lock := ctx.State()
 	if state == nil {
@@ -185,7 +292,10 @@ func writeInstanceToState(
 	}
 
 	// Get a write lock so we can access this instance
-	lock.Lock()
+	if err := lockState(ctx, lock); err != nil {
+		return nil, fmt.Errorf(
+			"%s: %s, so its state wasn't saved", resourceName, err)
+	}
 	defer lock.Unlock()
 
 	// Look for the module state. If we don't have one, create it.
@@ -205,7 +315,13 @@ func writeInstanceToState(
 	rs.Dependencies = dependencies
 	rs.Provider = provider
 
-	if err := writerFn(rs); err != nil {
+	// Update the cache entry for this resource only, so that concurrent
+	// writers of other resources don't lose their cache entries.
+	if cache, ok := ctx.(resourceStateCacher); ok {
+		cache.cacheResourceState(resourceName, mod, rs)
+	}
+
+	if err := writerFn(rs, state.Serial); err != nil {
 		return nil, err
 	}
 
@@ -279,6 +395,9 @@ func (n *EvalDeposeState) Eval(ctx EvalContext) (interface{}, error) {
 	// Depose
 	rs.Deposed = append(rs.Deposed, rs.Primary)
 	rs.Primary = nil
+	if l, ok := ctx.(stateTransitionLogger); ok {
+		l.logStateTransition(n.Name, state.Serial, StateTransitionDepose, false)
+	}
 
 	return nil, nil
 }
@@ -319,6 +438,9 @@ func (n *EvalUndeposeState) Eval(ctx EvalContext) (interface{}, error) {
 	idx := len(rs.Deposed) - 1
 	rs.Primary = rs.Deposed[idx]
 	rs.Deposed[idx] = *n.State
+	if l, ok := ctx.(stateTransitionLogger); ok {
+		l.logStateTransition(n.Name, state.Serial, StateTransitionUndepose, false)
+	}
 
 	return nil, nil
 }
@@ -1,8 +1,11 @@
 package terraform
 
 import (
+	"fmt"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 )
 
 func TestEvalRequireState(t *testing.T) {
@@ -47,23 +50,15 @@ func TestEvalRequireState(t *testing.T) {
 }
 
 func TestEvalUpdateStateHook(t *testing.T) {
-	mockHook := new(MockHook)
-
 	ctx := new(MockEvalContext)
-	ctx.HookHook = mockHook
-	ctx.StateState = &State{Serial: 42}
-	ctx.StateLock = new(sync.RWMutex)
 
 	node := &EvalUpdateStateHook{}
 	if _, err := node.Eval(ctx); err != nil {
 		t.Fatalf("err: %s", err)
 	}
 
-	if !mockHook.PostStateUpdateCalled {
-		t.Fatal("should call PostStateUpdate")
-	}
-	if mockHook.PostStateUpdateState.Serial != 42 {
-		t.Fatalf("bad: %#v", mockHook.PostStateUpdateState)
+	if !ctx.StateUpdatedCalled {
+		t.Fatal("should call StateUpdated")
 	}
 }
 
@@ -136,6 +131,75 @@ func TestEvalReadState(t *testing.T) {
 	}
 }
 
+func TestEvalReadState_deposedIndex(t *testing.T) {
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.bar": &ResourceState{
+						Primary: &InstanceState{ID: "i-abc123"},
+					},
+				},
+			},
+		},
+	}
+
+	ctx := new(MockEvalContext)
+	ctx.StateState = state
+	ctx.StateLock = new(sync.RWMutex)
+	ctx.PathPath = rootModulePath
+
+	// Depose two instances, creating a new primary instance each time
+	for _, id := range []string{"i-bcd234", "i-cde345"} {
+		if _, err := (&EvalDeposeState{Name: "aws_instance.bar"}).Eval(ctx); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		state.RootModule().Resources["aws_instance.bar"].Primary = &InstanceState{ID: id}
+	}
+
+	cases := map[string]struct {
+		Deposed  bool
+		Index    int
+		Expected string
+	}{
+		"primary":       {false, 0, "i-cde345"},
+		"first":         {true, 0, "i-abc123"},
+		"second":        {true, 1, "i-bcd234"},
+		"last":          {true, -1, "i-bcd234"},
+		"not deposed":   {true, 2, ""},
+		"index ignored": {false, 5, "i-cde345"},
+	}
+
+	for k, tc := range cases {
+		// Start with a value so we can tell nil was written
+		output := &InstanceState{ID: "bad"}
+		node := &EvalReadState{
+			Name:         "aws_instance.bar",
+			Output:       &output,
+			Deposed:      tc.Deposed,
+			DeposedIndex: tc.Index,
+		}
+
+		result, err := node.Eval(ctx)
+		if err != nil {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+
+		if tc.Expected == "" {
+			if result.(*InstanceState) != nil || output != nil {
+				t.Fatalf("%s: should be nil: %#v, %#v", k, result, output)
+			}
+			continue
+		}
+
+		if result.(*InstanceState).ID != tc.Expected || output.ID != tc.Expected {
+			t.Fatalf("%s: bad: %#v, %#v", k, result, output)
+		}
+	}
+}
+
 func TestEvalWriteState(t *testing.T) {
 	state := &State{}
 	ctx := new(MockEvalContext)
@@ -185,3 +249,295 @@ restype.resname: (1 deposed)
   Deposed ID 1 = i-abc123
 	`)
 }
+
+func TestEvalReadState_cache(t *testing.T) {
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Primary: &InstanceState{ID: "i-abc123"},
+					},
+					"aws_instance.bar": &ResourceState{
+						Primary: &InstanceState{ID: "i-def456"},
+					},
+				},
+			},
+		},
+	}
+	ctx := &BuiltinEvalContext{
+		PathValue:  rootModulePath,
+		StateValue: state,
+		StateLock:  new(sync.RWMutex),
+	}
+
+	read := func(name string) *InstanceState {
+		var result *InstanceState
+		node := &EvalReadState{Name: name, Output: &result}
+		if _, err := node.Eval(ctx); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		return result
+	}
+	write := func(name string, is *InstanceState) {
+		node := &EvalWriteState{Name: name, State: &is}
+		if _, err := node.Eval(ctx); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	if is := read("aws_instance.foo"); is == nil || is.ID != "i-abc123" {
+		t.Fatalf("bad: %#v", is)
+	}
+	if is := read("aws_instance.bar"); is == nil || is.ID != "i-def456" {
+		t.Fatalf("bad: %#v", is)
+	}
+
+	// Reads after a write must see the new value
+	write("aws_instance.foo", &InstanceState{ID: "i-new"})
+	if is := read("aws_instance.foo"); is == nil || is.ID != "i-new" {
+		t.Fatalf("bad: %#v", is)
+	}
+
+	// Writing one resource must not invalidate the others
+	barRS := state.RootModule().Resources["aws_instance.bar"]
+	if rs := ctx.cachedResourceState("aws_instance.bar"); rs != barRS {
+		t.Fatalf("bar should still be cached: %#v", rs)
+	}
+
+	// In place modifications such as deposing are seen through the cache
+	depose := &EvalDeposeState{Name: "aws_instance.bar"}
+	if _, err := depose.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if is := read("aws_instance.bar"); is != nil {
+		t.Fatalf("bad: %#v", is)
+	}
+
+	// Replacing the resource state outside of EvalWriteState makes the
+	// cache entry stale, and the read falls back to the state.
+	state.RootModule().Resources["aws_instance.foo"] = &ResourceState{
+		Primary: &InstanceState{ID: "i-replaced"},
+	}
+	if is := read("aws_instance.foo"); is == nil || is.ID != "i-replaced" {
+		t.Fatalf("bad: %#v", is)
+	}
+
+	// New resources are found once written
+	if is := read("aws_instance.baz"); is != nil {
+		t.Fatalf("bad: %#v", is)
+	}
+	write("aws_instance.baz", &InstanceState{ID: "i-baz"})
+	if is := read("aws_instance.baz"); is == nil || is.ID != "i-baz" {
+		t.Fatalf("bad: %#v", is)
+	}
+}
+
+func TestEvalWriteState_cacheConcurrent(t *testing.T) {
+	state := &State{}
+	state.init()
+	ctx := &BuiltinEvalContext{
+		PathValue:  rootModulePath,
+		StateValue: state,
+		StateLock:  new(sync.RWMutex),
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			name := fmt.Sprintf("aws_instance.foo.%d", i)
+			for j := 0; j < 20; j++ {
+				is := &InstanceState{ID: fmt.Sprintf("%d-%d", i, j)}
+				write := &EvalWriteState{Name: name, State: &is}
+				if _, err := write.Eval(ctx); err != nil {
+					t.Errorf("err: %s", err)
+					return
+				}
+
+				var result *InstanceState
+				read := &EvalReadState{Name: name, Output: &result}
+				if _, err := read.Eval(ctx); err != nil {
+					t.Errorf("err: %s", err)
+					return
+				}
+				if result == nil || result.ID != is.ID {
+					t.Errorf("bad: %#v", result)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func BenchmarkEvalReadState(b *testing.B) {
+	// 5000 resources spread across 100 modules
+	state := &State{}
+	state.init()
+	var paths [][]string
+	for i := 0; i < 100; i++ {
+		path := []string{"root", fmt.Sprintf("child%d", i)}
+		paths = append(paths, path)
+
+		mod := state.AddModule(path)
+		for j := 0; j < 50; j++ {
+			mod.Resources[fmt.Sprintf("aws_instance.foo.%d", j)] = &ResourceState{
+				Type:    "aws_instance",
+				Primary: &InstanceState{ID: fmt.Sprintf("%d", j)},
+			}
+		}
+	}
+
+	lock := new(sync.RWMutex)
+	bench := func(b *testing.B, ctxs []EvalContext) {
+		var result *InstanceState
+		for i := 0; i < b.N; i++ {
+			for _, ctx := range ctxs {
+				for j := 0; j < 50; j++ {
+					node := &EvalReadState{
+						Name:   fmt.Sprintf("aws_instance.foo.%d", j),
+						Output: &result,
+					}
+					if _, err := node.Eval(ctx); err != nil {
+						b.Fatalf("err: %s", err)
+					}
+				}
+			}
+		}
+	}
+
+	b.Run("uncached", func(b *testing.B) {
+		ctxs := make([]EvalContext, len(paths))
+		for i, p := range paths {
+			ctxs[i] = &MockEvalContext{
+				PathPath:   p,
+				StateState: state,
+				StateLock:  lock,
+			}
+		}
+
+		bench(b, ctxs)
+	})
+
+	b.Run("cached", func(b *testing.B) {
+		ctxs := make([]EvalContext, len(paths))
+		for i, p := range paths {
+			ctxs[i] = &BuiltinEvalContext{
+				PathValue:  p,
+				StateValue: state,
+				StateLock:  lock,
+			}
+		}
+
+		bench(b, ctxs)
+	})
+}
+
+func TestEvalReadState_lockTimeout(t *testing.T) {
+	lock := new(sync.RWMutex)
+	ctx := new(MockEvalContext)
+	ctx.StateState = &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.bar": &ResourceState{
+						Primary: &InstanceState{ID: "i-abc123"},
+					},
+				},
+			},
+		},
+	}
+	ctx.StateLock = lock
+	ctx.PathPath = rootModulePath
+	ctx.StateLockTimeoutValue = 10 * time.Millisecond
+
+	// Hold the lock as if the state were being persisted
+	lock.Lock()
+
+	var output *InstanceState
+	node := &EvalReadState{
+		Name:   "aws_instance.bar",
+		Output: &output,
+	}
+	_, err := node.Eval(ctx)
+	if err == nil {
+		t.Fatal("should error")
+	}
+	expected := "aws_instance.bar: could not acquire state lock within 10ms"
+	if err.Error() != expected {
+		t.Fatalf("bad: %s", err)
+	}
+	if output != nil {
+		t.Fatalf("bad: %#v", output)
+	}
+
+	// The abandoned attempt must not keep the lock once it's released
+	lock.Unlock()
+	testEvalStateLockFree(t, lock)
+
+	// The read succeeds now that the lock is free
+	if _, err := node.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if output == nil || output.ID != "i-abc123" {
+		t.Fatalf("bad: %#v", output)
+	}
+}
+
+func TestEvalWriteState_lockTimeout(t *testing.T) {
+	state := &State{}
+	lock := new(sync.RWMutex)
+	ctx := new(MockEvalContext)
+	ctx.StateState = state
+	ctx.StateLock = lock
+	ctx.PathPath = rootModulePath
+	ctx.StateLockTimeoutValue = 10 * time.Millisecond
+
+	// A reader holding the lock blocks writers
+	lock.RLock()
+
+	is := &InstanceState{ID: "i-abc123"}
+	node := &EvalWriteState{
+		Name:         "restype.resname",
+		ResourceType: "restype",
+		State:        &is,
+	}
+	_, err := node.Eval(ctx)
+	if err == nil {
+		t.Fatal("should error")
+	}
+	if !strings.Contains(err.Error(), "could not acquire state lock within 10ms") {
+		t.Fatalf("bad: %s", err)
+	}
+
+	lock.RUnlock()
+	testEvalStateLockFree(t, lock)
+
+	// Nothing was written
+	if len(state.Modules) != 0 {
+		t.Fatalf("bad: %s", state)
+	}
+}
+
+// testEvalStateLockFree fails the test if the lock can't be acquired for
+// writing soon.
+func testEvalStateLockFree(t *testing.T, lock *sync.RWMutex) {
+	lockedCh := make(chan struct{})
+	go func() {
+		lock.Lock()
+		lock.Unlock()
+		close(lockedCh)
+	}()
+
+	select {
+	case <-lockedCh:
+	case <-time.After(time.Second):
+		t.Fatal("state lock wasn't released")
+	}
+}
@@ -0,0 +1,330 @@
+package terraform
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// errTimeoutAbandoned is returned to an abandoned node that tries to start
+// the apply of its resource. Nothing sees it, since the node is detached
+// from the walk.
+var errTimeoutAbandoned = errors.New("the resource timed out before its apply started")
+
+// EvalTimeout is an EvalNode implementation that limits how long Node may
+// take to the resource timeout of the context, see
+// EvalContext.ResourceTimeout. Node is evaluated as usual if there is no
+// resource timeout.
+//
+// A Go routine can't be interrupted, so if the timeout is reached Node is
+// abandoned instead: the context it was given is stopped, and from then on
+// it is detached from the walk so anything it still does affects neither
+// the state, the diff nor the hooks. If the apply of the resource had
+// already started, the instance is tainted in the state so it's replaced
+// by the next apply, the same as an apply that times out in the provider.
+type EvalTimeout struct {
+	Name string
+	Info *InstanceInfo
+	Node EvalNode
+}
+
+func (n *EvalTimeout) Eval(ctx EvalContext) (interface{}, error) {
+	timeout := ctx.ResourceTimeout()
+	if timeout <= 0 {
+		return EvalRaw(n.Node, ctx)
+	}
+
+	type evalResult struct {
+		Output interface{}
+		Err    error
+	}
+
+	tctx := newTimeoutEvalContext(ctx)
+
+	// The channel is buffered so an abandoned node can always complete
+	resultCh := make(chan evalResult, 1)
+	go func() {
+		defer tctx.done()
+		output, err := EvalRaw(n.Node, tctx)
+		resultCh <- evalResult{Output: output, Err: err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case r := <-resultCh:
+		return r.Output, r.Err
+	case <-timer.C:
+	}
+
+	log.Printf("[ERROR] %s: timed out after %s, abandoning it", n.Info.Id, timeout)
+	err := fmt.Errorf(
+		"%s: applying took longer than the resource timeout of %s", n.Info.Id, timeout)
+	if !tctx.abandon() {
+		return nil, err
+	}
+
+	// The apply started, so whatever is in the state may not be what
+	// exists anymore. Taint it so it's replaced.
+	state, lock := ctx.State()
+	lock.Lock()
+	var is *InstanceState
+	if mod := state.ModuleByPath(ctx.Path()); mod != nil {
+		if rs := mod.Resources[n.Name]; rs != nil && rs.Primary != nil {
+			rs.Primary.Tainted = true
+			is = rs.Primary.DeepCopy()
+		}
+	}
+	lock.Unlock()
+
+	if is != nil {
+		if herr := ctx.StateUpdated(); herr != nil {
+			return nil, herr
+		}
+	}
+
+	// Let the hooks know the apply is over, since the abandoned node
+	// won't report it anymore.
+	herr := ctx.Hook(func(h Hook) (HookAction, error) {
+		return h.PostApply(n.Info, is, err)
+	})
+	if herr != nil {
+		return nil, herr
+	}
+
+	return nil, err
+}
+
+// EvalNodeFilterable impl.
+func (n *EvalTimeout) Filter(fn EvalNodeFilterFunc) {
+	n.Node = EvalFilter(n.Node, fn)
+}
+
+// timeoutEvalContext is the EvalContext that the node of an EvalTimeout
+// is evaluated with. Until the node is abandoned it passes everything
+// through to the wrapped context, including the optional interfaces of
+// the context, such as stateInvalidator, which have to be forwarded
+// explicitly.
+type timeoutEvalContext struct {
+	EvalContext
+
+	// stopCh is closed when the wrapped context is stopped or when the
+	// node is abandoned. doneCh is closed when the node completes.
+	stopCh chan struct{}
+	doneCh chan struct{}
+
+	// stateLock is the lock of the state of the walk.
+	stateLock StateLocker
+
+	l         sync.Mutex
+	abandoned bool
+	applying  bool
+	stopOnce  sync.Once
+}
+
+func newTimeoutEvalContext(ctx EvalContext) *timeoutEvalContext {
+	_, stateLock := ctx.State()
+	t := &timeoutEvalContext{
+		EvalContext: ctx,
+		stopCh:      make(chan struct{}),
+		doneCh:      make(chan struct{}),
+		stateLock:   stateLock,
+	}
+
+	go func() {
+		select {
+		case <-ctx.Stopped():
+			t.stop()
+		case <-t.doneCh:
+		}
+	}()
+
+	return t
+}
+
+// done must be called when the node completes, abandoned or not.
+func (t *timeoutEvalContext) done() {
+	close(t.doneCh)
+}
+
+// abandon detaches the node from the walk and stops it. It returns true
+// if the apply of the resource had already started.
+func (t *timeoutEvalContext) abandon() bool {
+	// The node is marked abandoned with the state lock held, so that a
+	// change the node is making to the state completes first, and the
+	// node sees it's abandoned the next time it locks the state.
+	t.stateLock.Lock()
+	t.l.Lock()
+	t.abandoned = true
+	applying := t.applying
+	t.l.Unlock()
+	t.stateLock.Unlock()
+
+	t.stop()
+	return applying
+}
+
+func (t *timeoutEvalContext) stop() {
+	t.stopOnce.Do(func() { close(t.stopCh) })
+}
+
+func (t *timeoutEvalContext) isAbandoned() bool {
+	t.l.Lock()
+	defer t.l.Unlock()
+	return t.abandoned
+}
+
+func (t *timeoutEvalContext) Stopped() <-chan struct{} {
+	return t.stopCh
+}
+
+func (t *timeoutEvalContext) Hook(fn func(Hook) (HookAction, error)) error {
+	// The lock isn't held while the hooks are called, so that a hook that
+	// hangs, such as one persisting the state, can't keep the node from
+	// being abandoned.
+	if t.isAbandoned() {
+		return nil
+	}
+
+	return t.EvalContext.Hook(fn)
+}
+
+// ApplyStarted records that the apply of the resource started, so that
+// it's tainted if it's abandoned. An abandoned node can't start it
+// anymore.
+func (t *timeoutEvalContext) ApplyStarted() error {
+	t.l.Lock()
+	defer t.l.Unlock()
+
+	if t.abandoned {
+		return errTimeoutAbandoned
+	}
+	t.applying = true
+
+	return t.EvalContext.ApplyStarted()
+}
+
+func (t *timeoutEvalContext) Diff() (*Diff, *sync.RWMutex) {
+	if t.isAbandoned() {
+		return new(Diff), new(sync.RWMutex)
+	}
+
+	return t.EvalContext.Diff()
+}
+
+func (t *timeoutEvalContext) State() (*State, StateLocker) {
+	if t.isAbandoned() {
+		return NewState(), new(sync.RWMutex)
+	}
+
+	state, lock := t.EvalContext.State()
+	return state, &timeoutStateLock{StateLocker: lock, ctx: t}
+}
+
+// StateUpdated only persists the state of the walk, so if the node is
+// abandoned right after the check it's harmless: the node can't change
+// the state anymore, see timeoutStateLock.
+func (t *timeoutEvalContext) StateUpdated() error {
+	if t.isAbandoned() {
+		return nil
+	}
+
+	return t.EvalContext.StateUpdated()
+}
+
+func (t *timeoutEvalContext) FlushStateUpdates() error {
+	if t.isAbandoned() {
+		return nil
+	}
+
+	return t.EvalContext.FlushStateUpdates()
+}
+
+// timeoutStateLock is the lock of the state of the walk that State gives
+// the node before it's abandoned. Whether it's abandoned is checked again
+// once the lock is held, since the node may still hold the state of the
+// walk. An abandoned node can still read it, but Lock blocks forever
+// instead of letting the node change it, since there's no other way to
+// stop the Go routine of the node.
+type timeoutStateLock struct {
+	StateLocker
+
+	ctx *timeoutEvalContext
+}
+
+func (l *timeoutStateLock) Lock() {
+	l.StateLocker.Lock()
+	if !l.ctx.isAbandoned() {
+		return
+	}
+
+	l.StateLocker.Unlock()
+	log.Printf("[WARN] abandoned node tried to change the state, blocking it")
+	select {}
+}
+
+// stateTransitionLogger
+func (t *timeoutEvalContext) logStateTransition(
+	name string, serial int64, action StateTransitionAction, deposed bool) {
+	l, ok := t.EvalContext.(stateTransitionLogger)
+	if !ok || t.isAbandoned() {
+		return
+	}
+
+	l.logStateTransition(name, serial, action, deposed)
+}
+
+// resourceStateCacher
+func (t *timeoutEvalContext) cachedResourceState(name string) *ResourceState {
+	cache, ok := t.EvalContext.(resourceStateCacher)
+	if !ok || t.isAbandoned() {
+		return nil
+	}
+
+	return cache.cachedResourceState(name)
+}
+
+// resourceStateCacher
+func (t *timeoutEvalContext) cacheResourceState(
+	name string, mod *ModuleState, rs *ResourceState) {
+	cache, ok := t.EvalContext.(resourceStateCacher)
+	if !ok || t.isAbandoned() {
+		return
+	}
+
+	cache.cacheResourceState(name, mod, rs)
+}
+
+// stateInvalidator
+func (t *timeoutEvalContext) takeInvalidatedState(name string) (bool, error) {
+	inv, ok := t.EvalContext.(stateInvalidator)
+	if !ok || t.isAbandoned() {
+		return false, nil
+	}
+
+	return inv.takeInvalidatedState(name)
+}
+
+// stateInvalidator
+func (t *timeoutEvalContext) setRefreshedState(
+	name string, state *InstanceState) error {
+	inv, ok := t.EvalContext.(stateInvalidator)
+	if !ok || t.isAbandoned() {
+		return nil
+	}
+
+	return inv.setRefreshedState(name, state)
+}
+
+// unrefreshedStateReader
+func (t *timeoutEvalContext) unrefreshedInstance(name string) (*InstanceState, bool) {
+	r, ok := t.EvalContext.(unrefreshedStateReader)
+	if !ok {
+		return nil, false
+	}
+
+	return r.unrefreshedInstance(name)
+}
@@ -0,0 +1,414 @@
+package terraform
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEvalTimeout_noTimeout(t *testing.T) {
+	ctx := new(MockEvalContext)
+	n := &EvalTimeout{
+		Name: "aws_instance.foo",
+		Info: &InstanceInfo{Id: "aws_instance.foo"},
+		Node: &testEvalTimeoutNode{Fn: func(EvalContext) (interface{}, error) {
+			return 42, errors.New("foo")
+		}},
+	}
+
+	result, err := n.Eval(ctx)
+	if err == nil || err.Error() != "foo" {
+		t.Fatalf("bad: %s", err)
+	}
+	if result != 42 {
+		t.Fatalf("bad: %#v", result)
+	}
+	if !ctx.ResourceTimeoutCalled {
+		t.Fatal("should call ResourceTimeout")
+	}
+}
+
+func TestEvalTimeout_completes(t *testing.T) {
+	ctx := new(MockEvalContext)
+	ctx.ResourceTimeoutValue = time.Minute
+	n := &EvalTimeout{
+		Name: "aws_instance.foo",
+		Info: &InstanceInfo{Id: "aws_instance.foo"},
+		Node: &testEvalTimeoutNode{Fn: func(EvalContext) (interface{}, error) {
+			return 42, nil
+		}},
+	}
+
+	result, err := n.Eval(ctx)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result != 42 {
+		t.Fatalf("bad: %#v", result)
+	}
+}
+
+func TestEvalTimeout_timeout(t *testing.T) {
+	cases := map[string]struct {
+		ApplyStarted bool
+		Tainted      bool
+	}{
+		"before apply": {false, false},
+		"during apply": {true, true},
+	}
+
+	for k, tc := range cases {
+		state := &State{
+			Modules: []*ModuleState{
+				&ModuleState{
+					Path: rootModulePath,
+					Resources: map[string]*ResourceState{
+						"aws_instance.foo": &ResourceState{
+							Type:    "aws_instance",
+							Primary: &InstanceState{ID: "foo"},
+						},
+					},
+				},
+			},
+		}
+
+		hook := new(MockHook)
+		ctx := new(MockEvalContext)
+		ctx.ResourceTimeoutValue = 10 * time.Millisecond
+		ctx.StoppedValue = make(chan struct{})
+		ctx.HookHook = hook
+		ctx.PathPath = rootModulePath
+		ctx.StateState = state
+		ctx.StateLock = new(sync.RWMutex)
+
+		// The node hangs until it's stopped, and then tries to delete the
+		// resource from the state.
+		releasedCh := make(chan struct{})
+		n := &EvalTimeout{
+			Name: "aws_instance.foo",
+			Info: &InstanceInfo{Id: "aws_instance.foo"},
+			Node: &testEvalTimeoutNode{Fn: func(ctx EvalContext) (interface{}, error) {
+				defer close(releasedCh)
+				if tc.ApplyStarted {
+					if err := ctx.ApplyStarted(); err != nil {
+						return nil, err
+					}
+				}
+
+				<-ctx.Stopped()
+
+				s, lock := ctx.State()
+				lock.Lock()
+				s.RootModule().Resources = nil
+				lock.Unlock()
+				return nil, ctx.StateUpdated()
+			}},
+		}
+
+		_, err := n.Eval(ctx)
+		if err == nil {
+			t.Fatalf("%s: should error", k)
+		}
+		if !strings.Contains(err.Error(), "resource timeout of 10ms") {
+			t.Fatalf("%s: bad: %s", k, err)
+		}
+
+		select {
+		case <-releasedCh:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: node should be stopped", k)
+		}
+
+		rs := state.RootModule().Resources["aws_instance.foo"]
+		if rs == nil {
+			t.Fatalf("%s: abandoned node should not modify the state", k)
+		}
+		if rs.Primary.Tainted != tc.Tainted {
+			t.Fatalf("%s: bad: %#v", k, rs.Primary)
+		}
+		if ctx.StateUpdatedCalled != tc.Tainted {
+			t.Fatalf("%s: bad: %#v", k, ctx.StateUpdatedCalled)
+		}
+		if hook.PostApplyCalled != tc.ApplyStarted {
+			t.Fatalf("%s: bad: %#v", k, hook.PostApplyCalled)
+		}
+		if tc.ApplyStarted && (hook.PostApplyError == nil || !hook.PostApplyState.Tainted) {
+			t.Fatalf("%s: bad: %s %#v", k, hook.PostApplyError, hook.PostApplyState)
+		}
+	}
+}
+
+// A node that got the state before it was abandoned can't change it
+// anymore once it is.
+func TestEvalTimeout_writeAtTimeout(t *testing.T) {
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Type:    "aws_instance",
+						Primary: &InstanceState{ID: "foo"},
+					},
+				},
+			},
+		},
+	}
+
+	ctx := new(MockEvalContext)
+	ctx.ResourceTimeoutValue = 10 * time.Millisecond
+	ctx.StoppedValue = make(chan struct{})
+	ctx.HookHook = new(MockHook)
+	ctx.PathPath = rootModulePath
+	ctx.StateState = state
+	ctx.StateLock = new(sync.RWMutex)
+
+	lockingCh := make(chan struct{})
+	lockedCh := make(chan struct{})
+	n := &EvalTimeout{
+		Name: "aws_instance.foo",
+		Info: &InstanceInfo{Id: "aws_instance.foo"},
+		Node: &testEvalTimeoutNode{Fn: func(ctx EvalContext) (interface{}, error) {
+			if err := ctx.ApplyStarted(); err != nil {
+				return nil, err
+			}
+
+			// Read the state, and then change it once it's abandoned
+			s, lock := ctx.State()
+			lock.RLock()
+			mod := s.RootModule()
+			lock.RUnlock()
+			<-ctx.Stopped()
+
+			close(lockingCh)
+			lock.Lock()
+			close(lockedCh)
+			mod.Resources = nil
+			lock.Unlock()
+			return nil, nil
+		}},
+	}
+
+	if _, err := n.Eval(ctx); err == nil {
+		t.Fatal("should error")
+	}
+
+	<-lockingCh
+	select {
+	case <-lockedCh:
+		t.Fatal("abandoned node should not lock the state")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	ctx.StateLock.RLock()
+	defer ctx.StateLock.RUnlock()
+	rs := state.RootModule().Resources["aws_instance.foo"]
+	if rs == nil || !rs.Primary.Tainted {
+		t.Fatalf("bad: %#v", rs)
+	}
+}
+
+// A hook that hangs doesn't keep the node from being abandoned, and the
+// abandoned node can't start the apply anymore.
+func TestEvalTimeout_hookHangs(t *testing.T) {
+	releaseCh := make(chan struct{})
+	ctx := new(MockEvalContext)
+	ctx.ResourceTimeoutValue = 10 * time.Millisecond
+	ctx.StoppedValue = make(chan struct{})
+	ctx.HookHook = &testEvalTimeoutHangingHook{ReleaseCh: releaseCh}
+	ctx.StateLock = new(sync.RWMutex)
+
+	startedCh := make(chan error, 1)
+	n := &EvalTimeout{
+		Name: "aws_instance.foo",
+		Info: &InstanceInfo{Id: "aws_instance.foo"},
+		Node: &testEvalTimeoutNode{Fn: func(ctx EvalContext) (interface{}, error) {
+			err := ctx.Hook(func(h Hook) (HookAction, error) {
+				return h.PostStateUpdate(nil)
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			err = ctx.ApplyStarted()
+			startedCh <- err
+			return nil, err
+		}},
+	}
+
+	resultCh := make(chan error, 1)
+	go func() {
+		_, err := n.Eval(ctx)
+		resultCh <- err
+	}()
+
+	select {
+	case err := <-resultCh:
+		if err == nil || !strings.Contains(err.Error(), "resource timeout of 10ms") {
+			t.Fatalf("bad: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("hanging hook should not block the timeout")
+	}
+
+	close(releaseCh)
+	select {
+	case err := <-startedCh:
+		if err != errTimeoutAbandoned {
+			t.Fatalf("bad: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("node should complete")
+	}
+}
+
+func TestEvalTimeout_stopped(t *testing.T) {
+	stopCh := make(chan struct{})
+	ctx := new(MockEvalContext)
+	ctx.ResourceTimeoutValue = time.Minute
+	ctx.StoppedValue = stopCh
+	n := &EvalTimeout{
+		Name: "aws_instance.foo",
+		Info: &InstanceInfo{Id: "aws_instance.foo"},
+		Node: &testEvalTimeoutNode{Fn: func(ctx EvalContext) (interface{}, error) {
+			<-ctx.Stopped()
+			return nil, errors.New("stopped")
+		}},
+	}
+
+	close(stopCh)
+	_, err := n.Eval(ctx)
+	if err == nil || err.Error() != "stopped" {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+// The optional interfaces of the wrapped context are forwarded until the
+// node is abandoned.
+func TestEvalTimeout_forwardsContext(t *testing.T) {
+	wrapped := &testEvalTimeoutStateContext{
+		Invalidated: map[string]bool{"aws_instance.foo": true},
+		Refreshed:   make(map[string]*InstanceState),
+		Cached:      make(map[string]*ResourceState),
+		Unrefreshed: map[string]*InstanceState{
+			"aws_instance.foo": &InstanceState{ID: "foo"},
+		},
+	}
+	wrapped.StateLock = new(sync.RWMutex)
+	tctx := newTimeoutEvalContext(wrapped)
+	defer tctx.done()
+
+	var ctx EvalContext = tctx
+	cache, ok := ctx.(resourceStateCacher)
+	if !ok {
+		t.Fatal("should be a resourceStateCacher")
+	}
+	inv, ok := ctx.(stateInvalidator)
+	if !ok {
+		t.Fatal("should be a stateInvalidator")
+	}
+	reader, ok := ctx.(unrefreshedStateReader)
+	if !ok {
+		t.Fatal("should be an unrefreshedStateReader")
+	}
+
+	rs := &ResourceState{Type: "aws_instance"}
+	cache.cacheResourceState("aws_instance.foo", nil, rs)
+	if actual := cache.cachedResourceState("aws_instance.foo"); actual != rs {
+		t.Fatalf("bad: %#v", actual)
+	}
+	if ok, err := inv.takeInvalidatedState("aws_instance.foo"); err != nil || !ok {
+		t.Fatalf("bad: %t %s", ok, err)
+	}
+	is := &InstanceState{ID: "foo"}
+	if err := inv.setRefreshedState("aws_instance.foo", is); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if wrapped.Refreshed["aws_instance.foo"] != is {
+		t.Fatalf("bad: %#v", wrapped.Refreshed)
+	}
+	if actual, ok := reader.unrefreshedInstance("aws_instance.foo"); !ok || actual.ID != "foo" {
+		t.Fatalf("bad: %#v %t", actual, ok)
+	}
+
+	// Once abandoned, the node can't affect the walk anymore
+	tctx.abandon()
+	wrapped.Invalidated["aws_instance.bar"] = true
+	cache.cacheResourceState("aws_instance.bar", nil, rs)
+	if len(wrapped.Cached) != 1 {
+		t.Fatalf("bad: %#v", wrapped.Cached)
+	}
+	if actual := cache.cachedResourceState("aws_instance.foo"); actual != nil {
+		t.Fatalf("bad: %#v", actual)
+	}
+	if ok, err := inv.takeInvalidatedState("aws_instance.bar"); err != nil || ok {
+		t.Fatalf("bad: %t %s", ok, err)
+	}
+	if !wrapped.Invalidated["aws_instance.bar"] {
+		t.Fatal("invalidation should be kept")
+	}
+	if err := inv.setRefreshedState("aws_instance.bar", is); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(wrapped.Refreshed) != 1 {
+		t.Fatalf("bad: %#v", wrapped.Refreshed)
+	}
+}
+
+type testEvalTimeoutNode struct {
+	Fn func(EvalContext) (interface{}, error)
+}
+
+func (n *testEvalTimeoutNode) Eval(ctx EvalContext) (interface{}, error) {
+	return n.Fn(ctx)
+}
+
+type testEvalTimeoutHangingHook struct {
+	NilHook
+
+	ReleaseCh chan struct{}
+}
+
+func (h *testEvalTimeoutHangingHook) PostStateUpdate(*State) (HookAction, error) {
+	<-h.ReleaseCh
+	return HookActionContinue, nil
+}
+
+// testEvalTimeoutStateContext implements the optional interfaces that
+// timeoutEvalContext forwards.
+type testEvalTimeoutStateContext struct {
+	MockEvalContext
+
+	Cached      map[string]*ResourceState
+	Invalidated map[string]bool
+	Refreshed   map[string]*InstanceState
+	Unrefreshed map[string]*InstanceState
+}
+
+func (c *testEvalTimeoutStateContext) cachedResourceState(name string) *ResourceState {
+	return c.Cached[name]
+}
+
+func (c *testEvalTimeoutStateContext) cacheResourceState(
+	name string, mod *ModuleState, rs *ResourceState) {
+	c.Cached[name] = rs
+}
+
+func (c *testEvalTimeoutStateContext) takeInvalidatedState(name string) (bool, error) {
+	ok := c.Invalidated[name]
+	delete(c.Invalidated, name)
+	return ok, nil
+}
+
+func (c *testEvalTimeoutStateContext) setRefreshedState(
+	name string, state *InstanceState) error {
+	c.Refreshed[name] = state
+	return nil
+}
+
+func (c *testEvalTimeoutStateContext) unrefreshedInstance(name string) (*InstanceState, bool) {
+	is, ok := c.Unrefreshed[name]
+	return is, ok
+}
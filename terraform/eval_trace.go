@@ -0,0 +1,60 @@
+package terraform
+
+// EvalTrace is an EvalNode implementation that evaluates Node in a span of
+// the tracer of the context, see EvalContext.Tracer. Node is evaluated as
+// usual if there is no tracer.
+//
+// The span is tagged with the address of the resource and its provider,
+// and is finished when Node completes, whether it fails or not. An early
+// exit isn't a failure.
+type EvalTrace struct {
+	Name     string
+	Addr     *ResourceAddress
+	Provider string
+	Node     EvalNode
+
+	// Parent is the span this span is part of, and may be nil. Output,
+	// if set, is set to the span while Node is evaluated, so that spans in
+	// Node can use it as their parent.
+	Parent *TraceSpan
+	Output *TraceSpan
+
+	// Error, if set, is where Node records its failure instead of
+	// returning it, as EvalApply does. The span fails with it if Node set
+	// it, but not if it was already set before.
+	Error *error
+}
+
+func (n *EvalTrace) Eval(ctx EvalContext) (interface{}, error) {
+	tracer := ctx.Tracer()
+	if tracer == nil {
+		return EvalRaw(n.Node, ctx)
+	}
+
+	var parent TraceSpan
+	if n.Parent != nil {
+		parent = *n.Parent
+	}
+
+	span := tracer.StartSpan(parent, n.Name, map[string]string{
+		TraceTagAddress:  n.Addr.String(),
+		TraceTagProvider: n.Provider,
+	})
+	if n.Output != nil {
+		*n.Output = span
+	}
+
+	failed := n.Error != nil && *n.Error != nil
+	output, err := EvalRaw(n.Node, ctx)
+
+	spanErr := err
+	if _, ok := err.(EvalEarlyExitError); ok {
+		spanErr = nil
+	}
+	if spanErr == nil && !failed && n.Error != nil {
+		spanErr = *n.Error
+	}
+	span.Finish(spanErr)
+
+	return output, err
+}
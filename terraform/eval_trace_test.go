@@ -0,0 +1,199 @@
+package terraform
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestEvalTrace(t *testing.T) {
+	addr, err := ParseResourceAddress("aws_instance.foo")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	testErr := errors.New("failed")
+
+	cases := map[string]struct {
+		Node     EvalNode
+		Error    error
+		Recorded bool
+		Before   error
+		SpanErr  error
+	}{
+		"success": {
+			Node: EvalNoop{},
+		},
+
+		"error": {
+			Node:    &EvalReturnError{Error: &testErr},
+			Error:   testErr,
+			SpanErr: testErr,
+		},
+
+		"early exit": {
+			Node:  &EvalReturnError{Error: &earlyExitErr},
+			Error: EvalEarlyExitError{},
+		},
+
+		"recorded error": {
+			Node:     &testEvalRecordError{Err: testErr},
+			Recorded: true,
+			SpanErr:  testErr,
+		},
+
+		"recorded error from before": {
+			Node:     EvalNoop{},
+			Recorded: true,
+			Before:   testErr,
+		},
+	}
+
+	for k, tc := range cases {
+		tracer := new(testTracer)
+		parent := tracer.StartSpan(nil, "parent", nil)
+		var span TraceSpan
+		recorded := tc.Before
+
+		n := &EvalTrace{
+			Name:     "child",
+			Addr:     addr,
+			Provider: "aws",
+			Node:     tc.Node,
+			Parent:   &parent,
+			Output:   &span,
+		}
+		if tc.Recorded {
+			n.Error = &recorded
+			if rn, ok := tc.Node.(*testEvalRecordError); ok {
+				rn.Output = &recorded
+			}
+		}
+
+		ctx := &MockEvalContext{TracerValue: tracer}
+		if _, err := EvalRaw(n, ctx); err != tc.Error {
+			t.Fatalf("%s: bad err: %#v", k, err)
+		}
+
+		child := tracer.Spans[1]
+		if span != child {
+			t.Fatalf("%s: output should be the span", k)
+		}
+		if child.Parent != parent || child.Name != "child" {
+			t.Fatalf("%s: bad: %#v", k, child)
+		}
+		if child.Tags[TraceTagAddress] != "aws_instance.foo" ||
+			child.Tags[TraceTagProvider] != "aws" {
+			t.Fatalf("%s: bad tags: %#v", k, child.Tags)
+		}
+		if child.Finished != 1 {
+			t.Fatalf("%s: finished %d times", k, child.Finished)
+		}
+		if child.Err != tc.SpanErr {
+			t.Fatalf("%s: bad span err: %#v", k, child.Err)
+		}
+	}
+}
+
+func TestEvalTrace_noTracer(t *testing.T) {
+	n := &EvalTrace{Name: "foo", Node: &EvalGetProvider{Name: "aws"}}
+
+	ctx := new(MockEvalContext)
+	ctx.ProviderProvider = testProvider("aws")
+	if _, err := n.Eval(ctx); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !ctx.TracerCalled {
+		t.Fatal("should call Tracer")
+	}
+	if !ctx.ProviderCalled {
+		t.Fatal("should evaluate the node")
+	}
+}
+
+var earlyExitErr error = EvalEarlyExitError{}
+
+// testEvalRecordError records an error in Output instead of returning it.
+type testEvalRecordError struct {
+	Err    error
+	Output *error
+}
+
+func (n *testEvalRecordError) Eval(ctx EvalContext) (interface{}, error) {
+	*n.Output = n.Err
+	return nil, nil
+}
+
+// testTracer is a Tracer that records the spans it starts.
+type testTracer struct {
+	sync.Mutex
+
+	Spans []*testSpan
+}
+
+func (t *testTracer) StartSpan(
+	parent TraceSpan, name string, tags map[string]string) TraceSpan {
+	t.Lock()
+	defer t.Unlock()
+
+	s := &testSpan{Name: name, Tags: tags}
+	if parent != nil {
+		s.Parent = parent.(*testSpan)
+	}
+	t.Spans = append(t.Spans, s)
+	return s
+}
+
+// String returns the spans started for every address, along with their
+// children in the order they were started and how they finished.
+func (t *testTracer) String() string {
+	t.Lock()
+	defer t.Unlock()
+
+	var roots []string
+	for _, s := range t.Spans {
+		if s.Parent != nil {
+			continue
+		}
+
+		var buf strings.Builder
+		buf.WriteString(s.String())
+		for _, c := range t.Spans {
+			if c.Parent == s {
+				buf.WriteString("\n  " + c.String())
+			}
+		}
+		roots = append(roots, buf.String())
+	}
+	sort.Strings(roots)
+
+	return strings.Join(roots, "\n")
+}
+
+type testSpan struct {
+	Name     string
+	Tags     map[string]string
+	Parent   *testSpan
+	Finished int
+	Err      error
+}
+
+func (s *testSpan) Finish(err error) {
+	s.Finished++
+	s.Err = err
+}
+
+func (s *testSpan) String() string {
+	result := fmt.Sprintf("%s %s (%s)",
+		s.Tags[TraceTagAddress], s.Name, s.Tags[TraceTagProvider])
+	switch {
+	case s.Finished != 1:
+		result += fmt.Sprintf(" finished %d times", s.Finished)
+	case s.Err != nil:
+		result += " error"
+	}
+
+	return result
+}
@@ -2,6 +2,7 @@ package terraform
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/hashicorp/terraform/config"
 )
@@ -113,6 +114,17 @@ type EvalValidateResource struct {
 	// IgnoreWarnings means that warnings will not be passed through. This allows
 	// "just-in-time" passes of validation to continue execution through warnings.
 	IgnoreWarnings bool
+
+	// WarningsAddr, if set with IgnoreWarnings, records the warnings that
+	// aren't passed through for the resource instance with this address,
+	// see EvalContext.ResourceWarnings.
+	WarningsAddr *ResourceAddress
+
+	// ComputedKeys, if non-nil, will be set to the sorted list of
+	// configuration keys whose values won't be known until after apply.
+	// This allows a UI to show these as "known after apply" rather than
+	// a stale value.
+	ComputedKeys *[]string
 }
 
 func (n *EvalValidateResource) Eval(ctx EvalContext) (interface{}, error) {
@@ -130,6 +142,17 @@ func (n *EvalValidateResource) Eval(ctx EvalContext) (interface{}, error) {
 		warns, errs = provider.ValidateDataSource(n.ResourceType, cfg)
 	}
 
+	if n.ComputedKeys != nil {
+		var computed []string
+		if cfg != nil && len(cfg.ComputedKeys) > 0 {
+			computed = make([]string, len(cfg.ComputedKeys))
+			copy(computed, cfg.ComputedKeys)
+			sort.Strings(computed)
+		}
+
+		*n.ComputedKeys = computed
+	}
+
 	// If the resource name doesn't match the name regular
 	// expression, show an error.
 	if !config.NameRegexp.Match([]byte(n.ResourceName)) {
@@ -138,6 +161,10 @@ func (n *EvalValidateResource) Eval(ctx EvalContext) (interface{}, error) {
 				"dashes, and underscores.", n.ResourceName))
 	}
 
+	if n.IgnoreWarnings && n.WarningsAddr != nil {
+		ctx.ResourceWarnings(n.WarningsAddr, warns)
+	}
+
 	if (len(warns) == 0 || n.IgnoreWarnings) && len(errs) == 0 {
 		return nil, nil
 	}
@@ -0,0 +1,49 @@
+package terraform
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/terraform/config"
+)
+
+// EvalValidateIgnoreChanges is an EvalNode implementation that warns about
+// the ignore_changes entries of a resource that aren't attributes of the
+// resource. Such an entry never matches anything, so it's most likely a
+// typo of the attribute that was meant to be ignored.
+//
+// This only works if the provider reports the schema of the resource
+// type. Only warnings are returned, so this must be the last node that
+// validates the resource: like any other error, they stop the rest of the
+// validation.
+type EvalValidateIgnoreChanges struct {
+	Provider *ResourceProvider
+	Resource *config.Resource
+}
+
+func (n *EvalValidateIgnoreChanges) Eval(ctx EvalContext) (interface{}, error) {
+	if len(n.Resource.Lifecycle.IgnoreChanges) == 0 {
+		return nil, nil
+	}
+
+	schema := providerResourceSchema(*n.Provider, n.Resource.Type)
+	if schema == nil {
+		return nil, nil
+	}
+
+	var warns []string
+	for _, v := range n.Resource.Lifecycle.IgnoreChanges {
+		if v == "*" || schema.HasAttribute(ignoreChangesPathReplacer.Replace(v)) {
+			continue
+		}
+
+		warns = append(warns, fmt.Sprintf(
+			"ignore_changes: %q is not an attribute of %s, so no changes "+
+				"are ignored for it", v, n.Resource.Type))
+	}
+
+	if len(warns) == 0 {
+		return nil, nil
+	}
+
+	return nil, &EvalValidateError{Warnings: warns}
+}
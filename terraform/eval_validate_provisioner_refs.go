@@ -0,0 +1,66 @@
+package terraform
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/terraform/config"
+)
+
+// EvalValidateProvisionerSelfRefs is an EvalNode implementation that
+// validates that the self variables in the provisioners and connection
+// info of a resource reference attributes the resource actually has,
+// so that a typo is caught before anything is applied.
+//
+// This only works if the provider reports the schema of the resource
+// type. References to other resources aren't checked here since the
+// graph already verifies they exist.
+type EvalValidateProvisionerSelfRefs struct {
+	Provider *ResourceProvider
+	Resource *config.Resource
+}
+
+func (n *EvalValidateProvisionerSelfRefs) Eval(ctx EvalContext) (interface{}, error) {
+	if len(n.Resource.Provisioners) == 0 {
+		return nil, nil
+	}
+
+	schema := providerResourceSchema(*n.Provider, n.Resource.Type)
+	if schema == nil {
+		return nil, nil
+	}
+
+	var errs []error
+	for i, p := range n.Resource.Provisioners {
+		for _, raw := range []*config.RawConfig{p.ConnInfo, p.RawConfig} {
+			if raw == nil {
+				continue
+			}
+
+			// Sort the variables so the errors are in a stable order
+			keys := make([]string, 0, len(raw.Variables))
+			for k := range raw.Variables {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+
+			for _, k := range keys {
+				v, ok := raw.Variables[k].(*config.SelfVariable)
+				if !ok || schema.HasAttribute(v.Field) {
+					continue
+				}
+
+				errs = append(errs, fmt.Errorf(
+					"provisioner %d (%s): %q references an attribute "+
+						"that %s doesn't have",
+					i, p.Type, k, n.Resource.Type))
+			}
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil, nil
+	}
+
+	return nil, &EvalValidateError{Errors: errs}
+}
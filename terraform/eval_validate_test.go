@@ -2,9 +2,11 @@ package terraform
 
 import (
 	"errors"
+	"reflect"
 	"strings"
 	"testing"
 
+	"github.com/hashicorp/hil/ast"
 	"github.com/hashicorp/terraform/config"
 )
 
@@ -43,6 +45,83 @@ func TestEvalValidateResource_managedResource(t *testing.T) {
 	}
 }
 
+func TestEvalValidateResource_computedKeys(t *testing.T) {
+	mp := testProvider("aws")
+	mp.ValidateResourceFn = func(rt string, c *ResourceConfig) ([]string, []error) {
+		if !c.IsComputed("ami") {
+			t.Fatal("ami should be computed")
+		}
+		return []string{"warn"}, nil
+	}
+
+	raw, err := config.NewRawConfig(map[string]interface{}{
+		"foo": "bar",
+		"id":  "${var.id}",
+		"ami": "${var.ami}",
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	unknown := ast.Variable{Type: ast.TypeUnknown, Value: unknownValue()}
+	err = raw.Interpolate(map[string]ast.Variable{
+		"var.id":  unknown,
+		"var.ami": unknown,
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	p := ResourceProvider(mp)
+	rc := NewResourceConfig(raw)
+
+	var computed []string
+	node := &EvalValidateResource{
+		Provider:       &p,
+		Config:         &rc,
+		ResourceName:   "foo",
+		ResourceType:   "aws_instance",
+		ResourceMode:   config.ManagedResourceMode,
+		IgnoreWarnings: true,
+		ComputedKeys:   &computed,
+	}
+
+	_, err = node.Eval(&MockEvalContext{})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := []string{"ami", "id"}
+	if !reflect.DeepEqual(computed, expected) {
+		t.Fatalf("bad: %#v", computed)
+	}
+}
+
+func TestEvalValidateResource_computedKeysNone(t *testing.T) {
+	mp := testProvider("aws")
+
+	p := ResourceProvider(mp)
+	rc := testResourceConfig(t, map[string]interface{}{"foo": "bar"})
+
+	computed := []string{"stale"}
+	node := &EvalValidateResource{
+		Provider:     &p,
+		Config:       &rc,
+		ResourceName: "foo",
+		ResourceType: "aws_instance",
+		ResourceMode: config.ManagedResourceMode,
+		ComputedKeys: &computed,
+	}
+
+	_, err := node.Eval(&MockEvalContext{})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(computed) != 0 {
+		t.Fatalf("bad: %#v", computed)
+	}
+}
+
 func TestEvalValidateResource_dataSource(t *testing.T) {
 	mp := testProvider("aws")
 	mp.ValidateDataSourceFn = func(rt string, c *ResourceConfig) (ws []string, es []error) {
@@ -178,3 +257,43 @@ func TestEvalValidateResource_ignoreWarnings(t *testing.T) {
 		t.Fatalf("Expected no error, got: %s", err)
 	}
 }
+
+func TestEvalValidateResource_recordWarnings(t *testing.T) {
+	mp := testProvider("aws")
+	mp.ValidateResourceFn = func(rt string, c *ResourceConfig) (ws []string, es []error) {
+		ws = append(ws, "warn")
+		return
+	}
+
+	addr, err := ParseResourceAddress("aws_instance.foo")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	p := ResourceProvider(mp)
+	rc := &ResourceConfig{}
+	node := &EvalValidateResource{
+		Provider:     &p,
+		Config:       &rc,
+		ResourceName: "foo",
+		ResourceType: "aws_instance",
+		ResourceMode: config.ManagedResourceMode,
+
+		IgnoreWarnings: true,
+		WarningsAddr:   addr,
+	}
+
+	ctx := &MockEvalContext{}
+	if _, err := node.Eval(ctx); err != nil {
+		t.Fatalf("Expected no error, got: %s", err)
+	}
+	if !ctx.ResourceWarningsCalled {
+		t.Fatal("should record the warnings")
+	}
+	if ctx.ResourceWarningsAddr != addr {
+		t.Fatalf("bad: %s", ctx.ResourceWarningsAddr)
+	}
+	if !reflect.DeepEqual(ctx.ResourceWarningsWarnings, []string{"warn"}) {
+		t.Fatalf("bad: %#v", ctx.ResourceWarningsWarnings)
+	}
+}
@@ -0,0 +1,159 @@
+package terraform
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/terraform/config"
+	"github.com/hashicorp/terraform/flatmap"
+)
+
+// EvalValuesDiff is an EvalNode implementation that diffs the attributes
+// stored for a values resource against its interpolated configuration.
+// Values resources don't have a provider: their attributes are just the
+// flattened configuration, so they are updated in place whenever it
+// changes.
+type EvalValuesDiff struct {
+	Info        *InstanceInfo
+	Config      **ResourceConfig
+	State       **InstanceState
+	OutputDiff  **InstanceDiff
+	OutputState **InstanceState
+}
+
+func (n *EvalValuesDiff) Eval(ctx EvalContext) (interface{}, error) {
+	state := *n.State
+
+	err := ctx.Hook(func(h Hook) (HookAction, error) {
+		return h.PreDiff(n.Info, state)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	diff := valuesDiff(n.Info.Id, *n.Config, state)
+
+	err = ctx.Hook(func(h Hook) (HookAction, error) {
+		return h.PostDiff(n.Info, diff)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	*n.OutputDiff = diff
+
+	// Update the state so that later resources in the plan see the values
+	// that are already known.
+	if n.OutputState != nil {
+		*n.OutputState = state
+		if !diff.Empty() {
+			*n.OutputState = valuesMergeDiff(state, diff)
+		}
+	}
+
+	return nil, nil
+}
+
+// EvalValuesApply is an EvalNode implementation that stores the attributes
+// of a values resource from its diff. A destroy diff just removes the
+// state, since there is nothing else to destroy.
+type EvalValuesApply struct {
+	Info   *InstanceInfo
+	State  **InstanceState
+	Diff   **InstanceDiff
+	Output **InstanceState
+}
+
+func (n *EvalValuesApply) Eval(ctx EvalContext) (interface{}, error) {
+	state := *n.State
+	diff := *n.Diff
+
+	if diff != nil && diff.GetDestroy() {
+		*n.Output = nil
+		return nil, nil
+	}
+
+	if diff == nil || diff.Empty() {
+		*n.Output = state
+		return nil, nil
+	}
+
+	for k, attr := range diff.CopyAttributes() {
+		if attr.NewComputed {
+			return nil, fmt.Errorf(
+				"%s: value %q is unknown after apply", n.Info.Id, k)
+		}
+	}
+
+	*n.Output = valuesMergeDiff(state, diff)
+	return nil, nil
+}
+
+// valuesDiff returns the diff from the attributes of the values resource
+// in state to the ones of its configuration. The ID is the resource's
+// state ID, and only a missing state is created rather than updated.
+func valuesDiff(id string, c *ResourceConfig, state *InstanceState) *InstanceDiff {
+	var attrs map[string]string
+	if c != nil {
+		attrs = flatmap.Flatten(c.Config)
+	} else {
+		attrs = make(map[string]string)
+	}
+	attrs["id"] = id
+
+	var old map[string]string
+	if state != nil {
+		old = state.Attributes
+	}
+
+	diff := new(InstanceDiff)
+	diff.init()
+	for k, v := range attrs {
+		o, ok := old[k]
+		if ok && o == v {
+			continue
+		}
+
+		attr := &ResourceAttrDiff{Old: o, New: v}
+		if v == config.UnknownVariableValue {
+			attr.New = ""
+			attr.NewComputed = true
+		}
+		if k == "id" && (state == nil || state.ID == "") {
+			attr.RequiresNew = true
+		}
+
+		diff.SetAttribute(k, attr)
+	}
+	for k, o := range old {
+		if _, ok := attrs[k]; !ok {
+			diff.SetAttribute(k, &ResourceAttrDiff{Old: o, NewRemoved: true})
+		}
+	}
+
+	return diff
+}
+
+// valuesMergeDiff returns a copy of the state of a values resource with
+// the diff applied. Unlike InstanceState.MergeDiff this keeps empty lists
+// and maps, since they are part of the configuration that's stored.
+func valuesMergeDiff(state *InstanceState, diff *InstanceDiff) *InstanceState {
+	result := new(InstanceState)
+	if state != nil {
+		result = state.DeepCopy()
+	}
+	result.init()
+
+	for k, attr := range diff.CopyAttributes() {
+		switch {
+		case attr.NewRemoved:
+			delete(result.Attributes, k)
+		case attr.NewComputed:
+			result.Attributes[k] = config.UnknownVariableValue
+		default:
+			result.Attributes[k] = attr.New
+		}
+	}
+	result.ID = result.Attributes["id"]
+
+	return result
+}
@@ -0,0 +1,171 @@
+package terraform
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/terraform/config"
+)
+
+func TestEvalValuesDiff_impl(t *testing.T) {
+	var _ EvalNode = new(EvalValuesDiff)
+}
+
+func TestEvalValuesDiff(t *testing.T) {
+	cases := map[string]struct {
+		Config   map[string]interface{}
+		State    *InstanceState
+		Expected map[string]*ResourceAttrDiff
+	}{
+		"create": {
+			map[string]interface{}{"name": "web"},
+			nil,
+			map[string]*ResourceAttrDiff{
+				"id":   &ResourceAttrDiff{New: "values.tags", RequiresNew: true},
+				"name": &ResourceAttrDiff{New: "web"},
+			},
+		},
+
+		"update in place": {
+			map[string]interface{}{"name": "web", "env": "dev"},
+			&InstanceState{
+				ID: "values.tags",
+				Attributes: map[string]string{
+					"id":   "values.tags",
+					"name": "web",
+					"env":  "prod",
+					"old":  "foo",
+				},
+			},
+			map[string]*ResourceAttrDiff{
+				"env": &ResourceAttrDiff{Old: "prod", New: "dev"},
+				"old": &ResourceAttrDiff{Old: "foo", NewRemoved: true},
+			},
+		},
+
+		"computed": {
+			map[string]interface{}{"name": config.UnknownVariableValue},
+			&InstanceState{
+				ID: "values.tags",
+				Attributes: map[string]string{
+					"id":   "values.tags",
+					"name": "web",
+				},
+			},
+			map[string]*ResourceAttrDiff{
+				"name": &ResourceAttrDiff{Old: "web", NewComputed: true},
+			},
+		},
+
+		"unchanged": {
+			map[string]interface{}{"list": []interface{}{"a"}},
+			&InstanceState{
+				ID: "values.tags",
+				Attributes: map[string]string{
+					"id":     "values.tags",
+					"list.#": "1",
+					"list.0": "a",
+				},
+			},
+			map[string]*ResourceAttrDiff{},
+		},
+	}
+
+	for k, tc := range cases {
+		var diff *InstanceDiff
+		var state *InstanceState
+		rc := &ResourceConfig{Config: tc.Config}
+		n := &EvalValuesDiff{
+			Info:        &InstanceInfo{Id: "values.tags", Type: "values"},
+			Config:      &rc,
+			State:       &tc.State,
+			OutputDiff:  &diff,
+			OutputState: &state,
+		}
+		if _, err := n.Eval(&MockEvalContext{}); err != nil {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+
+		if !reflect.DeepEqual(diff.Attributes, tc.Expected) {
+			t.Fatalf("%s: bad: %#v", k, diff.Attributes)
+		}
+	}
+}
+
+func TestEvalValuesApply(t *testing.T) {
+	state := &InstanceState{
+		ID: "values.tags",
+		Attributes: map[string]string{
+			"id":  "values.tags",
+			"env": "prod",
+		},
+	}
+	diff := &InstanceDiff{
+		Attributes: map[string]*ResourceAttrDiff{
+			"env":    &ResourceAttrDiff{Old: "prod", New: "dev"},
+			"list.#": &ResourceAttrDiff{Old: "", New: "0"},
+		},
+	}
+
+	var result *InstanceState
+	n := &EvalValuesApply{
+		Info:   &InstanceInfo{Id: "values.tags", Type: "values"},
+		State:  &state,
+		Diff:   &diff,
+		Output: &result,
+	}
+	if _, err := n.Eval(&MockEvalContext{}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := map[string]string{
+		"id":     "values.tags",
+		"env":    "dev",
+		"list.#": "0",
+	}
+	if result.ID != "values.tags" || !reflect.DeepEqual(result.Attributes, expected) {
+		t.Fatalf("bad: %#v", result)
+	}
+	if state.Attributes["env"] != "prod" {
+		t.Fatalf("state should not be modified: %#v", state)
+	}
+}
+
+func TestEvalValuesApply_destroy(t *testing.T) {
+	state := &InstanceState{ID: "values.tags"}
+	diff := &InstanceDiff{Destroy: true}
+
+	result := state
+	n := &EvalValuesApply{
+		Info:   &InstanceInfo{Id: "values.tags", Type: "values"},
+		State:  &state,
+		Diff:   &diff,
+		Output: &result,
+	}
+	if _, err := n.Eval(&MockEvalContext{}); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if result != nil {
+		t.Fatalf("bad: %#v", result)
+	}
+}
+
+func TestEvalValuesApply_computed(t *testing.T) {
+	var state *InstanceState
+	diff := &InstanceDiff{
+		Attributes: map[string]*ResourceAttrDiff{
+			"name": &ResourceAttrDiff{NewComputed: true},
+		},
+	}
+
+	var result *InstanceState
+	n := &EvalValuesApply{
+		Info:   &InstanceInfo{Id: "values.tags", Type: "values"},
+		State:  &state,
+		Diff:   &diff,
+		Output: &result,
+	}
+	if _, err := n.Eval(&MockEvalContext{}); err == nil {
+		t.Fatal("should error")
+	}
+}
@@ -36,6 +36,23 @@ type ApplyGraphBuilder struct {
 
 	// Validate will do structural validation of the graph.
 	Validate bool
+
+	// CoalesceProviders, if true, shares a single provider instance
+	// between the providers with an identical configuration. See
+	// CoalesceProviderTransformer.
+	CoalesceProviders bool
+
+	// StrictProviderVersions, if true, makes it an error if a provider
+	// with a version constraint doesn't report its version.
+	StrictProviderVersions bool
+
+	// Stages are the groups of resources that are applied one after the
+	// other. See ApplyStageTransformer.
+	Stages [][]*ResourceAddress
+
+	// DeferDestroys, if true, destroys resources after the creates and
+	// updates. See DeferDestroyTransformer.
+	DeferDestroys bool
 }
 
 // See GraphBuilder
@@ -53,6 +70,7 @@ func (b *ApplyGraphBuilder) Steps() []GraphTransformer {
 	concreteProvider := func(a *NodeAbstractProvider) dag.Vertex {
 		return &NodeApplyableProvider{
 			NodeAbstractProvider: a,
+			StrictVersion:        b.StrictProviderVersions,
 		}
 	}
 
@@ -72,12 +90,19 @@ func (b *ApplyGraphBuilder) Steps() []GraphTransformer {
 			State:  b.State,
 		},
 
+		// Make sure no two resources write to the same state
+		&StateIdTransformer{},
+
 		// Create orphan output nodes
 		&OrphanOutputTransformer{Module: b.Module, State: b.State},
 
 		// Attach the configuration to any resources
 		&AttachResourceConfigTransformer{Module: b.Module},
 
+		// Fail before anything is applied if the diff destroys a resource
+		// with lifecycle.prevent_destroy set
+		&PreventDestroyTransformer{Diff: b.Diff},
+
 		// Attach the state
 		&AttachStateTransformer{State: b.State},
 
@@ -87,6 +112,10 @@ func (b *ApplyGraphBuilder) Steps() []GraphTransformer {
 		&DisableProviderTransformer{},
 		&ParentProviderTransformer{},
 		&AttachProviderConfigTransformer{Module: b.Module},
+		GraphTransformIf(
+			func() bool { return b.CoalesceProviders },
+			&CoalesceProviderTransformer{},
+		),
 
 		// Destruction ordering
 		&DestroyEdgeTransformer{Module: b.Module, State: b.State},
@@ -111,6 +140,12 @@ func (b *ApplyGraphBuilder) Steps() []GraphTransformer {
 		// Connect references so ordering is correct
 		&ReferenceTransformer{},
 
+		// Gate the stages of the apply
+		&ApplyStageTransformer{Stages: b.Stages},
+
+		// Destroy after everything else is applied, if asked
+		&DeferDestroyTransformer{Enabled: b.DeferDestroys},
+
 		// Add the node to fix the state count boundaries
 		&CountBoundaryTransformer{},
 
@@ -144,6 +144,66 @@ func TestApplyGraphBuilder_doubleCBD(t *testing.T) {
 	}
 }
 
+// This tests that a resource depending on a CBD resource gets CBD
+// enabled as well, producing the same ordering as if both had CBD set.
+func TestApplyGraphBuilder_cbdDependent(t *testing.T) {
+	diff := &Diff{
+		Modules: []*ModuleDiff{
+			&ModuleDiff{
+				Path: []string{"root"},
+				Resources: map[string]*InstanceDiff{
+					"aws_instance.A": &InstanceDiff{
+						Destroy: true,
+						Attributes: map[string]*ResourceAttrDiff{
+							"name": &ResourceAttrDiff{
+								Old: "",
+								New: "foo",
+							},
+						},
+					},
+
+					"aws_instance.B": &InstanceDiff{
+						Destroy: true,
+						Attributes: map[string]*ResourceAttrDiff{
+							"name": &ResourceAttrDiff{
+								Old: "",
+								New: "foo",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	mod := testModule(t, "graph-builder-apply-cbd-dependent")
+	b := &ApplyGraphBuilder{
+		Module:        mod,
+		Diff:          diff,
+		Providers:     []string{"aws"},
+		Provisioners:  []string{"exec"},
+		DisableReduce: true,
+	}
+
+	g, err := b.Build(RootModulePath)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(g.String())
+	expected := strings.TrimSpace(testApplyGraphBuilderDoubleCBDStr)
+	if actual != expected {
+		t.Fatalf("bad: %s", actual)
+	}
+
+	// The dependent should have CBD enabled in its configuration
+	for _, r := range mod.Config().Resources {
+		if !r.Lifecycle.CreateBeforeDestroy {
+			t.Fatalf("%s should have CBD enabled", r.Id())
+		}
+	}
+}
+
 // This tests the ordering of destroying a single count of a resource.
 func TestApplyGraphBuilder_destroyCount(t *testing.T) {
 	diff := &Diff{
@@ -304,6 +364,86 @@ func TestApplyGraphBuilder_provisionerDestroy(t *testing.T) {
 		"null_resource.foo (destroy)")
 }
 
+// The destroy-time provisioners of a resource connect through a bastion
+// that is updated in the same apply, so they must run after the update.
+func TestApplyGraphBuilder_provisionerDestroyConnInfo(t *testing.T) {
+	diff := &Diff{
+		Modules: []*ModuleDiff{
+			&ModuleDiff{
+				Path: []string{"root"},
+				Resources: map[string]*InstanceDiff{
+					"aws_instance.bastion": &InstanceDiff{
+						Attributes: map[string]*ResourceAttrDiff{
+							"foo": &ResourceAttrDiff{
+								Old: "",
+								New: "bar",
+							},
+						},
+					},
+					"aws_instance.web": &InstanceDiff{
+						Destroy: true,
+					},
+				},
+			},
+		},
+	}
+
+	b := &ApplyGraphBuilder{
+		Module:       testModule(t, "graph-builder-apply-provisioner-destroy-conn-info"),
+		Diff:         diff,
+		Providers:    []string{"aws"},
+		Provisioners: []string{"exec"},
+	}
+
+	g, err := b.Build(RootModulePath)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	testGraphHappensBefore(
+		t, g,
+		"aws_instance.bastion",
+		"aws_instance.web (destroy)")
+}
+
+// A provider configured from a resource of another provider must be
+// configured after that resource is applied.
+func TestApplyGraphBuilder_providerComputed(t *testing.T) {
+	diff := &Diff{
+		Modules: []*ModuleDiff{
+			&ModuleDiff{
+				Path: []string{"root"},
+				Resources: map[string]*InstanceDiff{
+					"aws_instance.bar": &InstanceDiff{
+						Attributes: map[string]*ResourceAttrDiff{
+							"id": &ResourceAttrDiff{NewComputed: true},
+						},
+					},
+					"test_instance.foo": &InstanceDiff{
+						Attributes: map[string]*ResourceAttrDiff{
+							"value": &ResourceAttrDiff{New: "yes"},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	b := &ApplyGraphBuilder{
+		Module:    testModule(t, "apply-provider-computed"),
+		Diff:      diff,
+		Providers: []string{"aws", "test"},
+	}
+
+	g, err := b.Build(RootModulePath)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	testGraphHappensBefore(t, g, "test_instance.foo", "provider.aws")
+	testGraphHappensBefore(t, g, "provider.aws", "aws_instance.bar")
+}
+
 const testApplyGraphBuilderStr = `
 aws_instance.create
   provider.aws
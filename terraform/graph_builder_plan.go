@@ -145,6 +145,7 @@ func (b *PlanGraphBuilder) init() {
 		return &NodePlannableResource{
 			NodeAbstractCountResource: &NodeAbstractCountResource{
 				NodeAbstractResource: a,
+				DeferComputed:        true,
 			},
 		}
 	}
@@ -0,0 +1,130 @@
+package terraform
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/dag"
+)
+
+// GraphMermaid returns the given Terraform graph in the flowchart syntax
+// of Mermaid, so it can be rendered in Markdown documents.
+//
+// The vertices are labeled by their names, and the vertices of a module
+// are grouped in a subgraph for the module, nested in the subgraph of its
+// parent. Edges point from a vertex to the vertices it depends on, the
+// same as GraphDot.
+func GraphMermaid(g *Graph) (string, error) {
+	vertices := g.Vertices()
+	names := make([]string, 0, len(vertices))
+	byName := make(map[string]dag.Vertex, len(vertices))
+	for _, v := range vertices {
+		name := dag.VertexName(v)
+		if _, ok := byName[name]; ok {
+			return "", fmt.Errorf("duplicate vertex name %q", name)
+		}
+
+		names = append(names, name)
+		byName[name] = v
+	}
+	sort.Strings(names)
+
+	// Mermaid IDs can't contain most punctuation, so the vertices get an ID
+	// by their order and are labeled with their name. The module tree is
+	// built so each vertex is written in the subgraph of its module.
+	ids := make(map[dag.Vertex]int, len(names))
+	root := &mermaidModule{}
+	for i, name := range names {
+		v := byName[name]
+		ids[v] = i
+
+		path := rootModulePath
+		if sp, ok := v.(GraphNodeSubPath); ok {
+			path = normalizeModulePath(sp.Path())
+		}
+
+		m := root
+		for j := 2; j <= len(path); j++ {
+			m = m.child(path[:j])
+		}
+		m.Vertices = append(m.Vertices, v)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("graph TD\n")
+	var subgraphs int
+	root.write(&buf, ids, &subgraphs, 1)
+
+	edges := make([][2]int, 0, len(g.Edges()))
+	for _, e := range g.Edges() {
+		edges = append(edges, [2]int{ids[e.Source()], ids[e.Target()]})
+	}
+	sort.Sort(mermaidEdgeSort(edges))
+	for _, e := range edges {
+		buf.WriteString(fmt.Sprintf("    n%d --> n%d\n", e[0], e[1]))
+	}
+
+	return buf.String(), nil
+}
+
+// mermaidModule is the subgraph of a module in GraphMermaid.
+type mermaidModule struct {
+	Path     []string
+	Vertices []dag.Vertex
+	Children []*mermaidModule
+}
+
+// child returns the subgraph of the child module with the given path,
+// adding it if it doesn't exist yet.
+func (m *mermaidModule) child(path []string) *mermaidModule {
+	for _, c := range m.Children {
+		if c.Path[len(c.Path)-1] == path[len(path)-1] {
+			return c
+		}
+	}
+
+	c := &mermaidModule{Path: path}
+	m.Children = append(m.Children, c)
+	return c
+}
+
+func (m *mermaidModule) write(
+	buf *bytes.Buffer, ids map[dag.Vertex]int, subgraphs *int, depth int) {
+	indent := strings.Repeat("    ", depth)
+	for _, v := range m.Vertices {
+		buf.WriteString(fmt.Sprintf(
+			"%sn%d[\"%s\"]\n", indent, ids[v], mermaidEscape(dag.VertexName(v))))
+	}
+
+	for _, c := range m.Children {
+		id := fmt.Sprintf("s%d", *subgraphs)
+		*subgraphs++
+
+		buf.WriteString(fmt.Sprintf(
+			"%ssubgraph %s [\"%s\"]\n", indent, id, modulePrefixStr(c.Path)))
+		c.write(buf, ids, subgraphs, depth+1)
+		buf.WriteString(indent + "end\n")
+	}
+}
+
+// mermaidEscape escapes the characters of a label that Mermaid doesn't
+// allow in a quoted string.
+func mermaidEscape(s string) string {
+	return strings.NewReplacer(`"`, "#quot;").Replace(s)
+}
+
+// mermaidEdgeSort sorts the edges of GraphMermaid, given as the IDs of
+// their source and target, by source and then target.
+type mermaidEdgeSort [][2]int
+
+func (s mermaidEdgeSort) Len() int      { return len(s) }
+func (s mermaidEdgeSort) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s mermaidEdgeSort) Less(i, j int) bool {
+	if s[i][0] != s[j][0] {
+		return s[i][0] < s[j][0]
+	}
+
+	return s[i][1] < s[j][1]
+}
@@ -0,0 +1,87 @@
+package terraform
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/dag"
+)
+
+func TestGraphMermaid(t *testing.T) {
+	var g Graph
+	root := &testMermaidVertex{"root", nil}
+	provider := &testMermaidVertex{"provider.aws", nil}
+	foo := &testMermaidVertex{"aws_instance.foo", nil}
+	child := &testMermaidVertex{
+		"module.child.aws_instance.bar", []string{"root", "child"}}
+	grandchild := &testMermaidVertex{
+		"module.child.module.grandchild.aws_instance.baz",
+		[]string{"root", "child", "grandchild"}}
+	other := &testMermaidVertex{
+		`module.other.aws_instance."quoted"`, []string{"root", "other"}}
+	for _, v := range []dag.Vertex{root, provider, foo, child, grandchild, other} {
+		g.Add(v)
+	}
+
+	g.Connect(dag.BasicEdge(foo, provider))
+	g.Connect(dag.BasicEdge(child, foo))
+	g.Connect(dag.BasicEdge(child, provider))
+	g.Connect(dag.BasicEdge(grandchild, child))
+	g.Connect(dag.BasicEdge(root, grandchild))
+	g.Connect(dag.BasicEdge(root, other))
+
+	actual, err := GraphMermaid(&g)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := strings.TrimSpace(`
+graph TD
+    n0["aws_instance.foo"]
+    n4["provider.aws"]
+    n5["root"]
+    subgraph s0 ["module.child"]
+        n1["module.child.aws_instance.bar"]
+        subgraph s1 ["module.child.module.grandchild"]
+            n2["module.child.module.grandchild.aws_instance.baz"]
+        end
+    end
+    subgraph s2 ["module.other"]
+        n3["module.other.aws_instance.#quot;quoted#quot;"]
+    end
+    n0 --> n4
+    n1 --> n0
+    n1 --> n4
+    n2 --> n1
+    n5 --> n2
+    n5 --> n3
+`)
+	if strings.TrimSpace(actual) != expected {
+		t.Fatalf("bad:\n%s\n\nexpected:\n%s", actual, expected)
+	}
+}
+
+func TestGraphMermaid_empty(t *testing.T) {
+	actual, err := GraphMermaid(&Graph{})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if actual != "graph TD\n" {
+		t.Fatalf("bad: %q", actual)
+	}
+}
+
+type testMermaidVertex struct {
+	name string
+	path []string
+}
+
+func (v *testMermaidVertex) Name() string { return v.name }
+
+func (v *testMermaidVertex) Path() []string {
+	if v.path == nil {
+		return rootModulePath
+	}
+
+	return v.path
+}
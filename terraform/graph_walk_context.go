@@ -16,9 +16,10 @@ type ContextGraphWalker struct {
 	NullGraphWalker
 
 	// Configurable values
-	Context     *Context
-	Operation   walkOperation
-	StopContext context.Context
+	Context          *Context
+	Operation        walkOperation
+	StopContext      context.Context
+	InterruptContext context.Context
 
 	// Outputs, do not set these. Do not read these while the graph
 	// is being walked.
@@ -33,9 +34,14 @@ type ContextGraphWalker struct {
 	interpolaterVarLock sync.Mutex
 	providerCache       map[string]ResourceProvider
 	providerConfigCache map[string]*ResourceConfig
+	providerApplies     map[string]*providerApply
 	providerLock        sync.Mutex
 	provisionerCache    map[string]ResourceProvisioner
 	provisionerLock     sync.Mutex
+	providerSems        map[string]Semaphore
+	providerSemLock     sync.Mutex
+	stateUpdates        *stateUpdateBatch
+	resourceWarnings    *resourceWarnings
 }
 
 func (w *ContextGraphWalker) EnterPath(path []string) EvalContext {
@@ -68,6 +74,7 @@ func (w *ContextGraphWalker) EnterPath(path []string) EvalContext {
 
 	ctx := &BuiltinEvalContext{
 		StopContext:         w.StopContext,
+		InterruptContext:    w.InterruptContext,
 		PathValue:           path,
 		Hooks:               w.Context.hooks,
 		InputValue:          w.Context.uiInput,
@@ -76,6 +83,7 @@ func (w *ContextGraphWalker) EnterPath(path []string) EvalContext {
 		ProviderConfigCache: w.providerConfigCache,
 		ProviderInputConfig: w.Context.providerInputConfig,
 		ProviderLock:        &w.providerLock,
+		ProviderApplies:     w.providerApplies,
 		ProvisionerCache:    w.provisionerCache,
 		ProvisionerLock:     &w.provisionerLock,
 		DiffValue:           w.Context.diff,
@@ -92,6 +100,36 @@ func (w *ContextGraphWalker) EnterPath(path []string) EvalContext {
 		},
 		InterpolaterVars:    w.interpolaterVars,
 		InterpolaterVarLock: &w.interpolaterVarLock,
+
+		RefreshTargetsOnlyValue: w.Context.refreshTargetsOnly,
+		ReplaceValue:            w.Context.replace,
+		ForceAttributesValue:    w.Context.forceAttributes,
+		AttributeFilterValue:    w.Context.attributeFilter,
+		ResourceTimeoutValue:    w.Context.resourceTimeout,
+		TracerValue:             w.Context.tracer,
+		DiffCacheValue:          w.Context.diffCache,
+		StateInvalidations:      w.Context.stateInvalidations,
+		ManagedByValue:          w.Context.managedBy,
+		RewriteProvConfigValue:  w.Context.rewriteProvConfig,
+		ApplyProgressValue:      w.Context.applyProgress,
+		ApplyGateValue:          w.Context.applyGate,
+		StateLockTimeoutValue:   w.Context.stateLockTimeout,
+		SkipProvisionersValue:   w.Context.skipProvisioners,
+		SkipDestroyProvsValue:   w.Context.skipDestroyProvs,
+		StateUpdates:            w.stateUpdates,
+		ResourceWarningsValue:   w.resourceWarnings,
+	}
+
+	// Only the walks that change the real state log the changes to it,
+	// since plan only changes a copy.
+	switch w.Operation {
+	case walkApply, walkDestroy, walkRefresh, walkImport:
+		ctx.StateLog = w.Context.stateLog
+	}
+
+	// Only the plan annotates its diffs with what the refresh changed
+	if w.Operation == walkPlan {
+		ctx.UnrefreshedState = w.Context.unrefreshedState
 	}
 
 	w.contexts[key] = ctx
@@ -102,8 +140,14 @@ func (w *ContextGraphWalker) EnterEvalTree(v dag.Vertex, n EvalNode) EvalNode {
 	log.Printf("[TRACE] [%s] Entering eval tree: %s",
 		w.Operation, dag.VertexName(v))
 
+	// Acquire the provider semaphore first, if there is one, so that we
+	// don't hold a global slot while waiting on a busy provider.
+	if sem, ok := w.providerSem(v); ok {
+		sem.Acquire()
+	}
+
 	// Acquire a lock on the semaphore
-	w.Context.parallelSem.Acquire()
+	w.parallelSem(v).Acquire()
 
 	// We want to filter the evaluation tree to only include operations
 	// that belong in this operation.
@@ -116,7 +160,10 @@ func (w *ContextGraphWalker) ExitEvalTree(
 		w.Operation, dag.VertexName(v))
 
 	// Release the semaphore
-	w.Context.parallelSem.Release()
+	w.parallelSem(v).Release()
+	if sem, ok := w.providerSem(v); ok {
+		sem.Release()
+	}
 
 	if err == nil {
 		return nil
@@ -151,6 +198,123 @@ func (w *ContextGraphWalker) init() {
 	w.contexts = make(map[string]*BuiltinEvalContext, 5)
 	w.providerCache = make(map[string]ResourceProvider, 5)
 	w.providerConfigCache = make(map[string]*ResourceConfig, 5)
+	w.providerApplies = make(map[string]*providerApply, 5)
 	w.provisionerCache = make(map[string]ResourceProvisioner, 5)
 	w.interpolaterVars = make(map[string]map[string]interface{}, 5)
+	w.resourceWarnings = new(resourceWarnings)
+	if w.Context.batchStateUpdates {
+		w.stateUpdates = new(stateUpdateBatch)
+	}
+}
+
+// flushStateUpdates calls the PostStateUpdate hooks if there are batched
+// state updates they haven't seen yet. This must only be called once the
+// walk is done. The hooks are called even if the walk was stopped.
+func (w *ContextGraphWalker) flushStateUpdates() error {
+	if w.stateUpdates == nil {
+		return nil
+	}
+
+	// An interrupted apply may have written a resource to the state
+	// without reaching the node that reports the update, so the state is
+	// always reported at the end of an apply.
+	pending := w.stateUpdates.take()
+	if !pending && w.Operation != walkApply && w.Operation != walkDestroy {
+		return nil
+	}
+
+	w.Context.stateLock.Lock()
+	defer w.Context.stateLock.Unlock()
+
+	for _, h := range w.Context.hooks {
+		if _, err := h.PostStateUpdate(w.Context.state); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parallelSem returns the semaphore limiting the number of vertices that
+// are evaluated concurrently. Destroys during the apply and destroy walks
+// are limited separately if ContextOpts.DestroyParallelism is set.
+func (w *ContextGraphWalker) parallelSem(v dag.Vertex) Semaphore {
+	if w.Context.destroySem == nil {
+		return w.Context.parallelSem
+	}
+
+	switch w.Operation {
+	case walkApply, walkDestroy:
+	default:
+		return w.Context.parallelSem
+	}
+
+	// The destroyers include the nodes that embed NodeDestroyResource,
+	// such as the orphans of a count computed during apply
+	switch v.(type) {
+	case GraphNodeDestroyer, *graphNodeDeposedResource:
+		return w.Context.destroySem
+	default:
+		return w.Context.parallelSem
+	}
+}
+
+// providerSem returns the semaphore limiting the parallelism of the
+// provider used by the given vertex, if there is one. Limits only apply
+// to resources during the apply and destroy walks. Each module's instance
+// of a provider has its own semaphore, the same as it has its own entry
+// in the provider cache.
+func (w *ContextGraphWalker) providerSem(v dag.Vertex) (Semaphore, bool) {
+	if len(w.Context.providerParallelism) == 0 {
+		return nil, false
+	}
+
+	switch w.Operation {
+	case walkApply, walkDestroy:
+	default:
+		return nil, false
+	}
+
+	// Providers themselves consume other providers, so skip them
+	if _, ok := v.(GraphNodeProvider); ok {
+		return nil, false
+	}
+
+	pv, ok := v.(GraphNodeProviderConsumer)
+	if !ok {
+		return nil, false
+	}
+
+	provided := pv.ProvidedBy()
+	if len(provided) == 0 {
+		return nil, false
+	}
+
+	limit, ok := w.Context.providerParallelism[provided[0]]
+	if !ok {
+		return nil, false
+	}
+
+	var path []string
+	if sp, ok := v.(GraphNodeSubPath); ok {
+		path = sp.Path()
+	}
+	providerPath := make([]string, len(path)+1)
+	copy(providerPath, path)
+	providerPath[len(providerPath)-1] = provided[0]
+	key := PathCacheKey(providerPath)
+
+	w.providerSemLock.Lock()
+	defer w.providerSemLock.Unlock()
+
+	if w.providerSems == nil {
+		w.providerSems = make(map[string]Semaphore)
+	}
+	sem, ok := w.providerSems[key]
+	if !ok {
+		sem = NewSemaphore(limit)
+		w.providerSems[key] = sem
+	}
+
+	return sem, true
 }
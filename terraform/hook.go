@@ -1,5 +1,7 @@
 package terraform
 
+import "time"
+
 // HookAction is an enum of actions that can be taken as a result of a hook
 // callback. This allows you to modify the behavior of Terraform at runtime.
 type HookAction byte
@@ -27,6 +29,13 @@ type Hook interface {
 	PreApply(*InstanceInfo, *InstanceState, *InstanceDiff) (HookAction, error)
 	PostApply(*InstanceInfo, *InstanceState, error) (HookAction, error)
 
+	// ApplyElapsed is called after the provider has applied a single
+	// resource with the time the provider took. If the apply was retried,
+	// the duration is the total of all the attempts, and the last argument
+	// is the number of attempts. ApplyElapsed cannot control whether the
+	// hook continues running.
+	ApplyElapsed(*InstanceInfo, time.Duration, int)
+
 	// PreDiff and PostDiff are called before and after a single resource
 	// resource is diffed.
 	PreDiff(*InstanceInfo, *InstanceState) (HookAction, error)
@@ -57,6 +66,17 @@ type Hook interface {
 	// a single resource's state is being improted.
 	PreImportState(*InstanceInfo, string) (HookAction, error)
 	PostImportState(*InstanceInfo, []*InstanceState) (HookAction, error)
+
+	// PreApplyProvider is called once per walk for each provider, before
+	// the first resource using it is applied. It's given the path of the
+	// module and the name of the provider, and is useful to refresh the
+	// credentials of all providers at once instead of per resource.
+	PreApplyProvider([]string, string) (HookAction, error)
+
+	// ResourceUnchanged is called for a managed resource that exists and
+	// has no changes to apply, so UIs can tell it apart from a resource
+	// that wasn't considered at all.
+	ResourceUnchanged(*InstanceInfo) (HookAction, error)
 }
 
 // NilHook is a Hook implementation that does nothing. It exists only to
@@ -72,6 +92,9 @@ func (*NilHook) PostApply(*InstanceInfo, *InstanceState, error) (HookAction, err
 	return HookActionContinue, nil
 }
 
+func (*NilHook) ApplyElapsed(*InstanceInfo, time.Duration, int) {
+}
+
 func (*NilHook) PreDiff(*InstanceInfo, *InstanceState) (HookAction, error) {
 	return HookActionContinue, nil
 }
@@ -120,6 +143,14 @@ func (*NilHook) PostStateUpdate(*State) (HookAction, error) {
 	return HookActionContinue, nil
 }
 
+func (*NilHook) PreApplyProvider([]string, string) (HookAction, error) {
+	return HookActionContinue, nil
+}
+
+func (*NilHook) ResourceUnchanged(*InstanceInfo) (HookAction, error) {
+	return HookActionContinue, nil
+}
+
 // handleHook turns hook actions into panics. This lets you use the
 // panic/recover mechanism in Go as a flow control mechanism for hook
 // actions.
@@ -1,6 +1,9 @@
 package terraform
 
-import "sync"
+import (
+	"sync"
+	"time"
+)
 
 // MockHook is an implementation of Hook that can be used for tests.
 // It records all of its function calls.
@@ -22,6 +25,11 @@ type MockHook struct {
 	PostApplyReturnError error
 	PostApplyFn          func(*InstanceInfo, *InstanceState, error) (HookAction, error)
 
+	ApplyElapsedCalled   bool
+	ApplyElapsedInfo     *InstanceInfo
+	ApplyElapsedDuration time.Duration
+	ApplyElapsedAttempts int
+
 	PreDiffCalled bool
 	PreDiffInfo   *InstanceInfo
 	PreDiffState  *InstanceState
@@ -92,6 +100,17 @@ type MockHook struct {
 	PostStateUpdateState  *State
 	PostStateUpdateReturn HookAction
 	PostStateUpdateError  error
+
+	PreApplyProviderCalled bool
+	PreApplyProviderPath   []string
+	PreApplyProviderName   string
+	PreApplyProviderReturn HookAction
+	PreApplyProviderError  error
+
+	ResourceUnchangedCalled bool
+	ResourceUnchangedInfo   *InstanceInfo
+	ResourceUnchangedReturn HookAction
+	ResourceUnchangedError  error
 }
 
 func (h *MockHook) PreApply(n *InstanceInfo, s *InstanceState, d *InstanceDiff) (HookAction, error) {
@@ -121,6 +140,16 @@ func (h *MockHook) PostApply(n *InstanceInfo, s *InstanceState, e error) (HookAc
 	return h.PostApplyReturn, h.PostApplyReturnError
 }
 
+func (h *MockHook) ApplyElapsed(n *InstanceInfo, d time.Duration, attempts int) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.ApplyElapsedCalled = true
+	h.ApplyElapsedInfo = n
+	h.ApplyElapsedDuration = d
+	h.ApplyElapsedAttempts = attempts
+}
+
 func (h *MockHook) PreDiff(n *InstanceInfo, s *InstanceState) (HookAction, error) {
 	h.Lock()
 	defer h.Unlock()
@@ -243,3 +272,22 @@ func (h *MockHook) PostStateUpdate(s *State) (HookAction, error) {
 	h.PostStateUpdateState = s
 	return h.PostStateUpdateReturn, h.PostStateUpdateError
 }
+
+func (h *MockHook) PreApplyProvider(path []string, name string) (HookAction, error) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.PreApplyProviderCalled = true
+	h.PreApplyProviderPath = path
+	h.PreApplyProviderName = name
+	return h.PreApplyProviderReturn, h.PreApplyProviderError
+}
+
+func (h *MockHook) ResourceUnchanged(n *InstanceInfo) (HookAction, error) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.ResourceUnchangedCalled = true
+	h.ResourceUnchangedInfo = n
+	return h.ResourceUnchangedReturn, h.ResourceUnchangedError
+}
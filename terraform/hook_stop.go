@@ -2,6 +2,7 @@ package terraform
 
 import (
 	"sync/atomic"
+	"time"
 )
 
 // stopHook is a private Hook implementation that Terraform uses to
@@ -18,6 +19,9 @@ func (h *stopHook) PostApply(*InstanceInfo, *InstanceState, error) (HookAction,
 	return h.hook()
 }
 
+func (h *stopHook) ApplyElapsed(*InstanceInfo, time.Duration, int) {
+}
+
 func (h *stopHook) PreDiff(*InstanceInfo, *InstanceState) (HookAction, error) {
 	return h.hook()
 }
@@ -65,6 +69,14 @@ func (h *stopHook) PostStateUpdate(*State) (HookAction, error) {
 	return h.hook()
 }
 
+func (h *stopHook) PreApplyProvider([]string, string) (HookAction, error) {
+	return h.hook()
+}
+
+func (h *stopHook) ResourceUnchanged(*InstanceInfo) (HookAction, error) {
+	return h.hook()
+}
+
 func (h *stopHook) hook() (HookAction, error) {
 	if h.Stopped() {
 		return HookActionHalt, nil
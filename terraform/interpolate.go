@@ -77,6 +77,8 @@ func (i *Interpolater) Values(
 		switch v := rawV.(type) {
 		case *config.CountVariable:
 			err = i.valueCountVar(scope, n, v, result)
+		case *config.DependenciesVariable:
+			err = i.valueDependenciesVar(scope, n, v, result)
 		case *config.ModuleVariable:
 			err = i.valueModuleVar(scope, n, v, result)
 		case *config.PathVariable:
@@ -121,6 +123,54 @@ func (i *Interpolater) valueCountVar(
 	}
 }
 
+// valueDependenciesVar sets the dependencies that are written to the state
+// for the resource when it's applied. They only depend on the
+// configuration, so they're known before the resource is applied.
+func (i *Interpolater) valueDependenciesVar(
+	scope *InterpolationScope,
+	n string,
+	v *config.DependenciesVariable,
+	result map[string]ast.Variable) error {
+	path := []string{RootModuleName}
+	if scope != nil && len(scope.Path) > 0 {
+		path = normalizeModulePath(scope.Path)
+	}
+
+	mod := i.Module.Child(path[1:])
+	if mod == nil {
+		return fmt.Errorf("%s: module %s not found", n, strings.Join(path, "."))
+	}
+
+	var rc *config.Resource
+	for _, r := range mod.Config().Resources {
+		if r.Id() == v.Resource {
+			rc = r
+			break
+		}
+	}
+	if rc == nil {
+		return fmt.Errorf("%s: unknown resource %q", n, v.Resource)
+	}
+
+	addr, err := parseResourceAddressConfig(rc)
+	if err != nil {
+		return err
+	}
+	addr.Path = path[1:]
+
+	node := &NodeApplyableResource{
+		NodeAbstractResource: &NodeAbstractResource{Addr: addr, Config: rc},
+	}
+	deps := node.StateDependencies()
+
+	values := make([]ast.Variable, len(deps))
+	for idx, d := range deps {
+		values[idx] = ast.Variable{Type: ast.TypeString, Value: d}
+	}
+	result[n] = ast.Variable{Type: ast.TypeList, Value: values}
+	return nil
+}
+
 func unknownVariable() ast.Variable {
 	return ast.Variable{
 		Type:  ast.TypeUnknown,
@@ -281,6 +331,18 @@ func (i *Interpolater) valueSelfVar(
 			"%s: invalid scope, self variables are only valid on resources", n)
 	}
 
+	// If we have the applied state of the resource, read the attribute
+	// directly from it.
+	if s := scope.Resource.State; s != nil && v.Field != "count" {
+		variable, err := i.computeSelfVariable(s, v)
+		if err != nil {
+			return fmt.Errorf("%s: %s", n, err)
+		}
+
+		result[n] = *variable
+		return nil
+	}
+
 	rv, err := config.NewResourceVariable(fmt.Sprintf(
 		"%s.%s.%d.%s",
 		scope.Resource.Type,
@@ -294,6 +356,34 @@ func (i *Interpolater) valueSelfVar(
 	return i.valueResourceVar(scope, n, rv, result)
 }
 
+// computeSelfVariable returns the value of a self variable from the applied
+// state of the resource. Every attribute is known once the resource has
+// been applied, so an attribute that is missing or still unknown is an error.
+func (i *Interpolater) computeSelfVariable(
+	s *InstanceState, v *config.SelfVariable) (*ast.Variable, error) {
+	if attr, ok := s.Attributes[v.Field]; ok {
+		if attr == config.UnknownVariableValue {
+			return nil, fmt.Errorf(
+				"attribute %q is still unknown after apply", v.Field)
+		}
+
+		variable, err := hil.InterfaceToVariable(attr)
+		return &variable, err
+	}
+
+	// computed list or map attribute
+	_, isList := s.Attributes[v.Field+".#"]
+	_, isMap := s.Attributes[v.Field+".%"]
+	if isList || isMap {
+		variable, err := i.interpolateComplexTypeAttribute(v.Field, s.Attributes)
+		return &variable, err
+	}
+
+	return nil, fmt.Errorf(
+		"attribute %q is still unknown after apply, the provider didn't set it",
+		v.Field)
+}
+
 func (i *Interpolater) valueSimpleVar(
 	scope *InterpolationScope,
 	n string,
@@ -382,6 +472,12 @@ func (i *Interpolater) computeResourceVariable(
 		return nil, err
 	}
 
+	// If the count of the resource is computed then its expansion was
+	// deferred to apply and none of its values are known yet.
+	if cr != nil && i.Operation == walkPlan && countComputed(cr) {
+		return &unknownVariable, nil
+	}
+
 	// If we're requesting "count" its a special variable that we grab
 	// directly from the config itself.
 	if v.Field == "count" {
@@ -525,6 +621,12 @@ func (i *Interpolater) computeResourceMultiVariable(
 		return nil, err
 	}
 
+	// If the count of the resource is computed then its expansion was
+	// deferred to apply and none of its values are known yet.
+	if cr != nil && i.Operation == walkPlan && countComputed(cr) {
+		return &unknownVariable, nil
+	}
+
 	// Get the keys for all the resources that are created for this resource
 	countMax, err := i.resourceCountMax(module, cr, v)
 	if err != nil {
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"reflect"
+	"strings"
 	"sync"
 	"testing"
 
@@ -674,6 +675,54 @@ func TestInterpolater_selfVarWithoutResource(t *testing.T) {
 	}
 }
 
+func TestInterpolater_selfVarAppliedState(t *testing.T) {
+	i := &Interpolater{
+		Operation: walkApply,
+		StateLock: new(sync.RWMutex),
+	}
+
+	scope := &InterpolationScope{
+		Path: rootModulePath,
+		Resource: &Resource{
+			Name: "web",
+			Type: "aws_instance",
+			State: &InstanceState{
+				ID: "bar",
+				Attributes: map[string]string{
+					"id":      "bar",
+					"list.#":  "1",
+					"list.0":  "a",
+					"pending": config.UnknownVariableValue,
+				},
+			},
+		},
+	}
+
+	testInterpolate(t, i, scope, "self.id", ast.Variable{
+		Value: "bar",
+		Type:  ast.TypeString,
+	})
+	testInterpolate(t, i, scope, "self.list", ast.Variable{
+		Value: []ast.Variable{{Value: "a", Type: ast.TypeString}},
+		Type:  ast.TypeList,
+	})
+
+	for _, n := range []string{"self.pending", "self.nope"} {
+		v, err := config.NewInterpolatedVariable(n)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		_, err = i.Values(scope, map[string]config.InterpolatedVariable{"foo": v})
+		if err == nil {
+			t.Fatalf("%s: expected err, got none", n)
+		}
+		if field := strings.TrimPrefix(n, "self."); !strings.Contains(err.Error(), fmt.Sprintf("%q", field)) {
+			t.Fatalf("%s: error should name the attribute: %s", n, err)
+		}
+	}
+}
+
 func TestInterpolator_interpolatedListOrder(t *testing.T) {
 	state := &State{
 		Modules: []*ModuleState{
@@ -0,0 +1,24 @@
+package terraform
+
+import (
+	"fmt"
+)
+
+// NodeApplyStageGate waits for ContextOpts.ApplyGate to allow the stage of
+// ContextOpts.ApplyStages with the index Stage to be applied, once all the
+// stages before it are. See ApplyStageTransformer.
+type NodeApplyStageGate struct {
+	Stage int
+}
+
+func (n *NodeApplyStageGate) Name() string {
+	return fmt.Sprintf("meta.apply-stage.%d (apply stage gate)", n.Stage)
+}
+
+// GraphNodeEvalable
+func (n *NodeApplyStageGate) EvalTree() EvalNode {
+	return &EvalOpFilter{
+		Ops:  []walkOperation{walkApply, walkDestroy},
+		Node: &EvalApplyStageGate{Stage: n.Stage},
+	}
+}
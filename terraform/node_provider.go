@@ -3,9 +3,43 @@ package terraform
 // NodeApplyableProvider represents a provider during an apply.
 type NodeApplyableProvider struct {
 	*NodeAbstractProvider
+
+	// StrictVersion, if true, makes it an error instead of a warning if
+	// the provider doesn't report its version when the configuration has
+	// a version constraint. See EvalCheckProviderVersion.
+	StrictVersion bool
 }
 
 // GraphNodeEvalable
 func (n *NodeApplyableProvider) EvalTree() EvalNode {
-	return ProviderEvalTree(n.NameValue, n.ProviderConfig())
+	tree := ProviderEvalTree(n.NameValue, n.ProviderConfig())
+	if n.Config == nil || n.Config.Version == "" {
+		return tree
+	}
+
+	// Check the version before anything is applied. This is last since
+	// it may return a warning.
+	var provider ResourceProvider
+	return &EvalSequence{
+		Nodes: []EvalNode{
+			tree,
+			&EvalOpFilter{
+				Ops: []walkOperation{walkApply, walkDestroy},
+				Node: &EvalSequence{
+					Nodes: []EvalNode{
+						&EvalGetProvider{
+							Name:   n.NameValue,
+							Output: &provider,
+						},
+						&EvalCheckProviderVersion{
+							Name:       n.NameValue,
+							Provider:   &provider,
+							Constraint: n.Config.Version,
+							Strict:     n.StrictVersion,
+						},
+					},
+				},
+			},
+		},
+	}
 }
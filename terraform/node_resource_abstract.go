@@ -33,6 +33,10 @@ type NodeAbstractResource struct {
 	ResourceState *ResourceState   // ResourceState is the ResourceState for this
 
 	Targets []ResourceAddress // Set from GraphNodeTargetable
+
+	// CoalescedProvider, if set, is the provider used instead of the
+	// one from the config or state. Set from GraphNodeProviderCoalescer.
+	CoalescedProvider string
 }
 
 func (n *NodeAbstractResource) Name() string {
@@ -92,11 +96,25 @@ func (n *NodeAbstractResource) References() []string {
 		// Grab all the references
 		var result []string
 		result = append(result, c.DependsOn...)
+		for _, v := range c.Lifecycle.ReplaceTriggeredBy {
+			if id, _, err := config.ParseReplaceTrigger(v); err == nil {
+				result = append(result, id)
+			}
+		}
 		result = append(result, ReferencesFromConfig(c.RawCount)...)
 		result = append(result, ReferencesFromConfig(c.RawConfig)...)
 		for _, p := range c.Provisioners {
 			result = append(result, ReferencesFromConfig(p.ConnInfo)...)
 			result = append(result, ReferencesFromConfig(p.RawConfig)...)
+			if p.Condition != nil {
+				result = append(result, ReferencesFromConfig(p.Condition)...)
+			}
+		}
+		for _, cond := range c.Lifecycle.Preconditions {
+			result = append(result, ReferencesFromConfig(cond.RawConfig)...)
+		}
+		for _, cond := range c.Lifecycle.Postconditions {
+			result = append(result, ReferencesFromConfig(cond.RawConfig)...)
 		}
 
 		return result
@@ -169,6 +187,16 @@ func (n *NodeAbstractResource) StateReferences() []string {
 
 // GraphNodeProviderConsumer
 func (n *NodeAbstractResource) ProvidedBy() []string {
+	// Values don't have a provider
+	if n.Addr != nil && n.Addr.Mode == config.ValuesResourceMode {
+		return nil
+	}
+
+	// If our provider was coalesced into another we use that one
+	if n.CoalescedProvider != "" {
+		return []string{n.CoalescedProvider}
+	}
+
 	// If we have a config we prefer that above all else
 	if n.Config != nil {
 		return []string{resourceProvider(n.Config.Type, n.Config.Provider)}
@@ -183,6 +211,11 @@ func (n *NodeAbstractResource) ProvidedBy() []string {
 	return []string{resourceProvider(n.Addr.Type, "")}
 }
 
+// GraphNodeProviderCoalescer
+func (n *NodeAbstractResource) CoalesceProvider(name string) {
+	n.CoalescedProvider = name
+}
+
 // GraphNodeProvisionerConsumer
 func (n *NodeAbstractResource) ProvisionedBy() []string {
 	// If we have no configuration, then we have no provisioners
@@ -227,11 +260,23 @@ func (n *NodeAbstractResource) AttachResourceConfig(c *config.Resource) {
 
 // GraphNodeDotter impl.
 func (n *NodeAbstractResource) DotNode(name string, opts *dag.DotOpts) *dag.DotNode {
+	// Data sources are drawn differently so they stand out from the
+	// resources that are actually managed.
+	mode := n.Addr.Mode
+	if n.Config != nil {
+		mode = n.Config.Mode
+	}
+
+	shape := "box"
+	if mode == config.DataResourceMode {
+		shape = "note"
+	}
+
 	return &dag.DotNode{
 		Name: name,
 		Attrs: map[string]string{
-			"label": n.Name(),
-			"shape": "box",
+			"label": n.Addr.String(),
+			"shape": shape,
 		},
 	}
 }
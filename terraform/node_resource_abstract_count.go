@@ -10,6 +10,11 @@ type NodeAbstractCountResource struct {
 	// Validate, if true, will perform the validation for the count.
 	// This should only be turned on for the "validate" operation.
 	Validate bool
+
+	// DeferComputed, if true, will defer the expansion of a managed
+	// resource with a computed count to apply instead of erroring. This
+	// should only be turned on for the "plan" operation.
+	DeferComputed bool
 }
 
 // GraphNodeEvalable
@@ -18,7 +23,10 @@ func (n *NodeAbstractCountResource) EvalTree() EvalNode {
 	// If we're validating we allow computed counts since they just turn
 	// into more computed values.
 	var evalCountCheckComputed EvalNode
-	if !n.Validate {
+	switch {
+	case n.DeferComputed:
+		evalCountCheckComputed = &EvalCountDeferComputed{Resource: n.Config}
+	case !n.Validate:
 		evalCountCheckComputed = &EvalCountCheckComputed{Resource: n.Config}
 	}
 
@@ -48,3 +56,34 @@ func (n *NodeAbstractCountResource) EvalTree() EvalNode {
 		},
 	}
 }
+
+// skipExpand returns true if the resource doesn't need to be expanded,
+// because its count is zero and the state has no instances of it that
+// would need to be destroyed.
+func (n *NodeAbstractCountResource) skipExpand(count int, state *State) bool {
+	if count != 0 {
+		return false
+	}
+
+	addr := n.ResourceAddr()
+	ms := state.ModuleByPath(normalizeModulePath(addr.Path))
+	if ms == nil {
+		return true
+	}
+
+	for key := range ms.Resources {
+		// If we can't parse the key let the full expansion report it
+		stateAddr, err := parseResourceAddressInternal(key)
+		if err != nil {
+			return false
+		}
+		stateAddr.Path = ms.Path[1:]
+		stateAddr.Index = -1
+
+		if stateAddr.Equals(addr) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,51 @@
+package terraform
+
+import (
+	"testing"
+)
+
+func TestNodeAbstractCountResourceSkipExpand(t *testing.T) {
+	cases := map[string]struct {
+		Count    int
+		Keys     []string
+		Expected bool
+	}{
+		"zero count, no state":      {0, nil, true},
+		"zero count, other":         {0, []string{"aws_instance.bar"}, true},
+		"zero count, single":        {0, []string{"aws_instance.foo"}, false},
+		"zero count, counted":       {0, []string{"aws_instance.foo.2"}, false},
+		"zero count, data":          {0, []string{"data.aws_instance.foo"}, true},
+		"non-zero count, no state":  {1, nil, false},
+		"non-zero count, instances": {2, []string{"aws_instance.foo.0"}, false},
+	}
+
+	for k, tc := range cases {
+		addr, err := ParseResourceAddress("aws_instance.foo")
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		addr.Path = nil
+
+		state := &State{
+			Modules: []*ModuleState{
+				&ModuleState{
+					Path:      rootModulePath,
+					Resources: map[string]*ResourceState{},
+				},
+			},
+		}
+		for _, key := range tc.Keys {
+			state.RootModule().Resources[key] = &ResourceState{
+				Type:    "aws_instance",
+				Primary: &InstanceState{ID: "foo"},
+			}
+		}
+
+		n := &NodeAbstractCountResource{
+			NodeAbstractResource: &NodeAbstractResource{Addr: addr},
+		}
+		if actual := n.skipExpand(tc.Count, state); actual != tc.Expected {
+			t.Fatalf("%s: expected %t, got %t", k, tc.Expected, actual)
+		}
+	}
+}
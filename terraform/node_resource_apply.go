@@ -17,6 +17,11 @@ func (n *NodeApplyableResource) CreateAddr() *ResourceAddress {
 	return n.NodeAbstractResource.Addr
 }
 
+// GraphNodeTargetContainer
+func (n *NodeApplyableResource) TargetContains(target *ResourceAddress) bool {
+	return target.Contains(n.NodeAbstractResource.Addr)
+}
+
 // GraphNodeReferencer, overriding NodeAbstractResource
 func (n *NodeApplyableResource) References() []string {
 	result := n.NodeAbstractResource.References()
@@ -47,6 +52,12 @@ func (n *NodeApplyableResource) References() []string {
 	return result
 }
 
+// StateDependencies returns the dependencies that are written to the
+// state for this resource when it is applied.
+func (n *NodeApplyableResource) StateDependencies() []string {
+	return n.StateReferences()
+}
+
 // GraphNodeEvalable
 func (n *NodeApplyableResource) EvalTree() EvalNode {
 	addr := n.NodeAbstractResource.Addr
@@ -71,20 +82,53 @@ func (n *NodeApplyableResource) EvalTree() EvalNode {
 	}
 
 	// Determine the dependencies for the state.
-	stateDeps := n.StateReferences()
+	stateDeps := n.StateDependencies()
+
+	// The span of the resource, which is the parent of the spans of the
+	// operations done on it
+	var span TraceSpan
 
 	// Eval info is different depending on what kind of resource this is
+	var tree EvalNode
 	switch n.Config.Mode {
 	case config.ManagedResourceMode:
-		return n.evalTreeManagedResource(
-			stateId, info, resource, stateDeps,
+		tree = n.evalTreeManagedResource(
+			stateId, info, resource, stateDeps, &span,
 		)
 	case config.DataResourceMode:
-		return n.evalTreeDataResource(
+		tree = n.evalTreeDataResource(
+			stateId, info, resource, stateDeps)
+	case config.ValuesResourceMode:
+		tree = n.evalTreeValuesResource(
 			stateId, info, resource, stateDeps)
 	default:
 		panic(fmt.Errorf("unsupported resource mode %s", n.Config.Mode))
 	}
+
+	// Values don't have a provider
+	var providerName string
+	if p := n.ProvidedBy(); len(p) > 0 {
+		providerName = p[0]
+	}
+
+	return &EvalSequence{
+		Nodes: []EvalNode{
+			// Don't start applying if the walk was interrupted. Resources
+			// that already started are allowed to finish.
+			&EvalCheckInterrupted{Info: info},
+			&EvalTrace{
+				Name:     "resource",
+				Addr:     addr,
+				Provider: providerName,
+				Output:   &span,
+				Node: &EvalTimeout{
+					Name: stateId,
+					Info: info,
+					Node: tree,
+				},
+			},
+		},
+	}
 }
 
 func (n *NodeApplyableResource) evalTreeDataResource(
@@ -135,8 +179,9 @@ func (n *NodeApplyableResource) evalTreeDataResource(
 			},
 
 			&EvalGetProvider{
-				Name:   n.ProvidedBy()[0],
-				Output: &provider,
+				Name:     n.ProvidedBy()[0],
+				Output:   &provider,
+				PreApply: true,
 			},
 
 			// Make a new diff with our newly-interpolated config.
@@ -175,18 +220,121 @@ func (n *NodeApplyableResource) evalTreeDataResource(
 	}
 }
 
-func (n *NodeApplyableResource) evalTreeManagedResource(
+func (n *NodeApplyableResource) evalTreeValuesResource(
 	stateId string, info *InstanceInfo,
 	resource *Resource, stateDeps []string) EvalNode {
+	var diff *InstanceDiff
+	var state *InstanceState
+	var resourceConfig *ResourceConfig
+	var err error
+
+	return &EvalSequence{
+		Nodes: []EvalNode{
+			// Build the instance info
+			&EvalInstanceInfo{
+				Info: info,
+			},
+
+			// Get the saved diff for apply
+			&EvalReadDiff{
+				Name: stateId,
+				Diff: &diff,
+			},
+
+			// Stop here if we don't actually have a diff
+			&EvalIf{
+				If: func(ctx EvalContext) (bool, error) {
+					if diff == nil {
+						err := ctx.Hook(func(h Hook) (HookAction, error) {
+							return h.ResourceUnchanged(info)
+						})
+						if err != nil {
+							return true, err
+						}
+
+						return true, EvalEarlyExitError{}
+					}
+
+					if diff.GetDestroy() && diff.GetAttributesLen() == 0 {
+						return true, EvalEarlyExitError{}
+					}
+
+					return true, nil
+				},
+				Then: EvalNoop{},
+			},
+
+			// Re-interpolate the config and diff again, since values that
+			// were computed during the plan are known now.
+			&EvalInterpolate{
+				Config:   n.Config.RawConfig.Copy(),
+				Resource: resource,
+				Output:   &resourceConfig,
+			},
+			&EvalReadState{
+				Name:   stateId,
+				Output: &state,
+			},
+			&EvalValuesDiff{
+				Info:       info,
+				Config:     &resourceConfig,
+				State:      &state,
+				OutputDiff: &diff,
+			},
+
+			&EvalApplyPre{
+				Info:  info,
+				State: &state,
+				Diff:  &diff,
+			},
+			&EvalValuesApply{
+				Info:   info,
+				State:  &state,
+				Diff:   &diff,
+				Output: &state,
+			},
+			&EvalWriteState{
+				Name:         stateId,
+				ResourceType: n.Config.Type,
+				Dependencies: stateDeps,
+				State:        &state,
+			},
+
+			// Clear the diff now that we've applied it, so
+			// later nodes won't see a diff that's now a no-op.
+			&EvalWriteDiff{
+				Name: stateId,
+				Diff: nil,
+			},
+
+			&EvalApplyPost{
+				Info:  info,
+				State: &state,
+				Error: &err,
+			},
+			&EvalUpdateStateHook{},
+		},
+	}
+}
+
+func (n *NodeApplyableResource) evalTreeManagedResource(
+	stateId string, info *InstanceInfo,
+	resource *Resource, stateDeps []string, span *TraceSpan) EvalNode {
+	addr := n.NodeAbstractResource.Addr
+	providerName := n.ProvidedBy()[0]
+
 	// Declare a bunch of variables that are used for state during
 	// evaluation. Most of this are written to by-address below.
 	var provider ResourceProvider
 	var diff, diffApply *InstanceDiff
-	var state *InstanceState
+	var state, prior *InstanceState
 	var resourceConfig *ResourceConfig
 	var err error
 	var createNew bool
 	var createBeforeDestroyEnabled bool
+	var replaceOrder DiffReplaceOrder
+	var diffHash uint64
+	var priorId string
 
 	return &EvalSequence{
 		Nodes: []EvalNode{
@@ -201,10 +349,29 @@ func (n *NodeApplyableResource) evalTreeManagedResource(
 				Diff: &diffApply,
 			},
 
+			// Skip the instance if an interrupted apply of the plan
+			// already applied it.
+			&EvalCheckApplyProgress{
+				Name:           stateId,
+				Info:           info,
+				Diff:           &diffApply,
+				Dependencies:   stateDeps,
+				OutputDiffHash: &diffHash,
+			},
+
 			// We don't want to do any destroys
 			&EvalIf{
 				If: func(ctx EvalContext) (bool, error) {
 					if diffApply == nil {
+						// Nothing changes, such as for an instance of a
+						// resource whose count was only known now
+						err := ctx.Hook(func(h Hook) (HookAction, error) {
+							return h.ResourceUnchanged(info)
+						})
+						if err != nil {
+							return true, err
+						}
+
 						return true, EvalEarlyExitError{}
 					}
 
@@ -212,22 +379,29 @@ func (n *NodeApplyableResource) evalTreeManagedResource(
 						return true, EvalEarlyExitError{}
 					}
 
+					// Decide how we're replaced before the destroy is
+					// removed from the diff.
+					replaceOrder = diffApply.ReplaceOrder(
+						n.Config.Lifecycle.CreateBeforeDestroy)
+
 					diffApply.SetDestroy(false)
 					return true, nil
 				},
 				Then: EvalNoop{},
 			},
 
+			// Check the preconditions that were unknown during the plan,
+			// before anything is changed
+			&EvalCheckPreconditions{
+				Info:           info,
+				Resource:       n.Config,
+				InterpResource: resource,
+			},
+
 			&EvalIf{
 				If: func(ctx EvalContext) (bool, error) {
-					destroy := false
-					if diffApply != nil {
-						destroy = diffApply.GetDestroy() || diffApply.RequiresNew()
-					}
-
 					createBeforeDestroyEnabled =
-						n.Config.Lifecycle.CreateBeforeDestroy &&
-							destroy
+						replaceOrder == DiffReplaceCreateBeforeDestroy
 
 					return createBeforeDestroyEnabled, nil
 				},
@@ -242,8 +416,9 @@ func (n *NodeApplyableResource) evalTreeManagedResource(
 				Output:   &resourceConfig,
 			},
 			&EvalGetProvider{
-				Name:   n.ProvidedBy()[0],
-				Output: &provider,
+				Name:     n.ProvidedBy()[0],
+				Output:   &provider,
+				PreApply: true,
 			},
 			&EvalReadState{
 				Name:   stateId,
@@ -259,14 +434,20 @@ func (n *NodeApplyableResource) evalTreeManagedResource(
 				ResourceMode:   n.Config.Mode,
 				IgnoreWarnings: true,
 			},
-			&EvalDiff{
-				Info:       info,
-				Config:     &resourceConfig,
-				Resource:   n.Config,
-				Provider:   &provider,
-				Diff:       &diffApply,
-				State:      &state,
-				OutputDiff: &diffApply,
+			&EvalTrace{
+				Name:     "diff",
+				Addr:     addr,
+				Provider: providerName,
+				Parent:   span,
+				Node: &EvalDiff{
+					Info:       info,
+					Config:     &resourceConfig,
+					Resource:   n.Config,
+					Provider:   &provider,
+					Diff:       &diffApply,
+					State:      &state,
+					OutputDiff: &diffApply,
+				},
 			},
 
 			// Get the saved diff
@@ -277,14 +458,16 @@ func (n *NodeApplyableResource) evalTreeManagedResource(
 
 			// Compare the diffs
 			&EvalCompareDiff{
-				Info: info,
-				One:  &diff,
-				Two:  &diffApply,
+				Info:     info,
+				One:      &diff,
+				Two:      &diffApply,
+				Provider: &provider,
 			},
 
 			&EvalGetProvider{
-				Name:   n.ProvidedBy()[0],
-				Output: &provider,
+				Name:     n.ProvidedBy()[0],
+				Output:   &provider,
+				PreApply: true,
 			},
 			&EvalReadState{
 				Name:   stateId,
@@ -296,14 +479,24 @@ func (n *NodeApplyableResource) evalTreeManagedResource(
 				State: &state,
 				Diff:  &diffApply,
 			},
-			&EvalApply{
-				Info:      info,
-				State:     &state,
-				Diff:      &diffApply,
-				Provider:  &provider,
-				Output:    &state,
-				Error:     &err,
-				CreateNew: &createNew,
+			&EvalTrace{
+				Name:     "apply",
+				Addr:     addr,
+				Provider: providerName,
+				Parent:   span,
+				Error:    &err,
+				Node: &EvalApply{
+					Info:      info,
+					State:     &state,
+					Diff:      &diffApply,
+					Provider:  &provider,
+					Output:    &state,
+					Error:     &err,
+					CreateNew: &createNew,
+					Resource:  n.Config,
+					Prior:     &prior,
+					PriorId:   &priorId,
+				},
 			},
 			&EvalWriteState{
 				Name:         stateId,
@@ -311,15 +504,30 @@ func (n *NodeApplyableResource) evalTreeManagedResource(
 				Provider:     n.Config.Provider,
 				Dependencies: stateDeps,
 				State:        &state,
+				Prior:        &prior,
+			},
+			&EvalTrace{
+				Name:     "provisioners",
+				Addr:     addr,
+				Provider: providerName,
+				Parent:   span,
+				Error:    &err,
+				Node: &EvalApplyProvisioners{
+					Info:           info,
+					State:          &state,
+					Resource:       n.Config,
+					InterpResource: resource,
+					CreateNew:      &createNew,
+					Error:          &err,
+					When:           config.ProvisionerWhenCreate,
+				},
 			},
-			&EvalApplyProvisioners{
+			&EvalCheckPostconditions{
 				Info:           info,
-				State:          &state,
 				Resource:       n.Config,
 				InterpResource: resource,
-				CreateNew:      &createNew,
+				State:          &state,
 				Error:          &err,
-				When:           config.ProvisionerWhenCreate,
 			},
 			&EvalIf{
 				If: func(ctx EvalContext) (bool, error) {
@@ -335,6 +543,7 @@ func (n *NodeApplyableResource) evalTreeManagedResource(
 					Provider:     n.Config.Provider,
 					Dependencies: stateDeps,
 					State:        &state,
+					Prior:        &prior,
 				},
 			},
 
@@ -346,12 +555,28 @@ func (n *NodeApplyableResource) evalTreeManagedResource(
 				Diff: nil,
 			},
 
+			&EvalRecordApplyProgress{
+				Name:         stateId,
+				DiffHash:     &diffHash,
+				Dependencies: stateDeps,
+				Error:        &err,
+			},
+
 			&EvalApplyPost{
 				Info:  info,
 				State: &state,
 				Error: &err,
 			},
 			&EvalUpdateStateHook{},
+
+			// Warn if the provider didn't produce what the plan said it
+			// would. This must be last since it returns as a warning.
+			&EvalCheckApplyConsistency{
+				Info:    info,
+				Diff:    &diffApply,
+				State:   &state,
+				PriorId: &priorId,
+			},
 		},
 	}
 }
@@ -0,0 +1,206 @@
+package terraform
+
+import (
+	"log"
+
+	"github.com/hashicorp/terraform/dag"
+)
+
+// NodeApplyableCountResource represents a resource whose count couldn't
+// be determined during plan. The count is interpolated once everything it
+// references has been applied and the resource is then expanded into
+// instances that are diffed and applied in the same walk.
+type NodeApplyableCountResource struct {
+	*NodeAbstractCountResource
+}
+
+// GraphNodeDynamicExpandable
+func (n *NodeApplyableCountResource) DynamicExpand(ctx EvalContext) (*Graph, error) {
+	// Grab the state which we read
+	state, lock := ctx.State()
+	lock.RLock()
+	defer lock.RUnlock()
+
+	// Expand the resource count which must be available by now from EvalTree
+	count, err := n.Config.Count()
+	if err != nil {
+		return nil, err
+	}
+
+	// A resource with a zero count and nothing in the state has no
+	// instances to create or destroy, so there is nothing to expand.
+	if n.skipExpand(count, state) {
+		log.Printf("[TRACE] %s: count is zero, skipping expansion", n.Name())
+		return nil, nil
+	}
+
+	// The concrete resource factory we'll use
+	concreteResource := func(a *NodeAbstractResource) dag.Vertex {
+		// Add the config since we don't do that via transforms
+		a.Config = n.Config
+
+		return &NodeApplyableCountResourceInstance{
+			NodeApplyableResource: &NodeApplyableResource{
+				NodeAbstractResource: a,
+			},
+		}
+	}
+
+	// The concrete resource factory we'll use for orphans, which are
+	// the instances left over when the count shrinks.
+	concreteResourceOrphan := func(a *NodeAbstractResource) dag.Vertex {
+		// Add the config since we don't do that via transforms
+		a.Config = n.Config
+
+		return &NodeDestroyCountResourceOrphan{
+			NodeDestroyResource: &NodeDestroyResource{
+				NodeAbstractResource: a,
+			},
+		}
+	}
+
+	// Start creating the steps
+	steps := []GraphTransformer{
+		// Expand the count.
+		&ResourceCountTransformer{
+			Concrete: concreteResource,
+			Count:    count,
+			Addr:     n.ResourceAddr(),
+		},
+
+		// Add the count orphans
+		&OrphanResourceCountTransformer{
+			Concrete: concreteResourceOrphan,
+			Count:    count,
+			Addr:     n.ResourceAddr(),
+			State:    state,
+		},
+
+		// Attach the state
+		&AttachStateTransformer{State: state},
+
+		// Targeting
+		&TargetsTransformer{ParsedTargets: n.Targets},
+
+		// Connect references so ordering is correct
+		&ReferenceTransformer{},
+
+		// Make sure there is a single root
+		&RootTransformer{},
+	}
+
+	// Build the graph
+	b := &BasicGraphBuilder{
+		Steps:    steps,
+		Validate: true,
+		Name:     "NodeApplyableCountResource",
+	}
+	return b.Build(ctx.Path())
+}
+
+// NodeApplyableCountResourceInstance is a single instance of a
+// NodeApplyableCountResource. There is no planned diff for it, so the
+// diff is created and written before the instance is applied.
+type NodeApplyableCountResourceInstance struct {
+	*NodeApplyableResource
+}
+
+// GraphNodeEvalable
+func (n *NodeApplyableCountResourceInstance) EvalTree() EvalNode {
+	addr := n.NodeAbstractResource.Addr
+
+	// stateId is the ID to put into the state
+	stateId := addr.stateId()
+
+	// Build the instance info. More of this will be populated during eval
+	info := &InstanceInfo{
+		Id:         stateId,
+		Type:       addr.Type,
+		ModulePath: normalizeModulePath(addr.Path),
+	}
+
+	// Build the resource for eval
+	resource := &Resource{
+		Name:       addr.Name,
+		Type:       addr.Type,
+		CountIndex: addr.Index,
+	}
+	if resource.CountIndex < 0 {
+		resource.CountIndex = 0
+	}
+
+	// Declare a bunch of variables that are used for state during
+	// evaluation. Most of this are written to by-address below.
+	var provider ResourceProvider
+	var diff *InstanceDiff
+	var state *InstanceState
+	var resourceConfig *ResourceConfig
+
+	return &EvalSequence{
+		Nodes: []EvalNode{
+			&EvalInterpolate{
+				Config:   n.Config.RawConfig.Copy(),
+				Resource: resource,
+				Output:   &resourceConfig,
+			},
+			&EvalGetProvider{
+				Name:     n.ProvidedBy()[0],
+				Output:   &provider,
+				PreApply: true,
+			},
+			&EvalValidateResource{
+				Provider:       &provider,
+				Config:         &resourceConfig,
+				ResourceName:   n.Config.Name,
+				ResourceType:   n.Config.Type,
+				ResourceMode:   n.Config.Mode,
+				IgnoreWarnings: true,
+			},
+			&EvalReadState{
+				Name:   stateId,
+				Output: &state,
+			},
+			&EvalDiff{
+				Name:       stateId,
+				Info:       info,
+				Config:     &resourceConfig,
+				Resource:   n.Config,
+				Provider:   &provider,
+				State:      &state,
+				OutputDiff: &diff,
+			},
+			&EvalCheckPreventDestroy{
+				Resource: n.Config,
+				Diff:     &diff,
+			},
+			&EvalWriteDiff{
+				Name: stateId,
+				Diff: &diff,
+			},
+
+			// Apply the diff we just wrote as if it had been planned
+			n.NodeApplyableResource.EvalTree(),
+		},
+	}
+}
+
+// NodeDestroyCountResourceOrphan is an instance of a
+// NodeApplyableCountResource that is no longer covered by the count. The
+// destroy diff is created and written before the instance is destroyed.
+type NodeDestroyCountResourceOrphan struct {
+	*NodeDestroyResource
+}
+
+// GraphNodeEvalable
+func (n *NodeDestroyCountResourceOrphan) EvalTree() EvalNode {
+	orphan := &NodePlannableResourceOrphan{
+		NodeAbstractResource: n.NodeAbstractResource,
+	}
+
+	return &EvalSequence{
+		Nodes: []EvalNode{
+			orphan.EvalTree(),
+			n.NodeDestroyResource.EvalTree(),
+		},
+	}
+}
@@ -0,0 +1,110 @@
+package terraform
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/dag"
+)
+
+func TestNodeApplyableResourceStateDependencies(t *testing.T) {
+	m := testModule(t, "apply-state-dependencies")
+	p := testProvider("aws")
+	p.ApplyFn = testApplyFn
+	p.DiffFn = testDiffFn
+	ctx := testContext2(t, &ContextOpts{
+		Module: m,
+		Providers: map[string]ResourceProviderFactory{
+			"aws": testProviderFuncFixed(p),
+		},
+	})
+
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Get the dependencies from the apply graph before applying
+	g, err := ctx.Graph(GraphTypeApply, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := make(map[string][]string)
+	for _, v := range g.Vertices() {
+		n, ok := v.(*NodeApplyableResource)
+		if !ok {
+			continue
+		}
+
+		expected[n.Addr.stateId()] = n.StateDependencies()
+	}
+	if len(expected) != 4 {
+		t.Fatalf("bad: %#v", expected)
+	}
+
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := make(map[string][]string)
+	for k, rs := range state.RootModule().Resources {
+		actual[k] = rs.Dependencies
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad:\n\n%#v\n\nexpected:\n\n%#v", actual, expected)
+	}
+
+	deps := expected["aws_instance.bar"]
+	if !reflect.DeepEqual(deps, []string{"aws_instance.baz", "aws_instance.foo"}) {
+		t.Fatalf("bad: %#v", deps)
+	}
+}
+
+func TestNodeApplyableResourceDotNode(t *testing.T) {
+	var _ dag.GraphNodeDotter = new(NodeApplyableResource)
+
+	m := testModule(t, "graph-dot-resource")
+
+	var g Graph
+	for _, addr := range []string{
+		"data.aws_ami.foo",
+		"aws_instance.web[0]",
+		"aws_instance.web[1]",
+	} {
+		a, err := ParseResourceAddress(addr)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		a.Path = nil
+
+		n := &NodeApplyableResource{
+			NodeAbstractResource: &NodeAbstractResource{Addr: a},
+		}
+		for _, r := range m.Config().Resources {
+			if r.Mode == a.Mode && r.Type == a.Type && r.Name == a.Name {
+				n.AttachResourceConfig(r)
+			}
+		}
+		g.Add(n)
+	}
+
+	tf := &ReferenceTransformer{}
+	if err := tf.Transform(&g); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := string(g.Dot(&dag.DotOpts{}))
+	for _, expected := range []string{
+		`"[root] data.aws_ami.foo" [label = "data.aws_ami.foo", shape = "note"]`,
+		`"[root] aws_instance.web[0]" [label = "aws_instance.web[0]", shape = "box"]`,
+		`"[root] aws_instance.web[1]" [label = "aws_instance.web[1]", shape = "box"]`,
+		`"[root] aws_instance.web[0]" -> "[root] data.aws_ami.foo"`,
+		`"[root] aws_instance.web[1]" -> "[root] data.aws_ami.foo"`,
+	} {
+		if !strings.Contains(actual, expected) {
+			t.Fatalf("expected %q in:\n\n%s", expected, actual)
+		}
+	}
+}
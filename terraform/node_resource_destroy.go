@@ -56,6 +56,25 @@ func (n *NodeDestroyResource) ReferenceableName() []string {
 
 // GraphNodeReferencer, overriding NodeAbstractResource
 func (n *NodeDestroyResource) References() []string {
+	// If we have a config, then we need to include the dependencies of
+	// the destroy-time provisioners, which run before the destroy.
+	if c := n.Config; c != nil {
+		var result []string
+		for _, p := range c.Provisioners {
+			if p.When != config.ProvisionerWhenDestroy {
+				continue
+			}
+
+			result = append(result, ReferencesFromConfig(p.ConnInfo)...)
+			result = append(result, ReferencesFromConfig(p.RawConfig)...)
+			if p.Condition != nil {
+				result = append(result, ReferencesFromConfig(p.Condition)...)
+			}
+		}
+
+		return result
+	}
+
 	return nil
 }
 
@@ -107,6 +126,11 @@ func (n *NodeDestroyResource) EvalTree() EvalNode {
 		uniqueExtra: "destroy",
 	}
 
+	// Values don't have a provider, so there is only the state to remove
+	if n.Addr.Mode == config.ValuesResourceMode {
+		return n.evalTreeValuesResource(stateId, info)
+	}
+
 	// Build the resource for eval
 	addr := n.Addr
 	resource := &Resource{
@@ -124,7 +148,7 @@ func (n *NodeDestroyResource) EvalTree() EvalNode {
 		rs = &ResourceState{}
 	}
 
-	var diffApply *InstanceDiff
+	var diffApply, diffDestroy *InstanceDiff
 	var provider ResourceProvider
 	var state *InstanceState
 	var err error
@@ -161,8 +185,9 @@ func (n *NodeDestroyResource) EvalTree() EvalNode {
 				&EvalInstanceInfo{Info: info},
 
 				&EvalGetProvider{
-					Name:   n.ProvidedBy()[0],
-					Output: &provider,
+					Name:     n.ProvidedBy()[0],
+					Output:   &provider,
+					PreApply: true,
 				},
 				&EvalReadState{
 					Name:   stateId,
@@ -172,6 +197,20 @@ func (n *NodeDestroyResource) EvalTree() EvalNode {
 					State: &state,
 				},
 
+				// Recompute the destroy diff from the current state and make
+				// sure it still matches the planned diff, the same way apply
+				// nodes compare their diffs.
+				&EvalDiffDestroy{
+					Info:   info,
+					State:  &state,
+					Output: &diffDestroy,
+				},
+				&EvalCompareDiff{
+					Info: info,
+					One:  &diffApply,
+					Two:  &diffDestroy,
+				},
+
 				// Call pre-apply hook
 				&EvalApplyPre{
 					Info:  info,
@@ -240,6 +279,7 @@ func (n *NodeDestroyResource) EvalTree() EvalNode {
 						Provider: &provider,
 						Output:   &state,
 						Error:    &err,
+						Resource: n.Config,
 					},
 				},
 				&EvalWriteState{
@@ -259,3 +299,75 @@ func (n *NodeDestroyResource) EvalTree() EvalNode {
 		},
 	}
 }
+
+func (n *NodeDestroyResource) evalTreeValuesResource(
+	stateId string, info *InstanceInfo) EvalNode {
+	var diff *InstanceDiff
+	var state *InstanceState
+	var err error
+
+	return &EvalOpFilter{
+		Ops: []walkOperation{walkApply, walkDestroy},
+		Node: &EvalSequence{
+			Nodes: []EvalNode{
+				// Get the saved diff for apply
+				&EvalReadDiff{
+					Name: stateId,
+					Diff: &diff,
+				},
+
+				// Filter the diff so we only get the destroy
+				&EvalFilterDiff{
+					Diff:    &diff,
+					Output:  &diff,
+					Destroy: true,
+				},
+
+				// If we're not destroying, then there is nothing to do
+				&EvalIf{
+					If: func(ctx EvalContext) (bool, error) {
+						if diff != nil && diff.GetDestroy() {
+							return true, nil
+						}
+
+						return true, EvalEarlyExitError{}
+					},
+					Then: EvalNoop{},
+				},
+
+				// Load the instance info so we have the module path set
+				&EvalInstanceInfo{Info: info},
+
+				&EvalReadState{
+					Name:   stateId,
+					Output: &state,
+				},
+				&EvalRequireState{
+					State: &state,
+				},
+				&EvalApplyPre{
+					Info:  info,
+					State: &state,
+					Diff:  &diff,
+				},
+				&EvalValuesApply{
+					Info:   info,
+					State:  &state,
+					Diff:   &diff,
+					Output: &state,
+				},
+				&EvalWriteState{
+					Name:         stateId,
+					ResourceType: n.Addr.Type,
+					State:        &state,
+				},
+				&EvalApplyPost{
+					Info:  info,
+					State: &state,
+					Error: &err,
+				},
+				&EvalUpdateStateHook{},
+			},
+		},
+	}
+}
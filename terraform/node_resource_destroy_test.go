@@ -1,9 +1,12 @@
 package terraform
 
 import (
+	"reflect"
 	"strings"
 	"sync"
 	"testing"
+
+	"github.com/hashicorp/terraform/config"
 )
 
 func TestNodeDestroyResourceDynamicExpand_deposedCount(t *testing.T) {
@@ -65,3 +68,30 @@ aws_instance.bar.0 (deposed #0)
 		t.Fatalf("bad:\n\n%s", actual)
 	}
 }
+
+func TestNodeDestroyResourceProvisionedBy(t *testing.T) {
+	n := &NodeDestroyResource{
+		NodeAbstractResource: &NodeAbstractResource{
+			Config: &config.Resource{
+				Name: "foo",
+				Type: "aws_instance",
+				Provisioners: []*config.Provisioner{
+					&config.Provisioner{
+						Type: "local-exec",
+						When: config.ProvisionerWhenCreate,
+					},
+					&config.Provisioner{
+						Type: "shell",
+						When: config.ProvisionerWhenDestroy,
+					},
+				},
+			},
+		},
+	}
+
+	actual := n.ProvisionedBy()
+	expected := []string{"local-exec", "shell"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
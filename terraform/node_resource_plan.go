@@ -1,6 +1,8 @@
 package terraform
 
 import (
+	"log"
+
 	"github.com/hashicorp/terraform/dag"
 )
 
@@ -17,12 +19,25 @@ func (n *NodePlannableResource) DynamicExpand(ctx EvalContext) (*Graph, error) {
 	lock.RLock()
 	defer lock.RUnlock()
 
+	// If the count is computed then EvalTree deferred the expansion of
+	// this resource to apply, so there is nothing to plan yet.
+	if countComputed(n.Config) {
+		return nil, nil
+	}
+
 	// Expand the resource count which must be available by now from EvalTree
 	count, err := n.Config.Count()
 	if err != nil {
 		return nil, err
 	}
 
+	// A resource with a zero count and nothing in the state has no
+	// instances to create or destroy, so there is nothing to expand.
+	if n.skipExpand(count, state) {
+		log.Printf("[TRACE] %s: count is zero, skipping expansion", n.Name())
+		return nil, nil
+	}
+
 	// The concrete resource factory we'll use
 	concreteResource := func(a *NodeAbstractResource) dag.Vertex {
 		// Add the config and state since we don't do that via transforms
@@ -49,6 +49,9 @@ func (n *NodePlannableResourceInstance) EvalTree() EvalNode {
 	case config.DataResourceMode:
 		return n.evalTreeDataResource(
 			stateId, info, resource, stateDeps)
+	case config.ValuesResourceMode:
+		return n.evalTreeValuesResource(
+			stateId, info, resource, stateDeps)
 	default:
 		panic(fmt.Errorf("unsupported resource mode %s", n.Config.Mode))
 	}
@@ -125,6 +128,50 @@ func (n *NodePlannableResourceInstance) evalTreeDataResource(
 	}
 }
 
+func (n *NodePlannableResourceInstance) evalTreeValuesResource(
+	stateId string, info *InstanceInfo,
+	resource *Resource, stateDeps []string) EvalNode {
+	var diff *InstanceDiff
+	var state *InstanceState
+	var resourceConfig *ResourceConfig
+
+	return &EvalSequence{
+		Nodes: []EvalNode{
+			&EvalInterpolate{
+				Config:   n.Config.RawConfig.Copy(),
+				Resource: resource,
+				Output:   &resourceConfig,
+			},
+			&EvalReadState{
+				Name:   stateId,
+				Output: &state,
+			},
+			&EvalValuesDiff{
+				Info:        info,
+				Config:      &resourceConfig,
+				State:       &state,
+				OutputDiff:  &diff,
+				OutputState: &state,
+			},
+			&EvalResourceUnchanged{
+				Info:  info,
+				State: &state,
+				Diff:  &diff,
+			},
+			&EvalWriteState{
+				Name:         stateId,
+				ResourceType: n.Config.Type,
+				Dependencies: stateDeps,
+				State:        &state,
+			},
+			&EvalWriteDiff{
+				Name: stateId,
+				Diff: &diff,
+			},
+		},
+	}
+}
+
 func (n *NodePlannableResourceInstance) evalTreeManagedResource(
 	stateId string, info *InstanceInfo,
 	resource *Resource, stateDeps []string) EvalNode {
@@ -142,6 +189,11 @@ func (n *NodePlannableResourceInstance) evalTreeManagedResource(
 				Resource: resource,
 				Output:   &resourceConfig,
 			},
+			&EvalCheckPreconditions{
+				Info:           info,
+				Resource:       n.Config,
+				InterpResource: resource,
+			},
 			&EvalGetProvider{
 				Name:   n.ProvidedBy()[0],
 				Output: &provider,
@@ -155,11 +207,23 @@ func (n *NodePlannableResourceInstance) evalTreeManagedResource(
 				ResourceType:   n.Config.Type,
 				ResourceMode:   n.Config.Mode,
 				IgnoreWarnings: true,
+				WarningsAddr:   n.NodeAbstractResource.Addr,
 			},
 			&EvalReadState{
 				Name:   stateId,
 				Output: &state,
 			},
+			&EvalRefreshInvalidated{
+				Name:     stateId,
+				Info:     info,
+				Provider: &provider,
+				State:    &state,
+				Output:   &state,
+			},
+			&EvalCheckManagedBy{
+				Addr:  n.NodeAbstractResource.Addr,
+				State: &state,
+			},
 			&EvalDiff{
 				Name:        stateId,
 				Info:        info,
@@ -174,6 +238,11 @@ func (n *NodePlannableResourceInstance) evalTreeManagedResource(
 				Resource: n.Config,
 				Diff:     &diff,
 			},
+			&EvalResourceUnchanged{
+				Info:  info,
+				State: &state,
+				Diff:  &diff,
+			},
 			&EvalWriteState{
 				Name:         stateId,
 				ResourceType: n.Config.Type,
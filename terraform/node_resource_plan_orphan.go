@@ -39,6 +39,7 @@ func (n *NodePlannableResourceOrphan) EvalTree() EvalNode {
 				Info:   info,
 				State:  &state,
 				Output: &diff,
+				Name:   stateId,
 			},
 			&EvalCheckPreventDestroy{
 				Resource:   n.Config,
@@ -39,6 +39,11 @@ func (n *NodeRefreshableResource) EvalTree() EvalNode {
 		}
 
 		return dn.EvalTree()
+
+	case config.ValuesResourceMode:
+		// Values are only computed from the configuration, so there is
+		// nothing to refresh. Orphans are removed by the next apply.
+		return EvalNoop{}
 	default:
 		panic(fmt.Errorf("unsupported resource mode %s", mode))
 	}
@@ -82,11 +87,18 @@ func (n *NodeRefreshableResource) evalTreeManagedResource() EvalNode {
 				Name:   stateId,
 				Output: &state,
 			},
-			&EvalRefresh{
-				Info:     info,
-				Provider: &provider,
-				State:    &state,
-				Output:   &state,
+			// Resources that are only in the graph because a target
+			// depends on them keep their last-known state if requested.
+			&EvalIf{
+				If: func(ctx EvalContext) (bool, error) {
+					return !ctx.RefreshTargetsOnly() || len(n.Targets) > 0, nil
+				},
+				Then: &EvalRefresh{
+					Info:     info,
+					Provider: &provider,
+					State:    &state,
+					Output:   &state,
+				},
 			},
 			&EvalWriteState{
 				Name:         stateId,
@@ -1,6 +1,7 @@
 package terraform
 
 import (
+	"github.com/hashicorp/terraform/config"
 	"github.com/hashicorp/terraform/dag"
 )
 
@@ -96,6 +97,14 @@ func (n *NodeValidatableResourceInstance) EvalTree() EvalNode {
 		resource.CountIndex = 0
 	}
 
+	// Values don't have a provider to validate them with
+	if n.Config.Mode == config.ValuesResourceMode {
+		return &EvalValidateResourceSelfRef{
+			Addr:   &addr,
+			Config: &n.Config.RawConfig,
+		}
+	}
+
 	// Declare a bunch of variables that are used for state during
 	// evaluation. Most of this are written to by-address below.
 	var config *ResourceConfig
@@ -142,5 +151,18 @@ func (n *NodeValidatableResourceInstance) EvalTree() EvalNode {
 		})
 	}
 
+	// Validate the self references of the provisioners after the rest,
+	// since an error stops the rest of the validation.
+	seq.Nodes = append(seq.Nodes, &EvalValidateProvisionerSelfRefs{
+		Provider: &provider,
+		Resource: n.Config,
+	})
+
+	// This only warns, so it comes after everything that can error.
+	seq.Nodes = append(seq.Nodes, &EvalValidateIgnoreChanges{
+		Provider: &provider,
+		Resource: n.Config,
+	})
+
 	return seq
 }
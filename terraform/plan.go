@@ -34,6 +34,10 @@ type Plan struct {
 	// Backend is the backend that this plan should use and store data with.
 	Backend *BackendState
 
+	// Warnings are the warnings the providers reported while planning
+	// the resources. They don't prevent the plan from being applied.
+	Warnings []*PlanWarning
+
 	once sync.Once
 }
 
@@ -34,6 +34,11 @@ type Resource struct {
 	Type       string
 	CountIndex int
 
+	// State is the applied state of the instance, when it is known. Self
+	// variables are read from it so that provisioners see the attributes
+	// the provider produced.
+	State *InstanceState
+
 	// These aren't really used anymore anywhere, but we keep them around
 	// since we haven't done a proper cleanup yet.
 	Id           string
@@ -42,7 +47,6 @@ type Resource struct {
 	Dependencies []string
 	Diff         *InstanceDiff
 	Provider     ResourceProvider
-	State        *InstanceState
 	Provisioners []*ResourceProvisionerConfig
 	Flags        ResourceFlag
 }
@@ -34,15 +34,16 @@ func (r *ResourceAddress) Copy() *ResourceAddress {
 	}
 
 	n := &ResourceAddress{
-		Path:         make([]string, 0, len(r.Path)),
-		Index:        r.Index,
-		InstanceType: r.InstanceType,
-		Name:         r.Name,
-		Type:         r.Type,
-		Mode:         r.Mode,
+		Index:           r.Index,
+		InstanceType:    r.InstanceType,
+		InstanceTypeSet: r.InstanceTypeSet,
+		Name:            r.Name,
+		Type:            r.Type,
+		Mode:            r.Mode,
 	}
-	for _, p := range r.Path {
-		n.Path = append(n.Path, p)
+	if r.Path != nil {
+		n.Path = make([]string, len(r.Path))
+		copy(n.Path, r.Path)
 	}
 	return n
 }
@@ -55,7 +56,7 @@ func (r *ResourceAddress) String() string {
 	}
 
 	switch r.Mode {
-	case config.ManagedResourceMode:
+	case config.ManagedResourceMode, config.ValuesResourceMode:
 		// nothing to do
 	case config.DataResourceMode:
 		result = append(result, "data")
@@ -95,7 +96,7 @@ func (r *ResourceAddress) String() string {
 func (r *ResourceAddress) stateId() string {
 	result := fmt.Sprintf("%s.%s", r.Type, r.Name)
 	switch r.Mode {
-	case config.ManagedResourceMode:
+	case config.ManagedResourceMode, config.ValuesResourceMode:
 		// Done
 	case config.DataResourceMode:
 		result = fmt.Sprintf("data.%s", result)
@@ -141,6 +142,9 @@ func parseResourceAddressInternal(s string) (*ResourceAddress, error) {
 	if len(parts) > 3 && mode != config.DataResourceMode {
 		return nil, fmt.Errorf("Invalid internal resource address format: %s", s)
 	}
+	if mode == config.ManagedResourceMode && parts[0] == config.ValuesResourceType {
+		mode = config.ValuesResourceMode
+	}
 
 	// Build the parts of the resource address that are guaranteed to exist
 	addr := &ResourceAddress{
@@ -172,6 +176,8 @@ func ParseResourceAddress(s string) (*ResourceAddress, error) {
 	mode := config.ManagedResourceMode
 	if matches["data_prefix"] != "" {
 		mode = config.DataResourceMode
+	} else if matches["type"] == config.ValuesResourceType {
+		mode = config.ValuesResourceMode
 	}
 	resourceIndex, err := ParseResourceIndex(matches["index"])
 	if err != nil {
@@ -233,6 +239,49 @@ func (addr *ResourceAddress) Equals(raw interface{}) bool {
 		modeMatch
 }
 
+// Contains returns true if the given address is included by this address
+// when it is used as a target. Unlike Equals, this is not symmetric.
+//
+// A target without an index contains all indices of the resource, but a
+// target with an index only contains that exact index. An address without
+// an index, such as a resource without a count, is contained by a target
+// with index zero. A target that addresses only a module path contains all
+// resources in that module and in all of its descendant modules.
+func (addr *ResourceAddress) Contains(other *ResourceAddress) bool {
+	if other == nil {
+		return false
+	}
+
+	// A module-only target contains everything under that module path
+	if addr.Type == "" && addr.Name == "" {
+		if len(other.Path) < len(addr.Path) {
+			return false
+		}
+
+		return reflect.DeepEqual(addr.Path, other.Path[:len(addr.Path)])
+	}
+
+	pathMatch := len(addr.Path) == 0 && len(other.Path) == 0 ||
+		reflect.DeepEqual(addr.Path, other.Path)
+
+	indexMatch := addr.Index == -1 ||
+		addr.Index == other.Index ||
+		addr.Index == 0 && other.Index == -1
+
+	nameMatch := addr.Name == "" || addr.Name == other.Name
+	typeMatch := addr.Type == "" || addr.Type == other.Type
+
+	// mode is significant only when type is set
+	modeMatch := addr.Type == "" || addr.Mode == other.Mode
+
+	return pathMatch &&
+		indexMatch &&
+		addr.InstanceType == other.InstanceType &&
+		nameMatch &&
+		typeMatch &&
+		modeMatch
+}
+
 func ParseResourceIndex(s string) (int, error) {
 	if s == "" {
 		return -1, nil
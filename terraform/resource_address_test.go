@@ -128,6 +128,17 @@ func TestParseResourceAddress(t *testing.T) {
 			},
 			"",
 		},
+		"values instance": {
+			"values.foo[1]",
+			&ResourceAddress{
+				Mode:         config.ValuesResourceMode,
+				Type:         "values",
+				Name:         "foo",
+				InstanceType: TypePrimary,
+				Index:        1,
+			},
+			"",
+		},
 		"implicit primary, explicit index": {
 			"aws_instance.foo[2]",
 			&ResourceAddress{
@@ -277,6 +288,47 @@ func TestParseResourceAddress(t *testing.T) {
 	}
 }
 
+func TestParseResourceAddress_roundTrip(t *testing.T) {
+	cases := []string{
+		"aws_instance.web",
+		"aws_instance.web[3]",
+		"data.aws_ami.base",
+		"data.aws_ami.base[0]",
+		"aws_instance.web.tainted",
+		"aws_instance.web.deposed[1]",
+		"module.a",
+		"module.a.module.b",
+		"module.a.aws_instance.web",
+		"module.a.aws_instance.web[3]",
+		"module.a.module.b.aws_instance.web",
+		"module.a.module.b.aws_instance.web[3]",
+		"module.a.module.b.data.aws_ami.base[12]",
+	}
+
+	for _, tc := range cases {
+		addr, err := ParseResourceAddress(tc)
+		if err != nil {
+			t.Fatalf("%s: unexpected err: %s", tc, err)
+		}
+
+		if actual := addr.String(); actual != tc {
+			t.Fatalf("%s: bad string: %s", tc, actual)
+		}
+
+		reparsed, err := ParseResourceAddress(addr.String())
+		if err != nil {
+			t.Fatalf("%s: unexpected err reparsing: %s", tc, err)
+		}
+		if !reflect.DeepEqual(reparsed, addr) {
+			t.Fatalf("%s: bad reparse\n\nexpected:\n%#v\n\ngot:\n%#v", tc, addr, reparsed)
+		}
+
+		if copied := addr.Copy(); !reflect.DeepEqual(copied, addr) {
+			t.Fatalf("%s: bad copy\n\nexpected:\n%#v\n\ngot:\n%#v", tc, addr, copied)
+		}
+	}
+}
+
 func TestResourceAddressEquals(t *testing.T) {
 	cases := map[string]struct {
 		Address *ResourceAddress
@@ -603,3 +655,76 @@ func TestResourceAddressStateId(t *testing.T) {
 		})
 	}
 }
+
+func TestResourceAddressContains(t *testing.T) {
+	cases := map[string]struct {
+		Target string
+		Other  string
+		Expect bool
+	}{
+		"exact match": {
+			"aws_instance.foo[2]", "aws_instance.foo[2]", true,
+		},
+		"index mismatch": {
+			"aws_instance.foo[2]", "aws_instance.foo[1]", false,
+		},
+		"target with index, other without": {
+			"aws_instance.foo[2]", "aws_instance.foo", false,
+		},
+		"target index zero, other without": {
+			"aws_instance.foo[0]", "aws_instance.foo", true,
+		},
+		"target without index contains all indices": {
+			"aws_instance.foo", "aws_instance.foo[3]", true,
+		},
+		"name mismatch": {
+			"aws_instance.foo", "aws_instance.bar", false,
+		},
+		"type mismatch": {
+			"aws_instance.foo", "aws_elb.foo", false,
+		},
+		"mode mismatch": {
+			"data.aws_instance.foo", "aws_instance.foo", false,
+		},
+		"module resource": {
+			"module.child.aws_instance.foo", "module.child.aws_instance.foo[1]", true,
+		},
+		"resource in different module": {
+			"module.child.aws_instance.foo", "aws_instance.foo", false,
+		},
+		"resource target does not contain descendant modules": {
+			"module.child.aws_instance.foo",
+			"module.child.module.grandchild.aws_instance.foo",
+			false,
+		},
+		"module contains its resources": {
+			"module.child", "module.child.aws_instance.foo[1]", true,
+		},
+		"module contains descendant resources": {
+			"module.child", "module.child.module.grandchild.aws_instance.foo", true,
+		},
+		"module does not contain root resources": {
+			"module.child", "aws_instance.foo", false,
+		},
+		"module does not contain sibling modules": {
+			"module.child", "module.other.aws_instance.foo", false,
+		},
+	}
+
+	for tn, tc := range cases {
+		target, err := ParseResourceAddress(tc.Target)
+		if err != nil {
+			t.Fatalf("%s: err: %s", tn, err)
+		}
+		other, err := ParseResourceAddress(tc.Other)
+		if err != nil {
+			t.Fatalf("%s: err: %s", tn, err)
+		}
+
+		actual := target.Contains(other)
+		if actual != tc.Expect {
+			t.Fatalf("%q: expected contains: %t, got %t for:\n%#v\n%#v",
+				tn, tc.Expect, actual, target, other)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package terraform
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/terraform/config/module"
+	"github.com/hashicorp/terraform/dag"
+)
+
+// ResourceDependents returns the addresses of the resources in the
+// configuration that reference the resource at addr, either directly or
+// through other resources, variables and outputs. This is useful to find
+// out what a change to a resource may impact.
+//
+// The references are the same that order the graph walks, which includes
+// depends_on and the connection info of provisioners. The query is done
+// on the configuration, so it doesn't tell the instances of a counted
+// resource apart: any index in addr is ignored, and the dependents are
+// returned without an index.
+//
+// Nothing is evaluated and the configuration isn't validated, so this can
+// be called on any loaded module tree.
+func ResourceDependents(m *module.Tree, addr *ResourceAddress) ([]*ResourceAddress, error) {
+	// Everything that can reach the resource depends on it
+	return resourceReferences(m, addr, func(g *Graph, v dag.Vertex) (*dag.Set, error) {
+		return g.Descendents(v)
+	})
+}
+
+// ResourceDependencies returns the addresses of the resources in the
+// configuration that the resource at addr references, either directly or
+// through other resources, variables and outputs. These are the resources
+// that must exist for the resource to be applied.
+//
+// The same as for ResourceDependents, any index in addr is ignored and
+// the dependencies are returned without an index.
+func ResourceDependencies(m *module.Tree, addr *ResourceAddress) ([]*ResourceAddress, error) {
+	// Everything the resource can reach is a dependency
+	return resourceReferences(m, addr, func(g *Graph, v dag.Vertex) (*dag.Set, error) {
+		return g.Ancestors(v)
+	})
+}
+
+// ExpandTargets returns the targets together with the addresses of all
+// the resources that the targeted resources depend on, see
+// ResourceDependencies. The targets are returned first and as given,
+// followed by the dependencies that aren't targets already, sorted.
+// Targets that aren't resources, such as modules, aren't expanded.
+func ExpandTargets(m *module.Tree, targets []string) ([]string, error) {
+	result := make([]string, len(targets))
+	copy(result, targets)
+
+	seen := make(map[string]struct{})
+	for _, t := range targets {
+		seen[t] = struct{}{}
+	}
+
+	var deps []string
+	for _, t := range targets {
+		addr, err := ParseResourceAddress(t)
+		if err != nil {
+			return nil, fmt.Errorf("target %q: %s", t, err)
+		}
+		if addr.Type == "" || addr.Name == "" {
+			continue
+		}
+
+		addrs, err := ResourceDependencies(m, addr)
+		if err != nil {
+			return nil, fmt.Errorf("target %q: %s", t, err)
+		}
+
+		for _, a := range addrs {
+			k := a.String()
+			if _, ok := seen[k]; ok {
+				continue
+			}
+
+			seen[k] = struct{}{}
+			deps = append(deps, k)
+		}
+	}
+
+	sort.Strings(deps)
+	return append(result, deps...), nil
+}
+
+// resourceReferences returns the resources that the function related
+// returns for the vertices of the resource at addr, in a graph of the
+// references in the configuration.
+func resourceReferences(
+	m *module.Tree,
+	addr *ResourceAddress,
+	related func(*Graph, dag.Vertex) (*dag.Set, error)) ([]*ResourceAddress, error) {
+	if addr.Type == "" || addr.Name == "" {
+		return nil, fmt.Errorf("%s is not a resource address", addr)
+	}
+
+	target := addr.Copy()
+	target.Index = -1
+
+	concrete := func(a *NodeAbstractResource) dag.Vertex {
+		return &NodeApplyableResource{NodeAbstractResource: a}
+	}
+
+	g, err := (&BasicGraphBuilder{
+		Steps: []GraphTransformer{
+			&ConfigTransformer{Concrete: concrete, Module: m},
+			&OutputTransformer{Module: m},
+			&AttachResourceConfigTransformer{Module: m},
+			&RootVariableTransformer{Module: m},
+			&ModuleVariableTransformer{Module: m},
+			&ReferenceTransformer{},
+		},
+		Name: "ResourceReferences",
+	}).Build(RootModulePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// Find the resource we're looking for
+	var found []dag.Vertex
+	for _, v := range g.Vertices() {
+		if rn, ok := v.(GraphNodeResource); ok && target.Equals(rn.ResourceAddr()) {
+			found = append(found, v)
+		}
+	}
+	if len(found) == 0 {
+		return nil, fmt.Errorf("%s is not in the configuration", addr)
+	}
+
+	// Only the resources are returned, variables and outputs are just the
+	// way there.
+	seen := make(map[string]*ResourceAddress)
+	for _, v := range found {
+		vs, err := related(g, v)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, raw := range vs.List() {
+			rn, ok := raw.(GraphNodeResource)
+			if !ok {
+				continue
+			}
+
+			a := rn.ResourceAddr()
+			if target.Equals(a) {
+				continue
+			}
+
+			seen[a.String()] = a
+		}
+	}
+
+	keys := make([]string, 0, len(seen))
+	for k := range seen {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	result := make([]*ResourceAddress, len(keys))
+	for i, k := range keys {
+		result[i] = seen[k]
+	}
+
+	return result, nil
+}
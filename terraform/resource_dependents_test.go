@@ -0,0 +1,207 @@
+package terraform
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResourceDependents(t *testing.T) {
+	cases := map[string]struct {
+		Addr     string
+		Expected []string
+	}{
+		"direct and transitive": {
+			"aws_vpc.main",
+			[]string{
+				"aws_instance.after",
+				"aws_instance.bastion",
+				"aws_instance.from_child",
+				"aws_instance.web",
+				"aws_subnet.a",
+				"module.child.aws_instance.child",
+			},
+		},
+
+		"through depends_on": {
+			"aws_subnet.a",
+			[]string{
+				"aws_instance.after",
+				"aws_instance.web",
+			},
+		},
+
+		"index is ignored": {
+			"aws_instance.web[1]",
+			[]string{
+				"aws_instance.after",
+			},
+		},
+
+		"through a module output": {
+			"module.child.aws_instance.child",
+			[]string{
+				"aws_instance.from_child",
+			},
+		},
+
+		"no dependents": {
+			"aws_instance.unrelated",
+			[]string{},
+		},
+	}
+
+	m := testModule(t, "resource-dependents")
+	for k, tc := range cases {
+		addr, err := ParseResourceAddress(tc.Addr)
+		if err != nil {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+
+		result, err := ResourceDependents(m, addr)
+		if err != nil {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+
+		actual := make([]string, len(result))
+		for i, a := range result {
+			actual[i] = a.String()
+		}
+		if !reflect.DeepEqual(actual, tc.Expected) {
+			t.Fatalf("%s: bad: %#v", k, actual)
+		}
+	}
+}
+
+func TestResourceDependents_notFound(t *testing.T) {
+	m := testModule(t, "resource-dependents")
+	for _, v := range []string{"aws_instance.nope", "module.child"} {
+		addr, err := ParseResourceAddress(v)
+		if err != nil {
+			t.Fatalf("%s: err: %s", v, err)
+		}
+
+		if _, err := ResourceDependents(m, addr); err == nil {
+			t.Fatalf("%s: should error", v)
+		}
+	}
+}
+
+func TestResourceDependencies(t *testing.T) {
+	cases := map[string]struct {
+		Addr     string
+		Expected []string
+	}{
+		"direct and transitive": {
+			"aws_instance.web",
+			[]string{
+				"aws_subnet.a",
+				"aws_vpc.main",
+			},
+		},
+
+		"through depends_on": {
+			"aws_instance.after",
+			[]string{
+				"aws_instance.web",
+				"aws_subnet.a",
+				"aws_vpc.main",
+			},
+		},
+
+		"index is ignored": {
+			"aws_instance.web[1]",
+			[]string{
+				"aws_subnet.a",
+				"aws_vpc.main",
+			},
+		},
+
+		"through a module output": {
+			"aws_instance.from_child",
+			[]string{
+				"aws_vpc.main",
+				"module.child.aws_instance.child",
+			},
+		},
+
+		"through a module variable": {
+			"module.child.aws_instance.child",
+			[]string{
+				"aws_vpc.main",
+			},
+		},
+
+		"no dependencies": {
+			"aws_vpc.main",
+			[]string{},
+		},
+	}
+
+	m := testModule(t, "resource-dependents")
+	for k, tc := range cases {
+		addr, err := ParseResourceAddress(tc.Addr)
+		if err != nil {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+
+		result, err := ResourceDependencies(m, addr)
+		if err != nil {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+
+		actual := make([]string, len(result))
+		for i, a := range result {
+			actual[i] = a.String()
+		}
+		if !reflect.DeepEqual(actual, tc.Expected) {
+			t.Fatalf("%s: bad: %#v", k, actual)
+		}
+	}
+}
+
+func TestExpandTargets(t *testing.T) {
+	cases := map[string]struct {
+		Targets  []string
+		Expected []string
+	}{
+		"dependencies are added": {
+			[]string{"aws_instance.web[1]"},
+			[]string{
+				"aws_instance.web[1]",
+				"aws_subnet.a",
+				"aws_vpc.main",
+			},
+		},
+
+		"targets are not repeated": {
+			[]string{"aws_subnet.a", "aws_instance.after"},
+			[]string{
+				"aws_subnet.a",
+				"aws_instance.after",
+				"aws_instance.web",
+				"aws_vpc.main",
+			},
+		},
+
+		"dependents are not added": {
+			[]string{"aws_vpc.main"},
+			[]string{"aws_vpc.main"},
+		},
+
+		"modules are not expanded": {
+			[]string{"module.child"},
+			[]string{"module.child"},
+		},
+	}
+
+	m := testModule(t, "resource-dependents")
+	for k, tc := range cases {
+		actual, err := ExpandTargets(m, tc.Targets)
+		if err != nil {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+		if !reflect.DeepEqual(actual, tc.Expected) {
+			t.Fatalf("%s: bad: %#v", k, actual)
+		}
+	}
+}
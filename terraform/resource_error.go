@@ -0,0 +1,74 @@
+package terraform
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// ResourceError is an error that occurred while applying a single
+// resource instance. The original error is preserved in Err so that
+// callers can inspect it.
+type ResourceError struct {
+	// Addr is the address of the resource instance, in the format
+	// returned by ResourceAddress.String.
+	Addr string
+
+	// Id is the ID of the resource instance within its module, used to
+	// prefix the error message.
+	Id string
+
+	Err error
+}
+
+func newResourceError(info *InstanceInfo, err error) *ResourceError {
+	addr := info.HumanId()
+	if ra, perr := parseResourceAddressInternal(info.Id); perr == nil {
+		if len(info.ModulePath) > 1 {
+			ra.Path = info.ModulePath[1:]
+		}
+
+		addr = ra.String()
+	}
+
+	return &ResourceError{
+		Addr: addr,
+		Id:   info.Id,
+		Err:  err,
+	}
+}
+
+func (e *ResourceError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Id, e.Err)
+}
+
+// WrappedErrors implements errwrap.Wrapper.
+func (e *ResourceError) WrappedErrors() []error {
+	return []error{e.Err}
+}
+
+// ResourceErrors returns all the resource errors contained in the given
+// error, keyed by resource address. This looks through multierrors, so
+// it can be used on the error returned by an operation such as Apply to
+// find every resource that failed. If a resource has more than one error,
+// they're combined into a multierror.
+func ResourceErrors(err error) map[string]error {
+	result := make(map[string]error)
+	collectResourceErrors(err, result)
+	return result
+}
+
+func collectResourceErrors(err error, result map[string]error) {
+	switch e := err.(type) {
+	case *ResourceError:
+		if prev, ok := result[e.Addr]; ok {
+			result[e.Addr] = multierror.Append(prev, e.Err)
+		} else {
+			result[e.Addr] = e.Err
+		}
+	case *multierror.Error:
+		for _, e := range e.Errors {
+			collectResourceErrors(e, result)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package terraform
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+func TestResourceError(t *testing.T) {
+	cases := map[string]struct {
+		Info    *InstanceInfo
+		Addr    string
+		Message string
+	}{
+		"root": {
+			&InstanceInfo{Id: "aws_instance.foo", ModulePath: rootModulePath},
+			"aws_instance.foo",
+			"aws_instance.foo: failure",
+		},
+
+		"count": {
+			&InstanceInfo{Id: "aws_instance.foo.1", ModulePath: rootModulePath},
+			"aws_instance.foo[1]",
+			"aws_instance.foo.1: failure",
+		},
+
+		"module": {
+			&InstanceInfo{
+				Id:         "data.null_data_source.foo",
+				ModulePath: []string{"root", "child"},
+			},
+			"module.child.data.null_data_source.foo",
+			"data.null_data_source.foo: failure",
+		},
+	}
+
+	for k, tc := range cases {
+		err := newResourceError(tc.Info, errors.New("failure"))
+		if err.Addr != tc.Addr {
+			t.Fatalf("%s: bad addr: %s", k, err.Addr)
+		}
+		if err.Error() != tc.Message {
+			t.Fatalf("%s: bad message: %s", k, err.Error())
+		}
+	}
+}
+
+func TestResourceErrors(t *testing.T) {
+	errA := errors.New("a")
+	errB := errors.New("b")
+	errProv := errors.New("provisioner")
+	errOther := errors.New("other")
+
+	infoA := &InstanceInfo{Id: "aws_instance.a", ModulePath: rootModulePath}
+	infoB := &InstanceInfo{Id: "aws_instance.b", ModulePath: rootModulePath}
+
+	var nested error
+	nested = multierror.Append(nested, newResourceError(infoB, errB))
+	nested = multierror.Append(nested, newResourceError(infoB, errProv))
+
+	var err error
+	err = multierror.Append(err, newResourceError(infoA, errA))
+	err = multierror.Append(err, errOther)
+	err = multierror.Append(err, &multierror.Error{Errors: []error{nested}})
+
+	actual := ResourceErrors(err)
+	expected := map[string]error{
+		"aws_instance.a": errA,
+		"aws_instance.b": &multierror.Error{Errors: []error{errB, errProv}},
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	if len(ResourceErrors(errOther)) != 0 {
+		t.Fatal("should have no resource errors")
+	}
+}
@@ -160,10 +160,80 @@ type ResourceProviderCloser interface {
 	Close() error
 }
 
+// ResourceProviderVersioner is an interface that providers that can report
+// their version must implement. The version is checked against the version
+// constraint of the provider configuration. An empty version means the
+// provider doesn't know its version.
+type ResourceProviderVersioner interface {
+	ProviderVersion() (string, error)
+}
+
+// ResourceProviderPlanModifier is an interface that providers that adjust
+// the planned diffs of their resources beyond what Diff does must
+// implement, for example to set defaults that depend on other attributes
+// or to mark attributes as requiring a new resource.
+//
+// PlanModify is called with the diff Diff returned, the state and the
+// configuration it was diffed with, and returns the modified diff. A nil
+// diff leaves it unchanged. The diff can't change the values the
+// configuration sets, and the existing resource is replaced by marking
+// the attributes RequiresNew rather than by setting Destroy.
+type ResourceProviderPlanModifier interface {
+	PlanModify(
+		*InstanceInfo,
+		*InstanceState,
+		*ResourceConfig,
+		*InstanceDiff) (*InstanceDiff, error)
+}
+
+// ResourceProviderImportIDParser is an interface that providers whose
+// import IDs hold more than the ID of the resource, such as "region/id",
+// can implement.
+//
+// ParseImportID is called with the ID the user gave to import a resource,
+// before ImportState, and returns the attributes of the initial state of
+// the imported resource that the ID holds. They're added to the state
+// ImportState returns for the resource, unless it sets them itself. A
+// malformed ID must return an error that explains the format it expects.
+type ResourceProviderImportIDParser interface {
+	ParseImportID(*InstanceInfo, string) (map[string]string, error)
+}
+
+// ResourceProviderRetryClassifier is an interface that providers that can
+// tell transient errors apart must implement.
+//
+// IsRetryable is called with an error returned by Apply and returns true
+// if the error is transient (rate limiting, temporary network failures,
+// etc.) and the same Apply may succeed if it is retried. Retries only
+// happen for resources that enable them with a "retry" block in their
+// lifecycle configuration, and never for providers that don't implement
+// this interface.
+type ResourceProviderRetryClassifier interface {
+	IsRetryable(error) bool
+}
+
+// ResourceProviderValueNormalizer is an interface that providers that
+// normalize the values of attributes while diffing, such as JSON documents
+// with their keys in another order or names that only differ in case, can
+// implement.
+//
+// DiffValuesEquivalent is called when the diff of a resource from the plan
+// and the diff computed again during apply don't change the same attribute
+// with the given key. It's called with the value of the attribute from the
+// plan and the value during apply, and returns true if the values are
+// semantically equal, so that the apply can continue.
+type ResourceProviderValueNormalizer interface {
+	DiffValuesEquivalent(*InstanceInfo, string, string, string) bool
+}
+
 // ResourceType is a type of resource that a resource provider can manage.
 type ResourceType struct {
 	Name       string // Name of the resource, example "instance" (no provider prefix)
 	Importable bool   // Whether this resource supports importing
+
+	// Schema describes the attributes of the resource. This is optional,
+	// and when it is nil the attributes aren't validated by core.
+	Schema *ResourceSchema
 }
 
 // DataSource is a data source that a resource provider implements.
@@ -36,12 +36,31 @@ type MockResourceProvider struct {
 	DiffFn                         func(*InstanceInfo, *InstanceState, *ResourceConfig) (*InstanceDiff, error)
 	DiffReturn                     *InstanceDiff
 	DiffReturnError                error
+	PlanModifyCalled               bool
+	PlanModifyInfo                 *InstanceInfo
+	PlanModifyState                *InstanceState
+	PlanModifyConfig               *ResourceConfig
+	PlanModifyDiff                 *InstanceDiff
+	PlanModifyFn                   func(*InstanceInfo, *InstanceState, *ResourceConfig, *InstanceDiff) (*InstanceDiff, error)
+	PlanModifyReturn               *InstanceDiff
+	PlanModifyReturnError          error
 	RefreshCalled                  bool
 	RefreshInfo                    *InstanceInfo
 	RefreshState                   *InstanceState
 	RefreshFn                      func(*InstanceInfo, *InstanceState) (*InstanceState, error)
 	RefreshReturn                  *InstanceState
 	RefreshReturnError             error
+	IsRetryableCalled              bool
+	IsRetryableError               error
+	IsRetryableFn                  func(error) bool
+	IsRetryableReturn              bool
+	DiffValuesEquivalentCalled     bool
+	DiffValuesEquivalentInfo       *InstanceInfo
+	DiffValuesEquivalentKey        string
+	DiffValuesEquivalentOld        string
+	DiffValuesEquivalentNew        string
+	DiffValuesEquivalentFn         func(*InstanceInfo, string, string, string) bool
+	DiffValuesEquivalentReturn     bool
 	ResourcesCalled                bool
 	ResourcesReturn                []ResourceType
 	ReadDataApplyCalled            bool
@@ -85,6 +104,17 @@ type MockResourceProvider struct {
 	ImportStateReturn      []*InstanceState
 	ImportStateReturnError error
 	ImportStateFn          func(*InstanceInfo, string) ([]*InstanceState, error)
+
+	ParseImportIDCalled      bool
+	ParseImportIDInfo        *InstanceInfo
+	ParseImportIDID          string
+	ParseImportIDReturn      map[string]string
+	ParseImportIDReturnError error
+	ParseImportIDFn          func(*InstanceInfo, string) (map[string]string, error)
+
+	ProviderVersionCalled      bool
+	ProviderVersionReturn      string
+	ProviderVersionReturnError error
 }
 
 func (p *MockResourceProvider) Close() error {
@@ -92,6 +122,14 @@ func (p *MockResourceProvider) Close() error {
 	return p.CloseError
 }
 
+func (p *MockResourceProvider) ProviderVersion() (string, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.ProviderVersionCalled = true
+	return p.ProviderVersionReturn, p.ProviderVersionReturnError
+}
+
 func (p *MockResourceProvider) Input(
 	input UIInput, c *ResourceConfig) (*ResourceConfig, error) {
 	p.InputCalled = true
@@ -193,6 +231,26 @@ func (p *MockResourceProvider) Diff(
 	return p.DiffReturn.DeepCopy(), p.DiffReturnError
 }
 
+func (p *MockResourceProvider) PlanModify(
+	info *InstanceInfo,
+	state *InstanceState,
+	c *ResourceConfig,
+	diff *InstanceDiff) (*InstanceDiff, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.PlanModifyCalled = true
+	p.PlanModifyInfo = info
+	p.PlanModifyState = state
+	p.PlanModifyConfig = c
+	p.PlanModifyDiff = diff
+	if p.PlanModifyFn != nil {
+		return p.PlanModifyFn(info, state, c, diff)
+	}
+
+	return p.PlanModifyReturn.DeepCopy(), p.PlanModifyReturnError
+}
+
 func (p *MockResourceProvider) Refresh(
 	info *InstanceInfo,
 	s *InstanceState) (*InstanceState, error) {
@@ -210,6 +268,36 @@ func (p *MockResourceProvider) Refresh(
 	return p.RefreshReturn.DeepCopy(), p.RefreshReturnError
 }
 
+func (p *MockResourceProvider) IsRetryable(err error) bool {
+	p.Lock()
+	defer p.Unlock()
+
+	p.IsRetryableCalled = true
+	p.IsRetryableError = err
+	if p.IsRetryableFn != nil {
+		return p.IsRetryableFn(err)
+	}
+
+	return p.IsRetryableReturn
+}
+
+func (p *MockResourceProvider) DiffValuesEquivalent(
+	info *InstanceInfo, k, old, new string) bool {
+	p.Lock()
+	defer p.Unlock()
+
+	p.DiffValuesEquivalentCalled = true
+	p.DiffValuesEquivalentInfo = info
+	p.DiffValuesEquivalentKey = k
+	p.DiffValuesEquivalentOld = old
+	p.DiffValuesEquivalentNew = new
+	if p.DiffValuesEquivalentFn != nil {
+		return p.DiffValuesEquivalentFn(info, k, old, new)
+	}
+
+	return p.DiffValuesEquivalentReturn
+}
+
 func (p *MockResourceProvider) Resources() []ResourceType {
 	p.Lock()
 	defer p.Unlock()
@@ -240,6 +328,20 @@ func (p *MockResourceProvider) ImportState(info *InstanceInfo, id string) ([]*In
 	return result, p.ImportStateReturnError
 }
 
+func (p *MockResourceProvider) ParseImportID(info *InstanceInfo, id string) (map[string]string, error) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.ParseImportIDCalled = true
+	p.ParseImportIDInfo = info
+	p.ParseImportIDID = id
+	if p.ParseImportIDFn != nil {
+		return p.ParseImportIDFn(info, id)
+	}
+
+	return p.ParseImportIDReturn, p.ParseImportIDReturnError
+}
+
 func (p *MockResourceProvider) ValidateDataSource(t string, c *ResourceConfig) ([]string, []error) {
 	p.Lock()
 	defer p.Unlock()
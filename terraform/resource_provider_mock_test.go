@@ -7,4 +7,9 @@ import (
 func TestMockResourceProvider_impl(t *testing.T) {
 	var _ ResourceProvider = new(MockResourceProvider)
 	var _ ResourceProviderCloser = new(MockResourceProvider)
+	var _ ResourceProviderVersioner = new(MockResourceProvider)
+	var _ ResourceProviderPlanModifier = new(MockResourceProvider)
+	var _ ResourceProviderImportIDParser = new(MockResourceProvider)
+	var _ ResourceProviderRetryClassifier = new(MockResourceProvider)
+	var _ ResourceProviderValueNormalizer = new(MockResourceProvider)
 }
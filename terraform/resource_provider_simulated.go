@@ -0,0 +1,247 @@
+package terraform
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/terraform/config"
+	"github.com/hashicorp/terraform/config/module"
+	"github.com/hashicorp/terraform/flatmap"
+)
+
+// SimulatedProvider is a ResourceProvider that doesn't manage anything
+// real: the attributes of every resource and data source are just its
+// flattened configuration. It lets the graph ordering and interpolations
+// of a configuration be tested by planning and applying it, with
+// SimulatedProviders, without credentials for the real providers.
+//
+// Resources are created when they have no state and updated in place
+// whenever their configuration changes. The attributes that only the real
+// provider knows, which are computed until the resource is created, are
+// set with ComputedAttrs and filled by ComputedFn.
+type SimulatedProvider struct {
+	// ComputedAttrs are the attributes that are computed when a resource
+	// or data source is created, by type, besides the ones set in its
+	// configuration. The "id" is always computed.
+	ComputedAttrs map[string][]string
+
+	// ComputedFn, if set, returns the value of the attribute with the
+	// given key once it's created, for the computed attributes and the
+	// configured values that are only known then. By default the ID is
+	// the human ID of the instance, such as "module.foo.aws_instance.bar",
+	// and the other attributes are the key added to it.
+	ComputedFn func(info *InstanceInfo, key string) (string, error)
+}
+
+// SimulatedProviders returns the providers for ContextOpts.Providers that
+// simulate each provider the resources of the module tree use with p.
+func SimulatedProviders(m *module.Tree, p ResourceProvider) map[string]ResourceProviderFactory {
+	result := make(map[string]ResourceProviderFactory)
+
+	var walk func(*module.Tree)
+	walk = func(t *module.Tree) {
+		if c := t.Config(); c != nil {
+			for _, pc := range c.ProviderConfigs {
+				result[pc.Name] = ResourceProviderFactoryFixed(p)
+			}
+			for _, r := range c.Resources {
+				if r.Mode == config.ValuesResourceMode {
+					continue
+				}
+				name := resourceProvider(r.Type, "")
+				result[name] = ResourceProviderFactoryFixed(p)
+			}
+		}
+
+		for _, child := range t.Children() {
+			walk(child)
+		}
+	}
+	walk(m)
+
+	return result
+}
+
+func (p *SimulatedProvider) Input(
+	input UIInput, c *ResourceConfig) (*ResourceConfig, error) {
+	return c, nil
+}
+
+func (p *SimulatedProvider) Validate(c *ResourceConfig) ([]string, []error) {
+	return nil, nil
+}
+
+func (p *SimulatedProvider) Configure(c *ResourceConfig) error {
+	return nil
+}
+
+func (p *SimulatedProvider) Resources() []ResourceType {
+	return nil
+}
+
+func (p *SimulatedProvider) Stop() error {
+	return nil
+}
+
+func (p *SimulatedProvider) ValidateResource(
+	t string, c *ResourceConfig) ([]string, []error) {
+	return nil, nil
+}
+
+func (p *SimulatedProvider) Apply(
+	info *InstanceInfo,
+	state *InstanceState,
+	diff *InstanceDiff) (*InstanceState, error) {
+	if diff.GetDestroy() {
+		return nil, nil
+	}
+
+	return p.apply(info, state, diff)
+}
+
+func (p *SimulatedProvider) Diff(
+	info *InstanceInfo,
+	state *InstanceState,
+	c *ResourceConfig) (*InstanceDiff, error) {
+	return p.diff(info, state, c), nil
+}
+
+func (p *SimulatedProvider) Refresh(
+	info *InstanceInfo, state *InstanceState) (*InstanceState, error) {
+	return state, nil
+}
+
+func (p *SimulatedProvider) ImportState(
+	info *InstanceInfo, id string) ([]*InstanceState, error) {
+	return []*InstanceState{
+		&InstanceState{
+			ID:        id,
+			Ephemeral: EphemeralState{Type: info.Type},
+		},
+	}, nil
+}
+
+func (p *SimulatedProvider) ValidateDataSource(
+	t string, c *ResourceConfig) ([]string, []error) {
+	return nil, nil
+}
+
+func (p *SimulatedProvider) DataSources() []DataSource {
+	return nil
+}
+
+func (p *SimulatedProvider) ReadDataDiff(
+	info *InstanceInfo, c *ResourceConfig) (*InstanceDiff, error) {
+	return p.diff(info, nil, c), nil
+}
+
+func (p *SimulatedProvider) ReadDataApply(
+	info *InstanceInfo, diff *InstanceDiff) (*InstanceState, error) {
+	return p.apply(info, nil, diff)
+}
+
+// diff returns the diff from the attributes in state to the flattened
+// configuration, with the computed attributes if state doesn't exist.
+func (p *SimulatedProvider) diff(
+	info *InstanceInfo, state *InstanceState, c *ResourceConfig) *InstanceDiff {
+	attrs := make(map[string]string)
+	if c != nil {
+		attrs = flatmap.Flatten(c.Config)
+	}
+
+	exists := state != nil && state.ID != ""
+	var old map[string]string
+	if exists {
+		old = state.Attributes
+	}
+
+	diff := new(InstanceDiff)
+	diff.init()
+	for k, v := range attrs {
+		o, ok := old[k]
+		if ok && o == v {
+			continue
+		}
+
+		attr := &ResourceAttrDiff{Old: o, New: v}
+		if v == config.UnknownVariableValue {
+			attr.New = ""
+			attr.NewComputed = true
+		}
+		diff.SetAttribute(k, attr)
+	}
+
+	computed := p.ComputedAttrs[info.Type]
+	if !exists {
+		diff.SetAttribute("id", &ResourceAttrDiff{
+			NewComputed: true,
+			RequiresNew: true,
+		})
+		for _, k := range computed {
+			if _, ok := attrs[k]; !ok {
+				diff.SetAttribute(k, &ResourceAttrDiff{NewComputed: true})
+			}
+		}
+	}
+
+	for k, o := range old {
+		if _, ok := attrs[k]; ok || k == "id" || strSliceContains(computed, k) {
+			continue
+		}
+
+		diff.SetAttribute(k, &ResourceAttrDiff{Old: o, NewRemoved: true})
+	}
+
+	return diff
+}
+
+// apply returns state with the diff applied and its computed attributes
+// filled.
+func (p *SimulatedProvider) apply(
+	info *InstanceInfo, state *InstanceState, diff *InstanceDiff) (*InstanceState, error) {
+	result := new(InstanceState)
+	if state != nil {
+		result = state.DeepCopy()
+	}
+	result.init()
+
+	for k, attr := range diff.CopyAttributes() {
+		switch {
+		case attr.NewRemoved:
+			delete(result.Attributes, k)
+		case attr.NewComputed:
+			v, err := p.computed(info, k)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", info.HumanId(), err)
+			}
+			result.Attributes[k] = v
+		default:
+			result.Attributes[k] = attr.New
+		}
+	}
+
+	// Core removes the computed ID from the diffs of managed resources
+	// before they're applied.
+	if result.Attributes["id"] == "" {
+		id, err := p.computed(info, "id")
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", info.HumanId(), err)
+		}
+		result.Attributes["id"] = id
+	}
+	result.ID = result.Attributes["id"]
+
+	return result, nil
+}
+
+// computed returns the value of a computed attribute.
+func (p *SimulatedProvider) computed(info *InstanceInfo, k string) (string, error) {
+	if p.ComputedFn != nil {
+		return p.ComputedFn(info, k)
+	}
+
+	if k == "id" {
+		return info.HumanId(), nil
+	}
+
+	return fmt.Sprintf("%s.%s", info.HumanId(), k), nil
+}
@@ -0,0 +1,125 @@
+package terraform
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestSimulatedProvider_impl(t *testing.T) {
+	var _ ResourceProvider = new(SimulatedProvider)
+}
+
+func TestSimulatedProviders(t *testing.T) {
+	m := testModule(t, "simulate-apply")
+	providers := SimulatedProviders(m, new(SimulatedProvider))
+	if len(providers) != 1 || providers["aws"] == nil {
+		t.Fatalf("bad: %#v", providers)
+	}
+}
+
+func TestSimulatedProvider_apply(t *testing.T) {
+	m := testModule(t, "simulate-apply")
+	p := &SimulatedProvider{
+		ComputedAttrs: map[string][]string{
+			"aws_ami": []string{"image_id"},
+			"aws_eip": []string{"public_ip"},
+		},
+		ComputedFn: func(info *InstanceInfo, k string) (string, error) {
+			if k == "public_ip" {
+				return "10.0.0.1", nil
+			}
+			return "simulated-" + info.HumanId(), nil
+		},
+	}
+
+	h := new(simulatedOrderHook)
+	ctx := testContext2(t, &ContextOpts{
+		Module:    m,
+		Providers: SimulatedProviders(m, p),
+		Hooks:     []Hook{h},
+	})
+	if _, err := ctx.Plan(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	state, err := ctx.Apply()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The resources are applied in the order of their dependencies,
+	// across the module.
+	expected := []string{
+		"aws_instance.base",
+		"module.child.aws_eip.ip",
+		"aws_instance.top",
+	}
+	if len(h.applied) != len(expected) {
+		t.Fatalf("bad: %#v", h.applied)
+	}
+	for i, id := range expected {
+		if h.applied[i] != id {
+			t.Fatalf("bad: %#v", h.applied)
+		}
+	}
+
+	checkStateString(t, state, testTerraformSimulatedApplyStr)
+
+	// Applying again doesn't change anything
+	ctx = testContext2(t, &ContextOpts{
+		Module:    m,
+		Providers: SimulatedProviders(m, p),
+		State:     state,
+	})
+	plan, err := ctx.Plan()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !plan.Diff.Empty() {
+		t.Fatalf("bad: %s", plan.Diff)
+	}
+}
+
+// simulatedOrderHook records the order in which resources are applied.
+type simulatedOrderHook struct {
+	NilHook
+
+	applied []string
+	lock    sync.Mutex
+}
+
+func (h *simulatedOrderHook) PostApply(
+	info *InstanceInfo, s *InstanceState, err error) (HookAction, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.applied = append(h.applied, info.HumanId())
+	return HookActionContinue, nil
+}
+
+const testTerraformSimulatedApplyStr = `
+aws_instance.base:
+  ID = simulated-aws_instance.base
+  ami = simulated-data.aws_ami.image
+
+  Dependencies:
+    data.aws_ami.image
+aws_instance.top:
+  ID = simulated-aws_instance.top
+  address = 10.0.0.1
+
+  Dependencies:
+    module.child
+data.aws_ami.image:
+  ID = simulated-data.aws_ami.image
+  image_id = simulated-data.aws_ami.image
+  name = web
+
+module.child:
+  aws_eip.ip:
+    ID = simulated-module.child.aws_eip.ip
+    instance = simulated-aws_instance.base
+    public_ip = 10.0.0.1
+
+  Outputs:
+
+  address = 10.0.0.1
+`
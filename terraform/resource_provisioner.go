@@ -1,5 +1,17 @@
 package terraform
 
+// ProvisionerConfigFunc is called with the interpolated configuration of
+// a provisioner right before it's run for the resource instance, and
+// returns the configuration to run it with, such as one whose commands are
+// wrapped. The name is the type of the provisioner, such as "local-exec".
+//
+// Returning an error fails the provisioner, following its on_failure
+// setting. The function may be called concurrently for different
+// provisioners, and more than once for the same one when a shadow graph
+// is walked too, so it must always return the same configuration.
+type ProvisionerConfigFunc func(
+	info *InstanceInfo, name string, c *ResourceConfig) (*ResourceConfig, error)
+
 // ResourceProvisioner is an interface that must be implemented by any
 // resource provisioner: the thing that initializes resources in
 // a Terraform configuration.
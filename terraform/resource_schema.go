@@ -0,0 +1,117 @@
+package terraform
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ResourceSchema describes the attributes of a resource type, or of a
+// nested block within it. Each attribute with a nested block has the
+// schema of the block, and every other attribute has an empty schema.
+type ResourceSchema struct {
+	Attributes map[string]*ResourceSchema
+
+	// ComputedOnly is true for an attribute that only the provider sets,
+	// so that the configuration can't set it. Attributes that are both
+	// optional and computed can be set.
+	ComputedOnly bool
+}
+
+// HasAttribute returns true if the flatmapped key, such as
+// "ebs_block_device.0.device_name", is an attribute of the schema. The
+// "id" attribute always exists. Anything below a list, set or map of
+// primitive values is allowed since its keys aren't part of the schema.
+func (s *ResourceSchema) HasAttribute(key string) bool {
+	if key == "id" {
+		return true
+	}
+
+	current := s
+	for _, part := range strings.Split(key, ".") {
+		// The keys of the elements and their counts aren't in the schema
+		if len(current.Attributes) == 0 {
+			return true
+		}
+		if part == "#" || part == "%" {
+			continue
+		}
+		if _, err := strconv.Atoi(part); err == nil {
+			continue
+		}
+
+		next, ok := current.Attributes[part]
+		if !ok {
+			return false
+		}
+		if next == nil {
+			return true
+		}
+
+		current = next
+	}
+
+	return true
+}
+
+// ComputedOnlyAttributes returns the computed-only attributes that the
+// raw configuration of a resource, such as ResourceConfig.Raw, sets,
+// sorted. The attributes of nested blocks are flatmapped keys such as
+// "ebs_block_device.0.arn".
+func (s *ResourceSchema) ComputedOnlyAttributes(raw map[string]interface{}) []string {
+	var result []string
+	s.computedOnlyAttributes("", raw, &result)
+	sort.Strings(result)
+
+	return result
+}
+
+func (s *ResourceSchema) computedOnlyAttributes(
+	prefix string, raw map[string]interface{}, result *[]string) {
+	for k, v := range raw {
+		attr, ok := s.Attributes[k]
+		if !ok || attr == nil {
+			continue
+		}
+
+		key := prefix + k
+		if attr.ComputedOnly {
+			*result = append(*result, key)
+			continue
+		}
+		if len(attr.Attributes) == 0 {
+			continue
+		}
+
+		// Nested blocks are lists of maps, or a single map
+		var blocks []interface{}
+		switch v := v.(type) {
+		case []map[string]interface{}:
+			for _, b := range v {
+				blocks = append(blocks, b)
+			}
+		case []interface{}:
+			blocks = v
+		case map[string]interface{}:
+			blocks = []interface{}{v}
+		}
+		for i, b := range blocks {
+			if m, ok := b.(map[string]interface{}); ok {
+				attr.computedOnlyAttributes(fmt.Sprintf("%s.%d.", key, i), m, result)
+			}
+		}
+	}
+}
+
+// providerResourceSchema returns the schema of the resource type t, or nil
+// if the provider doesn't have one.
+func providerResourceSchema(p ResourceProvider, t string) *ResourceSchema {
+	for _, rt := range p.Resources() {
+		if rt.Name == t {
+			return rt.Schema
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package terraform
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResourceSchemaHasAttribute(t *testing.T) {
+	schema := &ResourceSchema{
+		Attributes: map[string]*ResourceSchema{
+			"ami":  &ResourceSchema{},
+			"tags": &ResourceSchema{},
+			"disk": &ResourceSchema{
+				Attributes: map[string]*ResourceSchema{
+					"size": &ResourceSchema{},
+				},
+			},
+		},
+	}
+
+	cases := map[string]bool{
+		"id":          true,
+		"ami":         true,
+		"tags.Name":   true,
+		"tags.%":      true,
+		"disk":        true,
+		"disk.#":      true,
+		"disk.0.size": true,
+		"disk.0.type": false,
+		"nope":        false,
+		"nope.0":      false,
+	}
+
+	for k, expected := range cases {
+		if actual := schema.HasAttribute(k); actual != expected {
+			t.Fatalf("%s: expected %t, got %t", k, expected, actual)
+		}
+	}
+}
+
+func TestResourceSchemaComputedOnlyAttributes(t *testing.T) {
+	schema := &ResourceSchema{
+		Attributes: map[string]*ResourceSchema{
+			"ami":  &ResourceSchema{},
+			"arn":  &ResourceSchema{ComputedOnly: true},
+			"tags": &ResourceSchema{},
+			"disk": &ResourceSchema{
+				Attributes: map[string]*ResourceSchema{
+					"size": &ResourceSchema{},
+					"id":   &ResourceSchema{ComputedOnly: true},
+				},
+			},
+		},
+	}
+
+	raw := map[string]interface{}{
+		"ami":  "foo",
+		"arn":  "${var.arn}",
+		"tags": map[string]interface{}{"arn": "bar"},
+		"disk": []map[string]interface{}{
+			map[string]interface{}{"size": 1},
+			map[string]interface{}{"size": 2, "id": "baz"},
+		},
+		"nope": "qux",
+	}
+
+	actual := schema.ComputedOnlyAttributes(raw)
+	expected := []string{"arn", "disk.1.id"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
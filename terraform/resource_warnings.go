@@ -0,0 +1,81 @@
+package terraform
+
+import (
+	"sort"
+	"sync"
+)
+
+// PlanWarning is a warning a provider reported for resources while they
+// were planned. The same warning reported for more than one resource is
+// only in the plan once, with all the resources it was reported for.
+type PlanWarning struct {
+	Message string
+
+	// Resources are the addresses of the resource instances the warning
+	// was reported for, sorted.
+	Resources []string
+}
+
+// resourceWarnings collects the warnings reported for resources during a
+// walk, grouped by message.
+type resourceWarnings struct {
+	sync.Mutex
+
+	// warnings maps the message of a warning to the set of addresses it
+	// was reported for.
+	warnings map[string]map[string]struct{}
+}
+
+// add records the warnings for the resource instance at addr.
+func (w *resourceWarnings) add(addr *ResourceAddress, warns []string) {
+	w.Lock()
+	defer w.Unlock()
+
+	if w.warnings == nil {
+		w.warnings = make(map[string]map[string]struct{})
+	}
+
+	for _, msg := range warns {
+		addrs, ok := w.warnings[msg]
+		if !ok {
+			addrs = make(map[string]struct{})
+			w.warnings[msg] = addrs
+		}
+
+		addrs[addr.String()] = struct{}{}
+	}
+}
+
+// planWarnings returns the warnings recorded so far, sorted by message.
+func (w *resourceWarnings) planWarnings() []*PlanWarning {
+	w.Lock()
+	defer w.Unlock()
+
+	if len(w.warnings) == 0 {
+		return nil
+	}
+
+	result := make([]*PlanWarning, 0, len(w.warnings))
+	for msg, addrs := range w.warnings {
+		pw := &PlanWarning{
+			Message:   msg,
+			Resources: make([]string, 0, len(addrs)),
+		}
+		for addr := range addrs {
+			pw.Resources = append(pw.Resources, addr)
+		}
+		sort.Strings(pw.Resources)
+
+		result = append(result, pw)
+	}
+	sort.Sort(planWarningSort(result))
+
+	return result
+}
+
+// planWarningSort sorts warnings by message.
+type planWarningSort []*PlanWarning
+
+func (s planWarningSort) Len() int           { return len(s) }
+func (s planWarningSort) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s planWarningSort) Less(i, j int) bool { return s[i].Message < s[j].Message }
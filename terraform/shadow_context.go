@@ -61,8 +61,31 @@ func newShadowContext(c *Context) (*Context, *Context, Shadow) {
 		// Hardcoded to 4 since parallelism in the shadow doesn't matter
 		// a ton since we're doing far less compared to the real side
 		// and our operations are MUCH faster.
+		batchStateUpdates:   c.batchStateUpdates,
+		coalesceProviders:   c.coalesceProviders,
 		parallelSem:         NewSemaphore(4),
 		providerInputConfig: providerInputRaw.(map[string]map[string]interface{}),
+		refreshTargetsOnly:  c.refreshTargetsOnly,
+		replace:             c.replace,
+		forceAttributes:     c.forceAttributes,
+		attributeFilter:     c.attributeFilter,
+		resourceTimeout:     c.resourceTimeout,
+		stateLockTimeout:    c.stateLockTimeout,
+		skipProvisioners:    c.skipProvisioners,
+		skipDestroyProvs:    c.skipDestroyProvs,
+		strictApply:         c.strictApply,
+		tracer:              nil,
+		diffCache:           c.diffCache.copy(),
+		stateInvalidations:  c.stateInvalidations.copy(),
+		managedBy:           c.managedBy,
+		rewriteProvConfig:   c.rewriteProvConfig,
+		stateLog:            nil,
+		applyProgress:       c.applyProgress.copy(),
+		validateUnreachable: c.validateUnreachable,
+		applyStages:         c.applyStages,
+		deferDestroys:       c.deferDestroys,
+		applyGate:           nil,
+		unrefreshedState:    c.unrefreshedState,
 	}
 
 	// Create the real context. This is effectively just a copy of
@@ -86,11 +109,38 @@ func newShadowContext(c *Context) (*Context, *Context, Shadow) {
 		variables: c.variables,
 
 		// l - no copy
+		batchStateUpdates:   c.batchStateUpdates,
+		coalesceProviders:   c.coalesceProviders,
+		destroySem:          c.destroySem,
 		parallelSem:         c.parallelSem,
+		providerParallelism: c.providerParallelism,
 		providerInputConfig: c.providerInputConfig,
+		refreshTargetsOnly:  c.refreshTargetsOnly,
+		replace:             c.replace,
+		forceAttributes:     c.forceAttributes,
+		attributeFilter:     c.attributeFilter,
+		resourceTimeout:     c.resourceTimeout,
+		stateLockTimeout:    c.stateLockTimeout,
 		runContext:          c.runContext,
 		runContextCancel:    c.runContextCancel,
+		runInterrupt:        c.runInterrupt,
+		runInterruptCancel:  c.runInterruptCancel,
 		shadowErr:           c.shadowErr,
+		skipProvisioners:    c.skipProvisioners,
+		skipDestroyProvs:    c.skipDestroyProvs,
+		strictApply:         c.strictApply,
+		tracer:              c.tracer,
+		diffCache:           c.diffCache,
+		stateInvalidations:  c.stateInvalidations,
+		managedBy:           c.managedBy,
+		rewriteProvConfig:   c.rewriteProvConfig,
+		stateLog:            c.stateLog,
+		applyProgress:       c.applyProgress,
+		validateUnreachable: c.validateUnreachable,
+		applyStages:         c.applyStages,
+		deferDestroys:       c.deferDestroys,
+		applyGate:           c.applyGate,
+		unrefreshedState:    c.unrefreshedState,
 	}
 
 	return real, shadow, &shadowContextCloser{
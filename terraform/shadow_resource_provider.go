@@ -69,6 +69,21 @@ func (p *shadowResourceProviderReal) Close() error {
 	return result
 }
 
+func (p *shadowResourceProviderReal) ProviderVersion() (string, error) {
+	var result string
+	var err error
+	if v, ok := p.ResourceProvider.(ResourceProviderVersioner); ok {
+		result, err = v.ProviderVersion()
+	}
+
+	p.Shared.ProviderVersion.SetValue(&shadowResourceProviderVersion{
+		Result:    result,
+		ResultErr: err,
+	})
+
+	return result, err
+}
+
 func (p *shadowResourceProviderReal) Input(
 	input UIInput, c *ResourceConfig) (*ResourceConfig, error) {
 	cCopy := c.DeepCopy()
@@ -204,6 +219,95 @@ func (p *shadowResourceProviderReal) Refresh(
 	return result, err
 }
 
+func (p *shadowResourceProviderReal) ImportState(
+	info *InstanceInfo, id string) ([]*InstanceState, error) {
+	result, err := p.ResourceProvider.ImportState(info, id)
+
+	resultCopy := make([]*InstanceState, len(result))
+	for i, s := range result {
+		resultCopy[i] = s.DeepCopy()
+	}
+	p.Shared.ImportState.SetValue(info.uniqueId(), &shadowResourceProviderImportState{
+		Id:        id,
+		Result:    resultCopy,
+		ResultErr: err,
+	})
+
+	return result, err
+}
+
+func (p *shadowResourceProviderReal) ParseImportID(
+	info *InstanceInfo, id string) (map[string]string, error) {
+	var result map[string]string
+	var err error
+	if parser, ok := p.ResourceProvider.(ResourceProviderImportIDParser); ok {
+		result, err = parser.ParseImportID(info, id)
+	}
+
+	resultCopy := make(map[string]string, len(result))
+	for k, v := range result {
+		resultCopy[k] = v
+	}
+	p.Shared.ParseImportID.SetValue(info.uniqueId(), &shadowResourceProviderParseImportID{
+		Id:        id,
+		Result:    resultCopy,
+		ResultErr: err,
+	})
+
+	return result, err
+}
+
+func (p *shadowResourceProviderReal) PlanModify(
+	info *InstanceInfo,
+	state *InstanceState,
+	c *ResourceConfig,
+	diff *InstanceDiff) (*InstanceDiff, error) {
+	// Thse have to be copied before the call since call can modify
+	stateCopy := state.DeepCopy()
+	configCopy := c.DeepCopy()
+	diffCopy := diff.DeepCopy()
+
+	var result *InstanceDiff
+	var err error
+	if m, ok := p.ResourceProvider.(ResourceProviderPlanModifier); ok {
+		result, err = m.PlanModify(info, state, c, diff)
+	}
+	p.Shared.PlanModify.SetValue(info.uniqueId(), &shadowResourceProviderPlanModify{
+		State:     stateCopy,
+		Config:    configCopy,
+		Diff:      diffCopy,
+		Result:    result.DeepCopy(),
+		ResultErr: err,
+	})
+
+	return result, err
+}
+
+func (p *shadowResourceProviderReal) DiffValuesEquivalent(
+	info *InstanceInfo, k, old, new string) bool {
+	var result bool
+	if n, ok := p.ResourceProvider.(ResourceProviderValueNormalizer); ok {
+		result = n.DiffValuesEquivalent(info, k, old, new)
+	}
+	p.Shared.DiffValuesEquivalent.SetValue(
+		info.uniqueId()+"."+k, &shadowResourceProviderDiffValuesEquivalent{
+			Old:    old,
+			New:    new,
+			Result: result,
+		})
+
+	return result
+}
+
+// IsRetryable isn't recorded, since the shadow never retries.
+func (p *shadowResourceProviderReal) IsRetryable(err error) bool {
+	if c, ok := p.ResourceProvider.(ResourceProviderRetryClassifier); ok {
+		return c.IsRetryable(err)
+	}
+
+	return false
+}
+
 func (p *shadowResourceProviderReal) ValidateDataSource(
 	t string, c *ResourceConfig) ([]string, []error) {
 	key := t
@@ -295,16 +399,22 @@ type shadowResourceProviderShared struct {
 	// the Close() method so that it is closed.
 
 	CloseErr           shadow.Value
+	ProviderVersion    shadow.Value
 	Input              shadow.Value
 	Validate           shadow.Value
 	Configure          shadow.Value
 	ValidateResource   shadow.KeyedValue
 	Apply              shadow.KeyedValue
 	Diff               shadow.KeyedValue
+	PlanModify         shadow.KeyedValue
 	Refresh            shadow.KeyedValue
 	ValidateDataSource shadow.KeyedValue
 	ReadDataDiff       shadow.KeyedValue
 	ReadDataApply      shadow.KeyedValue
+	ImportState        shadow.KeyedValue
+	ParseImportID      shadow.KeyedValue
+
+	DiffValuesEquivalent shadow.KeyedValue
 }
 
 func (p *shadowResourceProviderShared) Close() error {
@@ -341,6 +451,24 @@ func (p *shadowResourceProviderShadow) Close() error {
 	return v.(error)
 }
 
+func (p *shadowResourceProviderShadow) ProviderVersion() (string, error) {
+	raw := p.Shared.ProviderVersion.Value()
+	if raw == nil {
+		return "", nil
+	}
+
+	result, ok := raw.(*shadowResourceProviderVersion)
+	if !ok {
+		p.ErrorLock.Lock()
+		defer p.ErrorLock.Unlock()
+		p.Error = multierror.Append(p.Error, fmt.Errorf(
+			"Unknown 'ProviderVersion' shadow value: %#v", raw))
+		return "", nil
+	}
+
+	return result.Result, result.ResultErr
+}
+
 func (p *shadowResourceProviderShadow) Input(
 	input UIInput, c *ResourceConfig) (*ResourceConfig, error) {
 	// Get the result of the input call
@@ -434,6 +562,101 @@ func (p *shadowResourceProviderShadow) Stop() error {
 	return nil
 }
 
+func (p *shadowResourceProviderShadow) PlanModify(
+	info *InstanceInfo,
+	state *InstanceState,
+	c *ResourceConfig,
+	diff *InstanceDiff) (*InstanceDiff, error) {
+	// Unique key
+	key := info.uniqueId()
+	raw := p.Shared.PlanModify.Value(key)
+	if raw == nil {
+		p.ErrorLock.Lock()
+		defer p.ErrorLock.Unlock()
+		p.Error = multierror.Append(p.Error, fmt.Errorf(
+			"Unknown 'PlanModify' call for %q:\n\n%#v\n\n%#v",
+			key, state, c))
+		return nil, nil
+	}
+
+	result, ok := raw.(*shadowResourceProviderPlanModify)
+	if !ok {
+		p.ErrorLock.Lock()
+		defer p.ErrorLock.Unlock()
+		p.Error = multierror.Append(p.Error, fmt.Errorf(
+			"Unknown 'PlanModify' shadow value for %q: %#v", key, raw))
+		return nil, nil
+	}
+
+	// Compare the parameters, which should be identical
+	if !state.Equal(result.State) {
+		p.ErrorLock.Lock()
+		p.Error = multierror.Append(p.Error, fmt.Errorf(
+			"PlanModify %q had unequal states (real, then shadow):\n\n%#v\n\n%#v",
+			key, result.State, state))
+		p.ErrorLock.Unlock()
+	}
+	if !c.Equal(result.Config) {
+		p.ErrorLock.Lock()
+		p.Error = multierror.Append(p.Error, fmt.Errorf(
+			"PlanModify %q had unequal configs (real, then shadow):\n\n%#v\n\n%#v",
+			key, result.Config, c))
+		p.ErrorLock.Unlock()
+	}
+	if !diff.Equal(result.Diff) {
+		p.ErrorLock.Lock()
+		p.Error = multierror.Append(p.Error, fmt.Errorf(
+			"PlanModify %q had unequal diffs (real, then shadow):\n\n%#v\n\n%#v",
+			key, result.Diff, diff))
+		p.ErrorLock.Unlock()
+	}
+
+	// The result is copied, since the caller changes it and the same
+	// call can be made more than once
+	return result.Result.DeepCopy(), result.ResultErr
+}
+
+func (p *shadowResourceProviderShadow) DiffValuesEquivalent(
+	info *InstanceInfo, k, old, new string) bool {
+	// Unique key
+	key := info.uniqueId() + "." + k
+	raw := p.Shared.DiffValuesEquivalent.Value(key)
+	if raw == nil {
+		p.ErrorLock.Lock()
+		defer p.ErrorLock.Unlock()
+		p.Error = multierror.Append(p.Error, fmt.Errorf(
+			"Unknown 'DiffValuesEquivalent' call for %q", key))
+		return false
+	}
+
+	result, ok := raw.(*shadowResourceProviderDiffValuesEquivalent)
+	if !ok {
+		p.ErrorLock.Lock()
+		defer p.ErrorLock.Unlock()
+		p.Error = multierror.Append(p.Error, fmt.Errorf(
+			"Unknown 'DiffValuesEquivalent' shadow value: %#v", raw))
+		return false
+	}
+
+	// Compare the parameters, which should be identical
+	if old != result.Old || new != result.New {
+		p.ErrorLock.Lock()
+		p.Error = multierror.Append(p.Error, fmt.Errorf(
+			"DiffValuesEquivalent %q had unequal values (real, then shadow): "+
+				"%q => %q, %q => %q",
+			key, result.Old, result.New, old, new))
+		p.ErrorLock.Unlock()
+	}
+
+	return result.Result
+}
+
+// IsRetryable never allows a retry. The shadow replays the results of the
+// real provider, so it never needs to retry an Apply itself.
+func (p *shadowResourceProviderShadow) IsRetryable(err error) bool {
+	return false
+}
+
 func (p *shadowResourceProviderShadow) ValidateResource(t string, c *ResourceConfig) ([]string, []error) {
 	// Unique key
 	key := t
@@ -571,7 +794,9 @@ func (p *shadowResourceProviderShadow) Diff(
 		p.ErrorLock.Unlock()
 	}
 
-	return result.Result, result.ResultErr
+	// The result is copied, since the caller changes it and the same
+	// call can be made more than once
+	return result.Result.DeepCopy(), result.ResultErr
 }
 
 func (p *shadowResourceProviderShadow) Refresh(
@@ -735,12 +960,90 @@ func (p *shadowResourceProviderShadow) ReadDataApply(
 }
 
 func (p *shadowResourceProviderShadow) ImportState(info *InstanceInfo, id string) ([]*InstanceState, error) {
-	panic("import not supported by shadow graph")
+	// Unique key
+	key := info.uniqueId()
+	raw := p.Shared.ImportState.Value(key)
+	if raw == nil {
+		p.ErrorLock.Lock()
+		defer p.ErrorLock.Unlock()
+		p.Error = multierror.Append(p.Error, fmt.Errorf(
+			"Unknown 'import' call for %q: %s", key, id))
+		return nil, nil
+	}
+
+	result, ok := raw.(*shadowResourceProviderImportState)
+	if !ok {
+		p.ErrorLock.Lock()
+		defer p.ErrorLock.Unlock()
+		p.Error = multierror.Append(p.Error, fmt.Errorf(
+			"Unknown 'import' shadow value: %#v", raw))
+		return nil, nil
+	}
+
+	// Compare the parameters, which should be identical
+	if id != result.Id {
+		p.ErrorLock.Lock()
+		p.Error = multierror.Append(p.Error, fmt.Errorf(
+			"Import %q had unequal IDs (real, then shadow): %q, %q",
+			key, result.Id, id))
+		p.ErrorLock.Unlock()
+	}
+
+	states := make([]*InstanceState, len(result.Result))
+	for i, s := range result.Result {
+		states[i] = s.DeepCopy()
+	}
+
+	return states, result.ResultErr
+}
+
+func (p *shadowResourceProviderShadow) ParseImportID(
+	info *InstanceInfo, id string) (map[string]string, error) {
+	// Unique key
+	key := info.uniqueId()
+	raw := p.Shared.ParseImportID.Value(key)
+	if raw == nil {
+		p.ErrorLock.Lock()
+		defer p.ErrorLock.Unlock()
+		p.Error = multierror.Append(p.Error, fmt.Errorf(
+			"Unknown 'ParseImportID' call for %q: %s", key, id))
+		return nil, nil
+	}
+
+	result, ok := raw.(*shadowResourceProviderParseImportID)
+	if !ok {
+		p.ErrorLock.Lock()
+		defer p.ErrorLock.Unlock()
+		p.Error = multierror.Append(p.Error, fmt.Errorf(
+			"Unknown 'ParseImportID' shadow value: %#v", raw))
+		return nil, nil
+	}
+
+	// Compare the parameters, which should be identical
+	if id != result.Id {
+		p.ErrorLock.Lock()
+		p.Error = multierror.Append(p.Error, fmt.Errorf(
+			"ParseImportID %q had unequal IDs (real, then shadow): %q, %q",
+			key, result.Id, id))
+		p.ErrorLock.Unlock()
+	}
+
+	attrs := make(map[string]string, len(result.Result))
+	for k, v := range result.Result {
+		attrs[k] = v
+	}
+
+	return attrs, result.ResultErr
 }
 
 // The structs for the various function calls are put below. These structs
 // are used to carry call information across the real/shadow boundaries.
 
+type shadowResourceProviderVersion struct {
+	Result    string
+	ResultErr error
+}
+
 type shadowResourceProviderInput struct {
 	Config    *ResourceConfig
 	Result    *ResourceConfig
@@ -790,6 +1093,32 @@ type shadowResourceProviderRefresh struct {
 	ResultErr error
 }
 
+type shadowResourceProviderImportState struct {
+	Id        string
+	Result    []*InstanceState
+	ResultErr error
+}
+
+type shadowResourceProviderParseImportID struct {
+	Id        string
+	Result    map[string]string
+	ResultErr error
+}
+
+type shadowResourceProviderPlanModify struct {
+	State     *InstanceState
+	Config    *ResourceConfig
+	Diff      *InstanceDiff
+	Result    *InstanceDiff
+	ResultErr error
+}
+
+type shadowResourceProviderDiffValuesEquivalent struct {
+	Old    string
+	New    string
+	Result bool
+}
+
 type shadowResourceProviderValidateDataSourceWrapper struct {
 	sync.RWMutex
 
@@ -529,3 +529,98 @@ func TestShadowResourceProviderRefresh(t *testing.T) {
 		t.Fatalf("bad: %s", err)
 	}
 }
+
+func TestShadowResourceProviderImportState(t *testing.T) {
+	mock := new(MockResourceProvider)
+	real, shadow := newShadowResourceProvider(mock)
+
+	// Test values
+	info := &InstanceInfo{Id: "foo"}
+	mockResult := []*InstanceState{&InstanceState{ID: "bar"}}
+
+	// Configure the mock
+	mock.ImportStateReturn = mockResult
+
+	// Verify that it blocks until the real func is called
+	var result []*InstanceState
+	var err error
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		result, err = shadow.ImportState(info, "bar")
+	}()
+
+	select {
+	case <-doneCh:
+		t.Fatal("should block until finished")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	// Call the real func
+	realResult, realErr := real.ImportState(info, "bar")
+	if len(realResult) != 1 || !realResult[0].Equal(mockResult[0]) {
+		t.Fatalf("bad: %#v", realResult)
+	}
+	if realErr != nil {
+		t.Fatalf("bad: %#v", realErr)
+	}
+
+	// The shadow should finish now
+	<-doneCh
+
+	// Verify the shadow returned the same values
+	if len(result) != 1 || !result[0].Equal(mockResult[0]) {
+		t.Fatalf("bad: %#v", result)
+	}
+	if err != nil {
+		t.Fatalf("bad: %#v", err)
+	}
+
+	// Verify we have no errors
+	if err := shadow.CloseShadow(); err != nil {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+func TestShadowResourceProviderDiffValuesEquivalent(t *testing.T) {
+	mock := new(MockResourceProvider)
+	real, shadow := newShadowResourceProvider(mock)
+
+	// Test values
+	info := &InstanceInfo{Id: "foo"}
+
+	// Configure the mock
+	mock.DiffValuesEquivalentReturn = true
+
+	// Verify that it blocks until the real func is called
+	var result bool
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		result = shadow.(ResourceProviderValueNormalizer).DiffValuesEquivalent(info, "name", "Foo", "foo")
+	}()
+
+	select {
+	case <-doneCh:
+		t.Fatal("should block until finished")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	// Call the real func
+	if !real.(ResourceProviderValueNormalizer).DiffValuesEquivalent(info, "name", "Foo", "foo") {
+		t.Fatal("real should be equivalent")
+	}
+
+	// The shadow should finish now
+	<-doneCh
+
+	// Verify the shadow returned the same values
+	if !result {
+		t.Fatal("shadow should be equivalent")
+	}
+
+	// Verify we have no errors
+	if err := shadow.CloseShadow(); err != nil {
+		t.Fatalf("bad: %s", err)
+	}
+}
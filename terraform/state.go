@@ -1300,7 +1300,7 @@ func (rsk *ResourceStateKey) String() string {
 	}
 	var prefix string
 	switch rsk.Mode {
-	case config.ManagedResourceMode:
+	case config.ManagedResourceMode, config.ValuesResourceMode:
 		prefix = ""
 	case config.DataResourceMode:
 		prefix = "data."
@@ -1329,6 +1329,9 @@ func ParseResourceStateKey(k string) (*ResourceStateKey, error) {
 	if len(parts) < 2 || len(parts) > 3 {
 		return nil, fmt.Errorf("Malformed resource state key: %s", k)
 	}
+	if mode == config.ManagedResourceMode && parts[0] == config.ValuesResourceType {
+		mode = config.ValuesResourceMode
+	}
 	rsk := &ResourceStateKey{
 		Mode:  mode,
 		Type:  parts[0],
@@ -1395,6 +1398,12 @@ type ResourceState struct {
 	// destroyed and purged.
 	Deposed []*InstanceState `json:"deposed"`
 
+	// Prior is the Primary instance as it was before it was last updated,
+	// for resources with the preserve_prior_state lifecycle setting. It's
+	// only kept so that an update can be rolled back manually, Terraform
+	// itself never acts on it.
+	Prior *InstanceState `json:"prior,omitempty"`
+
 	// Provider is used when a resource is connected to a provider with an alias.
 	// If this string is empty, the resource is connected to the default provider,
 	// e.g. "aws_instance" goes with the "aws" provider.
@@ -1436,6 +1445,9 @@ func (s *ResourceState) Equal(other *ResourceState) bool {
 	if !s.Primary.Equal(other.Primary) {
 		return false
 	}
+	if !s.Prior.Equal(other.Prior) {
+		return false
+	}
 
 	return true
 }
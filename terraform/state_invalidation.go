@@ -0,0 +1,148 @@
+package terraform
+
+import (
+	"fmt"
+	"sync"
+)
+
+// stateInvalidations are the resource instances whose states were
+// invalidated with Context.InvalidateState, so they're refreshed by the
+// next plan. It's safe for concurrent use by the resources being planned.
+type stateInvalidations struct {
+	// addrs are the addresses of the invalidated instances that haven't
+	// been refreshed yet.
+	addrs map[string]struct{}
+
+	// refreshed are the states of the instances refreshed by the plan,
+	// which are kept in the state of the context. See writeRefreshed.
+	refreshed map[string]*refreshedState
+
+	lock sync.Mutex
+}
+
+type refreshedState struct {
+	Path  []string
+	Name  string
+	State *InstanceState
+}
+
+func newStateInvalidations() *stateInvalidations {
+	return &stateInvalidations{
+		addrs:     make(map[string]struct{}),
+		refreshed: make(map[string]*refreshedState),
+	}
+}
+
+// add invalidates the state of the instance with the given address.
+func (s *stateInvalidations) add(addr *ResourceAddress) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.addrs[addr.String()] = struct{}{}
+}
+
+// take returns true if the state of the instance with the given state ID
+// in the module was invalidated, and removes the invalidation so it's
+// only refreshed once. This is safe to call on nil.
+func (s *stateInvalidations) take(path []string, name string) (bool, error) {
+	if s == nil {
+		return false, nil
+	}
+
+	addr, err := stateInvalidationAddr(path, name)
+	if err != nil {
+		return false, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.addrs[addr]; !ok {
+		return false, nil
+	}
+
+	delete(s.addrs, addr)
+	return true, nil
+}
+
+// setRefreshed records the refreshed state of an instance it took.
+func (s *stateInvalidations) setRefreshed(
+	path []string, name string, state *InstanceState) error {
+	addr, err := stateInvalidationAddr(path, name)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.refreshed[addr] = &refreshedState{
+		Path:  normalizeModulePath(path),
+		Name:  name,
+		State: state.DeepCopy(),
+	}
+
+	return nil
+}
+
+// writeRefreshed writes the refreshed states into the given state, and
+// forgets about them. A resource that no longer exists is removed. This is
+// safe to call on nil.
+func (s *stateInvalidations) writeRefreshed(state *State) {
+	if s == nil || state == nil {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, r := range s.refreshed {
+		mod := state.ModuleByPath(r.Path)
+		if mod == nil {
+			continue
+		}
+
+		rs, ok := mod.Resources[r.Name]
+		if !ok {
+			continue
+		}
+
+		if r.State == nil {
+			delete(mod.Resources, r.Name)
+			continue
+		}
+
+		rs.Primary = r.State
+	}
+
+	s.refreshed = make(map[string]*refreshedState)
+}
+
+// copy returns a copy that's changed independently, or nil if s is nil.
+func (s *stateInvalidations) copy() *stateInvalidations {
+	if s == nil {
+		return nil
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	result := newStateInvalidations()
+	for k := range s.addrs {
+		result.addrs[k] = struct{}{}
+	}
+
+	return result
+}
+
+// stateInvalidationAddr returns the address that identifies the instance
+// with the given state ID in the module with the given path.
+func stateInvalidationAddr(path []string, name string) (string, error) {
+	addr, err := parseResourceAddressInternal(name)
+	if err != nil {
+		return "", fmt.Errorf("invalid state ID %q: %s", name, err)
+	}
+	addr.Path = normalizeModulePath(path)[1:]
+
+	return addr.String(), nil
+}
@@ -0,0 +1,98 @@
+package terraform
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestStateInvalidations(t *testing.T) {
+	s := newStateInvalidations()
+	for _, v := range []string{"aws_instance.foo[1]", "module.child.aws_instance.bar"} {
+		addr, err := ParseResourceAddress(v)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		s.add(addr)
+	}
+
+	// Other resources are taken concurrently without being invalidated
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			ok, err := s.take(rootModulePath, fmt.Sprintf("aws_instance.other.%d", i))
+			if err != nil || ok {
+				t.Errorf("%d: bad: %t %s", i, ok, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	cases := []struct {
+		Path     []string
+		Name     string
+		Expected bool
+	}{
+		{rootModulePath, "aws_instance.foo.0", false},
+		{rootModulePath, "aws_instance.foo.1", true},
+		{rootModulePath, "aws_instance.foo.1", false},
+		{rootModulePath, "aws_instance.bar", false},
+		{[]string{"root", "child"}, "aws_instance.bar", true},
+	}
+	for i, tc := range cases {
+		ok, err := s.take(tc.Path, tc.Name)
+		if err != nil {
+			t.Fatalf("%d: err: %s", i, err)
+		}
+		if ok != tc.Expected {
+			t.Fatalf("%d: bad: %t", i, ok)
+		}
+	}
+}
+
+func TestStateInvalidationsWriteRefreshed(t *testing.T) {
+	state := &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Type:    "aws_instance",
+						Primary: &InstanceState{ID: "foo"},
+					},
+					"aws_instance.bar": &ResourceState{
+						Type:    "aws_instance",
+						Primary: &InstanceState{ID: "bar"},
+					},
+				},
+			},
+		},
+	}
+
+	s := newStateInvalidations()
+	refreshed := &InstanceState{ID: "refreshed"}
+	if err := s.setRefreshed(rootModulePath, "aws_instance.foo", refreshed); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := s.setRefreshed(rootModulePath, "aws_instance.bar", nil); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	s.writeRefreshed(state)
+	checkStateString(t, state, `
+aws_instance.foo:
+  ID = refreshed
+	`)
+
+	// Nothing is written again
+	state.RootModule().Resources["aws_instance.foo"].Primary.ID = "foo"
+	s.writeRefreshed(state)
+	checkStateString(t, state, `
+aws_instance.foo:
+  ID = foo
+	`)
+}
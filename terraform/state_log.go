@@ -0,0 +1,123 @@
+package terraform
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"sync"
+)
+
+// StateTransitionAction is what a write of the state of a resource
+// instance did, see StateTransition.
+type StateTransitionAction string
+
+const (
+	StateTransitionCreate  StateTransitionAction = "create"
+	StateTransitionUpdate  StateTransitionAction = "update"
+	StateTransitionDestroy StateTransitionAction = "destroy"
+
+	// StateTransitionDepose and StateTransitionUndepose are the moves of
+	// the primary instance to the deposed instances and back, for
+	// create_before_destroy.
+	StateTransitionDepose   StateTransitionAction = "depose"
+	StateTransitionUndepose StateTransitionAction = "undepose"
+)
+
+// StateTransition is a record of a single change to the state of a
+// resource instance. A line of JSON with one is written to
+// ContextOpts.StateLog for each change during the walks that change the
+// real state, such as apply and refresh.
+type StateTransition struct {
+	// Addr is the address of the resource, such as "module.foo.aws_instance.bar[1]".
+	Addr string `json:"addr"`
+
+	// Action is what changed.
+	Action StateTransitionAction `json:"action"`
+
+	// Deposed is true if a deposed instance was changed rather than the
+	// primary instance, such as when it's destroyed.
+	Deposed bool `json:"deposed,omitempty"`
+
+	// OldSerial is the serial of the state when the instance was changed,
+	// and NewSerial the serial the state has once the change is persisted.
+	// Changes that aren't persisted separately have the same serials.
+	OldSerial int64 `json:"old_serial"`
+	NewSerial int64 `json:"new_serial"`
+}
+
+// stateTransitionLogger is implemented by EvalContexts that log the
+// changes to the state of resources.
+type stateTransitionLogger interface {
+	// logStateTransition logs the change of the state with the given name
+	// in the module, in a state with the given serial.
+	logStateTransition(
+		name string, serial int64, action StateTransitionAction, deposed bool)
+}
+
+// logInstanceWrite logs the write of the state with the given name from
+// old to new with ctx, if it logs the changes to the state. Writes that
+// don't change the instance aren't logged.
+func logInstanceWrite(
+	ctx EvalContext, name string, serial int64,
+	old, new *InstanceState, deposed bool) {
+	l, ok := ctx.(stateTransitionLogger)
+	if !ok {
+		return
+	}
+
+	oldExists := old != nil && old.ID != ""
+	newExists := new != nil && new.ID != ""
+
+	var action StateTransitionAction
+	switch {
+	case oldExists && newExists:
+		if old.Equal(new) {
+			return
+		}
+		action = StateTransitionUpdate
+	case newExists:
+		action = StateTransitionCreate
+	case oldExists:
+		action = StateTransitionDestroy
+	default:
+		return
+	}
+
+	l.logStateTransition(name, serial, action, deposed)
+}
+
+// stateLog writes StateTransitions to a writer, one line of JSON each.
+type stateLog struct {
+	w    io.Writer
+	lock sync.Mutex
+}
+
+// newStateLog returns the log writing to w, or nil if w is nil.
+func newStateLog(w io.Writer) *stateLog {
+	if w == nil {
+		return nil
+	}
+
+	return &stateLog{w: w}
+}
+
+// log writes t to the log. Failing to write is logged rather than
+// returned, since it mustn't interrupt changing the state. A nil log
+// doesn't write anything.
+func (l *stateLog) log(t *StateTransition) {
+	if l == nil {
+		return
+	}
+
+	raw, err := json.Marshal(t)
+	if err != nil {
+		log.Printf("[ERROR] state log: error encoding transition of %s: %s", t.Addr, err)
+		return
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if _, err := l.w.Write(append(raw, '\n')); err != nil {
+		log.Printf("[ERROR] state log: error writing transition of %s: %s", t.Addr, err)
+	}
+}
@@ -0,0 +1,63 @@
+package terraform
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestStateLog(t *testing.T) {
+	var buf bytes.Buffer
+	l := newStateLog(&buf)
+	l.log(&StateTransition{
+		Addr:      "aws_instance.foo",
+		Action:    StateTransitionDestroy,
+		Deposed:   true,
+		OldSerial: 1,
+		NewSerial: 2,
+	})
+	l.log(&StateTransition{
+		Addr:      "module.child.aws_instance.bar[1]",
+		Action:    StateTransitionCreate,
+		OldSerial: 2,
+		NewSerial: 3,
+	})
+
+	expected := `{"addr":"aws_instance.foo","action":"destroy","deposed":true,"old_serial":1,"new_serial":2}
+{"addr":"module.child.aws_instance.bar[1]","action":"create","old_serial":2,"new_serial":3}
+`
+	if actual := buf.String(); actual != expected {
+		t.Fatalf("bad:\n%s", actual)
+	}
+}
+
+func TestStateLog_nil(t *testing.T) {
+	if l := newStateLog(nil); l != nil {
+		t.Fatalf("bad: %#v", l)
+	}
+
+	// A nil log doesn't write anything
+	var l *stateLog
+	l.log(&StateTransition{Addr: "aws_instance.foo"})
+}
+
+// testStateTransitions decodes the StateTransitions logged to buf and
+// resets it.
+func testStateTransitions(t *testing.T, buf *bytes.Buffer) []StateTransition {
+	var result []StateTransition
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		var st StateTransition
+		if err := json.Unmarshal(scanner.Bytes(), &st); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		result = append(result, st)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	buf.Reset()
+	return result
+}
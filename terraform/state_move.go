@@ -0,0 +1,220 @@
+package terraform
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ResourceMove describes a resource that was renamed or moved to another
+// module in the configuration. The state of the resource at From is moved
+// to To so the resource keeps its existing infrastructure instead of
+// being destroyed and created again.
+type ResourceMove struct {
+	From *ResourceAddress
+	To   *ResourceAddress
+}
+
+func (m *ResourceMove) String() string {
+	return fmt.Sprintf("%s => %s", m.From, m.To)
+}
+
+// MoveResources moves the state of each resource in moves to its new
+// address, in order. A move without an index moves every instance of a
+// counted resource, keeping their indexes. Moving a resource that isn't in
+// the state does nothing, so the same moves can be applied more than once.
+func (s *State) MoveResources(moves []*ResourceMove) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, m := range moves {
+		if err := s.moveResource(m); err != nil {
+			return fmt.Errorf("move %s: %s", m, err)
+		}
+	}
+
+	s.prune()
+	return nil
+}
+
+func (s *State) moveResource(m *ResourceMove) error {
+	from, to := m.From, m.To
+	if from.Type == "" || from.Name == "" || to.Type == "" || to.Name == "" {
+		return fmt.Errorf("only resources can be moved")
+	}
+	if from.Type != to.Type || from.Mode != to.Mode {
+		return fmt.Errorf("a resource can't be moved to a different type")
+	}
+	if from.Index == -1 && to.Index != -1 {
+		return fmt.Errorf("all instances of a resource can't be moved to a single index")
+	}
+
+	fromMod := s.moduleByPath(normalizeModulePath(from.Path))
+	if fromMod == nil {
+		return nil
+	}
+
+	// Find the state keys we're moving along with their new keys
+	fromPrefix := from.stateId()
+	moved := make(map[string]string)
+	for k := range fromMod.Resources {
+		switch {
+		case k == fromPrefix:
+			moved[k] = to.stateId()
+		case from.Index == -1 && strings.HasPrefix(k, fromPrefix+"."):
+			moved[k] = to.stateId() + k[len(fromPrefix):]
+		}
+	}
+	if len(moved) == 0 {
+		return nil
+	}
+
+	toMod := s.addModule(normalizeModulePath(to.Path))
+	for _, newKey := range moved {
+		if _, ok := toMod.Resources[newKey]; ok {
+			return fmt.Errorf("%s already exists in the state", newKey)
+		}
+	}
+
+	for oldKey, newKey := range moved {
+		toMod.Resources[newKey] = fromMod.Resources[oldKey]
+		delete(fromMod.Resources, oldKey)
+	}
+
+	return nil
+}
+
+// RekeyCount moves the state of every instance of the counted resource at
+// addr to the address given for its index in keys. This is used when the
+// instances of a counted resource are split into resources of their own,
+// or when the index of each instance changes, so that the instances keep
+// their existing infrastructure instead of being destroyed and created
+// again. Since the instances are all moved at once, indexes can also be
+// swapped.
+//
+// Every instance of the resource in the state must have an address in
+// keys, since an instance that isn't moved would be destroyed. The
+// addresses must be of the same resource type. Nothing is moved if there
+// is an error.
+func (s *State) RekeyCount(addr *ResourceAddress, keys map[int]*ResourceAddress) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if addr.Type == "" || addr.Name == "" || addr.Index != -1 {
+		return fmt.Errorf("%s: only all instances of a resource can be re-keyed", addr)
+	}
+
+	mod := s.moduleByPath(normalizeModulePath(addr.Path))
+	if mod == nil {
+		return nil
+	}
+
+	// Find the index of every instance in the state. A resource with a
+	// count of one has no index in its key, which is the same as index 0.
+	prefix := addr.stateId()
+	indexes := make(map[int]string)
+	for k := range mod.Resources {
+		index := -1
+		switch {
+		case k == prefix:
+			index = 0
+		case strings.HasPrefix(k, prefix+"."):
+			i, err := strconv.Atoi(k[len(prefix)+1:])
+			if err != nil || i < 0 {
+				continue
+			}
+
+			index = i
+		default:
+			continue
+		}
+
+		if other, ok := indexes[index]; ok {
+			return fmt.Errorf(
+				"%s: both %s and %s are index %d in the state", addr, other, k, index)
+		}
+		indexes[index] = k
+	}
+
+	// Every instance must be re-keyed, and to an address of its own
+	var missing []int
+	targets := make(map[string]int)
+	for index := range indexes {
+		to, ok := keys[index]
+		if !ok {
+			missing = append(missing, index)
+			continue
+		}
+
+		if to.Type != addr.Type || to.Mode != addr.Mode || to.Name == "" {
+			return fmt.Errorf(
+				"%s: index %d: can't be re-keyed to %s, which is a different type",
+				addr, index, to)
+		}
+
+		key := fmt.Sprintf("%s/%s", PathCacheKey(normalizeModulePath(to.Path)), to.stateId())
+		if other, ok := targets[key]; ok {
+			return fmt.Errorf(
+				"%s: index %d and %d are both re-keyed to %s", addr, other, index, to)
+		}
+		targets[key] = index
+	}
+	if len(missing) > 0 {
+		sort.Ints(missing)
+		strs := make([]string, len(missing))
+		for i, index := range missing {
+			strs[i] = strconv.Itoa(index)
+		}
+
+		return fmt.Errorf(
+			"%s: no key for the instances with index %s, which would be destroyed",
+			addr, strings.Join(strs, ", "))
+	}
+
+	// The new keys may only exist already if they're moved away as well
+	for index := range indexes {
+		to := keys[index]
+		toMod := s.moduleByPath(normalizeModulePath(to.Path))
+		if toMod == nil {
+			continue
+		}
+
+		if _, ok := toMod.Resources[to.stateId()]; !ok {
+			continue
+		}
+		if toMod == mod && isRekeyedKey(indexes, to.stateId()) {
+			continue
+		}
+
+		return fmt.Errorf(
+			"%s: index %d: %s already exists in the state", addr, index, to)
+	}
+
+	// Move them all at once
+	moved := make(map[int]*ResourceState, len(indexes))
+	for index, k := range indexes {
+		moved[index] = mod.Resources[k]
+		delete(mod.Resources, k)
+	}
+	for index, rs := range moved {
+		to := keys[index]
+		toMod := s.addModule(normalizeModulePath(to.Path))
+		toMod.Resources[to.stateId()] = rs
+	}
+
+	s.prune()
+	return nil
+}
+
+// isRekeyedKey returns true if the state key k is one of the keys in
+// indexes, which are moved away by RekeyCount.
+func isRekeyedKey(indexes map[int]string, k string) bool {
+	for _, v := range indexes {
+		if v == k {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,401 @@
+package terraform
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStateMoveResources(t *testing.T) {
+	cases := map[string]struct {
+		Moves    [][2]string
+		Err      bool
+		Expected string
+	}{
+		"rename": {
+			[][2]string{{"aws_instance.foo", "aws_instance.renamed"}},
+			false,
+			`
+aws_instance.bar.0:
+  ID = bar0
+aws_instance.bar.1:
+  ID = bar1
+aws_instance.renamed:
+  ID = foo
+
+module.child:
+  aws_instance.baz:
+    ID = baz
+`,
+		},
+
+		"rename all counted instances": {
+			[][2]string{{"aws_instance.bar", "aws_instance.renamed"}},
+			false,
+			`
+aws_instance.foo:
+  ID = foo
+aws_instance.renamed.0:
+  ID = bar0
+aws_instance.renamed.1:
+  ID = bar1
+
+module.child:
+  aws_instance.baz:
+    ID = baz
+`,
+		},
+
+		"single index": {
+			[][2]string{{"aws_instance.bar[1]", "aws_instance.renamed"}},
+			false,
+			`
+aws_instance.bar.0:
+  ID = bar0
+aws_instance.foo:
+  ID = foo
+aws_instance.renamed:
+  ID = bar1
+
+module.child:
+  aws_instance.baz:
+    ID = baz
+`,
+		},
+
+		"into a module": {
+			[][2]string{{"aws_instance.foo", "module.child.aws_instance.foo"}},
+			false,
+			`
+aws_instance.bar.0:
+  ID = bar0
+aws_instance.bar.1:
+  ID = bar1
+
+module.child:
+  aws_instance.baz:
+    ID = baz
+  aws_instance.foo:
+    ID = foo
+`,
+		},
+
+		"out of a module": {
+			[][2]string{{"module.child.aws_instance.baz", "aws_instance.baz"}},
+			false,
+			`
+aws_instance.bar.0:
+  ID = bar0
+aws_instance.bar.1:
+  ID = bar1
+aws_instance.baz:
+  ID = baz
+aws_instance.foo:
+  ID = foo
+
+module.child:
+  <no state>
+`,
+		},
+
+		"into a new module": {
+			[][2]string{{"aws_instance.foo", "module.a.module.b.aws_instance.foo"}},
+			false,
+			`
+aws_instance.bar.0:
+  ID = bar0
+aws_instance.bar.1:
+  ID = bar1
+
+module.child:
+  aws_instance.baz:
+    ID = baz
+module.a.b:
+  aws_instance.foo:
+    ID = foo
+`,
+		},
+
+		"chained": {
+			[][2]string{
+				{"aws_instance.foo", "aws_instance.a"},
+				{"aws_instance.a", "aws_instance.b"},
+			},
+			false,
+			`
+aws_instance.b:
+  ID = foo
+aws_instance.bar.0:
+  ID = bar0
+aws_instance.bar.1:
+  ID = bar1
+
+module.child:
+  aws_instance.baz:
+    ID = baz
+`,
+		},
+
+		"missing": {
+			[][2]string{{"aws_instance.nope", "aws_instance.renamed"}},
+			false,
+			`
+aws_instance.bar.0:
+  ID = bar0
+aws_instance.bar.1:
+  ID = bar1
+aws_instance.foo:
+  ID = foo
+
+module.child:
+  aws_instance.baz:
+    ID = baz
+`,
+		},
+
+		"destination exists": {
+			[][2]string{{"aws_instance.foo", "aws_instance.bar[0]"}},
+			true,
+			"",
+		},
+
+		"different type": {
+			[][2]string{{"aws_instance.foo", "aws_elb.foo"}},
+			true,
+			"",
+		},
+
+		"module": {
+			[][2]string{{"module.child", "module.other"}},
+			true,
+			"",
+		},
+
+		"all instances to an index": {
+			[][2]string{{"aws_instance.bar", "aws_instance.renamed[0]"}},
+			true,
+			"",
+		},
+	}
+
+	for k, tc := range cases {
+		state := testStateMoveResources()
+
+		var moves []*ResourceMove
+		for _, m := range tc.Moves {
+			from, err := ParseResourceAddress(m[0])
+			if err != nil {
+				t.Fatalf("%s: err: %s", k, err)
+			}
+			to, err := ParseResourceAddress(m[1])
+			if err != nil {
+				t.Fatalf("%s: err: %s", k, err)
+			}
+
+			moves = append(moves, &ResourceMove{From: from, To: to})
+		}
+
+		err := state.MoveResources(moves)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+		if tc.Err {
+			continue
+		}
+
+		actual := strings.TrimSpace(state.String())
+		expected := strings.TrimSpace(tc.Expected)
+		if actual != expected {
+			t.Fatalf("%s: bad:\n\n%s\n\nexpected:\n\n%s", k, actual, expected)
+		}
+	}
+}
+
+func testStateMoveResources() *State {
+	return &State{
+		Modules: []*ModuleState{
+			&ModuleState{
+				Path: rootModulePath,
+				Resources: map[string]*ResourceState{
+					"aws_instance.foo": &ResourceState{
+						Type:    "aws_instance",
+						Primary: &InstanceState{ID: "foo"},
+					},
+					"aws_instance.bar.0": &ResourceState{
+						Type:    "aws_instance",
+						Primary: &InstanceState{ID: "bar0"},
+					},
+					"aws_instance.bar.1": &ResourceState{
+						Type:    "aws_instance",
+						Primary: &InstanceState{ID: "bar1"},
+					},
+				},
+			},
+			&ModuleState{
+				Path: []string{"root", "child"},
+				Resources: map[string]*ResourceState{
+					"aws_instance.baz": &ResourceState{
+						Type:    "aws_instance",
+						Primary: &InstanceState{ID: "baz"},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestStateRekeyCount(t *testing.T) {
+	cases := map[string]struct {
+		Addr     string
+		Keys     map[int]string
+		Err      string
+		Expected string
+	}{
+		"split into resources": {
+			"aws_instance.bar",
+			map[int]string{0: "aws_instance.a", 1: "module.child.aws_instance.b"},
+			"",
+			`
+aws_instance.a:
+  ID = bar0
+aws_instance.foo:
+  ID = foo
+
+module.child:
+  aws_instance.b:
+    ID = bar1
+  aws_instance.baz:
+    ID = baz
+`,
+		},
+
+		"swap indexes": {
+			"aws_instance.bar",
+			map[int]string{0: "aws_instance.bar[1]", 1: "aws_instance.bar[0]"},
+			"",
+			`
+aws_instance.bar.0:
+  ID = bar1
+aws_instance.bar.1:
+  ID = bar0
+aws_instance.foo:
+  ID = foo
+
+module.child:
+  aws_instance.baz:
+    ID = baz
+`,
+		},
+
+		"count of one": {
+			"aws_instance.foo",
+			map[int]string{0: "aws_instance.renamed[3]"},
+			"",
+			`
+aws_instance.bar.0:
+  ID = bar0
+aws_instance.bar.1:
+  ID = bar1
+aws_instance.renamed.3:
+  ID = foo
+
+module.child:
+  aws_instance.baz:
+    ID = baz
+`,
+		},
+
+		"not in the state": {
+			"aws_instance.nope",
+			map[int]string{},
+			"",
+			`
+aws_instance.bar.0:
+  ID = bar0
+aws_instance.bar.1:
+  ID = bar1
+aws_instance.foo:
+  ID = foo
+
+module.child:
+  aws_instance.baz:
+    ID = baz
+`,
+		},
+
+		"unmapped index": {
+			"aws_instance.bar",
+			map[int]string{0: "aws_instance.a", 5: "aws_instance.b"},
+			"no key for the instances with index 1",
+			"",
+		},
+
+		"destination exists": {
+			"aws_instance.bar",
+			map[int]string{0: "aws_instance.foo", 1: "aws_instance.a"},
+			"aws_instance.foo already exists",
+			"",
+		},
+
+		"same destination": {
+			"aws_instance.bar",
+			map[int]string{0: "aws_instance.a", 1: "aws_instance.a"},
+			"are both re-keyed to aws_instance.a",
+			"",
+		},
+
+		"different type": {
+			"aws_instance.bar",
+			map[int]string{0: "aws_elb.a", 1: "aws_instance.a"},
+			"different type",
+			"",
+		},
+
+		"single index": {
+			"aws_instance.bar[0]",
+			map[int]string{0: "aws_instance.a"},
+			"only all instances",
+			"",
+		},
+	}
+
+	for k, tc := range cases {
+		state := testStateMoveResources()
+
+		addr, err := ParseResourceAddress(tc.Addr)
+		if err != nil {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+		keys := make(map[int]*ResourceAddress)
+		for i, v := range tc.Keys {
+			to, err := ParseResourceAddress(v)
+			if err != nil {
+				t.Fatalf("%s: err: %s", k, err)
+			}
+
+			keys[i] = to
+		}
+
+		err = state.RekeyCount(addr, keys)
+		if tc.Err != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.Err) {
+				t.Fatalf("%s: expected error %q, got: %v", k, tc.Err, err)
+			}
+
+			// Nothing is moved
+			expected := testStateMoveResources().String()
+			if state.String() != expected {
+				t.Fatalf("%s: state changed:\n\n%s", k, state)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+
+		actual := strings.TrimSpace(state.String())
+		expected := strings.TrimSpace(tc.Expected)
+		if actual != expected {
+			t.Fatalf("%s: bad:\n\n%s\n\nexpected:\n\n%s", k, actual, expected)
+		}
+	}
+}
@@ -0,0 +1,441 @@
+package terraform
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+)
+
+// The indentation used when encoding the state. This must match the
+// indentation used by WriteState so both produce the same output.
+const stateStreamIndent = "    "
+
+// WriteStateStream writes the state to dst in exactly the same format as
+// WriteState, but encodes and writes one resource at a time instead of
+// encoding the whole document in memory first. This keeps the memory used
+// to write very large states small.
+//
+// The state is locked while it's written so the output is a consistent
+// snapshot. During a walk the state is also modified by the eval nodes
+// while holding the state lock of the context, so hooks writing the state
+// must hold that lock too, as PostStateUpdate callers already do.
+func WriteStateStream(d *State, dst io.Writer) error {
+	d.Lock()
+	defer d.Unlock()
+
+	// Make sure it is sorted
+	d.sort()
+
+	// make sure we have no uninitialized fields
+	d.init()
+
+	// Ensure the version is set
+	d.Version = StateVersion
+
+	if d.TFVersion != "" {
+		if _, err := version.NewVersion(d.TFVersion); err != nil {
+			return fmt.Errorf(
+				"Error writing state, invalid version: %s\n\n"+
+					"The Terraform version when writing the state must be a semantic\n"+
+					"version.",
+				d.TFVersion)
+		}
+	}
+
+	w := newStateStreamWriter(dst)
+	w.writeState(d)
+	if w.err == nil {
+		w.err = w.w.Flush()
+	}
+	if w.err != nil {
+		return fmt.Errorf("Failed to write state: %s", w.err)
+	}
+
+	return nil
+}
+
+// stateStreamHeader is the part of the State that is encoded before the
+// modules. The fields and their order must match State.
+type stateStreamHeader struct {
+	Version   int           `json:"version"`
+	TFVersion string        `json:"terraform_version,omitempty"`
+	Serial    int64         `json:"serial"`
+	Lineage   string        `json:"lineage"`
+	Remote    *RemoteState  `json:"remote,omitempty"`
+	Backend   *BackendState `json:"backend,omitempty"`
+}
+
+// moduleStreamHeader is the part of the ModuleState that is encoded before
+// the resources. The fields and their order must match ModuleState.
+type moduleStreamHeader struct {
+	Path    []string                `json:"path"`
+	Outputs map[string]*OutputState `json:"outputs"`
+}
+
+// stateStreamWriter writes the JSON encoding of a state piece by piece.
+// The first error is kept and all writes after it are skipped.
+type stateStreamWriter struct {
+	w   *bufio.Writer
+	buf bytes.Buffer
+	enc *json.Encoder
+	err error
+}
+
+func newStateStreamWriter(dst io.Writer) *stateStreamWriter {
+	w := &stateStreamWriter{w: bufio.NewWriter(dst)}
+	w.enc = json.NewEncoder(&w.buf)
+	return w
+}
+
+func (w *stateStreamWriter) writeState(s *State) {
+	w.writeObjectStart(0, &stateStreamHeader{
+		Version:   s.Version,
+		TFVersion: s.TFVersion,
+		Serial:    s.Serial,
+		Lineage:   s.Lineage,
+		Remote:    s.Remote,
+		Backend:   s.Backend,
+	})
+	w.writeKey(1, "modules")
+
+	switch {
+	case s.Modules == nil:
+		w.writeString("null")
+	case len(s.Modules) == 0:
+		w.writeString("[]")
+	default:
+		w.writeString("[")
+		for i, m := range s.Modules {
+			if i > 0 {
+				w.writeString(",")
+			}
+			w.writeString("\n" + stateStreamPrefix(2))
+			w.writeModule(m)
+		}
+		w.writeString("\n" + stateStreamPrefix(1) + "]")
+	}
+
+	w.writeString("\n}\n")
+}
+
+func (w *stateStreamWriter) writeModule(m *ModuleState) {
+	if m == nil {
+		w.writeString("null")
+		return
+	}
+
+	w.writeObjectStart(2, &moduleStreamHeader{
+		Path:    m.Path,
+		Outputs: m.Outputs,
+	})
+	w.writeKey(3, "resources")
+
+	switch {
+	case m.Resources == nil:
+		w.writeString("null")
+	case len(m.Resources) == 0:
+		w.writeString("{}")
+	default:
+		keys := make([]string, 0, len(m.Resources))
+		for k := range m.Resources {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		w.writeString("{")
+		for i, k := range keys {
+			if i > 0 {
+				w.writeString(",")
+			}
+			w.writeString("\n" + stateStreamPrefix(4))
+			w.writeValue(4, k)
+			w.writeString(": ")
+			w.writeValue(4, m.Resources[k])
+		}
+		w.writeString("\n" + stateStreamPrefix(3) + "}")
+	}
+
+	w.writeString(",")
+	w.writeKey(3, "depends_on")
+	w.writeValue(3, m.Dependencies)
+	w.writeString("\n" + stateStreamPrefix(2) + "}")
+}
+
+// writeObjectStart writes the encoding of the struct v without its closing
+// brace, so that more fields can be written after it.
+func (w *stateStreamWriter) writeObjectStart(depth int, v interface{}) {
+	data := w.encode(depth, v)
+	if data == nil {
+		return
+	}
+
+	end := []byte("\n" + stateStreamPrefix(depth) + "}")
+	if !bytes.HasSuffix(data, end) {
+		// An empty object, which the headers never are
+		panic(fmt.Sprintf("unexpected state encoding: %s", data))
+	}
+
+	w.writeBytes(data[:len(data)-len(end)])
+	w.writeString(",")
+}
+
+// writeKey writes the key of an object field on a new line.
+func (w *stateStreamWriter) writeKey(depth int, key string) {
+	w.writeString("\n" + stateStreamPrefix(depth))
+	w.writeValue(depth, key)
+	w.writeString(": ")
+}
+
+func (w *stateStreamWriter) writeValue(depth int, v interface{}) {
+	if data := w.encode(depth, v); data != nil {
+		w.writeBytes(data)
+	}
+}
+
+// encode returns the indented encoding of v, the same as json.MarshalIndent
+// would. The result is only valid until the next call.
+func (w *stateStreamWriter) encode(depth int, v interface{}) []byte {
+	if w.err != nil {
+		return nil
+	}
+
+	w.buf.Reset()
+	w.enc.SetIndent(stateStreamPrefix(depth), stateStreamIndent)
+	if err := w.enc.Encode(v); err != nil {
+		w.err = err
+		return nil
+	}
+
+	// Encode terminates each value with a newline
+	return bytes.TrimSuffix(w.buf.Bytes(), []byte("\n"))
+}
+
+func (w *stateStreamWriter) writeBytes(b []byte) {
+	if w.err != nil {
+		return
+	}
+
+	_, w.err = w.w.Write(b)
+}
+
+func (w *stateStreamWriter) writeString(s string) {
+	if w.err != nil {
+		return
+	}
+
+	_, w.err = w.w.WriteString(s)
+}
+
+func stateStreamPrefix(depth int) string {
+	return strings.Repeat(stateStreamIndent, depth)
+}
+
+// ReadStateStream reads a state written by WriteState or WriteStateStream,
+// decoding one resource at a time instead of reading the whole document
+// into memory first like ReadState does.
+//
+// Only the current state version can be read this way. Older states must
+// be read with ReadState so they can be upgraded. Unlike ReadState, the
+// serial isn't incremented if the state was written in a different
+// normalization, since the original document isn't kept to compare it.
+func ReadStateStream(src io.Reader) (*State, error) {
+	buf := bufio.NewReader(src)
+	if _, err := buf.Peek(1); err == io.EOF {
+		return nil, ErrNoState
+	}
+
+	if err := testForV0State(buf); err != nil {
+		return nil, err
+	}
+
+	state, err := readStateStream(json.NewDecoder(buf))
+	if err != nil {
+		return nil, fmt.Errorf("Decoding state file failed: %v", err)
+	}
+
+	// Check the version, since we can't upgrade a streamed state
+	if state.Version > StateVersion {
+		return nil, fmt.Errorf("Terraform %s does not support state version %d, please update.",
+			SemVersion.String(), state.Version)
+	}
+	if state.Version != StateVersion {
+		return nil, fmt.Errorf(
+			"State version %d can't be read as a stream, only version %d can",
+			state.Version, StateVersion)
+	}
+
+	// Make sure the version is semantic
+	if state.TFVersion != "" {
+		if _, err := version.NewVersion(state.TFVersion); err != nil {
+			return nil, fmt.Errorf(
+				"State contains invalid version: %s\n\n"+
+					"Terraform validates the version format prior to writing it. This\n"+
+					"means that this is invalid of the state becoming corrupted through\n"+
+					"some external means. Please manually modify the Terraform version\n"+
+					"field to be a proper semantic version.",
+				state.TFVersion)
+		}
+	}
+
+	// Sort it
+	state.sort()
+
+	// catch any unitialized fields in the state
+	state.init()
+
+	// Prune and validate it the same as ReadState does
+	state.prune()
+	if err := state.Validate(); err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+func readStateStream(dec *json.Decoder) (*State, error) {
+	state := &State{}
+	fields := map[string]interface{}{
+		"version":           &state.Version,
+		"terraform_version": &state.TFVersion,
+		"serial":            &state.Serial,
+		"lineage":           &state.Lineage,
+		"remote":            &state.Remote,
+		"backend":           &state.Backend,
+	}
+
+	err := readStreamObject(dec, func(key string) error {
+		if key == "modules" {
+			return readStreamModules(dec, state)
+		}
+
+		return readStreamField(dec, fields[key])
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+func readStreamModules(dec *json.Decoder, state *State) error {
+	null, err := readStreamDelim(dec, '[')
+	if err != nil || null {
+		return err
+	}
+
+	for dec.More() {
+		m, err := readStreamModule(dec)
+		if err != nil {
+			return err
+		}
+
+		state.Modules = append(state.Modules, m)
+	}
+
+	// Consume the closing bracket
+	_, err = dec.Token()
+	return err
+}
+
+func readStreamModule(dec *json.Decoder) (*ModuleState, error) {
+	m := &ModuleState{}
+	fields := map[string]interface{}{
+		"path":       &m.Path,
+		"outputs":    &m.Outputs,
+		"depends_on": &m.Dependencies,
+	}
+
+	var null bool
+	err := readStreamObjectOrNull(dec, &null, func(key string) error {
+		if key != "resources" {
+			return readStreamField(dec, fields[key])
+		}
+
+		if m.Resources == nil {
+			m.Resources = make(map[string]*ResourceState)
+		}
+
+		return readStreamObject(dec, func(key string) error {
+			var rs *ResourceState
+			if err := dec.Decode(&rs); err != nil {
+				return fmt.Errorf("resource %q: %s", key, err)
+			}
+
+			m.Resources[key] = rs
+			return nil
+		})
+	})
+	if err != nil || null {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// readStreamField decodes the next value into v, or skips it if v is nil.
+func readStreamField(dec *json.Decoder, v interface{}) error {
+	if v == nil {
+		var skip json.RawMessage
+		v = &skip
+	}
+
+	return dec.Decode(v)
+}
+
+// readStreamObject reads a JSON object, calling fn with each key. fn must
+// consume the value of the key. A null is read as an empty object.
+func readStreamObject(dec *json.Decoder, fn func(string) error) error {
+	var null bool
+	return readStreamObjectOrNull(dec, &null, fn)
+}
+
+func readStreamObjectOrNull(dec *json.Decoder, null *bool, fn func(string) error) error {
+	var err error
+	*null, err = readStreamDelim(dec, '{')
+	if err != nil || *null {
+		return err
+	}
+
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		key, ok := t.(string)
+		if !ok {
+			return fmt.Errorf("expected object key, got %v", t)
+		}
+
+		if err := fn(key); err != nil {
+			return err
+		}
+	}
+
+	// Consume the closing brace
+	_, err = dec.Token()
+	return err
+}
+
+// readStreamDelim reads the opening delimiter d. It returns true if the
+// value is a null instead.
+func readStreamDelim(dec *json.Decoder, d json.Delim) (bool, error) {
+	t, err := dec.Token()
+	if err != nil {
+		return false, err
+	}
+	if t == nil {
+		return true, nil
+	}
+	if t != d {
+		return false, fmt.Errorf("expected %q, got %v", d, t)
+	}
+
+	return false, nil
+}
@@ -0,0 +1,324 @@
+package terraform
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func testStateStreamCases() map[string]*State {
+	return map[string]*State{
+		"empty": &State{},
+
+		"resources": testStateMoveResources(),
+
+		"full": &State{
+			TFVersion: "0.9.0",
+			Serial:    9,
+			Lineage:   "5d1ad1a1-4027-4665-a908-dbe6adff11d8",
+			Remote: &RemoteState{
+				Type: "http",
+				Config: map[string]string{
+					"url": "http://my-cool-server.com/?a=<b>&c",
+				},
+			},
+			Backend: &BackendState{
+				Type: "local",
+				Hash: 42,
+			},
+			Modules: []*ModuleState{
+				&ModuleState{
+					Path:         rootModulePath,
+					Dependencies: []string{"aws_instance.bar"},
+					Outputs: map[string]*OutputState{
+						"list": &OutputState{
+							Type:  "list",
+							Value: []interface{}{"a", "b"},
+						},
+						"secret": &OutputState{
+							Type:      "string",
+							Sensitive: true,
+							Value:     "shh",
+						},
+					},
+					Resources: map[string]*ResourceState{
+						"aws_instance.foo": &ResourceState{
+							Type:         "aws_instance",
+							Dependencies: []string{"aws_instance.bar"},
+							Provider:     "aws.west",
+							Primary: &InstanceState{
+								ID: "foo",
+								Attributes: map[string]string{
+									"tags.%":    "1",
+									"tags.name": "\"quoted\"\n",
+								},
+								Meta: map[string]string{
+									"schema_version": "1",
+								},
+								Tainted: true,
+							},
+							Deposed: []*InstanceState{
+								&InstanceState{ID: "old"},
+							},
+						},
+					},
+				},
+				&ModuleState{
+					Path: []string{"root", "child"},
+				},
+			},
+		},
+	}
+}
+
+func TestWriteStateStream(t *testing.T) {
+	for k, state := range testStateStreamCases() {
+		state.init()
+
+		var expected bytes.Buffer
+		if err := WriteState(state.DeepCopy(), &expected); err != nil {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+
+		var actual bytes.Buffer
+		if err := WriteStateStream(state, &actual); err != nil {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+
+		if actual.String() != expected.String() {
+			t.Fatalf("%s: bad:\n\n%s\n\nexpected:\n\n%s", k, actual.String(), expected.String())
+		}
+	}
+}
+
+func TestWriteStateStream_badTFVersion(t *testing.T) {
+	state := &State{TFVersion: "bad"}
+	if err := WriteStateStream(state, new(bytes.Buffer)); err == nil {
+		t.Fatal("should error")
+	}
+}
+
+func TestReadStateStream(t *testing.T) {
+	for k, state := range testStateStreamCases() {
+		var buf bytes.Buffer
+		if err := WriteStateStream(state, &buf); err != nil {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+
+		expected, err := ReadState(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+
+		actual, err := ReadStateStream(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+
+		if !reflect.DeepEqual(actual, expected) {
+			t.Fatalf("%s: bad:\n\n%s\n\nexpected:\n\n%s", k, actual, expected)
+		}
+		if actual.Serial != expected.Serial || actual.Lineage != expected.Lineage {
+			t.Fatalf("%s: bad: %d %q", k, actual.Serial, actual.Lineage)
+		}
+	}
+}
+
+func TestReadStateStream_unknownFields(t *testing.T) {
+	src := `{
+    "version": 3,
+    "serial": 1,
+    "lineage": "abc",
+    "extra": {"a": [1, 2]},
+    "modules": [
+        {
+            "path": ["root"],
+            "extra": null,
+            "resources": {
+                "aws_instance.foo": {
+                    "type": "aws_instance",
+                    "primary": {"id": "foo"}
+                }
+            }
+        }
+    ]
+}`
+
+	state, err := ReadStateStream(strings.NewReader(src))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	rs := state.RootModule().Resources["aws_instance.foo"]
+	if rs == nil || rs.Primary.ID != "foo" {
+		t.Fatalf("bad: %s", state)
+	}
+}
+
+func TestReadStateStream_errors(t *testing.T) {
+	cases := map[string]string{
+		"old version":      `{"version": 2, "modules": []}`,
+		"future version":   `{"version": 4, "modules": []}`,
+		"bad json":         `{"version": 3, "modules": [`,
+		"bad resources":    `{"version": 3, "modules": [{"resources": []}]}`,
+		"bad tf version":   `{"version": 3, "terraform_version": "bad"}`,
+		"duplicate module": `{"version": 3, "modules": [{"path": ["root"]}, {"path": ["root"]}]}`,
+	}
+
+	for k, src := range cases {
+		if _, err := ReadStateStream(strings.NewReader(src)); err == nil {
+			t.Fatalf("%s: should error", k)
+		}
+	}
+
+	if _, err := ReadStateStream(new(bytes.Buffer)); err != ErrNoState {
+		t.Fatalf("bad: %s", err)
+	}
+}
+
+// Writing the state while it's modified must always write a consistent
+// snapshot: each resource is at exactly one of its names.
+func TestWriteStateStream_concurrent(t *testing.T) {
+	state := testStateMoveResources()
+	a, err := ParseResourceAddress("aws_instance.foo")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	b, err := ParseResourceAddress("aws_instance.moved")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		moves := [][]*ResourceMove{
+			{{From: a, To: b}},
+			{{From: b, To: a}},
+		}
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+
+			if err := state.MoveResources(moves[i%2]); err != nil {
+				t.Errorf("err: %s", err)
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 100; i++ {
+		var buf bytes.Buffer
+		if err := WriteStateStream(state, &buf); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		actual, err := ReadStateStream(&buf)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		mod := actual.RootModule()
+		_, foo := mod.Resources["aws_instance.foo"]
+		_, moved := mod.Resources["aws_instance.moved"]
+		if foo == moved {
+			t.Fatalf("inconsistent state:\n\n%s", actual)
+		}
+	}
+
+	close(done)
+	wg.Wait()
+}
+
+func BenchmarkWriteState(b *testing.B) {
+	state := testStateStreamLarge(10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := WriteState(state, new(bytes.Buffer)); err != nil {
+			b.Fatalf("err: %s", err)
+		}
+	}
+}
+
+func BenchmarkWriteStateStream(b *testing.B) {
+	state := testStateStreamLarge(10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := WriteStateStream(state, new(bytes.Buffer)); err != nil {
+			b.Fatalf("err: %s", err)
+		}
+	}
+}
+
+func BenchmarkReadState(b *testing.B) {
+	data := testStateStreamLargeBytes(b, 10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ReadState(bytes.NewReader(data)); err != nil {
+			b.Fatalf("err: %s", err)
+		}
+	}
+}
+
+func BenchmarkReadStateStream(b *testing.B) {
+	data := testStateStreamLargeBytes(b, 10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ReadStateStream(bytes.NewReader(data)); err != nil {
+			b.Fatalf("err: %s", err)
+		}
+	}
+}
+
+// testStateStreamLarge returns a state with n resources spread over ten
+// modules.
+func testStateStreamLarge(n int) *State {
+	state := NewState()
+	for i := 0; i < n; i++ {
+		path := rootModulePath
+		if m := i % 10; m > 0 {
+			path = []string{"root", fmt.Sprintf("mod%d", m)}
+		}
+
+		mod := state.ModuleByPath(path)
+		if mod == nil {
+			mod = state.AddModule(path)
+		}
+
+		attrs := make(map[string]string)
+		for j := 0; j < 10; j++ {
+			attrs[fmt.Sprintf("attr%d", j)] = fmt.Sprintf("value-%d-%d", i, j)
+		}
+
+		mod.Resources[fmt.Sprintf("aws_instance.foo.%d", i)] = &ResourceState{
+			Type: "aws_instance",
+			Primary: &InstanceState{
+				ID:         fmt.Sprintf("i-%d", i),
+				Attributes: attrs,
+			},
+		}
+	}
+
+	return state
+}
+
+func testStateStreamLargeBytes(b *testing.B, n int) []byte {
+	var buf bytes.Buffer
+	if err := WriteState(testStateStreamLarge(n), &buf); err != nil {
+		b.Fatalf("err: %s", err)
+	}
+
+	return buf.Bytes()
+}
@@ -989,6 +989,19 @@ func TestResourceStateEqual(t *testing.T) {
 			&ResourceState{Primary: &InstanceState{ID: "foo"}},
 		},
 
+		// Different prior states
+		{
+			false,
+			&ResourceState{Prior: nil},
+			&ResourceState{Prior: &InstanceState{ID: "foo"}},
+		},
+
+		{
+			true,
+			&ResourceState{Prior: &InstanceState{ID: "foo"}},
+			&ResourceState{Prior: &InstanceState{ID: "foo"}},
+		},
+
 		// Different tainted
 		{
 			false,
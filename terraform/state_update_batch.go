@@ -0,0 +1,31 @@
+package terraform
+
+import (
+	"sync"
+)
+
+// stateUpdateBatch keeps track of the state updates whose PostStateUpdate
+// hooks were deferred during a walk with batched state updates.
+type stateUpdateBatch struct {
+	sync.Mutex
+
+	pending int
+}
+
+// add records a state update the hooks haven't seen yet.
+func (b *stateUpdateBatch) add() {
+	b.Lock()
+	defer b.Unlock()
+	b.pending++
+}
+
+// take returns true if there are updates the hooks haven't seen yet and
+// resets the batch, since the caller calls the hooks.
+func (b *stateUpdateBatch) take() bool {
+	b.Lock()
+	defer b.Unlock()
+
+	pending := b.pending
+	b.pending = 0
+	return pending > 0
+}
@@ -43,7 +43,7 @@ func TestMain(m *testing.M) {
 	os.Exit(m.Run())
 }
 
-func tempDir(t *testing.T) string {
+func tempDir(t testing.TB) string {
 	dir, err := ioutil.TempDir("", "tf")
 	if err != nil {
 		t.Fatalf("err: %s", err)
@@ -79,7 +79,7 @@ func testConfig(t *testing.T, name string) *config.Config {
 	return c
 }
 
-func testModule(t *testing.T, name string) *module.Tree {
+func testModule(t testing.TB, name string) *module.Tree {
 	mod, err := module.NewTreeModule("", filepath.Join(fixtureDir, name))
 	if err != nil {
 		t.Fatalf("err: %s", err)
@@ -278,6 +278,22 @@ aws_instance.foo.2:
   ID = foo
 `
 
+const testTerraformApplyInterpolateTryStr = `
+aws_instance.bar:
+  ID = foo
+  missing = default
+  present = 2
+  type = aws_instance
+
+  Dependencies:
+    aws_instance.foo
+    aws_instance.foo
+aws_instance.foo:
+  ID = foo
+  num = 2
+  type = aws_instance
+`
+
 const testTerraformApplyProviderAliasStr = `
 aws_instance.bar:
   ID = foo
@@ -363,6 +379,10 @@ aws_instance.foo:
 `
 
 const testTerraformApplyCountDecStr = `
+aws_instance.bar:
+  ID = foo
+  foo = bar
+  type = aws_instance
 aws_instance.foo.0:
   ID = bar
   foo = foo
@@ -373,6 +393,13 @@ aws_instance.foo.1:
   type = aws_instance
 `
 
+const testTerraformApplyCountDecZeroStr = `
+aws_instance.bar:
+  ID = bar
+  foo = bar
+  type = aws_instance
+`
+
 const testTerraformApplyCountDecToOneStr = `
 aws_instance.foo:
   ID = bar
@@ -404,7 +431,14 @@ aws_instance.foo.0:
 `
 
 const testTerraformApplyCountTaintedStr = `
-<no state>
+aws_instance.foo.0:
+  ID = foo
+  foo = foo
+  type = aws_instance
+aws_instance.foo.1:
+  ID = foo
+  foo = foo
+  type = aws_instance
 `
 
 const testTerraformApplyCountVariableStr = `
@@ -992,6 +1026,141 @@ STATE:
 <no state>
 `
 
+const testTerraformApplyCountComputedStr = `
+aws_instance.bar.0:
+  ID = foo
+  foo = 0
+  type = aws_instance
+
+  Dependencies:
+    aws_instance.foo.*
+    aws_instance.foo.*
+aws_instance.bar.1:
+  ID = foo
+  foo = 1
+  type = aws_instance
+
+  Dependencies:
+    aws_instance.foo.*
+    aws_instance.foo.*
+aws_instance.bar.2:
+  ID = foo
+  foo = 2
+  type = aws_instance
+
+  Dependencies:
+    aws_instance.foo.*
+    aws_instance.foo.*
+aws_instance.baz:
+  ID = foo
+  foo = 0,1,2
+  type = aws_instance
+
+  Dependencies:
+    aws_instance.bar.*
+aws_instance.foo.0:
+  ID = foo
+  type = aws_instance
+  value = 0
+aws_instance.foo.1:
+  ID = foo
+  type = aws_instance
+  value = 1
+aws_instance.foo.2:
+  ID = foo
+  type = aws_instance
+  value = 2
+`
+
+const testTerraformApplyCountComputedDecreaseStr = `
+aws_instance.bar.0:
+  ID = bar0
+  foo = 0
+  type = aws_instance
+aws_instance.bar.1:
+  ID = bar1
+  foo = 1
+  type = aws_instance
+aws_instance.baz:
+  ID = foo
+  foo = 0,1
+  type = aws_instance
+
+  Dependencies:
+    aws_instance.bar.*
+aws_instance.foo.0:
+  ID = foo
+  type = aws_instance
+  value = 0
+aws_instance.foo.1:
+  ID = foo
+  type = aws_instance
+  value = 1
+`
+
+const testTerraformPlanMovedStr = `
+aws_instance.renamed:
+  ID = foo
+  foo = bar
+  type = aws_instance
+
+module.child:
+  aws_instance.baz:
+    ID = baz
+    foo = bar
+    type = aws_instance
+`
+
+const testTerraformPlanForceReplaceStr = `
+DIFF:
+
+DESTROY/CREATE: aws_instance.foo
+  ami:  "bar" => "bar"
+  num:  "2" => "2"
+  type: "aws_instance" => "aws_instance"
+
+STATE:
+
+aws_instance.bar:
+  ID = bar
+  num = 1
+  type = aws_instance
+aws_instance.foo:
+  ID = foo
+  ami = bar
+  num = 2
+  type = aws_instance
+`
+
+const testTerraformPlanCountComputedStr = `
+DIFF:
+
+CREATE: aws_instance.foo
+  foo:  "" => "<computed>"
+  num:  "" => "2"
+  type: "" => "aws_instance"
+DEFERRED: aws_instance.bar (count computed)
+
+STATE:
+
+<no state>
+`
+
+const testTerraformPlanCountComputedModuleStr = `
+DIFF:
+
+CREATE: aws_instance.foo
+  foo:  "" => "<computed>"
+  type: "" => "aws_instance"
+
+module.child:
+  DEFERRED: aws_instance.bar (count computed)
+
+STATE:
+
+<no state>
+`
+
 const testTerraformPlanCountIndexStr = `
 DIFF:
 
@@ -1566,6 +1735,13 @@ aws_instance.foo:
   ami = ami-abcd1234
 `
 
+const testTerraformPlanIgnoreChangesNestedStr = `
+UPDATE: aws_instance.foo
+  ami:                            "" => "ami-new"
+  ebs_block_device.0.device_name: "" => "/dev/sdc"
+  type:                           "" => "aws_instance"
+`
+
 const testTerraformPlanIgnoreChangesWildcardStr = `
 DIFF:
 
@@ -1641,3 +1817,71 @@ data.null_data_source.foo:
   foo = yes
   type = null_data_source
 `
+
+const testTerraformApplyValuesStr = `
+aws_instance.web:
+  ID = foo
+  foo = web-prod
+  type = aws_instance
+
+  Dependencies:
+    values.tags
+values.tags:
+  ID = values.tags
+  env = prod
+  name = web-prod
+`
+
+const testTerraformApplyValuesUpdateStr = `
+aws_instance.web:
+  ID = foo
+  foo = web-dev
+  type = aws_instance
+
+  Dependencies:
+    values.tags
+values.tags:
+  ID = values.tags
+  env = dev
+  name = web-dev
+`
+
+const testTerraformApplyProvisionerRewriteConfigErrorStr = `
+aws_instance.bar:
+  ID = foo
+aws_instance.foo: (tainted)
+  ID = foo
+`
+
+const testTerraformApplyIdChangeStr = `
+aws_instance.dep:
+  ID = d
+  ids = i-0,i-1
+  type = aws_instance
+aws_instance.foo.0:
+  ID = i-0
+  foo = bar
+  type = aws_instance
+aws_instance.foo.1:
+  ID = i-1-new
+  foo = bar
+  type = aws_instance
+`
+
+const testTerraformApplyIdChangePlannedStr = `
+aws_instance.dep:
+  ID = d
+  ids = i-0,i-1-new
+  type = aws_instance
+
+  Dependencies:
+    aws_instance.foo.*
+aws_instance.foo.0:
+  ID = i-0
+  foo = bar
+  type = aws_instance
+aws_instance.foo.1:
+  ID = i-1-new
+  foo = bar
+  type = aws_instance
+`
@@ -0,0 +1,5 @@
+resource "aws_instance" "foo" {
+    foo = "new"
+    bar = "new"
+    list = ["a", "b"]
+}
@@ -0,0 +1,12 @@
+resource "aws_instance" "a" {
+    foo = "a"
+}
+
+resource "aws_instance" "b" {
+    foo         = "${aws_instance.a.id}"
+    require_new = "new"
+
+    lifecycle {
+        create_before_destroy = true
+    }
+}
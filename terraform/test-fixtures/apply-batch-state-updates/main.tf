@@ -0,0 +1,12 @@
+resource "aws_instance" "a" {
+    foo = "a"
+}
+
+resource "aws_instance" "b" {
+    foo = "${aws_instance.a.id}"
+}
+
+resource "aws_instance" "c" {
+    count = 3
+    foo   = "c"
+}
@@ -0,0 +1,99 @@
+provider "aws" {
+  alias = "p0"
+  foo   = "bar"
+}
+
+resource "aws_instance" "r0" {
+  count    = 5
+  provider = "aws.p0"
+}
+
+provider "aws" {
+  alias = "p1"
+  foo   = "bar"
+}
+
+resource "aws_instance" "r1" {
+  count    = 5
+  provider = "aws.p1"
+}
+
+provider "aws" {
+  alias = "p2"
+  foo   = "bar"
+}
+
+resource "aws_instance" "r2" {
+  count    = 5
+  provider = "aws.p2"
+}
+
+provider "aws" {
+  alias = "p3"
+  foo   = "bar"
+}
+
+resource "aws_instance" "r3" {
+  count    = 5
+  provider = "aws.p3"
+}
+
+provider "aws" {
+  alias = "p4"
+  foo   = "bar"
+}
+
+resource "aws_instance" "r4" {
+  count    = 5
+  provider = "aws.p4"
+}
+
+provider "aws" {
+  alias = "p5"
+  foo   = "bar"
+}
+
+resource "aws_instance" "r5" {
+  count    = 5
+  provider = "aws.p5"
+}
+
+provider "aws" {
+  alias = "p6"
+  foo   = "bar"
+}
+
+resource "aws_instance" "r6" {
+  count    = 5
+  provider = "aws.p6"
+}
+
+provider "aws" {
+  alias = "p7"
+  foo   = "bar"
+}
+
+resource "aws_instance" "r7" {
+  count    = 5
+  provider = "aws.p7"
+}
+
+provider "aws" {
+  alias = "p8"
+  foo   = "bar"
+}
+
+resource "aws_instance" "r8" {
+  count    = 5
+  provider = "aws.p8"
+}
+
+provider "aws" {
+  alias = "p9"
+  foo   = "bar"
+}
+
+resource "aws_instance" "r9" {
+  count    = 5
+  provider = "aws.p9"
+}
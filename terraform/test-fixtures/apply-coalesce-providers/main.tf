@@ -0,0 +1,36 @@
+provider "aws" {
+  foo = "bar"
+}
+
+provider "aws" {
+  alias = "same"
+  foo   = "bar"
+}
+
+provider "aws" {
+  alias = "other"
+  foo   = "baz"
+}
+
+provider "aws" {
+  alias = "inherited"
+  foo   = "bar"
+}
+
+resource "aws_instance" "a" {}
+
+resource "aws_instance" "b" {
+  provider = "aws.same"
+}
+
+resource "aws_instance" "c" {
+  provider = "aws.other"
+}
+
+resource "aws_instance" "d" {
+  provider = "aws.inherited"
+}
+
+module "child" {
+  source = "./child"
+}
@@ -0,0 +1,17 @@
+variable "count" {
+    default = 3
+}
+
+resource "aws_instance" "foo" {
+    count = "${var.count}"
+    value = "${count.index}"
+}
+
+resource "aws_instance" "bar" {
+    count = "${length(aws_instance.foo.*.id)}"
+    foo   = "${element(aws_instance.foo.*.value, count.index)}"
+}
+
+resource "aws_instance" "baz" {
+    foo = "${join(",", aws_instance.bar.*.foo)}"
+}
@@ -0,0 +1,7 @@
+resource "null_resource" "write" {
+  compute = "value"
+}
+
+data "null_data_source" "read" {
+  foo = "${null_resource.write.value}"
+}
@@ -0,0 +1,7 @@
+resource "null_resource" "write" {
+  foo = "bar"
+}
+
+data "null_data_source" "read" {
+  foo = "${null_resource.write.foo}"
+}
@@ -0,0 +1,11 @@
+resource "aws_instance" "foo" {
+    num = "2"
+}
+
+resource "aws_instance" "bar" {
+    require_new = "yes"
+}
+
+resource "aws_instance" "baz" {
+    foo = "${aws_instance.bar.id}"
+}
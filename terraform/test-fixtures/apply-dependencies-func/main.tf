@@ -0,0 +1,23 @@
+resource "aws_instance" "a" {}
+
+resource "aws_instance" "b" {
+    foo = "${aws_instance.a.id}"
+}
+
+resource "aws_instance" "c" {
+    depends_on = ["aws_instance.a"]
+
+    provisioner "shell" {
+        connection {
+            host = "${aws_instance.b.id}"
+        }
+    }
+}
+
+resource "aws_instance" "d" {
+    foo = "${join(",", dependencies("aws_instance.c"))}"
+}
+
+output "deps" {
+    value = "${join(",", dependencies("aws_instance.b"))}"
+}
@@ -0,0 +1,8 @@
+resource "aws_instance" "foo" {
+    count = 3
+}
+
+resource "aws_instance" "bar" {
+    count = 3
+    foo = "${aws_instance.foo.0.id}"
+}
@@ -0,0 +1,4 @@
+resource "aws_instance" "foo" {
+  name  = "Foo"
+  value = "bar"
+}
@@ -0,0 +1,12 @@
+resource "aws_instance" "foo" {
+  count = 2
+  num   = "1"
+}
+
+resource "aws_instance" "bar" {
+  num = "2"
+}
+
+resource "aws_instance" "ok" {
+  num = "3"
+}
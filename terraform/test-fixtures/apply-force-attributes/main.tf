@@ -0,0 +1,9 @@
+resource "aws_instance" "foo" {
+    ami = "bar"
+    num = "2"
+}
+
+resource "aws_instance" "bar" {
+    num = "1"
+    __num_requires_new = "1"
+}
@@ -0,0 +1,8 @@
+resource "aws_instance" "foo" {
+  count = 2
+  foo   = "bar"
+}
+
+resource "aws_instance" "dep" {
+  ids = "${join(",", aws_instance.foo.*.id)}"
+}
@@ -0,0 +1,7 @@
+resource "aws_instance" "foo" {
+    foo = "bar"
+
+    lifecycle {
+        import_id = "us-west-2/i-abc123"
+    }
+}
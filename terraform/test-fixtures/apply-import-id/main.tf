@@ -0,0 +1,9 @@
+resource "aws_instance" "foo" {
+    foo = "bar"
+
+    lifecycle {
+        import_id = "i-abc123"
+    }
+
+    provisioner "shell" {}
+}
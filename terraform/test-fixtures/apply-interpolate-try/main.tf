@@ -0,0 +1,8 @@
+resource "aws_instance" "foo" {
+  num = "2"
+}
+
+resource "aws_instance" "bar" {
+  missing = "${try(aws_instance.foo.missing, "default")}"
+  present = "${try(aws_instance.foo.num, "default")}"
+}
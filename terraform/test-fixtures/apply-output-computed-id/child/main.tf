@@ -0,0 +1,13 @@
+variable "value" {}
+
+resource "aws_instance" "bar" {
+    foo = "${var.value}"
+}
+
+output "id" {
+    value = "${aws_instance.bar.id}"
+}
+
+output "value" {
+    value = "${var.value}"
+}
@@ -0,0 +1,18 @@
+resource "aws_instance" "foo" {}
+
+module "child" {
+    source = "./child"
+    value  = "${aws_instance.foo.id}"
+}
+
+output "id" {
+    value = "${aws_instance.foo.id}"
+}
+
+output "child_id" {
+    value = "${module.child.id}"
+}
+
+output "child_value" {
+    value = "${module.child.value}"
+}
@@ -0,0 +1,20 @@
+resource "aws_instance" "pass" {
+    foo = "bar"
+
+    lifecycle {
+        postcondition {
+            condition = "${self.foo == "bar"}"
+        }
+    }
+}
+
+resource "aws_instance" "fail" {
+    foo = "${aws_instance.pass.foo}"
+
+    lifecycle {
+        postcondition {
+            condition     = "${self.foo == "baz"}"
+            error_message = "foo must be baz, got ${self.foo}"
+        }
+    }
+}
@@ -0,0 +1,12 @@
+variable "expected" {}
+
+resource "aws_instance" "bar" {}
+
+resource "aws_instance" "baz" {
+    lifecycle {
+        precondition {
+            condition     = "${aws_instance.bar.id == var.expected}"
+            error_message = "bar has the wrong ID"
+        }
+    }
+}
@@ -0,0 +1,19 @@
+resource "aws_instance" "foo" {
+    ami = "new"
+
+    lifecycle {
+        preserve_prior_state = true
+    }
+}
+
+resource "aws_instance" "bar" {
+    ami = "new"
+
+    lifecycle {
+        preserve_prior_state = true
+    }
+}
+
+resource "aws_instance" "baz" {
+    ami = "new"
+}
@@ -0,0 +1,11 @@
+resource "aws_instance" "foo" {
+  require_new = "yes"
+
+  lifecycle {
+    prevent_destroy = true
+  }
+}
+
+resource "aws_instance" "bar" {
+  foo = "bar"
+}
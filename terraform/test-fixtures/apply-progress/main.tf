@@ -0,0 +1,11 @@
+resource "aws_instance" "a" {
+  foo = "a"
+}
+
+resource "aws_instance" "b" {
+  foo = "b"
+}
+
+resource "aws_instance" "c" {
+  foo = "${aws_instance.a.foo}"
+}
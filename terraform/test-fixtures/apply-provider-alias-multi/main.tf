@@ -0,0 +1,27 @@
+provider "aws" {
+  region = "default"
+}
+
+provider "aws" {
+  alias  = "east"
+  region = "east"
+}
+
+provider "aws" {
+  alias  = "west"
+  region = "west"
+}
+
+resource "aws_instance" "default" {
+  num = "1"
+}
+
+resource "aws_instance" "east" {
+  provider = "aws.east"
+  num      = "2"
+}
+
+resource "aws_instance" "west" {
+  provider = "aws.west"
+  num      = "3"
+}
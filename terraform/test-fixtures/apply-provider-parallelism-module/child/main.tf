@@ -0,0 +1,7 @@
+provider "aws" {
+  region = "child"
+}
+
+resource "aws_instance" "bar" {
+  count = 2
+}
@@ -0,0 +1,7 @@
+resource "aws_instance" "foo" {
+  count = 2
+}
+
+module "child" {
+  source = "./child"
+}
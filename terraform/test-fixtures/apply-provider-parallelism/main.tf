@@ -0,0 +1,7 @@
+resource "aws_instance" "foo" {
+  count = 3
+}
+
+resource "do_droplet" "bar" {
+  count = 2
+}
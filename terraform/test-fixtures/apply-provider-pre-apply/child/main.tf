@@ -0,0 +1,3 @@
+resource "aws_instance" "child" {
+    count = 2
+}
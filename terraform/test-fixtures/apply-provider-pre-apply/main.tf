@@ -0,0 +1,20 @@
+provider "aws" {
+    alias = "west"
+}
+
+resource "aws_instance" "foo" {
+    count = 3
+}
+
+resource "aws_instance" "west" {
+    provider = "aws.west"
+    count = 2
+}
+
+resource "do_instance" "foo" {
+    count = 2
+}
+
+module "child" {
+    source = "./child"
+}
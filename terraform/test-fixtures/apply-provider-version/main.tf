@@ -0,0 +1,7 @@
+provider "aws" {
+    version = "~> 1.2"
+}
+
+resource "aws_instance" "foo" {
+    foo = "bar"
+}
@@ -0,0 +1,23 @@
+resource "aws_instance" "foo" {
+    count = 2
+    foo = "bar"
+
+    provisioner "shell" {
+        command = "always"
+    }
+
+    provisioner "shell" {
+        command   = "first"
+        condition = "${count.index == 0}"
+    }
+
+    provisioner "shell" {
+        command   = "computed"
+        condition = "${self.id == "foo"}"
+    }
+
+    provisioner "shell" {
+        command   = "never"
+        condition = "${self.foo == "baz"}"
+    }
+}
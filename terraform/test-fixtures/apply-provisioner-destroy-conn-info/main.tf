@@ -0,0 +1,12 @@
+resource "aws_instance" "bastion" {}
+
+resource "aws_instance" "web" {
+    provisioner "shell" {
+        when = "destroy"
+        foo = "destroy"
+
+        connection {
+            bastion_host = "${aws_instance.bastion.id}"
+        }
+    }
+}
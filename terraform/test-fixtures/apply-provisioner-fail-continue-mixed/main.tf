@@ -0,0 +1,16 @@
+resource "aws_instance" "foo" {
+    foo = "bar"
+
+    provisioner "shell" {
+        foo        = "one"
+        on_failure = "continue"
+    }
+
+    provisioner "shell" {
+        foo = "two"
+    }
+
+    provisioner "shell" {
+        foo = "three"
+    }
+}
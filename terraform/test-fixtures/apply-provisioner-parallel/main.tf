@@ -0,0 +1,21 @@
+resource "aws_instance" "foo" {
+    lifecycle {
+        parallel_provisioners = true
+    }
+
+    connection {
+        host = "foo"
+    }
+
+    provisioner "shell" {
+        command = "one"
+    }
+
+    provisioner "shell" {
+        command = "two"
+
+        connection {
+            host = "two"
+        }
+    }
+}
@@ -0,0 +1,12 @@
+resource "aws_instance" "foo" {
+  provisioner "shell" {
+    command = "echo ${self.id}"
+  }
+}
+
+resource "aws_instance" "bar" {
+  provisioner "shell" {
+    command    = "echo bar"
+    on_failure = "continue"
+  }
+}
@@ -0,0 +1,8 @@
+resource "aws_instance" "foo" {
+    compute = "ip"
+
+    provisioner "shell" {
+        command = "${self.id}"
+        ip      = "${self.ip}"
+    }
+}
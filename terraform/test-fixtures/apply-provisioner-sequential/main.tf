@@ -0,0 +1,17 @@
+resource "aws_instance" "foo" {
+    connection {
+        host = "foo"
+    }
+
+    provisioner "shell" {
+        command = "one"
+    }
+
+    provisioner "shell" {
+        command = "two"
+
+        connection {
+            host = "two"
+        }
+    }
+}
@@ -0,0 +1,12 @@
+resource "aws_instance" "foo" {
+  ami = "new"
+}
+
+resource "aws_instance" "bar" {
+  num = "1"
+
+  lifecycle {
+    create_before_destroy = true
+    replace_triggered_by  = ["aws_instance.foo"]
+  }
+}
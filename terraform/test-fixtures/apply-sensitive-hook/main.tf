@@ -0,0 +1,4 @@
+resource "aws_instance" "foo" {
+    foo      = "bar"
+    password = "hunter2"
+}
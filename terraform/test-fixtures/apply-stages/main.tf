@@ -0,0 +1,7 @@
+resource "aws_instance" "a" {
+    count = 2
+}
+
+resource "aws_instance" "b" {}
+
+resource "aws_instance" "c" {}
@@ -0,0 +1,13 @@
+resource "aws_instance" "foo" {
+  count = 2
+  num   = "2"
+}
+
+resource "aws_instance" "bar" {
+  foo        = "${aws_instance.foo.0.num}"
+  depends_on = ["aws_instance.baz"]
+}
+
+resource "aws_instance" "baz" {
+  foo = "${join(",", aws_instance.foo.*.num)}"
+}
@@ -0,0 +1,9 @@
+variable "value" {}
+
+resource "aws_instance" "foo" {
+  require_new = "${var.value}"
+
+  lifecycle {
+    create_before_destroy = true
+  }
+}
@@ -0,0 +1,5 @@
+variable "value" {}
+
+resource "aws_instance" "foo" {
+  foo = "${var.value}"
+}
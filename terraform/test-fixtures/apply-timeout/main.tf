@@ -0,0 +1,7 @@
+resource "aws_instance" "foo" {
+    num = "2"
+
+    lifecycle {
+        timeout = "10ms"
+    }
+}
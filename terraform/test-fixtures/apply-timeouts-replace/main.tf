@@ -0,0 +1,21 @@
+resource "aws_instance" "foo" {
+    require_new = "new"
+
+    lifecycle {
+        timeouts {
+            create = "1m"
+            delete = "10ms"
+        }
+    }
+}
+
+resource "aws_instance" "bar" {
+    require_new = "new"
+
+    lifecycle {
+        timeouts {
+            create = "10ms"
+            delete = "1m"
+        }
+    }
+}
@@ -0,0 +1,14 @@
+provider "aws" {
+  alias = "west"
+}
+
+resource "aws_instance" "foo" {
+  num = "2"
+}
+
+resource "aws_instance" "bar" {
+  provider = "aws.west"
+  foo      = "${aws_instance.foo.id}"
+
+  provisioner "shell" {}
+}
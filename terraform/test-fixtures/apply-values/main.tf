@@ -0,0 +1,10 @@
+variable "env" {}
+
+values "tags" {
+  env  = "${var.env}"
+  name = "web-${var.env}"
+}
+
+resource "aws_instance" "web" {
+  foo = "${values.tags.name}"
+}
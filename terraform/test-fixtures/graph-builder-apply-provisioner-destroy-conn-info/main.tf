@@ -0,0 +1,13 @@
+resource "aws_instance" "bastion" {
+    foo = "bar"
+}
+
+resource "aws_instance" "web" {
+    provisioner "exec" {
+        when = "destroy"
+
+        connection {
+            bastion_host = "${aws_instance.bastion.id}"
+        }
+    }
+}
@@ -0,0 +1,6 @@
+data "aws_ami" "foo" {}
+
+resource "aws_instance" "web" {
+    count = 2
+    ami   = "${data.aws_ami.foo.id}"
+}
@@ -0,0 +1,10 @@
+resource "aws_instance" "foo" {
+    ami  = "ami-abc123"
+    arn  = "arn:foo"
+    zone = "us-east-1a"
+
+    ebs_block_device {
+        volume_size = 10
+        volume_id   = "vol-abc123"
+    }
+}
@@ -0,0 +1,12 @@
+resource "aws_instance" "a" {
+    compute = "foo"
+}
+
+resource "aws_instance" "b" {
+    foo  = "${aws_instance.a.foo}"
+    list = ["x", "${aws_instance.a.foo}"]
+}
+
+resource "aws_instance" "c" {
+    foo = "${aws_instance.b.foo}"
+}
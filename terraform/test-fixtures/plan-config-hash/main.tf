@@ -0,0 +1,13 @@
+variable "num" {
+    default = "2"
+}
+
+resource "aws_instance" "foo" {
+    num = "${var.num}"
+    tag = "${confighash()}"
+}
+
+resource "aws_instance" "bar" {
+    foo = "${aws_instance.foo.id}"
+    tag = "${confighash()}"
+}
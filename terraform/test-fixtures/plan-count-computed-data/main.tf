@@ -0,0 +1,8 @@
+resource "aws_instance" "foo" {
+    num = "2"
+    compute = "foo"
+}
+
+data "aws_data_source" "bar" {
+    count = "${aws_instance.foo.foo}"
+}
@@ -0,0 +1,11 @@
+resource "aws_instance" "a" {
+  foo = "${aws_security_group.b.id}"
+}
+
+resource "aws_security_group" "b" {
+  provisioner "shell" {
+    connection {
+      host = "${aws_instance.a.id}"
+    }
+  }
+}
@@ -0,0 +1,4 @@
+resource "aws_instance" "foo" {
+    count = 50
+    foo = "bar-${count.index}"
+}
@@ -0,0 +1,19 @@
+variable "ami" {
+    default = "foo"
+}
+
+resource "aws_instance" "foo" {
+    ami = "${var.ami}"
+}
+
+resource "aws_instance" "bar" {
+    foo = "bar"
+}
+
+resource "aws_instance" "new" {
+    foo = "new"
+}
+
+resource "aws_instance" "dep" {
+    foo = "${aws_instance.new.id}"
+}
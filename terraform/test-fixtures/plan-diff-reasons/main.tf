@@ -0,0 +1,23 @@
+resource "aws_instance" "drift" {
+  foo = "bar"
+}
+
+resource "aws_instance" "config" {
+  foo = "new"
+}
+
+resource "aws_instance" "both" {
+  foo = "new"
+}
+
+resource "aws_instance" "tainted" {
+  foo = "bar"
+}
+
+resource "aws_instance" "triggered" {
+  foo = "bar"
+
+  lifecycle {
+    replace_triggered_by = ["aws_instance.config"]
+  }
+}
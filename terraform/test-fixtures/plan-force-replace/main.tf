@@ -0,0 +1,8 @@
+resource "aws_instance" "foo" {
+  ami = "bar"
+  num = "2"
+}
+
+resource "aws_instance" "bar" {
+  num = "1"
+}
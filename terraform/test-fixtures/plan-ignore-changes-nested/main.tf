@@ -0,0 +1,16 @@
+resource "aws_instance" "foo" {
+  ami = "ami-new"
+
+  ebs_block_device {
+    device_name = "/dev/sdc"
+    volume_size = "20"
+  }
+
+  root_block_device {
+    volume_size = "20"
+  }
+
+  lifecycle {
+    ignore_changes = ["ebs_block_device.0.volume_size", "root_block_device"]
+  }
+}
@@ -0,0 +1,12 @@
+variable "foo" {}
+
+variable "bar" {}
+
+resource "aws_instance" "foo" {
+  require_new   = "${var.foo}"
+  instance_type = "${var.bar}"
+
+  lifecycle {
+    ignore_changes = ["*"]
+  }
+}
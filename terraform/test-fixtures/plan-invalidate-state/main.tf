@@ -0,0 +1,11 @@
+resource "aws_instance" "foo" {
+    foo = "bar"
+}
+
+resource "aws_instance" "bar" {
+    foo = "bar"
+}
+
+module "child" {
+    source = "./child"
+}
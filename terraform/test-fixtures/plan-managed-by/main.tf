@@ -0,0 +1,14 @@
+resource "aws_instance" "foo" {
+    count = 2
+    tags {
+        managed_by = "prod"
+    }
+}
+
+resource "aws_instance" "bar" {
+    tags {
+        managed_by = "prod"
+    }
+}
+
+resource "aws_instance" "untagged" {}
@@ -0,0 +1,7 @@
+resource "aws_instance" "renamed" {
+  foo = "bar"
+}
+
+module "child" {
+  source = "./child"
+}
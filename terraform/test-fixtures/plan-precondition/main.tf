@@ -0,0 +1,12 @@
+variable "region" {}
+
+resource "aws_instance" "foo" {
+    num = "2"
+
+    lifecycle {
+        precondition {
+            condition     = "${var.region == "us-east-1"}"
+            error_message = "the AMI is only in us-east-1, not ${var.region}"
+        }
+    }
+}
@@ -0,0 +1,8 @@
+resource "aws_instance" "foo" {
+    require_new = "new"
+    num         = "2"
+
+    lifecycle {
+        prevent_replace = true
+    }
+}
@@ -0,0 +1,11 @@
+resource "aws_instance" "foo" {
+  count = 2
+}
+
+resource "aws_instance" "bar" {
+  warn = "unique"
+}
+
+module "child" {
+  source = "./child"
+}
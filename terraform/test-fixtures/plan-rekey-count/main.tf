@@ -0,0 +1,7 @@
+resource "aws_instance" "a" {
+  foo = "bar"
+}
+
+resource "aws_instance" "b" {
+  foo = "bar"
+}
@@ -0,0 +1,13 @@
+variable "ami" {}
+
+resource "aws_instance" "foo" {
+  ami = "${var.ami}"
+}
+
+resource "aws_instance" "bar" {
+  num = "1"
+
+  lifecycle {
+    replace_triggered_by = ["aws_instance.foo.ami"]
+  }
+}
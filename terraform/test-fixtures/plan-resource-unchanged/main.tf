@@ -0,0 +1,11 @@
+resource "aws_instance" "foo" {
+    num = "2"
+}
+
+resource "aws_instance" "bar" {
+    num = "2"
+}
+
+data "aws_data_source" "foo" {
+    foo = "yes"
+}
@@ -0,0 +1,9 @@
+variable "vpc_id" {}
+
+resource "aws_instance" "child" {
+    vpc_id = "${var.vpc_id}"
+}
+
+output "id" {
+    value = "${aws_instance.child.id}"
+}
@@ -0,0 +1,33 @@
+resource "aws_vpc" "main" {}
+
+resource "aws_subnet" "a" {
+    vpc_id = "${aws_vpc.main.id}"
+}
+
+resource "aws_instance" "web" {
+    count = 2
+    subnet_id = "${aws_subnet.a.id}"
+}
+
+resource "aws_instance" "after" {
+    depends_on = ["aws_instance.web"]
+}
+
+resource "aws_instance" "bastion" {
+    provisioner "shell" {
+        connection {
+            host = "${aws_vpc.main.id}"
+        }
+    }
+}
+
+resource "aws_instance" "unrelated" {}
+
+module "child" {
+    source = "./child"
+    vpc_id = "${aws_vpc.main.id}"
+}
+
+resource "aws_instance" "from_child" {
+    foo = "${module.child.id}"
+}
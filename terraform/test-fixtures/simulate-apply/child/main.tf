@@ -0,0 +1,9 @@
+variable "instance" {}
+
+resource "aws_eip" "ip" {
+  instance = "${var.instance}"
+}
+
+output "address" {
+  value = "${aws_eip.ip.public_ip}"
+}
@@ -0,0 +1,16 @@
+data "aws_ami" "image" {
+  name = "web"
+}
+
+resource "aws_instance" "base" {
+  ami = "${data.aws_ami.image.image_id}"
+}
+
+module "child" {
+  source   = "./child"
+  instance = "${aws_instance.base.id}"
+}
+
+resource "aws_instance" "top" {
+  address = "${module.child.address}"
+}
@@ -0,0 +1,12 @@
+resource "test" "bastion" {}
+
+resource "test" "web" {
+    provisioner "shell" {
+        when = "destroy"
+        command = "echo goodbye"
+
+        connection {
+            bastion_host = "${test.bastion.public_ip}"
+        }
+    }
+}
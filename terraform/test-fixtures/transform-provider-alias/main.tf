@@ -0,0 +1,19 @@
+provider "aws" {}
+
+provider "aws" {
+  alias = "east"
+}
+
+provider "aws" {
+  alias = "west"
+}
+
+resource "aws_instance" "default" {}
+
+resource "aws_instance" "east" {
+  provider = "aws.east"
+}
+
+resource "aws_instance" "west" {
+  provider = "aws.west"
+}
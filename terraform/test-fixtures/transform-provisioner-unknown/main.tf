@@ -0,0 +1,5 @@
+resource "aws_instance" "web" {
+  provisioner "shell" {}
+  provisioner "foo" {}
+  provisioner "shell" {}
+}
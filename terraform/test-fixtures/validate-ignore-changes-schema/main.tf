@@ -0,0 +1,17 @@
+resource "aws_instance" "foo" {
+    lifecycle {
+        ignore_changes = [
+            "ami",
+            "amii",
+            "tags.Name",
+            "ebs_block_device.0.volume_size",
+            "ebs_block_device[0].volume_sise",
+        ]
+    }
+}
+
+resource "aws_instance" "bar" {
+    lifecycle {
+        ignore_changes = ["*"]
+    }
+}
@@ -0,0 +1,7 @@
+provider "aws" {
+    value = "${aws_instance.foo.value}"
+}
+
+resource "aws_instance" "foo" {
+    value = "yes"
+}
@@ -0,0 +1,15 @@
+resource "aws_instance" "bar" {}
+
+resource "aws_instance" "foo" {
+    provisioner "shell" {
+        command = "${self.public_ip} ${aws_instance.bar.whatever}"
+    }
+
+    provisioner "shell" {
+        command = "${self.ebs_block_device.0.device_nmae}"
+
+        connection {
+            host = "${self.pubilc_ip}"
+        }
+    }
+}
@@ -0,0 +1,10 @@
+resource "aws_instance" "foo" {
+  provisioner "shell" {}
+  provisioner "nope" {}
+  provisioner "shell" {}
+  provisioner "nope" {}
+}
+
+module "child" {
+  source = "./child"
+}
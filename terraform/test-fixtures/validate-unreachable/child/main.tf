@@ -0,0 +1,23 @@
+variable "ami" {}
+
+resource "aws_instance" "uses_var" {
+    ami = "${var.ami}"
+}
+
+resource "aws_instance" "referenced" {}
+
+output "id" {
+    value = "${aws_instance.referenced.id}"
+}
+
+resource "aws_instance" "dependency" {}
+
+resource "aws_instance" "dependent" {
+    depends_on = ["aws_instance.dependency"]
+}
+
+resource "aws_instance" "unused" {}
+
+resource "aws_instance" "counted" {
+    count = 2
+}
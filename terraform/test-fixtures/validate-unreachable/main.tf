@@ -0,0 +1,10 @@
+resource "aws_instance" "standalone" {}
+
+module "child" {
+    source = "./child"
+    ami = "foo"
+}
+
+output "out" {
+    value = "${module.child.id}"
+}
@@ -0,0 +1,25 @@
+package terraform
+
+// Tracer is the interface that must be implemented to trace the operations
+// done on resources during an apply, such as to export them as
+// OpenTelemetry spans. See ContextOpts.Tracer.
+//
+// A Tracer is called concurrently for the resources applied in parallel.
+type Tracer interface {
+	// StartSpan starts a span with the given name and tags. Parent is the
+	// span it's part of, or nil for the span of a resource.
+	StartSpan(parent TraceSpan, name string, tags map[string]string) TraceSpan
+}
+
+// TraceSpan is a span started by a Tracer.
+type TraceSpan interface {
+	// Finish ends the span. The error is the one the operation failed
+	// with, or nil if it succeeded. Finish is called exactly once.
+	Finish(error)
+}
+
+// The tags set on the spans of a resource.
+const (
+	TraceTagAddress  = "address"
+	TraceTagProvider = "provider"
+)
@@ -0,0 +1,68 @@
+package terraform
+
+import (
+	"github.com/hashicorp/terraform/dag"
+)
+
+// ApplyStageTransformer adds a gate between each of the stages of
+// ContextOpts.ApplyStages, which depends on every resource of the stage
+// before it and that every resource of the stage after it depends on. A
+// resource is in the first stage that contains its address, and the
+// resources that are in no stage aren't ordered by the gates.
+type ApplyStageTransformer struct {
+	Stages [][]*ResourceAddress
+}
+
+func (t *ApplyStageTransformer) Transform(g *Graph) error {
+	// A single stage has nothing to wait for
+	if len(t.Stages) < 2 {
+		return nil
+	}
+
+	members := make([][]dag.Vertex, len(t.Stages))
+	for _, v := range g.Vertices() {
+		r, ok := v.(GraphNodeResource)
+		if !ok {
+			continue
+		}
+
+		if i := t.stage(r.ResourceAddr()); i >= 0 {
+			members[i] = append(members[i], v)
+		}
+	}
+
+	var prev dag.Vertex
+	for i := 1; i < len(t.Stages); i++ {
+		gate := &NodeApplyStageGate{Stage: i}
+		g.Add(gate)
+
+		// The gates are consulted in order, even if a stage is empty
+		if prev != nil {
+			g.Connect(dag.BasicEdge(gate, prev))
+		}
+		for _, v := range members[i-1] {
+			g.Connect(dag.BasicEdge(gate, v))
+		}
+		for _, v := range members[i] {
+			g.Connect(dag.BasicEdge(v, gate))
+		}
+
+		prev = gate
+	}
+
+	return nil
+}
+
+// stage returns the index of the first stage that contains addr, or -1
+// if it's in no stage.
+func (t *ApplyStageTransformer) stage(addr *ResourceAddress) int {
+	for i, stage := range t.Stages {
+		for _, stageAddr := range stage {
+			if stageAddr.Contains(addr) {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
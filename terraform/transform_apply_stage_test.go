@@ -0,0 +1,59 @@
+package terraform
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyStageTransformer(t *testing.T) {
+	mod := testModule(t, "apply-stages")
+
+	g := Graph{Path: RootModulePath}
+	{
+		tf := &ConfigTransformer{Module: mod}
+		if err := tf.Transform(&g); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	var stages [][]*ResourceAddress
+	for _, stage := range [][]string{
+		[]string{"aws_instance.a"},
+		[]string{},
+		[]string{"aws_instance.b", "aws_instance.a"},
+	} {
+		var addrs []*ResourceAddress
+		for _, v := range stage {
+			addr, err := ParseResourceAddress(v)
+			if err != nil {
+				t.Fatalf("err: %s", err)
+			}
+			addrs = append(addrs, addr)
+		}
+		stages = append(stages, addrs)
+	}
+
+	{
+		tf := &ApplyStageTransformer{Stages: stages}
+		if err := tf.Transform(&g); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	actual := strings.TrimSpace(g.String())
+	expected := strings.TrimSpace(testApplyStageTransformerStr)
+	if actual != expected {
+		t.Fatalf("bad:\n\n%s", actual)
+	}
+}
+
+const testApplyStageTransformerStr = `
+aws_instance.a
+aws_instance.b
+  meta.apply-stage.2 (apply stage gate)
+aws_instance.c
+meta.apply-stage.1 (apply stage gate)
+  aws_instance.a
+meta.apply-stage.2 (apply stage gate)
+  meta.apply-stage.1 (apply stage gate)
+`
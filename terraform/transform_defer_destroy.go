@@ -0,0 +1,56 @@
+package terraform
+
+import (
+	"log"
+
+	"github.com/hashicorp/terraform/dag"
+)
+
+// DeferDestroyTransformer makes every destroy depend on every create and
+// update, so that with ContextOpts.DeferDestroys nothing is destroyed
+// until everything else is applied. A create or update that must happen
+// after a destroy, such as the replacement of a resource that isn't
+// create_before_destroy, keeps waiting for it instead, since the destroy
+// can't also wait for it.
+type DeferDestroyTransformer struct {
+	Enabled bool
+}
+
+func (t *DeferDestroyTransformer) Transform(g *Graph) error {
+	if !t.Enabled {
+		return nil
+	}
+
+	var destroyers []dag.Vertex
+	var creators []dag.Vertex
+	for _, v := range g.Vertices() {
+		if dn, ok := v.(GraphNodeDestroyer); ok && dn.DestroyAddr() != nil {
+			destroyers = append(destroyers, v)
+		}
+		if cn, ok := v.(GraphNodeCreator); ok && cn.CreateAddr() != nil {
+			creators = append(creators, v)
+		}
+	}
+
+	for _, cv := range creators {
+		// The dependencies of the creator only grow with the edges of the
+		// creators before it, so they're looked up once for each creator.
+		deps, err := g.Ancestors(cv)
+		if err != nil {
+			return err
+		}
+
+		for _, dv := range destroyers {
+			if deps.Include(dv) {
+				log.Printf(
+					"[TRACE] DeferDestroyTransformer: %s must be applied after %s, not deferring",
+					dag.VertexName(cv), dag.VertexName(dv))
+				continue
+			}
+
+			g.Connect(dag.BasicEdge(dv, cv))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package terraform
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/dag"
+)
+
+func TestDeferDestroyTransformer(t *testing.T) {
+	g := Graph{Path: RootModulePath}
+	destroyA := g.Add(&graphNodeDestroyerTest{AddrString: "test.A"})
+	g.Add(&graphNodeDestroyerTest{AddrString: "test.B"})
+	createA := g.Add(&graphNodeCreatorTest{AddrString: "test.A"})
+	createC := g.Add(&graphNodeCreatorTest{AddrString: "test.C"})
+	g.Add(&graphNodeCreatorTest{AddrString: "test.D"})
+
+	// A is replaced, and C depends on A
+	g.Connect(dag.BasicEdge(createA, destroyA))
+	g.Connect(dag.BasicEdge(createC, createA))
+
+	tf := &DeferDestroyTransformer{Enabled: true}
+	if err := tf.Transform(&g); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(g.String())
+	expected := strings.TrimSpace(testTransformDeferDestroyStr)
+	if actual != expected {
+		t.Fatalf("bad:\n\n%s", actual)
+	}
+}
+
+func TestDeferDestroyTransformer_disabled(t *testing.T) {
+	g := Graph{Path: RootModulePath}
+	g.Add(&graphNodeDestroyerTest{AddrString: "test.A"})
+	g.Add(&graphNodeCreatorTest{AddrString: "test.B"})
+
+	tf := &DeferDestroyTransformer{}
+	if err := tf.Transform(&g); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(g.String())
+	expected := strings.TrimSpace(testTransformDeferDestroyDisabledStr)
+	if actual != expected {
+		t.Fatalf("bad:\n\n%s", actual)
+	}
+}
+
+const testTransformDeferDestroyStr = `
+test.A
+  test.A (destroy)
+test.A (destroy)
+  test.D
+test.B (destroy)
+  test.A
+  test.C
+  test.D
+test.C
+  test.A
+test.D
+`
+
+const testTransformDeferDestroyDisabledStr = `
+test.A (destroy)
+test.B
+`
@@ -114,8 +114,9 @@ func (n *graphNodeDeposedResource) EvalTree() EvalNode {
 		Node: &EvalSequence{
 			Nodes: []EvalNode{
 				&EvalGetProvider{
-					Name:   n.ProvidedBy()[0],
-					Output: &provider,
+					Name:     n.ProvidedBy()[0],
+					Output:   &provider,
+					PreApply: true,
 				},
 				&EvalReadStateDeposed{
 					Name:   n.ResourceName,
@@ -45,6 +45,14 @@ type CBDEdgeTransformer struct {
 func (t *CBDEdgeTransformer) Transform(g *Graph) error {
 	log.Printf("[TRACE] CBDEdgeTransformer: Beginning CBD transformation...")
 
+	// Resources that depend on a CBD resource must be CBD as well,
+	// otherwise the creation of the dependent waits on the destruction of
+	// the CBD resource, which itself waits on the dependent: a cycle.
+	upgraded, err := t.propagateDependents(g)
+	if err != nil {
+		return err
+	}
+
 	// Go through and reverse any destroy edges
 	destroyMap := make(map[string][]dag.Vertex)
 	for _, v := range g.Vertices() {
@@ -53,7 +61,7 @@ func (t *CBDEdgeTransformer) Transform(g *Graph) error {
 			continue
 		}
 
-		if !dn.CreateBeforeDestroy() {
+		if !dn.CreateBeforeDestroy() && !upgraded[v] {
 			// If there are no CBD ancestors (dependent nodes), then we
 			// do nothing here.
 			if !t.hasCBDAncestor(g, v) {
@@ -212,6 +220,117 @@ func (t *CBDEdgeTransformer) depMap(
 	return depMap, nil
 }
 
+// propagateDependents enables CBD on the destroy nodes of any resource that
+// depends on a resource whose destroy node has CBD enabled. This repeats
+// until nothing changes so that CBD is carried along a chain of references.
+// The destroy nodes that were modified are returned.
+func (t *CBDEdgeTransformer) propagateDependents(g *Graph) (map[dag.Vertex]bool, error) {
+	// Map the destroy nodes in our graph by the resource they destroy
+	destroyers := make(map[string][]GraphNodeDestroyerCBD)
+	for _, v := range g.Vertices() {
+		dn, ok := v.(GraphNodeDestroyerCBD)
+		if !ok {
+			continue
+		}
+
+		key := cbdResourceKey(dn.DestroyAddr())
+		destroyers[key] = append(destroyers[key], dn)
+	}
+
+	upgraded := make(map[dag.Vertex]bool)
+	isCBD := func(key string) bool {
+		for _, dn := range destroyers[key] {
+			if dn.CreateBeforeDestroy() || upgraded[dn] {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	// Nothing to propagate if there are no CBD destroyers
+	found := false
+	for key := range destroyers {
+		if isCBD(key) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return upgraded, nil
+	}
+
+	// Build the graph of our config to determine which resources reference
+	// which, using the References of each resource.
+	cg, err := (&BasicGraphBuilder{
+		Steps: []GraphTransformer{
+			&FlatConfigTransformer{Module: t.Module},
+			&AttachResourceConfigTransformer{Module: t.Module},
+			&AttachStateTransformer{State: t.State},
+			&ReferenceTransformer{},
+		},
+		Name: "CBDEdgeTransformer",
+	}).Build(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for changed := true; changed; {
+		changed = false
+		for _, v := range cg.Vertices() {
+			rn, ok := v.(GraphNodeResource)
+			if !ok {
+				continue
+			}
+
+			// If this resource isn't being destroyed or is already CBD,
+			// there is nothing to do.
+			key := cbdResourceKey(rn.ResourceAddr())
+			if len(destroyers[key]) == 0 || isCBD(key) {
+				continue
+			}
+
+			// Look for a dependency that is CBD
+			for _, dep := range cg.DownEdges(v).List() {
+				depRn, ok := dep.(GraphNodeResource)
+				if !ok || !isCBD(cbdResourceKey(depRn.ResourceAddr())) {
+					continue
+				}
+
+				log.Printf(
+					"[TRACE] CBDEdgeTransformer: %s depends on CBD %s, enabling CBD",
+					key, dag.VertexName(dep))
+				for _, dn := range destroyers[key] {
+					if err := dn.ModifyCreateBeforeDestroy(true); err != nil {
+						return nil, fmt.Errorf(
+							"%s: must have create before destroy enabled because "+
+								"it depends on a resource with CBD enabled. However, "+
+								"when attempting to automatically do this, an error "+
+								"occurred: %s",
+							dag.VertexName(dn), err)
+					}
+
+					upgraded[dn] = true
+				}
+
+				changed = true
+				break
+			}
+		}
+	}
+
+	return upgraded, nil
+}
+
+// cbdResourceKey returns the key used to match destroy nodes to the
+// resources in the configuration. Destroy nodes may be for a specific
+// index, so the index is dropped to identify the resource as a whole.
+func cbdResourceKey(addr *ResourceAddress) string {
+	addr = addr.Copy()
+	addr.Index = -1
+	return addr.String()
+}
+
 // hasCBDAncestor returns true if any ancestor (node that depends on this)
 // has CBD set.
 func (t *CBDEdgeTransformer) hasCBDAncestor(g *Graph, v dag.Vertex) bool {
@@ -68,6 +68,38 @@ func TestCBDEdgeTransformer_depNonCBD(t *testing.T) {
 	}
 }
 
+func TestCBDEdgeTransformer_dependentNonCBD(t *testing.T) {
+	g := Graph{Path: RootModulePath}
+	g.Add(&graphNodeCreatorTest{AddrString: "test.A"})
+	g.Add(&graphNodeCreatorTest{AddrString: "test.B"})
+	g.Add(&graphNodeDestroyerTest{AddrString: "test.A", CBD: true})
+	g.Add(&graphNodeDestroyerTest{AddrString: "test.B"})
+
+	module := testModule(t, "transform-destroy-edge-basic")
+
+	{
+		tf := &DestroyEdgeTransformer{
+			Module: module,
+		}
+		if err := tf.Transform(&g); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	{
+		tf := &CBDEdgeTransformer{Module: module}
+		if err := tf.Transform(&g); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	actual := strings.TrimSpace(g.String())
+	expected := strings.TrimSpace(testTransformCBDEdgeDependentNonCBDStr)
+	if actual != expected {
+		t.Fatalf("bad:\n\n%s", actual)
+	}
+}
+
 const testTransformCBDEdgeBasicStr = `
 test.A
 test.A (destroy)
@@ -86,3 +118,14 @@ test.B
 test.B (destroy)
   test.B
 `
+
+const testTransformCBDEdgeDependentNonCBDStr = `
+test.A
+test.A (destroy)
+  test.A
+  test.B
+  test.B (destroy) (modified)
+test.B
+test.B (destroy) (modified)
+  test.B
+`
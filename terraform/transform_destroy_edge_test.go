@@ -78,6 +78,24 @@ func TestDestroyEdgeTransformer_selfRef(t *testing.T) {
 	}
 }
 
+func TestDestroyEdgeTransformer_connInfo(t *testing.T) {
+	g := Graph{Path: RootModulePath}
+	g.Add(&graphNodeDestroyerTest{AddrString: "test.bastion"})
+	g.Add(&graphNodeDestroyerTest{AddrString: "test.web"})
+	tf := &DestroyEdgeTransformer{
+		Module: testModule(t, "transform-destroy-edge-conn-info"),
+	}
+	if err := tf.Transform(&g); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(g.String())
+	expected := strings.TrimSpace(testTransformDestroyEdgeConnInfoStr)
+	if actual != expected {
+		t.Fatalf("bad:\n\n%s", actual)
+	}
+}
+
 func TestDestroyEdgeTransformer_module(t *testing.T) {
 	g := Graph{Path: RootModulePath}
 	g.Add(&graphNodeDestroyerTest{AddrString: "module.child.aws_instance.b"})
@@ -176,3 +194,9 @@ aws_instance.a (destroy)
 module.child.aws_instance.b (destroy)
   aws_instance.a (destroy)
 `
+
+const testTransformDestroyEdgeConnInfoStr = `
+test.bastion (destroy)
+  test.web (destroy)
+test.web (destroy)
+`
@@ -75,6 +75,25 @@ func (t *DiffTransformer) Transform(g *Graph) error {
 				nodes = append(nodes, node)
 			}
 		}
+
+		// Add the resources whose count couldn't be determined during
+		// plan. These are expanded during apply.
+		for _, name := range m.DeferredCount {
+			log.Printf("[TRACE] DiffTransformer: Deferred resource %q", name)
+
+			addr, err := parseResourceAddressInternal(name)
+			if err != nil {
+				panic(fmt.Sprintf(
+					"Error parsing internal name, this is a bug: %q", name))
+			}
+			addr.Path = m.Path[1:]
+
+			nodes = append(nodes, &NodeApplyableCountResource{
+				NodeAbstractCountResource: &NodeAbstractCountResource{
+					NodeAbstractResource: &NodeAbstractResource{Addr: addr},
+				},
+			})
+		}
 	}
 
 	// Add all the nodes to the graph
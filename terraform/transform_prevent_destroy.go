@@ -0,0 +1,81 @@
+package terraform
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// PreventDestroyTransformer is a GraphTransformer that checks the diff
+// being applied against the lifecycle.prevent_destroy setting of the
+// resources in the graph. Any resource with prevent_destroy set that the
+// diff would destroy, including a replacement, is an error.
+//
+// The check is done while the graph is built so that the apply fails
+// before anything is applied, rather than midway through the walk after
+// other resources were already changed. It must run after the
+// configuration is attached to the resource nodes.
+type PreventDestroyTransformer struct {
+	Diff *Diff
+}
+
+func (t *PreventDestroyTransformer) Transform(g *Graph) error {
+	if t.Diff.Empty() {
+		return nil
+	}
+
+	// The destroy and the create node of a replaced resource both
+	// point to the same diff, so only report each resource once.
+	var addrs []string
+	seen := make(map[string]struct{})
+	for _, v := range g.Vertices() {
+		var n *NodeAbstractResource
+		switch tv := v.(type) {
+		case *NodeApplyableResource:
+			n = tv.NodeAbstractResource
+		case *NodeDestroyResource:
+			n = tv.NodeAbstractResource
+		default:
+			continue
+		}
+
+		if n.Config == nil || !n.Config.Lifecycle.PreventDestroy {
+			continue
+		}
+
+		mod := t.Diff.ModuleByPath(normalizeModulePath(n.Addr.Path))
+		if mod == nil {
+			continue
+		}
+		diff, ok := mod.Resources[n.Addr.stateId()]
+		if !ok || diff == nil {
+			continue
+		}
+		if !diff.GetDestroy() && !diff.RequiresNew() {
+			continue
+		}
+
+		key := n.Addr.String()
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		addrs = append(addrs, key)
+	}
+
+	if len(addrs) == 0 {
+		return nil
+	}
+
+	sort.Strings(addrs)
+
+	var err error
+	for _, addr := range addrs {
+		log.Printf("[ERROR] PreventDestroyTransformer: %s would be destroyed", addr)
+		err = multierror.Append(err, fmt.Errorf(preventDestroyErrStr, addr))
+	}
+
+	return err
+}
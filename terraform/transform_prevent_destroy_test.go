@@ -0,0 +1,120 @@
+package terraform
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/dag"
+)
+
+func TestPreventDestroyTransformer(t *testing.T) {
+	cases := map[string]struct {
+		Diff *InstanceDiff
+		Err  bool
+	}{
+		"destroy": {
+			&InstanceDiff{Destroy: true},
+			true,
+		},
+
+		"replace": {
+			&InstanceDiff{
+				Destroy: true,
+				Attributes: map[string]*ResourceAttrDiff{
+					"require_new": &ResourceAttrDiff{
+						New:         "yes",
+						RequiresNew: true,
+					},
+				},
+			},
+			true,
+		},
+
+		"update": {
+			&InstanceDiff{
+				Attributes: map[string]*ResourceAttrDiff{
+					"require_new": &ResourceAttrDiff{
+						New: "yes",
+					},
+				},
+			},
+			false,
+		},
+	}
+
+	for k, tc := range cases {
+		mod := testModule(t, "plan-prevent-destroy-bad")
+		diff := &Diff{
+			Modules: []*ModuleDiff{
+				&ModuleDiff{
+					Path: rootModulePath,
+					Resources: map[string]*InstanceDiff{
+						"aws_instance.foo": tc.Diff,
+					},
+				},
+			},
+		}
+
+		g := Graph{Path: RootModulePath}
+		{
+			tf := &DiffTransformer{
+				Concrete: func(a *NodeAbstractResource) dag.Vertex {
+					return &NodeApplyableResource{NodeAbstractResource: a}
+				},
+				Module: mod,
+				Diff:   diff,
+			}
+			if err := tf.Transform(&g); err != nil {
+				t.Fatalf("%s: err: %s", k, err)
+			}
+		}
+		{
+			tf := &AttachResourceConfigTransformer{Module: mod}
+			if err := tf.Transform(&g); err != nil {
+				t.Fatalf("%s: err: %s", k, err)
+			}
+		}
+
+		tf := &PreventDestroyTransformer{Diff: diff}
+		err := tf.Transform(&g)
+		if (err != nil) != tc.Err {
+			t.Fatalf("%s: err: %s", k, err)
+		}
+		if err == nil {
+			continue
+		}
+
+		// A replacement has both a destroy and a create node, but the
+		// resource is only reported once.
+		if n := strings.Count(err.Error(), "aws_instance.foo:"); n != 1 {
+			t.Fatalf("%s: expected one error, got %d: %s", k, n, err)
+		}
+	}
+}
+
+func TestPreventDestroyTransformer_noConfig(t *testing.T) {
+	diff := &Diff{
+		Modules: []*ModuleDiff{
+			&ModuleDiff{
+				Path: rootModulePath,
+				Resources: map[string]*InstanceDiff{
+					"aws_instance.foo": &InstanceDiff{Destroy: true},
+				},
+			},
+		},
+	}
+
+	g := Graph{Path: RootModulePath}
+	{
+		tf := &DiffTransformer{Diff: diff}
+		if err := tf.Transform(&g); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	// Orphans have no configuration, so nothing prevents their destroy
+	tf := &PreventDestroyTransformer{Diff: diff}
+	if err := tf.Transform(&g); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
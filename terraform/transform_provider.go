@@ -3,6 +3,8 @@ package terraform
 import (
 	"fmt"
 	"log"
+	"reflect"
+	"sort"
 	"strings"
 
 	"github.com/hashicorp/go-multierror"
@@ -282,6 +284,105 @@ func (t *PruneProviderTransformer) Transform(g *Graph) error {
 	return nil
 }
 
+// GraphNodeProviderCoalescer is an interface that provider consumers can
+// implement to use another provider than the one they were configured
+// with. See CoalesceProviderTransformer.
+type GraphNodeProviderCoalescer interface {
+	GraphNodeProviderConsumer
+
+	// CoalesceProvider sets the name of the provider to use instead.
+	CoalesceProvider(string)
+}
+
+// CoalesceProviderTransformer is a GraphTransformer that shares a single
+// provider instance between the providers of the same type in a module
+// that have an identical configuration. The resources of the removed
+// providers are connected to the one that is kept, which is the first by
+// name.
+//
+// The configurations are compared before interpolation, but since they're
+// in the same module, identical configurations interpolate to the same
+// values. Providers without a configuration of their own and providers
+// that child modules inherit from are never removed, since their
+// configuration depends on more than what is in the module.
+//
+// This must be run after the provider configurations are attached and
+// the providers are connected to their consumers and children.
+type CoalesceProviderTransformer struct{}
+
+func (t *CoalesceProviderTransformer) Transform(g *Graph) error {
+	// Group the configured providers by module and type
+	groups := make(map[string][]*NodeApplyableProvider)
+	for _, v := range g.Vertices() {
+		pv, ok := v.(*NodeApplyableProvider)
+		if !ok || pv.Config == nil {
+			continue
+		}
+
+		ptype := strings.SplitN(pv.NameValue, ".", 2)[0]
+		key := fmt.Sprintf(
+			"%s.%s", strings.Join(normalizeModulePath(pv.PathValue), "."), ptype)
+		groups[key] = append(groups[key], pv)
+	}
+
+	for _, group := range groups {
+		if len(group) < 2 {
+			continue
+		}
+
+		sort.Sort(applyableProviderSort(group))
+		kept := make([]*NodeApplyableProvider, 0, len(group))
+		for _, pv := range group {
+			var into *NodeApplyableProvider
+			for _, k := range kept {
+				if reflect.DeepEqual(
+					k.Config.RawConfig.Raw, pv.Config.RawConfig.Raw) {
+					into = k
+					break
+				}
+			}
+			if into == nil || !t.coalesce(g, pv, into) {
+				kept = append(kept, pv)
+			}
+		}
+	}
+
+	return nil
+}
+
+// coalesce moves the consumers of the provider from to into, and removes
+// from. This returns false if from can't be removed.
+func (t *CoalesceProviderTransformer) coalesce(
+	g *Graph, from, into *NodeApplyableProvider) bool {
+	consumers := g.UpEdges(from).List()
+	for _, v := range consumers {
+		if _, ok := v.(GraphNodeProviderCoalescer); !ok {
+			// A child module provider inheriting the configuration, or
+			// something else we can't point to another provider.
+			return false
+		}
+	}
+
+	log.Printf(
+		"[DEBUG] Coalescing provider %s into %s", from.Name(), into.Name())
+	for _, v := range consumers {
+		v.(GraphNodeProviderCoalescer).CoalesceProvider(into.NameValue)
+		g.Connect(dag.BasicEdge(v, into))
+	}
+	g.Remove(from)
+
+	return true
+}
+
+// applyableProviderSort sorts providers by name.
+type applyableProviderSort []*NodeApplyableProvider
+
+func (s applyableProviderSort) Len() int      { return len(s) }
+func (s applyableProviderSort) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s applyableProviderSort) Less(i, j int) bool {
+	return s[i].NameValue < s[j].NameValue
+}
+
 // providerMapKey is a helper that gives us the key to use for the
 // maps returned by things such as providerVertexMap.
 func providerMapKey(k string, v dag.Vertex) string {
@@ -42,6 +42,43 @@ func TestProviderTransformer(t *testing.T) {
 	}
 }
 
+func TestProviderTransformer_alias(t *testing.T) {
+	mod := testModule(t, "transform-provider-alias")
+
+	g := Graph{Path: RootModulePath}
+	{
+		tf := &ConfigTransformer{Module: mod}
+		if err := tf.Transform(&g); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	{
+		transform := &AttachResourceConfigTransformer{Module: mod}
+		if err := transform.Transform(&g); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	{
+		transform := &MissingProviderTransformer{Providers: []string{"aws"}}
+		if err := transform.Transform(&g); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	transform := &ProviderTransformer{}
+	if err := transform.Transform(&g); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(g.String())
+	expected := strings.TrimSpace(testTransformProviderAliasStr)
+	if actual != expected {
+		t.Fatalf("bad:\n\n%s", actual)
+	}
+}
+
 func TestProviderTransformer_moduleChild(t *testing.T) {
 	g := Graph{Path: RootModulePath}
 
@@ -406,6 +443,18 @@ aws_instance.web
 provider.aws
 `
 
+const testTransformProviderAliasStr = `
+aws_instance.default
+  provider.aws
+aws_instance.east
+  provider.aws.east
+aws_instance.west
+  provider.aws.west
+provider.aws
+provider.aws.east
+provider.aws.west
+`
+
 const testTransformCloseProviderBasicStr = `
 aws_instance.web
   provider.aws
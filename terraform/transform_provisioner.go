@@ -58,6 +58,10 @@ func (t *ProvisionerTransformer) Transform(g *Graph) error {
 
 // MissingProvisionerTransformer is a GraphTransformer that adds nodes
 // for missing provisioners into the graph.
+//
+// This errors for every provisioner a node uses whose type isn't one of
+// Provisioners, so that an unknown provisioner is reported by validate
+// along with the resource and the index of the provisioner in it.
 type MissingProvisionerTransformer struct {
 	// Provisioners is the list of provisioners we support.
 	Provisioners []string
@@ -75,6 +79,7 @@ func (t *MissingProvisionerTransformer) Transform(g *Graph) error {
 
 	// Go through all the provisioner consumers and make sure we add
 	// that provisioner if it is missing.
+	var err error
 	for _, v := range g.Vertices() {
 		pv, ok := v.(GraphNodeProvisionerConsumer)
 		if !ok {
@@ -91,7 +96,16 @@ func (t *MissingProvisionerTransformer) Transform(g *Graph) error {
 			}
 		}
 
-		for _, p := range pv.ProvisionedBy() {
+		for i, p := range pv.ProvisionedBy() {
+			if _, ok := supported[p]; !ok {
+				// The same type may be used by more than one provisioner,
+				// so each is reported by its own index.
+				err = multierror.Append(err, fmt.Errorf(
+					"%s: provisioner %d: unknown provisioner type %q",
+					dag.VertexName(v), i, p))
+				continue
+			}
+
 			// Build the key for storing in the map
 			key := provisionerMapKey(p, pv)
 
@@ -100,12 +114,6 @@ func (t *MissingProvisionerTransformer) Transform(g *Graph) error {
 				continue
 			}
 
-			if _, ok := supported[p]; !ok {
-				// If we don't support the provisioner type, skip it.
-				// Validation later will catch this as an error.
-				continue
-			}
-
 			// Build the vertex
 			var newV dag.Vertex = &NodeProvisioner{
 				NameValue: p,
@@ -117,7 +125,7 @@ func (t *MissingProvisionerTransformer) Transform(g *Graph) error {
 		}
 	}
 
-	return nil
+	return err
 }
 
 // CloseProvisionerTransformer is a GraphTransformer that adds nodes to the
@@ -114,6 +114,39 @@ func TestMissingProvisionerTransformer_module(t *testing.T) {
 	}
 }
 
+func TestMissingProvisionerTransformer_unknown(t *testing.T) {
+	mod := testModule(t, "transform-provisioner-unknown")
+
+	g := Graph{Path: RootModulePath}
+	{
+		tf := &ConfigTransformer{Module: mod}
+		if err := tf.Transform(&g); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	{
+		transform := &AttachResourceConfigTransformer{Module: mod}
+		if err := transform.Transform(&g); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	transform := &MissingProvisionerTransformer{Provisioners: []string{"shell"}}
+	err := transform.Transform(&g)
+	if err == nil {
+		t.Fatal("should error")
+	}
+
+	expected := `aws_instance.web: provisioner 1: unknown provisioner type "foo"`
+	if !strings.Contains(err.Error(), expected) {
+		t.Fatalf("bad: %s", err)
+	}
+	if strings.Contains(err.Error(), `"shell"`) {
+		t.Fatalf("the duplicate known provisioner shouldn't error: %s", err)
+	}
+}
+
 func TestCloseProvisionerTransformer(t *testing.T) {
 	mod := testModule(t, "transform-provisioner-basic")
 
@@ -270,6 +270,32 @@ func ReferencesFromConfig(c *config.RawConfig) []string {
 	return result
 }
 
+// ReferencesFromConfigInModule returns the references that a configuration
+// in the module at the given path has, qualified with that module path.
+// Alternate references separated by "/" are each qualified, and references
+// to child module outputs ("module.foo.output.bar") resolve to the output
+// node of the child module.
+//
+// Graph nodes don't need this: ReferenceMap already qualifies References
+// with the Path of the node. This is for comparing references against
+// fully qualified names, such as those of GraphNodeReferenceGlobal nodes.
+func ReferencesFromConfigInModule(c *config.RawConfig, path []string) []string {
+	result := ReferencesFromConfig(c)
+
+	path = normalizeModulePath(path)
+	if len(path) <= 1 {
+		return result
+	}
+
+	prefix := modulePrefixStr(path)
+	for i, ref := range result {
+		parts := strings.Split(ref, "/")
+		result[i] = strings.Join(modulePrefixList(parts, prefix), "/")
+	}
+
+	return result
+}
+
 // ReferenceFromInterpolatedVar returns the reference from this variable,
 // or an empty string if there is no reference.
 func ReferenceFromInterpolatedVar(v config.InterpolatedVariable) []string {
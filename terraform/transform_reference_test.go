@@ -6,6 +6,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/hashicorp/terraform/config"
 	"github.com/hashicorp/terraform/dag"
 )
 
@@ -186,6 +187,130 @@ func TestReferenceTransformer_modulePathNormalized(t *testing.T) {
 	}
 }
 
+func TestReferenceTransformer_nestedModules(t *testing.T) {
+	rcWeb, err := config.NewRawConfig(map[string]interface{}{
+		"ip": "${module.b.ip}",
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	rcOutput, err := config.NewRawConfig(map[string]interface{}{
+		"value": "${aws_instance.db.id}",
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	rcEmpty, err := config.NewRawConfig(map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var g Graph
+	g.Add(&NodeAbstractResource{
+		Addr: &ResourceAddress{
+			Path:  []string{"a"},
+			Type:  "aws_instance",
+			Name:  "web",
+			Index: -1,
+			Mode:  config.ManagedResourceMode,
+		},
+		Config: &config.Resource{
+			Name:      "web",
+			Type:      "aws_instance",
+			RawCount:  rcEmpty,
+			RawConfig: rcWeb,
+		},
+	})
+	g.Add(&NodeApplyableOutput{
+		PathValue: []string{"root", "a", "b"},
+		Config: &config.Output{
+			Name:      "ip",
+			RawConfig: rcOutput,
+		},
+	})
+	for _, path := range [][]string{nil, []string{"a", "b"}} {
+		g.Add(&NodeAbstractResource{
+			Addr: &ResourceAddress{
+				Path:  path,
+				Type:  "aws_instance",
+				Name:  "db",
+				Index: -1,
+				Mode:  config.ManagedResourceMode,
+			},
+			Config: &config.Resource{
+				Name:      "db",
+				Type:      "aws_instance",
+				RawCount:  rcEmpty,
+				RawConfig: rcEmpty,
+			},
+		})
+	}
+
+	tf := &ReferenceTransformer{}
+	if err := tf.Transform(&g); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	actual := strings.TrimSpace(g.String())
+	expected := strings.TrimSpace(testTransformRefNestedModulesStr)
+	if actual != expected {
+		t.Fatalf("bad:\n\n%s", actual)
+	}
+}
+
+func TestReferencesFromConfigInModule(t *testing.T) {
+	rc, err := config.NewRawConfig(map[string]interface{}{
+		"instance": "${aws_instance.foo.id}",
+		"module":   "${module.b.ip}",
+		"var":      "${var.foo}",
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	cases := map[string]struct {
+		Path   []string
+		Result []string
+	}{
+		"root": {
+			RootModulePath,
+			[]string{
+				"aws_instance.foo.0/aws_instance.foo.N",
+				"module.b.output.ip",
+				"var.foo",
+			},
+		},
+
+		"child": {
+			[]string{"root", "a"},
+			[]string{
+				"module.a.aws_instance.foo.0/module.a.aws_instance.foo.N",
+				"module.a.module.b.output.ip",
+				"module.a.var.foo",
+			},
+		},
+
+		"grandchild, not normalized": {
+			[]string{"a", "c"},
+			[]string{
+				"module.a.module.c.aws_instance.foo.0/module.a.module.c.aws_instance.foo.N",
+				"module.a.module.c.module.b.output.ip",
+				"module.a.module.c.var.foo",
+			},
+		},
+	}
+
+	for tn, tc := range cases {
+		t.Run(tn, func(t *testing.T) {
+			result := ReferencesFromConfigInModule(rc, tc.Path)
+			sort.Strings(result)
+			if !reflect.DeepEqual(result, tc.Result) {
+				t.Fatalf("bad: %#v", result)
+			}
+		})
+	}
+}
+
 func TestReferenceMapReferences(t *testing.T) {
 	cases := map[string]struct {
 		Nodes  []dag.Vertex
@@ -327,3 +452,12 @@ child.A
 child.B
   child.A
 `
+
+const testTransformRefNestedModulesStr = `
+aws_instance.db
+module.a.aws_instance.web
+  module.a.module.b.output.ip
+module.a.module.b.aws_instance.db
+module.a.module.b.output.ip
+  module.a.module.b.aws_instance.db
+`
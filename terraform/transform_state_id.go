@@ -0,0 +1,84 @@
+package terraform
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// StateIdTransformer is a GraphTransformer that errors if two resources
+// that are created or updated resolve to the same state ID in a module,
+// since they would silently overwrite each other in the state. It runs
+// while the graph is built, so that nothing is applied if they do.
+//
+// Every node in the graph has its own address, so two nodes with equal
+// addresses still collide. That happens, for example, when a diff has
+// both aws_instance.foo.1 and aws_instance.foo.01.
+type StateIdTransformer struct{}
+
+func (t *StateIdTransformer) Transform(g *Graph) error {
+	// Group the addresses by module and state ID
+	groups := make(map[string][]*ResourceAddress)
+	for _, v := range g.Vertices() {
+		cn, ok := v.(GraphNodeCreator)
+		if !ok {
+			continue
+		}
+
+		addr := cn.CreateAddr()
+		if addr == nil {
+			continue
+		}
+
+		key := strings.Join(addr.Path, ".") + "|" + addr.stateId()
+		groups[key] = append(groups[key], addr)
+	}
+
+	keys := make([]string, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var err error
+	for _, k := range keys {
+		addrs := groups[k]
+		if len(addrs) < 2 {
+			continue
+		}
+
+		sort.Sort(resourceAddressesByString(addrs))
+		err = multierror.Append(err, stateIdCollisionError(addrs))
+	}
+
+	return err
+}
+
+// stateIdCollisionError returns the error for the sorted addresses that
+// resolve to the same state ID.
+func stateIdCollisionError(addrs []*ResourceAddress) error {
+	id := addrs[0].stateId()
+	for _, addr := range addrs[1:] {
+		if addr.String() != addrs[0].String() {
+			return fmt.Errorf(
+				"%s and %s both resolve to the state ID %q, so they would "+
+					"overwrite each other in the state",
+				addrs[0], addr, id)
+		}
+	}
+
+	return fmt.Errorf(
+		"%s is in the graph more than once with the state ID %q, so "+
+			"the instances would overwrite each other in the state. "+
+			"This is a bug in Terraform or the plan was modified.",
+		addrs[0], id)
+}
+
+// resourceAddressesByString sorts addresses by their string form.
+type resourceAddressesByString []*ResourceAddress
+
+func (s resourceAddressesByString) Len() int           { return len(s) }
+func (s resourceAddressesByString) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s resourceAddressesByString) Less(i, j int) bool { return s[i].String() < s[j].String() }
@@ -0,0 +1,92 @@
+package terraform
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/config"
+)
+
+func TestStateIdTransformer(t *testing.T) {
+	// An instance of a counted resource
+	counted := &ResourceAddress{
+		Type:  "aws_instance",
+		Name:  "foo",
+		Index: 1,
+		Mode:  config.ManagedResourceMode,
+	}
+
+	// A resource whose name happens to produce the same state ID
+	dotted := &ResourceAddress{
+		Type:  "aws_instance",
+		Name:  "foo.1",
+		Index: -1,
+		Mode:  config.ManagedResourceMode,
+	}
+
+	// Another instance with the same address
+	duplicate := &ResourceAddress{
+		Type:  "aws_instance",
+		Name:  "foo",
+		Index: 1,
+		Mode:  config.ManagedResourceMode,
+	}
+
+	// The same state ID in another module
+	child := &ResourceAddress{
+		Path:  []string{"child"},
+		Type:  "aws_instance",
+		Name:  "foo",
+		Index: 1,
+		Mode:  config.ManagedResourceMode,
+	}
+
+	cases := map[string]struct {
+		Addrs []*ResourceAddress
+		Err   string
+	}{
+		"no collision": {
+			[]*ResourceAddress{counted, child},
+			"",
+		},
+
+		"different addresses": {
+			[]*ResourceAddress{counted, dotted},
+			`aws_instance.foo.1 and aws_instance.foo[1] both resolve to the state ID "aws_instance.foo.1"`,
+		},
+
+		"same address": {
+			[]*ResourceAddress{counted, duplicate},
+			"aws_instance.foo[1] is in the graph more than once",
+		},
+	}
+
+	for k, tc := range cases {
+		g := Graph{Path: RootModulePath}
+		for _, addr := range tc.Addrs {
+			g.Add(&testStateIdNode{Addr: addr})
+		}
+
+		err := (&StateIdTransformer{}).Transform(&g)
+		if tc.Err == "" {
+			if err != nil {
+				t.Fatalf("%s: err: %s", k, err)
+			}
+			continue
+		}
+
+		if err == nil {
+			t.Fatalf("%s: should error", k)
+		}
+		if !strings.Contains(err.Error(), tc.Err) {
+			t.Fatalf("%s: bad: %s", k, err)
+		}
+	}
+}
+
+type testStateIdNode struct {
+	Addr *ResourceAddress
+}
+
+func (n *testStateIdNode) Name() string                 { return n.Addr.String() }
+func (n *testStateIdNode) CreateAddr() *ResourceAddress { return n.Addr }
@@ -15,6 +15,15 @@ type GraphNodeTargetable interface {
 	SetTargets([]ResourceAddress)
 }
 
+// GraphNodeTargetContainer is an interface for graph nodes to implement
+// when they want to decide for themselves whether they are addressed by a
+// target, rather than relying on ResourceAddress.Equals. This allows nodes
+// that represent a single resource instance to match targets precisely,
+// including the index and module path of the target.
+type GraphNodeTargetContainer interface {
+	TargetContains(*ResourceAddress) bool
+}
+
 // TargetsTransformer is a GraphTransformer that, when the user specifies a
 // list of resources to target, limits the graph to only those resources and
 // their dependencies.
@@ -117,6 +126,16 @@ func (t *TargetsTransformer) selectTargetedNodes(
 
 func (t *TargetsTransformer) nodeIsTarget(
 	v dag.Vertex, addrs []ResourceAddress) bool {
+	if tc, ok := v.(GraphNodeTargetContainer); ok {
+		for i := range addrs {
+			if tc.TargetContains(&addrs[i]) {
+				return true
+			}
+		}
+
+		return false
+	}
+
 	r, ok := v.(GraphNodeResource)
 	if !ok {
 		return false
@@ -97,3 +97,67 @@ aws_instance.metoo
 		t.Fatalf("bad:\n\nexpected:\n%s\n\ngot:\n%s\n", expected, actual)
 	}
 }
+
+func TestTargetsTransformer_applyableResource(t *testing.T) {
+	cases := map[string]struct {
+		Targets  []string
+		Expected string
+	}{
+		"indexed target": {
+			[]string{"aws_instance.web[2]"},
+			`aws_instance.web[2]`,
+		},
+		"resource target pulls in all indices": {
+			[]string{"aws_instance.web"},
+			`
+aws_instance.web[0]
+aws_instance.web[1]
+aws_instance.web[2]`,
+		},
+		"module target includes descendants": {
+			[]string{"module.child"},
+			`
+module.child.aws_instance.web[2]
+module.child.module.grandchild.aws_instance.web`,
+		},
+		"non-matching target": {
+			[]string{"aws_instance.web[5]"},
+			``,
+		},
+	}
+
+	for tn, tc := range cases {
+		g := Graph{Path: RootModulePath}
+		for _, raw := range []struct {
+			Path []string
+			Name string
+		}{
+			{nil, "aws_instance.web.0"},
+			{nil, "aws_instance.web.1"},
+			{nil, "aws_instance.web.2"},
+			{[]string{"child"}, "aws_instance.web.2"},
+			{[]string{"child", "grandchild"}, "aws_instance.web"},
+		} {
+			addr, err := parseResourceAddressInternal(raw.Name)
+			if err != nil {
+				t.Fatalf("%s: err: %s", tn, err)
+			}
+			addr.Path = raw.Path
+
+			g.Add(&NodeApplyableResource{
+				NodeAbstractResource: &NodeAbstractResource{Addr: addr},
+			})
+		}
+
+		transform := &TargetsTransformer{Targets: tc.Targets}
+		if err := transform.Transform(&g); err != nil {
+			t.Fatalf("%s: err: %s", tn, err)
+		}
+
+		actual := strings.TrimSpace(g.String())
+		expected := strings.TrimSpace(tc.Expected)
+		if actual != expected {
+			t.Fatalf("%s: bad:\n\nexpected:\n%s\n\ngot:\n%s\n", tn, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package terraform
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/terraform/dag"
+)
+
+// unreachableResourceWarnings returns the warnings about the resources of
+// child modules in the validate graph g that don't reference anything and
+// that nothing references, for ContextOpts.ValidateUnreachable. Nothing
+// else in the configuration uses such a resource, so it may be dead
+// configuration left behind. The resources of the root module are never
+// reported, since standalone resources are common there.
+func unreachableResourceWarnings(g *Graph) []string {
+	vs := g.Vertices()
+	m := NewReferenceMap(vs)
+
+	// The references are resolved from the referencing side, since that
+	// is where the alternatives of a reference, such as the specific
+	// index or the whole resource, are resolved.
+	connected := make(map[dag.Vertex]struct{})
+	for _, v := range vs {
+		refs, _ := m.References(v)
+		if len(refs) > 0 {
+			connected[v] = struct{}{}
+		}
+		for _, ref := range refs {
+			connected[ref] = struct{}{}
+		}
+	}
+
+	var addrs []string
+	for _, v := range vs {
+		rn, ok := v.(*NodeValidatableResource)
+		if !ok || rn.Config == nil || len(normalizeModulePath(rn.Path())) <= 1 {
+			continue
+		}
+		if _, ok := connected[v]; ok {
+			continue
+		}
+
+		addrs = append(addrs, rn.Addr.String())
+	}
+	sort.Strings(addrs)
+
+	result := make([]string, len(addrs))
+	for i, addr := range addrs {
+		result[i] = fmt.Sprintf(
+			"%s: doesn't reference anything in its module and nothing "+
+				"references it, so it may be unused", addr)
+	}
+
+	return result
+}